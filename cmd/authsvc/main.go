@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mkrupp/homecase-michael/internal/infra/bootstrap"
 	"github.com/mkrupp/homecase-michael/internal/infra/config"
+	"github.com/mkrupp/homecase-michael/internal/infra/container"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/startup"
 	"github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
 	"github.com/mkrupp/homecase-michael/internal/repo/user"
 	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
 )
@@ -17,13 +28,23 @@ const (
 	svcName = "authsvc"
 )
 
+var (
+	errUnknownCommand = fmt.Errorf("%w: unknown command", bootstrap.ErrConfig)
+	errInvalidArgs    = fmt.Errorf("%w: invalid arguments", bootstrap.ErrConfig)
+)
+
 type Config struct {
 	config.EnvConfig
 
-	Log  logging.LoggerConfig            `envPrefix:"LOG_"`
-	Auth authsvc.AuthConfig              `envPrefix:"AUTH_"`
-	HTTP authsvc.HTTPTransportConfig     `envPrefix:"HTTP_"`
-	User user.SQLiteUserRepositoryConfig `envPrefix:"USER_"`
+	Log       logging.LoggerConfig            `envPrefix:"LOG_"`
+	Auth      authsvc.AuthConfig              `envPrefix:"AUTH_"`
+	HTTP      authsvc.HTTPTransportConfig     `envPrefix:"HTTP_"`
+	User      user.SQLiteUserRepositoryConfig `envPrefix:"USER_"`
+	Throttle  throttle.Config                 `envPrefix:"THROTTLE_"`
+	Flags     featureflags.Config             `envPrefix:"FLAGS_"`
+	OAuth     authsvc.OAuthConfig             `envPrefix:"OAUTH_"`
+	Challenge authsvc.ChallengeConfig         `envPrefix:"CHALLENGE_"`
+	Startup   startup.Config                  `envPrefix:"STARTUP_"`
 }
 
 func main() {
@@ -35,15 +56,94 @@ func main() {
 		loggerName   = strings.ToLower(strings.Join([]string{appName, svcName}, "."))
 	)
 
-	if err := config.Parse(ctx, &cfg, configPrefix); err != nil {
-		panic(err)
-	}
+	bootstrap.ExitOnError(svcName, bootstrap.ConfigError(config.Parse(ctx, &cfg, configPrefix)))
 
 	logging.Configure(ctx, cfg.Log, loggerName)
 
-	if err := run(ctx, cfg); err != nil {
-		panic(err)
+	// Administrative commands run instead of the service
+	if len(os.Args) > 1 {
+		bootstrap.ExitOnError(svcName, runCommand(ctx, cfg, os.Args[1], os.Args[2:]))
+
+		return
+	}
+
+	bootstrap.ExitOnError(svcName, run(ctx, cfg))
+}
+
+// runCommand runs an administrative command supporting the password hash migration:
+// - password-report: Print the password hash report as JSON
+// - rehash-legacy-passwords: Wrap legacy SHA-256 hashes into hashes of the configured hasher
+// - expire-stale-accounts <days>: Expire accounts needing a rehash without login for <days>
+// - set-roles <username> [<role>,...]: Replace the roles of a user, removing all if none are given.
+func runCommand(ctx context.Context, cfg Config, command string, args []string) error {
+	commands := []string{"password-report", "rehash-legacy-passwords", "expire-stale-accounts", "set-roles"}
+	if !slices.Contains(commands, command) {
+		return fmt.Errorf("%w: %q", errUnknownCommand, command)
+	}
+
+	// Administrative commands do not log in, so the login lockout is not needed.
+	authSvc, err := authsvc.NewAuthService(user.SQLiteUserRepositoryFactory(cfg.User), nil, cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("new auth service: %w", authServiceError(err))
+	}
+	defer authSvc.Close()
+
+	var result any
+
+	switch command {
+	case "password-report":
+		result, err = authSvc.PasswordHashReport(ctx)
+	case "rehash-legacy-passwords":
+		result, err = authSvc.RehashLegacyPasswords(ctx)
+	case "expire-stale-accounts":
+		if len(args) != 1 {
+			return fmt.Errorf("%s: %w: expected <days>", command, errInvalidArgs)
+		}
+
+		days, parseErr := strconv.Atoi(args[0])
+		if parseErr != nil || days <= 0 {
+			return fmt.Errorf("%s: %w: invalid days %q", command, errInvalidArgs, args[0])
+		}
+
+		result, err = authSvc.ExpireStaleAccounts(ctx, time.Duration(days)*24*time.Hour)
+	case "set-roles":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("%s: %w: expected <username> [<role>,...]", command, errInvalidArgs)
+		}
+
+		roles := []string{}
+		if len(args) == 2 && args[1] != "" {
+			roles = strings.Split(args[1], ",")
+		}
+
+		err = authSvc.SetRoles(ctx, args[0], roles)
+		result = map[string]any{"username": args[0], "roles": roles}
+	default:
+		return fmt.Errorf("%w: %q", errUnknownCommand, command)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", command, err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("encode result: %w", err)
+	}
+
+	return nil
+}
+
+// authServiceError categorizes an error returned by authsvc.NewAuthService:
+// An unknown password hasher as ErrConfig, anything else as ErrStorage.
+func authServiceError(err error) error {
+	if errors.Is(err, authsvc.ErrUnknownPasswordHasher) {
+		return bootstrap.Wrap(bootstrap.ErrConfig, err)
 	}
+
+	return bootstrap.Wrap(bootstrap.ErrStorage, err)
 }
 
 func run(ctx context.Context, cfg Config) (err error) {
@@ -52,25 +152,167 @@ func run(ctx context.Context, cfg Config) (err error) {
 
 		if err != nil {
 			log.ErrorContext(ctx, "error", "err", err)
-			panic(err)
+		} else {
+			log.InfoContext(ctx, "shutdown")
 		}
+	}()
 
-		log.InfoContext(ctx, "shutdown")
+	c := newContainer(cfg)
+
+	defer func() {
+		err = errors.Join(err, c.Stop(context.WithoutCancel(ctx)))
 	}()
 
-	authSvc, err := authsvc.NewAuthService(
-		user.SQLiteUserRepositoryFactory(cfg.User),
-		cfg.Auth,
-	)
+	httpTransport, err := container.Resolve[*authsvc.HTTPTransport](ctx, c)
 	if err != nil {
-		return fmt.Errorf("new auth service: %w", err)
+		return err
 	}
 
-	httpTransport := authsvc.NewHTTPTransport(authSvc, cfg.HTTP)
+	if err := c.Start(ctx); err != nil {
+		return err
+	}
 
 	if err := http.ListenAndServe(ctx, httpTransport, cfg.HTTP.HTTPTransportConfig); err != nil {
-		return fmt.Errorf("listen and serve: %w", err)
+		return fmt.Errorf("listen and serve: %w", bootstrap.ServeError(err))
 	}
 
 	return nil
 }
+
+// newContainer registers the constructors of the auth service components.
+func newContainer(cfg Config) *container.Container {
+	c := container.New()
+
+	provideOrchestrator(c, cfg)
+	provideThrottleStore(c, cfg)
+	provideFeatureFlags(c, cfg)
+	provideAuthService(c, cfg)
+	provideHTTPTransport(c, cfg)
+
+	return c
+}
+
+// provideOrchestrator registers the constructor of the startup orchestrator,
+// which probes the storage when constructed.
+func provideOrchestrator(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, _ *container.Container) (*startup.Orchestrator, error) {
+		orchestrator := startup.NewOrchestrator(cfg.Startup)
+		orchestrator.Add(startup.Dependency{
+			Name: "storage",
+			Probe: func(ctx context.Context) error {
+				return bootstrap.Wrap(bootstrap.ErrStorage, user.ProbeSQLiteDatabase(ctx, cfg.User))
+			},
+			Required: true,
+		})
+
+		if err := orchestrator.Run(ctx); err != nil {
+			return nil, fmt.Errorf("startup: %w", err)
+		}
+
+		return orchestrator, nil
+	})
+}
+
+// provideThrottleStore registers the constructor of the throttle store of the login
+// lockout and rate limits.
+func provideThrottleStore(c *container.Container, cfg Config) {
+	container.Provide(c, func(_ context.Context, c *container.Container) (throttle.Store, error) {
+		throttleStore, err := throttle.NewStore(cfg.Throttle)
+		if err != nil {
+			return nil, fmt.Errorf("new throttle store: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		}
+
+		c.Append(container.Closer("throttle store", throttleStore))
+
+		return throttleStore, nil
+	})
+}
+
+// provideFeatureFlags registers the constructor of the feature flags, refreshed in the
+// background once started.
+func provideFeatureFlags(c *container.Container, cfg Config) {
+	container.Provide(c, func(_ context.Context, c *container.Container) (*featureflags.Store, error) {
+		flags, err := featureflags.NewStore(cfg.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("new feature flags: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		}
+
+		c.Append(container.Background("feature flags", flags.Run))
+
+		return flags, nil
+	})
+}
+
+// provideAuthService registers the constructor of the auth service, constructed after
+// the storage is available.
+func provideAuthService(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (*authsvc.AuthService, error) {
+		if _, err := container.Resolve[*startup.Orchestrator](ctx, c); err != nil {
+			return nil, err
+		}
+
+		throttleStore, err := container.Resolve[throttle.Store](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		flags, err := container.Resolve[*featureflags.Store](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		authSvc, err := authsvc.NewAuthService(
+			user.SQLiteUserRepositoryFactory(cfg.User),
+			throttleStore,
+			cfg.Auth,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new auth service: %w", authServiceError(err))
+		}
+
+		authSvc.Flags = flags
+
+		c.Append(container.Closer("auth service", authSvc))
+
+		return authSvc, nil
+	})
+}
+
+// provideHTTPTransport registers the constructor of the HTTP transport of the auth service.
+func provideHTTPTransport(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (*authsvc.HTTPTransport, error) {
+		authSvc, err := container.Resolve[*authsvc.AuthService](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		httpTransport := authsvc.NewHTTPTransport(authSvc, cfg.HTTP)
+
+		// The OAuth2 endpoints are served if clients are registered
+		if cfg.OAuth.Clients != "" {
+			oauth, err := authsvc.NewOAuthServer(authSvc, cfg.OAuth)
+			if err != nil {
+				return nil, fmt.Errorf("new oauth server: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+			}
+
+			httpTransport.SetOAuthServer(oauth)
+		}
+
+		// Registrations and repeatedly failing logins are challenged if a provider is configured
+		challenge, err := authsvc.NewChallengeVerifier(cfg.Challenge)
+		if err != nil {
+			return nil, fmt.Errorf("new challenge verifier: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		} else if challenge != nil {
+			httpTransport.SetChallengeVerifier(challenge, cfg.Challenge)
+		}
+
+		responseCache, err := http.NewResponseCache(cfg.HTTP.ResponseCache, httpTransport.CacheableRoutes())
+		if err != nil {
+			return nil, fmt.Errorf("new response cache: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		}
+
+		httpTransport.SetResponseCache(responseCache)
+
+		return httpTransport, nil
+	})
+}
@@ -2,13 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
 
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/bootstrap"
 	"github.com/mkrupp/homecase-michael/internal/infra/config"
+	"github.com/mkrupp/homecase-michael/internal/infra/container"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/faults"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/startup"
 	"github.com/mkrupp/homecase-michael/internal/infra/transport/http"
 	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/repo/metaindex"
 	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
 	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
 	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
@@ -17,8 +29,13 @@ import (
 const (
 	appName = "demo"
 	svcName = "imagesvc"
+
+	// reprocessLogInterval is the number of images between progress reports of the reprocess command.
+	reprocessLogInterval = 100
 )
 
+var errIndexDisabled = fmt.Errorf("%w: index disabled, set INDEX_DATABASE_PATH", bootstrap.ErrConfig)
+
 type Config struct {
 	config.EnvConfig
 
@@ -27,7 +44,23 @@ type Config struct {
 	Image      imagesvc.ImageConfig                `envPrefix:"IMAGE_"`
 	ImageHTTP  imagesvc.HTTPTransportConfig        `envPrefix:"IMAGE_HTTP_"`
 	AuthClient authclient.HTTPClientConfig         `envPrefix:"AUTH_CLIENT_"`
+	AuthLocal  authclient.PublicKeyClientConfig    `envPrefix:"AUTH_LOCAL_"`
 	Blob       blob.FileSystemBlobRepositoryConfig `envPrefix:"BLOB_"`
+	BlobTrace  blob.TracingConfig                  `envPrefix:"BLOB_TRACING_"`
+	Index      metaindex.SQLiteIndexConfig         `envPrefix:"INDEX_"`
+	Flags      featureflags.Config                 `envPrefix:"FLAGS_"`
+	Faults     faults.Config                       `envPrefix:"FAULTS_"`
+	Startup    startup.Config                      `envPrefix:"STARTUP_"`
+
+	// AuthMode selects how tokens are validated: "http" by requests to the auth service,
+	// "local" using its public key
+	AuthMode string `env:"AUTH_MODE" default:"http"`
+}
+
+// probedAuthClient is an auth client whose availability is probed at startup.
+type probedAuthClient interface {
+	authclient.AuthClient
+	Probe(ctx context.Context) error
 }
 
 func main() {
@@ -39,15 +72,121 @@ func main() {
 		loggerName   = strings.ToLower(strings.Join([]string{appName, svcName}, "."))
 	)
 
-	if err := config.Parse(ctx, &cfg, configPrefix); err != nil {
-		panic(err)
-	}
+	bootstrap.ExitOnError(svcName, bootstrap.ConfigError(config.Parse(ctx, &cfg, configPrefix)))
 
 	logging.Configure(ctx, cfg.Log, loggerName)
 
-	if err := run(ctx, cfg); err != nil {
-		panic(err)
+	// "rebuild-index" rebuilds the metadata index from the metadata blobs and exits
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-index" {
+		bootstrap.ExitOnError(svcName, rebuildIndex(ctx, cfg))
+
+		return
+	}
+
+	// "reprocess" runs processors on the stored images and exits
+	if len(os.Args) > 1 && os.Args[1] == "reprocess" {
+		bootstrap.ExitOnError(svcName, reprocess(ctx, cfg, os.Args[2:]))
+
+		return
+	}
+
+	bootstrap.ExitOnError(svcName, run(ctx, cfg))
+}
+
+// rebuildIndex replaces the contents of the metadata index by the metadata of all stored media.
+func rebuildIndex(ctx context.Context, cfg Config) error {
+	if cfg.Index.DatabasePath == "" {
+		return fmt.Errorf("rebuild index: %w", errIndexDisabled)
+	}
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(ctx, blob.FileSystemBlobRepositoryFactory(cfg.Blob), cfg.Media)
+	if err != nil {
+		return fmt.Errorf("new media service: %w", bootstrap.Wrap(bootstrap.ErrStorage, err))
+	}
+
+	index, err := metaindex.NewSQLiteIndex(cfg.Index)
+	if err != nil {
+		return fmt.Errorf("new index: %w", bootstrap.Wrap(bootstrap.ErrStorage, err))
+	}
+	defer index.Close()
+
+	mediaSvc.SetIndex(index)
+
+	if _, err := mediaSvc.RebuildIndex(ctx); err != nil {
+		return fmt.Errorf("rebuild index: %w", err)
+	}
+
+	return nil
+}
+
+// reprocess runs the processors named by args on the stored images, reporting the progress
+// every reprocessLogInterval images. Interrupting stops after the current image.
+func reprocess(ctx context.Context, cfg Config, args []string) error {
+	var (
+		req   domain.MediaReprocessRequest
+		flags = flag.NewFlagSet("reprocess", flag.ContinueOnError)
+
+		processors = flags.String("processors", "", "comma-separated, ordered processors to run, e.g. exif_strip,optimize")
+	)
+
+	flags.StringVar(&req.Owner, "owner", "", "only reprocess the images of this user")
+	flags.IntVar(&req.Rate, "rate", 0, "maximum number of images per second, IMAGE_REPROCESS_RATE if 0")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse arguments: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+	}
+
+	for _, name := range strings.Split(*processors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			req.Processors = append(req.Processors, name)
+		}
+	}
+
+	blobFactory := blob.FileSystemBlobRepositoryFactory(cfg.Blob)
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(ctx, blobFactory, cfg.Media)
+	if err != nil {
+		return fmt.Errorf("new media service: %w", bootstrap.Wrap(bootstrap.ErrStorage, err))
+	}
+
+	// Keep the index in sync with the replaced images
+	if cfg.Index.DatabasePath != "" {
+		index, err := metaindex.NewSQLiteIndex(cfg.Index)
+		if err != nil {
+			return fmt.Errorf("new index: %w", bootstrap.Wrap(bootstrap.ErrStorage, err))
+		}
+		defer index.Close()
+
+		mediaSvc.SetIndex(index)
+	}
+
+	imageSvc, err := imagesvc.NewBlobImageService(ctx, blobFactory, mediaSvc, nil, cfg.Image)
+	if err != nil {
+		return fmt.Errorf("new image service: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+	}
+
+	ctx, stop := signal.NotifyContext(context_.WithAdminAccess(ctx), os.Interrupt)
+	defer stop()
+
+	log := logging.GetLogger("cmd.imagesvc")
+
+	status, err := imageSvc.Reprocess(ctx, req, func(progress domain.MediaReprocessStatus) {
+		if progress.Processed%reprocessLogInterval == 0 {
+			log.InfoContext(ctx, "reprocess progress", "processed", progress.Processed, "total", progress.Total,
+				"changed", progress.Changed, "failed", progress.Failed)
+		}
+	})
+	if errors.Is(err, imagesvc.ErrInvalidProcessorChain) {
+		return fmt.Errorf("reprocess: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+	} else if err != nil {
+		return fmt.Errorf("reprocess: %w", err)
+	}
+
+	for oldID, newID := range status.Replaced {
+		log.InfoContext(ctx, "image replaced", "id", oldID, "newID", newID)
 	}
+
+	return nil
 }
 
 func run(ctx context.Context, cfg Config) (err error) {
@@ -56,39 +195,280 @@ func run(ctx context.Context, cfg Config) (err error) {
 
 		if err != nil {
 			log.ErrorContext(ctx, "error", "err", err)
-			panic(err)
+		} else {
+			log.InfoContext(ctx, "shutdown")
 		}
-
-		log.InfoContext(ctx, "shutdown")
 	}()
 
-	mediaSvc, err := mediasvc.NewBlobMediaService(
-		ctx,
-		blob.FileSystemBlobRepositoryFactory(cfg.Blob),
-		cfg.Media,
-	)
-	if err != nil {
-		return fmt.Errorf("new media service: %w", err)
-	}
+	c := newContainer(cfg)
 
-	authClient := authclient.NewHTTPClient(cfg.AuthClient, nil)
+	defer func() {
+		err = errors.Join(err, c.Stop(context.WithoutCancel(ctx)))
+	}()
 
-	imageSvc, err := imagesvc.NewBlobImageService(
-		ctx,
-		blob.FileSystemBlobRepositoryFactory(cfg.Blob),
-		mediaSvc,
-		authClient,
-		cfg.Image,
-	)
+	httpTransport, err := container.Resolve[*imagesvc.HTTPTransport](ctx, c)
 	if err != nil {
-		return fmt.Errorf("new image service: %w", err)
+		return err
 	}
 
-	httpTransport := imagesvc.NewHTTPTransport(imageSvc, authClient, cfg.ImageHTTP)
+	if err := c.Start(ctx); err != nil {
+		return err
+	}
 
 	if err := http.ListenAndServe(ctx, httpTransport, cfg.ImageHTTP.HTTPTransportConfig); err != nil {
-		return fmt.Errorf("listen and serve: %w", err)
+		return fmt.Errorf("listen and serve: %w", bootstrap.ServeError(err))
 	}
 
 	return nil
 }
+
+// newContainer registers the constructors of the image service components.
+func newContainer(cfg Config) *container.Container {
+	c := container.New()
+
+	provideFeatureFlags(c, cfg)
+	provideAuthClients(c, cfg)
+	provideBlobFactory(c, cfg)
+	provideOrchestrator(c, cfg)
+	provideMediaService(c, cfg)
+	provideImageService(c, cfg)
+	provideHTTPTransport(c, cfg)
+
+	return c
+}
+
+// provideFeatureFlags registers the constructor of the feature flags, refreshed in the
+// background once started.
+func provideFeatureFlags(c *container.Container, cfg Config) {
+	container.Provide(c, func(_ context.Context, c *container.Container) (*featureflags.Store, error) {
+		flags, err := featureflags.NewStore(cfg.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("new feature flags: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		}
+
+		c.Append(container.Background("feature flags", flags.Run))
+
+		return flags, nil
+	})
+}
+
+// provideAuthClients registers the constructors of the fault injector, the auth client
+// probed at startup, and the auth client of the services, which is subject to fault injection.
+func provideAuthClients(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, _ *container.Container) (*faults.Injector, error) {
+		injector := faults.NewInjector(cfg.Faults)
+		if injector != nil {
+			logging.GetLogger("cmd.imagesvc").WarnContext(ctx, "fault injection enabled", "operations", cfg.Faults.Operations)
+		}
+
+		return injector, nil
+	})
+
+	container.Provide(c, func(context.Context, *container.Container) (probedAuthClient, error) {
+		switch cfg.AuthMode {
+		case authclient.ModeHTTP:
+			return authclient.NewHTTPClient(cfg.AuthClient, nil), nil
+		case authclient.ModeLocal:
+			authClient, err := authclient.NewPublicKeyAuthClient(cfg.AuthLocal, nil)
+			if err != nil {
+				return nil, bootstrap.Wrap(bootstrap.ErrConfig, err)
+			}
+
+			return authClient, nil
+		default:
+			return nil, fmt.Errorf("%w: %w: %q", bootstrap.ErrConfig, authclient.ErrUnknownMode, cfg.AuthMode)
+		}
+	})
+
+	// Fault injection applies to the services, not to the startup probes
+	container.Provide(c, func(ctx context.Context, c *container.Container) (authclient.AuthClient, error) {
+		authClient, err := container.Resolve[probedAuthClient](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		injector, err := container.Resolve[*faults.Injector](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		return authclient.NewFaultInjectingClient(authClient, injector), nil
+	})
+}
+
+// provideBlobFactory registers the constructor of the blob repository factory of the services.
+func provideBlobFactory(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (blob.RepositoryFactory, error) {
+		injector, err := container.Resolve[*faults.Injector](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		return blob.TracingRepositoryFactory(
+			blob.FaultInjectingRepositoryFactory(blob.FileSystemBlobRepositoryFactory(cfg.Blob), injector),
+			cfg.BlobTrace,
+		), nil
+	})
+}
+
+// provideOrchestrator registers the constructor of the startup orchestrator,
+// which probes the storage and the auth service when constructed.
+func provideOrchestrator(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (*startup.Orchestrator, error) {
+		authClient, err := container.Resolve[probedAuthClient](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		orchestrator := startup.NewOrchestrator(cfg.Startup)
+		orchestrator.Add(
+			startup.Dependency{
+				Name: "storage",
+				Probe: func(ctx context.Context) error {
+					return bootstrap.Wrap(bootstrap.ErrStorage, blob.ProbeFileSystemStorage(ctx, cfg.Blob))
+				},
+				Required: true,
+			},
+			startup.Dependency{
+				Name:     "auth",
+				Probe:    authClient.Probe,
+				Required: true,
+			},
+		)
+
+		if err := orchestrator.Run(ctx); err != nil {
+			return nil, fmt.Errorf("startup: %w", err)
+		}
+
+		return orchestrator, nil
+	})
+}
+
+// provideMediaService registers the constructor of the media service, constructed after the
+// dependencies are available. A new metadata index is populated from the existing metadata blobs.
+func provideMediaService(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (*mediasvc.BlobMediaService, error) {
+		if _, err := container.Resolve[*startup.Orchestrator](ctx, c); err != nil {
+			return nil, err
+		}
+
+		blobFactory, err := container.Resolve[blob.RepositoryFactory](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		mediaSvc, err := mediasvc.NewBlobMediaService(ctx, blobFactory, cfg.Media)
+		if err != nil {
+			return nil, fmt.Errorf("new media service: %w", bootstrap.Wrap(bootstrap.ErrStorage, err))
+		}
+
+		if cfg.Index.DatabasePath == "" {
+			return mediaSvc, nil
+		}
+
+		index, err := metaindex.NewSQLiteIndex(cfg.Index)
+		if err != nil {
+			return nil, fmt.Errorf("new index: %w", bootstrap.Wrap(bootstrap.ErrStorage, err))
+		}
+
+		c.Append(container.Closer("metadata index", index))
+
+		mediaSvc.SetIndex(index)
+
+		if count, err := index.Count(ctx); err != nil {
+			return nil, fmt.Errorf("count index: %w", err)
+		} else if count == 0 {
+			if _, err := mediaSvc.RebuildIndex(ctx); err != nil {
+				return nil, fmt.Errorf("rebuild index: %w", err)
+			}
+		}
+
+		return mediaSvc, nil
+	})
+}
+
+// provideImageService registers the constructor of the image service, whose cache garbage
+// collection, thumbnail generation and upload expiry run in the background once started.
+func provideImageService(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (*imagesvc.BlobImageService, error) {
+		mediaSvc, err := container.Resolve[*mediasvc.BlobMediaService](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		blobFactory, err := container.Resolve[blob.RepositoryFactory](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		authClient, err := container.Resolve[authclient.AuthClient](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		imageSvc, err := imagesvc.NewBlobImageService(ctx, blobFactory, mediaSvc, authClient, cfg.Image)
+		if errors.Is(err, imagesvc.ErrInvalidProcessorChain) || errors.Is(err, imagesvc.ErrInvalidThumbnailWidths) ||
+			errors.Is(err, imagesvc.ErrInvalidJPEGQuality) || errors.Is(err, imagesvc.ErrInvalidAllowedWidths) {
+			return nil, fmt.Errorf("new image service: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		} else if err != nil {
+			return nil, fmt.Errorf("new image service: %w", err)
+		}
+
+		c.Append(container.Background("image cache gc", imageSvc.RunCacheGC))
+		c.Append(container.Background("image cache eviction", imageSvc.RunCacheEviction))
+		c.Append(container.Background("image thumbnails", imageSvc.RunThumbnailWorkers))
+		c.Append(container.Background("upload expiry", imageSvc.RunUploadExpiry))
+
+		return imageSvc, nil
+	})
+}
+
+// provideHTTPTransport registers the constructor of the HTTP transport of the image service.
+func provideHTTPTransport(c *container.Container, cfg Config) {
+	container.Provide(c, func(ctx context.Context, c *container.Container) (*imagesvc.HTTPTransport, error) {
+		imageSvc, err := container.Resolve[*imagesvc.BlobImageService](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		authClient, err := container.Resolve[authclient.AuthClient](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		orchestrator, err := container.Resolve[*startup.Orchestrator](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		flags, err := container.Resolve[*featureflags.Store](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		httpTransport := imagesvc.NewHTTPTransport(imageSvc, authClient, cfg.ImageHTTP)
+
+		responseCache, err := http.NewResponseCache(cfg.ImageHTTP.ResponseCache, httpTransport.CacheableRoutes())
+		if err != nil {
+			return nil, fmt.Errorf("new response cache: %w", bootstrap.Wrap(bootstrap.ErrConfig, err))
+		}
+
+		httpTransport.SetDegradedFunc(orchestrator.DegradedNames)
+		httpTransport.SetFeatureFlags(flags)
+		httpTransport.SetResponseCache(responseCache)
+		httpTransport.SetStatusSources(imagesvc.StatusSources{
+			StorageDir: cfg.Blob.Basedir,
+			Health:     orchestrator.Health,
+			Config: map[string]any{
+				"authMode":        cfg.AuthMode,
+				"blobLayout":      cfg.Blob.Layout,
+				"imageProcessors": cfg.Image.Processors,
+				"indexEnabled":    cfg.Index.DatabasePath != "",
+			},
+		})
+
+		c.Append(container.Background("upload staging cleanup", httpTransport.RunStagingCleanup))
+
+		return httpTransport, nil
+	})
+}
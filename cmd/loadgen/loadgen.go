@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of the workload.
+const (
+	opUpload   = "upload"
+	opDownload = "download"
+	opResize   = "resize"
+)
+
+var (
+	errInvalidMix    = errors.New("invalid mix")
+	errInvalidWidths = errors.New("invalid resize widths")
+	errStatus        = errors.New("unexpected status")
+	errNoMedia       = errors.New("no media uploaded")
+)
+
+// weightedOp is an operation of the workload with its relative weight.
+type weightedOp struct {
+	name   string
+	weight int
+}
+
+// parseMix parses comma-separated operation weights "name=weight".
+func parseMix(mix string) ([]weightedOp, error) {
+	var ops []weightedOp
+
+	for _, entry := range strings.Split(mix, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, weightStr, ok := strings.Cut(entry, "=")
+		if !ok || !slices.Contains([]string{opUpload, opDownload, opResize}, name) {
+			return nil, fmt.Errorf("%w: %q", errInvalidMix, entry)
+		}
+
+		weight, err := strconv.Atoi(weightStr)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%w: %q", errInvalidMix, entry)
+		} else if weight > 0 {
+			ops = append(ops, weightedOp{name: name, weight: weight})
+		}
+	}
+
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no operations", errInvalidMix)
+	}
+
+	return ops, nil
+}
+
+// parseWidths parses comma-separated resize widths.
+func parseWidths(widths string) ([]int, error) {
+	var parsed []int
+
+	for _, widthStr := range strings.Split(widths, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(widthStr))
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("%w: %q", errInvalidWidths, widthStr)
+		}
+
+		parsed = append(parsed, width)
+	}
+
+	return parsed, nil
+}
+
+// generator drives the workload and records the results.
+type generator struct {
+	cfg    Config
+	mix    []weightedOp
+	widths []int
+	client *http.Client
+	token  string
+
+	mu      sync.Mutex
+	ids     []string
+	results map[string][]result
+}
+
+// result is the outcome of a single operation.
+type result struct {
+	duration time.Duration
+	err      error
+}
+
+func newGenerator(cfg Config, mix []weightedOp, widths []int) *generator {
+	return &generator{
+		cfg:     cfg,
+		mix:     mix,
+		widths:  widths,
+		client:  &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Millisecond}, //nolint:exhaustruct
+		token:   cfg.Token,
+		mu:      sync.Mutex{},
+		ids:     nil,
+		results: make(map[string][]result),
+	}
+}
+
+// authenticate registers and logs in the user, unless a token is configured.
+func (g *generator) authenticate(ctx context.Context) error {
+	if g.token != "" {
+		return nil
+	}
+
+	form := url.Values{"username": {g.cfg.Username}, "password": {g.cfg.Password}}
+
+	if g.cfg.Register {
+		resp, err := g.postForm(ctx, g.cfg.AuthURL+"/auth/register", form)
+		if err != nil {
+			return fmt.Errorf("register: %w", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+			return fmt.Errorf("register: %w: %d", errStatus, resp.StatusCode)
+		}
+	}
+
+	resp, err := g.postForm(ctx, g.cfg.AuthURL+"/auth/login", form)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		Token string `json:"token"`
+	}
+
+	if err := decodeResponse(resp, &token); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+
+	g.token = token.Token
+
+	return nil
+}
+
+func (g *generator) postForm(ctx context.Context, target string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return g.client.Do(req) //nolint:wrapcheck
+}
+
+// seed uploads the first image, so downloads and resizes have media to request.
+func (g *generator) seed(ctx context.Context) error {
+	return g.upload(ctx)
+}
+
+// run executes operations on all workers until the context ends.
+func (g *generator) run(ctx context.Context) report {
+	start := time.Now()
+
+	var wg sync.WaitGroup
+
+	for range g.cfg.Concurrency {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				op := g.pick()
+				opStart := time.Now()
+				err := g.execute(ctx, op)
+
+				// Operations cut short by the end of the run are not recorded
+				if ctx.Err() != nil {
+					return
+				}
+
+				g.record(op, result{duration: time.Since(opStart), err: err})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return newReport(g.results, time.Since(start))
+}
+
+// pick returns a random operation according to the weights of the mix.
+func (g *generator) pick() string {
+	total := 0
+	for _, op := range g.mix {
+		total += op.weight
+	}
+
+	n := rand.IntN(total) //nolint:gosec
+	for _, op := range g.mix {
+		if n < op.weight {
+			return op.name
+		}
+
+		n -= op.weight
+	}
+
+	return g.mix[len(g.mix)-1].name
+}
+
+func (g *generator) record(op string, res result) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.results[op] = append(g.results[op], res)
+}
+
+func (g *generator) execute(ctx context.Context, op string) error {
+	switch op {
+	case opUpload:
+		return g.upload(ctx)
+	case opResize:
+		width := g.widths[rand.IntN(len(g.widths))] //nolint:gosec
+
+		return g.download(ctx, url.Values{g.cfg.WidthParam: {strconv.Itoa(width)}})
+	default:
+		return g.download(ctx, nil)
+	}
+}
+
+// upload uploads a generated image and remembers its ID.
+func (g *generator) upload(ctx context.Context) error {
+	var body bytes.Buffer
+
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("file", "loadgen.png")
+	if err != nil {
+		return fmt.Errorf("create form file: %w", err)
+	}
+
+	if err := png.Encode(part, g.image()); err != nil {
+		return fmt.Errorf("encode image: %w", err)
+	}
+
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("close form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.ImageURL+"/media", &body)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+g.token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var media []struct {
+		ID string `json:"id"`
+	}
+
+	if err := decodeResponse(resp, &media); err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+
+	g.mu.Lock()
+	for _, m := range media {
+		g.ids = append(g.ids, m.ID)
+	}
+	g.mu.Unlock()
+
+	return nil
+}
+
+// image generates an image with a gradient and random pixels, so every upload is new content.
+func (g *generator) image() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, g.cfg.ImageWidth, g.cfg.ImageHeight))
+	w, h := max(g.cfg.ImageWidth, 1), max(g.cfg.ImageHeight, 1)
+
+	for y := range g.cfg.ImageHeight {
+		for x := range g.cfg.ImageWidth {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255}) //nolint:gosec
+		}
+	}
+
+	for range 64 {
+		img.Set(rand.IntN(w), rand.IntN(h), color.RGBA{ //nolint:gosec
+			R: uint8(rand.UintN(256)), G: uint8(rand.UintN(256)), B: uint8(rand.UintN(256)), A: 255, //nolint:gosec
+		})
+	}
+
+	return img
+}
+
+// download downloads a random uploaded image with the given query parameters.
+func (g *generator) download(ctx context.Context, query url.Values) error {
+	g.mu.Lock()
+	if len(g.ids) == 0 {
+		g.mu.Unlock()
+
+		return errNoMedia
+	}
+
+	id := g.ids[rand.IntN(len(g.ids))] //nolint:gosec
+	g.mu.Unlock()
+
+	target := g.cfg.ImageURL + "/media/" + url.PathEscape(id)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+g.token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d", errStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// decodeResponse decodes a JSON response body into v, unwrapping the response envelope if present.
+func decodeResponse(resp *http.Response, v any) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d", errStatus, resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Data) > 0 {
+		body = envelope.Data
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decode body: %w", err)
+	}
+
+	return nil
+}
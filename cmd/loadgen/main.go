@@ -0,0 +1,122 @@
+// Command loadgen drives concurrent upload, download and resize workloads against a running
+// deployment and reports latency percentiles and error rates per operation.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/bootstrap"
+	"github.com/mkrupp/homecase-michael/internal/infra/config"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+const (
+	appName = "demo"
+	svcName = "loadgen"
+)
+
+var errErrorRateExceeded = errors.New("error rate exceeded")
+
+type Config struct {
+	config.EnvConfig
+
+	Log logging.LoggerConfig `envPrefix:"LOG_"`
+
+	// ImageURL is the base URL of the image service
+	ImageURL string `env:"IMAGE_URL" default:"http://localhost:8081"`
+	// AuthURL is the base URL of the auth service
+	AuthURL string `env:"AUTH_URL" default:"http://localhost:8080"`
+	// Token is the auth token of requests; if empty, the user logs in
+	Token string `env:"TOKEN" default:""`
+	// Username is the user logging in
+	Username string `env:"USERNAME" default:"loadgen"`
+	// Password is the password of the user
+	Password string `env:"PASSWORD" default:"loadgen-password"`
+	// Register registers the user before logging in, ignoring existing users
+	Register bool `env:"REGISTER" default:"true"`
+
+	// Concurrency is the number of concurrent workers
+	Concurrency int `env:"CONCURRENCY" default:"8"`
+	// Duration is the duration of the run in seconds
+	Duration int64 `env:"DURATION" default:"30"`
+	// Mix are the comma-separated relative weights of the operations "upload", "download" and "resize"
+	Mix string `env:"MIX" default:"upload=1,download=4,resize=2"`
+	// ResizeWidths are the comma-separated widths requested by resize operations
+	ResizeWidths string `env:"RESIZE_WIDTHS" default:"160,320,640"`
+	// WidthParam is the URL parameter of the resize width
+	WidthParam string `env:"WIDTH_PARAM" default:"width"`
+	// ImageWidth and ImageHeight are the dimensions of uploaded images
+	ImageWidth  int `env:"IMAGE_WIDTH" default:"640"`
+	ImageHeight int `env:"IMAGE_HEIGHT" default:"480"`
+	// Timeout is the timeout of requests in milliseconds
+	Timeout int64 `env:"TIMEOUT" default:"10000"`
+
+	// Output is the report format, "text" or "json"
+	Output string `env:"OUTPUT" default:"text"`
+	// MaxErrorRate is the error rate in percent above which the run fails
+	MaxErrorRate int `env:"MAX_ERROR_RATE" default:"100"`
+}
+
+func main() {
+	var (
+		cfg Config
+		ctx = context.Background()
+
+		configPrefix = strings.ToUpper(strings.Join([]string{appName, svcName}, "_"))
+		loggerName   = strings.ToLower(strings.Join([]string{appName, svcName}, "."))
+	)
+
+	bootstrap.ExitOnError(svcName, bootstrap.ConfigError(config.Parse(ctx, &cfg, configPrefix)))
+
+	logging.Configure(ctx, cfg.Log, loggerName)
+
+	// Interrupting the run still prints the report
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	bootstrap.ExitOnError(svcName, run(ctx, cfg))
+}
+
+func run(ctx context.Context, cfg Config) error {
+	mix, err := parseMix(cfg.Mix)
+	if err != nil {
+		return bootstrap.Wrap(bootstrap.ErrConfig, err)
+	}
+
+	widths, err := parseWidths(cfg.ResizeWidths)
+	if err != nil {
+		return bootstrap.Wrap(bootstrap.ErrConfig, err)
+	}
+
+	gen := newGenerator(cfg, mix, widths)
+
+	if err := gen.authenticate(ctx); err != nil {
+		return fmt.Errorf("authenticate: %w", err)
+	}
+
+	// Downloads and resizes need uploaded media
+	if err := gen.seed(ctx); err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Duration)*time.Second)
+	defer cancel()
+
+	report := gen.run(runCtx)
+
+	if err := report.write(os.Stdout, cfg.Output); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	if rate := report.Total.ErrorRate; rate > float64(cfg.MaxErrorRate) {
+		return fmt.Errorf("%w: %.2f%% > %d%%", errErrorRateExceeded, rate, cfg.MaxErrorRate)
+	}
+
+	return nil
+}
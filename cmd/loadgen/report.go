@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// report summarizes the results of a run.
+type report struct {
+	Duration   float64           `json:"durationSeconds"`
+	Operations []operationReport `json:"operations"`
+	Total      operationReport   `json:"total"`
+}
+
+// operationReport summarizes the results of an operation. Latencies are in milliseconds.
+type operationReport struct {
+	Operation  string  `json:"operation"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"errorRate"` // Percentage of failed requests
+	Throughput float64 `json:"throughput"`
+	P50        float64 `json:"p50"`
+	P90        float64 `json:"p90"`
+	P99        float64 `json:"p99"`
+	Max        float64 `json:"max"`
+	FirstError string  `json:"firstError,omitempty"`
+}
+
+func newReport(results map[string][]result, elapsed time.Duration) report {
+	rep := report{Duration: elapsed.Seconds(), Operations: nil, Total: operationReport{Operation: "total"}} //nolint:exhaustruct
+
+	var all []result
+
+	for _, op := range []string{opUpload, opDownload, opResize} {
+		if len(results[op]) == 0 {
+			continue
+		}
+
+		rep.Operations = append(rep.Operations, summarize(op, results[op], elapsed))
+		all = append(all, results[op]...)
+	}
+
+	rep.Total = summarize("total", all, elapsed)
+
+	return rep
+}
+
+// summarize computes the statistics of the results of an operation.
+func summarize(op string, results []result, elapsed time.Duration) operationReport {
+	summary := operationReport{Operation: op, Requests: len(results)} //nolint:exhaustruct
+	if len(results) == 0 {
+		return summary
+	}
+
+	durations := make([]time.Duration, len(results))
+
+	for i, res := range results {
+		durations[i] = res.duration
+
+		if res.err != nil {
+			if summary.Errors == 0 {
+				summary.FirstError = res.err.Error()
+			}
+
+			summary.Errors++
+		}
+	}
+
+	slices.Sort(durations)
+
+	summary.ErrorRate = float64(summary.Errors) * 100 / float64(len(results)) //nolint:mnd
+	summary.Throughput = float64(len(results)) / elapsed.Seconds()
+	summary.P50 = milliseconds(percentile(durations, 50)) //nolint:mnd
+	summary.P90 = milliseconds(percentile(durations, 90)) //nolint:mnd
+	summary.P99 = milliseconds(percentile(durations, 99)) //nolint:mnd
+	summary.Max = milliseconds(durations[len(durations)-1])
+
+	return summary
+}
+
+// percentile returns the p-th percentile of sorted durations using the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100 //nolint:mnd // ceil(p/100 * n)
+
+	return sorted[max(rank, 1)-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000 //nolint:mnd
+}
+
+// write writes the report as "text" table or as "json".
+func (rep report) write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(rep) //nolint:wrapcheck
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight) //nolint:mnd
+	_, _ = fmt.Fprintf(tw, "operation\trequests\terrors\terror%%\treq/s\tp50 ms\tp90 ms\tp99 ms\tmax ms\t\n")
+
+	for _, op := range append(rep.Operations, rep.Total) {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			op.Operation, op.Requests, op.Errors, op.ErrorRate, op.Throughput, op.P50, op.P90, op.P99, op.Max)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	for _, op := range rep.Operations {
+		if op.FirstError != "" {
+			_, _ = fmt.Fprintf(w, "first %s error: %s\n", op.Operation, op.FirstError)
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "duration: %.1fs\n", rep.Duration)
+
+	return nil
+}
@@ -5,7 +5,9 @@ go 1.23.0
 toolchain go1.23.7
 
 require (
+	golang.org/x/crypto v0.35.0
 	golang.org/x/image v0.25.0
+	golang.org/x/sync v0.12.0
 	modernc.org/sqlite v1.36.0
 )
 
@@ -0,0 +1,50 @@
+package domain
+
+// AdminStatusResponse represents a snapshot of the state of a service for dashboards and support tooling.
+type AdminStatusResponse struct {
+	Build   AdminStatusBuild      `json:"build"`   // Build of the running binary
+	Storage []AdminStatusVolume   `json:"storage"` // Usage of the filesystems the service writes to
+	Caches  map[string]CacheStats `json:"caches"`  // Statistics of the caches by name
+	Queues  map[string]int        `json:"queues"`  // Number of pending or active operations by queue
+	Health  map[string]string     `json:"health"`  // Status of the dependencies by name, "ok" or the reason they are degraded
+	Config  map[string]any        `json:"config"`  // Selected configuration values, never secrets
+}
+
+// AdminStatusBuild describes the build of the running binary.
+type AdminStatusBuild struct {
+	GoVersion string `json:"goVersion"`          // Go version the binary was built with
+	Version   string `json:"version"`            // Module version, "(devel)" for local builds
+	Revision  string `json:"revision,omitempty"` // VCS revision the binary was built from
+	Time      string `json:"time,omitempty"`     // Time of the VCS revision in RFC 3339 format
+	Modified  bool   `json:"modified"`           // Whether the working tree had local modifications
+}
+
+// AdminStatusVolume describes the usage of the filesystem holding a directory.
+type AdminStatusVolume struct {
+	Name       string `json:"name"`            // Purpose of the directory, e.g. "storage"
+	Dir        string `json:"dir"`             // Path of the directory
+	TotalBytes int64  `json:"totalBytes"`      // Size of the filesystem
+	FreeBytes  int64  `json:"freeBytes"`       // Bytes available to unprivileged users
+	UsedBytes  int64  `json:"usedBytes"`       // Bytes in use
+	Error      string `json:"error,omitempty"` // Reason the usage is unknown, if any
+}
+
+// CacheStats describes the size and hit rate of a cache.
+type CacheStats struct {
+	Entries    int     `json:"entries"`    // Number of cached entries, 0 if unknown
+	MaxEntries int     `json:"maxEntries"` // Maximum number of cached entries, 0 if unlimited or unknown
+	Hits       int64   `json:"hits"`       // Number of lookups served from the cache
+	Misses     int64   `json:"misses"`     // Number of lookups not served from the cache
+	HitRate    float64 `json:"hitRate"`    // Ratio of hits to lookups, 0 without lookups
+}
+
+// NewCacheStats returns the CacheStats of the given size and lookups, computing their hit rate.
+func NewCacheStats(entries, maxEntries int, hits, misses int64) CacheStats {
+	stats := CacheStats{Entries: entries, MaxEntries: maxEntries, Hits: hits, Misses: misses, HitRate: 0}
+
+	if lookups := hits + misses; lookups > 0 {
+		stats.HitRate = float64(hits) / float64(lookups)
+	}
+
+	return stats
+}
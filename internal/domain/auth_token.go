@@ -1,21 +1,35 @@
 package domain
 
-import "errors"
-
-var (
-	// ErrNoAuthToken is returned when an authentication token is required but not provided.
-	ErrNoAuthToken = errors.New("no auth token")
-	// ErrInvalidAuthToken is returned when a token's signature is invalid or it has expired.
-	ErrInvalidAuthToken = errors.New("invalid auth token")
-	// ErrUnauthorized is returned when the authenticated user lacks permission.
-	ErrUnauthorized = errors.New("unauthorized")
-)
+import "slices"
 
 // AuthToken represents an authentication token with user information and validity period.
 type AuthToken struct {
-	Username  string `json:"username"`  // Identifier of the authenticated user
-	IssuedAt  int64  `json:"issuedAt"`  // Unix timestamp when the token was created
-	ExpiresAt int64  `json:"expiresAt"` // Unix timestamp when the token expires
+	Username  string   `json:"username"`           // Identifier of the authenticated user
+	Issuer    string   `json:"issuer,omitempty"`   // Base URL of the issuing auth service, if configured
+	IssuedAt  int64    `json:"issuedAt"`           // Unix timestamp when the token was created
+	ExpiresAt int64    `json:"expiresAt"`          // Unix timestamp when the token expires
+	AuthTime  int64    `json:"authTime,omitempty"` // Unix timestamp of the login, kept by renewals; IssuedAt if 0
+	Roles     []string `json:"roles,omitempty"`    // Roles of the user when the token was issued
+	Audience  []string `json:"audience,omitempty"` // Services the token is intended for, any service if empty
+	Scopes    []string `json:"scopes,omitempty"`   // Scopes granted to the token
+	Remember  bool     `json:"remember,omitempty"` // Whether the token was issued for a persistent "remember me" session
+}
+
+// HasAudience reports whether the token is intended for the given service.
+// Tokens without audience are intended for any service.
+func (t AuthToken) HasAudience(audience string) bool {
+	return len(t.Audience) == 0 || slices.Contains(t.Audience, audience)
+}
+
+// HasScopes reports whether all of the given scopes are granted to the token.
+func (t AuthToken) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(t.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // AuthTokenResponse represents a response containing an authentication token.
@@ -0,0 +1,161 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorCodeInternal is the code of batch items that failed with an unregistered error.
+const ErrorCodeInternal ErrorCode = "internal"
+
+// BatchErrorItem describes the failure of a single item of a batch operation.
+type BatchErrorItem struct {
+	Key     string    `json:"key"`     // Identifies the item, e.g. its filename or media ID
+	Code    ErrorCode `json:"code"`    // Code of the registered error, or ErrorCodeInternal
+	Message string    `json:"message"` // Client-facing message
+
+	err error // Underlying error, not exposed to clients
+}
+
+// BatchError collects the per-item failures of a batch operation. Unlike errors.Join, it keeps
+// the key of each failed item along with the code and message of its registered error.
+// The zero value is an empty BatchError ready to use. BatchError is not safe for concurrent use.
+//
+// A BatchError marshals to the JSON array of its items.
+type BatchError struct {
+	Items []BatchErrorItem
+}
+
+var (
+	_ error            = (*BatchError)(nil)
+	_ json.Marshaler   = BatchError{}
+	_ json.Unmarshaler = (*BatchError)(nil)
+)
+
+// Add records the failure of the item with the given key. The code and message are those
+// of the first registered error in the chain of err, or ErrorCodeInternal and the status text
+// of HTTP 500 if there is none, so internal details are not exposed to clients.
+// A nil err is ignored.
+func (e *BatchError) Add(key string, err error) {
+	if err == nil {
+		return
+	}
+
+	item := BatchErrorItem{
+		Key:     key,
+		Code:    ErrorCodeInternal,
+		Message: http.StatusText(http.StatusInternalServerError),
+		err:     err,
+	}
+
+	if domainErr, ok := AsError(err); ok {
+		item.Code = domainErr.Code
+		item.Message = domainErr.Message
+	}
+
+	e.Items = append(e.Items, item)
+}
+
+// Len returns the number of failed items.
+func (e *BatchError) Len() int {
+	if e == nil {
+		return 0
+	}
+
+	return len(e.Items)
+}
+
+// ErrOrNil returns e if any item failed, or nil otherwise.
+func (e *BatchError) ErrOrNil() error {
+	if e.Len() == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Error implements error, listing the key and underlying error of every failed item.
+func (e *BatchError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%d item(s) failed", e.Len())
+
+	for i, item := range e.Items {
+		if i == 0 {
+			sb.WriteString(": ")
+		} else {
+			sb.WriteString("; ")
+		}
+
+		if item.Key != "" {
+			sb.WriteString(item.Key)
+			sb.WriteString(": ")
+		}
+
+		if item.err != nil {
+			sb.WriteString(item.err.Error())
+		} else {
+			sb.WriteString(item.Message)
+		}
+	}
+
+	return sb.String()
+}
+
+// Unwrap returns the underlying errors of all failed items, so errors.Is, errors.As and
+// ErrorStatus see through a BatchError.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, e.Len())
+
+	for _, item := range e.Items {
+		if item.err != nil {
+			errs = append(errs, item.err)
+		} else if domainErr, ok := LookupError(item.Code); ok {
+			errs = append(errs, domainErr)
+		}
+	}
+
+	return errs
+}
+
+// MarshalJSON implements json.Marshaler, encoding the items as JSON array.
+// An empty BatchError marshals to an empty array.
+func (e BatchError) MarshalJSON() ([]byte, error) {
+	items := e.Items
+	if items == nil {
+		items = []BatchErrorItem{}
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("marshal batch error: %w", err)
+	}
+
+	return data, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a JSON array of items.
+// Items with a registered code unwrap to the registered error.
+func (e *BatchError) UnmarshalJSON(data []byte) error {
+	var items []BatchErrorItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("unmarshal batch error: %w", err)
+	}
+
+	e.Items = items
+
+	return nil
+}
+
+// AsBatchError returns the first BatchError in the chain of err.
+func AsBatchError(err error) (*BatchError, bool) {
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr, true
+	}
+
+	return nil, false
+}
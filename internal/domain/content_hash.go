@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"hash"
+
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// ContentHasher computes the content hash and size of media written to it, so content can be
+// hashed while it is streamed instead of being held in memory.
+type ContentHasher struct {
+	hash hash.Hash
+	size int64
+}
+
+// NewContentHasher creates a new ContentHasher.
+func NewContentHasher() *ContentHasher {
+	return &ContentHasher{hash: sha256.New(), size: 0}
+}
+
+// Write implements io.Writer. It never returns an error.
+func (h *ContentHasher) Write(p []byte) (int, error) {
+	n, _ := h.hash.Write(p)
+	h.size += int64(n)
+
+	return n, nil
+}
+
+// Hash returns the content hash of the bytes written so far, as used by MediaMeta.Hash.
+func (h *ContentHasher) Hash() string {
+	return encoding.EncodeCrockfordB32LC(h.hash.Sum(nil))
+}
+
+// Size returns the number of bytes written so far.
+func (h *ContentHasher) Size() int64 {
+	return h.size
+}
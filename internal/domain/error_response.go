@@ -0,0 +1,9 @@
+package domain
+
+// ErrorResponse represents the body of an error response.
+type ErrorResponse struct {
+	Error     string           `json:"error"`               // Human-readable error message
+	Code      ErrorCode        `json:"code,omitempty"`      // Stable code of the error, if known
+	Errors    []BatchErrorItem `json:"errors,omitempty"`    // Failed items of a batch operation
+	RequestID string           `json:"requestId,omitempty"` // Request ID to quote in support requests
+}
@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrorCode is a stable, machine-readable identifier of a client-facing error.
+type ErrorCode string
+
+// Error is a registered error carrying a code and hints on how it should be surfaced to clients.
+// Services declare their client-facing sentinel errors using NewError and test for them with
+// errors.Is, or extract the details of any wrapped Error with errors.As or AsError.
+type Error struct {
+	Code      ErrorCode // Stable identifier, e.g. "media.too_large"
+	Message   string    // Human-readable message
+	Status    int       // HTTP status code hint
+	Retryable bool      // Whether retrying the same request may succeed
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+//nolint:gochecknoglobals
+var (
+	errorRegistryMu sync.RWMutex
+	errorRegistry   = map[ErrorCode]*Error{}
+)
+
+// NewError creates and registers a client-facing error.
+// Panics if an error with the same code is already registered.
+func NewError(code ErrorCode, message string, status int, retryable bool) *Error {
+	errorRegistryMu.Lock()
+	defer errorRegistryMu.Unlock()
+
+	if _, ok := errorRegistry[code]; ok {
+		panic(fmt.Sprintf("domain: error code %q registered twice", code))
+	}
+
+	err := &Error{Code: code, Message: message, Status: status, Retryable: retryable}
+	errorRegistry[code] = err
+
+	return err
+}
+
+// LookupError returns the registered error with the given code.
+func LookupError(code ErrorCode) (*Error, bool) {
+	errorRegistryMu.RLock()
+	defer errorRegistryMu.RUnlock()
+
+	err, ok := errorRegistry[code]
+
+	return err, ok
+}
+
+// RegisteredErrors returns all registered errors ordered by code.
+func RegisteredErrors() []*Error {
+	errorRegistryMu.RLock()
+	defer errorRegistryMu.RUnlock()
+
+	errs := make([]*Error, 0, len(errorRegistry))
+	for _, err := range errorRegistry {
+		errs = append(errs, err)
+	}
+
+	slices.SortFunc(errs, func(a, b *Error) int {
+		return strings.Compare(string(a.Code), string(b.Code))
+	})
+
+	return errs
+}
+
+// AsError returns the first registered error in the chain of err.
+func AsError(err error) (*Error, bool) {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr, true
+	}
+
+	return nil, false
+}
+
+// ErrorStatus returns the HTTP status code hint of the first registered error
+// in the chain of err, or fallback if there is none.
+func ErrorStatus(err error, fallback int) int {
+	if domainErr, ok := AsError(err); ok && domainErr.Status != 0 {
+		return domainErr.Status
+	}
+
+	return fallback
+}
+
+// IsRetryable reports whether the first registered error in the chain of err is retryable.
+func IsRetryable(err error) bool {
+	domainErr, ok := AsError(err)
+
+	return ok && domainErr.Retryable
+}
+
+// WriteErrorCatalog writes a Markdown table documenting all registered errors.
+func WriteErrorCatalog(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("| Code | HTTP Status | Retryable | Message |\n")
+	sb.WriteString("|------|-------------|-----------|---------|\n")
+
+	for _, err := range RegisteredErrors() {
+		fmt.Fprintf(&sb, "| `%s` | %d %s | %t | %s |\n",
+			err.Code, err.Status, http.StatusText(err.Status), err.Retryable, err.Message)
+	}
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+var (
+	// ErrNoAuthToken is returned when an authentication token is required but not provided.
+	ErrNoAuthToken = NewError("auth.no_token", "no auth token", http.StatusBadRequest, false)
+	// ErrInvalidAuthToken is returned when a token is malformed or fails validation. Tokens failing
+	// for one of the reasons below are rejected with both ErrInvalidAuthToken and the reason.
+	ErrInvalidAuthToken = NewError("auth.invalid_token", "invalid auth token", http.StatusUnauthorized, false)
+	// ErrTokenExpired is returned when a token has expired, beyond the allowed clock skew.
+	ErrTokenExpired = NewError("auth.token_expired", "auth token expired", http.StatusUnauthorized, false)
+	// ErrTokenNotYetValid is returned when a token is issued in the future, beyond the allowed clock skew.
+	ErrTokenNotYetValid = NewError(
+		"auth.token_not_yet_valid", "auth token not yet valid", http.StatusUnauthorized, true)
+	// ErrSessionExpired is returned when renewing a token would exceed the maximum lifetime of the session.
+	ErrSessionExpired = NewError("auth.session_expired", "session expired", http.StatusUnauthorized, false)
+	// ErrBadSignature is returned when the signature of a token does not match its contents.
+	ErrBadSignature = NewError("auth.bad_signature", "bad auth token signature", http.StatusUnauthorized, false)
+	// ErrWrongAudience is returned when a token is not intended for the service validating it.
+	ErrWrongAudience = NewError("auth.wrong_audience", "auth token not intended for service", http.StatusUnauthorized, false)
+	// ErrInsufficientScope is returned when a token lacks a scope required by the request.
+	ErrInsufficientScope = NewError("auth.insufficient_scope", "insufficient scope", http.StatusForbidden, false)
+	// ErrInvalidScope is returned when a login requests a scope that cannot be granted.
+	ErrInvalidScope = NewError("auth.invalid_scope", "invalid scope", http.StatusBadRequest, false)
+	// ErrUnauthorized is returned when the authenticated user lacks permission.
+	ErrUnauthorized = NewError("auth.unauthorized", "unauthorized", http.StatusForbidden, false)
+
+	// ErrUserAlreadyExists is returned when trying to create a user with an existing username.
+	ErrUserAlreadyExists = NewError("user.already_exists", "user already exists", http.StatusConflict, false)
+	// ErrUserNotFound is returned when looking up a non-existent user.
+	ErrUserNotFound = NewError("user.not_found", "user not found", http.StatusNotFound, false)
+	// ErrInvalidCredentials is returned when the username/password combination is incorrect.
+	ErrInvalidCredentials = NewError("user.invalid_credentials", "invalid credentials", http.StatusUnauthorized, false)
+	// ErrTooManyLoginAttempts is returned when logins to an account are locked after repeated failures.
+	ErrTooManyLoginAttempts = NewError(
+		"user.too_many_login_attempts", "too many login attempts", http.StatusTooManyRequests, true)
+	// ErrAccountExpired is returned when logging in to an expired account.
+	ErrAccountExpired = NewError("user.account_expired", "account expired", http.StatusForbidden, false)
+
+	// ErrNoMediaID is returned when a media ID is required but not provided.
+	ErrNoMediaID = NewError("media.no_id", "no media ID", http.StatusBadRequest, false)
+	// ErrMediaNotFound is returned when media does not exist or is not accessible to the user.
+	ErrMediaNotFound = NewError("media.not_found", "media not found", http.StatusNotFound, false)
+	// ErrInvalidVisibility is returned when media is set to an undefined visibility.
+	ErrInvalidVisibility = NewError("media.invalid_visibility", "invalid visibility", http.StatusBadRequest, false)
+	// ErrInvalidShareUser is returned when media is shared with an empty username or its owner.
+	ErrInvalidShareUser = NewError("media.invalid_share_user", "invalid share user", http.StatusBadRequest, false)
+	// ErrMediaTooLarge is returned when media exceeds the configured size limit.
+	ErrMediaTooLarge = NewError("media.too_large", "media too large", http.StatusRequestEntityTooLarge, false)
+	// ErrContentMismatch is returned when streamed media content does not match its content hash or size,
+	// e.g. because the content changed after it was hashed.
+	ErrContentMismatch = NewError("media.content_mismatch", "content mismatch", http.StatusBadRequest, false)
+	// ErrChangesExpired is returned when the changes after a sequence number are no longer known,
+	// e.g. because the deletions after it were pruned, so the client has to list all media again.
+	ErrChangesExpired = NewError("media.changes_expired", "changes expired", http.StatusGone, false)
+	// ErrDownloadCapExceeded is returned when a user has exhausted the download volume of the current period.
+	ErrDownloadCapExceeded = NewError(
+		"media.download_cap_exceeded", "download cap exceeded", http.StatusTooManyRequests, false)
+
+	// ErrImageTypeNotSupported is returned when an image format is not supported.
+	ErrImageTypeNotSupported = NewError(
+		"image.type_not_supported", "image type not supported", http.StatusUnsupportedMediaType, false)
+	// ErrImageTypeMismatch is returned when the filename extension does not match the image content.
+	ErrImageTypeMismatch = NewError(
+		"image.type_mismatch", "image ext does not match content type", http.StatusUnsupportedMediaType, false)
+	// ErrImageTooLarge is returned when an image exceeds the configured size limit.
+	ErrImageTooLarge = NewError("image.too_large", "image too large", http.StatusRequestEntityTooLarge, false)
+	// ErrImageDimensionsTooLarge is returned when the width, height or pixel count of an image
+	// exceeds the configured limits.
+	ErrImageDimensionsTooLarge = NewError(
+		"image.dimensions_too_large", "image dimensions too large", http.StatusRequestEntityTooLarge, false)
+	// ErrWidthNotAllowed is returned when a requested width is not one of the configured allowed widths.
+	ErrWidthNotAllowed = NewError("image.width_not_allowed", "width not allowed", http.StatusBadRequest, false)
+	// ErrCropOutOfBounds is returned when the crop region of a transform lies outside of the image.
+	ErrCropOutOfBounds = NewError(
+		"image.crop_out_of_bounds", "crop region outside of the image", http.StatusBadRequest, false)
+)
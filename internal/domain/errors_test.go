@@ -0,0 +1,137 @@
+package domain_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+func TestErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		err           error
+		wantStatus    int
+		wantRetryable bool
+	}{
+		{name: "registered error", err: ErrImageTooLarge, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "wrapped error", err: fmt.Errorf("store: %w", ErrUserAlreadyExists), wantStatus: http.StatusConflict},
+		{
+			name:       "joined error",
+			err:        errors.Join(errors.New("other"), ErrInvalidAuthToken),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{name: "unregistered error", err: errors.New("other"), wantStatus: http.StatusTeapot},
+		{name: "nil error", err: nil, wantStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ErrorStatus(tt.err, http.StatusTeapot); got != tt.wantStatus {
+				t.Errorf("ErrorStatus() = %d, want %d", got, tt.wantStatus)
+			}
+
+			if got := IsRetryable(tt.err); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	t.Parallel()
+
+	err := NewError("test.retryable", "test error", http.StatusServiceUnavailable, true)
+
+	if !errors.Is(fmt.Errorf("wrapped: %w", err), err) {
+		t.Error("wrapped error does not match sentinel")
+	}
+
+	if got, ok := LookupError("test.retryable"); !ok || got != err {
+		t.Errorf("LookupError() = %v, %v, want %v", got, ok, err)
+	}
+
+	if !IsRetryable(err) {
+		t.Error("IsRetryable() = false, want true")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate code did not panic")
+		}
+	}()
+
+	NewError("test.retryable", "duplicate", http.StatusBadRequest, false)
+}
+
+func TestWriteErrorCatalog(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := WriteErrorCatalog(&buf); err != nil {
+		t.Fatalf("WriteErrorCatalog() error = %v", err)
+	}
+
+	if want := "| `image.too_large` | 413 Request Entity Too Large | false | image too large |"; !strings.Contains(buf.String(), want) {
+		t.Errorf("catalog does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	t.Parallel()
+
+	var batchErr BatchError
+	if batchErr.ErrOrNil() != nil {
+		t.Fatal("ErrOrNil() of empty batch error is not nil")
+	}
+
+	batchErr.Add("a.png", fmt.Errorf("store: %w", ErrImageTooLarge))
+	batchErr.Add("b.png", nil)
+	batchErr.Add("c.png", errors.New("disk full"))
+
+	err := batchErr.ErrOrNil()
+	if err == nil || batchErr.Len() != 2 {
+		t.Fatalf("ErrOrNil() = %v, Len() = %d, want 2 items", err, batchErr.Len())
+	}
+
+	if !errors.Is(err, ErrImageTooLarge) || ErrorStatus(err, http.StatusTeapot) != http.StatusRequestEntityTooLarge {
+		t.Errorf("batch error does not unwrap to item errors: %v", err)
+	}
+
+	if want := "2 item(s) failed: a.png: store: image too large; c.png: disk full"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	data, err := json.Marshal(batchErr)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	want := `[{"key":"a.png","code":"image.too_large","message":"image too large"},` +
+		`{"key":"c.png","code":"internal","message":"Internal Server Error"}]`
+	if string(data) != want {
+		t.Errorf("marshal = %s, want %s", data, want)
+	}
+
+	var decoded BatchError
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if decoded.Len() != 2 || !errors.Is(&decoded, ErrImageTooLarge) {
+		t.Errorf("unmarshaled = %+v, want items unwrapping to registered errors", decoded.Items)
+	}
+
+	if data, _ := json.Marshal(BatchError{Items: nil}); string(data) != "[]" {
+		t.Errorf("marshal empty = %s, want []", data)
+	}
+}
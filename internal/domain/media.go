@@ -2,13 +2,10 @@ package domain
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 )
 
-var ErrMediaTooLarge = errors.New("media too large")
-
 // Media represents a media file with its content and metadata.
 type Media struct {
 	data []byte
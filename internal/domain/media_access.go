@@ -0,0 +1,14 @@
+package domain
+
+// MediaVisibilityRequest represents a request to change the visibility of a media file.
+type MediaVisibilityRequest struct {
+	Visibility MediaVisibility `json:"visibility"`
+}
+
+// MediaAccessResponse represents who may access a media file besides its owner.
+type MediaAccessResponse struct {
+	ID         string          `json:"id"`                   // Unique identifier
+	Visibility MediaVisibility `json:"visibility"`           // Visibility of the media
+	SharedWith []string        `json:"sharedWith"`           // Usernames the media is shared with
+	ShareToken string          `json:"shareToken,omitempty"` // Token granting access while unlisted
+}
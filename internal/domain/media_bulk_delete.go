@@ -0,0 +1,23 @@
+package domain
+
+// MediaBulkDeleteRequest represents a request to prepare or execute the deletion of multiple media.
+// Token is the confirmation token of the prepare step, required to execute the deletion.
+type MediaBulkDeleteRequest struct {
+	IDs   []string `json:"ids"`
+	Token string   `json:"token,omitempty"`
+}
+
+// MediaBulkDeletePrepareResponse represents a summary of a prepared bulk deletion.
+type MediaBulkDeletePrepareResponse struct {
+	IDs        []string `json:"ids"`        // IDs of the media to delete
+	Count      int      `json:"count"`      // Number of media to delete
+	TotalBytes int64    `json:"totalBytes"` // Total size of the media to delete in bytes
+	Token      string   `json:"token"`      // Confirmation token of the execute step
+	ExpiresAt  int64    `json:"expiresAt"`  // Unix timestamp when the token expires
+}
+
+// MediaBulkDeleteResponse represents the outcome of an executed bulk deletion.
+type MediaBulkDeleteResponse struct {
+	Deleted []string   `json:"deleted"` // IDs of the deleted media
+	Failed  BatchError `json:"failed"`  // Media that could not be deleted, keyed by ID
+}
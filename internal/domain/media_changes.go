@@ -0,0 +1,9 @@
+package domain
+
+// MediaChanges lists the changes of a user's media after a sequence number. Changes of a user's
+// media are numbered in the order they are committed, so no change numbered up to Seq is missed.
+type MediaChanges struct {
+	Seq     int64       // Sequence number of the latest change listed
+	Changed []MediaMeta // Media stored or updated after the requested sequence number
+	Deleted []MediaID   // Media deleted after the requested sequence number
+}
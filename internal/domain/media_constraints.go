@@ -0,0 +1,12 @@
+package domain
+
+// MediaUploadConstraints describes the limits uploaded media must meet.
+type MediaUploadConstraints struct {
+	MaxSize      int64    `json:"maxSize"`      // Maximum size in bytes
+	MaxWidth     int      `json:"maxWidth"`     // Maximum width in pixels, 0 if unlimited
+	MaxHeight    int      `json:"maxHeight"`    // Maximum height in pixels, 0 if unlimited
+	MaxPixels    int64    `json:"maxPixels"`    // Maximum width times height, 0 if unlimited
+	ChunkMaxSize int64    `json:"chunkMaxSize"` // Maximum size in bytes of a resumable upload chunk
+	MIMETypes    []string `json:"mimeTypes"`    // Accepted MIME types, sorted
+	Extensions   []string `json:"extensions"`   // Accepted filename extensions, sorted
+}
@@ -0,0 +1,8 @@
+package domain
+
+// MediaDataRequest represents a request to upload media from inline data.
+// Data holds either plain base64 content or a data URL ("data:image/png;base64,...").
+type MediaDataRequest struct {
+	Filename string `json:"filename"`
+	Data     string `json:"data"`
+}
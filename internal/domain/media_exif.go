@@ -0,0 +1,29 @@
+package domain
+
+// MediaExif holds the EXIF metadata extracted from an image on ingest. Fields missing
+// from the image are empty.
+type MediaExif struct {
+	Make         string        `json:"make,omitempty"`         // Camera manufacturer
+	Model        string        `json:"model,omitempty"`        // Camera model
+	LensModel    string        `json:"lensModel,omitempty"`    // Lens model
+	Software     string        `json:"software,omitempty"`     // Software that created the image
+	TakenAt      string        `json:"takenAt,omitempty"`      // Time the photo was taken, RFC 3339 if the offset is known
+	Orientation  int           `json:"orientation,omitempty"`  // EXIF orientation (1-8)
+	ExposureTime string        `json:"exposureTime,omitempty"` // Exposure time in seconds, e.g. "1/250"
+	FNumber      float64       `json:"fNumber,omitempty"`      // Aperture f-number
+	ISO          int           `json:"iso,omitempty"`          // ISO speed
+	FocalLength  float64       `json:"focalLength,omitempty"`  // Focal length in millimeters
+	GPS          *MediaExifGPS `json:"gps,omitempty"`          // Location, if recorded and permitted
+}
+
+// MediaExifGPS is the location a photo was taken at.
+type MediaExifGPS struct {
+	Latitude  float64 `json:"latitude"`           // Degrees north, negative for south
+	Longitude float64 `json:"longitude"`          // Degrees east, negative for west
+	Altitude  float64 `json:"altitude,omitempty"` // Meters above sea level, negative below
+}
+
+// IsEmpty reports whether no EXIF metadata was extracted.
+func (exif MediaExif) IsEmpty() bool {
+	return exif == MediaExif{}
+}
@@ -0,0 +1,8 @@
+package domain
+
+// MediaExistsResponse represents a response telling whether content is already stored for a user.
+type MediaExistsResponse struct {
+	Hash   string            `json:"hash"`   // Content hash (Crockford Base32)
+	Exists bool              `json:"exists"` // Whether the user has stored media with this content
+	Media  []MediaIDResponse `json:"media"`  // Media of the user with this content
+}
@@ -0,0 +1,37 @@
+package domain
+
+// GeoJSON object types used by MediaGeoResponse.
+const (
+	GeoJSONFeatureCollection = "FeatureCollection"
+	GeoJSONFeature           = "Feature"
+	GeoJSONPoint             = "Point"
+)
+
+// MediaGeoResponse represents a user's geotagged media clustered by location as a
+// GeoJSON FeatureCollection (RFC 7946).
+type MediaGeoResponse struct {
+	Type     string            `json:"type"`     // Always "FeatureCollection"
+	Zoom     int               `json:"zoom"`     // Zoom level the media were clustered for
+	Features []MediaGeoFeature `json:"features"` // Clusters of media, largest first
+}
+
+// MediaGeoFeature represents a cluster of media taken close to each other as a GeoJSON Feature.
+type MediaGeoFeature struct {
+	Type       string             `json:"type"`       // Always "Feature"
+	Geometry   MediaGeoPoint      `json:"geometry"`   // Center of the cluster
+	Properties MediaGeoProperties `json:"properties"` // Media of the cluster
+}
+
+// MediaGeoPoint represents a GeoJSON Point geometry.
+type MediaGeoPoint struct {
+	Type        string     `json:"type"`        // Always "Point"
+	Coordinates [2]float64 `json:"coordinates"` // Longitude and latitude, in this order
+}
+
+// MediaGeoProperties represents the media of a cluster.
+type MediaGeoProperties struct {
+	Count    int      `json:"count"`    // Number of media in the cluster
+	CoverID  string   `json:"coverId"`  // ID of the most recently stored media of the cluster
+	CoverURL string   `json:"coverUrl"` // URL of a thumbnail of the cover
+	IDs      []string `json:"ids"`      // IDs of the media of the cluster, most recent first
+}
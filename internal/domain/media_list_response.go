@@ -0,0 +1,24 @@
+package domain
+
+// MediaPosition is the position of media in the listing of a user's media, which is ordered by
+// storage time and ID. Pages of the listing start after a position; the zero value is its start.
+type MediaPosition struct {
+	Modified int64   // Unix time in milliseconds when the media was stored
+	ID       MediaID // Unique identifier, ordering media stored at the same time
+}
+
+// MediaListEntry represents a media file in a page of a user's media.
+type MediaListEntry struct {
+	ID       string `json:"id"`       // Unique identifier
+	Filename string `json:"filename"` // Original filename
+	Size     int64  `json:"size"`     // Size in bytes
+	MIMEType string `json:"mimeType"` // MIME type
+	Modified int64  `json:"modified"` // Unix time in milliseconds when the media was stored
+}
+
+// MediaListResponse represents a page of a user's media, ordered by storage time.
+// Pass Cursor as cursor parameter of the next request to receive the next page.
+type MediaListResponse struct {
+	Entries []MediaListEntry `json:"entries"`          // Media of the page
+	Cursor  string           `json:"cursor,omitempty"` // Cursor of the next page, empty on the last page
+}
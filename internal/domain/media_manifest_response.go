@@ -0,0 +1,19 @@
+package domain
+
+// MediaManifestEntry represents a media file in a sync manifest.
+type MediaManifestEntry struct {
+	ID           string `json:"id"`                     // Unique identifier
+	Hash         string `json:"hash"`                   // Content hash (Crockford Base32)
+	OriginalHash string `json:"originalHash,omitempty"` // Content hash as uploaded, if modified on ingest
+	Size         int64  `json:"size"`                   // Size in bytes
+	Modified     int64  `json:"modified"`               // Unix time in milliseconds when the media was stored
+}
+
+// MediaManifestResponse represents a compact listing of a user's media for sync clients.
+// Pass Cursor as since parameter of the next request to receive only the changes since.
+type MediaManifestResponse struct {
+	Cursor  string               `json:"cursor"`            // Cursor of the next delta request
+	Entries []MediaManifestEntry `json:"entries"`           // Media stored or updated since the requested cursor
+	Deleted []string             `json:"deleted,omitempty"` // IDs of the media deleted since the requested cursor
+	Reset   bool                 `json:"reset,omitempty"`   // Whether the cursor expired, so Entries lists all media
+}
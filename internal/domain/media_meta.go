@@ -4,10 +4,14 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/mkrupp/homecase-michael/internal/util/encoding"
 )
 
+// revisionLength is the number of hash bytes identifying a metadata revision.
+const revisionLength = 10
+
 // MediaMeta contains metadata about a media file.
 //
 //nolint:recvcheck
@@ -18,6 +22,44 @@ type MediaMeta struct {
 	Size     int64   `json:"size"`     // Size in bytes
 	Owner    string  `json:"owner"`    // Username of owner
 	MIMEType string  `json:"mimeType"` // MIME type
+
+	OriginalSize int64  `json:"originalSize,omitempty"` // Size in bytes before processing, if modified on ingest
+	OriginalHash string `json:"originalHash,omitempty"` // Content hash before processing, if modified on ingest
+	Modified     int64  `json:"modified,omitempty"`     // Unix time in milliseconds when the media was stored
+	Seq          int64  `json:"seq,omitempty"`          // Number of the owner's change that stored or updated the media (see MediaChanges)
+	Category     string `json:"category,omitempty"`     // Content category assigned on ingest, e.g. "photo"
+	TakenAt      string `json:"takenAt,omitempty"`      // Time the photo was taken per its EXIF metadata (see MediaExif.TakenAt)
+
+	Location *MediaLocation `json:"location,omitempty"` // Where the photo was taken per its EXIF metadata, if kept
+
+	Visibility MediaVisibility `json:"visibility,omitempty"` // Who may access the media besides the owner, private if empty
+	SharedWith []string        `json:"sharedWith,omitempty"` // Usernames the media is shared with, regardless of its visibility
+	ShareToken string          `json:"shareToken,omitempty"` // Random token granting access while unlisted, empty otherwise
+}
+
+// MediaVisibility controls who may access media besides its owner and the users it is shared with.
+type MediaVisibility string
+
+const (
+	// VisibilityPrivate restricts access to the owner and the users the media is shared with.
+	VisibilityPrivate MediaVisibility = "private"
+	// VisibilityUnlisted grants access to any authenticated user presenting the share token of the
+	// media (see MediaMeta.ShareToken). The media ID is no capability, as it is derived from the
+	// content, filename, MIME type and owner.
+	VisibilityUnlisted MediaVisibility = "unlisted"
+	// VisibilityPublic grants access to anyone knowing the media ID, including anonymous requests.
+	VisibilityPublic MediaVisibility = "public"
+)
+
+// Valid reports whether the visibility is one of the defined visibilities.
+func (v MediaVisibility) Valid() bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// MediaLocation represents the position a photo was taken at, in decimal degrees.
+type MediaLocation struct {
+	Latitude  float64 `json:"latitude"`  // Positive north of the equator
+	Longitude float64 `json:"longitude"` // Positive east of the prime meridian
 }
 
 // NewMediaMetaFromBlob creates MediaMeta from a JSON-encoded blob.
@@ -34,14 +76,28 @@ func NewMediaMetaFromBlob(blob *Blob) (MediaMeta, error) {
 // update recalculates metadata fields based on the provided content.
 // This includes content type detection and hash calculation.
 func (imgMeta *MediaMeta) update(data []byte) {
-	// Update media metadata
-	hasher := sha256.New()
-	hasher.Write(data)
-	imgMeta.Hash = encoding.EncodeCrockfordB32LC(hasher.Sum(nil))
-	imgMeta.Size = int64(len(data))
+	hasher := NewContentHasher()
+	_, _ = hasher.Write(data)
+
+	imgMeta.setContent(hasher.Hash(), hasher.Size())
+}
+
+// WithContent returns the metadata of media whose content has the given hash and size,
+// as computed by a ContentHasher, with the ID updated accordingly. It is used for content
+// that is streamed instead of held by a Media.
+func (imgMeta MediaMeta) WithContent(hash string, size int64) MediaMeta {
+	imgMeta.setContent(hash, size)
 
-	// Update media ID
-	hasher.Reset()
+	return imgMeta
+}
+
+// setContent sets the content hash and size and updates the ID, which depends on the hash,
+// filename, MIME type and owner.
+func (imgMeta *MediaMeta) setContent(hash string, size int64) {
+	imgMeta.Hash = hash
+	imgMeta.Size = size
+
+	hasher := sha256.New()
 	hasher.Write([]byte(imgMeta.Hash))
 	hasher.Write([]byte(imgMeta.Filename))
 	hasher.Write([]byte(imgMeta.MIMEType))
@@ -49,6 +105,56 @@ func (imgMeta *MediaMeta) update(data []byte) {
 	imgMeta.ID = MediaID(encoding.EncodeCrockfordB32LC(hasher.Sum(nil)))
 }
 
+// Revision returns an identifier of the metadata's current state, which changes
+// whenever any metadata field changes.
+func (imgMeta MediaMeta) Revision() string {
+	data, err := json.Marshal(imgMeta)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+
+	return encoding.EncodeCrockfordB32LC(sum[:revisionLength])
+}
+
+// EffectiveVisibility returns the visibility of the media, which is private if it is not set,
+// e.g. for media stored before visibilities were introduced.
+func (imgMeta MediaMeta) EffectiveVisibility() MediaVisibility {
+	if imgMeta.Visibility == "" {
+		return VisibilityPrivate
+	}
+
+	return imgMeta.Visibility
+}
+
+// ModifiedTime returns the time the media was stored, or the zero time if it is unknown,
+// e.g. for media stored before the time was recorded.
+func (imgMeta MediaMeta) ModifiedTime() time.Time {
+	if imgMeta.Modified == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(imgMeta.Modified)
+}
+
+// TakenDate returns the date the media was taken as "2006-01-02", falling back to the
+// date it was stored in UTC. The date of the time taken is the local date of the camera.
+// Returns an empty string if both are unknown.
+func (imgMeta MediaMeta) TakenDate() string {
+	if len(imgMeta.TakenAt) >= len(time.DateOnly) {
+		if date, err := time.Parse(time.DateOnly, imgMeta.TakenAt[:len(time.DateOnly)]); err == nil {
+			return date.Format(time.DateOnly)
+		}
+	}
+
+	if imgMeta.Modified == 0 {
+		return ""
+	}
+
+	return time.UnixMilli(imgMeta.Modified).UTC().Format(time.DateOnly)
+}
+
 // AsBlob converts the metadata to a JSON-encoded blob using the ID as the blob ID.
 // Returns an error if JSON marshaling fails.
 func (imgMeta MediaMeta) AsBlob() (*Blob, error) {
@@ -0,0 +1,17 @@
+package domain
+
+// MediaMetaResponse represents the metadata of a media file, without its content.
+type MediaMetaResponse struct {
+	ID           string `json:"id"`                     // Unique identifier
+	Filename     string `json:"filename"`               // Original filename
+	Size         int64  `json:"size"`                   // Size in bytes
+	MIMEType     string `json:"mimeType"`               // MIME type
+	Hash         string `json:"hash"`                   // Content hash (Crockford Base32)
+	OriginalHash string `json:"originalHash,omitempty"` // Content hash as uploaded, if modified on ingest
+	Modified     int64  `json:"modified"`               // Unix time in milliseconds when the media was stored
+	TakenAt      string `json:"takenAt,omitempty"`      // Time the photo was taken per its EXIF metadata, if known
+
+	Visibility MediaVisibility `json:"visibility"`           // Who may access the media besides the owner
+	SharedWith []string        `json:"sharedWith,omitempty"` // Usernames the media is shared with, only listed to the owner
+	ShareToken string          `json:"shareToken,omitempty"` // Token granting access while unlisted, only listed to the owner
+}
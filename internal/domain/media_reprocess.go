@@ -0,0 +1,24 @@
+package domain
+
+// MediaReprocessRequest represents a request to run processors on already stored media,
+// e.g. to backfill a processor added to the ingest pipeline after they were uploaded.
+type MediaReprocessRequest struct {
+	Processors []string `json:"processors"`      // Names of the processors to run, in order
+	Owner      string   `json:"owner,omitempty"` // Only reprocess the media of this user, all if empty
+	Rate       int      `json:"rate,omitempty"`  // Maximum number of media per second, the default if 0
+}
+
+// MediaReprocessStatus represents the progress of a reprocessing job.
+type MediaReprocessStatus struct {
+	Running    bool              `json:"running"`            // Whether the job is still running
+	Processors []string          `json:"processors"`         // Names of the processors run
+	Owner      string            `json:"owner,omitempty"`    // User whose media are reprocessed, all if empty
+	Total      int               `json:"total"`              // Number of media to reprocess
+	Processed  int               `json:"processed"`          // Number of media reprocessed so far
+	Changed    int               `json:"changed"`            // Number of media modified by the processors
+	Failed     int               `json:"failed"`             // Number of media that could not be reprocessed
+	Replaced   map[string]string `json:"replaced,omitempty"` // New IDs of media whose content changed, keyed by old ID
+	Started    int64             `json:"started"`            // Unix time in milliseconds when the job started
+	Finished   int64             `json:"finished,omitempty"` // Unix time in milliseconds when the job finished
+	Error      string            `json:"error,omitempty"`    // Reason the job stopped early, if any
+}
@@ -0,0 +1,14 @@
+package domain
+
+// MediaShareRequest represents a request to create a time-limited download URL of a media file,
+// which can be used without authentication.
+type MediaShareRequest struct {
+	Width     int   `json:"width,omitempty"`     // Width the media is resized to, the original if 0
+	ExpiresIn int64 `json:"expiresIn,omitempty"` // Validity duration in seconds, the default if 0
+}
+
+// MediaShareResponse represents a time-limited download URL of a media file.
+type MediaShareResponse struct {
+	URL       string `json:"url"`       // Signed download URL
+	ExpiresAt int64  `json:"expiresAt"` // Unix timestamp when the URL expires
+}
@@ -0,0 +1,26 @@
+package domain
+
+// MediaVariantResponse describes a single resized derivative of a media file.
+type MediaVariantResponse struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height,omitempty"`
+	URL    string `json:"url"`
+}
+
+// MediaSrcsetResponse represents a response listing the resized derivatives of
+// a media file together with a ready-to-use HTML srcset attribute value.
+type MediaSrcsetResponse struct {
+	ID       string                 `json:"id"`
+	Srcset   string                 `json:"srcset"`
+	Variants []MediaVariantResponse `json:"variants"`
+}
+
+// MediaVariantsResponse represents a response listing the dimensions and URLs of the
+// configured resized derivatives of a media file.
+type MediaVariantsResponse struct {
+	ID       string                 `json:"id"`
+	Width    int                    `json:"width"`  // Width of the original in pixels
+	Height   int                    `json:"height"` // Height of the original in pixels
+	Srcset   string                 `json:"srcset"`
+	Variants []MediaVariantResponse `json:"variants"`
+}
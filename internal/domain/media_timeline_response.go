@@ -0,0 +1,17 @@
+package domain
+
+// MediaTimelineGroup represents the media taken within a single day or month.
+type MediaTimelineGroup struct {
+	Period   string   `json:"period"`   // Day ("2006-01-02") or month ("2006-01"), empty if unknown
+	Count    int      `json:"count"`    // Number of media in the period
+	CoverID  string   `json:"coverId"`  // ID of the most recent media of the period
+	CoverURL string   `json:"coverUrl"` // URL of a thumbnail of the cover
+	IDs      []string `json:"ids"`      // IDs of the media of the period, most recent first
+}
+
+// MediaTimelineResponse represents a user's media grouped by the period they were taken in,
+// most recent period first.
+type MediaTimelineResponse struct {
+	Group  string               `json:"group"`  // Grouping of the periods, "day" or "month"
+	Groups []MediaTimelineGroup `json:"groups"` // Periods containing media
+}
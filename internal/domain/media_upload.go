@@ -0,0 +1,33 @@
+package domain
+
+// MediaUpload is a resumable upload session. The content of a media file is appended to it
+// in chunks, which survive interrupted connections, and stored once it is complete.
+type MediaUpload struct {
+	ID       string `json:"id"`
+	Owner    string `json:"owner"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`    // Total size of the media file in bytes
+	Offset   int64  `json:"offset"`  // Number of bytes received so far
+	Chunks   int    `json:"chunks"`  // Number of chunks received so far
+	Expires  int64  `json:"expires"` // Unix timestamp when the session is removed unless resumed
+}
+
+// Complete reports whether all bytes of the media file were received.
+func (upload MediaUpload) Complete() bool {
+	return upload.Offset >= upload.Size
+}
+
+// MediaUploadRequest represents a request to create a resumable upload session.
+type MediaUploadRequest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"` // Total size of the media file in bytes
+}
+
+// MediaUploadResponse represents the state of a resumable upload session.
+type MediaUploadResponse struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`      // Total size of the media file in bytes
+	Offset    int64  `json:"offset"`    // Offset the next chunk is appended at
+	ExpiresAt int64  `json:"expiresAt"` // Unix timestamp when the session is removed unless resumed
+}
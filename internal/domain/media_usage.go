@@ -0,0 +1,17 @@
+package domain
+
+// MediaUsage holds the download usage of a user in an accounting period.
+type MediaUsage struct {
+	Username      string `json:"username"`      // Username of the accounted user
+	Period        string `json:"period"`        // Accounting month in YYYY-MM format
+	Downloads     int64  `json:"downloads"`     // Number of downloads
+	DownloadBytes int64  `json:"downloadBytes"` // Number of bytes downloaded
+}
+
+// MediaUsageResponse represents a response describing the download usage of the current period.
+type MediaUsageResponse struct {
+	Period        string `json:"period"`        // Accounting month in YYYY-MM format
+	Downloads     int64  `json:"downloads"`     // Number of downloads
+	DownloadBytes int64  `json:"downloadBytes"` // Number of bytes downloaded
+	DownloadCap   int64  `json:"downloadCap"`   // Maximum bytes per period, 0 if unlimited
+}
@@ -0,0 +1,14 @@
+package domain
+
+// MediaVariant holds the dimensions of a resized derivative of a media file.
+type MediaVariant struct {
+	Width  int // Width in pixels, the width the derivative is requested by
+	Height int // Height in pixels
+}
+
+// MediaVariantSet holds the dimensions of a media file and of its resized derivatives.
+type MediaVariantSet struct {
+	Meta     MediaMeta      // Metadata of the original
+	Original MediaVariant   // Dimensions of the original, oriented upright
+	Variants []MediaVariant // Derivatives in ascending order of width
+}
@@ -0,0 +1,14 @@
+package domain
+
+// OAuthTokenResponse represents a successful response of the OAuth2 token endpoint (RFC 6749 section 5.1).
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"` // Auth token, as returned by login
+	TokenType   string `json:"token_type"`   // Always "Bearer"
+	ExpiresIn   int64  `json:"expires_in"`   // Seconds until the access token expires
+}
+
+// OAuthErrorResponse represents an error response of the OAuth2 token endpoint (RFC 6749 section 5.2).
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
@@ -0,0 +1,33 @@
+package domain
+
+// OIDCDiscoveryDocument represents the OpenID Provider metadata of the auth service
+// (OpenID Connect Discovery 1.0, RFC 8414).
+type OIDCDiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+}
+
+// JWK represents an RSA public key as JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"` // Key type, "RSA"
+	Use string `json:"use"` // Public key use, "sig"
+	Alg string `json:"alg"` // Algorithm, "RS256"
+	Kid string `json:"kid"` // Key ID, matching the "kid" header of tokens
+	N   string `json:"n"`   // Base64url-encoded modulus
+	E   string `json:"e"`   // Base64url-encoded exponent
+}
+
+// JWKSet represents a JSON Web Key Set (RFC 7517 section 5).
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
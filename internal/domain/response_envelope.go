@@ -0,0 +1,17 @@
+package domain
+
+// ResponseEnvelope wraps the body of every JSON response if the envelope is enabled.
+// Exactly one of Data and Error is set.
+type ResponseEnvelope struct {
+	Data      any                    `json:"data"`                 // Response payload
+	Error     *ResponseEnvelopeError `json:"error"`                // Error details
+	RequestID string                 `json:"request_id,omitempty"` // Request ID to quote in support requests
+}
+
+// ResponseEnvelopeError describes the error of a failed request.
+type ResponseEnvelopeError struct {
+	Status  int              `json:"status"`           // HTTP status code
+	Code    ErrorCode        `json:"code,omitempty"`   // Stable code of the error, if known
+	Message string           `json:"message"`          // Human-readable error message
+	Errors  []BatchErrorItem `json:"errors,omitempty"` // Failed items of a batch operation
+}
@@ -0,0 +1,15 @@
+package domain
+
+// UploadValidationResponse describes the outcome of validating a single upload
+// without persisting it.
+type UploadValidationResponse struct {
+	Filename string `json:"filename"`
+	ID       string `json:"id,omitempty"`       // Media ID the upload would be stored as
+	MIMEType string `json:"mimeType,omitempty"` // Detected MIME type
+	Size     int64  `json:"size"`               // Size in bytes
+	Width    int    `json:"width,omitempty"`    // Image width in pixels
+	Height   int    `json:"height,omitempty"`   // Image height in pixels
+	Exists   bool   `json:"exists"`             // Whether the media is already stored for the user
+	Valid    bool   `json:"valid"`              // Whether the upload would be accepted
+	Error    string `json:"error,omitempty"`    // Reason for rejection
+}
@@ -1,20 +1,15 @@
 package domain
 
-import "errors"
-
-var (
-	// ErrUserAlreadyExists is returned when trying to create a user with an existing username.
-	ErrUserAlreadyExists = errors.New("user already exists")
-	// ErrUserNotFound is returned when looking up a non-existent user.
-	ErrUserNotFound = errors.New("user not found")
-	// ErrInvalidCredentials is returned when the username/password combination is incorrect.
-	ErrInvalidCredentials = errors.New("invalid credentials")
-)
-
 // User represents an authenticated user in the system.
 type User struct {
-	ID           int64  // Unique identifier
-	Username     string // Login username
-	PasswordHash []byte // Hashed password
-	CreatedAt    int64  // Unix timestamp of account creation
+	ID           int64    // Unique identifier
+	Username     string   // Login username
+	PasswordHash []byte   // Hashed password
+	CreatedAt    int64    // Unix timestamp of account creation
+	LastLoginAt  int64    // Unix timestamp of the last successful login, 0 if never
+	ExpiredAt    int64    // Unix timestamp when the account was expired, 0 if active
+	Roles        []string // Roles granting access to restricted endpoints, e.g. RoleAdmin
 }
+
+// RoleAdmin is the role of administrators, e.g. allowed to delete media of other users.
+const RoleAdmin = "admin"
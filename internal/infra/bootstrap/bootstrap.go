@@ -0,0 +1,115 @@
+// Package bootstrap reports errors of service binaries as friendly messages and exit codes.
+// Errors exit the process with the code of their category, panics are reserved for bugs.
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// Exit codes of service binaries.
+const (
+	ExitOK      = 0 // Success
+	ExitError   = 1 // Any error not in one of the categories below
+	ExitConfig  = 2 // Invalid configuration or command line
+	ExitBind    = 3 // The server cannot listen on its address
+	ExitStorage = 4 // The storage is unavailable
+)
+
+var (
+	// ErrConfig categorizes errors caused by invalid configuration or command lines.
+	ErrConfig = errors.New("configuration error")
+	// ErrBind categorizes errors caused by servers that cannot listen on their address.
+	ErrBind = errors.New("cannot bind address")
+	// ErrStorage categorizes errors caused by unavailable storage.
+	ErrStorage = errors.New("storage unavailable")
+)
+
+// exitCodes maps error categories to exit codes, checked in order.
+//
+//nolint:gochecknoglobals
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrConfig, ExitConfig},
+	{ErrBind, ExitBind},
+	{ErrStorage, ExitStorage},
+}
+
+// Wrap categorizes err as category, e.g. ErrStorage, unless err already has a category.
+// Returns nil if err is nil.
+func Wrap(category, err error) error {
+	if err == nil || ExitCode(err) != ExitError {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", category, err)
+}
+
+// ServeError categorizes an error returned by http.ListenAndServe:
+// Listen errors as ErrBind and invalid middleware chains as ErrConfig.
+func ServeError(err error) error {
+	switch {
+	case errors.Is(err, http.ErrListen):
+		return Wrap(ErrBind, err)
+	case errors.Is(err, http.ErrUnknownMiddleware), errors.Is(err, http.ErrDuplicateMiddleware):
+		return Wrap(ErrConfig, err)
+	default:
+		return err
+	}
+}
+
+// ConfigError categorizes an error returned by config.Parse as ErrConfig.
+func ConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return Wrap(ErrConfig, fmt.Errorf("parse config: %w", err))
+}
+
+// ExitCode returns the exit code of the category of err, ExitOK if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	for _, c := range exitCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+
+	return ExitError
+}
+
+// Report writes err to w prefixed by the program name and returns its exit code.
+// Nothing is written if err is nil.
+func Report(w io.Writer, name string, err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	_, _ = fmt.Fprintf(w, "%s: %v\n", name, err)
+
+	if errors.Is(err, ErrConfig) {
+		_, _ = fmt.Fprintf(w, "%s: see the configuration reference in README.md\n", name)
+	}
+
+	return ExitCode(err)
+}
+
+// ExitOnError reports err to stderr and exits the process with its exit code.
+// Returns without exiting if err is nil.
+func ExitOnError(name string, err error) {
+	if err == nil {
+		return
+	}
+
+	os.Exit(Report(os.Stderr, name, err))
+}
@@ -0,0 +1,51 @@
+package bootstrap_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/bootstrap"
+	"github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+var errBoom = errors.New("boom")
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantOut  string
+	}{
+		{name: "nil", err: nil, wantCode: bootstrap.ExitOK, wantOut: ""},
+		{name: "uncategorized", err: errBoom, wantCode: bootstrap.ExitError, wantOut: "svc: boom\n"},
+		{name: "config", err: bootstrap.ConfigError(errBoom), wantCode: bootstrap.ExitConfig, wantOut: "svc: configuration error: parse config: boom\n"},
+		{name: "bind", err: bootstrap.ServeError(fmt.Errorf("%w: %w", http.ErrListen, errBoom)), wantCode: bootstrap.ExitBind, wantOut: "svc: cannot bind address: listen: boom\n"},
+		{name: "middleware", err: bootstrap.ServeError(http.ErrUnknownMiddleware), wantCode: bootstrap.ExitConfig, wantOut: "svc: configuration error: unknown middleware\n"},
+		{name: "serve", err: bootstrap.ServeError(errBoom), wantCode: bootstrap.ExitError, wantOut: "svc: boom\n"},
+		{name: "storage", err: fmt.Errorf("startup: %w", bootstrap.Wrap(bootstrap.ErrStorage, errBoom)), wantCode: bootstrap.ExitStorage, wantOut: "svc: startup: storage unavailable: boom\n"},
+		{name: "first category wins", err: bootstrap.Wrap(bootstrap.ErrStorage, bootstrap.Wrap(bootstrap.ErrBind, errBoom)), wantCode: bootstrap.ExitBind, wantOut: "svc: cannot bind address: boom\n"},
+		{name: "wrap nil", err: bootstrap.Wrap(bootstrap.ErrStorage, nil), wantCode: bootstrap.ExitOK, wantOut: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out strings.Builder
+
+			code := bootstrap.Report(&out, "svc", tt.err)
+			if code != tt.wantCode {
+				t.Errorf("Report() = %d, want %d", code, tt.wantCode)
+			}
+
+			if got, _, _ := strings.Cut(out.String(), "svc: see"); got != tt.wantOut {
+				t.Errorf("Report() wrote %q, want %q", got, tt.wantOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Package container wires the components of a service binary. Components register typed
+// constructors, which are called once when the component is first resolved, and lifecycle
+// hooks, which are started in the order the components were constructed and stopped in reverse.
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+var (
+	// ErrNotProvided is returned when a component without constructor is resolved.
+	ErrNotProvided = errors.New("component not provided")
+	// ErrCycle is returned when the constructor of a component depends on the component itself.
+	ErrCycle = errors.New("component dependency cycle")
+)
+
+// Constructor creates a component of type T, resolving its dependencies from c.
+type Constructor[T any] func(ctx context.Context, c *Container) (T, error)
+
+// Hook is a lifecycle hook of a component. Start runs when the container starts, e.g. to launch
+// background loops, and Stop when it stops, e.g. to close connections. Either may be nil.
+type Hook struct {
+	Name  string                          // Name used in logs and errors
+	Start func(ctx context.Context) error // Starts the component
+	Stop  func(ctx context.Context) error // Stops the component or releases its resources
+}
+
+// Background returns a hook running a background loop of a component, e.g. a refresh loop, in
+// its own goroutine. Stop cancels the context of the loop and waits until run returns.
+func Background(name string, run func(ctx context.Context)) Hook {
+	var (
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+	)
+
+	return Hook{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			// The loop runs until the container stops, not until the start context ends
+			ctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				run(ctx)
+			}()
+
+			return nil
+		},
+		Stop: func(context.Context) error {
+			cancel()
+			wg.Wait()
+
+			return nil
+		},
+	}
+}
+
+// Closer returns a hook closing a component when the container stops, e.g. a database connection.
+func Closer(name string, closer interface{ Close() error }) Hook {
+	return Hook{
+		Name:  name,
+		Start: nil,
+		Stop: func(context.Context) error {
+			return closer.Close() //nolint:wrapcheck
+		},
+	}
+}
+
+// hookState is a registered hook and whether it was started.
+type hookState struct {
+	Hook
+
+	started bool
+}
+
+// Container holds the constructors, instances and lifecycle hooks of the components of a
+// service binary. Components are identified by their type, so distinct components of the same
+// type need distinct named types. Container is not safe for concurrent use, as it is meant to
+// be used by the main goroutine while wiring up a binary.
+type Container struct {
+	constructors map[reflect.Type]func(ctx context.Context, c *Container) (any, error)
+	instances    map[reflect.Type]any
+	resolving    []reflect.Type
+	hooks        []*hookState
+	log          logging.Logger
+}
+
+// New creates an empty Container.
+func New() *Container {
+	return &Container{
+		constructors: make(map[reflect.Type]func(ctx context.Context, c *Container) (any, error)),
+		instances:    make(map[reflect.Type]any),
+		resolving:    nil,
+		hooks:        nil,
+		log:          logging.GetLogger("infra.container"),
+	}
+}
+
+// Provide registers the constructor of components of type T, replacing any previous
+// constructor, e.g. to substitute a fake in tests. Components already constructed are kept.
+func Provide[T any](c *Container, constructor Constructor[T]) {
+	c.constructors[reflect.TypeFor[T]()] = func(ctx context.Context, c *Container) (any, error) {
+		return constructor(ctx, c)
+	}
+}
+
+// Supply registers an existing component of type T, e.g. the configuration of the binary.
+func Supply[T any](c *Container, component T) {
+	c.instances[reflect.TypeFor[T]()] = component
+}
+
+// Resolve returns the component of type T, constructing it and its dependencies on first use.
+// Returns ErrNotProvided if no constructor of T is registered, ErrCycle if constructing T
+// requires T itself, or the error of a constructor.
+func Resolve[T any](ctx context.Context, c *Container) (T, error) {
+	var zero T
+
+	typ := reflect.TypeFor[T]()
+
+	if instance, ok := c.instances[typ]; ok {
+		return instance.(T), nil //nolint:forcetypeassert
+	}
+
+	constructor, ok := c.constructors[typ]
+	if !ok {
+		return zero, fmt.Errorf("resolve %s: %w", typ, ErrNotProvided)
+	}
+
+	for i, resolving := range c.resolving {
+		if resolving == typ {
+			return zero, fmt.Errorf("resolve %s: %w: %s", typ, ErrCycle, cyclePath(slices.Concat(c.resolving[i:], []reflect.Type{typ})))
+		}
+	}
+
+	c.resolving = append(c.resolving, typ)
+	defer func() { c.resolving = c.resolving[:len(c.resolving)-1] }()
+
+	instance, err := constructor(ctx, c)
+	if err != nil {
+		return zero, fmt.Errorf("resolve %s: %w", typ, err)
+	}
+
+	c.instances[typ] = instance
+	c.log.DebugContext(ctx, "component constructed", "type", typ.String())
+
+	return instance.(T), nil //nolint:forcetypeassert
+}
+
+// Append registers lifecycle hooks, usually by the constructor of their component, so hooks of
+// dependencies precede the hooks of their dependents. Hooks without Start count as started, so
+// their Stop runs even if the container is never started, e.g. to close resources of components
+// constructed before a later constructor failed.
+func (c *Container) Append(hooks ...Hook) {
+	for _, hook := range hooks {
+		c.hooks = append(c.hooks, &hookState{Hook: hook, started: hook.Start == nil})
+	}
+}
+
+// Start runs the Start functions of all hooks not yet started in registration order.
+// If a hook fails to start, the remaining hooks are not started and the error is returned;
+// Stop must still be called to stop the hooks started so far.
+func (c *Container) Start(ctx context.Context) error {
+	for _, hook := range c.hooks {
+		if hook.started {
+			continue
+		}
+
+		if hook.Start != nil {
+			if err := hook.Start(ctx); err != nil {
+				return fmt.Errorf("start %s: %w", hook.Name, err)
+			}
+		}
+
+		hook.started = true
+
+		c.log.DebugContext(ctx, "component started", "name", hook.Name)
+	}
+
+	return nil
+}
+
+// Stop runs the Stop functions of all started hooks in reverse registration order.
+// All hooks are stopped even if some fail, and their errors are joined.
+func (c *Container) Stop(ctx context.Context) error {
+	var errs []error
+
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		hook := c.hooks[i]
+		if !hook.started {
+			continue
+		}
+
+		hook.started = false
+
+		if hook.Stop == nil {
+			continue
+		}
+
+		if err := hook.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", hook.Name, err))
+		} else {
+			c.log.DebugContext(ctx, "component stopped", "name", hook.Name)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// cyclePath formats the types of a dependency cycle as "A -> B -> A".
+func cyclePath(types []reflect.Type) string {
+	names := make([]string, len(types))
+	for i, typ := range types {
+		names[i] = typ.String()
+	}
+
+	return strings.Join(names, " -> ")
+}
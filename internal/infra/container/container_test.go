@@ -0,0 +1,146 @@
+package container_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/container"
+)
+
+type (
+	store  struct{ name string }
+	server struct{ store *store }
+	cycleA struct{}
+	cycleB struct{}
+)
+
+var errBroken = errors.New("broken")
+
+func TestContainer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := New()
+
+	var events []string
+
+	hook := func(name string) Hook {
+		return Hook{
+			Name:  name,
+			Start: func(context.Context) error { events = append(events, "start "+name); return nil },
+			Stop:  func(context.Context) error { events = append(events, "stop "+name); return nil },
+		}
+	}
+
+	constructed := 0
+
+	Provide(c, func(context.Context, *Container) (*store, error) {
+		constructed++
+
+		c.Append(hook("store"))
+
+		return &store{name: "db"}, nil
+	})
+	Provide(c, func(ctx context.Context, c *Container) (*server, error) {
+		store, err := Resolve[*store](ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Append(hook("server"))
+
+		return &server{store: store}, nil
+	})
+
+	srv, err := Resolve[*server](ctx, c)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if again, _ := Resolve[*store](ctx, c); again != srv.store || constructed != 1 {
+		t.Errorf("Resolve() constructed store %d times, want once", constructed)
+	}
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	want := []string{"start store", "start server", "stop server", "stop store"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestResolve_Errors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := New()
+
+	Provide(c, func(ctx context.Context, c *Container) (cycleA, error) {
+		_, err := Resolve[cycleB](ctx, c)
+
+		return cycleA{}, err
+	})
+	Provide(c, func(ctx context.Context, c *Container) (cycleB, error) {
+		_, err := Resolve[cycleA](ctx, c)
+
+		return cycleB{}, err
+	})
+	Provide(c, func(context.Context, *Container) (*store, error) {
+		return nil, errBroken
+	})
+
+	tests := []struct {
+		name    string
+		resolve func() error
+		wantErr error
+	}{
+		{name: "not provided", resolve: func() error { _, err := Resolve[*server](ctx, c); return err }, wantErr: ErrNotProvided},
+		{name: "cycle", resolve: func() error { _, err := Resolve[cycleA](ctx, c); return err }, wantErr: ErrCycle},
+		{name: "constructor error", resolve: func() error { _, err := Resolve[*store](ctx, c); return err }, wantErr: errBroken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.resolve(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainer_StopAfterFailedStart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := New()
+
+	var stopped []string
+
+	c.Append(
+		Hook{Name: "closer", Start: nil, Stop: func(context.Context) error { stopped = append(stopped, "closer"); return nil }},
+		Background("loop", func(ctx context.Context) { <-ctx.Done(); stopped = append(stopped, "loop") }),
+		Hook{Name: "broken", Start: func(context.Context) error { return errBroken }, Stop: nil},
+		Hook{Name: "never", Start: func(context.Context) error { return nil },
+			Stop: func(context.Context) error { stopped = append(stopped, "never"); return nil }},
+	)
+
+	if err := c.Start(ctx); !errors.Is(err, errBroken) {
+		t.Fatalf("Start() error = %v, want %v", err, errBroken)
+	}
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	if want := []string{"loop", "closer"}; !reflect.DeepEqual(stopped, want) {
+		t.Errorf("stopped = %v, want %v", stopped, want)
+	}
+}
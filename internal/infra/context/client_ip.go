@@ -0,0 +1,20 @@
+package context
+
+import (
+	"context"
+)
+
+const contextKeyClientIP = contextKey("client_ip")
+
+// ClientIPFromContext extracts the IP address of the client of the request from the context.
+// Returns the IP address and true if present, or empty string and false if not present.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	clientIP, ok := ctx.Value(contextKeyClientIP).(string)
+
+	return clientIP, ok
+}
+
+// WithClientIP creates a new context with the given client IP address.
+func WithClientIP(ctx context.Context, clientIP string) context.Context {
+	return context.WithValue(ctx, contextKeyClientIP, clientIP)
+}
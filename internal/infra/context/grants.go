@@ -0,0 +1,31 @@
+package context
+
+import (
+	"context"
+	"slices"
+)
+
+const contextKeyGrants = contextKey("grants")
+
+// GrantsFromContext extracts the IDs of resources the request was granted read access to,
+// e.g. by a signed URL, regardless of the authenticated user.
+// Returns the IDs and true if present, or nil and false if not present.
+func GrantsFromContext(ctx context.Context) ([]string, bool) {
+	grants, ok := ctx.Value(contextKeyGrants).([]string)
+
+	return grants, ok
+}
+
+// WithGrant creates a new context granting read access to the resource with the given ID.
+func WithGrant(ctx context.Context, id string) context.Context {
+	grants, _ := GrantsFromContext(ctx)
+
+	return context.WithValue(ctx, contextKeyGrants, append(slices.Clone(grants), id))
+}
+
+// HasGrant reports whether the context grants read access to the resource with the given ID.
+func HasGrant(ctx context.Context, id string) bool {
+	grants, _ := GrantsFromContext(ctx)
+
+	return slices.Contains(grants, id)
+}
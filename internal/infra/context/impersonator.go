@@ -0,0 +1,20 @@
+package context
+
+import (
+	"context"
+)
+
+const contextKeyImpersonator = contextKey("impersonator")
+
+// ImpersonatorFromContext extracts the username of the admin acting as the user in the context.
+// Returns the username and true if the request is impersonated, or empty string and false if not.
+func ImpersonatorFromContext(ctx context.Context) (string, bool) {
+	impersonator, ok := ctx.Value(contextKeyImpersonator).(string)
+
+	return impersonator, ok
+}
+
+// WithImpersonator creates a new context recording that the given admin acts as the user of the context.
+func WithImpersonator(ctx context.Context, impersonator string) context.Context {
+	return context.WithValue(ctx, contextKeyImpersonator, impersonator)
+}
@@ -0,0 +1,49 @@
+package context
+
+import (
+	"context"
+	"slices"
+)
+
+const contextKeyRoles = contextKey("roles")
+
+// RolesFromContext extracts the roles of the authenticated user from the context.
+// Returns the roles and true if present, or nil and false if not present.
+func RolesFromContext(ctx context.Context) ([]string, bool) {
+	roles, ok := ctx.Value(contextKeyRoles).([]string)
+
+	return roles, ok
+}
+
+// WithRoles creates a new context with the given roles of the authenticated user.
+func WithRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, contextKeyRoles, slices.Clone(roles))
+}
+
+// HasRole reports whether the authenticated user in the context has any of the given roles.
+func HasRole(ctx context.Context, roles ...string) bool {
+	userRoles, _ := RolesFromContext(ctx)
+
+	for _, role := range roles {
+		if slices.Contains(userRoles, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const contextKeyAdminAccess = contextKey("admin_access")
+
+// WithAdminAccess creates a new context granting access to resources regardless of their owner.
+// It must only be set by handlers restricted to administrators.
+func WithAdminAccess(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyAdminAccess, true)
+}
+
+// HasAdminAccess reports whether the context grants access to resources regardless of their owner.
+func HasAdminAccess(ctx context.Context) bool {
+	adminAccess, _ := ctx.Value(contextKeyAdminAccess).(bool)
+
+	return adminAccess
+}
@@ -0,0 +1,20 @@
+package context
+
+import (
+	"context"
+)
+
+const contextKeyShareToken = contextKey("share_token")
+
+// ShareTokenFromContext extracts the share token presented by the request, e.g. of unlisted media.
+// Returns the token and true if present, or empty string and false if not present.
+func ShareTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(contextKeyShareToken).(string)
+
+	return token, ok
+}
+
+// WithShareToken creates a new context with the share token presented by the request.
+func WithShareToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, contextKeyShareToken, token)
+}
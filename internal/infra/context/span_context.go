@@ -0,0 +1,79 @@
+package context
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+const contextKeySpanContext = contextKey("spanContext")
+
+// spanIDBytes is the number of random bytes of a span ID.
+const spanIDBytes = 8
+
+// TraceFlagSampled is the W3C Trace Context flag marking a trace as sampled.
+const TraceFlagSampled byte = 0x01
+
+// SpanContext identifies the span of a request within a distributed trace,
+// following the W3C Trace Context specification.
+type SpanContext struct {
+	TraceID    string // 32 lowercase hex digits identifying the trace
+	SpanID     string // 16 lowercase hex digits identifying the span of this service
+	ParentID   string // Span ID of the caller, empty if this span is the root
+	Flags      byte   // Trace flags, e.g. TraceFlagSampled
+	TraceState string // Vendor-specific tracestate header value, propagated unchanged
+}
+
+// IsSampled reports whether the trace is sampled.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&TraceFlagSampled != 0
+}
+
+// IsRemote reports whether the span continues a trace started by a caller.
+func (sc SpanContext) IsRemote() bool {
+	return sc.ParentID != ""
+}
+
+// Traceparent returns the traceparent header value propagating the span to a callee.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// SpanContextFromContext extracts the span context from the context.
+// Returns the span context and true if present, or an empty span context and false if not present.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(contextKeySpanContext).(SpanContext)
+
+	return sc, ok
+}
+
+// WithSpanContext creates a new context with the given span context.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKeySpanContext, sc)
+}
+
+// WithChildSpan creates a new context with a span for an operation within the span of ctx.
+// The child span shares the trace of its parent and references it as parent.
+// Returns ctx unchanged and false if ctx has no span context.
+func WithChildSpan(ctx context.Context) (context.Context, SpanContext, bool) {
+	parent, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return ctx, SpanContext{}, false
+	}
+
+	id := make([]byte, spanIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return ctx, SpanContext{}, false
+	}
+
+	child := SpanContext{
+		TraceID:    parent.TraceID,
+		SpanID:     hex.EncodeToString(id),
+		ParentID:   parent.SpanID,
+		Flags:      parent.Flags,
+		TraceState: parent.TraceState,
+	}
+
+	return WithSpanContext(ctx, child), child, true
+}
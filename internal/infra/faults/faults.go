@@ -0,0 +1,123 @@
+// Package faults injects latency and errors into calls of dependencies, so that resilience
+// features like retries, circuit breakers and timeouts can be exercised in integration
+// tests and staging. It is disabled by default and must never be enabled in production.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// ErrInjected is returned by calls failed by fault injection.
+var ErrInjected = errors.New("injected fault")
+
+// Config configures fault injection.
+type Config struct {
+	// Enabled enables fault injection
+	Enabled bool `env:"ENABLED" default:"false"`
+
+	// Operations are the comma-separated operations to inject faults into, e.g. "blob.fetch",
+	// or prefixes ending in "." like "blob.", empty for all operations
+	Operations string `env:"OPERATIONS" default:""`
+
+	// Latency is the delay in milliseconds added to every call
+	Latency int64 `env:"LATENCY" default:"0"`
+
+	// LatencyJitter is the maximum random delay in milliseconds added to the latency
+	LatencyJitter int64 `env:"LATENCY_JITTER" default:"0"`
+
+	// ErrorRate is the percentage of calls failed with ErrInjected
+	ErrorRate int `env:"ERROR_RATE" default:"0"`
+}
+
+//nolint:gochecknoglobals
+var faultsTotal = metrics.Default().NewCounterVec(
+	"faults_injected_total",
+	"Injected faults by operation and kind.",
+	"operation", "kind",
+)
+
+// Injector injects faults into operations.
+// A nil *Injector injects no faults.
+type Injector struct {
+	cfg        Config
+	operations []string
+	log        logging.Logger
+}
+
+// NewInjector creates an Injector from the configuration.
+// Returns nil if fault injection is disabled.
+func NewInjector(cfg Config) *Injector {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var operations []string
+
+	for _, op := range strings.Split(cfg.Operations, ",") {
+		if op = strings.TrimSpace(op); op != "" {
+			operations = append(operations, op)
+		}
+	}
+
+	return &Injector{
+		cfg:        cfg,
+		operations: operations,
+		log:        logging.GetLogger("infra.faults"),
+	}
+}
+
+// applies reports whether faults are injected into the operation.
+func (i *Injector) applies(op string) bool {
+	if len(i.operations) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(i.operations, func(pattern string) bool {
+		return pattern == op || (strings.HasSuffix(pattern, ".") && strings.HasPrefix(op, pattern))
+	})
+}
+
+// Inject delays the operation by the configured latency and fails it at the configured rate.
+// Returns ErrInjected if the operation fails, or the context error if the context ends
+// during the delay.
+func (i *Injector) Inject(ctx context.Context, op string) error {
+	if i == nil || !i.applies(op) {
+		return nil
+	}
+
+	delay := time.Duration(i.cfg.Latency) * time.Millisecond
+	if i.cfg.LatencyJitter > 0 {
+		delay += time.Duration(rand.Int64N(i.cfg.LatencyJitter+1)) * time.Millisecond //nolint:gosec
+	}
+
+	if delay > 0 {
+		faultsTotal.With(op, "latency").Inc()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	if i.cfg.ErrorRate > 0 && rand.IntN(100) < i.cfg.ErrorRate { //nolint:gosec,mnd
+		faultsTotal.With(op, "error").Inc()
+		i.log.DebugContext(ctx, "fault injected", "operation", op)
+
+		return fmt.Errorf("%s: %w", op, ErrInjected)
+	}
+
+	return nil
+}
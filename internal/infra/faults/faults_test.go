@@ -0,0 +1,56 @@
+package faults_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/faults"
+)
+
+func TestInjector_Inject(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cfg       faults.Config
+		op        string
+		timeout   time.Duration
+		wantErr   error
+		wantDelay time.Duration
+	}{
+		{name: "disabled", cfg: faults.Config{Enabled: false, ErrorRate: 100}, op: "blob.fetch"},
+		{name: "no faults", cfg: faults.Config{Enabled: true}, op: "blob.fetch"},
+		{name: "error", cfg: faults.Config{Enabled: true, ErrorRate: 100}, op: "blob.fetch", wantErr: faults.ErrInjected},
+		{name: "matching operation", cfg: faults.Config{Enabled: true, Operations: "authclient.validate, blob.fetch", ErrorRate: 100}, op: "blob.fetch", wantErr: faults.ErrInjected},
+		{name: "matching prefix", cfg: faults.Config{Enabled: true, Operations: "blob.", ErrorRate: 100}, op: "blob.store", wantErr: faults.ErrInjected},
+		{name: "other operation", cfg: faults.Config{Enabled: true, Operations: "blob.fetch", ErrorRate: 100}, op: "blob.store"},
+		{name: "latency", cfg: faults.Config{Enabled: true, Latency: 20, LatencyJitter: 5}, op: "blob.fetch", wantDelay: 20 * time.Millisecond},
+		{name: "latency exceeding deadline", cfg: faults.Config{Enabled: true, Latency: 1000}, op: "blob.fetch", timeout: 10 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				t.Cleanup(cancel)
+			}
+
+			start := time.Now()
+			err := faults.NewInjector(tt.cfg).Inject(ctx, tt.op)
+
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Errorf("Inject() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if elapsed := time.Since(start); elapsed < tt.wantDelay {
+				t.Errorf("Inject() took %v, want at least %v", elapsed, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+// Package featureflags toggles behaviors per deployment, per route and per tenant.
+//
+// Flags are declared by the code using them, together with their default. Rules override
+// the default, configured in the environment and in an optional JSON file that is reloaded
+// when it changes. A rule applies to all requests, to requests of a tenant (the
+// authenticated user), or to requests of a route (a URL path, or a path prefix ending in "/").
+// Tenant rules take precedence over route rules, which take precedence over global rules.
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// ErrInvalidRule is returned when a flag rule cannot be parsed.
+var ErrInvalidRule = errors.New("invalid feature flag rule")
+
+// Config configures the sources of flag rules.
+type Config struct {
+	// Overrides are comma-separated rules "name=bool", "name@tenant=bool" or "name@/route=bool"
+	Overrides string `env:"OVERRIDES" default:""`
+
+	// File is the path of a JSON file of rules, empty to disable.
+	// Its rules take precedence over Overrides.
+	File string `env:"FILE" default:""`
+
+	// ReloadInterval is the interval in seconds the file is checked for changes, 0 to disable
+	ReloadInterval int64 `env:"RELOAD_INTERVAL" default:"10"`
+}
+
+// Flag declares a feature flag.
+type Flag struct {
+	Name    string // Name referenced by rules
+	Default bool   // State if no rule applies
+}
+
+// FileRule is the JSON representation of the rules of a flag in the rules file, e.g.
+//
+//	{"transform_dsl": {"enabled": false, "tenants": {"alice": true}, "routes": {"/media/": true}}}
+type FileRule struct {
+	Enabled *bool           `json:"enabled,omitempty"`
+	Tenants map[string]bool `json:"tenants,omitempty"`
+	Routes  map[string]bool `json:"routes,omitempty"`
+}
+
+// rules are the rules of all flags.
+type rules map[string]*FileRule
+
+// Store evaluates flags against the current rules.
+// A nil *Store evaluates all flags to their default.
+type Store struct {
+	cfg       Config
+	overrides rules
+	current   atomic.Pointer[rules]
+	modTime   time.Time
+	log       logging.Logger
+}
+
+// NewStore creates a Store from the rules of the configuration.
+// Returns an error if the overrides or the rules file are invalid.
+func NewStore(cfg Config) (*Store, error) {
+	overrides, err := parseOverrides(cfg.Overrides)
+	if err != nil {
+		return nil, fmt.Errorf("parse overrides: %w", err)
+	}
+
+	//nolint:exhaustruct
+	s := &Store{
+		cfg:       cfg,
+		overrides: overrides,
+		log:       logging.GetLogger("infra.featureflags"),
+	}
+
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// parseOverrides parses comma-separated rules "name=bool", "name@tenant=bool" or "name@/route=bool".
+func parseOverrides(overrides string) (rules, error) {
+	parsed := make(rules)
+
+	for _, rule := range strings.Split(overrides, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, rule)
+		}
+
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidRule, rule, err)
+		}
+
+		name, scope, scoped := strings.Cut(strings.TrimSpace(key), "@")
+		if name == "" || (scoped && scope == "") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, rule)
+		}
+
+		flagRule := parsed.rule(name)
+
+		switch {
+		case !scoped:
+			flagRule.Enabled = &enabled
+		case strings.HasPrefix(scope, "/"):
+			flagRule.Routes[scope] = enabled
+		default:
+			flagRule.Tenants[scope] = enabled
+		}
+	}
+
+	return parsed, nil
+}
+
+// rule returns the rule of a flag, creating it if necessary.
+func (r rules) rule(name string) *FileRule {
+	flagRule, ok := r[name]
+	if !ok {
+		flagRule = &FileRule{Enabled: nil, Tenants: make(map[string]bool), Routes: make(map[string]bool)}
+		r[name] = flagRule
+	}
+
+	return flagRule
+}
+
+// merge returns the rules of r overridden by the rules of other.
+func (r rules) merge(other rules) rules {
+	merged := make(rules, len(r))
+
+	for _, src := range []rules{r, other} {
+		for name, srcRule := range src {
+			flagRule := merged.rule(name)
+			if srcRule.Enabled != nil {
+				flagRule.Enabled = srcRule.Enabled
+			}
+
+			for tenant, enabled := range srcRule.Tenants {
+				flagRule.Tenants[tenant] = enabled
+			}
+
+			for route, enabled := range srcRule.Routes {
+				flagRule.Routes[route] = enabled
+			}
+		}
+	}
+
+	return merged
+}
+
+// Reload reads the rules file if it changed since the last reload.
+// Returns whether the rules changed. On error, the current rules are kept.
+func (s *Store) Reload() (bool, error) {
+	if s.cfg.File == "" {
+		if s.current.Load() == nil {
+			s.current.Store(&s.overrides)
+
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	info, err := os.Stat(s.cfg.File)
+	if err != nil {
+		return false, fmt.Errorf("stat rules file: %w", err)
+	} else if s.current.Load() != nil && info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.cfg.File)
+	if err != nil {
+		return false, fmt.Errorf("read rules file: %w", err)
+	}
+
+	var fileRules rules
+	if err := json.Unmarshal(data, &fileRules); err != nil {
+		return false, fmt.Errorf("%w: %s: %w", ErrInvalidRule, s.cfg.File, err)
+	}
+
+	merged := s.overrides.merge(fileRules)
+	s.current.Store(&merged)
+	s.modTime = info.ModTime()
+
+	return true, nil
+}
+
+// Run reloads the rules file every ReloadInterval until the context is cancelled.
+// Returns immediately if there is no rules file or the interval is 0.
+func (s *Store) Run(ctx context.Context) {
+	if s == nil || s.cfg.File == "" || s.cfg.ReloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(s.cfg.ReloadInterval * int64(time.Second)))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed, err := s.Reload(); err != nil {
+				s.log.ErrorContext(ctx, "reload feature flags failed", "error", err)
+			} else if changed {
+				s.log.InfoContext(ctx, "feature flags reloaded", "file", s.cfg.File)
+			}
+		}
+	}
+}
+
+// Enabled evaluates a flag for the tenant of the context.
+func (s *Store) Enabled(ctx context.Context, flag Flag) bool {
+	tenant, _ := context_.UsernameFromContext(ctx)
+
+	return s.EnabledFor(flag, tenant, "")
+}
+
+// EnabledForRequest evaluates a flag for the tenant and the URL path of a request.
+func (s *Store) EnabledForRequest(r *http.Request, flag Flag) bool {
+	tenant, _ := context_.UsernameFromContext(r.Context())
+
+	return s.EnabledFor(flag, tenant, r.URL.Path)
+}
+
+// EnabledFor evaluates a flag for a tenant and a route, either may be empty.
+// Of the route rules, the one of the longest matching route applies.
+func (s *Store) EnabledFor(flag Flag, tenant, route string) bool {
+	if s == nil {
+		return flag.Default
+	}
+
+	flagRule, ok := (*s.current.Load())[flag.Name]
+	if !ok {
+		return flag.Default
+	}
+
+	if enabled, ok := flagRule.Tenants[tenant]; ok && tenant != "" {
+		return enabled
+	}
+
+	if route != "" {
+		var (
+			match   string
+			enabled bool
+		)
+
+		for pattern, patternEnabled := range flagRule.Routes {
+			if (pattern == route || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(route, pattern))) &&
+				len(pattern) > len(match) {
+				match, enabled = pattern, patternEnabled
+			}
+		}
+
+		if match != "" {
+			return enabled
+		}
+	}
+
+	if flagRule.Enabled != nil {
+		return *flagRule.Enabled
+	}
+
+	return flag.Default
+}
@@ -0,0 +1,120 @@
+package featureflags_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
+)
+
+func TestStore_EnabledFor(t *testing.T) {
+	t.Parallel()
+
+	flagOn := featureflags.Flag{Name: "on", Default: true}
+	flagOff := featureflags.Flag{Name: "off", Default: false}
+
+	store, err := featureflags.NewStore(featureflags.Config{
+		Overrides: "on=false, on@alice=true, on@/media/=true, on@/media/data=false, off@bob=true",
+	})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		store  *featureflags.Store
+		flag   featureflags.Flag
+		tenant string
+		route  string
+		want   bool
+	}{
+		{name: "nil store", store: nil, flag: flagOn, want: true},
+		{name: "global rule", store: store, flag: flagOn, want: false},
+		{name: "tenant rule", store: store, flag: flagOn, tenant: "alice", want: true},
+		{name: "route prefix rule", store: store, flag: flagOn, route: "/media/abc", want: true},
+		{name: "longest route rule", store: store, flag: flagOn, route: "/media/data", want: false},
+		{name: "tenant before route", store: store, flag: flagOn, tenant: "alice", route: "/media/data", want: true},
+		{name: "unmatched route", store: store, flag: flagOn, route: "/gallery", want: false},
+		{name: "default", store: store, flag: flagOff, tenant: "alice", want: false},
+		{name: "tenant rule without global rule", store: store, flag: flagOff, tenant: "bob", want: true},
+		{name: "unknown flag", store: store, flag: featureflags.Flag{Name: "unknown", Default: true}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.store.EnabledFor(tt.flag, tt.tenant, tt.route); got != tt.want {
+				t.Errorf("EnabledFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStore_InvalidOverrides(t *testing.T) {
+	t.Parallel()
+
+	for _, overrides := range []string{"on", "on=maybe", "=true", "on@=true"} {
+		if _, err := featureflags.NewStore(featureflags.Config{Overrides: overrides}); !errors.Is(err, featureflags.ErrInvalidRule) {
+			t.Errorf("NewStore(%q) error = %v, want %v", overrides, err, featureflags.ErrInvalidRule)
+		}
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	t.Parallel()
+
+	flag := featureflags.Flag{Name: "flag", Default: false}
+	path := filepath.Join(t.TempDir(), "flags.json")
+
+	writeRules := func(rules string, modTime time.Time) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+			t.Fatalf("failed to write rules: %v", err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("failed to set mod time: %v", err)
+		}
+	}
+
+	now := time.Now()
+	writeRules(`{"flag": {"enabled": true, "tenants": {"alice": false}}}`, now)
+
+	store, err := featureflags.NewStore(featureflags.Config{Overrides: "flag@bob=false", File: path})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	if !store.EnabledFor(flag, "", "") || store.EnabledFor(flag, "alice", "") || store.EnabledFor(flag, "bob", "") {
+		t.Fatal("EnabledFor() does not merge file rules and overrides")
+	}
+
+	// Unchanged file
+	if changed, err := store.Reload(); err != nil || changed {
+		t.Fatalf("Reload() = %v, %v, want false, nil", changed, err)
+	}
+
+	// Invalid file keeps the current rules
+	writeRules(`{`, now.Add(time.Second))
+
+	if _, err := store.Reload(); !errors.Is(err, featureflags.ErrInvalidRule) {
+		t.Fatalf("Reload() error = %v, want %v", err, featureflags.ErrInvalidRule)
+	} else if !store.EnabledFor(flag, "", "") {
+		t.Fatal("Reload() replaced rules by invalid file")
+	}
+
+	writeRules(`{"flag": {"enabled": false}}`, now.Add(2*time.Second))
+
+	if changed, err := store.Reload(); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v, want true, nil", changed, err)
+	}
+
+	if store.EnabledFor(flag, "", "") || store.EnabledFor(flag, "alice", "") {
+		t.Error("EnabledFor() after reload uses stale rules")
+	}
+}
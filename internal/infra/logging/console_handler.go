@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"os"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -157,7 +158,7 @@ func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) Handler {
 		Output:    h.Output,
 		Level:     h.Level,
 		PkgLevels: h.PkgLevels,
-		attrs:     append(h.attrs, attrs...),
+		attrs:     append(slices.Clip(h.attrs), attrs...),
 		groups:    h.groups,
 	}
 }
@@ -169,7 +170,7 @@ func (h *ConsoleHandler) WithGroup(name string) Handler {
 		Level:     h.Level,
 		PkgLevels: h.PkgLevels,
 		attrs:     h.attrs,
-		groups:    append(h.groups, name),
+		groups:    append(slices.Clip(h.groups), name),
 	}
 }
 
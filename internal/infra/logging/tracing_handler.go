@@ -29,6 +29,14 @@ func (h *TracingHandler) Handle(ctx context.Context, r slog.Record) error {
 		))
 	}
 
+	if spanCtx, ok := context_.SpanContextFromContext(ctx); ok {
+		r.AddAttrs(slog.Group("span",
+			slog.String("trace_id", spanCtx.TraceID),
+			slog.String("id", spanCtx.SpanID),
+			slog.String("parent_id", spanCtx.ParentID),
+		))
+	}
+
 	//nolint:wrapcheck
 	return h.h.Handle(ctx, r)
 }
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing metric value.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increments the counter by the given non-negative value.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+
+	for {
+		oldBits := c.bits.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+
+		if c.bits.CompareAndSwap(oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+	m          sync.Mutex
+	counters   map[string]*Counter
+	values     map[string][]string
+}
+
+var _ collector = (*CounterVec)(nil)
+
+// NewCounterVec creates a counter vector with the given label names in the registry.
+// Returns the existing vector if a counter with the same name was registered before.
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return register(reg, name, func() *CounterVec {
+		return &CounterVec{
+			metricName: name,
+			help:       help,
+			labels:     labels,
+			m:          sync.Mutex{},
+			counters:   make(map[string]*Counter),
+			values:     make(map[string][]string),
+		}
+	})
+}
+
+// NewCounter creates an unlabeled counter in the registry.
+func (reg *Registry) NewCounter(name, help string) *Counter {
+	return reg.NewCounterVec(name, help).With()
+}
+
+// With returns the counter for the given label values, creating it if necessary.
+// Panics if the number of values does not match the number of labels.
+func (vec *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(vec.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", vec.metricName, len(vec.labels), len(values)))
+	}
+
+	key := labelKey(values)
+
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	counter, ok := vec.counters[key]
+	if !ok {
+		counter = new(Counter)
+		vec.counters[key] = counter
+		vec.values[key] = append([]string(nil), values...)
+	}
+
+	return counter
+}
+
+// Sum returns the sum of the counters whose label has the given value, e.g. all cache hits
+// regardless of other labels. Returns 0 if the vector has no such label.
+func (vec *CounterVec) Sum(label, value string) float64 {
+	index := slices.Index(vec.labels, label)
+	if index < 0 {
+		return 0
+	}
+
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	var sum float64
+
+	for key, values := range vec.values {
+		if values[index] == value {
+			sum += vec.counters[key].Value()
+		}
+	}
+
+	return sum
+}
+
+func (vec *CounterVec) name() string {
+	return vec.metricName
+}
+
+func (vec *CounterVec) write(w *bufio.Writer) {
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	writeHeader(w, vec.metricName, vec.help, typeCounter)
+
+	keys := make([]string, 0, len(vec.counters))
+	for key := range vec.counters {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		writeSample(w, vec.metricName, vec.labels, vec.values[key], vec.counters[key].Value())
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Gauge is a metric value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the gauge to the given value.
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds the given value to the gauge. Use negative values to decrease it.
+func (g *Gauge) Add(v float64) {
+	for {
+		oldBits := g.bits.Load()
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+
+		if g.bits.CompareAndSwap(oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	metricName string
+	help       string
+	labels     []string
+	m          sync.Mutex
+	gauges     map[string]*Gauge
+	values     map[string][]string
+}
+
+var _ collector = (*GaugeVec)(nil)
+
+// NewGaugeVec creates a gauge vector with the given label names in the registry.
+// Returns the existing vector if a gauge with the same name was registered before.
+func (reg *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return register(reg, name, func() *GaugeVec {
+		return &GaugeVec{
+			metricName: name,
+			help:       help,
+			labels:     labels,
+			m:          sync.Mutex{},
+			gauges:     make(map[string]*Gauge),
+			values:     make(map[string][]string),
+		}
+	})
+}
+
+// NewGauge creates an unlabeled gauge in the registry.
+func (reg *Registry) NewGauge(name, help string) *Gauge {
+	return reg.NewGaugeVec(name, help).With()
+}
+
+// With returns the gauge for the given label values, creating it if necessary.
+// Panics if the number of values does not match the number of labels.
+func (vec *GaugeVec) With(values ...string) *Gauge {
+	if len(values) != len(vec.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", vec.metricName, len(vec.labels), len(values)))
+	}
+
+	key := labelKey(values)
+
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	gauge, ok := vec.gauges[key]
+	if !ok {
+		gauge = new(Gauge)
+		vec.gauges[key] = gauge
+		vec.values[key] = append([]string(nil), values...)
+	}
+
+	return gauge
+}
+
+func (vec *GaugeVec) name() string {
+	return vec.metricName
+}
+
+func (vec *GaugeVec) write(w *bufio.Writer) {
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	writeHeader(w, vec.metricName, vec.help, typeGauge)
+
+	keys := make([]string, 0, len(vec.gauges))
+	for key := range vec.gauges {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		writeSample(w, vec.metricName, vec.labels, vec.values[key], vec.gauges[key].Value())
+	}
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+//nolint:gochecknoglobals
+var (
+	// DefaultDurationBuckets are histogram buckets suitable for request and operation durations in seconds.
+	DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// DefaultSizeBuckets are histogram buckets suitable for payload sizes in bytes.
+	DefaultSizeBuckets = []float64{1 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+)
+
+// Histogram samples observations and counts them in configurable buckets.
+type Histogram struct {
+	m       sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += v
+}
+
+// ObserveDuration observes the time elapsed since start in seconds.
+func (h *Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.count
+}
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() float64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.sum
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+	m          sync.Mutex
+	histograms map[string]*Histogram
+	values     map[string][]string
+}
+
+var _ collector = (*HistogramVec)(nil)
+
+// NewHistogramVec creates a histogram vector with the given buckets and label names in the registry.
+// Returns the existing vector if a histogram with the same name was registered before.
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	return register(reg, name, func() *HistogramVec {
+		return &HistogramVec{
+			metricName: name,
+			help:       help,
+			labels:     labels,
+			buckets:    buckets,
+			m:          sync.Mutex{},
+			histograms: make(map[string]*Histogram),
+			values:     make(map[string][]string),
+		}
+	})
+}
+
+// NewHistogram creates an unlabeled histogram in the registry.
+func (reg *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return reg.NewHistogramVec(name, help, buckets).With()
+}
+
+// With returns the histogram for the given label values, creating it if necessary.
+// Panics if the number of values does not match the number of labels.
+func (vec *HistogramVec) With(values ...string) *Histogram {
+	if len(values) != len(vec.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", vec.metricName, len(vec.labels), len(values)))
+	}
+
+	key := labelKey(values)
+
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	histogram, ok := vec.histograms[key]
+	if !ok {
+		histogram = &Histogram{
+			m:       sync.Mutex{},
+			buckets: vec.buckets,
+			counts:  make([]uint64, len(vec.buckets)),
+			count:   0,
+			sum:     0,
+		}
+		vec.histograms[key] = histogram
+		vec.values[key] = append([]string(nil), values...)
+	}
+
+	return histogram
+}
+
+func (vec *HistogramVec) name() string {
+	return vec.metricName
+}
+
+func (vec *HistogramVec) write(w *bufio.Writer) {
+	vec.m.Lock()
+	defer vec.m.Unlock()
+
+	writeHeader(w, vec.metricName, vec.help, typeHistogram)
+
+	keys := make([]string, 0, len(vec.histograms))
+	for key := range vec.histograms {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	bucketLabels := append(slices.Clone(vec.labels), "le")
+
+	for _, key := range keys {
+		histogram := vec.histograms[key]
+		values := vec.values[key]
+
+		histogram.m.Lock()
+
+		for i, upper := range vec.buckets {
+			writeSample(w, vec.metricName+"_bucket", bucketLabels,
+				append(slices.Clone(values), formatFloat(upper)), float64(histogram.counts[i]))
+		}
+
+		writeSample(w, vec.metricName+"_bucket", bucketLabels,
+			append(slices.Clone(values), "+Inf"), float64(histogram.count))
+		writeSample(w, vec.metricName+"_sum", vec.labels, values, histogram.sum)
+		writeSample(w, vec.metricName+"_count", vec.labels, values, float64(histogram.count))
+
+		histogram.m.Unlock()
+	}
+}
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types as used in the Prometheus text exposition format.
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// collector is implemented by all metric vectors.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics and renders them in the Prometheus text exposition format.
+type Registry struct {
+	m          sync.Mutex
+	collectors map[string]collector
+}
+
+//nolint:gochecknoglobals
+var defaultRegistry = NewRegistry()
+
+// NewRegistry creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		m:          sync.Mutex{},
+		collectors: make(map[string]collector),
+	}
+}
+
+// Default returns the process-wide default registry.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// register adds the collector created by newFn to the registry, unless a collector with
+// the same name already exists, in which case the existing collector is returned.
+// This makes metric creation idempotent across multiple service instances.
+func register[T collector](reg *Registry, name string, newFn func() T) T {
+	reg.m.Lock()
+	defer reg.m.Unlock()
+
+	if existing, ok := reg.collectors[name]; ok {
+		if c, ok := existing.(T); ok {
+			return c
+		}
+
+		panic(fmt.Sprintf("metrics: %q already registered with a different type", name))
+	}
+
+	c := newFn()
+	reg.collectors[name] = c
+
+	return c
+}
+
+// WriteTo writes all metrics of the registry in the Prometheus text exposition format.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.m.Lock()
+	collectors := make([]collector, 0, len(reg.collectors))
+
+	for _, c := range reg.collectors {
+		collectors = append(collectors, c)
+	}
+	reg.m.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	counter := &countingWriter{w: w, n: 0}
+	buf := bufio.NewWriter(counter)
+
+	for _, c := range collectors {
+		c.write(buf)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return counter.n, fmt.Errorf("flush: %w", err)
+	}
+
+	return counter.n, nil
+}
+
+// Handler returns an http.Handler serving the metrics of the given registry.
+func Handler(reg *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = reg.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err //nolint:wrapcheck
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// writeSample writes a single sample line.
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 {
+		w.WriteByte('{')
+
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabelValue(values[i]))
+			w.WriteByte('"')
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+// labelKey joins label values into a map key.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
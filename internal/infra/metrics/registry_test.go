@@ -0,0 +1,127 @@
+package metrics_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+
+	requests := reg.NewCounterVec("test_requests_total", "Total requests.", "method")
+	requests.With("GET").Inc()
+	requests.With("GET").Add(2)
+	requests.With(`P"OST`).Inc()
+
+	reg.NewGauge("test_inflight", "In-flight requests.").Set(3)
+
+	sizes := reg.NewHistogram("test_size_bytes", "Sizes.", []float64{10, 100})
+	sizes.Observe(5)
+	sizes.Observe(50)
+	sizes.Observe(500)
+
+	var out strings.Builder
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP test_inflight In-flight requests.
+# TYPE test_inflight gauge
+test_inflight 3
+# HELP test_requests_total Total requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET"} 3
+test_requests_total{method="P\"OST"} 1
+# HELP test_size_bytes Sizes.
+# TYPE test_size_bytes histogram
+test_size_bytes_bucket{le="10"} 1
+test_size_bytes_bucket{le="100"} 2
+test_size_bytes_bucket{le="+Inf"} 3
+test_size_bytes_sum 555
+test_size_bytes_count 3
+`
+
+	if got := out.String(); got != want {
+		t.Errorf("WriteTo() mismatch\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRegistry_RegisterIdempotent(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+
+	first := reg.NewCounterVec("test_total", "Test.", "label")
+	second := reg.NewCounterVec("test_total", "Test.", "label")
+
+	first.With("a").Inc()
+
+	if got := second.With("a").Value(); got != 1 {
+		t.Errorf("Value() = %v, want 1", got)
+	}
+}
+
+func TestCounterVec_Sum(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+	requests := reg.NewCounterVec("test_cache_total", "Test.", "result", "bucket")
+
+	requests.With("hit", "small").Add(2)
+	requests.With("hit", "large").Add(3)
+	requests.With("miss", "small").Inc()
+
+	tests := []struct {
+		label, value string
+		want         float64
+	}{
+		{label: "result", value: "hit", want: 5},
+		{label: "result", value: "miss", want: 1},
+		{label: "bucket", value: "small", want: 3},
+		{label: "unknown", value: "hit", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := requests.Sum(tt.label, tt.value); got != tt.want {
+			t.Errorf("Sum(%q, %q) = %v, want %v", tt.label, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseObjective(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{input: "0.999", want: 0.999},
+		{input: "99.9%", want: 0.999},
+		{input: " 99.95% ", want: 0.9995},
+		{input: "1", wantErr: true},
+		{input: "0%", wantErr: true},
+		{input: "-0.5", wantErr: true},
+		{input: "nines", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := metrics.ParseObjective(tt.input)
+			if (err != nil) != tt.wantErr || (err != nil) != errors.Is(err, metrics.ErrInvalidObjective) {
+				t.Fatalf("ParseObjective() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseObjective() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
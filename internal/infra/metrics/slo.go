@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SLO event results.
+const (
+	ResultGood = "good"
+	ResultBad  = "bad"
+)
+
+// ratioPrecision is the precision of exposed SLO ratios.
+const ratioPrecision = 1e9
+
+// ErrInvalidObjective is returned when an SLO objective is not a ratio between 0 and 1.
+var ErrInvalidObjective = errors.New("invalid slo objective")
+
+// SLO counts the good and bad events of a service level objective, i.e. the fraction of
+// events that must be good, in the counter <name>_events_total labeled by result.
+// The objective is exposed as slo_objective_ratio and the allowed fraction of bad events as
+// slo_error_budget_ratio, both labeled by slo, so alerts can compare the rate of bad events
+// to the error budget without repeating the objective, e.g. for a 1h burn rate of 14.4:
+//
+//	sum(rate(<name>_events_total{result="bad"}[1h])) / sum(rate(<name>_events_total[1h]))
+//	  > 14.4 * on() slo_error_budget_ratio{slo="<name>"}
+type SLO struct {
+	objective float64
+	events    *CounterVec
+}
+
+// NewSLO registers an SLO with the given objective and event label names in the registry.
+// Returns the existing SLO if one with the same name was registered before.
+// Panics if the objective is not in (0, 1).
+func (reg *Registry) NewSLO(name, help string, objective float64, labels ...string) *SLO {
+	if objective <= 0 || objective >= 1 {
+		panic(fmt.Sprintf("metrics: %s objective %v not in (0, 1)", name, objective))
+	}
+
+	reg.NewGaugeVec("slo_objective_ratio", "Fraction of events that must be good by SLO.", "slo").
+		With(name).Set(objective)
+	reg.NewGaugeVec("slo_error_budget_ratio", "Fraction of events that may be bad by SLO.", "slo").
+		With(name).Set(roundRatio(1 - objective))
+
+	return &SLO{
+		objective: objective,
+		events:    reg.NewCounterVec(name+"_events_total", help, slices.Concat(labels, []string{"result"})...),
+	}
+}
+
+// Objective returns the fraction of events that must be good.
+func (slo *SLO) Objective() float64 {
+	return slo.objective
+}
+
+// Record counts an event with the given label values as good or bad.
+// Panics if the number of values does not match the number of labels.
+func (slo *SLO) Record(good bool, values ...string) {
+	result := ResultBad
+	if good {
+		result = ResultGood
+	}
+
+	slo.events.With(slices.Concat(values, []string{result})...).Inc()
+}
+
+// ParseObjective parses an SLO objective given as ratio, e.g. "0.999", or percentage, e.g. "99.9%".
+// Returns ErrInvalidObjective if it is not in (0, 1).
+func ParseObjective(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	scale := 1.0
+	if trimmed, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = trimmed, 100
+	}
+
+	objective, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidObjective, s)
+	}
+
+	objective = roundRatio(objective / scale)
+	if objective <= 0 || objective >= 1 {
+		return 0, fmt.Errorf("%w: %q not in (0, 1)", ErrInvalidObjective, s)
+	}
+
+	return objective, nil
+}
+
+// roundRatio rounds a ratio to nine decimals, removing floating point artifacts
+// like 0.9990000000000001 from exposed values.
+func roundRatio(ratio float64) float64 {
+	return math.Round(ratio*ratioPrecision) / ratioPrecision
+}
+
+// BucketsWith returns a sorted copy of the buckets including the given bounds,
+// so histograms have bucket boundaries at SLO thresholds.
+func BucketsWith(buckets []float64, bounds ...float64) []float64 {
+	merged := slices.Concat(buckets, bounds)
+	slices.Sort(merged)
+
+	return slices.Compact(merged)
+}
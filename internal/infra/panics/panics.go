@@ -0,0 +1,72 @@
+// Package panics turns recovered panics into errors carrying their stack traces.
+package panics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// ErrPanic matches any PanicError using errors.Is.
+var ErrPanic = errors.New("panic")
+
+// PanicError is an error created from a recovered panic.
+type PanicError struct {
+	Value any    // Value passed to panic
+	Stack []byte // Stack trace of the panicking goroutine
+}
+
+// New creates a PanicError from a value returned by recover, capturing the current stack.
+// It must be called from the deferred function that recovered the panic.
+func New(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// Error implements error.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Is reports whether target is ErrPanic.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanic //nolint:errorlint
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+//nolint:gochecknoglobals
+var panicsTotal = metrics.Default().NewCounterVec(
+	"panics_recovered_total",
+	"Recovered panics by source.",
+	"source",
+)
+
+// Recover creates a PanicError from a value returned by recover, logs it to log with its
+// stack trace and the given attributes, and counts it by source, e.g. "http" or "upload".
+// It must be called from the deferred function that recovered the panic.
+func Recover(ctx context.Context, log logging.Logger, source string, value any, args ...any) *PanicError {
+	err := New(value)
+
+	panicsTotal.With(source).Inc()
+
+	log.ErrorContext(ctx, "panic recovered", append(args,
+		logging.Group("error",
+			"source", source,
+			"panic", value,
+			"stack", string(err.Stack),
+		),
+	)...)
+
+	return err
+}
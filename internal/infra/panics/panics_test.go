@@ -0,0 +1,91 @@
+package panics_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+	"github.com/mkrupp/homecase-michael/internal/infra/panics"
+)
+
+var errBoom = errors.New("boom")
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		value     any
+		wantMsg   string
+		wantCause error
+	}{
+		{name: "string value", value: "boom", wantMsg: "panic: boom"},
+		{name: "error value", value: errBoom, wantMsg: "panic: boom", wantCause: errBoom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := recoverFrom(t, tt.value)
+
+			var panicErr *panics.PanicError
+			if !errors.As(err, &panicErr) {
+				t.Fatalf("error = %v, want *PanicError", err)
+			}
+
+			if !errors.Is(err, panics.ErrPanic) {
+				t.Error("errors.Is(err, ErrPanic) = false, want true")
+			}
+
+			if tt.wantCause != nil && !errors.Is(err, tt.wantCause) {
+				t.Errorf("errors.Is(err, %v) = false, want true", tt.wantCause)
+			}
+
+			if panicErr.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", panicErr.Error(), tt.wantMsg)
+			}
+
+			if !strings.Contains(string(panicErr.Stack), "panicking") {
+				t.Errorf("stack does not contain the panicking function:\n%s", panicErr.Stack)
+			}
+		})
+	}
+}
+
+func TestRecover_CountsMetric(t *testing.T) {
+	t.Parallel()
+
+	_ = recoverFrom(t, "boom")
+
+	var out strings.Builder
+	if _, err := metrics.Default().WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	if !strings.Contains(out.String(), `panics_recovered_total{source="test"}`) {
+		t.Errorf("metrics do not count recovered panics:\n%s", out.String())
+	}
+}
+
+func recoverFrom(t *testing.T, value any) (err error) {
+	t.Helper()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("wrapped: %w", panics.Recover(context.Background(), logging.NewNopLogger(), "test", p))
+		}
+	}()
+
+	panicking(value)
+
+	return nil
+}
+
+func panicking(value any) {
+	panic(value)
+}
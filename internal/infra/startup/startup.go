@@ -0,0 +1,238 @@
+// Package startup orders the startup of a service behind probes of its dependencies.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// ErrDependencyUnavailable is returned when a required dependency does not become available.
+var ErrDependencyUnavailable = errors.New("dependency unavailable")
+
+// Config holds the retry configuration of dependency probes.
+type Config struct {
+	// MaxAttempts is the number of probe attempts before a dependency is considered unavailable.
+	MaxAttempts int `env:"MAX_ATTEMPTS" default:"10"`
+
+	// InitialBackoff is the delay in milliseconds before the first retry.
+	// The delay doubles with every attempt.
+	InitialBackoff int64 `env:"INITIAL_BACKOFF" default:"250"`
+
+	// MaxBackoff is the maximum delay in milliseconds between two attempts.
+	MaxBackoff int64 `env:"MAX_BACKOFF" default:"5000"`
+
+	// Optional is a comma-separated list of dependency names that may be unavailable
+	// at startup, overriding Dependency.Required. The service then starts degraded.
+	Optional string `env:"OPTIONAL" default:""`
+}
+
+// ProbeFunc checks whether a dependency is available.
+type ProbeFunc func(ctx context.Context) error
+
+// Dependency describes a dependency of a service.
+type Dependency struct {
+	Name     string    // Name used in logs and status reports
+	Probe    ProbeFunc // Check of the dependency's availability
+	Required bool      // Whether the service must not start without the dependency
+}
+
+// Orchestrator probes the dependencies of a service before it starts.
+// Required dependencies must become available for the startup to succeed. Optional
+// dependencies that are unavailable leave the service in a degraded state and are
+// probed in the background until they become available.
+type Orchestrator struct {
+	deps     []Dependency
+	degraded map[string]error
+	m        sync.RWMutex
+	log      logging.Logger
+	cfg      Config
+}
+
+// NewOrchestrator creates an Orchestrator with the given retry configuration.
+func NewOrchestrator(cfg Config) *Orchestrator {
+	return &Orchestrator{
+		deps:     nil,
+		degraded: make(map[string]error),
+		m:        sync.RWMutex{},
+		log:      logging.GetLogger("infra.startup"),
+		cfg:      cfg,
+	}
+}
+
+// Add registers a dependency. Dependencies must be added before Run is called.
+// Dependencies listed in Config.Optional are registered as optional.
+func (o *Orchestrator) Add(deps ...Dependency) {
+	optional := strings.Split(o.cfg.Optional, ",")
+	for i := range optional {
+		optional[i] = strings.TrimSpace(optional[i])
+	}
+
+	for _, dep := range deps {
+		if slices.Contains(optional, dep.Name) {
+			dep.Required = false
+		}
+
+		o.deps = append(o.deps, dep)
+	}
+}
+
+// Run probes all dependencies concurrently, retrying with exponential backoff.
+// Returns ErrDependencyUnavailable if a required dependency does not become available.
+// Unavailable optional dependencies are reported by Degraded and keep being probed
+// in the background until they become available or the context is cancelled.
+func (o *Orchestrator) Run(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(o.deps))
+	)
+
+	for i, dep := range o.deps {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			errs[i] = o.probe(ctx, dep, o.cfg.MaxAttempts)
+		}()
+	}
+
+	wg.Wait()
+
+	var failed []error
+
+	for i, dep := range o.deps {
+		if errs[i] == nil {
+			continue
+		}
+
+		if dep.Required {
+			failed = append(failed, fmt.Errorf("%w: %s: %w", ErrDependencyUnavailable, dep.Name, errs[i]))
+
+			continue
+		}
+
+		o.setDegraded(dep.Name, errs[i])
+		o.log.WarnContext(ctx, "starting degraded", "dependency", dep.Name, "error", errs[i])
+
+		go o.probeUntilAvailable(ctx, dep)
+	}
+
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+
+	return nil
+}
+
+// Degraded returns the unavailable optional dependencies and their last probe errors.
+func (o *Orchestrator) Degraded() map[string]error {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
+	degraded := make(map[string]error, len(o.degraded))
+	for name, err := range o.degraded {
+		degraded[name] = err
+	}
+
+	return degraded
+}
+
+// Health returns the status of all dependencies by name: "ok", or the last probe error of
+// unavailable optional dependencies.
+func (o *Orchestrator) Health() map[string]string {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
+	health := make(map[string]string, len(o.deps))
+	for _, dep := range o.deps {
+		if err, ok := o.degraded[dep.Name]; ok {
+			health[dep.Name] = err.Error()
+		} else {
+			health[dep.Name] = "ok"
+		}
+	}
+
+	return health
+}
+
+// DegradedNames returns the sorted names of the unavailable optional dependencies.
+func (o *Orchestrator) DegradedNames() []string {
+	o.m.RLock()
+	defer o.m.RUnlock()
+
+	names := make([]string, 0, len(o.degraded))
+	for name := range o.degraded {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// probeUntilAvailable probes an unavailable optional dependency until it becomes available.
+func (o *Orchestrator) probeUntilAvailable(ctx context.Context, dep Dependency) {
+	for {
+		err := o.probe(ctx, dep, o.cfg.MaxAttempts)
+		if err == nil {
+			o.setDegraded(dep.Name, nil)
+			o.log.InfoContext(ctx, "dependency recovered", "dependency", dep.Name)
+
+			return
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		o.setDegraded(dep.Name, err)
+	}
+}
+
+// probe checks a dependency until it is available, the context is cancelled,
+// or maxAttempts is reached. A maxAttempts of 0 retries indefinitely.
+func (o *Orchestrator) probe(ctx context.Context, dep Dependency, maxAttempts int) (err error) {
+	log := o.log.With(logging.Group("dependency", "name", dep.Name, "required", dep.Required))
+	backoff := max(time.Duration(o.cfg.InitialBackoff)*time.Millisecond, time.Millisecond)
+	maxBackoff := max(time.Duration(o.cfg.MaxBackoff)*time.Millisecond, backoff)
+
+	for attempt := 1; ; attempt++ {
+		if err = dep.Probe(ctx); err == nil {
+			log.InfoContext(ctx, "dependency available", "attempt", attempt)
+
+			return nil
+		}
+
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			return fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+
+		log.WarnContext(ctx, "dependency unavailable, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("probe: %w", errors.Join(ctx.Err(), err))
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (o *Orchestrator) setDegraded(name string, err error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if err == nil {
+		delete(o.degraded, name)
+	} else {
+		o.degraded[name] = err
+	}
+}
@@ -0,0 +1,115 @@
+package startup_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/startup"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// flakyProbe fails until it has been called the given number of times.
+func flakyProbe(failures int32) (startup.ProbeFunc, *atomic.Int32) {
+	calls := new(atomic.Int32)
+
+	return func(context.Context) error {
+		if calls.Add(1) <= failures {
+			return errUnavailable
+		}
+
+		return nil
+	}, calls
+}
+
+func TestOrchestrator_Run(t *testing.T) {
+	t.Parallel()
+
+	cfg := startup.Config{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 2, Optional: ""}
+
+	tests := []struct {
+		name         string
+		optional     string
+		failures     int32
+		required     bool
+		wantErr      error
+		wantDegraded []string
+	}{
+		{name: "available", failures: 0, required: true, wantDegraded: []string{}},
+		{name: "recovers within attempts", failures: 2, required: true, wantDegraded: []string{}},
+		{name: "required unavailable", failures: 100, required: true, wantErr: startup.ErrDependencyUnavailable},
+		{name: "optional unavailable", failures: 100, required: false, wantDegraded: []string{"dep"}},
+		{name: "made optional by config", optional: "other, dep", failures: 100, required: true, wantDegraded: []string{"dep"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			cfg := cfg
+			cfg.Optional = tt.optional
+
+			probe, _ := flakyProbe(tt.failures)
+
+			orchestrator := startup.NewOrchestrator(cfg)
+			orchestrator.Add(startup.Dependency{Name: "dep", Probe: probe, Required: tt.required})
+
+			err := orchestrator.Run(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got := orchestrator.DegradedNames(); !slices.Equal(got, tt.wantDegraded) {
+				t.Errorf("DegradedNames() = %v, want %v", got, tt.wantDegraded)
+			}
+		})
+	}
+}
+
+func TestOrchestrator_RunRecoversOptional(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	probe, calls := flakyProbe(20)
+
+	orchestrator := startup.NewOrchestrator(startup.Config{MaxAttempts: 2, InitialBackoff: 1, MaxBackoff: 1, Optional: ""})
+	orchestrator.Add(startup.Dependency{Name: "dep", Probe: probe, Required: false})
+
+	if err := orchestrator.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if degraded := orchestrator.Degraded(); !errors.Is(degraded["dep"], errUnavailable) {
+		t.Fatalf("Degraded() = %v, want dep to be unavailable", degraded)
+	}
+
+	if health := orchestrator.Health(); health["dep"] == "ok" {
+		t.Errorf("Health() = %v, want dep to be unavailable", health)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(orchestrator.DegradedNames()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("dependency did not recover after %d probes", calls.Load())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if health := orchestrator.Health(); health["dep"] != "ok" {
+		t.Errorf("Health() after recovery = %v, want dep ok", health)
+	}
+}
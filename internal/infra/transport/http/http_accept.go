@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NegotiateContentType returns the offered media type the request's Accept header prefers,
+// or "" if it accepts none of them. The quality of an offer is that of the most specific
+// media range matching it (RFC 9110, section 12.5.1); ties are won by the earlier offer.
+// Requests without an Accept header accept the first offer.
+func NegotiateContentType(r *http.Request, offers ...string) string {
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		if len(offers) == 0 {
+			return ""
+		}
+
+		return offers[0]
+	}
+
+	ranges := parseAccept(strings.Join(accept, ","))
+
+	var (
+		best        string
+		bestQuality float64
+	)
+
+	for _, offer := range offers {
+		if quality := acceptQuality(ranges, strings.ToLower(offer)); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	return best
+}
+
+// mediaRange is a media range of an Accept header with its quality.
+type mediaRange struct {
+	typ, subtype string
+	quality      float64
+}
+
+// parseAccept parses the media ranges of an Accept header. Malformed ranges are skipped.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+
+		quality := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+					quality = q
+				}
+			}
+		}
+
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, quality: quality})
+	}
+
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific media range matching the media type,
+// or 0 if none matches.
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	quality, specificity := 0.0, 0
+
+	for _, r := range ranges {
+		var matched int
+
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			matched = 3 //nolint:mnd // exact match
+		case r.typ == typ && r.subtype == "*":
+			matched = 2 //nolint:mnd // subtype wildcard
+		case r.typ == "*":
+			matched = 1
+		default:
+			continue
+		}
+
+		if matched > specificity {
+			quality, specificity = r.quality, matched
+		}
+	}
+
+	return quality
+}
@@ -0,0 +1,46 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	t.Parallel()
+
+	offers := []string{"image/png", "image/jpeg", "image/tiff"}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "no accept header", want: "image/png"},
+		{name: "browser", accept: "image/avif,image/webp,image/apng,image/*,*/*;q=0.8", want: "image/png"},
+		{name: "exact", accept: "image/jpeg", want: "image/jpeg"},
+		{name: "quality", accept: "image/png;q=0.5, image/tiff;q=0.9", want: "image/tiff"},
+		{name: "most specific range", accept: "image/*, image/png;q=0", want: "image/jpeg"},
+		{name: "case insensitive", accept: "Image/JPEG", want: "image/jpeg"},
+		{name: "wildcard", accept: "*/*", want: "image/png"},
+		{name: "none acceptable", accept: "image/webp, text/*", want: ""},
+		{name: "malformed ranges skipped", accept: "jpeg, */png, image/tiff", want: "image/tiff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			if got := NegotiateContentType(req, offers...); got != tt.want {
+				t.Errorf("NegotiateContentType(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"net/http"
+)
+
+// AuthPolicy defines the authentication requirements of a route.
+type AuthPolicy int
+
+const (
+	// AuthPolicyAuthenticated requires a valid auth token. This is the default policy.
+	AuthPolicyAuthenticated AuthPolicy = iota
+	// AuthPolicyPublic allows unauthenticated access. If a token is provided anyway,
+	// it is validated on a best-effort basis to identify the user.
+	AuthPolicyPublic
+	// AuthPolicyRole requires a valid auth token of a user having one of the route's roles.
+	// The user's roles are read from the request context (see context.WithRoles).
+	AuthPolicyRole
+)
+
+// String returns the name of the policy.
+func (p AuthPolicy) String() string {
+	switch p {
+	case AuthPolicyAuthenticated:
+		return "authenticated"
+	case AuthPolicyPublic:
+		return "public"
+	case AuthPolicyRole:
+		return "role"
+	default:
+		return "unknown"
+	}
+}
+
+// RoutePolicy assigns an AuthPolicy to all requests matching a route pattern.
+// Patterns use the syntax of http.ServeMux, e.g. "GET /health" or "/media/{id}/public".
+// Tokens of non-public routes must have all of Scopes.
+type RoutePolicy struct {
+	Pattern string
+	Policy  AuthPolicy
+	Roles   []string // Required roles for AuthPolicyRole
+	Scopes  []string // Required scopes of the token
+}
+
+// RoutePolicies is a table of route policies evaluated by the AuthorizingMiddleware.
+// Routes not matching any pattern use AuthPolicyAuthenticated.
+type RoutePolicies []RoutePolicy
+
+// PublicRoute creates a RoutePolicy allowing unauthenticated access to the given pattern.
+func PublicRoute(pattern string) RoutePolicy {
+	return RoutePolicy{Pattern: pattern, Policy: AuthPolicyPublic, Roles: nil, Scopes: nil}
+}
+
+// AuthenticatedRoute creates a RoutePolicy requiring a valid auth token for the given pattern.
+func AuthenticatedRoute(pattern string) RoutePolicy {
+	return RoutePolicy{Pattern: pattern, Policy: AuthPolicyAuthenticated, Roles: nil, Scopes: nil}
+}
+
+// RoleRoute creates a RoutePolicy requiring one of the given roles for the given pattern.
+func RoleRoute(pattern string, roles ...string) RoutePolicy {
+	return RoutePolicy{Pattern: pattern, Policy: AuthPolicyRole, Roles: roles, Scopes: nil}
+}
+
+// ScopedRoute creates a RoutePolicy requiring a valid auth token having all of the given scopes
+// for the given pattern.
+func ScopedRoute(pattern string, scopes ...string) RoutePolicy {
+	return RoutePolicy{Pattern: pattern, Policy: AuthPolicyAuthenticated, Roles: nil, Scopes: scopes}
+}
+
+// routePolicyMatcher resolves the policy of a request using the pattern matching
+// rules of http.ServeMux, so the most specific pattern wins.
+type routePolicyMatcher struct {
+	mux      *http.ServeMux
+	policies map[string]RoutePolicy
+}
+
+// newRoutePolicyMatcher builds a matcher for the given policies.
+// Panics if a pattern is invalid or conflicts with another pattern, just like http.ServeMux.
+func newRoutePolicyMatcher(policies RoutePolicies) *routePolicyMatcher {
+	matcher := &routePolicyMatcher{
+		mux:      http.NewServeMux(),
+		policies: make(map[string]RoutePolicy, len(policies)),
+	}
+
+	for _, policy := range policies {
+		matcher.mux.Handle(policy.Pattern, http.NotFoundHandler())
+		matcher.policies[policy.Pattern] = policy
+	}
+
+	return matcher
+}
+
+// match returns the policy of the given request.
+func (m *routePolicyMatcher) match(r *http.Request) RoutePolicy {
+	if _, pattern := m.mux.Handler(r); pattern != "" {
+		if policy, ok := m.policies[pattern]; ok {
+			return policy
+		}
+	}
+
+	return AuthenticatedRoute("")
+}
@@ -1,7 +1,9 @@
 package http
 
 import (
+	"context"
 	"net/http"
+	"slices"
 
 	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
@@ -10,35 +12,156 @@ import (
 
 // AuthorizingMiddleware creates middleware that validates authentication tokens.
 // It requires an AuthClient for token validation.
-// Requests without a valid token in the Authorization header are rejected.
+// Requests without a valid token are rejected. Tokens are accepted in the Authorization
+// header, the X-Api-Key header or the access_token URL parameter.
 // On successful validation, the username is added to the request context.
 func AuthorizingMiddleware(
 	next http.Handler,
 	authClient authclient.AuthClient,
 	log logging.Logger,
 ) http.Handler {
+	return PolicyAuthorizingMiddleware(next, authClient, AuthorizationConfig{}, log) //nolint:exhaustruct
+}
+
+// AuthorizationConfig configures the authorization of requests with a valid token.
+type AuthorizationConfig struct {
+	// Policies are the route policies. Routes not covered by the policies require a valid token.
+	Policies RoutePolicies
+	// Roles maps usernames to roles granted in addition to the roles of their token
+	Roles map[string][]string
+	// Impersonation allows users having RoleAdmin to act as another user (see ImpersonateUserHeader)
+	Impersonation bool
+	// Audit receives a record of every impersonated request, the "audit" logger if nil
+	Audit logging.Logger
+	// Audience identifies the service, rejecting tokens intended for other services if set.
+	// Tokens without audience are intended for any service.
+	Audience string
+	// Scopes are required of the tokens of all non-public routes, in addition to the scopes of their policy
+	Scopes []string
+}
+
+// PolicyAuthorizingMiddleware creates middleware that validates authentication tokens
+// according to the route policies of cfg:
+//   - AuthPolicyPublic routes are served without a token; a valid token having the required scopes
+//     identifies the user, any other token is ignored and the request is served anonymously
+//   - AuthPolicyAuthenticated routes require a valid token
+//   - AuthPolicyRole routes require a valid token of a user having one of the route's roles
+//
+// Routes not covered by the policies require a valid token.
+// Tokens not intended for the configured audience are invalid, and tokens of non-public routes
+// lacking a scope required by the configuration or the route policy are rejected with 403 Forbidden.
+// On successful validation, the username and roles are added to the request context.
+// Roles are read from the token if the AuthClient implements authclient.RoleValidator.
+// If impersonation is enabled, admins may act as another user on non-public routes (see impersonate).
+func PolicyAuthorizingMiddleware(
+	next http.Handler,
+	authClient authclient.AuthClient,
+	cfg AuthorizationConfig,
+	log logging.Logger,
+) http.Handler {
+	matcher := newRoutePolicyMatcher(cfg.Policies)
+
+	audit := cfg.Audit
+	if audit == nil {
+		audit = logging.GetLogger("audit")
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
+		policy := matcher.match(r)
+		creds, _ := authclient.CredentialsFromRequest(r)
+		token := creds.Token
+
+		if policy.Policy == AuthPolicyPublic {
+			if token != "" {
+				claims, ok, err := authclient.ValidateClaims(r.Context(), authClient, token)
+				if err == nil && ok && (cfg.Audience == "" || claims.HasAudience(cfg.Audience)) &&
+					claims.HasScopes(slices.Concat(cfg.Scopes, policy.Scopes)...) {
+					r = r.WithContext(withUser(r.Context(), claims.Username, claims.Roles, cfg.Roles))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
 		if token == "" {
 			log.ErrorContext(r.Context(), "no token provided")
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			WriteError(w, r, http.StatusBadRequest)
 
 			return
 		}
 
-		username, ok, err := authClient.Validate(r.Context(), token)
+		claims, ok, err := authclient.ValidateClaims(r.Context(), authClient, token)
 		if err != nil {
 			log.ErrorContext(r.Context(), "validate token failed", "error", err)
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			WriteError(w, r, http.StatusUnauthorized)
 
 			return
 		} else if !ok {
 			log.ErrorContext(r.Context(), "invalid token")
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			WriteError(w, r, http.StatusUnauthorized)
+
+			return
+		} else if cfg.Audience != "" && !claims.HasAudience(cfg.Audience) {
+			log.ErrorContext(r.Context(), "token not intended for service", "audience", claims.Audience)
+			WriteError(w, r, http.StatusUnauthorized)
+
+			return
+		} else if scopes := slices.Concat(cfg.Scopes, policy.Scopes); !claims.HasScopes(scopes...) {
+			log.ErrorContext(r.Context(), "missing required scope", "scopes", scopes, "granted", claims.Scopes)
+			WriteError(w, r, http.StatusForbidden)
 
 			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(context_.WithUsername(r.Context(), username)))
+		ctx := withUser(r.Context(), claims.Username, claims.Roles, cfg.Roles)
+		handler := next
+
+		if policy.Policy == AuthPolicyRole {
+			handler = RequireRole(next, log, policy.Roles...)
+		}
+
+		if target := r.Header.Get(ImpersonateUserHeader); target != "" {
+			ctx, ok = impersonate(ctx, target, cfg, audit, r)
+			if !ok {
+				log.ErrorContext(ctx, "impersonation not allowed", "impersonate", target)
+				WriteError(w, r, http.StatusForbidden)
+
+				return
+			}
+
+			handler = auditImpersonated(handler, audit)
+		}
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireRole wraps a handler, rejecting requests of users having none of the given roles
+// with 403 Forbidden. Roles are read from the request context (see context.WithRoles),
+// so the handler must be served behind the PolicyAuthorizingMiddleware.
+func RequireRole(next http.Handler, log logging.Logger, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !context_.HasRole(r.Context(), roles...) {
+			log.ErrorContext(r.Context(), "missing required role", "roles", roles)
+			WriteError(w, r, http.StatusForbidden)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withUser returns a context with the given username, and the roles of its token along with
+// those granted to the user by the configuration.
+func withUser(ctx context.Context, username string, tokenRoles []string, roles map[string][]string) context.Context {
+	ctx = context_.WithUsername(ctx, username)
+
+	if userRoles := slices.Concat(tokenRoles, roles[username]); len(userRoles) > 0 {
+		ctx = context_.WithRoles(ctx, userRoles)
+	}
+
+	return ctx
+}
@@ -0,0 +1,269 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+type mockAuthClient struct {
+	tokens map[string]string
+	roles  map[string][]string
+}
+
+func (m *mockAuthClient) Validate(_ context.Context, token string) (string, bool, error) {
+	username, ok := m.tokens[token]
+
+	return username, ok, nil
+}
+
+func (m *mockAuthClient) ValidateRoles(ctx context.Context, token string) (string, []string, bool, error) {
+	username, ok, err := m.Validate(ctx, token)
+
+	return username, m.roles[token], ok, err
+}
+
+// mockClaimsClient validates the tokens it has claims of.
+type mockClaimsClient struct {
+	claims map[string]domain.AuthToken
+}
+
+func (m *mockClaimsClient) Validate(ctx context.Context, token string) (string, bool, error) {
+	claims, ok, err := m.ValidateClaims(ctx, token)
+
+	return claims.Username, ok, err
+}
+
+func (m *mockClaimsClient) ValidateClaims(_ context.Context, token string) (domain.AuthToken, bool, error) {
+	claims, ok := m.claims[token]
+
+	return claims, ok, nil
+}
+
+func TestPolicyAuthorizingMiddleware(t *testing.T) {
+	t.Parallel()
+
+	authClient := &mockAuthClient{
+		tokens: map[string]string{"valid": "testuser", "admin": "root"},
+		roles:  map[string][]string{"admin": {"admin"}},
+	}
+	policies := RoutePolicies{
+		PublicRoute("GET /health"),
+		PublicRoute("GET /public/{id}"),
+		RoleRoute("/admin/", "admin"),
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := context_.UsernameFromContext(r.Context())
+		_, _ = w.Write([]byte(username))
+	})
+
+	handler := PolicyAuthorizingMiddleware(next, authClient, AuthorizationConfig{
+		Policies:      policies,
+		Roles:         nil,
+		Impersonation: false,
+		Audit:         nil,
+	}, logging.NewNopLogger())
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		wantCode int
+		wantUser string
+	}{
+		{name: "public route without token", method: http.MethodGet, path: "/health", wantCode: http.StatusOK},
+		{name: "public route with token", method: http.MethodGet, path: "/public/abc", token: "valid",
+			wantCode: http.StatusOK, wantUser: "testuser"},
+		{name: "public route with invalid token", method: http.MethodGet, path: "/public/abc", token: "invalid",
+			wantCode: http.StatusOK},
+		{name: "public pattern is method specific", method: http.MethodDelete, path: "/health",
+			wantCode: http.StatusBadRequest},
+		{name: "default route without token", method: http.MethodGet, path: "/media/abc",
+			wantCode: http.StatusBadRequest},
+		{name: "default route with invalid token", method: http.MethodGet, path: "/media/abc", token: "invalid",
+			wantCode: http.StatusUnauthorized},
+		{name: "default route with token", method: http.MethodGet, path: "/media/abc", token: "valid",
+			wantCode: http.StatusOK, wantUser: "testuser"},
+		{name: "role route without role", method: http.MethodGet, path: "/admin/status", token: "valid",
+			wantCode: http.StatusForbidden},
+		{name: "role route with role of token", method: http.MethodGet, path: "/admin/status", token: "admin",
+			wantCode: http.StatusOK, wantUser: "root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.wantUser {
+				t.Errorf("username = %q, want %q", rec.Body.String(), tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestPolicyAuthorizingMiddleware_Claims(t *testing.T) {
+	t.Parallel()
+
+	authClient := &mockClaimsClient{claims: map[string]domain.AuthToken{
+		"any":      {Username: "anyuser"},
+		"imagesvc": {Username: "imageuser", Audience: []string{"authsvc", "imagesvc"}, Scopes: []string{"media"}},
+		"other":    {Username: "otheruser", Audience: []string{"othersvc"}, Scopes: []string{"media"}},
+		"upload":   {Username: "uploader", Scopes: []string{"media", "media:write"}},
+	}}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := context_.UsernameFromContext(r.Context())
+		_, _ = w.Write([]byte(username))
+	})
+
+	handler := PolicyAuthorizingMiddleware(next, authClient, AuthorizationConfig{
+		Policies: RoutePolicies{
+			PublicRoute("GET /health"),
+			ScopedRoute("POST /media", "media:write"),
+		},
+		Roles:         nil,
+		Impersonation: false,
+		Audit:         nil,
+		Audience:      "imagesvc",
+		Scopes:        []string{"media"},
+	}, logging.NewNopLogger())
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		wantCode int
+		wantUser string
+	}{
+		{name: "matching audience", method: http.MethodGet, path: "/media/abc", token: "imagesvc",
+			wantCode: http.StatusOK, wantUser: "imageuser"},
+		{name: "other audience", method: http.MethodGet, path: "/media/abc", token: "other",
+			wantCode: http.StatusUnauthorized},
+		{name: "other audience on public route", method: http.MethodGet, path: "/health", token: "other",
+			wantCode: http.StatusOK, wantUser: ""},
+		{name: "missing configured scope on public route", method: http.MethodGet, path: "/health", token: "any",
+			wantCode: http.StatusOK, wantUser: ""},
+		{name: "missing configured scope", method: http.MethodGet, path: "/media/abc", token: "any",
+			wantCode: http.StatusForbidden},
+		{name: "missing route scope", method: http.MethodPost, path: "/media", token: "imagesvc",
+			wantCode: http.StatusForbidden},
+		{name: "route scope", method: http.MethodPost, path: "/media", token: "upload",
+			wantCode: http.StatusOK, wantUser: "uploader"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", tt.token)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.wantUser {
+				t.Errorf("username = %q, want %q", rec.Body.String(), tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestPolicyAuthorizingMiddleware_Impersonation(t *testing.T) {
+	t.Parallel()
+
+	authClient := &mockAuthClient{tokens: map[string]string{"admin": "root", "user": "alice"}, roles: nil}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := context_.UsernameFromContext(r.Context())
+		impersonator, _ := context_.ImpersonatorFromContext(r.Context())
+		_, _ = w.Write([]byte(username + "/" + impersonator))
+	})
+
+	tests := []struct {
+		name          string
+		impersonation bool
+		path          string
+		token         string
+		impersonate   string
+		wantCode      int
+		wantBody      string
+		wantAudit     string
+	}{
+		{name: "admin without header", impersonation: true, path: "/media/abc", token: "admin",
+			wantCode: http.StatusOK, wantBody: "root/"},
+		{name: "admin impersonates user", impersonation: true, path: "/media/abc", token: "admin", impersonate: "bob",
+			wantCode: http.StatusOK, wantBody: "bob/root", wantAudit: "impersonated request"},
+		{name: "impersonated user lacks admin role", impersonation: true, path: "/admin/status", token: "admin",
+			impersonate: "bob", wantCode: http.StatusForbidden, wantAudit: "impersonated request"},
+		{name: "non-admin is denied", impersonation: true, path: "/media/abc", token: "user", impersonate: "bob",
+			wantCode: http.StatusForbidden, wantAudit: "impersonation denied"},
+		{name: "impersonation disabled", impersonation: false, path: "/media/abc", token: "admin", impersonate: "bob",
+			wantCode: http.StatusForbidden, wantAudit: "impersonation denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var audit bytes.Buffer
+
+			handler := PolicyAuthorizingMiddleware(next, authClient, AuthorizationConfig{
+				Policies:      RoutePolicies{RoleRoute("/admin/", RoleAdmin)},
+				Roles:         map[string][]string{"root": {RoleAdmin}},
+				Impersonation: tt.impersonation,
+				Audit:         slog.New(slog.NewJSONHandler(&audit, nil)),
+			}, logging.NewNopLogger())
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", tt.token)
+
+			if tt.impersonate != "" {
+				req.Header.Set(ImpersonateUserHeader, tt.impersonate)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+
+			if got := audit.String(); (tt.wantAudit == "") != (got == "") || !strings.Contains(got, tt.wantAudit) {
+				t.Errorf("audit log = %q, want %q", got, tt.wantAudit)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DispositionAttachment instructs clients to download the response body.
+	DispositionAttachment = "attachment"
+	// DispositionInline instructs clients to display the response body.
+	DispositionInline = "inline"
+
+	// defaultDispositionFilename is used when a filename sanitizes to nothing.
+	defaultDispositionFilename = "download"
+)
+
+// ContentDisposition builds a Content-Disposition header value for the given
+// disposition type and filename according to RFC 6266.
+// The filename is sanitized by SanitizeFilename. If it contains non-ASCII
+// characters, an ASCII fallback is emitted as `filename` and the full name
+// is emitted as RFC 5987 encoded `filename*`.
+func ContentDisposition(dispositionType, filename string) string {
+	if dispositionType != DispositionInline {
+		dispositionType = DispositionAttachment
+	}
+
+	filename = SanitizeFilename(filename)
+
+	fallback := asciiFilename(filename)
+	value := mime.FormatMediaType(dispositionType, map[string]string{"filename": fallback})
+
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+
+	return value
+}
+
+// SanitizeFilename strips directory components, control characters and
+// characters that have a special meaning in header parameters from the
+// given filename. Returns a generic name if nothing usable remains.
+func SanitizeFilename(filename string) string {
+	filename = filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+
+	filename = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r), r == unicode.ReplacementChar:
+			return -1
+		case r == '"', r == '\\', r == '/', r == ';':
+			return '_'
+		default:
+			return r
+		}
+	}, filename)
+
+	filename = strings.TrimSpace(filename)
+
+	if filename == "" || filename == "." || filename == ".." {
+		return defaultDispositionFilename
+	}
+
+	return filename
+}
+
+// asciiFilename replaces every non-printable-ASCII rune with an underscore.
+func asciiFilename(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '_'
+		}
+
+		return r
+	}, filename)
+}
+
+// encodeRFC5987 percent-encodes a UTF-8 string as an RFC 5987 ext-value.
+func encodeRFC5987(value string) string {
+	// url.PathEscape leaves a few sub-delims unescaped which are not part of
+	// the RFC 5987 attr-char set, so escape them explicitly.
+	return strings.NewReplacer(
+		",", "%2C",
+		":", "%3A",
+		"=", "%3D",
+		"@", "%40",
+	).Replace(url.PathEscape(value))
+}
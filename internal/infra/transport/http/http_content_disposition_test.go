@@ -0,0 +1,93 @@
+package http_test
+
+import (
+	"testing"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{name: "keeps plain filename", filename: "image.jpg", want: "image.jpg"},
+		{name: "strips directories", filename: "../../etc/passwd", want: "passwd"},
+		{name: "strips windows directories", filename: `C:\photos\image.jpg`, want: "image.jpg"},
+		{name: "strips control characters", filename: "image\r\nX-Injected: 1.jpg", want: "imageX-Injected: 1.jpg"},
+		{name: "replaces quotes", filename: `my"image".jpg`, want: "my_image_.jpg"},
+		{name: "falls back on empty name", filename: "\x00\x01", want: "download"},
+		{name: "falls back on dot name", filename: "..", want: "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := SanitizeFilename(tt.filename); got != tt.want {
+				t.Errorf("SanitizeFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		disposition string
+		filename    string
+		want        string
+	}{
+		{
+			name:        "ascii filename",
+			disposition: DispositionAttachment,
+			filename:    "image.jpg",
+			want:        `attachment; filename=image.jpg`,
+		},
+		{
+			name:        "inline disposition",
+			disposition: DispositionInline,
+			filename:    "image.jpg",
+			want:        `inline; filename=image.jpg`,
+		},
+		{
+			name:        "unknown disposition falls back to attachment",
+			disposition: "bogus",
+			filename:    "image.jpg",
+			want:        `attachment; filename=image.jpg`,
+		},
+		{
+			name:        "quotes filename with spaces",
+			disposition: DispositionAttachment,
+			filename:    "my image.jpg",
+			want:        `attachment; filename="my image.jpg"`,
+		},
+		{
+			name:        "encodes non-ascii filename",
+			disposition: DispositionAttachment,
+			filename:    "bild-ä.jpg",
+			want:        `attachment; filename=bild-_.jpg; filename*=UTF-8''bild-%C3%A4.jpg`,
+		},
+		{
+			name:        "neutralizes header injection",
+			disposition: DispositionAttachment,
+			filename:    "a.jpg\r\nSet-Cookie: x=1",
+			want:        `attachment; filename="a.jpgSet-Cookie: x=1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ContentDisposition(tt.disposition, tt.filename); got != tt.want {
+				t.Errorf("ContentDisposition() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
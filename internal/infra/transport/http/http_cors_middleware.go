@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSMiddleware creates middleware that adds Cross-Origin Resource Sharing headers
+// for requests from the origins allowed by cfg.CORSAllowedOrigins.
+// Preflight requests are answered directly with 204 No Content.
+func CORSMiddleware(next http.Handler, cfg HTTPTransportConfig) http.Handler {
+	origins := ParseMiddlewares(cfg.CORSAllowedOrigins)
+	allowAll := slices.Contains(origins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		if !allowAll && !slices.Contains(origins, strings.ToLower(origin)) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if allowAll {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", TraceIDHeader+", ETag")
+
+		// Answer preflight requests
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", cfg.CORSAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", cfg.CORSAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", strconv.FormatInt(cfg.CORSMaxAge, 10))
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// etagLength is the number of hash bytes in an ETag.
+const etagLength = 10
+
+// RevisionETag returns a strong ETag identifying a response built from resources at the given
+// revisions, e.g. the revisions of all listed media. Parts of the request affecting the response,
+// such as query parameters, must be included as well.
+func RevisionETag(revisions ...string) string {
+	hasher := sha256.New()
+
+	for _, revision := range revisions {
+		hasher.Write([]byte(revision))
+		hasher.Write([]byte{0})
+	}
+
+	return `"` + encoding.EncodeCrockfordB32LC(hasher.Sum(nil)[:etagLength]) + `"`
+}
+
+// ContentETag returns a strong ETag identifying a response body by its content hash.
+func ContentETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// NotModified sets the ETag header of the response and checks it against the request's
+// If-None-Match header. If any of the listed entity tags matches, using the weak comparison
+// of RFC 9110, it replies with 304 Not Modified and returns true.
+// It must be called before the response body is written.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if !matchesETag(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
+
+// NotModifiedSince sets the Last-Modified header of the response and checks it against the
+// request's If-Modified-Since header. If the resource was not modified since that time, it
+// replies with 304 Not Modified and returns true. As required by RFC 9110, If-Modified-Since
+// is ignored if the request has an If-None-Match header, so NotModified must be checked first.
+// A zero modified time sets no header and never matches.
+// It must be called before the response body is written.
+func NotModifiedSince(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	if modified.IsZero() {
+		return false
+	}
+
+	// HTTP dates have a resolution of seconds
+	modified = modified.Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
+
+// matchesETag reports whether an If-None-Match header value matches the given ETag.
+func matchesETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
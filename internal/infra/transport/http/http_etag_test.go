@@ -0,0 +1,129 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestNotModified(t *testing.T) {
+	t.Parallel()
+
+	etag := RevisionETag("rev1", "widths=320")
+
+	tests := []struct {
+		name         string
+		method       string
+		ifNoneMatch  string
+		wantModified bool
+	}{
+		{name: "no precondition", method: http.MethodGet, wantModified: true},
+		{name: "matching etag", method: http.MethodGet, ifNoneMatch: etag},
+		{name: "weak matching etag", method: http.MethodGet, ifNoneMatch: "W/" + etag},
+		{name: "matching etag in list", method: http.MethodGet, ifNoneMatch: `"other", ` + etag},
+		{name: "wildcard", method: http.MethodHead, ifNoneMatch: "*"},
+		{name: "stale etag", method: http.MethodGet, ifNoneMatch: RevisionETag("rev0", "widths=320"), wantModified: true},
+		{name: "unsafe method", method: http.MethodPost, ifNoneMatch: etag, wantModified: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			rec := httptest.NewRecorder()
+			notModified := NotModified(rec, req, etag)
+
+			if notModified == tt.wantModified {
+				t.Fatalf("NotModified() = %t, want %t", notModified, !tt.wantModified)
+			}
+
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+
+			if notModified && rec.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	t.Parallel()
+
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500_000_000, time.UTC)
+	lastModified := modified.Format(http.TimeFormat)
+
+	tests := []struct {
+		name            string
+		method          string
+		ifModifiedSince string
+		ifNoneMatch     string
+		modified        time.Time
+		wantModified    bool
+	}{
+		{name: "no precondition", method: http.MethodGet, modified: modified, wantModified: true},
+		{name: "same second", method: http.MethodGet, ifModifiedSince: lastModified, modified: modified},
+		{name: "later", method: http.MethodHead, ifModifiedSince: modified.Add(time.Hour).Format(http.TimeFormat), modified: modified},
+		{name: "earlier", method: http.MethodGet, ifModifiedSince: modified.Add(-time.Second).Format(http.TimeFormat), modified: modified, wantModified: true},
+		{name: "malformed", method: http.MethodGet, ifModifiedSince: "yesterday", modified: modified, wantModified: true},
+		{name: "if-none-match precedes", method: http.MethodGet, ifModifiedSince: lastModified, ifNoneMatch: `"other"`, modified: modified, wantModified: true},
+		{name: "unsafe method", method: http.MethodPost, ifModifiedSince: lastModified, modified: modified, wantModified: true},
+		{name: "unknown time", method: http.MethodGet, ifModifiedSince: lastModified, wantModified: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			rec := httptest.NewRecorder()
+			notModified := NotModifiedSince(rec, req, tt.modified)
+
+			if notModified == tt.wantModified {
+				t.Fatalf("NotModifiedSince() = %t, want %t", notModified, !tt.wantModified)
+			}
+
+			want := lastModified
+			if tt.modified.IsZero() {
+				want = ""
+			}
+
+			if got := rec.Header().Get("Last-Modified"); got != want {
+				t.Errorf("Last-Modified = %q, want %q", got, want)
+			}
+
+			if notModified && rec.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
+
+func TestRevisionETag(t *testing.T) {
+	t.Parallel()
+
+	if RevisionETag("a", "b") == RevisionETag("ab") {
+		t.Error("RevisionETag() does not separate revisions")
+	}
+
+	if RevisionETag("a", "b") != RevisionETag("a", "b") {
+		t.Error("RevisionETag() is not deterministic")
+	}
+}
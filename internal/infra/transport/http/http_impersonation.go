@@ -0,0 +1,67 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+const (
+	// ImpersonateUserHeader names the user an admin acts as.
+	ImpersonateUserHeader = "X-Impersonate-User"
+
+	// RoleAdmin is the role of users allowed to impersonate other users.
+	RoleAdmin = domain.RoleAdmin
+)
+
+// impersonate returns a context in which the authenticated admin of ctx acts as the target user:
+// the username is the target's, and the admin is recorded as impersonator. As the target's
+// token is not available, it only has the roles granted by the configuration.
+// Returns false if impersonation is disabled or the authenticated user is not an admin.
+// Denied attempts are written to the audit log.
+func impersonate(
+	ctx context.Context,
+	target string,
+	cfg AuthorizationConfig,
+	audit logging.Logger,
+	r *http.Request,
+) (context.Context, bool) {
+	admin, _ := context_.UsernameFromContext(ctx)
+
+	if !cfg.Impersonation || !context_.HasRole(ctx, RoleAdmin) {
+		audit.WarnContext(ctx, "impersonation denied", "admin", admin, "user", target,
+			slog.Group("http", "method", r.Method, "uri", RedactedURL(r.URL)))
+
+		return ctx, false
+	}
+
+	ctx = context_.WithUsername(ctx, target)
+	ctx = context_.WithRoles(ctx, cfg.Roles[target])
+	ctx = context_.WithImpersonator(ctx, admin)
+
+	return ctx, true
+}
+
+// auditImpersonated wraps a handler serving impersonated requests, writing every request
+// along with the acting admin, the impersonated user and the response status to the audit log.
+func auditImpersonated(next http.Handler, audit logging.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := &LoggingMiddlewareResponseWriter{
+			ResponseWriter: w,
+			StatusCode:     http.StatusOK,
+			BytesSent:      0,
+		}
+
+		next.ServeHTTP(mw, r)
+
+		admin, _ := context_.ImpersonatorFromContext(r.Context())
+		user, _ := context_.UsernameFromContext(r.Context())
+
+		audit.InfoContext(r.Context(), "impersonated request", "admin", admin, "user", user,
+			slog.Group("http", "method", r.Method, "uri", RedactedURL(r.URL), "status", mw.StatusCode))
+	})
+}
@@ -4,10 +4,47 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
 )
 
+// redactedValue replaces the values of credential parameters in logged URLs.
+const redactedValue = "REDACTED"
+
+// ShareTokenParam is the URL parameter carrying the share token of an unlisted resource.
+const ShareTokenParam = "share_token"
+
+// credentialParams are the URL parameters carrying credentials, which must not be logged.
+//
+//nolint:gochecknoglobals
+var credentialParams = []string{authclient.QueryTokenParam, ShareTokenParam}
+
+// RedactedURL returns u as string with the values of URL parameters carrying credentials,
+// like the access_token and share_token parameters, replaced, so logged URLs do not leak tokens.
+func RedactedURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+
+	for _, param := range credentialParams {
+		if query.Has(param) {
+			query.Set(param, redactedValue)
+
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return u.String()
+	}
+
+	clone := *u
+	clone.RawQuery = query.Encode()
+
+	return clone.String()
+}
+
 // LoggingMiddlewareResponseWriter wraps http.ResponseWriter to capture response metrics.
 type LoggingMiddlewareResponseWriter struct {
 	http.ResponseWriter
@@ -20,6 +57,11 @@ func (w *LoggingMiddlewareResponseWriter) WriteHeader(code int) {
 	w.StatusCode = code
 }
 
+// Unwrap returns the wrapped http.ResponseWriter for use by http.ResponseController.
+func (w *LoggingMiddlewareResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w *LoggingMiddlewareResponseWriter) Write(b []byte) (int, error) {
 	w.BytesSent += len(b)
 
@@ -32,6 +74,7 @@ func (w *LoggingMiddlewareResponseWriter) Write(b []byte) (int, error) {
 }
 
 // LoggingMiddleware creates middleware that logs HTTP request and response details.
+// Credentials in the URL are redacted (see RedactedURL).
 // It logs requests at DEBUG level and responses at a level determined by the status code:
 // - 5xx: ERROR
 // - 4xx: WARN
@@ -40,7 +83,7 @@ func LoggingMiddleware(next http.Handler, log logging.Logger) http.Handler {
 	//nolint:varnamelen
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.DebugContext(r.Context(), "request", slog.Group("http",
-			"uri", r.RequestURI,
+			"uri", RedactedURL(r.URL),
 			"method", r.Method,
 		))
 
@@ -64,7 +107,7 @@ func LoggingMiddleware(next http.Handler, log logging.Logger) http.Handler {
 		}
 
 		log.Log(r.Context(), level, "response", slog.Group("http",
-			"uri", r.RequestURI,
+			"uri", RedactedURL(r.URL),
 			"method", r.Method,
 			"status", mw.StatusCode,
 			"bytes_sent", mw.BytesSent,
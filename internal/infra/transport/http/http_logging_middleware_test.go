@@ -0,0 +1,40 @@
+package http_test
+
+import (
+	"net/url"
+	"testing"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestRedactedURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "no query", url: "/media/abc", want: "/media/abc"},
+		{name: "no credentials", url: "/media/abc?width=640&sig=x", want: "/media/abc?width=640&sig=x"},
+		{name: "access token", url: "/gallery?access_token=secret", want: "/gallery?access_token=REDACTED"},
+		{name: "access token among others", url: "/media/abc?width=640&access_token=secret", want: "/media/abc?access_token=REDACTED&width=640"},
+		{name: "share token", url: "/media/abc?share_token=secret&width=640", want: "/media/abc?share_token=REDACTED&width=640"},
+		{name: "repeated access token", url: "/media/abc?access_token=a&access_token=b", want: "/media/abc?access_token=REDACTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("parse URL: %v", err)
+			}
+
+			if got := RedactedURL(u); got != tt.want {
+				t.Errorf("RedactedURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
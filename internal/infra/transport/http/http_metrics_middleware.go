@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// unmatchedRoute is the route label of requests not matching any route.
+const unmatchedRoute = "unmatched"
+
+// otherMethod is the method label of requests with a nonstandard method.
+const otherMethod = "OTHER"
+
+// routeKey is the context key of the route pattern recorded by RecordRoute.
+type routeKey struct{}
+
+// NewMetricsMiddleware creates middleware recording request SLIs in the registry, labeled by the
+// route pattern recorded by RecordRoute and the method:
+// - http_requests_total: Requests by status code
+// - http_request_duration_seconds: Request durations, with a bucket at cfg.SLOLatencyThreshold
+// - http_availability_events_total: Requests by whether they did not fail with a server error,
+// counted against the cfg.SLOAvailability objective
+// - http_latency_events_total: Requests not failing with a server error by whether they were
+// served within cfg.SLOLatencyThreshold, counted against the cfg.SLOLatency objective.
+// Returns metrics.ErrInvalidObjective if an objective cannot be parsed.
+func NewMetricsMiddleware(cfg HTTPTransportConfig, reg *metrics.Registry) (Middleware, error) {
+	availabilityObjective, err := metrics.ParseObjective(cfg.SLOAvailability)
+	if err != nil {
+		return nil, fmt.Errorf("availability: %w", err)
+	}
+
+	latencyObjective, err := metrics.ParseObjective(cfg.SLOLatency)
+	if err != nil {
+		return nil, fmt.Errorf("latency: %w", err)
+	}
+
+	threshold := time.Duration(cfg.SLOLatencyThreshold) * time.Millisecond
+
+	var (
+		requests = reg.NewCounterVec("http_requests_total",
+			"HTTP requests by route, method and status code.", "route", "method", "code")
+		durations = reg.NewHistogramVec("http_request_duration_seconds",
+			"Duration of HTTP requests by route and method.",
+			metrics.BucketsWith(metrics.DefaultDurationBuckets, threshold.Seconds()), "route", "method")
+		availability = reg.NewSLO("http_availability",
+			"HTTP requests by route, method and whether they did not fail with a server error.",
+			availabilityObjective, "route", "method")
+		latency = reg.NewSLO("http_latency",
+			"HTTP requests not failing with a server error by route, method and whether they were served in time.",
+			latencyObjective, "route", "method")
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := new(string)
+
+			mw := &LoggingMiddlewareResponseWriter{
+				ResponseWriter: w,
+				StatusCode:     http.StatusOK, // This is default if no response code is written
+				BytesSent:      0,
+			}
+
+			next.ServeHTTP(mw, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)))
+
+			elapsed := time.Since(start)
+			label, method := *route, methodLabel(r.Method)
+
+			if label == "" {
+				label = unmatchedRoute
+			}
+
+			requests.With(label, method, strconv.Itoa(mw.StatusCode)).Inc()
+			durations.With(label, method).Observe(elapsed.Seconds())
+
+			available := mw.StatusCode < http.StatusInternalServerError
+			availability.Record(available, label, method)
+
+			if available {
+				latency.Record(elapsed <= threshold, label, method)
+			}
+		})
+	}, nil
+}
+
+// RecordRoute wraps a ServeMux, recording the pattern matching each request as its route
+// label for the metrics middleware. Labeling by pattern rather than path keeps the number
+// of label values bounded.
+func RecordRoute(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = r.Pattern
+		}
+	})
+}
+
+// methodLabel returns the method label of a request method, bounding the number of label values.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return otherMethod
+	}
+}
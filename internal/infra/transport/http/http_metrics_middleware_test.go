@@ -0,0 +1,73 @@
+package http_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+
+	middleware, err := NewMetricsMiddleware(HTTPTransportConfig{
+		SLOAvailability:     "99.9%",
+		SLOLatency:          "0.99",
+		SLOLatencyThreshold: 250,
+	}, reg)
+	if err != nil {
+		t.Fatalf("NewMetricsMiddleware() error = %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	handler := middleware(RecordRoute(mux))
+
+	for _, target := range []string{"/items/1", "/items/2", "/items/broken", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	var out strings.Builder
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`http_requests_total{route="GET /items/{id}",method="GET",code="200"} 2`,
+		`http_requests_total{route="GET /items/{id}",method="GET",code="500"} 1`,
+		`http_requests_total{route="unmatched",method="GET",code="404"} 1`,
+		`http_request_duration_seconds_bucket{route="GET /items/{id}",method="GET",le="0.25"} 3`,
+		`http_availability_events_total{route="GET /items/{id}",method="GET",result="bad"} 1`,
+		`http_availability_events_total{route="GET /items/{id}",method="GET",result="good"} 2`,
+		`http_latency_events_total{route="GET /items/{id}",method="GET",result="good"} 2`,
+		`slo_objective_ratio{slo="http_availability"} 0.999`,
+		`slo_error_budget_ratio{slo="http_latency"} 0.01`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("metrics missing %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestNewMetricsMiddleware_InvalidObjective(t *testing.T) {
+	t.Parallel()
+
+	for _, objective := range []string{"", "1", "0", "120%", "fast"} {
+		_, err := NewMetricsMiddleware(HTTPTransportConfig{SLOAvailability: objective, SLOLatency: "99%"}, metrics.NewRegistry())
+		if !errors.Is(err, metrics.ErrInvalidObjective) {
+			t.Errorf("NewMetricsMiddleware(%q) error = %v, want %v", objective, err, metrics.ErrInvalidObjective)
+		}
+	}
+}
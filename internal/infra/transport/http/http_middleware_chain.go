@@ -0,0 +1,145 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+var (
+	// ErrUnknownMiddleware is returned when a middleware chain lists an unregistered middleware.
+	ErrUnknownMiddleware = errors.New("unknown middleware")
+	// ErrDuplicateMiddleware is returned when a middleware chain lists a middleware more than once.
+	ErrDuplicateMiddleware = errors.New("duplicate middleware")
+)
+
+// Names of the built-in middlewares.
+const (
+	MiddlewareTracing   = "tracing"
+	MiddlewareMetrics   = "metrics"
+	MiddlewareLogging   = "logging"
+	MiddlewareRecover   = "recover"
+	MiddlewareCORS      = "cors"
+	MiddlewareRateLimit = "ratelimit"
+	MiddlewareSecurity  = "security"
+)
+
+// Middleware wraps an http.Handler with cross-cutting behavior.
+type Middleware func(next http.Handler) http.Handler
+
+// MiddlewareFactory creates a Middleware from the server configuration.
+type MiddlewareFactory func(cfg HTTPTransportConfig, log logging.Logger) (Middleware, error)
+
+//nolint:gochecknoglobals
+var (
+	middlewareRegistryMu sync.RWMutex
+	middlewareRegistry   = map[string]MiddlewareFactory{
+		MiddlewareTracing: func(HTTPTransportConfig, logging.Logger) (Middleware, error) {
+			return TracingMiddleware, nil
+		},
+		MiddlewareMetrics: func(cfg HTTPTransportConfig, _ logging.Logger) (Middleware, error) {
+			return NewMetricsMiddleware(cfg, metrics.Default())
+		},
+		MiddlewareLogging: func(_ HTTPTransportConfig, log logging.Logger) (Middleware, error) {
+			return func(next http.Handler) http.Handler { return LoggingMiddleware(next, log) }, nil
+		},
+		MiddlewareRecover: func(_ HTTPTransportConfig, log logging.Logger) (Middleware, error) {
+			return func(next http.Handler) http.Handler { return RescueingMiddleware(next, log) }, nil
+		},
+		MiddlewareCORS: func(cfg HTTPTransportConfig, _ logging.Logger) (Middleware, error) {
+			return func(next http.Handler) http.Handler { return CORSMiddleware(next, cfg) }, nil
+		},
+		MiddlewareRateLimit: func(cfg HTTPTransportConfig, log logging.Logger) (Middleware, error) {
+			return func(next http.Handler) http.Handler { return RateLimitMiddleware(next, cfg, clock.Real{}, log) }, nil
+		},
+		MiddlewareSecurity: func(cfg HTTPTransportConfig, _ logging.Logger) (Middleware, error) {
+			return func(next http.Handler) http.Handler { return SecurityHeadersMiddleware(next, cfg) }, nil
+		},
+	}
+)
+
+// RegisterMiddleware registers a middleware factory under the given name, so it can be
+// enabled in HTTPTransportConfig.Middlewares. Names are case-insensitive and trimmed like
+// those of the configuration. Replaces any middleware of the same name.
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	middlewareRegistryMu.Lock()
+	defer middlewareRegistryMu.Unlock()
+
+	middlewareRegistry[normalizeMiddlewareName(name)] = factory
+}
+
+// RegisteredMiddlewares returns the sorted names of all registered middlewares.
+func RegisteredMiddlewares() []string {
+	middlewareRegistryMu.RLock()
+	defer middlewareRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(middlewareRegistry))
+	for name := range middlewareRegistry {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// ParseMiddlewares splits a comma-separated list of middleware names.
+// Names are normalized like those of RegisterMiddleware, and empty entries are ignored.
+func ParseMiddlewares(names string) []string {
+	var parsed []string
+
+	for _, name := range strings.Split(names, ",") {
+		if name = normalizeMiddlewareName(name); name != "" {
+			parsed = append(parsed, name)
+		}
+	}
+
+	return parsed
+}
+
+// normalizeMiddlewareName returns the lowercase name without surrounding whitespace.
+func normalizeMiddlewareName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// BuildMiddlewareChain wraps handler with the middlewares listed in cfg.Middlewares.
+// The first middleware listed is the outermost, i.e. it sees the request first.
+// Returns ErrUnknownMiddleware or ErrDuplicateMiddleware if the list is invalid.
+func BuildMiddlewareChain(handler http.Handler, cfg HTTPTransportConfig, log logging.Logger) (http.Handler, error) {
+	names := ParseMiddlewares(cfg.Middlewares)
+	middlewares := make([]Middleware, 0, len(names))
+
+	middlewareRegistryMu.RLock()
+	defer middlewareRegistryMu.RUnlock()
+
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateMiddleware, name)
+		}
+
+		factory, ok := middlewareRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownMiddleware, name)
+		}
+
+		middleware, err := factory(cfg, log)
+		if err != nil {
+			return nil, fmt.Errorf("create middleware %q: %w", name, err)
+		}
+
+		middlewares = append(middlewares, middleware)
+	}
+
+	for _, middleware := range slices.Backward(middlewares) {
+		handler = middleware(handler)
+	}
+
+	return handler, nil
+}
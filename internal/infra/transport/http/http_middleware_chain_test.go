@@ -0,0 +1,264 @@
+package http_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestBuildMiddlewareChain(t *testing.T) {
+	t.Parallel()
+
+	RegisterMiddleware("test-a", orderMiddleware("a"))
+	RegisterMiddleware("test-b", orderMiddleware("b"))
+	RegisterMiddleware(" Test-Upper ", orderMiddleware("upper"))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Add("X-Order", "handler")
+	})
+
+	tests := []struct {
+		name        string
+		middlewares string
+		wantOrder   string
+		wantErr     error
+	}{
+		{name: "empty chain", middlewares: "", wantOrder: "handler"},
+		{name: "outermost first", middlewares: "test-a,test-b", wantOrder: "a,b,handler"},
+		{name: "reversed", middlewares: " test-b , TEST-A ", wantOrder: "b,a,handler"},
+		{name: "registered uppercase", middlewares: "test-upper,Test-Upper", wantErr: ErrDuplicateMiddleware},
+		{name: "registered uppercase selected", middlewares: "TEST-UPPER,test-a", wantOrder: "upper,a,handler"},
+		{name: "builtin middlewares", middlewares: "tracing,metrics,logging,recover,cors,ratelimit,security", wantOrder: "handler"},
+		{name: "unknown middleware", middlewares: "test-a,gzip", wantErr: ErrUnknownMiddleware},
+		{name: "duplicate middleware", middlewares: "test-a,test-a", wantErr: ErrDuplicateMiddleware},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := HTTPTransportConfig{
+				Middlewares:     tt.middlewares,
+				RateLimit:       10,
+				RateLimitBurst:  10,
+				SLOAvailability: "99.9%",
+				SLOLatency:      "0.99",
+			}
+
+			handler, err := BuildMiddlewareChain(next, cfg, logging.NewNopLogger())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BuildMiddlewareChain() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := strings.Join(rec.Header().Values("X-Order"), ","); got != tt.wantOrder {
+				t.Errorf("order = %q, want %q", got, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	t.Parallel()
+
+	cfg := HTTPTransportConfig{
+		CORSAllowedOrigins: "https://example.com",
+		CORSAllowedMethods: "GET",
+		CORSAllowedHeaders: "Authorization",
+		CORSMaxAge:         60,
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := CORSMiddleware(next, cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		preflight  bool
+		wantStatus int
+		wantOrigin string
+	}{
+		{name: "no origin", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "allowed origin", method: http.MethodGet, origin: "https://example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://example.com"},
+		{name: "disallowed origin", method: http.MethodGet, origin: "https://evil.com", wantStatus: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, origin: "https://example.com", preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	cfg := HTTPTransportConfig{RateLimit: 1, RateLimitBurst: 2}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+	handler := RateLimitMiddleware(next, cfg, clk, logging.NewNopLogger())
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	for i := range 2 {
+		if rec := request("10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+
+	rec := request("10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+
+	if rec := request("10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	clk.Advance(time.Second)
+
+	if rec := request("10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("status after refill = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func orderMiddleware(name string) MiddlewareFactory {
+	return func(HTTPTransportConfig, logging.Logger) (Middleware, error) {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Order", name)
+				next.ServeHTTP(w, r)
+			})
+		}, nil
+	}
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	t.Parallel()
+
+	cfg := HTTPTransportConfig{
+		SecurityContentTypeOptions:    "nosniff",
+		SecurityFrameOptions:          "DENY",
+		SecurityReferrerPolicy:        "",
+		SecurityContentSecurityPolicy: "default-src 'self'",
+		SecurityHSTS:                  "max-age=60",
+	}
+
+	tests := []struct {
+		name    string
+		tls     bool
+		handler http.HandlerFunc
+		want    map[string]string
+	}{
+		{
+			name: "json response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = WriteJSON(w, r, http.StatusOK, "ok")
+			},
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "",
+				"Content-Security-Policy":   "",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name: "html response over tls",
+			tls:  true,
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("<!DOCTYPE html><html></html>"))
+			},
+			want: map[string]string{
+				"Content-Security-Policy":   "default-src 'self'",
+				"Strict-Transport-Security": "max-age=60",
+			},
+		},
+		{
+			name: "handler overrides header",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+			},
+			want: map[string]string{
+				"X-Frame-Options":         "SAMEORIGIN",
+				"Content-Security-Policy": "default-src 'self'",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				req = httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			}
+
+			rec := httptest.NewRecorder()
+			SecurityHeadersMiddleware(tt.handler, cfg).ServeHTTP(rec, req)
+
+			for name, want := range tt.want {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
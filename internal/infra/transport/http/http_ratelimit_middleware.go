@@ -0,0 +1,52 @@
+package http
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+	"github.com/mkrupp/homecase-michael/internal/util/tokenbucket"
+)
+
+// rateLimitIdleTimeout is the duration after which the bucket of an idle client is dropped.
+const rateLimitIdleTimeout = time.Minute
+
+// RateLimitMiddleware creates middleware that limits the request rate per client IP address
+// using a token bucket refilled at cfg.RateLimit requests per second and holding up to
+// cfg.RateLimitBurst requests, as time passes on clk. Requests exceeding the limit are rejected with
+// 429 Too Many Requests. A RateLimit of 0 disables the limit.
+func RateLimitMiddleware(next http.Handler, cfg HTTPTransportConfig, clk clock.Clock, log logging.Logger) http.Handler {
+	if cfg.RateLimit <= 0 {
+		return next
+	}
+
+	limiter := tokenbucket.NewKeyed(float64(cfg.RateLimit), float64(max(cfg.RateLimitBurst, 1)), rateLimitIdleTimeout)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, now := ClientIP(r), clk.Now()
+
+		if wait, ok := limiter.Get(client, now).Allow(now); !ok {
+			log.WarnContext(r.Context(), "rate limit exceeded", "client", client)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			WriteError(w, r, http.StatusTooManyRequests)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the IP address of the client of a request.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
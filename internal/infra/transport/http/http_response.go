@@ -0,0 +1,168 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+)
+
+// JSONContentType is the Content-Type of JSON responses.
+const JSONContentType = "application/json; charset=utf-8"
+
+const contextKeyResponseConfig = contextKey("responseConfig")
+
+type contextKey string
+
+// responseConfig controls how JSON responses are written.
+type responseConfig struct {
+	envelope    bool
+	prettyParam string
+}
+
+// ResponseConfigMiddleware creates middleware that makes the JSON response settings of cfg
+// available to WriteJSON and WriteError. ListenAndServe applies it to all requests.
+func ResponseConfigMiddleware(next http.Handler, cfg HTTPTransportConfig) http.Handler {
+	rc := responseConfig{
+		envelope:    cfg.JSONEnvelope,
+		prettyParam: cfg.URLPrettyParam,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKeyResponseConfig, rc)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WriteJSON replies to the request with the given HTTP status code and v encoded as JSON.
+// If the envelope is enabled, v is wrapped in a domain.ResponseEnvelope. The response is
+// indented if the request's pretty parameter is true, e.g. ?pretty=1.
+func WriteJSON(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	rc := getResponseConfig(r)
+
+	if rc.envelope {
+		v = domain.ResponseEnvelope{Data: v, Error: nil, RequestID: getRequestID(w, r)}
+	}
+
+	return writeJSON(w, r, rc, status, v)
+}
+
+// WriteError replies to the request with the given HTTP status code and a JSON error body
+// carrying the status text and the request's trace ID, if any.
+// If the envelope is enabled, the error is wrapped in a domain.ResponseEnvelope,
+// otherwise the body is a domain.ErrorResponse.
+func WriteError(w http.ResponseWriter, r *http.Request, status int) {
+	writeError(w, r, status, "", http.StatusText(status), nil)
+}
+
+// WriteDomainError replies to the request like WriteError, with the code and message of the
+// first registered error in the chain of err, so clients can tell errors of the same status
+// apart. If there is none, the code is domain.ErrorCodeInternal and the message the status text,
+// so internal details are not exposed to clients.
+func WriteDomainError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	code, message := domain.ErrorCodeInternal, http.StatusText(status)
+	if domainErr, ok := domain.AsError(err); ok {
+		code, message = domainErr.Code, domainErr.Message
+	}
+
+	writeError(w, r, status, code, message, nil)
+}
+
+// WriteBatchError replies to the request like WriteError, additionally listing the failed
+// items of a batch operation in the "errors" field of the error body.
+func WriteBatchError(w http.ResponseWriter, r *http.Request, status int, batchErr *domain.BatchError) {
+	var items []domain.BatchErrorItem
+	if batchErr != nil {
+		items = batchErr.Items
+	}
+
+	writeError(w, r, status, "", http.StatusText(status), items)
+}
+
+func writeError(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	code domain.ErrorCode,
+	message string,
+	items []domain.BatchErrorItem,
+) {
+	var (
+		rc        = getResponseConfig(r)
+		requestID = getRequestID(w, r)
+		body      any
+	)
+
+	if rc.envelope {
+		body = domain.ResponseEnvelope{
+			Data:      nil,
+			Error:     &domain.ResponseEnvelopeError{Status: status, Code: code, Message: message, Errors: items},
+			RequestID: requestID,
+		}
+	} else {
+		body = domain.ErrorResponse{Error: message, Code: code, Errors: items, RequestID: requestID}
+	}
+
+	w.Header().Del("Content-Length")
+
+	// Error bodies always marshal, so writing fails only if the client has gone away
+	_ = writeJSON(w, r, rc, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, rc responseConfig, status int, v any) error {
+	var (
+		body []byte
+		err  error
+	)
+
+	if isPretty(r, rc) {
+		body, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		body, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		return fmt.Errorf("marshal response: %w", err)
+	}
+
+	w.Header().Set("Content-Type", JSONContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+
+	return nil
+}
+
+func getResponseConfig(r *http.Request) responseConfig {
+	rc, _ := r.Context().Value(contextKeyResponseConfig).(responseConfig)
+
+	return rc
+}
+
+// getRequestID returns the trace ID of the request.
+func getRequestID(w http.ResponseWriter, r *http.Request) string {
+	if traceID, ok := context_.TraceIDFromContext(r.Context()); ok {
+		return traceID
+	}
+
+	// The trace ID is not in the context of middlewares wrapping TracingMiddleware
+	return w.Header().Get(TraceIDHeader)
+}
+
+func isPretty(r *http.Request, rc responseConfig) bool {
+	if rc.prettyParam == "" {
+		return false
+	}
+
+	pretty, err := strconv.ParseBool(r.URL.Query().Get(rc.prettyParam))
+
+	return err == nil && pretty
+}
@@ -0,0 +1,435 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+// ErrInvalidCacheTTL is returned when a route TTL of the response cache configuration is malformed
+// or names a route that is not cacheable.
+var ErrInvalidCacheTTL = errors.New("invalid response cache ttl")
+
+// CacheStatusHeader reports whether a response was served from the response cache ("HIT") or not ("MISS").
+const CacheStatusHeader = "X-Cache"
+
+// responseCacheMaxBodySize is the maximum size of cached response bodies in bytes.
+// Larger responses are passed through without being cached.
+const responseCacheMaxBodySize = 1 << 20
+
+// responseCacheVary lists the request headers besides the principal and URL that
+// responses may depend on, e.g. the issuer of the OIDC discovery document.
+//
+//nolint:gochecknoglobals
+var responseCacheVary = []string{"Accept", "Accept-Language", "X-Forwarded-Proto", "X-Forwarded-Host"}
+
+// ResponseCacheConfig holds configuration for caching responses of read-heavy routes in memory.
+type ResponseCacheConfig struct {
+	// TTLs is the comma-separated list of "<pattern>=<seconds>" TTLs of cached routes,
+	// e.g. "GET /gallery=30,GET /.well-known/jwks.json=300". Patterns are those the
+	// routes are registered with and must be among the cacheable routes of the service.
+	// Routes not listed are not cached.
+	TTLs string `env:"TTLS" default:""`
+
+	// MaxEntries is the maximum number of cached responses
+	MaxEntries int `env:"MAX_ENTRIES" default:"1000"`
+}
+
+// ResponseCache caches successful GET responses of selected routes in memory. Responses are
+// cached per route, principal (the authenticated username), host, request URI and the headers
+// listed in responseCacheVary, so users never see each other's responses. It is safe for
+// concurrent use. A nil *ResponseCache caches nothing.
+//
+// Cached responses are replayed with the headers set by the route, but not those set by outer
+// middlewares. Conditional requests matching their ETag or Last-Modified header are answered with
+// 304 Not Modified. Enveloped JSON responses are cached without their request ID and replayed in
+// an envelope carrying the ID of the replaying request; other responses embedding the request ID
+// are not cached.
+type ResponseCache struct {
+	ttls       map[string]time.Duration
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[responseCacheKey]*cachedResponse
+	hits       atomic.Int64
+	misses     atomic.Int64
+	clock      clock.Clock
+	log        logging.Logger
+}
+
+// responseCacheKey identifies a cached response.
+type responseCacheKey struct {
+	principal string
+	request   string
+}
+
+// cachedResponse is a response recorded by the ResponseCache.
+type cachedResponse struct {
+	header  http.Header
+	body    []byte // Body, or the data of an enveloped JSON body
+	data    bool   // Whether body is the data of an enveloped JSON body
+	expires time.Time
+}
+
+// NewResponseCache creates a ResponseCache for the routes listed in cfg.TTLs, which must be
+// among the cacheable routes. Returns nil if no route is listed, or ErrInvalidCacheTTL if the
+// list is malformed or lists a route that is not cacheable.
+func NewResponseCache(cfg ResponseCacheConfig, cacheable []string) (*ResponseCache, error) {
+	ttls := make(map[string]time.Duration)
+
+	for _, entry := range strings.Split(cfg.TTLs, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		pattern, secondsStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCacheTTL, entry)
+		}
+
+		seconds, err := strconv.ParseInt(strings.TrimSpace(secondsStr), 10, 64)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCacheTTL, entry)
+		}
+
+		pattern = strings.TrimSpace(pattern)
+		if !slices.Contains(cacheable, pattern) {
+			return nil, fmt.Errorf("%w: %q is not one of the cacheable routes %q", ErrInvalidCacheTTL, pattern, cacheable)
+		}
+
+		ttls[pattern] = time.Duration(seconds) * time.Second
+	}
+
+	if len(ttls) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &ResponseCache{
+		ttls:       ttls,
+		maxEntries: max(cfg.MaxEntries, 1),
+		mu:         sync.Mutex{},
+		entries:    make(map[responseCacheKey]*cachedResponse),
+		hits:       atomic.Int64{},
+		misses:     atomic.Int64{},
+		clock:      clock.Real{},
+		log:        logging.GetLogger("infra.transport.http.cache"),
+	}, nil
+}
+
+// SetClock sets the clock expiring cached responses, e.g. a fake clock in tests.
+// Defaults to the system clock. Does nothing if c is nil.
+func (c *ResponseCache) SetClock(clk clock.Clock) {
+	if c != nil {
+		c.clock = clk
+	}
+}
+
+// Handle wraps the handler of the route registered with pattern, caching its responses for the
+// configured TTL of pattern. Returns next unchanged if c is nil or pattern is not configured.
+// The principal is read from the request context, so Handle must be applied inside the
+// authorizing middleware.
+func (c *ResponseCache) Handle(pattern string, next http.Handler) http.Handler {
+	if c == nil || c.ttls[pattern] <= 0 {
+		return next
+	}
+
+	ttl := c.ttls[pattern]
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		key := responseCacheKeyOf(pattern, r)
+
+		if entry := c.get(key, c.clock.Now()); entry != nil {
+			c.hits.Add(1)
+			c.replay(w, r, entry)
+
+			return
+		}
+
+		c.misses.Add(1)
+		w.Header().Set(CacheStatusHeader, "MISS")
+
+		before := w.Header().Clone()
+		rec := &responseCacheRecorder{ResponseWriter: w, status: 0, body: bytes.Buffer{}, overflow: false}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK || rec.overflow || !cacheableHeader(w.Header()) {
+			return
+		}
+
+		body, data, ok := cacheableBody(w, r, rec.body.Bytes())
+		if !ok {
+			return
+		}
+
+		c.put(key, &cachedResponse{
+			header:  headerChanges(before, w.Header()),
+			body:    body,
+			data:    data,
+			expires: c.clock.Now().Add(ttl),
+		})
+	})
+}
+
+// replay writes a cached response, or 304 Not Modified if the request is conditional and
+// the cached response matches. The data of enveloped JSON bodies is wrapped in an envelope
+// carrying the request ID.
+func (c *ResponseCache) replay(w http.ResponseWriter, r *http.Request, entry *cachedResponse) {
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+
+	w.Header().Set(CacheStatusHeader, "HIT")
+
+	if etag := entry.header.Get("ETag"); etag != "" && NotModified(w, r, etag) {
+		return
+	}
+
+	modified, err := http.ParseTime(entry.header.Get("Last-Modified"))
+	if err == nil && NotModifiedSince(w, r, modified) {
+		return
+	}
+
+	if entry.data {
+		// The request ID may differ in length from that of the cached response
+		w.Header().Del("Content-Length")
+
+		if err := WriteJSON(w, r, http.StatusOK, json.RawMessage(entry.body)); err != nil {
+			c.log.DebugContext(r.Context(), "write cached response failed", "error", err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(entry.body); err != nil {
+		c.log.DebugContext(r.Context(), "write cached response failed", "error", err)
+	}
+}
+
+// cacheableBody returns the body of a response to cache without the request ID, and whether it
+// is the data of an enveloped JSON body. Returns false if the body embeds the request ID outside
+// of an envelope, so it cannot be replayed to other requests.
+func cacheableBody(w http.ResponseWriter, r *http.Request, body []byte) ([]byte, bool, bool) {
+	requestID := getRequestID(w, r)
+	if requestID == "" || !bytes.Contains(body, []byte(requestID)) {
+		return bytes.Clone(body), false, true
+	}
+
+	if !getResponseConfig(r).envelope {
+		return nil, false, false
+	}
+
+	var envelope struct {
+		Data      json.RawMessage `json:"data"`
+		RequestID string          `json:"request_id"`
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.RequestID != requestID ||
+		bytes.Contains(envelope.Data, []byte(requestID)) {
+		return nil, false, false
+	}
+
+	return bytes.Clone(envelope.Data), true, true
+}
+
+// Invalidate removes all cached responses of the given principal, e.g. after the user's media changed.
+func (c *ResponseCache) Invalidate(principal string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if key.principal == principal {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Stats returns the number of cached responses and the hits and misses of lookups since the cache
+// was created. Returns zero stats if c is nil.
+func (c *ResponseCache) Stats() domain.CacheStats {
+	if c == nil {
+		return domain.CacheStats{Entries: 0, MaxEntries: 0, Hits: 0, Misses: 0, HitRate: 0}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return domain.NewCacheStats(entries, c.maxEntries, c.hits.Load(), c.misses.Load())
+}
+
+// Purge removes all cached responses.
+func (c *ResponseCache) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+}
+
+// get returns the unexpired cached response of key, or nil if there is none.
+func (c *ResponseCache) get(key responseCacheKey, now time.Time) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+
+		return nil
+	}
+
+	return entry
+}
+
+// put caches the response of key. If the cache is full, expired responses are removed first,
+// then the responses expiring soonest.
+func (c *ResponseCache) put(key responseCacheKey, entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		now := c.clock.Now()
+
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+
+		for len(c.entries) >= c.maxEntries {
+			var oldest responseCacheKey
+
+			for key, entry := range c.entries {
+				if oldest == (responseCacheKey{}) || entry.expires.Before(c.entries[oldest].expires) {
+					oldest = key
+				}
+			}
+
+			delete(c.entries, oldest)
+		}
+	}
+
+	c.entries[key] = entry
+}
+
+// responseCacheKeyOf returns the cache key of a request to the route registered with pattern.
+func responseCacheKeyOf(pattern string, r *http.Request) responseCacheKey {
+	principal, _ := context_.UsernameFromContext(r.Context())
+
+	var sb strings.Builder
+
+	sb.WriteString(pattern)
+	sb.WriteByte(0)
+	sb.WriteString(r.Host)
+	sb.WriteByte(0)
+	sb.WriteString(r.URL.RequestURI())
+
+	for _, name := range responseCacheVary {
+		sb.WriteByte(0)
+		sb.WriteString(r.Header.Get(name))
+	}
+
+	return responseCacheKey{principal: principal, request: sb.String()}
+}
+
+// cacheableHeader reports whether a response with the given header may be cached.
+func cacheableHeader(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	return !slices.ContainsFunc(strings.Split(header.Get("Cache-Control"), ","), func(directive string) bool {
+		return strings.EqualFold(strings.TrimSpace(directive), "no-store")
+	})
+}
+
+// headerChanges returns the header fields of after that were added or changed since before.
+func headerChanges(before, after http.Header) http.Header {
+	changes := make(http.Header)
+
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			changes[name] = slices.Clone(values)
+		}
+	}
+
+	return changes
+}
+
+// responseCacheRecorder passes a response on while recording its status and body.
+type responseCacheRecorder struct {
+	http.ResponseWriter
+
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (rec *responseCacheRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (rec *responseCacheRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	if !rec.overflow {
+		if rec.body.Len()+len(data) > responseCacheMaxBodySize {
+			rec.overflow = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(data)
+		}
+	}
+
+	n, err := rec.ResponseWriter.Write(data)
+	if err != nil {
+		return n, fmt.Errorf("write: %w", err)
+	}
+
+	return n, nil
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (rec *responseCacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
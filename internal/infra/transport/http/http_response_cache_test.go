@@ -0,0 +1,181 @@
+package http_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestResponseCache(t *testing.T) {
+	t.Parallel()
+
+	cacheable := []string{"GET /albums", "GET /uncached", "GET /traced", "GET /enveloped", "GET /tagged"}
+
+	cache, err := NewResponseCache(ResponseCacheConfig{
+		TTLs: "GET /albums=60, GET /uncached=0, GET /traced=60, GET /enveloped=60, GET /tagged=60", MaxEntries: 10,
+	}, cacheable)
+	if err != nil {
+		t.Fatalf("NewResponseCache() error = %v", err)
+	}
+
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+	cache.SetClock(clk)
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if r.URL.Query().Has("fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("call " + strconv.Itoa(calls)))
+	})
+
+	handlers := map[string]http.Handler{
+		"/albums":   cache.Handle("GET /albums", next),
+		"/uncached": cache.Handle("GET /uncached", next),
+	}
+
+	// Steps share the cache, so they run in order
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		user       string
+		invalidate string
+		advance    time.Duration
+		wantBody   string
+		wantCache  string
+	}{
+		{name: "miss", method: http.MethodGet, path: "/albums", user: "alice", wantBody: "call 1", wantCache: "MISS"},
+		{name: "hit", method: http.MethodGet, path: "/albums", user: "alice", wantBody: "call 1", wantCache: "HIT"},
+		{name: "other user", method: http.MethodGet, path: "/albums", user: "bob", wantBody: "call 2", wantCache: "MISS"},
+		{name: "other query", method: http.MethodGet, path: "/albums?page=2", user: "alice", wantBody: "call 3", wantCache: "MISS"},
+		{name: "head not cached", method: http.MethodHead, path: "/albums", user: "alice", wantBody: "call 4", wantCache: ""},
+		{name: "error not cached", method: http.MethodGet, path: "/albums?fail", user: "alice", wantBody: "", wantCache: "MISS"},
+		{name: "error not replayed", method: http.MethodGet, path: "/albums?fail", user: "alice", wantBody: "", wantCache: "MISS"},
+		{name: "zero ttl", method: http.MethodGet, path: "/uncached", user: "alice", wantBody: "call 7", wantCache: ""},
+		{name: "invalidated", method: http.MethodGet, path: "/albums", user: "alice", invalidate: "alice",
+			wantBody: "call 8", wantCache: "MISS"},
+		{name: "other user kept", method: http.MethodGet, path: "/albums", user: "bob", wantBody: "call 2", wantCache: "HIT"},
+		{name: "within ttl", method: http.MethodGet, path: "/albums", user: "alice", advance: 59 * time.Second,
+			wantBody: "call 8", wantCache: "HIT"},
+		{name: "expired", method: http.MethodGet, path: "/albums", user: "alice", advance: time.Second,
+			wantBody: "call 9", wantCache: "MISS"},
+	}
+
+	for _, step := range steps {
+		if step.invalidate != "" {
+			cache.Invalidate(step.invalidate)
+		}
+
+		clk.Advance(step.advance)
+
+		req := httptest.NewRequest(step.method, step.path, nil)
+		req = req.WithContext(context_.WithUsername(req.Context(), step.user))
+		rec := httptest.NewRecorder()
+
+		handlers[req.URL.Path].ServeHTTP(rec, req)
+
+		if got := rec.Body.String(); got != step.wantBody {
+			t.Errorf("%s: body = %q, want %q", step.name, got, step.wantBody)
+		}
+
+		if got := rec.Header().Get(CacheStatusHeader); got != step.wantCache {
+			t.Errorf("%s: %s = %q, want %q", step.name, CacheStatusHeader, got, step.wantCache)
+		}
+
+		if step.wantBody != "" {
+			if got := rec.Header().Get("Content-Type"); got != "text/plain" {
+				t.Errorf("%s: Content-Type = %q, want %q", step.name, got, "text/plain")
+			}
+		}
+	}
+
+	// Enveloped responses are replayed with the request ID of the replaying request, other
+	// responses embedding the request ID are not cached, and conditional requests are answered
+	// from the cache
+	replayed := map[string]http.Handler{
+		"/traced": cache.Handle("GET /traced", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceID, _ := context_.TraceIDFromContext(r.Context())
+			_, _ = w.Write([]byte(`{"data":"traced","requestId":"` + traceID + `"}`))
+		})),
+		"/enveloped": ResponseConfigMiddleware(cache.Handle("GET /enveloped", http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_ = WriteJSON(w, r, http.StatusOK, map[string]string{"name": "enveloped"})
+			})), HTTPTransportConfig{JSONEnvelope: true, URLPrettyParam: "pretty"}),
+		"/tagged": cache.Handle("GET /tagged", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("tagged"))
+		})),
+	}
+
+	replays := []struct {
+		name        string
+		path        string
+		traceID     string
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+		wantCache   string
+	}{
+		{name: "traced miss", path: "/traced", traceID: "request-1", wantStatus: http.StatusOK,
+			wantBody: `{"data":"traced","requestId":"request-1"}`, wantCache: "MISS"},
+		{name: "traced not cached", path: "/traced", traceID: "request-2", wantStatus: http.StatusOK,
+			wantBody: `{"data":"traced","requestId":"request-2"}`, wantCache: "MISS"},
+		{name: "enveloped miss", path: "/enveloped", traceID: "request-3", wantStatus: http.StatusOK,
+			wantBody: `{"data":{"name":"enveloped"},"error":null,"request_id":"request-3"}` + "\n", wantCache: "MISS"},
+		{name: "enveloped hit", path: "/enveloped", traceID: "request-4", wantStatus: http.StatusOK,
+			wantBody: `{"data":{"name":"enveloped"},"error":null,"request_id":"request-4"}` + "\n", wantCache: "HIT"},
+		{name: "tagged miss", path: "/tagged", traceID: "request-5", wantStatus: http.StatusOK,
+			wantBody: "tagged", wantCache: "MISS"},
+		{name: "tagged hit", path: "/tagged", traceID: "request-6", wantStatus: http.StatusOK,
+			wantBody: "tagged", wantCache: "HIT"},
+		{name: "tagged not modified", path: "/tagged", traceID: "request-7", ifNoneMatch: `"v0", "v1"`,
+			wantStatus: http.StatusNotModified, wantBody: "", wantCache: "HIT"},
+		{name: "tagged modified", path: "/tagged", traceID: "request-8", ifNoneMatch: `"v0"`,
+			wantStatus: http.StatusOK, wantBody: "tagged", wantCache: "HIT"},
+	}
+
+	for _, step := range replays {
+		req := httptest.NewRequest(http.MethodGet, step.path, nil)
+		req = req.WithContext(context_.WithTraceID(req.Context(), step.traceID))
+
+		if step.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", step.ifNoneMatch)
+		}
+
+		rec := httptest.NewRecorder()
+		replayed[step.path].ServeHTTP(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d", step.name, rec.Code, step.wantStatus)
+		}
+
+		if got := rec.Body.String(); got != step.wantBody {
+			t.Errorf("%s: body = %q, want %q", step.name, got, step.wantBody)
+		}
+
+		if got := rec.Header().Get(CacheStatusHeader); got != step.wantCache {
+			t.Errorf("%s: %s = %q, want %q", step.name, CacheStatusHeader, got, step.wantCache)
+		}
+	}
+
+	for _, ttls := range []string{"GET /albums", "GET /unknown=60", "GET /albums=-1"} {
+		if _, err := NewResponseCache(ResponseCacheConfig{TTLs: ttls, MaxEntries: 10}, cacheable); !errors.Is(err, ErrInvalidCacheTTL) {
+			t.Errorf("NewResponseCache(%q) error = %v, want %v", ttls, err, ErrInvalidCacheTTL)
+		}
+	}
+}
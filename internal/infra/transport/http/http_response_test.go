@@ -0,0 +1,139 @@
+package http_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestWriteJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		envelope bool
+		url      string
+		handler  http.HandlerFunc
+		status   int
+		want     string
+	}{
+		{
+			name: "plain data",
+			url:  "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = WriteJSON(w, r, http.StatusOK, domain.AuthTokenResponse{Token: "t"})
+			},
+			status: http.StatusOK,
+			want:   `{"token":"t"}` + "\n",
+		},
+		{
+			name:     "enveloped data",
+			envelope: true,
+			url:      "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = WriteJSON(w, r, http.StatusOK, domain.AuthTokenResponse{Token: "t"})
+			},
+			status: http.StatusOK,
+			want:   `{"data":{"token":"t"},"error":null,"request_id":"req-1"}` + "\n",
+		},
+		{
+			name: "plain error",
+			url:  "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteError(w, r, http.StatusNotFound)
+			},
+			status: http.StatusNotFound,
+			want:   `{"error":"Not Found","requestId":"req-1"}` + "\n",
+		},
+		{
+			name:     "enveloped error",
+			envelope: true,
+			url:      "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteError(w, r, http.StatusNotFound)
+			},
+			status: http.StatusNotFound,
+			want:   `{"data":null,"error":{"status":404,"message":"Not Found"},"request_id":"req-1"}` + "\n",
+		},
+		{
+			name: "plain domain error",
+			url:  "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteDomainError(w, r, http.StatusConflict, fmt.Errorf("register: %w", domain.ErrUserAlreadyExists))
+			},
+			status: http.StatusConflict,
+			want:   `{"error":"user already exists","code":"user.already_exists","requestId":"req-1"}` + "\n",
+		},
+		{
+			name:     "enveloped domain error",
+			envelope: true,
+			url:      "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteDomainError(w, r, http.StatusConflict, domain.ErrUserAlreadyExists)
+			},
+			status: http.StatusConflict,
+			want: `{"data":null,"error":{"status":409,"code":"user.already_exists","message":"user already exists"},` +
+				`"request_id":"req-1"}` + "\n",
+		},
+		{
+			name: "unregistered error",
+			url:  "/",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteDomainError(w, r, http.StatusInternalServerError, errors.New("disk on fire"))
+			},
+			status: http.StatusInternalServerError,
+			want:   `{"error":"Internal Server Error","code":"internal","requestId":"req-1"}` + "\n",
+		},
+		{
+			name: "pretty",
+			url:  "/?pretty=1",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = WriteJSON(w, r, http.StatusOK, domain.AuthTokenResponse{Token: "t"})
+			},
+			status: http.StatusOK,
+			want:   "{\n  \"token\": \"t\"\n}\n",
+		},
+		{
+			name: "invalid pretty value",
+			url:  "/?pretty=yes",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = WriteJSON(w, r, http.StatusOK, domain.AuthTokenResponse{Token: "t"})
+			},
+			status: http.StatusOK,
+			want:   `{"token":"t"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := HTTPTransportConfig{JSONEnvelope: tt.envelope, URLPrettyParam: "pretty"}
+			handler := TracingMiddleware(ResponseConfigMiddleware(tt.handler, cfg))
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.Header.Set(TraceIDHeader, "req-1")
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Type"); got != JSONContentType {
+				t.Errorf("Content-Type = %q, want %q", got, JSONContentType)
+			}
+
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+)
+
+// W3C Trace Context headers.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const (
+	traceIDLength     = 32
+	spanIDLength      = 16
+	traceparentLength = 55
+	maxTracestateLen  = 512
+)
+
+// ParseTraceparent parses a W3C traceparent header value into the trace ID,
+// parent span ID and trace flags. Returns false if the value is invalid.
+// Values of future versions are accepted as long as their version 00 prefix is valid.
+func ParseTraceparent(value string) (traceID, parentID string, flags byte, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < traceparentLength {
+		return "", "", 0, false
+	}
+
+	version := value[0:2]
+	if !isLowerHex(version) || version == "ff" {
+		return "", "", 0, false
+	}
+
+	if version == "00" && len(value) != traceparentLength {
+		return "", "", 0, false
+	}
+
+	if len(value) > traceparentLength && value[traceparentLength] != '-' {
+		return "", "", 0, false
+	}
+
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return "", "", 0, false
+	}
+
+	traceID, parentID = value[3:35], value[36:52]
+	if !isLowerHex(traceID) || isZero(traceID) || !isLowerHex(parentID) || isZero(parentID) {
+		return "", "", 0, false
+	}
+
+	if !isLowerHex(value[53:55]) {
+		return "", "", 0, false
+	}
+
+	parsed, err := strconv.ParseUint(value[53:55], 16, 8)
+	if err != nil {
+		return "", "", 0, false
+	}
+
+	return traceID, parentID, byte(parsed), true
+}
+
+// getSpanContext returns the span context of a request, continuing the trace of a valid
+// traceparent header or starting a new sampled trace. Returns false if no IDs could be generated.
+func getSpanContext(r *http.Request) (context_.SpanContext, bool) {
+	spanID, err := randomHex(spanIDLength / 2)
+	if err != nil {
+		return context_.SpanContext{}, false
+	}
+
+	if traceID, parentID, flags, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		traceState := strings.Join(r.Header.Values(TracestateHeader), ",")
+		if len(traceState) > maxTracestateLen {
+			traceState = ""
+		}
+
+		return context_.SpanContext{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			ParentID:   parentID,
+			Flags:      flags,
+			TraceState: traceState,
+		}, true
+	}
+
+	traceID, err := randomHex(traceIDLength / 2)
+	if err != nil {
+		return context_.SpanContext{}, false
+	}
+
+	return context_.SpanContext{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		ParentID:   "",
+		Flags:      context_.TraceFlagSampled,
+		TraceState: "",
+	}, true
+}
+
+// randomHex returns n random bytes as lowercase hex digits, never all zero.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("read random: %w", err)
+		}
+
+		if id := hex.EncodeToString(b); !isZero(id) {
+			return id, nil
+		}
+	}
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range []byte(s) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
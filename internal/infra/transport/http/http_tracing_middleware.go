@@ -10,22 +10,46 @@ import (
 
 const TraceIDHeader = "X-Request-ID"
 
+// maxTraceIDLength is the maximum length of a client-supplied trace ID.
+const maxTraceIDLength = 128
+
 // TracingMiddleware creates middleware that adds request tracing.
-// It uses the X-Request-ID header if present, otherwise generates a new UUIDv7.
-// The trace ID is added to the request context.
+// It uses the X-Request-ID header if present, otherwise the trace ID of a valid W3C
+// traceparent header, otherwise generates a new UUIDv7.
+// The trace ID is added to the request context and echoed in the X-Request-ID
+// response header before the next handler runs, so it is present on error and
+// panic responses as well.
+// The W3C span context, continuing the caller's trace or starting a new one, is added
+// to the request context as well, for propagation to downstream services.
 func TracingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context_.WithTraceID(r.Context(), getTraceID(r))
+		ctx := r.Context()
+
+		spanCtx, ok := getSpanContext(r)
+		if ok {
+			ctx = context_.WithSpanContext(ctx, spanCtx)
+		}
+
+		traceID := getTraceID(r, spanCtx)
+		if traceID != "" {
+			w.Header().Set(TraceIDHeader, traceID)
+		}
+
+		ctx = context_.WithTraceID(ctx, traceID)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func getTraceID(r *http.Request) string {
-	if traceID := r.Header.Get(TraceIDHeader); traceID != "" {
+func getTraceID(r *http.Request, spanCtx context_.SpanContext) string {
+	if traceID := r.Header.Get(TraceIDHeader); isValidTraceID(traceID) {
 		return traceID
 	}
 
+	if spanCtx.IsRemote() {
+		return spanCtx.TraceID
+	}
+
 	uuid, err := uuid.New(uuid.UUIDv7)
 	if err != nil {
 		return ""
@@ -33,3 +57,19 @@ func getTraceID(r *http.Request) string {
 
 	return encoding.EncodeCrockfordB32LC(uuid.Bytes())
 }
+
+// isValidTraceID reports whether a client-supplied trace ID is non-empty, not too long
+// and consists of printable ASCII characters only, so it is safe to echo and log.
+func isValidTraceID(traceID string) bool {
+	if traceID == "" || len(traceID) > maxTraceIDLength {
+		return false
+	}
+
+	for _, c := range []byte(traceID) {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
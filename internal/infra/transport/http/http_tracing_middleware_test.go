@@ -0,0 +1,238 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	t.Parallel()
+
+	log := logging.NewNopLogger()
+
+	tests := []struct {
+		name       string
+		requestID  string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantEcho   bool
+	}{
+		{
+			name:       "echoes request ID on success",
+			requestID:  "abc-123",
+			handler:    func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) },
+			wantStatus: http.StatusOK,
+			wantEcho:   true,
+		},
+		{
+			name:       "echoes request ID on error",
+			requestID:  "abc-123",
+			handler:    func(w http.ResponseWriter, r *http.Request) { WriteError(w, r, http.StatusNotFound) },
+			wantStatus: http.StatusNotFound,
+			wantEcho:   true,
+		},
+		{
+			name:       "echoes request ID on panic",
+			requestID:  "abc-123",
+			handler:    func(http.ResponseWriter, *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantEcho:   true,
+		},
+		{
+			name:       "generates request ID",
+			handler:    func(w http.ResponseWriter, r *http.Request) { WriteError(w, r, http.StatusBadRequest) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "replaces invalid request ID",
+			requestID:  "abc 123",
+			handler:    func(w http.ResponseWriter, r *http.Request) { WriteError(w, r, http.StatusBadRequest) },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := TracingMiddleware(RescueingMiddleware(tt.handler, log))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.requestID != "" {
+				req.Header.Set(TraceIDHeader, tt.requestID)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			got := rec.Header().Get(TraceIDHeader)
+			if got == "" {
+				t.Fatalf("%s header missing", TraceIDHeader)
+			}
+
+			if (got == tt.requestID) != tt.wantEcho {
+				t.Errorf("%s = %q, request ID %q, want echo %t", TraceIDHeader, got, tt.requestID, tt.wantEcho)
+			}
+
+			if rec.Code < http.StatusBadRequest {
+				return
+			}
+
+			if ctype := rec.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "application/json") {
+				t.Fatalf("Content-Type = %q, want application/json", ctype)
+			}
+
+			var body domain.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode error body: %v", err)
+			}
+
+			if body.RequestID != got {
+				t.Errorf("body request ID = %q, want %q", body.RequestID, got)
+			}
+
+			if body.Error != http.StatusText(tt.wantStatus) {
+				t.Errorf("body error = %q, want %q", body.Error, http.StatusText(tt.wantStatus))
+			}
+		})
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		value     string
+		wantTrace string
+		wantSpan  string
+		wantFlags byte
+		wantOK    bool
+	}{
+		{
+			name:      "valid sampled",
+			value:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:  "00f067aa0ba902b7",
+			wantFlags: 0x01,
+			wantOK:    true,
+		},
+		{
+			name:      "future version with suffix",
+			value:     "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:  "00f067aa0ba902b7",
+			wantOK:    true,
+		},
+		{name: "empty", value: ""},
+		{name: "version 00 with suffix", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "uppercase hex", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "zero trace ID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero span ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "bad separator", value: "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			traceID, parentID, flags, ok := ParseTraceparent(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseTraceparent() ok = %t, want %t", ok, tt.wantOK)
+			}
+
+			if traceID != tt.wantTrace || parentID != tt.wantSpan || flags != tt.wantFlags {
+				t.Errorf("ParseTraceparent() = (%q, %q, %02x), want (%q, %q, %02x)",
+					traceID, parentID, flags, tt.wantTrace, tt.wantSpan, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestTracingMiddleware_SpanContext(t *testing.T) {
+	t.Parallel()
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		wantRemote  bool
+	}{
+		{name: "continues trace", traceparent: traceparent, tracestate: "vendor=value", wantRemote: true},
+		{name: "starts trace without traceparent"},
+		{name: "starts trace with invalid traceparent", traceparent: "00-invalid", tracestate: "vendor=value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				spanCtx context_.SpanContext
+				ok      bool
+			)
+
+			handler := TracingMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				spanCtx, ok = context_.SpanContextFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.traceparent != "" {
+				req.Header.Set(TraceparentHeader, tt.traceparent)
+				req.Header.Set(TracestateHeader, tt.tracestate)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if !ok {
+				t.Fatal("span context missing")
+			}
+
+			if spanCtx.IsRemote() != tt.wantRemote {
+				t.Errorf("IsRemote() = %t, want %t", spanCtx.IsRemote(), tt.wantRemote)
+			}
+
+			traceID, spanID, _, valid := ParseTraceparent(spanCtx.Traceparent())
+			if !valid || traceID != spanCtx.TraceID || spanID != spanCtx.SpanID {
+				t.Fatalf("Traceparent() = %q is not a valid propagation of %+v", spanCtx.Traceparent(), spanCtx)
+			}
+
+			if !tt.wantRemote {
+				if spanCtx.TraceState != "" || !spanCtx.IsSampled() {
+					t.Errorf("new trace = %+v, want sampled without tracestate", spanCtx)
+				}
+
+				return
+			}
+
+			if spanCtx.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || spanCtx.ParentID != "00f067aa0ba902b7" {
+				t.Errorf("span context = %+v, want continuation of %s", spanCtx, tt.traceparent)
+			}
+
+			if spanCtx.TraceState != tt.tracestate {
+				t.Errorf("TraceState = %q, want %q", spanCtx.TraceState, tt.tracestate)
+			}
+
+			if got := rec.Header().Get(TraceIDHeader); got != spanCtx.TraceID {
+				t.Errorf("%s = %q, want trace ID %q", TraceIDHeader, got, spanCtx.TraceID)
+			}
+		})
+	}
+}
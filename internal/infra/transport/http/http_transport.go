@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -10,6 +11,9 @@ import (
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
 )
 
+// ErrListen is returned when the server cannot listen on its address, e.g. because it is in use.
+var ErrListen = errors.New("listen")
+
 // HTTPTransportConfig contains configuration parameters for HTTP servers.
 type HTTPTransportConfig struct {
 	// ServerAddr is the network address to listen on
@@ -19,6 +23,52 @@ type HTTPTransportConfig struct {
 
 	ReadTimeout  int64 `env:"READ_TIMEOUT" default:"5"`
 	WriteTimeout int64 `env:"WRITE_TIMEOUT" default:"5"`
+
+	// JSONEnvelope wraps JSON responses in a {data, error, request_id} envelope
+	JSONEnvelope bool `env:"JSON_ENVELOPE" default:"false"`
+	// URLPrettyParam is the URL parameter enabling indented JSON responses, e.g. ?pretty=1
+	URLPrettyParam string `env:"URL_PRETTY_PARAM" default:"pretty"`
+
+	// Middlewares is the comma-separated, outermost first list of middlewares
+	// wrapping all requests (see RegisteredMiddlewares)
+	Middlewares string `env:"MIDDLEWARES" default:"tracing,metrics,logging,recover,security"`
+
+	// SLOAvailability is the objective of the fraction of requests not failing with a server error,
+	// as ratio or percentage, recorded by the metrics middleware
+	SLOAvailability string `env:"SLO_AVAILABILITY" default:"99.9%"`
+	// SLOLatency is the objective of the fraction of requests not failing with a server error
+	// that are served within SLOLatencyThreshold, as ratio or percentage
+	SLOLatency string `env:"SLO_LATENCY" default:"99%"`
+	// SLOLatencyThreshold is the duration in milliseconds within which requests count as served in time
+	SLOLatencyThreshold int64 `env:"SLO_LATENCY_THRESHOLD" default:"500"`
+
+	// SecurityContentTypeOptions is the X-Content-Type-Options header set by the security middleware
+	SecurityContentTypeOptions string `env:"SECURITY_CONTENT_TYPE_OPTIONS" default:"nosniff"`
+	// SecurityFrameOptions is the X-Frame-Options header set by the security middleware
+	SecurityFrameOptions string `env:"SECURITY_FRAME_OPTIONS" default:"DENY"`
+	// SecurityReferrerPolicy is the Referrer-Policy header set by the security middleware
+	SecurityReferrerPolicy string `env:"SECURITY_REFERRER_POLICY" default:"no-referrer"`
+	// SecurityContentSecurityPolicy is the Content-Security-Policy header set on HTML responses
+	SecurityContentSecurityPolicy string `env:"SECURITY_CONTENT_SECURITY_POLICY" default:"default-src 'self'; frame-ancestors 'none'"`
+	// SecurityHSTS is the Strict-Transport-Security header set on TLS connections
+	SecurityHSTS string `env:"SECURITY_HSTS" default:"max-age=31536000; includeSubDomains"`
+
+	// CORSAllowedOrigins is the comma-separated list of origins allowed by the cors middleware, or "*"
+	CORSAllowedOrigins string `env:"CORS_ALLOWED_ORIGINS" default:"*"`
+	// CORSAllowedMethods is the list of methods allowed in cross-origin requests
+	CORSAllowedMethods string `env:"CORS_ALLOWED_METHODS" default:"GET,HEAD,POST,DELETE,OPTIONS"`
+	// CORSAllowedHeaders is the list of headers allowed in cross-origin requests
+	CORSAllowedHeaders string `env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,X-Api-Key,X-Request-ID,If-None-Match,If-Modified-Since,traceparent,tracestate"`
+	// CORSMaxAge is the duration in seconds clients may cache preflight responses
+	CORSMaxAge int64 `env:"CORS_MAX_AGE" default:"600"`
+
+	// RateLimit is the number of requests per second allowed per client IP by the ratelimit middleware
+	RateLimit int `env:"RATE_LIMIT" default:"10"`
+	// RateLimitBurst is the number of requests a client IP may send at once
+	RateLimitBurst int `env:"RATE_LIMIT_BURST" default:"20"`
+
+	// ResponseCache configures the in-memory cache of read-heavy routes (see ResponseCache)
+	ResponseCache ResponseCacheConfig `envPrefix:"RESPONSE_CACHE_"`
 }
 
 // HTTPTransport defines the interface for HTTP handlers that can serve requests.
@@ -35,14 +85,21 @@ func HTTPHandlerFunc(handler HTTPTransport) http.HandlerFunc {
 }
 
 // ListenAndServe starts an HTTP server with the given handler and configuration.
-// It sets up standard middleware for logging, tracing, and panic recovery.
-// Returns an error if the server fails to start or encounters an error while running.
+// It wraps the handler in the middlewares listed in cfg.Middlewares, by default
+// tracing, logging, panic recovery and security headers.
+// Returns an error if the middleware list is invalid, or if the server fails to start
+// or encounters an error while running.
 func ListenAndServe(ctx context.Context, handler HTTPTransport, cfg HTTPTransportConfig) (err error) {
 	log := logging.GetLogger("infra.transport.http")
 
-	handler = RescueingMiddleware(handler, log)
-	handler = LoggingMiddleware(handler, log)
-	handler = TracingMiddleware(handler)
+	handler, err = BuildMiddlewareChain(handler, cfg, log)
+	if err != nil {
+		return fmt.Errorf("build middleware chain: %w", err)
+	}
+
+	log.DebugContext(ctx, "middlewares", "chain", ParseMiddlewares(cfg.Middlewares))
+
+	handler = ResponseConfigMiddleware(handler, cfg)
 
 	//nolint:exhaustruct
 	server := &http.Server{
@@ -57,7 +114,7 @@ func ListenAndServe(ctx context.Context, handler HTTPTransport, cfg HTTPTranspor
 
 	sock, err := net.Listen("tcp", cfg.ServerAddr)
 	if err != nil {
-		return fmt.Errorf("listen: %w", err)
+		return fmt.Errorf("%w: %w", ErrListen, err)
 	}
 	defer sock.Close()
 
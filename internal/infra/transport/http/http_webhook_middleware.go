@@ -0,0 +1,217 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+// Headers of signed webhook requests.
+const (
+	// WebhookIDHeader carries the unique ID of a webhook delivery, used for replay protection
+	WebhookIDHeader = "X-Webhook-ID"
+	// WebhookTimestampHeader carries the Unix timestamp in seconds when the webhook was signed
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookSignatureHeader carries one or more space-separated signatures "sha256=<hex>"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookSignaturePrefix precedes the hex-encoded HMAC-SHA256 of signatures.
+const webhookSignaturePrefix = "sha256="
+
+var (
+	// ErrWebhookMalformed is returned when a webhook request lacks an ID, timestamp or signature.
+	ErrWebhookMalformed = errors.New("malformed webhook")
+	// ErrWebhookSignature is returned when no signature of a webhook matches any secret.
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookExpired is returned when the timestamp of a webhook is too far from the server time.
+	ErrWebhookExpired = errors.New("webhook timestamp out of range")
+	// ErrWebhookReplayed is returned when a webhook with the same ID was already delivered.
+	ErrWebhookReplayed = errors.New("webhook replayed")
+)
+
+// WebhookConfig holds configuration for verifying signed inbound webhooks.
+type WebhookConfig struct {
+	// Secrets is the comma-separated list of shared HMAC-SHA256 keys accepted for signatures.
+	// Listing the old and the new key allows rotating keys without rejecting deliveries.
+	Secrets string `env:"SECRETS" default:""`
+
+	// MaxSkew is the maximum difference in seconds between the timestamp of a webhook and the
+	// server time. Deliveries are remembered for twice this duration to detect replays.
+	MaxSkew int64 `env:"MAX_SKEW" default:"300"`
+
+	// MaxBodySize is the maximum size of webhook bodies in bytes
+	MaxBodySize int64 `env:"MAX_BODY_SIZE" default:"1048576"`
+}
+
+// ReplayStore remembers the IDs of delivered webhooks. It is implemented by throttle.Store,
+// whose Redis store detects replays across replicas.
+type ReplayStore interface {
+	// Incr increments the counter of key, which expires after ttl. Returns the new count.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error)
+}
+
+// SignWebhook returns the signature header value of a webhook delivery with the given ID,
+// Unix timestamp and body: the HMAC-SHA256 of "<id>.<timestamp>.<body>" using secret.
+func SignWebhook(secret, id string, timestamp int64, body []byte) string {
+	mac := webhookMAC([]byte(secret), id, strconv.FormatInt(timestamp, 10), body)
+
+	return webhookSignaturePrefix + hex.EncodeToString(mac)
+}
+
+// WebhookMiddleware creates middleware verifying signed inbound webhooks before passing them on:
+// - The WebhookSignatureHeader must hold an HMAC-SHA256 signature by one of cfg.Secrets
+// - The WebhookTimestampHeader must be within cfg.MaxSkew seconds of the time of clk
+// - The WebhookIDHeader must not have been delivered before, as recorded in replays
+// Malformed requests are rejected with 400 Bad Request, invalid signatures and timestamps with
+// 401 Unauthorized, and replays with 409 Conflict. Bodies larger than cfg.MaxBodySize are rejected
+// with 413 Request Entity Too Large. If no secret is configured, all requests are rejected with
+// 503 Service Unavailable. The verified body is passed on to next.
+func WebhookMiddleware(
+	next http.Handler,
+	cfg WebhookConfig,
+	replays ReplayStore,
+	clk clock.Clock,
+	log logging.Logger,
+) http.Handler {
+	var secrets [][]byte
+
+	for _, secret := range strings.Split(cfg.Secrets, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+
+	maxSkew := time.Duration(cfg.MaxSkew) * time.Second
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(secrets) == 0 {
+			log.ErrorContext(r.Context(), "webhook rejected", "error", "no webhook secret configured")
+			WriteError(w, r, http.StatusServiceUnavailable)
+
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				WriteError(w, r, http.StatusRequestEntityTooLarge)
+			} else {
+				WriteError(w, r, http.StatusBadRequest)
+			}
+
+			log.WarnContext(r.Context(), "webhook rejected", "error", fmt.Errorf("read body: %w", err))
+
+			return
+		}
+
+		id := r.Header.Get(WebhookIDHeader)
+		log := log.With(logging.Group("webhook", "id", id))
+
+		if err := verifyWebhook(r, body, secrets, maxSkew, clk.Now()); err != nil {
+			log.WarnContext(r.Context(), "webhook rejected", "error", err)
+			WriteError(w, r, webhookErrorStatus(err))
+
+			return
+		}
+
+		// Timestamps are accepted up to maxSkew in either direction, so a delivery must be
+		// remembered for twice as long
+		if count, _, err := replays.Incr(r.Context(), "webhook:"+id, 2*maxSkew); err != nil {
+			log.ErrorContext(r.Context(), "webhook rejected", "error", fmt.Errorf("record delivery: %w", err))
+			WriteError(w, r, http.StatusServiceUnavailable)
+
+			return
+		} else if count > 1 {
+			log.WarnContext(r.Context(), "webhook rejected", "error", ErrWebhookReplayed)
+			WriteError(w, r, webhookErrorStatus(ErrWebhookReplayed))
+
+			return
+		}
+
+		log.DebugContext(r.Context(), "webhook verified")
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// verifyWebhook checks the presence of the webhook headers, the timestamp and the signature
+// of a webhook request with the given body.
+func verifyWebhook(r *http.Request, body []byte, secrets [][]byte, maxSkew time.Duration, now time.Time) error {
+	id := r.Header.Get(WebhookIDHeader)
+	timestampStr := r.Header.Get(WebhookTimestampHeader)
+	signatures := strings.Fields(r.Header.Get(WebhookSignatureHeader))
+
+	if id == "" || timestampStr == "" || len(signatures) == 0 {
+		return ErrWebhookMalformed
+	}
+
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: timestamp %q", ErrWebhookMalformed, timestampStr)
+	}
+
+	if skew := now.Sub(time.Unix(timestamp, 0)).Abs(); skew > maxSkew {
+		return fmt.Errorf("%w: skew %s exceeds %s", ErrWebhookExpired, skew, maxSkew)
+	}
+
+	for _, signature := range signatures {
+		hexMAC, ok := strings.CutPrefix(signature, webhookSignaturePrefix)
+		if !ok {
+			continue
+		}
+
+		mac, err := hex.DecodeString(hexMAC)
+		if err != nil {
+			continue
+		}
+
+		for _, secret := range secrets {
+			if hmac.Equal(mac, webhookMAC(secret, id, timestampStr, body)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrWebhookSignature
+}
+
+// webhookMAC returns the HMAC-SHA256 of "<id>.<timestamp>.<body>" using secret.
+func webhookMAC(secret []byte, id, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+// webhookErrorStatus returns the HTTP status code of a rejected webhook.
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrWebhookMalformed):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrWebhookReplayed):
+		return http.StatusConflict
+	default:
+		return http.StatusUnauthorized
+	}
+}
@@ -0,0 +1,89 @@
+package http_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+
+	. "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+func TestWebhookMiddleware(t *testing.T) {
+	t.Parallel()
+
+	const body = `{"event":"upload.completed"}`
+
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+	now := clk.Now().Unix()
+
+	tests := []struct {
+		name      string
+		secrets   string
+		id        string
+		timestamp int64
+		signature string
+		body      string
+		wantCode  int
+	}{
+		{name: "valid", secrets: "s3cret", id: "a", timestamp: now,
+			signature: SignWebhook("s3cret", "a", now, []byte(body)), body: body, wantCode: http.StatusOK},
+		{name: "rotated secret", secrets: "new, old", id: "b", timestamp: now,
+			signature: "sha256=00 " + SignWebhook("old", "b", now, []byte(body)), body: body, wantCode: http.StatusOK},
+		{name: "replayed", secrets: "s3cret", id: "a", timestamp: now,
+			signature: SignWebhook("s3cret", "a", now, []byte(body)), body: body, wantCode: http.StatusConflict},
+		{name: "tampered body", secrets: "s3cret", id: "c", timestamp: now,
+			signature: SignWebhook("s3cret", "c", now, []byte(body)), body: body + " ", wantCode: http.StatusUnauthorized},
+		{name: "wrong secret", secrets: "s3cret", id: "d", timestamp: now,
+			signature: SignWebhook("other", "d", now, []byte(body)), body: body, wantCode: http.StatusUnauthorized},
+		{name: "stale timestamp", secrets: "s3cret", id: "e", timestamp: now - 600,
+			signature: SignWebhook("s3cret", "e", now-600, []byte(body)), body: body, wantCode: http.StatusUnauthorized},
+		{name: "missing id", secrets: "s3cret", id: "", timestamp: now,
+			signature: SignWebhook("s3cret", "", now, []byte(body)), body: body, wantCode: http.StatusBadRequest},
+		{name: "body too large", secrets: "s3cret", id: "f", timestamp: now,
+			signature: "sha256=00", body: strings.Repeat("x", 2048), wantCode: http.StatusRequestEntityTooLarge},
+		{name: "no secret configured", secrets: "", id: "g", timestamp: now,
+			signature: SignWebhook("", "g", now, []byte(body)), body: body, wantCode: http.StatusServiceUnavailable},
+	}
+
+	replays := throttle.NewMemoryStore("")
+
+	// Subtests share the replay store, so they run in order
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ := io.ReadAll(r.Body)
+				_, _ = w.Write(received)
+			})
+
+			handler := WebhookMiddleware(next, WebhookConfig{
+				Secrets:     tt.secrets,
+				MaxSkew:     300,
+				MaxBodySize: 1024,
+			}, replays, clk, logging.NewNopLogger())
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/storage", strings.NewReader(tt.body))
+			req.Header.Set(WebhookIDHeader, tt.id)
+			req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(tt.timestamp, 10))
+			req.Header.Set(WebhookSignatureHeader, tt.signature)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
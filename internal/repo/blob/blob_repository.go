@@ -2,6 +2,7 @@ package blob
 
 import (
 	"context"
+	"io"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
 )
@@ -20,6 +21,11 @@ type Repository interface {
 	// Returns an error if the operation fails.
 	Store(ctx context.Context, blob *domain.Blob) error
 
+	// StoreFrom persists the content read from r as blob with the given ID, without holding
+	// it in memory. The blob is only replaced once r is read completely.
+	// Returns the number of bytes stored, or an error if reading or storing fails.
+	StoreFrom(ctx context.Context, id domain.BlobID, r io.Reader) (int64, error)
+
 	// Fetch retrieves a blob by its ID.
 	// Returns the blob if found, or an error if not found or if retrieval fails.
 	Fetch(ctx context.Context, id domain.BlobID) (*domain.Blob, error)
@@ -31,6 +37,10 @@ type Repository interface {
 	// DeleteAll removes all blobs matching the given ID prefix and pattern.
 	// Returns an error if any deletion operation fails.
 	DeleteAll(ctx context.Context, id domain.BlobID, pattern string) error
+
+	// List returns the IDs of all blobs in the repository.
+	// Returns an error if the repository cannot be enumerated.
+	List(ctx context.Context) ([]domain.BlobID, error)
 }
 
 // RepositoryFactory is a function that creates a new Repository instance.
@@ -0,0 +1,82 @@
+//go:build integration || all
+
+package blob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/faults"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob/blobtest"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	t.Parallel()
+
+	fileSystem := func(t *testing.T) blob.RepositoryFactory {
+		t.Helper()
+
+		return blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+	}
+
+	tests := []struct {
+		name    string
+		factory func(t *testing.T) blob.RepositoryFactory
+	}{
+		{"FileSystemRepository", fileSystem},
+		{"FileSystemRepository/PortableLocking", func(t *testing.T) blob.RepositoryFactory {
+			t.Helper()
+
+			return blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{
+				Basedir:         t.TempDir(),
+				PortableLocking: true,
+			})
+		}},
+		{"FileSystemRepository/PreviousLayout", func(t *testing.T) blob.RepositoryFactory {
+			t.Helper()
+
+			return blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{
+				Basedir:        t.TempDir(),
+				Layout:         blob.LayoutFanout2,
+				PreviousLayout: blob.LayoutFanout3,
+			})
+		}},
+		{"TracingRepository", func(t *testing.T) blob.RepositoryFactory {
+			t.Helper()
+
+			return blob.TracingRepositoryFactory(fileSystem(t), blob.TracingConfig{Enabled: true, SlowThreshold: 0})
+		}},
+		{"FaultInjectingRepository", func(t *testing.T) blob.RepositoryFactory {
+			t.Helper()
+
+			// Latency only, injected errors would fail the suite
+			injector := faults.NewInjector(faults.Config{
+				Enabled:       true,
+				Operations:    "",
+				Latency:       0,
+				LatencyJitter: 1,
+				ErrorRate:     0,
+			})
+
+			return blob.FaultInjectingRepositoryFactory(fileSystem(t), injector)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			blobtest.Run(t, func(t *testing.T) blob.Repository {
+				t.Helper()
+
+				repo, err := tt.factory(t)(context.Background(), "conformance", "bin")
+				if err != nil {
+					t.Fatalf("failed to create repository: %v", err)
+				}
+
+				return repo
+			})
+		})
+	}
+}
@@ -0,0 +1,506 @@
+// Package blobtest provides a conformance test suite for blob.Repository implementations.
+// Every implementation, including decorators, runs the suite to verify that it behaves like
+// the others with regard to locking, existence, deletion, listing, large and streamed blobs and concurrency.
+package blobtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+)
+
+const (
+	// largeBlobSize is the size of the blob verifying that large blobs are stored completely.
+	largeBlobSize = 4<<20 + 17
+
+	// lockWait is how long a blocked lock is expected to stay blocked.
+	lockWait = 50 * time.Millisecond
+
+	// concurrentWorkers is the number of goroutines of the concurrency tests.
+	concurrentWorkers = 8
+
+	// concurrentIterations is the number of operations of each goroutine of the concurrency tests.
+	concurrentIterations = 20
+)
+
+// Factory creates an empty repository for a single test.
+// Repositories created for different tests must not share blobs.
+type Factory func(t *testing.T) blob.Repository
+
+// Run runs the conformance suite against the repositories created by newRepo.
+// All tests run in parallel.
+func Run(t *testing.T, newRepo Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo blob.Repository)
+	}{
+		{"ReadAfterWrite", testReadAfterWrite},
+		{"Overwrite", testOverwrite},
+		{"Missing", testMissing},
+		{"Delete", testDelete},
+		{"DeleteAll", testDeleteAll},
+		{"List", testList},
+		{"LargeBlob", testLargeBlob},
+		{"StoreFrom", testStoreFrom},
+		{"SharedLocks", testSharedLocks},
+		{"ExclusiveLock", testExclusiveLock},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"ConcurrentReads", testConcurrentReads},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+func store(t *testing.T, repo blob.Repository, id domain.BlobID, body []byte) {
+	t.Helper()
+
+	if err := repo.Store(context.Background(), domain.NewBlob(id, body)); err != nil {
+		t.Fatalf("Store(%s) error = %v", id, err)
+	}
+}
+
+func fetch(t *testing.T, repo blob.Repository, id domain.BlobID) []byte {
+	t.Helper()
+
+	fetched, err := repo.Fetch(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Fetch(%s) error = %v", id, err)
+	}
+
+	if fetched.ID != id {
+		t.Errorf("Fetch(%s) returned blob %s", id, fetched.ID)
+	}
+
+	return fetched.Bytes()
+}
+
+func lock(t *testing.T, repo blob.Repository, id domain.BlobID, exclusive bool) func() {
+	t.Helper()
+
+	unlock, err := repo.Lock(context.Background(), id, exclusive)
+	if err != nil {
+		t.Fatalf("Lock(%s, %t) error = %v", id, exclusive, err)
+	}
+
+	return unlock
+}
+
+func testReadAfterWrite(t *testing.T, repo blob.Repository) {
+	store(t, repo, "readafterwrite", []byte("content"))
+
+	if !repo.Exists(context.Background(), "readafterwrite") {
+		t.Error("Exists() = false after Store()")
+	}
+
+	if got := fetch(t, repo, "readafterwrite"); string(got) != "content" {
+		t.Errorf("Fetch() = %q, want %q", got, "content")
+	}
+
+	// Empty blobs are blobs, too
+	store(t, repo, "emptyblob", nil)
+
+	if !repo.Exists(context.Background(), "emptyblob") {
+		t.Error("Exists() = false after Store() of empty blob")
+	}
+
+	if got := fetch(t, repo, "emptyblob"); len(got) != 0 {
+		t.Errorf("Fetch() of empty blob = %q", got)
+	}
+}
+
+func testOverwrite(t *testing.T, repo blob.Repository) {
+	store(t, repo, "overwritten", []byte("long original content"))
+	store(t, repo, "overwritten", []byte("short"))
+
+	if got := fetch(t, repo, "overwritten"); string(got) != "short" {
+		t.Errorf("Fetch() after overwrite = %q, want %q", got, "short")
+	}
+}
+
+func testMissing(t *testing.T, repo blob.Repository) {
+	ctx := context.Background()
+
+	if repo.Exists(ctx, "missingblob") {
+		t.Error("Exists() = true for missing blob")
+	}
+
+	if _, err := repo.Fetch(ctx, "missingblob"); err == nil {
+		t.Error("Fetch() error = nil for missing blob")
+	}
+
+	if err := repo.Delete(ctx, "missingblob"); err == nil {
+		t.Error("Delete() error = nil for missing blob")
+	}
+
+	if err := repo.DeleteAll(ctx, "missingblob", "_*"); err != nil {
+		t.Errorf("DeleteAll() error = %v without matching blobs", err)
+	}
+}
+
+func testDelete(t *testing.T, repo blob.Repository) {
+	ctx := context.Background()
+
+	store(t, repo, "deletedblob", []byte("content"))
+	store(t, repo, "deletedblob_640", []byte("derived"))
+
+	if err := repo.Delete(ctx, "deletedblob"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if repo.Exists(ctx, "deletedblob") {
+		t.Error("Exists() = true after Delete()")
+	}
+
+	if _, err := repo.Fetch(ctx, "deletedblob"); err == nil {
+		t.Error("Fetch() error = nil after Delete()")
+	}
+
+	if !repo.Exists(ctx, "deletedblob_640") {
+		t.Error("Delete() removed a blob with the ID as prefix")
+	}
+
+	// Deleted blobs can be stored again
+	store(t, repo, "deletedblob", []byte("restored"))
+
+	if got := fetch(t, repo, "deletedblob"); string(got) != "restored" {
+		t.Errorf("Fetch() after restore = %q, want %q", got, "restored")
+	}
+}
+
+func testDeleteAll(t *testing.T, repo blob.Repository) {
+	ctx := context.Background()
+
+	ids := []domain.BlobID{"deleteall", "deleteall_640", "deleteall_1280", "deleteallx_640", "otherblob_640"}
+	for _, id := range ids {
+		store(t, repo, id, []byte(id))
+	}
+
+	if err := repo.DeleteAll(ctx, "deleteall", "_*"); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+
+	for _, id := range ids {
+		want := id != "deleteall_640" && id != "deleteall_1280"
+		if got := repo.Exists(ctx, id); got != want {
+			t.Errorf("Exists(%s) after DeleteAll() = %t, want %t", id, got, want)
+		}
+	}
+}
+
+func testList(t *testing.T, repo blob.Repository) {
+	ctx := context.Background()
+
+	ids, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	} else if len(ids) != 0 {
+		t.Errorf("List() of empty repository = %v", ids)
+	}
+
+	want := []domain.BlobID{"listedblob1", "listedblob2", "listedblob2_640"}
+	for _, id := range want {
+		store(t, repo, id, []byte("content"))
+	}
+
+	// Locks and deleted blobs are not listed
+	unlock := lock(t, repo, "lockedblob", true)
+	defer unlock()
+
+	store(t, repo, "removedblob", []byte("content"))
+
+	if err := repo.Delete(ctx, "removedblob"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	ids, err = repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	slices.Sort(ids)
+
+	if !slices.Equal(ids, want) {
+		t.Errorf("List() = %v, want %v", ids, want)
+	}
+}
+
+func testLargeBlob(t *testing.T, repo blob.Repository) {
+	body := make([]byte, largeBlobSize)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+
+	store(t, repo, "largeblob", body)
+
+	fetched, err := repo.Fetch(context.Background(), "largeblob")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if fetched.Size() != largeBlobSize {
+		t.Errorf("Size() = %d, want %d", fetched.Size(), largeBlobSize)
+	}
+
+	// The fetched blob is streamed out completely
+	var buffer bytes.Buffer
+	if n, err := fetched.WriteTo(&buffer); err != nil || n != largeBlobSize {
+		t.Fatalf("WriteTo() = %d, %v", n, err)
+	}
+
+	if !bytes.Equal(buffer.Bytes(), body) {
+		t.Error("fetched content differs from stored content")
+	}
+}
+
+func testStoreFrom(t *testing.T, repo blob.Repository) {
+	ctx := context.Background()
+
+	body := make([]byte, largeBlobSize)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+
+	n, err := repo.StoreFrom(ctx, "streamed", bytes.NewReader(body))
+	if err != nil || n != largeBlobSize {
+		t.Fatalf("StoreFrom() = %d, %v, want %d", n, err, largeBlobSize)
+	}
+
+	if !bytes.Equal(fetch(t, repo, "streamed"), body) {
+		t.Error("fetched content differs from streamed content")
+	}
+
+	// A failed read keeps the previous content
+	failing := io.MultiReader(bytes.NewReader([]byte("partial")), iotest.ErrReader(errors.New("read failed")))
+	if _, err := repo.StoreFrom(ctx, "streamed", failing); err == nil {
+		t.Error("StoreFrom() error = nil for failing reader")
+	}
+
+	if !bytes.Equal(fetch(t, repo, "streamed"), body) {
+		t.Error("fetched content changed by failed StoreFrom()")
+	}
+
+	ids, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if !slices.Equal(ids, []domain.BlobID{"streamed"}) {
+		t.Errorf("List() = %v, want [streamed]", ids)
+	}
+}
+
+func testSharedLocks(t *testing.T, repo blob.Repository) {
+	unlock1 := lock(t, repo, "sharedlock", false)
+	defer unlock1()
+
+	acquired := make(chan func())
+
+	go func() {
+		unlock, err := repo.Lock(context.Background(), "sharedlock", false)
+		if err != nil {
+			t.Errorf("second Lock() error = %v", err)
+
+			unlock = func() {}
+		}
+
+		acquired <- unlock
+	}()
+
+	select {
+	case unlock2 := <-acquired:
+		unlock2()
+	case <-time.After(time.Second):
+		t.Fatal("shared lock blocked by another shared lock")
+	}
+
+	// Locks of other blobs are independent
+	unlock3 := lock(t, repo, "othersharedlock", true)
+	unlock3()
+}
+
+func testExclusiveLock(t *testing.T, repo blob.Repository) {
+	for _, secondExclusive := range []bool{true, false} {
+		unlock := lock(t, repo, "exclusivelock", true)
+
+		var acquired atomic.Bool
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			unlock2, err := repo.Lock(context.Background(), "exclusivelock", secondExclusive)
+			if err != nil {
+				t.Errorf("second Lock() error = %v", err)
+
+				return
+			}
+
+			acquired.Store(true)
+			unlock2()
+		}()
+
+		time.Sleep(lockWait)
+
+		if acquired.Load() {
+			t.Errorf("Lock(exclusive=%t) acquired while exclusively locked", secondExclusive)
+		}
+
+		unlock()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Lock(exclusive=%t) not acquired after release", secondExclusive)
+		}
+	}
+}
+
+// testConcurrentUpdates increments a counter blob from concurrent goroutines under an
+// exclusive lock. Any lost update indicates that the lock failed to exclude another writer.
+func testConcurrentUpdates(t *testing.T, repo blob.Repository) {
+	store(t, repo, "counterblob", []byte("0"))
+
+	var wg sync.WaitGroup
+
+	for range concurrentWorkers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range concurrentIterations {
+				if err := increment(repo, "counterblob"); err != nil {
+					t.Error(err)
+
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got, want := string(fetch(t, repo, "counterblob")), fmt.Sprint(concurrentWorkers*concurrentIterations); got != want {
+		t.Errorf("counter = %s, want %s", got, want)
+	}
+}
+
+func increment(repo blob.Repository, id domain.BlobID) error {
+	ctx := context.Background()
+
+	unlock, err := repo.Lock(ctx, id, true)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer unlock()
+
+	counter, err := repo.Fetch(ctx, id)
+	if err != nil {
+		return fmt.Errorf("fetch: %w", err)
+	}
+
+	var value int
+	if _, err := fmt.Sscan(string(counter.Bytes()), &value); err != nil {
+		return fmt.Errorf("parse counter %q: %w", counter.Bytes(), err)
+	}
+
+	if err := repo.Store(ctx, domain.NewBlob(id, []byte(fmt.Sprint(value+1)))); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+
+	return nil
+}
+
+// testConcurrentReads reads a blob under shared locks while it is rewritten under exclusive
+// locks. Readers must only ever see one of the complete versions.
+func testConcurrentReads(t *testing.T, repo blob.Repository) {
+	versions := [][]byte{
+		bytes.Repeat([]byte("a"), 64<<10),
+		bytes.Repeat([]byte("b"), 32<<10),
+	}
+
+	store(t, repo, "readblob", versions[0])
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i := range concurrentIterations {
+			unlock, err := repo.Lock(context.Background(), "readblob", true)
+			if err != nil {
+				t.Errorf("Lock() error = %v", err)
+
+				return
+			}
+
+			err = repo.Store(context.Background(), domain.NewBlob("readblob", versions[(i+1)%len(versions)]))
+
+			unlock()
+
+			if err != nil {
+				t.Errorf("Store() error = %v", err)
+
+				return
+			}
+		}
+	}()
+
+	for range concurrentWorkers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range concurrentIterations {
+				unlock, err := repo.Lock(context.Background(), "readblob", false)
+				if err != nil {
+					t.Errorf("Lock() error = %v", err)
+
+					return
+				}
+
+				fetched, err := repo.Fetch(context.Background(), "readblob")
+
+				unlock()
+
+				if err != nil {
+					t.Errorf("Fetch() error = %v", err)
+
+					return
+				}
+
+				if !slices.ContainsFunc(versions, func(v []byte) bool { return bytes.Equal(v, fetched.Bytes()) }) {
+					t.Errorf("Fetch() returned a torn blob of %d bytes", fetched.Size())
+
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,108 @@
+package blob
+
+import (
+	"context"
+	"io"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/faults"
+)
+
+// FaultInjectingRepository wraps a Repository, injecting faults into its calls.
+// Operations are named "blob.<method>", e.g. "blob.fetch".
+type FaultInjectingRepository struct {
+	Repository
+
+	injector *faults.Injector
+}
+
+var _ Repository = (*FaultInjectingRepository)(nil)
+
+// FaultInjectingRepositoryFactory wraps the repositories created by a factory into
+// FaultInjectingRepository. Returns the factory unchanged if the injector is nil.
+func FaultInjectingRepositoryFactory(factory RepositoryFactory, injector *faults.Injector) RepositoryFactory {
+	if injector == nil {
+		return factory
+	}
+
+	return func(ctx context.Context, name string, ext string) (Repository, error) {
+		repo, err := factory(ctx, name, ext)
+		if err != nil {
+			return nil, err
+		}
+
+		return &FaultInjectingRepository{Repository: repo, injector: injector}, nil
+	}
+}
+
+// Lock implements Repository.Lock.
+func (r *FaultInjectingRepository) Lock(ctx context.Context, id domain.BlobID, exclusive bool) (func(), error) {
+	if err := r.injector.Inject(ctx, "blob.lock"); err != nil {
+		return nil, err
+	}
+
+	return r.Repository.Lock(ctx, id, exclusive)
+}
+
+// Exists implements Repository.Exists. Injected errors report the blob as missing.
+func (r *FaultInjectingRepository) Exists(ctx context.Context, id domain.BlobID) bool {
+	if err := r.injector.Inject(ctx, "blob.exists"); err != nil {
+		return false
+	}
+
+	return r.Repository.Exists(ctx, id)
+}
+
+// Store implements Repository.Store.
+func (r *FaultInjectingRepository) Store(ctx context.Context, blob *domain.Blob) error {
+	if err := r.injector.Inject(ctx, "blob.store"); err != nil {
+		return err
+	}
+
+	return r.Repository.Store(ctx, blob)
+}
+
+// StoreFrom implements Repository.StoreFrom. Faults are injected as "blob.store".
+func (r *FaultInjectingRepository) StoreFrom(ctx context.Context, id domain.BlobID, reader io.Reader) (int64, error) {
+	if err := r.injector.Inject(ctx, "blob.store"); err != nil {
+		return 0, err
+	}
+
+	return r.Repository.StoreFrom(ctx, id, reader)
+}
+
+// Fetch implements Repository.Fetch.
+func (r *FaultInjectingRepository) Fetch(ctx context.Context, id domain.BlobID) (*domain.Blob, error) {
+	if err := r.injector.Inject(ctx, "blob.fetch"); err != nil {
+		return nil, err
+	}
+
+	return r.Repository.Fetch(ctx, id)
+}
+
+// Delete implements Repository.Delete.
+func (r *FaultInjectingRepository) Delete(ctx context.Context, id domain.BlobID) error {
+	if err := r.injector.Inject(ctx, "blob.delete"); err != nil {
+		return err
+	}
+
+	return r.Repository.Delete(ctx, id)
+}
+
+// DeleteAll implements Repository.DeleteAll.
+func (r *FaultInjectingRepository) DeleteAll(ctx context.Context, id domain.BlobID, pattern string) error {
+	if err := r.injector.Inject(ctx, "blob.delete_all"); err != nil {
+		return err
+	}
+
+	return r.Repository.DeleteAll(ctx, id, pattern)
+}
+
+// List implements Repository.List.
+func (r *FaultInjectingRepository) List(ctx context.Context) ([]domain.BlobID, error) {
+	if err := r.injector.Inject(ctx, "blob.list"); err != nil {
+		return nil, err
+	}
+
+	return r.Repository.List(ctx)
+}
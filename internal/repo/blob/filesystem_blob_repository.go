@@ -4,11 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
@@ -29,6 +29,31 @@ const (
 type FileSystemBlobRepositoryConfig struct {
 	// Basedir is the root directory for blob storage
 	Basedir string `env:"BASEDIR" default:"var/storage/blob"`
+
+	// PortableLocking locks blobs by exclusively created lock files instead of flock, for
+	// filesystems without flock support, e.g. some network filesystems. Shared locks are only
+	// shared within a process, and lock files left behind by crashed processes must be removed
+	// manually. Always enabled on platforms without flock.
+	PortableLocking bool `env:"PORTABLE_LOCKING" default:"false"`
+
+	// Layout is the directory layout of blob files ("fanout3", "fanout2", "fanout1", "flat")
+	Layout string `env:"LAYOUT" default:"fanout3"`
+
+	// PreviousLayout is the layout blobs were stored in before Layout was changed, empty if it
+	// never was. Blobs missing in Layout are read from PreviousLayout and moved to Layout in the
+	// background on access, so the layout can be changed without downtime.
+	PreviousLayout string `env:"PREVIOUS_LAYOUT" default:""`
+
+	// MigrateOnStartup moves all blobs of PreviousLayout to Layout in the background on startup,
+	// instead of only the accessed ones.
+	MigrateOnStartup bool `env:"MIGRATE_ON_STARTUP" default:"false"`
+
+	// MigrationWorkers is the number of workers moving blobs read from PreviousLayout
+	MigrationWorkers int `env:"MIGRATION_WORKERS" default:"2"`
+
+	// MigrationQueueSize is the maximum number of blobs read from PreviousLayout waiting to be
+	// moved. Blobs read while the queue is full are moved on a later read.
+	MigrationQueueSize int `env:"MIGRATION_QUEUE_SIZE" default:"1000"`
 }
 
 // FileSystemBlobRepositoryFactory creates a factory function that returns a new FileSystemRepository.
@@ -47,7 +72,7 @@ func FileSystemBlobRepositoryFactory(cfg FileSystemBlobRepositoryConfig) Reposit
 // - subdir: subdirectory name for organizing blobs
 // - ext: file extension for blob files
 // - cfg: repository configuration
-// Returns an error if initialization fails.
+// Returns ErrUnknownLayout if a configured layout does not exist, or an error if initialization fails.
 func NewFileSystemBlobRepository(
 	ctx context.Context,
 	subdir string,
@@ -62,29 +87,85 @@ func NewFileSystemBlobRepository(
 		),
 	)
 
+	layout, err := parseLayout(cfg.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("layout: %w", err)
+	}
+
+	var previous *storageLayout
+
+	if cfg.PreviousLayout != "" {
+		previousLayout, err := parseLayout(cfg.PreviousLayout)
+		if err != nil {
+			return nil, fmt.Errorf("previous layout: %w", err)
+		}
+
+		if previousLayout != layout {
+			previous = &previousLayout
+		}
+	}
+
 	repo := &FileSystemRepository{
-		subdir: subdir,
-		ext:    ext,
-		cfg:    cfg,
-		log:    log,
-		m:      new(sync.Mutex),
+		subdir:     subdir,
+		ext:        ext,
+		cfg:        cfg,
+		layout:     layout,
+		previous:   previous,
+		migrating:  make(map[domain.BlobID]struct{}),
+		migrations: nil,
+		log:        log,
+		m:          new(sync.Mutex),
 	}
 
 	if err := repo.initStorage(ctx); err != nil {
 		return nil, fmt.Errorf("init repo: %w", err)
 	}
 
+	if repo.dualRead() {
+		repo.startMigrationWorkers(context.WithoutCancel(ctx))
+	}
+
+	if repo.dualRead() && cfg.MigrateOnStartup {
+		go func() { _, _ = repo.MigrateLayout(context.WithoutCancel(ctx)) }()
+	}
+
 	return repo, nil
 }
 
+// ProbeFileSystemStorage checks whether the storage base directory is writable.
+func ProbeFileSystemStorage(_ context.Context, cfg FileSystemBlobRepositoryConfig) error {
+	if err := os.MkdirAll(cfg.Basedir, 0o755); err != nil {
+		return fmt.Errorf("mkdir all: %w", err)
+	}
+
+	file, err := os.CreateTemp(cfg.Basedir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("create temp: %w", err)
+	}
+
+	_ = file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return fmt.Errorf("remove temp: %w", err)
+	}
+
+	return nil
+}
+
 // FileSystemRepository implements Repository using the local filesystem.
 // It organizes blobs in a directory hierarchy to improve performance with large numbers of files.
+// While a previous layout is configured, blobs are read from the configured layout first and
+// from the previous layout second, and written to the configured layout only.
 type FileSystemRepository struct {
-	subdir string
-	ext    string
-	cfg    FileSystemBlobRepositoryConfig
-	log    logging.Logger
-	m      *sync.Mutex
+	subdir     string
+	ext        string
+	cfg        FileSystemBlobRepositoryConfig
+	layout     storageLayout
+	previous   *storageLayout             // Layout read as fallback, nil if none
+	migrating  map[domain.BlobID]struct{} // Blobs queued or being moved from the previous layout
+	migrations chan domain.BlobID         // Queue of blobs to move from the previous layout
+	log        logging.Logger
+	m          *sync.Mutex
 }
 
 var _ Repository = (*FileSystemRepository)(nil)
@@ -92,14 +173,9 @@ var _ Repository = (*FileSystemRepository)(nil)
 func (fsRepo *FileSystemRepository) Lock(ctx context.Context, id domain.BlobID, exclusive bool) (func(), error) {
 	filename := fsRepo.GetFilename(id)
 
-	mode := syscall.LOCK_SH
-	if exclusive {
-		mode = syscall.LOCK_EX
-	}
-
-	release, err := fsRepo.flock(ctx, filename, mode)
+	release, err := fsRepo.lock(ctx, filename, exclusive)
 	if err != nil {
-		return nil, fmt.Errorf("flock: %w", err)
+		return nil, fmt.Errorf("lock: %w", err)
 	}
 
 	return release, nil
@@ -125,6 +201,15 @@ func (fsRepo *FileSystemRepository) DeleteAll(ctx context.Context, id domain.Blo
 	return nil
 }
 
+func (fsRepo *FileSystemRepository) List(ctx context.Context) ([]domain.BlobID, error) {
+	ids, err := fsRepo.listBlobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list blobs: %w", err)
+	}
+
+	return ids, nil
+}
+
 func (fsRepo *FileSystemRepository) Fetch(ctx context.Context, id domain.BlobID) (*domain.Blob, error) {
 	blob, err := fsRepo.fetchBlob(ctx, id)
 	if err != nil {
@@ -142,6 +227,15 @@ func (fsRepo *FileSystemRepository) Store(ctx context.Context, blob *domain.Blob
 	return nil
 }
 
+func (fsRepo *FileSystemRepository) StoreFrom(ctx context.Context, id domain.BlobID, r io.Reader) (int64, error) {
+	n, err := fsRepo.storeBlobFrom(ctx, id, r)
+	if err != nil {
+		return n, fmt.Errorf("store blob from reader: %w", err)
+	}
+
+	return n, nil
+}
+
 func (fsRepo *FileSystemRepository) initStorage(ctx context.Context) (err error) {
 	defer func() {
 		if err != nil {
@@ -161,30 +255,28 @@ func (fsRepo *FileSystemRepository) initStorage(ctx context.Context) (err error)
 }
 
 func (fsRepo *FileSystemRepository) getBasename(id domain.BlobID) string {
-	// Pad the id with zeros to the left to make it fit ith the directory structure
-	basename := strings.ReplaceAll(string(id), "/", "")
-	basename = strings.ReplaceAll(fmt.Sprintf("%*s", idMinLength, basename), " ", "0")
-
-	// Split the filename into dirPrefixDepth chunks of dirPrefixLength characters
-	// and create a directory structure like this:
-	//   5f/56/69/2f/5f56692f0df9ff68607abdb054943ed86bcee7c9f2a2d01fdcb27032f70f3fe9.bin
-	var prefixes []string
-	for i := 0; i < dirPrefixLength*dirPrefixDepth && i < len(basename)-dirPrefixLength; i += dirPrefixLength {
-		prefixes = append(prefixes, basename[i:i+dirPrefixLength])
-	}
-
-	return filepath.Join(append(append([]string{fsRepo.cfg.Basedir, fsRepo.subdir}, prefixes...), basename)...)
+	return fsRepo.layout.basename(filepath.Join(fsRepo.cfg.Basedir, fsRepo.subdir), id)
 }
 
-func (fsRepo *FileSystemRepository) getFilenames(id domain.BlobID, pattern string) (filenames []string, err error) {
-	basename := fsRepo.getBasename(id)
+func (fsRepo *FileSystemRepository) getFilenames(basename string, pattern string) (filenames []string, err error) {
 	pattern = fmt.Sprintf("%s%s.%s", basename, pattern, fsRepo.ext)
 
-	err = filepath.Walk(filepath.Dir(basename), func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
+	dir := filepath.Dir(basename)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// No blob with the ID prefix was ever stored
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+
 			return err
 		}
 
+		if info.IsDir() {
+			return nil
+		}
+
 		if matched, err := filepath.Match(pattern, path); err != nil {
 			return fmt.Errorf("match: %w", err)
 		} else if !matched {
@@ -199,12 +291,14 @@ func (fsRepo *FileSystemRepository) getFilenames(id domain.BlobID, pattern strin
 	return
 }
 
-// GetFilename returns the full filesystem path for a blob with the given ID.
+// GetFilename returns the full filesystem path for a blob with the given ID in the configured layout.
 func (fsRepo *FileSystemRepository) GetFilename(id domain.BlobID) string {
 	return fmt.Sprintf("%s.%s", fsRepo.getBasename(id), fsRepo.ext)
 }
 
-func (fsRepo *FileSystemRepository) flock(ctx context.Context, filename string, mode int) (release func(), err error) {
+// lock locks the lock file of a blob file, using flock unless portable locking is configured
+// or flock is not supported by the platform.
+func (fsRepo *FileSystemRepository) lock(ctx context.Context, filename string, exclusive bool) (release func(), err error) {
 	lockfile := filename + ".lock"
 	log := fsRepo.log.With(logging.Group("blob", "lockfile", lockfile))
 
@@ -220,31 +314,31 @@ func (fsRepo *FileSystemRepository) flock(ctx context.Context, filename string,
 		return nil, fmt.Errorf("mkdir all: %w", err)
 	}
 
-	file, err := os.OpenFile(lockfile, os.O_CREATE|os.O_RDWR, 0o600)
-	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+	lockFile := flockLockFile
+	if fsRepo.cfg.PortableLocking || !flockSupported {
+		lockFile = mutexLockFile
 	}
 
-	err = syscall.Flock(int(file.Fd()), mode)
+	unlock, err := lockFile(ctx, lockfile, exclusive)
 	if err != nil {
-		_ = os.Remove(lockfile)
-		_ = file.Close()
-
-		return nil, fmt.Errorf("flock: %w", err)
+		return nil, err
 	}
 
 	return func() {
-		_ = os.Remove(lockfile)
-		_ = file.Close()
-		_ = syscall.Flock(int(file.Fd()), mode)
+		unlock()
 
 		log.DebugContext(ctx, "lock released")
 	}, nil
 }
 
 func (fsRepo *FileSystemRepository) blobExists(id domain.BlobID) bool {
-	filename := fsRepo.GetFilename(id)
-	_, err := os.Stat(filename)
+	if _, err := os.Stat(fsRepo.GetFilename(id)); err == nil {
+		return true
+	} else if !fsRepo.dualRead() {
+		return false
+	}
+
+	_, err := os.Stat(fsRepo.getPreviousFilename(id))
 
 	return err == nil
 }
@@ -285,9 +379,81 @@ func (fsRepo *FileSystemRepository) storeBlob(ctx context.Context, blob *domain.
 		return fmt.Errorf("%w: expected %d, got %d", ErrBytesWrittenMismatch, blob.Size(), bytes)
 	}
 
+	// The stored blob replaces any file of the previous layout, which must not be read again
+	if fsRepo.dualRead() {
+		if err := os.Remove(fsRepo.getPreviousFilename(blob.ID)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove previous: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// storeBlobFrom writes the content of r to a temporary file next to the blob file, which
+// replaces the blob file once it is written completely, so a failed read never leaves a
+// truncated blob behind.
+func (fsRepo *FileSystemRepository) storeBlobFrom(
+	ctx context.Context,
+	id domain.BlobID,
+	r io.Reader,
+) (n int64, err error) {
+	filename := fsRepo.GetFilename(id)
+
+	defer func() {
+		log := fsRepo.log.With(logging.Group("blob", "id", id, "filename", filename))
+		if err != nil {
+			log.ErrorContext(ctx, "blob store failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "blob stored", "size", n)
+		}
+	}()
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return 0, fmt.Errorf("mkdir all: %w", err)
+	}
+
+	// The temporary file lacks the extension of blob files, so it is never listed as blob
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("create temp: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+
+		if err != nil {
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	if n, err = io.Copy(file, r); err != nil {
+		return n, fmt.Errorf("write: %w", err)
+	} else if err := file.Sync(); err != nil {
+		return n, fmt.Errorf("sync: %w", err)
+	} else if info, err := file.Stat(); err != nil {
+		return n, fmt.Errorf("stat: %w", err)
+	} else if n != info.Size() {
+		return n, fmt.Errorf("%w: expected %d, got %d", ErrBytesWrittenMismatch, n, info.Size())
+	}
+
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return n, fmt.Errorf("chmod: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return n, fmt.Errorf("rename: %w", err)
+	}
+
+	// The stored blob replaces any file of the previous layout, which must not be read again
+	if fsRepo.dualRead() {
+		if err := os.Remove(fsRepo.getPreviousFilename(id)); err != nil && !os.IsNotExist(err) {
+			return n, fmt.Errorf("remove previous: %w", err)
+		}
+	}
+
+	return n, nil
+}
+
 func (fsRepo *FileSystemRepository) fetchBlob(
 	ctx context.Context,
 	blobID domain.BlobID,
@@ -304,6 +470,14 @@ func (fsRepo *FileSystemRepository) fetchBlob(
 	}()
 
 	file, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	if os.IsNotExist(err) && fsRepo.dualRead() {
+		filename = fsRepo.getPreviousFilename(blobID)
+
+		if file, err = os.OpenFile(filename, os.O_RDONLY, 0); err == nil {
+			fsRepo.scheduleMigration(ctx, blobID)
+		}
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("open: %w", err)
 	}
@@ -334,7 +508,19 @@ func (fsRepo *FileSystemRepository) deleteBlob(ctx context.Context, id domain.Bl
 		}
 	}()
 
-	if err := os.Remove(filename); err != nil {
+	err = os.Remove(filename)
+
+	// The blob may be stored in either layout until it is migrated
+	if fsRepo.dualRead() {
+		previous := fsRepo.getPreviousFilename(id)
+		if errPrevious := os.Remove(previous); errPrevious == nil {
+			filename, err = previous, nil
+		} else if !os.IsNotExist(errPrevious) {
+			return fmt.Errorf("remove previous: %w", errPrevious)
+		}
+	}
+
+	if err != nil {
 		return fmt.Errorf("remove: %w", err)
 	}
 
@@ -355,11 +541,22 @@ func (fsRepo *FileSystemRepository) deleteBlobPattern(
 		}
 	}()
 
-	filenames, err := fsRepo.getFilenames(blobID, pattern)
+	filenames, err := fsRepo.getFilenames(fsRepo.getBasename(blobID), pattern)
 	if err != nil {
 		return fmt.Errorf("get filenames: %w", err)
 	}
 
+	if fsRepo.dualRead() {
+		basedir := filepath.Join(fsRepo.cfg.Basedir, fsRepo.subdir)
+
+		previous, err := fsRepo.getFilenames(fsRepo.previous.basename(basedir, blobID), pattern)
+		if err != nil {
+			return fmt.Errorf("get previous filenames: %w", err)
+		}
+
+		filenames = append(filenames, previous...)
+	}
+
 	for _, filename := range filenames {
 		if err := os.Remove(filename); err != nil {
 			if !os.IsNotExist(err) {
@@ -370,3 +567,65 @@ func (fsRepo *FileSystemRepository) deleteBlobPattern(
 
 	return nil
 }
+
+// listBlobs walks the repository directory and returns the IDs of all blobs.
+// IDs shorter than the directory prefix are returned zero-padded, see getBasename.
+// Blobs stored in both the configured and the previous layout are listed once.
+func (fsRepo *FileSystemRepository) listBlobs(ctx context.Context) (ids []domain.BlobID, err error) {
+	basedir := filepath.Join(fsRepo.cfg.Basedir, fsRepo.subdir)
+	seen := make(map[domain.BlobID]struct{})
+
+	defer func() {
+		log := fsRepo.log.With(logging.Group("blob", "dir", basedir))
+		if err != nil {
+			log.ErrorContext(ctx, "blob list failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "blobs listed", "count", len(ids))
+		}
+	}()
+
+	err = fsRepo.walkBlobs(ctx, func(_ string, id domain.BlobID) {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// walkBlobs walks the repository directory, calling fn with the path and ID of every blob file.
+func (fsRepo *FileSystemRepository) walkBlobs(ctx context.Context, fn func(path string, id domain.BlobID)) error {
+	basedir := filepath.Join(fsRepo.cfg.Basedir, fsRepo.subdir)
+	suffix := "." + fsRepo.ext
+
+	err := filepath.WalkDir(basedir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == basedir {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			return nil
+		}
+
+		fn(path, domain.BlobID(strings.TrimSuffix(entry.Name(), suffix)))
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk dir: %w", err)
+	}
+
+	return nil
+}
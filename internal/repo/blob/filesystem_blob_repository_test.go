@@ -7,6 +7,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
@@ -232,6 +233,45 @@ func TestFileSystemBlobRepository_Delete(t *testing.T) {
 	}
 }
 
+func TestFileSystemBlobRepository_List(t *testing.T) {
+	t.Parallel()
+
+	repo, _, cleanup := setupFileSystemBlobTestRepo(t)
+	t.Cleanup(cleanup)
+
+	ids, err := repo.List(context.TODO())
+	if err != nil {
+		t.Fatalf("failed to list empty repository: %v", err)
+	} else if len(ids) != 0 {
+		t.Errorf("expected no blobs, got %v", ids)
+	}
+
+	want := []domain.BlobID{"listedblob1", "listedblob2", "listedblob2_640"}
+	for _, id := range want {
+		if err := repo.Store(context.TODO(), &domain.Blob{ID: id, Body: []byte("test content")}); err != nil {
+			t.Fatalf("failed to store blob: %v", err)
+		}
+	}
+
+	// Lock files must not be listed
+	unlock, err := repo.Lock(context.TODO(), "listedblob1", false)
+	if err != nil {
+		t.Fatalf("failed to lock blob: %v", err)
+	}
+	t.Cleanup(unlock)
+
+	ids, err = repo.List(context.TODO())
+	if err != nil {
+		t.Fatalf("failed to list repository: %v", err)
+	}
+
+	slices.Sort(ids)
+
+	if !slices.Equal(ids, want) {
+		t.Errorf("expected %v, got %v", want, ids)
+	}
+}
+
 func TestFileSystemBlobRepository_Lock(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,227 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// ErrUnknownLayout is returned when the configured storage layout does not exist.
+var ErrUnknownLayout = errors.New("unknown storage layout")
+
+// Storage layouts, selecting the directories blob files are fanned out to.
+const (
+	// LayoutFanout3 nests blobs in three levels of directories named by the first six characters
+	// of their ID, e.g. 5f/56/69/5f56692f...bin
+	LayoutFanout3 = "fanout3"
+	// LayoutFanout2 nests blobs in two levels of directories, e.g. 5f/56/5f56692f...bin
+	LayoutFanout2 = "fanout2"
+	// LayoutFanout1 nests blobs in one level of directories, e.g. 5f/5f56692f...bin
+	LayoutFanout1 = "fanout1"
+	// LayoutFlat stores all blobs in the same directory
+	LayoutFlat = "flat"
+)
+
+// storageLayout maps blob IDs to paths of blob files.
+type storageLayout struct {
+	name  string
+	depth int // Number of directory levels of dirPrefixLength characters
+}
+
+// parseLayout returns the storage layout of the given name, LayoutFanout3 if empty.
+// Returns ErrUnknownLayout if there is no such layout.
+func parseLayout(name string) (storageLayout, error) {
+	if name == "" {
+		name = LayoutFanout3
+	}
+
+	depths := map[string]int{
+		LayoutFanout3: dirPrefixDepth,
+		LayoutFanout2: 2, //nolint:mnd // directory levels
+		LayoutFanout1: 1,
+		LayoutFlat:    0,
+	}
+
+	depth, ok := depths[name]
+	if !ok {
+		return storageLayout{}, fmt.Errorf("%w: %q", ErrUnknownLayout, name)
+	}
+
+	return storageLayout{name: name, depth: depth}, nil
+}
+
+// basename returns the path of the blob file of id below dir without extension.
+// IDs are zero-padded to idMinLength in every layout, so their listed IDs do not depend on the layout.
+func (layout storageLayout) basename(dir string, id domain.BlobID) string {
+	// Pad the id with zeros to the left to make it fit ith the directory structure
+	basename := strings.ReplaceAll(string(id), "/", "")
+	basename = strings.ReplaceAll(fmt.Sprintf("%*s", idMinLength, basename), " ", "0")
+
+	// Split the filename into depth chunks of dirPrefixLength characters
+	// and create a directory structure like this:
+	//   5f/56/69/2f/5f56692f0df9ff68607abdb054943ed86bcee7c9f2a2d01fdcb27032f70f3fe9.bin
+	var prefixes []string
+	for i := 0; i < dirPrefixLength*layout.depth && i < len(basename)-dirPrefixLength; i += dirPrefixLength {
+		prefixes = append(prefixes, basename[i:i+dirPrefixLength])
+	}
+
+	return filepath.Join(append(append([]string{dir}, prefixes...), basename)...)
+}
+
+// dualRead reports whether blobs missing in the configured layout are read from the previous layout.
+func (fsRepo *FileSystemRepository) dualRead() bool {
+	return fsRepo.previous != nil
+}
+
+// getPreviousFilename returns the path of a blob file in the previous layout.
+func (fsRepo *FileSystemRepository) getPreviousFilename(id domain.BlobID) string {
+	return fmt.Sprintf("%s.%s", fsRepo.previous.basename(filepath.Join(fsRepo.cfg.Basedir, fsRepo.subdir), id), fsRepo.ext)
+}
+
+// startMigrationWorkers starts the workers moving blobs queued by scheduleMigration.
+func (fsRepo *FileSystemRepository) startMigrationWorkers(ctx context.Context) {
+	fsRepo.migrations = make(chan domain.BlobID, max(fsRepo.cfg.MigrationQueueSize, 1))
+
+	for range max(fsRepo.cfg.MigrationWorkers, 1) {
+		go func() {
+			for id := range fsRepo.migrations {
+				_, _ = fsRepo.migrateBlob(ctx, id)
+
+				fsRepo.m.Lock()
+				delete(fsRepo.migrating, id)
+				fsRepo.m.Unlock()
+			}
+		}()
+	}
+}
+
+// scheduleMigration queues a blob found in the previous layout to be moved to the configured
+// layout in the background. The caller may hold a lock of the blob, which the migration waits for.
+// Blobs already queued or being migrated are not queued again, and blobs read while the queue is
+// full are not queued at all, so they are moved on a later read.
+func (fsRepo *FileSystemRepository) scheduleMigration(ctx context.Context, id domain.BlobID) {
+	fsRepo.m.Lock()
+	defer fsRepo.m.Unlock()
+
+	if _, ok := fsRepo.migrating[id]; ok {
+		return
+	}
+
+	select {
+	case fsRepo.migrations <- id:
+		fsRepo.migrating[id] = struct{}{}
+	default:
+		fsRepo.log.DebugContext(ctx, "blob migration queue full", logging.Group("blob", "id", id))
+	}
+}
+
+// migrateBlob moves a blob file from the previous layout to the configured layout, holding the
+// exclusive locks of both, so neither replicas reading the configured layout nor replicas still
+// writing the previous layout access the blob meanwhile. If the blob was stored in the configured
+// layout since, the file of the previous layout is outdated and removed.
+// Returns whether a file of the previous layout was moved or removed.
+func (fsRepo *FileSystemRepository) migrateBlob(ctx context.Context, id domain.BlobID) (migrated bool, err error) {
+	filename, previous := fsRepo.GetFilename(id), fsRepo.getPreviousFilename(id)
+	log := fsRepo.log.With(logging.Group("blob", "id", id, "filename", filename, "previous", previous))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "blob migration failed", "error", err)
+		} else if migrated {
+			log.DebugContext(ctx, "blob migrated")
+		}
+	}()
+
+	if filename == previous {
+		return false, nil
+	}
+
+	unlock, err := fsRepo.lock(ctx, filename, true)
+	if err != nil {
+		return false, fmt.Errorf("lock: %w", err)
+	}
+	defer unlock()
+
+	unlockPrevious, err := fsRepo.lock(ctx, previous, true)
+	if err != nil {
+		return false, fmt.Errorf("lock previous: %w", err)
+	}
+	defer unlockPrevious()
+
+	if _, err := os.Stat(previous); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("stat previous: %w", err)
+	}
+
+	if _, err := os.Stat(filename); err == nil {
+		if err := os.Remove(previous); err != nil {
+			return false, fmt.Errorf("remove previous: %w", err)
+		}
+
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return false, fmt.Errorf("mkdir all: %w", err)
+	}
+
+	if err := os.Rename(previous, filename); err != nil {
+		return false, fmt.Errorf("rename: %w", err)
+	}
+
+	return true, nil
+}
+
+// MigrateLayout moves all blobs of the previous layout to the configured layout, e.g. to
+// complete an upgrade before the previous layout is no longer read. Blobs are moved one by one,
+// so the repository stays available meanwhile. Does nothing without a previous layout.
+// Returns the number of migrated blobs.
+func (fsRepo *FileSystemRepository) MigrateLayout(ctx context.Context) (count int, err error) {
+	if !fsRepo.dualRead() {
+		return 0, nil
+	}
+
+	log := fsRepo.log.With(logging.Group("layout", "name", fsRepo.layout.name, "previous", fsRepo.previous.name))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "layout migration failed", "error", err, "count", count)
+		} else {
+			log.InfoContext(ctx, "layout migrated", "count", count)
+		}
+	}()
+
+	// Collect the blobs first, moving files while walking could visit them twice
+	var ids []domain.BlobID
+
+	err = fsRepo.walkBlobs(ctx, func(path string, id domain.BlobID) {
+		if path == fsRepo.getPreviousFilename(id) && path != fsRepo.GetFilename(id) {
+			ids = append(ids, id)
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("walk blobs: %w", err)
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return count, fmt.Errorf("migrate: %w", ctx.Err())
+		}
+
+		migrated, err := fsRepo.migrateBlob(ctx, id)
+		if err != nil {
+			return count, fmt.Errorf("migrate blob %s: %w", id, err)
+		} else if migrated {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,231 @@
+package blob_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+)
+
+func TestFileSystemRepository_Layout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	basedir := t.TempDir()
+
+	newRepo := func(t *testing.T, layout, previous string) *blob.FileSystemRepository {
+		t.Helper()
+
+		repo, err := blob.NewFileSystemBlobRepository(ctx, "layout", "bin", blob.FileSystemBlobRepositoryConfig{
+			Basedir:        basedir,
+			Layout:         layout,
+			PreviousLayout: previous,
+		})
+		if err != nil {
+			t.Fatalf("failed to create repository: %v", err)
+		}
+
+		return repo
+	}
+
+	// Blobs stored before the upgrade
+	before := newRepo(t, blob.LayoutFlat, "")
+	for _, id := range []domain.BlobID{"accessed", "replaced", "deleted", "untouched", "other"} {
+		if err := before.Store(ctx, domain.NewBlob(id, []byte(id))); err != nil {
+			t.Fatalf("Store(%s) error = %v", id, err)
+		}
+	}
+
+	repo := newRepo(t, blob.LayoutFanout3, blob.LayoutFlat)
+
+	if ids, err := repo.List(ctx); err != nil || len(ids) != 5 {
+		t.Fatalf("List() = %v, %v, want 5 blobs", ids, err)
+	}
+
+	// Accessed blobs are read from the previous layout and moved in the background
+	if !repo.Exists(ctx, "accessed") {
+		t.Error("Exists(accessed) = false, want true")
+	}
+
+	if got, err := repo.Fetch(ctx, "accessed"); err != nil || string(got.Body) != "accessed" {
+		t.Fatalf("Fetch(accessed) = %v, %v, want accessed", got, err)
+	}
+
+	waitForFile(t, repo.GetFilename("accessed"))
+
+	if _, err := os.Stat(before.GetFilename("accessed")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("previous file of migrated blob not removed: %v", err)
+	}
+
+	if got, err := repo.Fetch(ctx, "accessed"); err != nil || string(got.Body) != "accessed" {
+		t.Errorf("Fetch(accessed) after migration = %v, %v, want accessed", got, err)
+	}
+
+	// Stored blobs replace their previous file
+	if err := repo.Store(ctx, domain.NewBlob("replaced", []byte("new"))); err != nil {
+		t.Fatalf("Store(replaced) error = %v", err)
+	}
+
+	if before.Exists(ctx, "replaced") {
+		t.Error("previous file of replaced blob not removed")
+	}
+
+	// Deleted blobs are removed from the previous layout
+	if err := repo.Delete(ctx, "deleted"); err != nil {
+		t.Fatalf("Delete(deleted) error = %v", err)
+	}
+
+	if repo.Exists(ctx, "deleted") {
+		t.Error("Exists(deleted) = true, want false")
+	}
+
+	if err := repo.Delete(ctx, "deleted"); err == nil {
+		t.Error("Delete() of missing blob: expected error")
+	}
+
+	if ids, err := repo.List(ctx); err != nil || len(ids) != 4 {
+		t.Errorf("List() = %v, %v, want 4 blobs", ids, err)
+	}
+
+	// The remaining blobs are moved by the migration
+	if count, err := repo.MigrateLayout(ctx); err != nil || count != 2 {
+		t.Fatalf("MigrateLayout() = %d, %v, want 2, nil", count, err)
+	}
+
+	if ids, err := before.List(ctx); err != nil || len(ids) != 4 {
+		t.Fatalf("List() = %v, %v, want 4 blobs", ids, err)
+	}
+
+	after := newRepo(t, blob.LayoutFanout3, "")
+
+	for _, id := range []domain.BlobID{"accessed", "replaced", "untouched", "other"} {
+		if !after.Exists(ctx, id) {
+			t.Errorf("Exists(%s) without previous layout = false, want true", id)
+		}
+
+		if _, err := os.Stat(before.GetFilename(id)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("previous file of %s not removed: %v", id, err)
+		}
+	}
+
+	if ids, err := after.List(ctx); err != nil || !slices.Contains(ids, "untouched") {
+		t.Errorf("List() without previous layout = %v, %v, want untouched", ids, err)
+	}
+}
+
+func TestFileSystemRepository_MigrationQueue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		workers   int
+		queueSize int
+	}{
+		{name: "single slot", workers: 1, queueSize: 1},
+		{name: "small queue", workers: 2, queueSize: 4},
+		{name: "defaults", workers: 0, queueSize: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			basedir := t.TempDir()
+
+			before, err := blob.NewFileSystemBlobRepository(ctx, "queue", "bin", blob.FileSystemBlobRepositoryConfig{
+				Basedir: basedir,
+				Layout:  blob.LayoutFlat,
+			})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			ids := make([]domain.BlobID, 50)
+			for i := range ids {
+				ids[i] = domain.BlobID(fmt.Sprintf("blob%02d", i))
+				if err := before.Store(ctx, domain.NewBlob(ids[i], []byte(ids[i]))); err != nil {
+					t.Fatalf("Store(%s) error = %v", ids[i], err)
+				}
+			}
+
+			repo, err := blob.NewFileSystemBlobRepository(ctx, "queue", "bin", blob.FileSystemBlobRepositoryConfig{
+				Basedir:            basedir,
+				Layout:             blob.LayoutFanout3,
+				PreviousLayout:     blob.LayoutFlat,
+				MigrationWorkers:   tt.workers,
+				MigrationQueueSize: tt.queueSize,
+			})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			// Blobs not queued while the queue is full are moved on a later read
+			deadline := time.Now().Add(5 * time.Second)
+
+			for remaining := ids; len(remaining) > 0; {
+				if time.Now().After(deadline) {
+					t.Fatalf("blobs not migrated: %v", remaining)
+				}
+
+				var next []domain.BlobID
+
+				for _, id := range remaining {
+					if got, err := repo.Fetch(ctx, id); err != nil || string(got.Body) != string(id) {
+						t.Fatalf("Fetch(%s) = %v, %v, want %s", id, got, err, id)
+					}
+
+					if _, err := os.Stat(before.GetFilename(id)); err == nil {
+						next = append(next, id)
+					}
+				}
+
+				remaining = next
+
+				time.Sleep(time.Millisecond)
+			}
+
+			for _, id := range ids {
+				if _, err := os.Stat(repo.GetFilename(id)); err != nil {
+					t.Errorf("blob %s not migrated: %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSystemRepository_UnknownLayout(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []blob.FileSystemBlobRepositoryConfig{
+		{Basedir: t.TempDir(), Layout: "fanout9"},
+		{Basedir: t.TempDir(), Layout: blob.LayoutFanout3, PreviousLayout: "sharded"},
+	} {
+		if _, err := blob.NewFileSystemBlobRepository(context.Background(), "layout", "bin", cfg); !errors.Is(err, blob.ErrUnknownLayout) {
+			t.Errorf("NewFileSystemBlobRepository(%+v) error = %v, want %v", cfg, err, blob.ErrUnknownLayout)
+		}
+	}
+}
+
+// waitForFile waits until the file at path exists, e.g. after a background migration.
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("file %s not created: %v", path, err)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
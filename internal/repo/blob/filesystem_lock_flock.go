@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly || illumos
+
+package blob
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// flockSupported reports whether flockLockFile is supported by the platform.
+const flockSupported = true
+
+// flockLockFile opens and locks the lock file with flock, creating it if necessary.
+// If the lock file was removed or replaced while waiting for the lock, it is opened again,
+// so that the locked file is always the current lock file.
+func flockLockFile(_ context.Context, lockfile string, exclusive bool) (release func(), err error) {
+	mode := syscall.LOCK_SH
+	if exclusive {
+		mode = syscall.LOCK_EX
+	}
+
+	for {
+		file, err := os.OpenFile(lockfile, os.O_CREATE|os.O_RDWR, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+
+		if err := syscall.Flock(int(file.Fd()), mode); err != nil {
+			_ = file.Close()
+
+			return nil, fmt.Errorf("flock: %w", err)
+		}
+
+		locked, errLocked := file.Stat()
+		current, errCurrent := os.Stat(lockfile)
+
+		if errLocked == nil && errCurrent == nil && os.SameFile(locked, current) {
+			return func() {
+				// Only remove the lock file if no one else holds a lock on it.
+				// Waiters still blocked on a removed lock file notice it and retry.
+				if syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) == nil {
+					_ = os.Remove(lockfile)
+				}
+
+				_ = file.Close()
+			}, nil
+		}
+
+		_ = file.Close()
+	}
+}
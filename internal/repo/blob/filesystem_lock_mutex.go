@@ -0,0 +1,95 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	mutexPollMin = time.Millisecond      // Initial delay between attempts to create a held lock file
+	mutexPollMax = 50 * time.Millisecond // Maximum delay between attempts to create a held lock file
+)
+
+// mutexSharedLocks counts the shared locks held by this process by lock file, so shared locks
+// of the same process share the lock file instead of waiting for each other.
+//
+//nolint:gochecknoglobals
+var mutexSharedLocks = struct {
+	sync.Mutex
+	holders map[string]int
+}{holders: make(map[string]int)}
+
+// mutexLockFile locks the lock file by creating it exclusively, which every platform and most
+// network filesystems support, and releases the lock by removing it. While the lock file
+// exists, creation is retried with exponential backoff until the context is done.
+// Shared locks are only shared within this process, and exclusive between processes.
+func mutexLockFile(ctx context.Context, lockfile string, exclusive bool) (release func(), err error) {
+	delay := mutexPollMin
+
+	for {
+		if !exclusive && joinSharedLock(lockfile) {
+			return func() { releaseSharedLock(lockfile) }, nil
+		}
+
+		file, err := os.OpenFile(lockfile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = file.Close()
+
+			if exclusive {
+				return func() { _ = os.Remove(lockfile) }, nil
+			}
+
+			mutexSharedLocks.Lock()
+			mutexSharedLocks.holders[lockfile]++
+			mutexSharedLocks.Unlock()
+
+			return func() { releaseSharedLock(lockfile) }, nil
+		} else if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("create file: %w", err)
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, fmt.Errorf("wait for lock: %w", ctx.Err())
+		case <-timer.C:
+		}
+
+		delay = min(2*delay, mutexPollMax)
+	}
+}
+
+// joinSharedLock joins the shared lock this process holds on the lock file, if any.
+func joinSharedLock(lockfile string) bool {
+	mutexSharedLocks.Lock()
+	defer mutexSharedLocks.Unlock()
+
+	if mutexSharedLocks.holders[lockfile] == 0 {
+		return false
+	}
+
+	mutexSharedLocks.holders[lockfile]++
+
+	return true
+}
+
+// releaseSharedLock releases a shared lock on the lock file, removing it once no shared lock
+// of this process is left.
+func releaseSharedLock(lockfile string) {
+	mutexSharedLocks.Lock()
+	defer mutexSharedLocks.Unlock()
+
+	if mutexSharedLocks.holders[lockfile]--; mutexSharedLocks.holders[lockfile] == 0 {
+		delete(mutexSharedLocks.holders, lockfile)
+
+		_ = os.Remove(lockfile)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly || illumos)
+
+package blob
+
+import (
+	"context"
+	"errors"
+)
+
+// flockSupported reports whether flockLockFile is supported by the platform.
+const flockSupported = false
+
+// errFlockUnsupported is returned by flockLockFile on platforms without flock.
+var errFlockUnsupported = errors.New("flock not supported")
+
+// flockLockFile is not supported by the platform, mutexLockFile is used instead.
+func flockLockFile(context.Context, string, bool) (func(), error) {
+	return nil, errFlockUnsupported
+}
@@ -0,0 +1,102 @@
+package blob_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+)
+
+// TestFileSystemRepository_Lock tests flock and portable locking on any platform.
+// Without flock support, both use portable locking.
+func TestFileSystemRepository_Lock(t *testing.T) {
+	t.Parallel()
+
+	for _, portable := range []bool{false, true} {
+		name := "flock"
+		if portable {
+			name = "portable"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, err := blob.NewFileSystemBlobRepository(context.Background(), "locks", "bin",
+				blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir(), PortableLocking: portable})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+
+			ctx := context.Background()
+			lockfile := repo.GetFilename("lockedblob") + ".lock"
+
+			// Shared locks do not wait for each other
+			unlock1, err := repo.Lock(ctx, "lockedblob", false)
+			if err != nil {
+				t.Fatalf("Lock(shared) error = %v", err)
+			}
+
+			unlock2, err := repo.Lock(ctx, "lockedblob", false)
+			if err != nil {
+				t.Fatalf("second Lock(shared) error = %v", err)
+			}
+
+			unlock1()
+			unlock2()
+
+			if _, err := os.Stat(lockfile); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("lock file not removed after release: %v", err)
+			}
+
+			// Exclusive locks wait for each other
+			unlock, err := repo.Lock(ctx, "lockedblob", true)
+			if err != nil {
+				t.Fatalf("Lock(exclusive) error = %v", err)
+			}
+
+			acquired := make(chan struct{})
+
+			go func() {
+				defer close(acquired)
+
+				if unlock, err := repo.Lock(ctx, "lockedblob", true); err != nil {
+					t.Errorf("second Lock(exclusive) error = %v", err)
+				} else {
+					unlock()
+				}
+			}()
+
+			select {
+			case <-acquired:
+				t.Fatal("Lock(exclusive) acquired while exclusively locked")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			if portable {
+				// Waiting for portable locks ends with the context
+				timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+
+				if _, err := repo.Lock(timeoutCtx, "lockedblob", false); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("Lock() with expired context error = %v, want %v", err, context.DeadlineExceeded)
+				}
+			}
+
+			unlock()
+
+			select {
+			case <-acquired:
+			case <-time.After(time.Second):
+				t.Fatal("Lock(exclusive) not acquired after release")
+			}
+
+			if _, err := os.Stat(lockfile); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("lock file not removed after release: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// Outcomes of traced repository operations.
+const (
+	outcomeOK       = "ok"
+	outcomeNotFound = "not_found"
+	outcomeError    = "error"
+)
+
+// TracingConfig holds configuration for tracing blob repository operations.
+type TracingConfig struct {
+	// Enabled wraps all blob repositories into a TracingRepository.
+	Enabled bool `env:"ENABLED" default:"false"`
+
+	// SlowThreshold is the duration in milliseconds from which operations are logged
+	// as warnings instead of debug messages. 0 disables slow operation warnings.
+	SlowThreshold int64 `env:"SLOW_THRESHOLD" default:"250"`
+}
+
+// TracingRepository wraps a Repository, recording a span, metrics and a log message
+// with duration, blob size and outcome for every operation.
+type TracingRepository struct {
+	Repository
+
+	name          string
+	slowThreshold time.Duration
+	duration      *metrics.HistogramVec
+	bytes         *metrics.CounterVec
+	log           logging.Logger
+}
+
+var _ Repository = (*TracingRepository)(nil)
+
+// TracingRepositoryFactory wraps the repositories created by a factory into
+// TracingRepository, labeled with the repository name. Returns the factory unchanged
+// if tracing is disabled.
+func TracingRepositoryFactory(factory RepositoryFactory, cfg TracingConfig) RepositoryFactory {
+	if !cfg.Enabled {
+		return factory
+	}
+
+	return func(ctx context.Context, name string, ext string) (Repository, error) {
+		repo, err := factory(ctx, name, ext)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewTracingRepository(repo, name, cfg), nil
+	}
+}
+
+// NewTracingRepository wraps a Repository into a TracingRepository labeled with the given name.
+func NewTracingRepository(repo Repository, name string, cfg TracingConfig) *TracingRepository {
+	reg := metrics.Default()
+
+	return &TracingRepository{
+		Repository:    repo,
+		name:          name,
+		slowThreshold: time.Duration(cfg.SlowThreshold) * time.Millisecond,
+		duration: reg.NewHistogramVec(
+			"blob_operation_duration_seconds",
+			"Duration of blob repository operations by repository, operation and outcome.",
+			metrics.DefaultDurationBuckets,
+			"repository", "operation", "outcome",
+		),
+		bytes: reg.NewCounterVec(
+			"blob_operation_bytes_total",
+			"Total bytes of blobs stored and fetched by repository and operation.",
+			"repository", "operation",
+		),
+		log: logging.GetLogger("repo.blob.tracing_repository").With("repository", name),
+	}
+}
+
+// Lock implements Repository.Lock, tracing the time to acquire the lock.
+func (r *TracingRepository) Lock(ctx context.Context, id domain.BlobID, exclusive bool) (func(), error) {
+	ctx, done := r.trace(ctx, "lock", id)
+
+	release, err := r.Repository.Lock(ctx, id, exclusive)
+	done(err, -1, "exclusive", exclusive)
+
+	return release, err //nolint:wrapcheck
+}
+
+// Exists implements Repository.Exists. Missing blobs are traced as "not_found".
+func (r *TracingRepository) Exists(ctx context.Context, id domain.BlobID) bool {
+	ctx, done := r.trace(ctx, "exists", id)
+
+	exists := r.Repository.Exists(ctx, id)
+	if exists {
+		done(nil, -1)
+	} else {
+		done(fs.ErrNotExist, -1)
+	}
+
+	return exists
+}
+
+// Store implements Repository.Store.
+func (r *TracingRepository) Store(ctx context.Context, blob *domain.Blob) error {
+	ctx, done := r.trace(ctx, "store", blob.ID)
+
+	err := r.Repository.Store(ctx, blob)
+	done(err, blob.Size())
+
+	return err //nolint:wrapcheck
+}
+
+// StoreFrom implements Repository.StoreFrom.
+func (r *TracingRepository) StoreFrom(ctx context.Context, id domain.BlobID, reader io.Reader) (int64, error) {
+	ctx, done := r.trace(ctx, "store", id)
+
+	n, err := r.Repository.StoreFrom(ctx, id, reader)
+	done(err, n)
+
+	return n, err //nolint:wrapcheck
+}
+
+// Fetch implements Repository.Fetch.
+func (r *TracingRepository) Fetch(ctx context.Context, id domain.BlobID) (*domain.Blob, error) {
+	ctx, done := r.trace(ctx, "fetch", id)
+
+	blob, err := r.Repository.Fetch(ctx, id)
+	if err != nil {
+		done(err, -1)
+	} else {
+		done(nil, blob.Size())
+	}
+
+	return blob, err //nolint:wrapcheck
+}
+
+// Delete implements Repository.Delete.
+func (r *TracingRepository) Delete(ctx context.Context, id domain.BlobID) error {
+	ctx, done := r.trace(ctx, "delete", id)
+
+	err := r.Repository.Delete(ctx, id)
+	done(err, -1)
+
+	return err //nolint:wrapcheck
+}
+
+// DeleteAll implements Repository.DeleteAll.
+func (r *TracingRepository) DeleteAll(ctx context.Context, id domain.BlobID, pattern string) error {
+	ctx, done := r.trace(ctx, "delete_all", id)
+
+	err := r.Repository.DeleteAll(ctx, id, pattern)
+	done(err, -1, "pattern", pattern)
+
+	return err //nolint:wrapcheck
+}
+
+// List implements Repository.List.
+func (r *TracingRepository) List(ctx context.Context) ([]domain.BlobID, error) {
+	ctx, done := r.trace(ctx, "list", "")
+
+	ids, err := r.Repository.List(ctx)
+	done(err, -1, "count", len(ids))
+
+	return ids, err //nolint:wrapcheck
+}
+
+// trace starts tracing an operation on the blob with the given ID in a child span of ctx,
+// which is logged along with the operation.
+// The returned function records the operation's outcome, the size of the blob if
+// non-negative, and additional log attributes.
+func (r *TracingRepository) trace(
+	ctx context.Context,
+	operation string,
+	id domain.BlobID,
+) (context.Context, func(err error, size int64, attrs ...any)) {
+	ctx, _, _ = context_.WithChildSpan(ctx)
+	start := time.Now()
+
+	return ctx, func(err error, size int64, attrs ...any) {
+		elapsed := time.Since(start)
+		outcome := operationOutcome(err)
+
+		r.duration.With(r.name, operation, outcome).ObserveDuration(start)
+
+		attrs = append(attrs,
+			"operation", operation,
+			"outcome", outcome,
+			"duration", elapsed.String(),
+			logging.Group("blob", "id", id),
+		)
+
+		if size >= 0 {
+			r.bytes.With(r.name, operation).Add(float64(size))
+			attrs = append(attrs, "size", size)
+		}
+
+		switch {
+		case outcome == outcomeError:
+			r.log.WarnContext(ctx, "blob operation failed", append(attrs, "error", err)...)
+		case r.slowThreshold > 0 && elapsed >= r.slowThreshold:
+			r.log.WarnContext(ctx, "blob operation slow", attrs...)
+		default:
+			r.log.DebugContext(ctx, "blob operation", attrs...)
+		}
+	}
+}
+
+// operationOutcome returns the outcome label of an operation that returned err.
+func operationOutcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeOK
+	case errors.Is(err, fs.ErrNotExist):
+		return outcomeNotFound
+	default:
+		return outcomeError
+	}
+}
@@ -0,0 +1,45 @@
+package metaindex
+
+import (
+	"context"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// Index defines the interface for a queryable index of media metadata.
+// The index is derived from the metadata blobs and can be rebuilt from them at any time.
+type Index interface {
+	// Put adds the metadata to the index, replacing any entry with the same ID.
+	Put(ctx context.Context, meta domain.MediaMeta) error
+
+	// Delete removes the entry with the given ID. Deleting a missing entry is not an error.
+	Delete(ctx context.Context, id domain.MediaID) error
+
+	// ListByOwner returns the metadata of all media of the owner, ordered by storage time.
+	ListByOwner(ctx context.Context, owner string) ([]domain.MediaMeta, error)
+
+	// ListPageByOwner returns the metadata of at most limit media of the owner after the given
+	// position, ordered by storage time and ID.
+	ListPageByOwner(ctx context.Context, owner string, after domain.MediaPosition, limit int) ([]domain.MediaMeta, error)
+
+	// FindByHash returns the metadata of the media of the owner with the given content hash,
+	// or whose content had the given hash before it was processed on ingest.
+	FindByHash(ctx context.Context, owner, hash string) ([]domain.MediaMeta, error)
+
+	// ListLocated returns the metadata of all media of the owner with a known location,
+	// ordered by storage time.
+	ListLocated(ctx context.Context, owner string) ([]domain.MediaMeta, error)
+
+	// Count returns the number of indexed media.
+	Count(ctx context.Context) (int64, error)
+
+	// Reset removes all entries from the index.
+	Reset(ctx context.Context) error
+
+	// Close releases any resources held by the index.
+	Close() error
+}
+
+// IndexFactory is a function that creates a new Index instance.
+// Returns an error if initialization fails.
+type IndexFactory func() (Index, error)
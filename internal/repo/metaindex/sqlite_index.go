@@ -0,0 +1,287 @@
+package metaindex
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // Register the sqlite driver
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// SQLiteIndexConfig holds configuration for the SQLite metadata index.
+type SQLiteIndexConfig struct {
+	// DatabasePath is the filesystem path to the SQLite database file.
+	// Default is empty, which disables the index.
+	DatabasePath string `env:"DATABASE_PATH" default:""`
+}
+
+// SQLiteIndex implements Index using SQLite as the storage backend.
+type SQLiteIndex struct {
+	db        *sql.DB
+	log       logging.Logger
+	writeLock *sync.Mutex // go-sqlite does not support concurrent writes
+}
+
+var _ Index = (*SQLiteIndex)(nil)
+
+const selectColumns = "SELECT id, owner, hash, filename, mime_type, size, original_size, original_hash, modified, seq, category, taken_at, latitude, longitude FROM media"
+
+// addedColumns lists the columns added to the media table after its initial schema,
+// which are added to existing databases on startup.
+//
+//nolint:gochecknoglobals
+var addedColumns = []struct{ name, definition string }{
+	{"category", "TEXT NOT NULL DEFAULT ''"},
+	{"taken_at", "TEXT NOT NULL DEFAULT ''"},
+	{"latitude", "REAL"},
+	{"longitude", "REAL"},
+	{"original_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"seq", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// SQLiteIndexFactory creates a factory function that returns a new SQLiteIndex.
+// The factory function implements the IndexFactory type.
+func SQLiteIndexFactory(cfg SQLiteIndexConfig) IndexFactory {
+	return func() (Index, error) {
+		return NewSQLiteIndex(cfg)
+	}
+}
+
+// NewSQLiteIndex creates a new SQLiteIndex with the given configuration.
+// It initializes the database connection and creates the schema if needed.
+// Returns an error if database connection or initialization fails.
+func NewSQLiteIndex(cfg SQLiteIndexConfig) (*SQLiteIndex, error) {
+	log := logging.GetLogger("repo.metaindex.sqlite_index").With(
+		logging.Group("db", "path", cfg.DatabasePath),
+	)
+
+	db, err := sql.Open("sqlite", cfg.DatabasePath)
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	if err := initializeDB(db); err != nil {
+		return nil, fmt.Errorf("initialize db: %w", err)
+	}
+
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		return nil, fmt.Errorf("set busy timeout: %w", err)
+	}
+
+	return &SQLiteIndex{
+		db:        db,
+		log:       log,
+		writeLock: new(sync.Mutex),
+	}, nil
+}
+
+func initializeDB(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS media (
+			id            TEXT    PRIMARY KEY,
+			owner         TEXT    NOT NULL,
+			hash          TEXT    NOT NULL,
+			filename      TEXT    NOT NULL,
+			mime_type     TEXT    NOT NULL,
+			size          INTEGER NOT NULL,
+			original_size INTEGER NOT NULL,
+			modified      INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS media_owner_modified ON media (owner, modified);
+		CREATE INDEX IF NOT EXISTS media_hash ON media (hash);
+	`); err != nil {
+		return fmt.Errorf("create schema: %w", err)
+	}
+
+	if err := addColumns(db); err != nil {
+		return fmt.Errorf("migrate schema: %w", err)
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS media_original_hash ON media (original_hash)"); err != nil {
+		return fmt.Errorf("create original hash index: %w", err)
+	}
+
+	return nil
+}
+
+// addColumns adds all missing addedColumns to the media table.
+func addColumns(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('media')")
+	if err != nil {
+		return fmt.Errorf("query columns: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("scan column: %w", err)
+		}
+
+		existing[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate columns: %w", err)
+	}
+
+	for _, column := range addedColumns {
+		if existing[column.name] {
+			continue
+		}
+
+		if _, err := db.Exec("ALTER TABLE media ADD COLUMN " + column.name + " " + column.definition); err != nil {
+			return fmt.Errorf("add column %s: %w", column.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Put implements Index.Put using SQLite.
+func (idx *SQLiteIndex) Put(ctx context.Context, meta domain.MediaMeta) error {
+	var latitude, longitude sql.NullFloat64
+	if meta.Location != nil {
+		latitude = sql.NullFloat64{Float64: meta.Location.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: meta.Location.Longitude, Valid: true}
+	}
+
+	idx.writeLock.Lock()
+	defer idx.writeLock.Unlock()
+
+	if _, err := idx.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO media (id, owner, hash, filename, mime_type, size, original_size, original_hash,
+			modified, seq, category, taken_at, latitude, longitude)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		meta.ID.String(), meta.Owner, meta.Hash, meta.Filename, meta.MIMEType,
+		meta.Size, meta.OriginalSize, meta.OriginalHash, meta.Modified, meta.Seq, meta.Category,
+		meta.TakenAt, latitude, longitude,
+	); err != nil {
+		return fmt.Errorf("insert media: %w", err)
+	}
+
+	return nil
+}
+
+// Delete implements Index.Delete using SQLite.
+func (idx *SQLiteIndex) Delete(ctx context.Context, id domain.MediaID) error {
+	idx.writeLock.Lock()
+	defer idx.writeLock.Unlock()
+
+	if _, err := idx.db.ExecContext(ctx, "DELETE FROM media WHERE id = ?", id.String()); err != nil {
+		return fmt.Errorf("delete media: %w", err)
+	}
+
+	return nil
+}
+
+// ListByOwner implements Index.ListByOwner using SQLite.
+func (idx *SQLiteIndex) ListByOwner(ctx context.Context, owner string) ([]domain.MediaMeta, error) {
+	return idx.query(ctx, selectColumns+" WHERE owner = ? ORDER BY modified, id", owner)
+}
+
+// ListPageByOwner implements Index.ListPageByOwner using SQLite.
+func (idx *SQLiteIndex) ListPageByOwner(
+	ctx context.Context,
+	owner string,
+	after domain.MediaPosition,
+	limit int,
+) ([]domain.MediaMeta, error) {
+	return idx.query(ctx, selectColumns+
+		" WHERE owner = ? AND (modified > ? OR (modified = ? AND id > ?)) ORDER BY modified, id LIMIT ?",
+		owner, after.Modified, after.Modified, string(after.ID), limit)
+}
+
+// FindByHash implements Index.FindByHash using SQLite.
+func (idx *SQLiteIndex) FindByHash(ctx context.Context, owner, hash string) ([]domain.MediaMeta, error) {
+	return idx.query(ctx, selectColumns+" WHERE owner = ? AND (hash = ? OR original_hash = ?) ORDER BY modified, id",
+		owner, hash, hash)
+}
+
+// ListLocated implements Index.ListLocated using SQLite.
+func (idx *SQLiteIndex) ListLocated(ctx context.Context, owner string) ([]domain.MediaMeta, error) {
+	return idx.query(ctx, selectColumns+
+		" WHERE owner = ? AND latitude IS NOT NULL AND longitude IS NOT NULL ORDER BY modified, id", owner)
+}
+
+// Count implements Index.Count using SQLite.
+func (idx *SQLiteIndex) Count(ctx context.Context) (int64, error) {
+	var count int64
+
+	if err := idx.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM media").Scan(&count); err != nil {
+		return 0, fmt.Errorf("count media: %w", err)
+	}
+
+	return count, nil
+}
+
+// Reset implements Index.Reset using SQLite.
+func (idx *SQLiteIndex) Reset(ctx context.Context) error {
+	idx.writeLock.Lock()
+	defer idx.writeLock.Unlock()
+
+	if _, err := idx.db.ExecContext(ctx, "DELETE FROM media"); err != nil {
+		return fmt.Errorf("delete media: %w", err)
+	}
+
+	return nil
+}
+
+// Close implements Index.Close by closing the database connection.
+func (idx *SQLiteIndex) Close() error {
+	if err := idx.db.Close(); err != nil {
+		return fmt.Errorf("close db: %w", err)
+	}
+
+	return nil
+}
+
+func (idx *SQLiteIndex) query(ctx context.Context, query string, args ...any) ([]domain.MediaMeta, error) {
+	rows, err := idx.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query media: %w", err)
+	}
+	defer rows.Close()
+
+	var metas []domain.MediaMeta
+
+	for rows.Next() {
+		var (
+			meta                domain.MediaMeta
+			id                  string
+			latitude, longitude sql.NullFloat64
+		)
+
+		if err := rows.Scan(&id, &meta.Owner, &meta.Hash, &meta.Filename, &meta.MIMEType,
+			&meta.Size, &meta.OriginalSize, &meta.OriginalHash, &meta.Modified, &meta.Seq, &meta.Category,
+			&meta.TakenAt, &latitude, &longitude); err != nil {
+			return nil, fmt.Errorf("scan media: %w", err)
+		}
+
+		meta.ID = domain.MediaID(id)
+
+		if latitude.Valid && longitude.Valid {
+			meta.Location = &domain.MediaLocation{Latitude: latitude.Float64, Longitude: longitude.Float64}
+		}
+		metas = append(metas, meta)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate media: %w", err)
+	}
+
+	return metas, nil
+}
@@ -0,0 +1,95 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStoreSweepSize is the number of counters above which expired counters are swept.
+const memoryStoreSweepSize = 1024
+
+// MemoryStore implements Store in memory. Counters are local to the process and lost on restart.
+type MemoryStore struct {
+	prefix   string
+	counters map[string]memoryCounter
+	m        sync.Mutex
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new MemoryStore prefixing all keys by prefix.
+func NewMemoryStore(prefix string) *MemoryStore {
+	return &MemoryStore{
+		prefix:   prefix,
+		counters: make(map[string]memoryCounter),
+		m:        sync.Mutex{},
+	}
+}
+
+// Incr implements Store.Incr.
+func (s *MemoryStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	key = s.prefix + key
+
+	counter, ok := s.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		if len(s.counters) >= memoryStoreSweepSize {
+			s.sweep(now)
+		}
+
+		counter = memoryCounter{count: 0, expiresAt: now.Add(ttl)}
+	}
+
+	counter.count++
+	s.counters[key] = counter
+
+	return counter.count, counter.expiresAt.Sub(now), nil
+}
+
+// Get implements Store.Get.
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, time.Duration, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+
+	counter, ok := s.counters[s.prefix+key]
+	if !ok || !now.Before(counter.expiresAt) {
+		return 0, 0, nil
+	}
+
+	return counter.count, counter.expiresAt.Sub(now), nil
+}
+
+// Reset implements Store.Reset.
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.counters, s.prefix+key)
+
+	return nil
+}
+
+// Close implements Store.Close.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sweep removes expired counters. The caller must hold the lock.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, counter := range s.counters {
+		if !now.Before(counter.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package throttle
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRedis is returned when Redis replies with an error or an unexpected reply.
+var ErrRedis = errors.New("redis error")
+
+// redisIncrScript increments a counter, sets its expiry if it is new, and returns the count
+// and the remaining time to live in milliseconds.
+const redisIncrScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return {n, redis.call('PTTL', KEYS[1])}`
+
+// redisGetScript returns the count and the remaining time to live in milliseconds of a counter.
+const redisGetScript = `return {tonumber(redis.call('GET', KEYS[1]) or '0'), redis.call('PTTL', KEYS[1])}`
+
+// RedisStore implements Store using Redis, so counters are shared between replicas
+// and survive restarts. It speaks the Redis protocol (RESP) over a single connection,
+// which is re-established after errors.
+type RedisStore struct {
+	cfg  Config
+	conn net.Conn
+	rd   *bufio.Reader
+	m    sync.Mutex
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a new RedisStore. The connection is established on first use.
+func NewRedisStore(cfg Config) *RedisStore {
+	return &RedisStore{
+		cfg:  cfg,
+		conn: nil,
+		rd:   nil,
+		m:    sync.Mutex{},
+	}
+}
+
+// Incr implements Store.Incr.
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return s.eval(ctx, redisIncrScript, key, strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+}
+
+// Get implements Store.Get.
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	return s.eval(ctx, redisGetScript, key)
+}
+
+// Reset implements Store.Reset.
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	if _, err := s.do(ctx, "DEL", s.cfg.KeyPrefix+key); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+
+	return nil
+}
+
+// Close implements Store.Close.
+func (s *RedisStore) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.disconnect()
+}
+
+// eval runs a script returning a count and a time to live in milliseconds.
+func (s *RedisStore) eval(ctx context.Context, script, key string, args ...string) (int64, time.Duration, error) {
+	reply, err := s.do(ctx, append([]string{"EVAL", script, "1", s.cfg.KeyPrefix + key}, args...)...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("eval: %w", err)
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("%w: unexpected reply %v", ErrRedis, reply)
+	}
+
+	count, countOK := values[0].(int64)
+	ttl, ttlOK := values[1].(int64)
+
+	if !countOK || !ttlOK {
+		return 0, 0, fmt.Errorf("%w: unexpected reply %v", ErrRedis, reply)
+	}
+
+	// PTTL is negative if the key does not exist or has no expiry
+	if count == 0 || ttl < 0 {
+		return count, 0, nil
+	}
+
+	return count, time.Duration(ttl) * time.Millisecond, nil
+}
+
+// do sends a command and reads its reply. The connection is dropped after errors.
+func (s *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.connect(ctx); err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	reply, err := s.roundTrip(ctx, args...)
+	if err != nil {
+		// The connection may hold unread replies, so it is not reused
+		_ = s.disconnect()
+	}
+
+	return reply, err
+}
+
+// connect establishes the connection, authenticates and selects the database, if not connected.
+// The caller must hold the lock.
+func (s *RedisStore) connect(ctx context.Context) error {
+	if s.conn != nil {
+		return nil
+	}
+
+	dialer := net.Dialer{Timeout: s.timeout()}
+
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.RedisAddr)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+
+	s.conn, s.rd = conn, bufio.NewReader(conn)
+
+	if s.cfg.RedisPassword != "" {
+		if _, err := s.roundTrip(ctx, "AUTH", s.cfg.RedisPassword); err != nil {
+			_ = s.disconnect()
+
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if s.cfg.RedisDB != 0 {
+		if _, err := s.roundTrip(ctx, "SELECT", strconv.Itoa(s.cfg.RedisDB)); err != nil {
+			_ = s.disconnect()
+
+			return fmt.Errorf("select: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// disconnect closes the connection, if any. The caller must hold the lock.
+func (s *RedisStore) disconnect() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn, s.rd = nil, nil
+
+	if err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	return nil
+}
+
+// roundTrip writes a command as RESP array of bulk strings and reads the reply.
+// The caller must hold the lock.
+func (s *RedisStore) roundTrip(ctx context.Context, args ...string) (any, error) {
+	deadline := time.Now().Add(s.timeout())
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("set deadline: %w", err)
+	}
+
+	cmd := make([]byte, 0, 64)
+	cmd = fmt.Appendf(cmd, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		cmd = fmt.Appendf(cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := s.conn.Write(cmd); err != nil {
+		return nil, fmt.Errorf("write: %w", err)
+	}
+
+	return readReply(s.rd)
+}
+
+func (s *RedisStore) timeout() time.Duration {
+	return time.Duration(max(s.cfg.RedisTimeout, 1)) * time.Millisecond
+}
+
+// readReply reads a RESP reply. Simple strings are returned as string, integers as int64,
+// bulk strings as string or nil, and arrays as []any. Error replies are returned as ErrRedis.
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: malformed reply %q", ErrRedis, line)
+	}
+
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, fmt.Errorf("%w: %s", ErrRedis, payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed integer %q", ErrRedis, payload)
+		}
+
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed bulk length %q", ErrRedis, payload)
+		} else if size < 0 {
+			return nil, nil //nolint:nilnil
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed array length %q", ErrRedis, payload)
+		} else if size < 0 {
+			return nil, nil //nolint:nilnil
+		}
+
+		values := make([]any, 0, size)
+
+		for range size {
+			value, err := readReply(rd)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, value)
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown reply type %q", ErrRedis, kind)
+	}
+}
@@ -0,0 +1,69 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// StoreMemory selects the in-memory store, which is local to the process.
+	StoreMemory = "memory"
+	// StoreRedis selects the Redis store, which is shared between replicas and survives restarts.
+	StoreRedis = "redis"
+)
+
+// ErrUnknownStore is returned when the configured store does not exist.
+var ErrUnknownStore = errors.New("unknown throttle store")
+
+// Config holds configuration for the throttle store.
+type Config struct {
+	// Store is the backend of the throttle state ("memory" or "redis")
+	Store string `env:"STORE" default:"memory"`
+
+	// KeyPrefix is prepended to all keys, to share a Redis database with other applications
+	KeyPrefix string `env:"KEY_PREFIX" default:"throttle:"`
+
+	// RedisAddr is the address of the Redis server
+	RedisAddr string `env:"REDIS_ADDR" default:"localhost:6379"`
+
+	// RedisPassword is the password of the Redis server, empty if not required
+	RedisPassword string `env:"REDIS_PASSWORD" default:""`
+
+	// RedisDB is the number of the Redis database
+	RedisDB int `env:"REDIS_DB" default:"0"`
+
+	// RedisTimeout is the timeout of Redis commands in milliseconds
+	RedisTimeout int64 `env:"REDIS_TIMEOUT" default:"1000"`
+}
+
+// Store holds expiring counters, e.g. of failed logins, for throttling and lockouts.
+type Store interface {
+	// Incr increments the counter of key. A new counter expires after ttl; incrementing
+	// does not extend the expiry. Returns the new count and the remaining time to live.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error)
+
+	// Get returns the count and the remaining time to live of the counter of key,
+	// or 0 and 0 if the counter does not exist or has expired.
+	Get(ctx context.Context, key string) (int64, time.Duration, error)
+
+	// Reset deletes the counter of key.
+	Reset(ctx context.Context, key string) error
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// NewStore creates the store selected by the configuration.
+// Returns ErrUnknownStore if the configured store does not exist.
+func NewStore(cfg Config) (Store, error) {
+	switch cfg.Store {
+	case StoreMemory:
+		return NewMemoryStore(cfg.KeyPrefix), nil
+	case StoreRedis:
+		return NewRedisStore(cfg), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStore, cfg.Store)
+	}
+}
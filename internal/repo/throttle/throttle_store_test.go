@@ -0,0 +1,193 @@
+package throttle_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
+)
+
+// fakeRedis serves the subset of Redis commands used by RedisStore from memory.
+type fakeRedis struct {
+	counters map[string]int64
+	expiry   map[string]time.Time
+	m        sync.Mutex
+}
+
+func startFakeRedis(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	fake := &fakeRedis{counters: make(map[string]int64), expiry: make(map[string]time.Time)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go fake.serve(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	rd := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+
+		if _, err := io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	switch {
+	case args[0] == "DEL":
+		delete(f.counters, args[1])
+
+		return ":1\r\n"
+	case args[0] == "EVAL" && strings.Contains(args[1], "INCR"):
+		key := args[3]
+		if exp, ok := f.expiry[key]; ok && !time.Now().Before(exp) {
+			delete(f.counters, key)
+		}
+
+		f.counters[key]++
+		if f.counters[key] == 1 {
+			ttl, _ := strconv.ParseInt(args[4], 10, 64)
+			f.expiry[key] = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+
+		return fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", f.counters[key], time.Until(f.expiry[key]).Milliseconds())
+	case args[0] == "EVAL":
+		key := args[3]
+		if _, ok := f.counters[key]; !ok {
+			return "*2\r\n:0\r\n:-2\r\n"
+		}
+
+		return fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", f.counters[key], time.Until(f.expiry[key]).Milliseconds())
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(rd, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(rd, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		store func(t *testing.T) throttle.Store
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) throttle.Store {
+				return throttle.NewMemoryStore("test:")
+			},
+		},
+		{
+			name: "redis",
+			store: func(t *testing.T) throttle.Store {
+				return throttle.NewRedisStore(throttle.Config{
+					KeyPrefix:    "test:",
+					RedisAddr:    startFakeRedis(t),
+					RedisTimeout: 1000,
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			store := tt.store(t)
+			t.Cleanup(func() { _ = store.Close() })
+
+			if count, ttl, err := store.Get(ctx, "user"); err != nil || count != 0 || ttl != 0 {
+				t.Fatalf("Get() of missing key = %d, %v, %v, want 0, 0, nil", count, ttl, err)
+			}
+
+			for want := int64(1); want <= 3; want++ {
+				count, ttl, err := store.Incr(ctx, "user", time.Minute)
+				if err != nil || count != want || ttl <= 0 || ttl > time.Minute {
+					t.Fatalf("Incr() = %d, %v, %v, want %d within a minute", count, ttl, err, want)
+				}
+			}
+
+			if count, _, err := store.Get(ctx, "user"); err != nil || count != 3 {
+				t.Fatalf("Get() = %d, %v, want 3", count, err)
+			}
+
+			if err := store.Reset(ctx, "user"); err != nil {
+				t.Fatalf("Reset() error = %v", err)
+			}
+
+			if count, _, err := store.Get(ctx, "user"); err != nil || count != 0 {
+				t.Fatalf("Get() after Reset() = %d, %v, want 0", count, err)
+			}
+
+			// Counters expire after their ttl
+			if _, _, err := store.Incr(ctx, "short", 10*time.Millisecond); err != nil {
+				t.Fatalf("Incr() error = %v", err)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+
+			if count, _, err := store.Incr(ctx, "short", time.Minute); err != nil || count != 1 {
+				t.Errorf("Incr() after expiry = %d, %v, want 1", count, err)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +22,8 @@ type SQLiteUserRepositoryConfig struct {
 	DatabasePath string `env:"DATABASE_PATH" default:"var/storage/authsvc.db"`
 }
 
+const selectUserColumns = "SELECT id, username, password_hash, created_at, last_login_at, expired_at, roles FROM users"
+
 // SQLiteUserRepository implements Repository using SQLite as the storage backend.
 type SQLiteUserRepository struct {
 	db        *sql.DB
@@ -72,18 +75,68 @@ func NewSQLiteUserRepository(cfg SQLiteUserRepositoryConfig) (*SQLiteUserReposit
 	}, nil
 }
 
+// ProbeSQLiteDatabase checks whether the SQLite database can be opened.
+func ProbeSQLiteDatabase(ctx context.Context, cfg SQLiteUserRepositoryConfig) error {
+	db, err := sql.Open("sqlite", cfg.DatabasePath)
+	if err != nil {
+		return fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping db: %w", err)
+	}
+
+	return nil
+}
+
 func initializeDB(db *sql.DB) (err error) {
 	if _, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS users (
 			id            INTEGER PRIMARY KEY AUTOINCREMENT,
 			username      TEXT    UNIQUE NOT NULL,
 			password_hash BLOB    NOT NULL,
-			created_at    INTEGER NOT NULL
+			created_at    INTEGER NOT NULL,
+			last_login_at INTEGER NOT NULL DEFAULT 0,
+			expired_at    INTEGER NOT NULL DEFAULT 0,
+			roles         TEXT    NOT NULL DEFAULT ''
 		)
 	`); err != nil {
 		return fmt.Errorf("create schema: %w", err)
 	}
 
+	// Migrate databases created before the columns were added
+	for _, column := range []string{"last_login_at", "expired_at"} {
+		if err := addColumnIfMissing(db, "users", column, "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return fmt.Errorf("migrate schema: %w", err)
+		}
+	}
+
+	if err := addColumnIfMissing(db, "users", "roles", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("migrate schema: %w", err)
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var exists bool
+
+	if err := db.QueryRow(
+		"SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&exists); err != nil {
+		return fmt.Errorf("query columns: %w", err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add column %s: %w", column, err)
+	}
+
 	return nil
 }
 
@@ -119,12 +172,7 @@ func (r *SQLiteUserRepository) CreateUser(ctx context.Context, username string,
 
 // GetUserByUsername implements Repository.GetUserByUsername using SQLite.
 func (r *SQLiteUserRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, bool, error) {
-	var user domain.User
-
-	err := r.db.QueryRow(
-		"SELECT id, username, password_hash, created_at FROM users WHERE username = ?",
-		username,
-	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	user, err := scanUser(r.db.QueryRow(selectUserColumns+" WHERE username = ?", username))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = errors.Join(domain.ErrUserNotFound, err)
@@ -136,6 +184,92 @@ func (r *SQLiteUserRepository) GetUserByUsername(ctx context.Context, username s
 	return &user, true, nil
 }
 
+// SetRoles implements Repository.SetRoles using SQLite.
+// Roles are stored as comma-separated list.
+func (r *SQLiteUserRepository) SetRoles(ctx context.Context, username string, roles []string) error {
+	return r.updateUser(ctx, "UPDATE users SET roles = ? WHERE username = ?", strings.Join(roles, ","), username)
+}
+
+// UpdatePasswordHash implements Repository.UpdatePasswordHash using SQLite.
+func (r *SQLiteUserRepository) UpdatePasswordHash(ctx context.Context, username string, passwordHash []byte) error {
+	return r.updateUser(ctx, "UPDATE users SET password_hash = ? WHERE username = ?", passwordHash, username)
+}
+
+// RecordLogin implements Repository.RecordLogin using SQLite.
+func (r *SQLiteUserRepository) RecordLogin(ctx context.Context, username string, at int64) error {
+	return r.updateUser(ctx, "UPDATE users SET last_login_at = ? WHERE username = ?", at, username)
+}
+
+// ExpireUser implements Repository.ExpireUser using SQLite.
+func (r *SQLiteUserRepository) ExpireUser(ctx context.Context, username string, at int64) error {
+	return r.updateUser(ctx, "UPDATE users SET expired_at = ? WHERE username = ?", at, username)
+}
+
+// ListUsers implements Repository.ListUsers using SQLite.
+func (r *SQLiteUserRepository) ListUsers(ctx context.Context) ([]domain.User, error) {
+	rows, err := r.db.QueryContext(ctx, selectUserColumns+" ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []domain.User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// scanUser scans a row of selectUserColumns into a user.
+func scanUser(row interface{ Scan(dest ...any) error }) (domain.User, error) {
+	var (
+		user  domain.User
+		roles string
+	)
+
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt,
+		&user.LastLoginAt, &user.ExpiredAt, &roles); err != nil {
+		return domain.User{}, err //nolint:wrapcheck
+	}
+
+	if roles != "" {
+		user.Roles = strings.Split(roles, ",")
+	}
+
+	return user, nil
+}
+
+// updateUser executes an update of a single user.
+// Returns ErrUserNotFound if no user was updated.
+func (r *SQLiteUserRepository) updateUser(ctx context.Context, query string, args ...any) error {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("update user: %w", domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
 // Close implements Repository.Close by closing the database connection.
 func (r *SQLiteUserRepository) Close() error {
 	if err := r.db.Close(); err != nil {
@@ -17,6 +17,25 @@ type Repository interface {
 	// Returns an error if the operation fails.
 	GetUserByUsername(ctx context.Context, username string) (*domain.User, bool, error)
 
+	// UpdatePasswordHash replaces the password hash of a user.
+	// Returns ErrUserNotFound if the user does not exist.
+	UpdatePasswordHash(ctx context.Context, username string, passwordHash []byte) error
+
+	// ListUsers returns all users, ordered by ID.
+	ListUsers(ctx context.Context) ([]domain.User, error)
+
+	// RecordLogin sets the time of the last successful login of a user.
+	// Returns ErrUserNotFound if the user does not exist.
+	RecordLogin(ctx context.Context, username string, at int64) error
+
+	// SetRoles replaces the roles of a user.
+	// Returns ErrUserNotFound if the user does not exist.
+	SetRoles(ctx context.Context, username string, roles []string) error
+
+	// ExpireUser marks the account of a user as expired, which prevents logging in.
+	// Returns ErrUserNotFound if the user does not exist.
+	ExpireUser(ctx context.Context, username string, at int64) error
+
 	// Close releases any resources held by the repository.
 	// Returns an error if cleanup fails.
 	Close() error
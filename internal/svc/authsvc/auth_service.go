@@ -2,20 +2,21 @@ package authsvc
 
 import (
 	"context"
-	"crypto"
-	"crypto/hmac"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
 	"github.com/mkrupp/homecase-michael/internal/repo/user"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
 )
 
 // AuthConfig contains configuration parameters for the authentication service.
@@ -25,42 +26,154 @@ type AuthConfig struct {
 
 	// TokenDuration is the validity duration of auth tokens in seconds
 	TokenDuration int64 `env:"TOKEN_DURATION" default:"3600"` // 1h
+
+	// RememberTokenDuration is the validity duration in seconds of tokens issued for persistent
+	// "remember me" sessions, which carry the "remember" claim. 0 disables them, issuing regular tokens.
+	RememberTokenDuration int64 `env:"REMEMBER_TOKEN_DURATION" default:"2592000"` // 30d
+
+	// Issuer is the base URL of the auth service, set as "iss" claim of tokens and in the
+	// OIDC discovery document. If empty, tokens have no issuer and the discovery document
+	// derives it from the request.
+	Issuer string `env:"ISSUER" default:""`
+
+	// TokenMaxLifetime is the maximum lifetime in seconds of a session: tokens are renewed by
+	// POST /auth/renew until TokenMaxLifetime after the login, then users have to log in again.
+	// 0 disables the renewal.
+	TokenMaxLifetime int64 `env:"TOKEN_MAX_LIFETIME" default:"86400"` // 24h
+
+	// TokenLeeway is the clock skew in seconds tolerated between the issuer and validators of tokens:
+	// tokens are accepted until TokenLeeway after they expire, and from TokenLeeway before they are issued
+	TokenLeeway int64 `env:"TOKEN_LEEWAY" default:"30"`
+
+	// AcceptLegacyTokens enables accepting tokens of the format predating JWTs during the migration
+	AcceptLegacyTokens bool `env:"ACCEPT_LEGACY_TOKENS" default:"false"`
+
+	// PasswordHasher is the algorithm used to hash passwords ("argon2id" or "bcrypt").
+	// Existing hashes of other algorithms or parameters are replaced on login.
+	PasswordHasher string `env:"PASSWORD_HASHER" default:"argon2id"`
+
+	// Argon2Time is the number of passes over the memory of argon2id
+	Argon2Time int `env:"ARGON2_TIME" default:"1"`
+
+	// Argon2Memory is the memory of argon2id in KiB
+	Argon2Memory int `env:"ARGON2_MEMORY" default:"65536"` // 64MiB
+
+	// Argon2Threads is the degree of parallelism of argon2id
+	Argon2Threads int `env:"ARGON2_THREADS" default:"4"`
+
+	// BcryptCost is the cost factor of bcrypt
+	BcryptCost int `env:"BCRYPT_COST" default:"10"`
+
+	// LoginMaxFailures is the number of failed logins after which an account is locked, 0 to disable
+	LoginMaxFailures int `env:"LOGIN_MAX_FAILURES" default:"5"`
+
+	// LoginLockoutDuration is the duration in seconds failed logins are counted and an account is locked
+	LoginLockoutDuration int64 `env:"LOGIN_LOCKOUT_DURATION" default:"900"` // 15m
+
+	// AnomalyWindow is the duration in seconds failed logins are counted per user and client IP
+	// to detect brute-force attacks
+	AnomalyWindow int64 `env:"ANOMALY_WINDOW" default:"300"` // 5m
+
+	// AnomalyFailuresPerUser is the number of failed logins of a user within AnomalyWindow
+	// logged and counted as login anomaly, 0 to disable
+	AnomalyFailuresPerUser int `env:"ANOMALY_FAILURES_PER_USER" default:"20"`
+
+	// AnomalyFailuresPerIP is the number of failed logins from a client IP within AnomalyWindow
+	// logged and counted as login anomaly, 0 to disable
+	AnomalyFailuresPerIP int `env:"ANOMALY_FAILURES_PER_IP" default:"50"`
+
+	// RateLimitPerIP is the number of login and register requests per minute allowed from
+	// a client IP address, 0 to disable
+	RateLimitPerIP int `env:"RATE_LIMIT_PER_IP" default:"30"`
+
+	// RateLimitPerUsername is the number of login and register requests per minute allowed
+	// for a username, 0 to disable
+	RateLimitPerUsername int `env:"RATE_LIMIT_PER_USERNAME" default:"10"`
+
+	// Audience is the comma-separated list of services issued tokens are intended for, set as
+	// "aud" claim. If empty, tokens have no audience and are accepted by any service.
+	Audience string `env:"AUDIENCE" default:""`
+
+	// Scopes is the comma-separated list of scopes users may request at login, set as "scope"
+	// claim of their tokens. If empty, no scopes can be requested.
+	Scopes string `env:"SCOPES" default:""`
+
+	// Backend is the backend checking the credentials of logins ("local" or "ldap").
+	// Users authenticated by LDAP are provisioned an account without password on their first login.
+	Backend string `env:"BACKEND" default:"local"`
+
+	// LDAP configures the LDAP server of the "ldap" backend
+	LDAP LDAPConfig `envPrefix:"LDAP_"`
 }
 
+// FlagJWTTokens toggles issuing tokens as JWTs. Tenants with the flag disabled are issued
+// tokens in the legacy format, which are accepted from them regardless of AcceptLegacyTokens.
+//
+//nolint:gochecknoglobals
+var FlagJWTTokens = featureflags.Flag{Name: "jwt_tokens", Default: true}
+
 // AuthService provides authentication and user management functionality.
 // It handles user registration, login, and token validation.
 type AuthService struct {
-	Config     AuthConfig
-	UserRepo   user.Repository
-	Log        logging.Logger
-	SigningKey *rsa.PrivateKey
+	Config      AuthConfig
+	UserRepo    user.Repository
+	Throttle    throttle.Store
+	Flags       *featureflags.Store
+	Hasher      PasswordHasher
+	Log         logging.Logger
+	SigningKey  *rsa.PrivateKey
+	Clock       clock.Clock
+	Credentials CredentialVerifier // Checks the credentials of logins, a PasswordVerifier using Hasher if nil
+	Metrics     LoginMetrics       // Records logins and login anomalies, if set
 }
 
-// NewAuthService creates a new AuthService with the given user repository factory and configuration.
-// Returns an error if the signing key cannot be loaded or the user repository cannot be created.
-func NewAuthService(repoFactory user.RepositoryFactory, cfg AuthConfig) (*AuthService, error) {
+// NewAuthService creates a new AuthService with the given user repository factory, throttle store
+// for the login lockout, and configuration.
+// Returns an error if the signing key cannot be loaded, the password hasher or auth backend
+// is unknown or the user repository cannot be created.
+func NewAuthService(
+	repoFactory user.RepositoryFactory,
+	throttleStore throttle.Store,
+	cfg AuthConfig,
+) (*AuthService, error) {
 	log := logging.GetLogger("svc.authsvc.auth_service")
 
+	hasher, err := NewPasswordHasher(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new password hasher: %w", err)
+	}
+
 	signingKey, err := GetPrivateKey(cfg.SigningKeyFile)
 	if err != nil {
 		return nil, fmt.Errorf("get private key: %w", err)
 	}
 
+	credentials, err := NewCredentialVerifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new credential verifier: %w", err)
+	}
+
 	userRepo, err := repoFactory()
 	if err != nil {
 		return nil, fmt.Errorf("new user repo: %w", err)
 	}
 
 	return &AuthService{
-		Config:     cfg,
-		UserRepo:   userRepo,
-		Log:        log,
-		SigningKey: signingKey,
+		Config:      cfg,
+		UserRepo:    userRepo,
+		Throttle:    throttleStore,
+		Flags:       nil,
+		Hasher:      hasher,
+		Log:         log,
+		SigningKey:  signingKey,
+		Clock:       clock.Real{},
+		Credentials: credentials,
+		Metrics:     NewLoginMetrics(metrics.Default()),
 	}, nil
 }
 
 // RegisterUser creates a new user account with the given username and password.
-// The password is hashed before storage.
+// The password is hashed with the configured PasswordHasher before storage.
 // Returns an error if the username is already taken or if creation fails.
 func (s *AuthService) RegisterUser(ctx context.Context, username, password string) (err error) {
 	log := s.Log.With(logging.Group("user", "username", username))
@@ -73,9 +186,10 @@ func (s *AuthService) RegisterUser(ctx context.Context, username, password strin
 		}
 	}()
 
-	hasher := sha256.New()
-	hasher.Write([]byte(password))
-	passwordHash := hasher.Sum(nil)
+	passwordHash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
 
 	if err := s.UserRepo.CreateUser(ctx, username, passwordHash); err != nil {
 		return fmt.Errorf("create user: %w", err)
@@ -85,8 +199,31 @@ func (s *AuthService) RegisterUser(ctx context.Context, username, password strin
 }
 
 // Login authenticates a user and generates a signed JWT token.
-// Returns the encoded token string or an error if authentication fails.
-func (s *AuthService) Login(ctx context.Context, username, password string) (_ string, err error) {
+// After LoginMaxFailures failed logins, logins to the account are rejected with a
+// *LockoutError until LoginLockoutDuration has passed since the first failure.
+// If the stored password hash uses another algorithm or other parameters than the
+// configured PasswordHasher, it is replaced by a new hash of the password.
+// Credentials are checked by the CredentialVerifier of the configured backend, see authenticate.
+// The token is granted the requested scopes, which must be listed by AuthConfig.Scopes.
+// Returns the encoded token string or an error if authentication fails, which is
+// domain.ErrInvalidScope if a scope cannot be granted.
+func (s *AuthService) Login(ctx context.Context, username, password string, scopes []string) (string, error) {
+	return s.login(ctx, username, password, scopes, false)
+}
+
+// LoginRemember authenticates a user like Login, but generates a token for a persistent
+// "remember me" session, valid for RememberTokenDuration and carrying the "remember" claim.
+// If RememberTokenDuration is 0, a regular token is generated.
+func (s *AuthService) LoginRemember(ctx context.Context, username, password string, scopes []string) (string, error) {
+	return s.login(ctx, username, password, scopes, s.Config.RememberTokenDuration > 0)
+}
+
+func (s *AuthService) login(
+	ctx context.Context,
+	username, password string,
+	scopes []string,
+	remember bool,
+) (_ string, err error) {
 	log := s.Log
 
 	defer func() {
@@ -95,62 +232,186 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (_ s
 		} else {
 			log.DebugContext(ctx, "login successful")
 		}
+
+		s.recordLoginAttempt(ctx, username, err)
 	}()
 
+	if err := s.checkScopes(scopes); err != nil {
+		return "", err
+	}
+
+	if err := s.checkLockout(ctx, username); err != nil {
+		return "", err
+	}
+
 	// Authenticate user
-	user, ok, err := s.UserRepo.GetUserByUsername(ctx, username)
+	user, rehash, err := s.authenticate(ctx, username, password)
 	if err != nil {
-		if errors.Is(err, domain.ErrUserNotFound) {
-			return "", errors.Join(domain.ErrInvalidCredentials, err)
-		} else {
-			return "", fmt.Errorf("get user: %w", err)
-		}
-	} else if !ok {
-		return "", domain.ErrInvalidCredentials
+		return "", err
+	}
+
+	s.resetLoginFailures(ctx, username)
+
+	if user.ExpiredAt != 0 {
+		return "", domain.ErrAccountExpired
+	}
+
+	if rehash {
+		s.rehashPassword(ctx, username, password)
 	}
 
-	hasher := sha256.New()
-	hasher.Write([]byte(password))
+	now := s.Clock.Now()
 
-	if !hmac.Equal(hasher.Sum(nil), user.PasswordHash) {
-		return "", domain.ErrInvalidCredentials
+	if err := s.UserRepo.RecordLogin(ctx, username, now.Unix()); err != nil {
+		log.WarnContext(ctx, "record login failed", "error", err)
 	}
 
 	// Generate token
-	now := time.Now()
-	expiry := now.Add(time.Duration(s.Config.TokenDuration * int64(time.Second)))
-	token := domain.AuthToken{
-		Username:  username,
+	token := s.newToken(user, scopes, now, now.Add(s.tokenDuration(remember)))
+	token.Remember = remember
+
+	log = log.With(tokenLogGroup(token))
+
+	return s.signToken(token)
+}
+
+// newToken returns a token of the user with the given scopes, issued at now and expiring at expiry.
+// The issuer and audience are those configured, and the time of the login is now.
+func (s *AuthService) newToken(user *domain.User, scopes []string, now, expiry time.Time) domain.AuthToken {
+	return domain.AuthToken{
+		Username:  user.Username,
+		Issuer:    s.Config.Issuer,
 		IssuedAt:  now.Unix(),
 		ExpiresAt: expiry.Unix(),
+		AuthTime:  now.Unix(),
+		Roles:     user.Roles,
+		Audience:  splitList(s.Config.Audience),
+		Scopes:    scopes,
 	}
+}
 
-	log = log.With(logging.Group("token",
+// tokenDuration returns the validity duration of regular or "remember me" tokens.
+func (s *AuthService) tokenDuration(remember bool) time.Duration {
+	if remember {
+		return time.Duration(s.Config.RememberTokenDuration) * time.Second
+	}
+
+	return time.Duration(s.Config.TokenDuration) * time.Second
+}
+
+// signToken signs the token as JWT, or in the legacy format for tenants with FlagJWTTokens disabled.
+func (s *AuthService) signToken(token domain.AuthToken) (string, error) {
+	if !s.Flags.EnabledFor(FlagJWTTokens, token.Username, "") {
+		return SignLegacyToken(token, s.SigningKey)
+	}
+
+	return SignToken(token, s.SigningKey)
+}
+
+// tokenLogGroup returns the log attributes of an issued token.
+func tokenLogGroup(token domain.AuthToken) slog.Attr {
+	return logging.Group("token",
 		"username", token.Username,
-		"exp", expiry.UTC().Format(time.RFC3339),
-		"iat", now.UTC().Format(time.RFC3339),
-	))
+		"exp", time.Unix(token.ExpiresAt, 0).UTC().Format(time.RFC3339),
+		"iat", time.Unix(token.IssuedAt, 0).UTC().Format(time.RFC3339),
+		"roles", token.Roles,
+		"scopes", token.Scopes,
+		"remember", token.Remember,
+	)
+}
 
-	// Serialize token
-	tokenBytes, err := json.Marshal(token)
-	if err != nil {
-		return "", fmt.Errorf("marshal token: %w", err)
+// authenticate checks the credentials of a user with the configured CredentialVerifier and
+// returns the user, and whether its password hash should be replaced. Users accepted without
+// an account, e.g. by an external backend, are provisioned one without password, holding their
+// roles and login records. Returns domain.ErrInvalidCredentials if the credentials are wrong.
+func (s *AuthService) authenticate(ctx context.Context, username, password string) (*domain.User, bool, error) {
+	user, found, lookupErr := s.UserRepo.GetUserByUsername(ctx, username)
+	if lookupErr != nil && !errors.Is(lookupErr, domain.ErrUserNotFound) {
+		return nil, false, fmt.Errorf("get user: %w", lookupErr)
+	} else if !found {
+		user = nil
 	}
 
-	// Create signature
-	hashed := sha256.Sum256(tokenBytes)
+	verifier := s.Credentials
+	if verifier == nil {
+		verifier = PasswordVerifier{Hasher: s.Hasher}
+	}
 
-	signature, err := rsa.SignPSS(rand.Reader, s.SigningKey, crypto.SHA256, hashed[:], nil)
+	result, err := verifier.Verify(ctx, username, password, user)
 	if err != nil {
-		return "", fmt.Errorf("sign token: %w", err)
+		return nil, false, fmt.Errorf("verify credentials: %w", err)
+	} else if !result.Valid {
+		s.recordLoginFailure(ctx, username)
+
+		return nil, false, errors.Join(domain.ErrInvalidCredentials, lookupErr)
+	}
+
+	if user != nil {
+		return user, result.Rehash, nil
+	}
+
+	// Provision the account, tolerating concurrent logins provisioning it as well
+	if err := s.UserRepo.CreateUser(ctx, username, []byte{}); err != nil && !errors.Is(err, domain.ErrUserAlreadyExists) {
+		return nil, false, fmt.Errorf("provision user: %w", err)
+	}
+
+	if user, found, err = s.UserRepo.GetUserByUsername(ctx, username); err != nil || !found {
+		return nil, false, fmt.Errorf("get provisioned user: %w", err)
+	}
+
+	s.Log.InfoContext(ctx, "user provisioned", "username", username)
+
+	return user, false, nil
+}
+
+// checkScopes returns domain.ErrInvalidScope if a scope is not listed by AuthConfig.Scopes.
+func (s *AuthService) checkScopes(scopes []string) error {
+	allowed := splitList(s.Config.Scopes)
+
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return fmt.Errorf("%w: %q", domain.ErrInvalidScope, scope)
+		}
 	}
 
-	// Encode combined token + signature
-	return base64.URLEncoding.EncodeToString(append(tokenBytes, signature...)), nil
+	return nil
 }
 
-// ValidateToken verifies a JWT token's signature and expiration.
-// Returns the decoded token if valid, or an error if validation fails.
+// splitList returns the non-empty elements of a comma-separated list.
+func splitList(list string) []string {
+	var elements []string
+
+	for _, element := range strings.Split(list, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
+
+// rehashPassword replaces the stored password hash of the user by a hash of the configured
+// PasswordHasher. Failures are logged only, as the login itself succeeded.
+func (s *AuthService) rehashPassword(ctx context.Context, username, password string) {
+	log := s.Log.With(logging.Group("user", "username", username))
+
+	passwordHash, err := s.Hasher.Hash(password)
+	if err == nil {
+		err = s.UserRepo.UpdatePasswordHash(ctx, username, passwordHash)
+	}
+
+	if err != nil {
+		log.WarnContext(ctx, "password rehash failed", "error", err)
+	} else {
+		log.InfoContext(ctx, "password rehashed")
+	}
+}
+
+// ValidateToken verifies a JWT token's signature and validity period, allowing for
+// AuthConfig.TokenLeeway clock skew.
+// Returns the decoded token if valid, or an error if validation fails, which is
+// domain.ErrInvalidAuthToken, and domain.ErrBadSignature, domain.ErrTokenNotYetValid or
+// domain.ErrTokenExpired if the token failed for that reason.
 func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (token domain.AuthToken, err error) {
 	log := s.Log
 
@@ -162,7 +423,18 @@ func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (to
 		}
 	}()
 
-	token, err = ValidateToken(ctx, tokenString, &s.SigningKey.PublicKey)
+	if IsLegacyToken(tokenString) {
+		log = log.With("legacy", true)
+
+		// Legacy tokens are accepted during the migration, and from tenants still issued legacy tokens
+		token, err = ValidateLegacyToken(ctx, tokenString, &s.SigningKey.PublicKey, s.Clock.Now(), s.tokenLeeway())
+		if err == nil && !s.Config.AcceptLegacyTokens && s.Flags.EnabledFor(FlagJWTTokens, token.Username, "") {
+			err = domain.ErrInvalidAuthToken
+		}
+	} else {
+		token, err = ValidateToken(ctx, tokenString, &s.SigningKey.PublicKey, s.Clock.Now(), s.tokenLeeway())
+	}
+
 	if err != nil {
 		return domain.AuthToken{}, fmt.Errorf("validate token: %w", err)
 	}
@@ -176,6 +448,11 @@ func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (to
 	return token, nil
 }
 
+// tokenLeeway returns the tolerated clock skew of token validation.
+func (s *AuthService) tokenLeeway() time.Duration {
+	return time.Duration(s.Config.TokenLeeway) * time.Second
+}
+
 // Close releases resources held by the service, such as database connections.
 // Returns an error if cleanup fails.
 func (s *AuthService) Close() error {
@@ -0,0 +1,145 @@
+package authsvc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// Results of logins recorded by LoginMetrics.
+const (
+	LoginResultSuccess            = "success"
+	LoginResultInvalidCredentials = "invalid_credentials"
+	LoginResultLocked             = "locked"
+	LoginResultAccountExpired     = "account_expired"
+	LoginResultError              = "error"
+)
+
+// Kinds of login anomalies recorded by LoginMetrics.
+const (
+	LoginAnomalyUser = "user" // Failed logins of a user crossed AuthConfig.AnomalyFailuresPerUser
+	LoginAnomalyIP   = "ip"   // Failed logins from a client IP crossed AuthConfig.AnomalyFailuresPerIP
+)
+
+// LoginMetrics records the results of logins and detected login anomalies, supporting the
+// detection of brute-force attacks.
+type LoginMetrics interface {
+	// LoginAttempt records a login with the given result, one of the LoginResult constants.
+	LoginAttempt(result string)
+
+	// LoginAnomaly records that the failed logins of a user or client IP crossed their threshold
+	// within AuthConfig.AnomalyWindow, kind is one of the LoginAnomaly constants.
+	LoginAnomaly(kind string)
+}
+
+// registryLoginMetrics implements LoginMetrics with counters of a metrics.Registry.
+type registryLoginMetrics struct {
+	attempts  *metrics.CounterVec
+	anomalies *metrics.CounterVec
+}
+
+// NewLoginMetrics returns LoginMetrics counting logins by result and anomalies by kind in the
+// authsvc_logins_total and authsvc_login_anomalies_total counters of reg.
+func NewLoginMetrics(reg *metrics.Registry) LoginMetrics {
+	return &registryLoginMetrics{
+		attempts: reg.NewCounterVec(
+			"authsvc_logins_total",
+			"Logins by result.",
+			"result",
+		),
+		anomalies: reg.NewCounterVec(
+			"authsvc_login_anomalies_total",
+			"Users and client IPs whose failed logins crossed the anomaly threshold, by kind.",
+			"kind",
+		),
+	}
+}
+
+// LoginAttempt implements LoginMetrics.
+func (m *registryLoginMetrics) LoginAttempt(result string) {
+	m.attempts.With(result).Inc()
+}
+
+// LoginAnomaly implements LoginMetrics.
+func (m *registryLoginMetrics) LoginAnomaly(kind string) {
+	m.anomalies.With(kind).Inc()
+}
+
+// loginAnomalyKey returns the throttle store key counting the failed logins of a user or client IP.
+func loginAnomalyKey(kind, key string) string {
+	return "login_anomaly:" + kind + ":" + key
+}
+
+// loginResult returns the LoginResult of a login failing with err, or succeeding if nil.
+func loginResult(err error) string {
+	var lockoutErr *LockoutError
+
+	switch {
+	case err == nil:
+		return LoginResultSuccess
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		return LoginResultInvalidCredentials
+	case errors.As(err, &lockoutErr):
+		return LoginResultLocked
+	case errors.Is(err, domain.ErrAccountExpired):
+		return LoginResultAccountExpired
+	default:
+		return LoginResultError
+	}
+}
+
+// recordLoginAttempt records the result of a login in the LoginMetrics. Failed logins with
+// wrong credentials or to locked accounts are counted per user and per client IP of the context
+// within AnomalyWindow, and logged as anomaly when crossing AnomalyFailuresPerUser or
+// AnomalyFailuresPerIP. Counting requires a throttle store; it fails open like the lockout.
+func (s *AuthService) recordLoginAttempt(ctx context.Context, username string, err error) {
+	result := loginResult(err)
+
+	if s.Metrics != nil {
+		s.Metrics.LoginAttempt(result)
+	}
+
+	if s.Throttle == nil || (result != LoginResultInvalidCredentials && result != LoginResultLocked) {
+		return
+	}
+
+	s.countLoginFailure(ctx, LoginAnomalyUser, username, s.Config.AnomalyFailuresPerUser)
+
+	if clientIP, ok := context_.ClientIPFromContext(ctx); ok {
+		s.countLoginFailure(ctx, LoginAnomalyIP, clientIP, s.Config.AnomalyFailuresPerIP)
+	}
+}
+
+// countLoginFailure counts a failed login of the user or client IP key, and records an anomaly
+// of the given kind when the failures within AnomalyWindow reach threshold, 0 to disable.
+func (s *AuthService) countLoginFailure(ctx context.Context, kind, key string, threshold int) {
+	if threshold <= 0 {
+		return
+	}
+
+	log := s.Log.With(logging.Group("anomaly", "kind", kind, "key", key))
+	window := time.Duration(s.Config.AnomalyWindow) * time.Second
+
+	failures, _, err := s.Throttle.Incr(ctx, loginAnomalyKey(kind, key), window)
+	if err != nil {
+		log.WarnContext(ctx, "login anomaly recording failed", "error", err)
+
+		return
+	}
+
+	// Anomalies are recorded once per window, when crossing the threshold
+	if failures != int64(threshold) {
+		return
+	}
+
+	log.WarnContext(ctx, "login anomaly detected", "failures", failures, "window", window.String())
+
+	if s.Metrics != nil {
+		s.Metrics.LoginAnomaly(kind)
+	}
+}
@@ -0,0 +1,86 @@
+package authsvc_test
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+)
+
+// recordingLoginMetrics counts the recorded login results and anomalies.
+type recordingLoginMetrics struct {
+	m         sync.Mutex
+	attempts  map[string]int
+	anomalies map[string]int
+}
+
+func (r *recordingLoginMetrics) LoginAttempt(result string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.attempts[result]++
+}
+
+func (r *recordingLoginMetrics) LoginAnomaly(kind string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.anomalies[kind]++
+}
+
+func TestAuthService_LoginAnomalies(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.LoginMaxFailures = 4
+	svc.Config.LoginLockoutDuration = 60
+	svc.Config.AnomalyWindow = 60
+	svc.Config.AnomalyFailuresPerUser = 5
+	svc.Config.AnomalyFailuresPerIP = 3
+	svc.Throttle = throttle.NewMemoryStore("")
+
+	recorder := &recordingLoginMetrics{attempts: map[string]int{}, anomalies: map[string]int{}}
+	svc.Metrics = recorder
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	if _, err := svc.Login(ctx, "testuser", "testpass", nil); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	// Guessing the passwords of several users from one client
+	attacker := context_.WithClientIP(ctx, "192.0.2.1")
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		if _, err := svc.Login(attacker, username, "guess", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("Login(%s) error = %v, want %v", username, err, domain.ErrInvalidCredentials)
+		}
+	}
+
+	// Guessing the password of one user, who is locked after 4 failures
+	for range 6 {
+		_, _ = svc.Login(ctx, "testuser", "guess", nil)
+	}
+
+	wantAttempts := map[string]int{
+		authsvc.LoginResultSuccess:            1,
+		authsvc.LoginResultInvalidCredentials: 8,
+		authsvc.LoginResultLocked:             2,
+	}
+	if !maps.Equal(recorder.attempts, wantAttempts) {
+		t.Errorf("recorded attempts = %v, want %v", recorder.attempts, wantAttempts)
+	}
+
+	wantAnomalies := map[string]int{authsvc.LoginAnomalyIP: 1, authsvc.LoginAnomalyUser: 1}
+	if !maps.Equal(recorder.anomalies, wantAnomalies) {
+		t.Errorf("recorded anomalies = %v, want %v", recorder.anomalies, wantAnomalies)
+	}
+}
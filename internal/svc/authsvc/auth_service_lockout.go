@@ -0,0 +1,102 @@
+package authsvc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// LockoutError is returned when logins to an account are locked after repeated failures.
+// It matches domain.ErrTooManyLoginAttempts.
+type LockoutError struct {
+	RetryAfter time.Duration // Remaining duration of the lockout
+}
+
+// Error implements error.
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", domain.ErrTooManyLoginAttempts, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap returns domain.ErrTooManyLoginAttempts.
+func (e *LockoutError) Unwrap() error {
+	return domain.ErrTooManyLoginAttempts
+}
+
+// loginFailureKey returns the throttle store key counting the failed logins of a user.
+func loginFailureKey(username string) string {
+	return "login_failures:" + username
+}
+
+// lockoutEnabled reports whether failed logins lock accounts.
+func (s *AuthService) lockoutEnabled() bool {
+	return s.Throttle != nil && s.Config.LoginMaxFailures > 0
+}
+
+// checkLockout returns a *LockoutError if logins to the account are locked.
+// The lockout fails open: if the throttle store is unavailable, logins are allowed.
+func (s *AuthService) checkLockout(ctx context.Context, username string) error {
+	if !s.lockoutEnabled() {
+		return nil
+	}
+
+	failures, ttl, err := s.Throttle.Get(ctx, loginFailureKey(username))
+	if err != nil {
+		s.Log.WarnContext(ctx, "login lockout check failed", "error", err)
+
+		return nil
+	}
+
+	if failures >= int64(s.Config.LoginMaxFailures) {
+		return &LockoutError{RetryAfter: ttl}
+	}
+
+	return nil
+}
+
+// LoginFailures returns the number of failed logins of the user counted within the lockout duration.
+// Returns 0 if failed logins are not counted or the throttle store is unavailable.
+func (s *AuthService) LoginFailures(ctx context.Context, username string) int64 {
+	if !s.lockoutEnabled() {
+		return 0
+	}
+
+	failures, _, err := s.Throttle.Get(ctx, loginFailureKey(username))
+	if err != nil {
+		s.Log.WarnContext(ctx, "login failures check failed", "error", err)
+
+		return 0
+	}
+
+	return failures
+}
+
+// recordLoginFailure counts a failed login of the user.
+func (s *AuthService) recordLoginFailure(ctx context.Context, username string) {
+	if !s.lockoutEnabled() {
+		return
+	}
+
+	log := s.Log.With(logging.Group("user", "username", username))
+	ttl := time.Duration(s.Config.LoginLockoutDuration) * time.Second
+
+	failures, _, err := s.Throttle.Incr(ctx, loginFailureKey(username), ttl)
+	if err != nil {
+		log.WarnContext(ctx, "login failure recording failed", "error", err)
+	} else if failures == int64(s.Config.LoginMaxFailures) {
+		log.WarnContext(ctx, "login locked", "failures", failures, "duration", ttl.String())
+	}
+}
+
+// resetLoginFailures clears the failed logins of the user after a successful login.
+func (s *AuthService) resetLoginFailures(ctx context.Context, username string) {
+	if !s.lockoutEnabled() {
+		return
+	}
+
+	if err := s.Throttle.Reset(ctx, loginFailureKey(username)); err != nil {
+		s.Log.WarnContext(ctx, "login failure reset failed", "error", err)
+	}
+}
@@ -0,0 +1,172 @@
+package authsvc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// PasswordHashReport summarizes the progress of the password hash migration.
+type PasswordHashReport struct {
+	Users       int            `json:"users"`       // Number of users
+	Algorithms  map[string]int `json:"algorithms"`  // Number of users per hash algorithm
+	NeedsRehash int            `json:"needsRehash"` // Users whose hash is replaced on their next login
+	Legacy      int            `json:"legacy"`      // Users on plain SHA-256 hashes
+	Expired     int            `json:"expired"`     // Expired accounts
+	LastLogin   LastLoginStats `json:"lastLogin"`   // Last login distribution of users needing a rehash
+}
+
+// LastLoginStats is a distribution of the last login times of users.
+type LastLoginStats struct {
+	Never     int `json:"never"`     // Never logged in since last logins are recorded
+	Within7d  int `json:"within7d"`  // Logged in within the last 7 days
+	Within30d int `json:"within30d"` // Logged in within the last 30 days, but not 7 days
+	Within90d int `json:"within90d"` // Logged in within the last 90 days, but not 30 days
+	Beyond90d int `json:"beyond90d"` // Last logged in more than 90 days ago
+}
+
+// add counts a last login at the given Unix timestamp.
+func (stats *LastLoginStats) add(lastLoginAt int64, now time.Time) {
+	const day = 24 * time.Hour
+
+	age := now.Sub(time.Unix(lastLoginAt, 0))
+
+	switch {
+	case lastLoginAt == 0:
+		stats.Never++
+	case age <= 7*day:
+		stats.Within7d++
+	case age <= 30*day:
+		stats.Within30d++
+	case age <= 90*day:
+		stats.Within90d++
+	default:
+		stats.Beyond90d++
+	}
+}
+
+// PasswordHashReport reports how many users remain on hashes that are replaced on their
+// next login, in particular legacy SHA-256 hashes, and when they last logged in.
+func (s *AuthService) PasswordHashReport(ctx context.Context) (report PasswordHashReport, err error) {
+	log := s.Log
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "password hash report failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "password hash report created")
+		}
+	}()
+
+	users, err := s.UserRepo.ListUsers(ctx)
+	if err != nil {
+		return PasswordHashReport{}, fmt.Errorf("list users: %w", err)
+	}
+
+	now := s.Clock.Now()
+	report.Algorithms = make(map[string]int)
+
+	for _, user := range users {
+		algorithm := PasswordHashAlgorithm(user.PasswordHash)
+
+		report.Users++
+		report.Algorithms[algorithm]++
+
+		if user.ExpiredAt != 0 {
+			report.Expired++
+		}
+
+		if algorithm == "sha256" {
+			report.Legacy++
+		}
+
+		if s.Hasher.NeedsRehash(user.PasswordHash) {
+			report.NeedsRehash++
+			report.LastLogin.add(user.LastLoginAt, now)
+		}
+	}
+
+	return report, nil
+}
+
+// RehashLegacyPasswords wraps all legacy SHA-256 password hashes into hashes of the
+// configured PasswordHasher (see WrappedSHA256Hasher), so they are no longer stored in
+// a weak format. The wrapped hashes are replaced by plain hashes on the next login.
+// Returns the number of rehashed users.
+func (s *AuthService) RehashLegacyPasswords(ctx context.Context) (count int, err error) {
+	log := s.Log
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "legacy password rehash failed", "error", err, "count", count)
+		} else {
+			log.InfoContext(ctx, "legacy passwords rehashed", "count", count)
+		}
+	}()
+
+	users, err := s.UserRepo.ListUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list users: %w", err)
+	}
+
+	wrapper := WrappedSHA256Hasher{Inner: s.Hasher}
+
+	for _, user := range users {
+		if !(SHA256Hasher{}).Supports(user.PasswordHash) {
+			continue
+		}
+
+		passwordHash, err := wrapper.Wrap(user.PasswordHash)
+		if err != nil {
+			return count, fmt.Errorf("wrap hash of %q: %w", user.Username, err)
+		}
+
+		if err := s.UserRepo.UpdatePasswordHash(ctx, user.Username, passwordHash); err != nil {
+			return count, fmt.Errorf("update hash of %q: %w", user.Username, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// ExpireStaleAccounts expires the accounts of users whose password hash still needs a rehash
+// and who have not logged in within maxAge, or ever and were created before. Expired accounts
+// cannot log in anymore. Returns the usernames of the expired accounts.
+func (s *AuthService) ExpireStaleAccounts(ctx context.Context, maxAge time.Duration) (expired []string, err error) {
+	log := s.Log.With(logging.Group("expire", "maxAge", maxAge.String()))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "expire stale accounts failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "stale accounts expired", "count", len(expired))
+		}
+	}()
+
+	users, err := s.UserRepo.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	now := s.Clock.Now()
+	cutoff := now.Add(-maxAge).Unix()
+
+	for _, user := range users {
+		lastSeen := max(user.LastLoginAt, user.CreatedAt)
+		if user.ExpiredAt != 0 || lastSeen >= cutoff || !s.Hasher.NeedsRehash(user.PasswordHash) {
+			continue
+		}
+
+		if err := s.UserRepo.ExpireUser(ctx, user.Username, now.Unix()); err != nil {
+			return expired, fmt.Errorf("expire %q: %w", user.Username, err)
+		}
+
+		expired = append(expired, user.Username)
+	}
+
+	return expired, nil
+}
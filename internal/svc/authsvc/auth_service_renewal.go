@@ -0,0 +1,83 @@
+package authsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// RenewToken issues a new token for a still valid token, extending the session with a sliding
+// expiry: the new token expires TokenDuration from now, but at most TokenMaxLifetime after the
+// login the token descends from. It carries the scopes of the token and the current roles of the user.
+// Tokens of "remember me" sessions are renewed for RememberTokenDuration, until at least
+// RememberTokenDuration after the login.
+// Returns the errors of ValidateToken if the token is invalid, domain.ErrSessionExpired if the
+// session reached its maximum lifetime or renewal is disabled, domain.ErrAccountExpired if the
+// account expired since, and domain.ErrInvalidAuthToken if the user no longer exists.
+func (s *AuthService) RenewToken(ctx context.Context, tokenString string) (_ string, err error) {
+	log := s.Log
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "renew token failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "token renewed")
+		}
+	}()
+
+	token, err := s.ValidateToken(ctx, tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.Clock.Now()
+
+	// Tokens issued before the time of the login was recorded descend from a login at their issue time
+	authTime := token.AuthTime
+	if authTime == 0 {
+		authTime = token.IssuedAt
+	}
+
+	remember := token.Remember && s.Config.RememberTokenDuration > 0
+
+	lifetime := time.Duration(s.Config.TokenMaxLifetime) * time.Second
+	if remember {
+		lifetime = max(lifetime, s.tokenDuration(true))
+	}
+
+	deadline := time.Unix(authTime, 0).Add(lifetime)
+	if s.Config.TokenMaxLifetime <= 0 || !now.Before(deadline) {
+		return "", domain.ErrSessionExpired
+	}
+
+	if err := s.checkScopes(token.Scopes); err != nil {
+		return "", err
+	}
+
+	user, found, err := s.UserRepo.GetUserByUsername(ctx, token.Username)
+	if errors.Is(err, domain.ErrUserNotFound) || (err == nil && !found) {
+		return "", errors.Join(domain.ErrInvalidAuthToken, domain.ErrUserNotFound)
+	} else if err != nil {
+		return "", fmt.Errorf("get user: %w", err)
+	}
+
+	if user.ExpiredAt != 0 {
+		return "", domain.ErrAccountExpired
+	}
+
+	expiry := now.Add(s.tokenDuration(remember))
+	if expiry.After(deadline) {
+		expiry = deadline
+	}
+
+	renewed := s.newToken(user, token.Scopes, now, expiry)
+	renewed.AuthTime = authTime
+	renewed.Remember = remember
+
+	log = log.With(tokenLogGroup(renewed))
+
+	return s.signToken(renewed)
+}
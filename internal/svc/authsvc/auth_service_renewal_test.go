@@ -0,0 +1,259 @@
+package authsvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+func TestAuthService_RenewToken(t *testing.T) {
+	t.Parallel()
+
+	svc, mockRepo := setupTestService(t)
+	svc.Config.TokenMaxLifetime = 3 * 3600
+
+	login := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(login)
+	svc.Clock = clk
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	token, err := svc.Login(ctx, "testuser", "testpass", nil)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	mockRepo.users["testuser"].Roles = []string{"editor"}
+
+	// Subtests are sequential, each advancing the clock and renewing the last token
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		wantExpiry time.Time
+		wantErr    error
+	}{
+		{name: "sliding", advance: 50 * time.Minute, wantExpiry: login.Add(110 * time.Minute)},
+		{name: "renewed again", advance: 50 * time.Minute, wantExpiry: login.Add(160 * time.Minute)},
+		{name: "capped by lifetime", advance: 50 * time.Minute, wantExpiry: login.Add(3 * time.Hour)},
+		{name: "session expired", advance: 30 * time.Minute, wantErr: domain.ErrSessionExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+
+			renewed, err := svc.RenewToken(ctx, token)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("RenewToken() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			got, err := svc.ValidateToken(ctx, renewed)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+
+			if got.ExpiresAt != tt.wantExpiry.Unix() || got.AuthTime != login.Unix() || got.IssuedAt != clk.Now().Unix() {
+				t.Errorf("renewed token = %+v, want expiry %v and login %v", got, tt.wantExpiry, login)
+			}
+
+			if !slices.Equal(got.Roles, []string{"editor"}) {
+				t.Errorf("renewed roles = %v, want current roles", got.Roles)
+			}
+
+			token = renewed
+		})
+	}
+}
+
+func TestAuthService_RenewTokenRejected(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		setup   func(svc *authsvc.AuthService, clk *clock.Fake, users map[string]*domain.User)
+		wantErr error
+	}{
+		{name: "disabled", setup: func(svc *authsvc.AuthService, _ *clock.Fake, _ map[string]*domain.User) {
+			svc.Config.TokenMaxLifetime = 0
+		}, wantErr: domain.ErrSessionExpired},
+		{name: "token expired", setup: func(_ *authsvc.AuthService, clk *clock.Fake, _ map[string]*domain.User) {
+			clk.Advance(2 * time.Hour)
+		}, wantErr: domain.ErrTokenExpired},
+		{name: "account expired", setup: func(_ *authsvc.AuthService, _ *clock.Fake, users map[string]*domain.User) {
+			users["testuser"].ExpiredAt = 1
+		}, wantErr: domain.ErrAccountExpired},
+		{name: "user deleted", setup: func(_ *authsvc.AuthService, _ *clock.Fake, users map[string]*domain.User) {
+			delete(users, "testuser")
+		}, wantErr: domain.ErrInvalidAuthToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, mockRepo := setupTestService(t)
+			svc.Config.TokenMaxLifetime = 86400
+
+			clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+			svc.Clock = clk
+
+			ctx := context.Background()
+			if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+				t.Fatalf("failed to register user: %v", err)
+			}
+
+			token, err := svc.Login(ctx, "testuser", "testpass", nil)
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			tt.setup(svc, clk, mockRepo.users)
+
+			if _, err := svc.RenewToken(ctx, token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RenewToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPTransport_Renew(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.TokenMaxLifetime = 86400
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	token, err := svc.Login(ctx, "testuser", "testpass", nil)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	transport := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+
+	renew := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/auth/renew", nil)
+		r.Header.Set(authclient.AuthorizationHeader, authclient.AuthorizationValue(token))
+
+		rec := httptest.NewRecorder()
+		transport.ServeHTTP(rec, r)
+
+		return rec
+	}
+
+	rec := renew(token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("renew status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp domain.AuthTokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("renew response = %s, %v, want token", rec.Body, err)
+	}
+
+	if _, err := svc.ValidateToken(ctx, resp.Token); err != nil {
+		t.Errorf("ValidateToken(renewed) error = %v", err)
+	}
+
+	rec = renew("invalid")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get(authsvc.WWWAuthenticateHeader), "invalid_token") {
+		t.Errorf("renew invalid token = %d %v, want 401 with token challenge", rec.Code, rec.Header())
+	}
+}
+
+func TestAuthService_RenewRememberToken(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.TokenMaxLifetime = 3600
+	svc.Config.RememberTokenDuration = 7 * 86400
+
+	login := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(login)
+	svc.Clock = clk
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	token, err := svc.LoginRemember(ctx, "testuser", "testpass", nil)
+	if err != nil {
+		t.Fatalf("LoginRemember() error = %v", err)
+	}
+
+	// Remembered sessions outlive TokenMaxLifetime, up to RememberTokenDuration after the login
+	clk.Advance(6 * 24 * time.Hour)
+
+	renewed, err := svc.RenewToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RenewToken() error = %v", err)
+	}
+
+	got, err := svc.ValidateToken(ctx, renewed)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+
+	if want := login.Add(7 * 24 * time.Hour); !got.Remember || got.ExpiresAt != want.Unix() {
+		t.Errorf("renewed token = %+v, want remember and expiry %v", got, want)
+	}
+}
+
+func TestHTTPTransport_LoginRemember(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.RememberTokenDuration = 86400
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	transport := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+
+	for _, remember := range []string{"", "false", "true"} {
+		rec := serveForm(transport, http.MethodPost, "/auth/login", url.Values{
+			"username": {"testuser"},
+			"password": {"testpass"},
+			"remember": {remember},
+		})
+
+		var resp domain.AuthTokenResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("login(remember=%q) = %d %s, want token", remember, rec.Code, rec.Body)
+		}
+
+		token, err := svc.ValidateToken(ctx, resp.Token)
+		if err != nil {
+			t.Fatalf("ValidateToken() error = %v", err)
+		}
+
+		if token.Remember != (remember == "true") {
+			t.Errorf("login(remember=%q) token remember = %v", remember, token.Remember)
+		}
+	}
+}
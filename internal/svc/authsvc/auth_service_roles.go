@@ -0,0 +1,43 @@
+package authsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// ErrInvalidRole is returned when a role name is empty or contains a comma or whitespace.
+var ErrInvalidRole = errors.New("invalid role")
+
+// SetRoles replaces the roles of a user, e.g. domain.RoleAdmin. Roles are embedded into
+// tokens issued from the next login on; tokens issued before keep their roles until they expire.
+// Returns ErrInvalidRole if a role name is invalid, or domain.ErrUserNotFound.
+func (s *AuthService) SetRoles(ctx context.Context, username string, roles []string) (err error) {
+	log := s.Log.With(logging.Group("user", "username", username, "roles", roles))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "set roles failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "roles set")
+		}
+	}()
+
+	for _, role := range roles {
+		if role == "" || strings.ContainsFunc(role, func(r rune) bool { return r == ',' || r <= ' ' }) {
+			return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+
+	roles = slices.Compact(slices.Sorted(slices.Values(roles)))
+
+	if err := s.UserRepo.SetRoles(ctx, username, roles); err != nil {
+		return fmt.Errorf("set roles: %w", err)
+	}
+
+	return nil
+}
@@ -3,14 +3,22 @@ package authsvc_test
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
 	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // mockUserRepository implements user.Repository for testing.
@@ -50,6 +58,51 @@ func (m *mockUserRepository) GetUserByUsername(_ context.Context, username strin
 	return user, true, nil
 }
 
+func (m *mockUserRepository) UpdatePasswordHash(_ context.Context, username string, passwordHash []byte) error {
+	return m.update(username, func(user *domain.User) { user.PasswordHash = passwordHash })
+}
+
+func (m *mockUserRepository) ListUsers(_ context.Context) ([]domain.User, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.err != nil {
+		return nil, m.err
+	}
+	users := make([]domain.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+func (m *mockUserRepository) RecordLogin(_ context.Context, username string, at int64) error {
+	return m.update(username, func(user *domain.User) { user.LastLoginAt = at })
+}
+
+func (m *mockUserRepository) ExpireUser(_ context.Context, username string, at int64) error {
+	return m.update(username, func(user *domain.User) { user.ExpiredAt = at })
+}
+
+func (m *mockUserRepository) SetRoles(_ context.Context, username string, roles []string) error {
+	return m.update(username, func(user *domain.User) { user.Roles = roles })
+}
+
+func (m *mockUserRepository) update(username string, fn func(*domain.User)) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	user, exists := m.users[username]
+	if !exists {
+		return domain.ErrUserNotFound
+	}
+	fn(user)
+	return nil
+}
+
 func (m *mockUserRepository) Close() error {
 	return m.err
 }
@@ -79,13 +132,72 @@ func setupTestService(t *testing.T) (*authsvc.AuthService, *mockUserRepository)
 	svc := &authsvc.AuthService{
 		Config:     cfg,
 		UserRepo:   mockRepo,
+		Hasher:     authsvc.BcryptHasher{Cost: bcrypt.MinCost},
 		Log:        logging.GetLogger("test.authsvc"),
 		SigningKey: signingKey,
+		Clock:      clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)),
 	}
 
 	return svc, mockRepo
 }
 
+func TestAuthService_LoginLockout(t *testing.T) {
+	t.Parallel()
+
+	svc, mockRepo := setupTestService(t)
+	svc.Config.LoginMaxFailures = 3
+	svc.Config.LoginLockoutDuration = 60
+	svc.Throttle = throttle.NewMemoryStore("")
+
+	hash, err := svc.Hasher.Hash("testpass")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	mockRepo.users["testuser"] = &domain.User{ID: 1, Username: "testuser", PasswordHash: hash}
+	ctx := context.Background()
+
+	// A successful login resets the failure count
+	for range 2 {
+		if _, err := svc.Login(ctx, "testuser", "wrongpass", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("Login() with wrong password error = %v, want %v", err, domain.ErrInvalidCredentials)
+		}
+	}
+
+	if _, err := svc.Login(ctx, "testuser", "testpass", nil); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	for range 3 {
+		if _, err := svc.Login(ctx, "testuser", "wrongpass", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("Login() with wrong password error = %v, want %v", err, domain.ErrInvalidCredentials)
+		}
+	}
+
+	// The correct password is rejected while the account is locked
+	_, err = svc.Login(ctx, "testuser", "testpass", nil)
+
+	var lockoutErr *authsvc.LockoutError
+	if !errors.As(err, &lockoutErr) || !errors.Is(err, domain.ErrTooManyLoginAttempts) {
+		t.Fatalf("Login() while locked error = %v, want %v", err, domain.ErrTooManyLoginAttempts)
+	}
+
+	if lockoutErr.RetryAfter <= 0 || lockoutErr.RetryAfter > time.Minute {
+		t.Errorf("Login() while locked RetryAfter = %v, want (0, 1m]", lockoutErr.RetryAfter)
+	}
+
+	// Unknown users are counted as well
+	for range 3 {
+		if _, err := svc.Login(ctx, "nouser", "wrongpass", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("Login() with unknown user error = %v, want %v", err, domain.ErrInvalidCredentials)
+		}
+	}
+
+	if _, err := svc.Login(ctx, "nouser", "wrongpass", nil); !errors.Is(err, domain.ErrTooManyLoginAttempts) {
+		t.Errorf("Login() with locked unknown user error = %v, want %v", err, domain.ErrTooManyLoginAttempts)
+	}
+}
+
 //nolint:paralleltest
 func TestAuthService_RegisterUser(t *testing.T) {
 	svc, mockRepo := setupTestService(t)
@@ -199,7 +311,7 @@ func TestAuthService_Login(t *testing.T) {
 			mockRepo.err = tt.repoErr
 
 			// Execute test
-			token, err := svc.Login(context.Background(), tt.username, tt.password)
+			token, err := svc.Login(context.Background(), tt.username, tt.password, nil)
 
 			// Verify results
 			if (err != nil) != (tt.wantErr != nil) {
@@ -219,6 +331,106 @@ func TestAuthService_Login(t *testing.T) {
 	}
 }
 
+func TestAuthService_LoginScopes(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.Audience = "imagesvc, thumbsvc"
+	svc.Config.Scopes = "media,media:write"
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr error
+	}{
+		{name: "no scopes", scopes: nil},
+		{name: "allowed scopes", scopes: []string{"media", "media:write"}},
+		{name: "unknown scope", scopes: []string{"media", "admin"}, wantErr: domain.ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tokenString, err := svc.Login(ctx, "testuser", "testpass", tt.scopes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Login() error = %v, want %v", err, tt.wantErr)
+			} else if err != nil {
+				return
+			}
+
+			token, err := svc.ValidateToken(ctx, tokenString)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+
+			if want := []string{"imagesvc", "thumbsvc"}; !slices.Equal(token.Audience, want) {
+				t.Errorf("ValidateToken() audience = %v, want %v", token.Audience, want)
+			}
+
+			if !slices.Equal(token.Scopes, tt.scopes) {
+				t.Errorf("ValidateToken() scopes = %v, want %v", token.Scopes, tt.scopes)
+			}
+		})
+	}
+}
+
+func TestAuthService_LoginRemember(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		remember         bool
+		rememberDuration int64
+		wantExpiry       time.Time
+		wantRemember     bool
+	}{
+		{name: "regular", rememberDuration: 86400, wantExpiry: now.Add(time.Hour)},
+		{name: "remember", remember: true, rememberDuration: 86400, wantExpiry: now.Add(24 * time.Hour), wantRemember: true},
+		{name: "remember disabled", remember: true, rememberDuration: 0, wantExpiry: now.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, _ := setupTestService(t)
+			svc.Config.RememberTokenDuration = tt.rememberDuration
+
+			ctx := context.Background()
+			if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+				t.Fatalf("failed to register user: %v", err)
+			}
+
+			login := svc.Login
+			if tt.remember {
+				login = svc.LoginRemember
+			}
+
+			tokenString, err := login(ctx, "testuser", "testpass", nil)
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			token, err := svc.ValidateToken(ctx, tokenString)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+
+			if token.ExpiresAt != tt.wantExpiry.Unix() || token.Remember != tt.wantRemember {
+				t.Errorf("ValidateToken() = %+v, want expiry %v and remember %v", token, tt.wantExpiry, tt.wantRemember)
+			}
+		})
+	}
+}
+
 func TestAuthService_ValidateToken(t *testing.T) {
 	t.Parallel()
 
@@ -227,7 +439,7 @@ func TestAuthService_ValidateToken(t *testing.T) {
 	// Generate a valid token
 	ctx := context.Background()
 	svc.RegisterUser(ctx, "testuser", "testpass")
-	validToken, err := svc.Login(ctx, "testuser", "testpass")
+	validToken, err := svc.Login(ctx, "testuser", "testpass", nil)
 	if err != nil {
 		t.Fatalf("failed to generate test token: %v", err)
 	}
@@ -271,10 +483,374 @@ func TestAuthService_ValidateToken(t *testing.T) {
 				if token.Username != "testuser" {
 					t.Errorf("ValidateToken() username = %v, want %v", token.Username, "testuser")
 				}
-				if token.ExpiresAt <= time.Now().Unix() {
+				if token.ExpiresAt <= svc.Clock.Now().Unix() {
 					t.Error("ValidateToken() token already expired")
 				}
 			}
 		})
 	}
 }
+
+func TestInProcessClient(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	if err := svc.SetRoles(ctx, "testuser", []string{domain.RoleAdmin}); err != nil {
+		t.Fatalf("failed to set roles: %v", err)
+	}
+
+	validToken, err := svc.Login(ctx, "testuser", "testpass", nil)
+	if err != nil {
+		t.Fatalf("failed to generate test token: %v", err)
+	}
+
+	client := authsvc.NewInProcessClient(svc)
+
+	tests := []struct {
+		name   string
+		token  string
+		wantOK bool
+	}{
+		{name: "valid token", token: validToken, wantOK: true},
+		{name: "bearer token", token: "Bearer " + validToken, wantOK: true},
+		{name: "invalid token", token: "Bearer invalid.token.here", wantOK: false},
+		{name: "empty token", token: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			username, roles, ok, err := client.ValidateRoles(ctx, tt.token)
+			if err != nil {
+				t.Fatalf("ValidateRoles() error = %v", err)
+			}
+
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateRoles() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if ok && (username != "testuser" || !slices.Equal(roles, []string{domain.RoleAdmin})) {
+				t.Errorf("ValidateRoles() = %q, %v, want %q, [%s]", username, roles, "testuser", domain.RoleAdmin)
+			}
+		})
+	}
+}
+
+// legacyToken encodes a token in the legacy format predating JWTs.
+func legacyToken(t *testing.T, svc *authsvc.AuthService, token domain.AuthToken) string {
+	t.Helper()
+
+	tokenString, err := authsvc.SignLegacyToken(token, svc.SigningKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return tokenString
+}
+
+func TestAuthService_TokenExpiry(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.TokenLeeway = 30
+
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+	svc.Clock = clk
+
+	ctx := context.Background()
+	if err := svc.RegisterUser(ctx, "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	token, err := svc.Login(ctx, "testuser", "testpass", nil)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	// Subtests are sequential, each advancing the clock
+	tests := []struct {
+		name    string
+		advance time.Duration
+		wantErr error
+	}{
+		{name: "issued", advance: 0},
+		{name: "expired within leeway", advance: time.Hour + 29*time.Second},
+		{name: "expired", advance: 2 * time.Second, wantErr: domain.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+
+			_, err := svc.ValidateToken(ctx, token)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Errorf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_ValidateTokenFormats(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	ctx := context.Background()
+	now := svc.Clock.Now()
+
+	token := domain.AuthToken{
+		Username:  "testuser",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		Roles:     []string{domain.RoleAdmin},
+	}
+	expired := domain.AuthToken{Username: "testuser", IssuedAt: now.Unix(), ExpiresAt: now.Add(-time.Minute).Unix()}
+	future := domain.AuthToken{Username: "testuser", IssuedAt: now.Add(time.Minute).Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+
+	sign := func(token domain.AuthToken) string {
+		jwt, err := authsvc.SignToken(token, svc.SigningKey)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+
+		return jwt
+	}
+
+	jwt := sign(token)
+	segments := strings.Split(jwt, ".")
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	tamperedClaims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","iat":0,"exp":9999999999}`))
+
+	tests := []struct {
+		name         string
+		token        string
+		acceptLegacy bool
+		leeway       int64
+		want         *domain.AuthToken
+		wantErr      error
+	}{
+		{name: "jwt", token: jwt},
+		{name: "jwt with legacy accepted", token: jwt, acceptLegacy: true},
+		{name: "expired jwt", token: sign(expired), wantErr: domain.ErrTokenExpired},
+		{name: "expired jwt beyond leeway", token: sign(expired), leeway: 30, wantErr: domain.ErrTokenExpired},
+		{name: "expired jwt within leeway", token: sign(expired), leeway: 90, want: &expired},
+		{name: "future jwt", token: sign(future), wantErr: domain.ErrTokenNotYetValid},
+		{name: "future jwt within leeway", token: sign(future), leeway: 90, want: &future},
+		{name: "alg none", token: noneHeader + "." + segments[1] + ".", wantErr: domain.ErrInvalidAuthToken},
+		{
+			name:    "tampered claims",
+			token:   segments[0] + "." + tamperedClaims + "." + segments[2],
+			wantErr: domain.ErrBadSignature,
+		},
+		{name: "legacy rejected", token: legacyToken(t, svc, token), wantErr: domain.ErrInvalidAuthToken},
+		{name: "legacy accepted", token: legacyToken(t, svc, token), acceptLegacy: true},
+		{
+			name:         "expired legacy",
+			token:        legacyToken(t, svc, expired),
+			acceptLegacy: true,
+			wantErr:      domain.ErrTokenExpired,
+		},
+		{
+			name:         "expired legacy within leeway",
+			token:        legacyToken(t, svc, expired),
+			acceptLegacy: true,
+			leeway:       90,
+			want:         &expired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc := *svc
+			svc.Config.AcceptLegacyTokens = tt.acceptLegacy
+			svc.Config.TokenLeeway = tt.leeway
+
+			got, err := svc.ValidateToken(ctx, tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, domain.ErrInvalidAuthToken) || !errors.Is(err, tt.wantErr) {
+					t.Errorf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+
+			want := token
+			if tt.want != nil {
+				want = *tt.want
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ValidateToken() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestAuthService_JWTTokensFlag(t *testing.T) {
+	t.Parallel()
+
+	flags, err := featureflags.NewStore(featureflags.Config{Overrides: "jwt_tokens@legacyuser=false"})
+	if err != nil {
+		t.Fatalf("failed to create feature flags: %v", err)
+	}
+
+	svc, _ := setupTestService(t)
+	svc.Flags = flags
+	ctx := context.Background()
+
+	tests := []struct {
+		username   string
+		wantLegacy bool
+	}{
+		{username: "jwtuser", wantLegacy: false},
+		{username: "legacyuser", wantLegacy: true},
+	}
+
+	for _, tt := range tests {
+		if err := svc.RegisterUser(ctx, tt.username, "testpass"); err != nil {
+			t.Fatalf("RegisterUser() error = %v", err)
+		}
+
+		tokenString, err := svc.Login(ctx, tt.username, "testpass", nil)
+		if err != nil {
+			t.Fatalf("Login() error = %v", err)
+		}
+
+		if legacy := authsvc.IsLegacyToken(tokenString); legacy != tt.wantLegacy {
+			t.Errorf("Login(%s) legacy token = %v, want %v", tt.username, legacy, tt.wantLegacy)
+		}
+
+		// Legacy tokens are accepted from tenants issued them, without AcceptLegacyTokens
+		if token, err := svc.ValidateToken(ctx, tokenString); err != nil {
+			t.Errorf("ValidateToken(%s) error = %v", tt.username, err)
+		} else if token.Username != tt.username {
+			t.Errorf("ValidateToken(%s) username = %v", tt.username, token.Username)
+		}
+	}
+
+	// Legacy tokens of tenants issued JWTs are rejected
+	now := svc.Clock.Now()
+	token := domain.AuthToken{Username: "jwtuser", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+
+	if _, err := svc.ValidateToken(ctx, legacyToken(t, svc, token)); !errors.Is(err, domain.ErrInvalidAuthToken) {
+		t.Errorf("ValidateToken() of legacy token error = %v, want %v", err, domain.ErrInvalidAuthToken)
+	}
+}
+
+func TestAuthService_LoginRehash(t *testing.T) {
+	t.Parallel()
+
+	legacyHash := sha256.Sum256([]byte("testpass"))
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("testpass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to generate bcrypt hash: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		hash       []byte
+		hasher     authsvc.PasswordHasher
+		wantRehash bool
+	}{
+		{name: "legacy sha256 to argon2id", hash: legacyHash[:], hasher: authsvc.Argon2idHasher{Time: 1, Memory: 64, Threads: 1}, wantRehash: true},
+		{name: "bcrypt to argon2id", hash: bcryptHash, hasher: authsvc.Argon2idHasher{Time: 1, Memory: 64, Threads: 1}, wantRehash: true},
+		{name: "bcrypt cost change", hash: bcryptHash, hasher: authsvc.BcryptHasher{Cost: bcrypt.MinCost + 1}, wantRehash: true},
+		{name: "current bcrypt", hash: bcryptHash, hasher: authsvc.BcryptHasher{Cost: bcrypt.MinCost}, wantRehash: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, mockRepo := setupTestService(t)
+			svc.Hasher = tt.hasher
+			mockRepo.users["testuser"] = &domain.User{ID: 1, Username: "testuser", PasswordHash: tt.hash}
+
+			if _, err := svc.Login(context.Background(), "testuser", "wrongpass", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Fatalf("Login() with wrong password error = %v, want %v", err, domain.ErrInvalidCredentials)
+			}
+
+			if _, err := svc.Login(context.Background(), "testuser", "testpass", nil); err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			newHash := mockRepo.users["testuser"].PasswordHash
+			if rehashed := string(newHash) != string(tt.hash); rehashed != tt.wantRehash {
+				t.Fatalf("Login() rehashed = %v, want %v", rehashed, tt.wantRehash)
+			}
+
+			if tt.hasher.NeedsRehash(newHash) {
+				t.Errorf("Login() stored hash %q needing rehash", newHash)
+			}
+
+			// The migrated hash must still be accepted
+			if _, err := svc.Login(context.Background(), "testuser", "testpass", nil); err != nil {
+				t.Errorf("Login() after rehash error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_PasswordMigration(t *testing.T) {
+	t.Parallel()
+
+	svc, mockRepo := setupTestService(t)
+	ctx := context.Background()
+	longAgo := svc.Clock.Now().Add(-365 * 24 * time.Hour).Unix()
+
+	for _, username := range []string{"active", "stale"} {
+		legacyHash := sha256.Sum256([]byte(username + "pass"))
+		mockRepo.users[username] = &domain.User{Username: username, PasswordHash: legacyHash[:], CreatedAt: longAgo}
+	}
+
+	if err := svc.RegisterUser(ctx, "current", "currentpass"); err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+
+	report, err := svc.PasswordHashReport(ctx)
+	if err != nil {
+		t.Fatalf("PasswordHashReport() error = %v", err)
+	}
+
+	if report.Users != 3 || report.Legacy != 2 || report.NeedsRehash != 2 || report.LastLogin.Never != 2 {
+		t.Errorf("PasswordHashReport() = %+v, want 3 users, 2 legacy never logged in", report)
+	}
+
+	if count, err := svc.RehashLegacyPasswords(ctx); err != nil || count != 2 {
+		t.Fatalf("RehashLegacyPasswords() = %d, %v, want 2, nil", count, err)
+	}
+
+	if algorithm := authsvc.PasswordHashAlgorithm(mockRepo.users["active"].PasswordHash); algorithm != "sha256+bcrypt" {
+		t.Errorf("PasswordHashAlgorithm() after rehash = %q, want %q", algorithm, "sha256+bcrypt")
+	}
+
+	// Wrapped hashes still verify and are replaced by plain hashes on login
+	if _, err := svc.Login(ctx, "active", "activepass", nil); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if algorithm := authsvc.PasswordHashAlgorithm(mockRepo.users["active"].PasswordHash); algorithm != "bcrypt" {
+		t.Errorf("PasswordHashAlgorithm() after login = %q, want %q", algorithm, "bcrypt")
+	}
+
+	expired, err := svc.ExpireStaleAccounts(ctx, 30*24*time.Hour)
+	if err != nil || len(expired) != 1 || expired[0] != "stale" {
+		t.Fatalf("ExpireStaleAccounts() = %v, %v, want [stale]", expired, err)
+	}
+
+	if _, err := svc.Login(ctx, "stale", "stalepass", nil); !errors.Is(err, domain.ErrAccountExpired) {
+		t.Errorf("Login() of expired account error = %v, want %v", err, domain.ErrAccountExpired)
+	}
+}
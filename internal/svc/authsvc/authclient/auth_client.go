@@ -1,6 +1,13 @@
 package authclient
 
-import "context"
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
 
 // AuthClient defines the interface for validating authentication tokens.
 type AuthClient interface {
@@ -9,3 +16,70 @@ type AuthClient interface {
 	// and any error encountered during validation.
 	Validate(ctx context.Context, token string) (string, bool, error)
 }
+
+// RoleValidator is implemented by AuthClients that also return the roles of the user
+// associated with a token. AuthClients not implementing it authenticate users without roles.
+type RoleValidator interface {
+	// ValidateRoles checks if the given token is valid like AuthClient.Validate,
+	// additionally returning the roles of the user.
+	ValidateRoles(ctx context.Context, token string) (string, []string, bool, error)
+}
+
+// ValidateRoles validates a token using the given client, returning the roles of the user
+// if the client implements RoleValidator, or no roles otherwise.
+func ValidateRoles(ctx context.Context, client AuthClient, token string) (string, []string, bool, error) {
+	if validator, ok := client.(RoleValidator); ok {
+		return validator.ValidateRoles(ctx, token)
+	}
+
+	username, ok, err := client.Validate(ctx, token)
+
+	return username, nil, ok, err
+}
+
+// ClaimsValidator is implemented by AuthClients that also return the claims of a token,
+// i.e. the roles of the user and the audience and scopes of the token.
+type ClaimsValidator interface {
+	// ValidateClaims checks if the given token is valid like AuthClient.Validate,
+	// returning the claims of the token instead of the username.
+	ValidateClaims(ctx context.Context, token string) (domain.AuthToken, bool, error)
+}
+
+// ValidateClaims validates a token using the given client, returning the claims of the token if
+// the client implements ClaimsValidator, or the username and roles as by ValidateRoles otherwise.
+func ValidateClaims(ctx context.Context, client AuthClient, token string) (domain.AuthToken, bool, error) {
+	if validator, ok := client.(ClaimsValidator); ok {
+		return validator.ValidateClaims(ctx, token)
+	}
+
+	username, roles, ok, err := ValidateRoles(ctx, client, token)
+
+	return domain.AuthToken{Username: username, Roles: roles}, ok, err //nolint:exhaustruct
+}
+
+// cloneClaims returns a copy of the claims not sharing their slices.
+func cloneClaims(claims domain.AuthToken) domain.AuthToken {
+	claims.Roles = slices.Clone(claims.Roles)
+	claims.Audience = slices.Clone(claims.Audience)
+	claims.Scopes = slices.Clone(claims.Scopes)
+
+	return claims
+}
+
+// defaultTimeout is the timeout of requests to the auth service if none is configured.
+const defaultTimeout = 10 * time.Second
+
+// requestTimeout returns the configured timeout in seconds as duration, or defaultTimeout if
+// it is not positive, so requests to the auth service never hang indefinitely.
+func requestTimeout(seconds int64) time.Duration {
+	if seconds <= 0 {
+		return defaultTimeout
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// newHTTPClient returns the HTTP client used if none is given, timing out requests after timeout.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout} //nolint:exhaustruct
+}
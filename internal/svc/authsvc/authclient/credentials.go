@@ -0,0 +1,79 @@
+package authclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// APIKeyHeader is the header carrying an auth token as API key.
+	APIKeyHeader = "X-Api-Key"
+	// QueryTokenParam is the URL parameter carrying a signed auth token.
+	QueryTokenParam = "access_token"
+	// BearerScheme is the authorization scheme used for auth tokens.
+	BearerScheme = "Bearer"
+)
+
+// CredentialSource identifies where in a request credentials were found.
+type CredentialSource string
+
+const (
+	CredentialSourceBearer CredentialSource = "bearer"
+	CredentialSourceAPIKey CredentialSource = "apikey"
+	CredentialSourceQuery  CredentialSource = "query"
+)
+
+// Credentials holds an auth token extracted from a request.
+type Credentials struct {
+	Source CredentialSource
+	Token  string
+}
+
+// ParseAuthorization extracts the token from an Authorization header value.
+// Accepts "Bearer <token>" with a case-insensitive scheme as well as a bare token.
+// Returns false if the value is empty or uses a different scheme.
+func ParseAuthorization(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, BearerScheme) {
+		return "", false
+	}
+
+	scheme, token, found := strings.Cut(value, " ")
+	if !found {
+		return value, true // bare token
+	}
+
+	if !strings.EqualFold(scheme, BearerScheme) {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// CredentialsFromRequest extracts credentials from a request, checking in order:
+// - the Authorization header (Bearer scheme or bare token)
+// - the X-Api-Key header
+// - the access_token URL parameter
+// Returns false if no credentials are present.
+func CredentialsFromRequest(r *http.Request) (Credentials, bool) {
+	if token, ok := ParseAuthorization(r.Header.Get(AuthorizationHeader)); ok {
+		return Credentials{Source: CredentialSourceBearer, Token: token}, true
+	}
+
+	if token := strings.TrimSpace(r.Header.Get(APIKeyHeader)); token != "" {
+		return Credentials{Source: CredentialSourceAPIKey, Token: token}, true
+	}
+
+	if token := strings.TrimSpace(r.URL.Query().Get(QueryTokenParam)); token != "" {
+		return Credentials{Source: CredentialSourceQuery, Token: token}, true
+	}
+
+	return Credentials{Source: "", Token: ""}, false
+}
+
+// AuthorizationValue returns the normalized Authorization header value for the given token.
+func AuthorizationValue(token string) string {
+	return BearerScheme + " " + token
+}
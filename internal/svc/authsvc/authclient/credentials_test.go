@@ -0,0 +1,105 @@
+package authclient_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+func TestParseAuthorization(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		value     string
+		wantToken string
+		wantOK    bool
+	}{
+		{name: "bearer token", value: "Bearer abc", wantToken: "abc", wantOK: true},
+		{name: "lowercase scheme", value: "bearer abc", wantToken: "abc", wantOK: true},
+		{name: "extra whitespace", value: "  Bearer   abc  ", wantToken: "abc", wantOK: true},
+		{name: "bare token", value: "abc", wantToken: "abc", wantOK: true},
+		{name: "other scheme", value: "Basic abc", wantOK: false},
+		{name: "scheme without token", value: "Bearer ", wantOK: false},
+		{name: "empty", value: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, ok := authclient.ParseAuthorization(tt.value)
+			if ok != tt.wantOK || token != tt.wantToken {
+				t.Errorf("ParseAuthorization() = (%q, %v), want (%q, %v)", token, ok, tt.wantToken, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCredentialsFromRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		url        string
+		headers    map[string]string
+		wantSource authclient.CredentialSource
+		wantToken  string
+		wantOK     bool
+	}{
+		{
+			name:       "authorization header",
+			url:        "/",
+			headers:    map[string]string{"Authorization": "Bearer abc"},
+			wantSource: authclient.CredentialSourceBearer,
+			wantToken:  "abc",
+			wantOK:     true,
+		},
+		{
+			name:       "api key header",
+			url:        "/",
+			headers:    map[string]string{"X-Api-Key": "abc"},
+			wantSource: authclient.CredentialSourceAPIKey,
+			wantToken:  "abc",
+			wantOK:     true,
+		},
+		{
+			name:       "query token",
+			url:        "/?access_token=abc",
+			wantSource: authclient.CredentialSourceQuery,
+			wantToken:  "abc",
+			wantOK:     true,
+		},
+		{
+			name:       "authorization header takes precedence",
+			url:        "/?access_token=query",
+			headers:    map[string]string{"Authorization": "Bearer header", "X-Api-Key": "apikey"},
+			wantSource: authclient.CredentialSourceBearer,
+			wantToken:  "header",
+			wantOK:     true,
+		},
+		{
+			name:   "no credentials",
+			url:    "/",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			creds, ok := authclient.CredentialsFromRequest(req)
+			if ok != tt.wantOK || creds.Source != tt.wantSource || creds.Token != tt.wantToken {
+				t.Errorf("CredentialsFromRequest() = (%+v, %v), want source %q token %q ok %v",
+					creds, ok, tt.wantSource, tt.wantToken, tt.wantOK)
+			}
+		})
+	}
+}
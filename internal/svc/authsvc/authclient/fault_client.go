@@ -0,0 +1,58 @@
+package authclient
+
+import (
+	"context"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/faults"
+)
+
+// FaultInjectingClient wraps an AuthClient, injecting faults into its calls.
+// Validation is named "authclient.validate".
+type FaultInjectingClient struct {
+	client   AuthClient
+	injector *faults.Injector
+}
+
+var (
+	_ AuthClient      = (*FaultInjectingClient)(nil)
+	_ RoleValidator   = (*FaultInjectingClient)(nil)
+	_ ClaimsValidator = (*FaultInjectingClient)(nil)
+)
+
+// NewFaultInjectingClient wraps an AuthClient into a FaultInjectingClient.
+// Returns the client unchanged if the injector is nil.
+func NewFaultInjectingClient(client AuthClient, injector *faults.Injector) AuthClient {
+	if injector == nil {
+		return client
+	}
+
+	return &FaultInjectingClient{client: client, injector: injector}
+}
+
+// Validate implements AuthClient.Validate.
+func (c *FaultInjectingClient) Validate(ctx context.Context, token string) (string, bool, error) {
+	if err := c.injector.Inject(ctx, "authclient.validate"); err != nil {
+		return "", false, err
+	}
+
+	return c.client.Validate(ctx, token)
+}
+
+// ValidateRoles implements RoleValidator.ValidateRoles, injecting the faults of Validate.
+func (c *FaultInjectingClient) ValidateRoles(ctx context.Context, token string) (string, []string, bool, error) {
+	if err := c.injector.Inject(ctx, "authclient.validate"); err != nil {
+		return "", nil, false, err
+	}
+
+	return ValidateRoles(ctx, c.client, token)
+}
+
+// ValidateClaims implements ClaimsValidator.ValidateClaims, injecting the faults of Validate.
+func (c *FaultInjectingClient) ValidateClaims(ctx context.Context, token string) (domain.AuthToken, bool, error) {
+	if err := c.injector.Inject(ctx, "authclient.validate"); err != nil {
+		return domain.AuthToken{}, false, err
+	}
+
+	return ValidateClaims(ctx, c.client, token)
+}
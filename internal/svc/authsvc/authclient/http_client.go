@@ -2,79 +2,339 @@ package authclient
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"golang.org/x/sync/singleflight"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
 	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
 )
 
+// ErrAuthUnavailable is returned when the auth service responds with a server error.
+var ErrAuthUnavailable = errors.New("auth service unavailable")
+
 const (
 	TraceIDHeader       = "X-Request-ID"
+	TraceparentHeader   = "traceparent"
+	TracestateHeader    = "tracestate"
 	AuthorizationHeader = "Authorization"
+
+	// RolesHeader carries the comma-separated roles of the user in validation responses
+	RolesHeader = "X-Auth-Roles"
+
+	// ExpiresHeader carries the Unix time the token expires at in validation responses
+	ExpiresHeader = "X-Auth-Expires"
+
+	// AudienceHeader carries the comma-separated audience of the token in validation responses
+	AudienceHeader = "X-Auth-Audience"
+
+	// ScopesHeader carries the comma-separated scopes of the token in validation responses
+	ScopesHeader = "X-Auth-Scopes"
 )
 
 // HTTPClientConfig holds configuration for the HTTP auth client.
 type HTTPClientConfig struct {
 	// AuthURL is the endpoint for token validation requests
 	AuthURL string `env:"AUTH_URL" default:"http://localhost:8080/auth/validate"`
+
+	// Coalesce enables sharing a single upstream validation request between
+	// concurrent validations of the same token
+	Coalesce bool `env:"COALESCE" default:"true"`
+
+	// CacheTTL is the maximum duration in seconds successful validations are cached, keyed by
+	// the hash of the token. Validations are never cached beyond the expiry of the token.
+	// Tokens revoked while cached are still accepted until the validation expires. 0 disables caching.
+	CacheTTL int64 `env:"CACHE_TTL" default:"60"`
+
+	// CacheSize is the maximum number of cached validations.
+	CacheSize int `env:"CACHE_SIZE" default:"10000"`
+
+	// Retries is the number of times a validation is retried after a network error or
+	// server error response, 0 to disable retries
+	Retries int `env:"RETRIES" default:"2"`
+
+	// RetryBackoff is the delay in milliseconds before the first retry, doubled for every further retry
+	RetryBackoff int64 `env:"RETRY_BACKOFF" default:"50"`
+
+	// RetryMaxBackoff is the maximum delay in milliseconds between two attempts
+	RetryMaxBackoff int64 `env:"RETRY_MAX_BACKOFF" default:"1000"`
+
+	// RetryJitter is the percentage of each delay that is randomized, spreading the
+	// retries of concurrent requests
+	RetryJitter int `env:"RETRY_JITTER" default:"50"`
+
+	// Timeout is the maximum duration in seconds of a validation including its retries,
+	// 10 if not positive
+	Timeout int64 `env:"TIMEOUT" default:"10"`
 }
 
 // HTTPClient implements AuthClient using HTTP requests to validate tokens.
 type HTTPClient struct {
 	httpClient *http.Client
+	group      *singleflight.Group
+	cache      *validationCache
 	log        logging.Logger
 	cfg        HTTPClientConfig
 }
 
-var _ AuthClient = (*HTTPClient)(nil)
+// validateResult is the shared result of a coalesced validation.
+type validateResult struct {
+	token   domain.AuthToken // Claims of the token returned by the auth service
+	ok      bool
+	expires time.Time // Expiry of the token, zero if unknown
+}
+
+var (
+	_ AuthClient      = (*HTTPClient)(nil)
+	_ RoleValidator   = (*HTTPClient)(nil)
+	_ ClaimsValidator = (*HTTPClient)(nil)
+)
 
 // NewHTTPClient creates a new HTTPClient with the given configuration.
-// If httpClient is nil, http.DefaultClient will be used.
+// If httpClient is nil, a client timing out after the configured Timeout will be used.
 func NewHTTPClient(
 	cfg HTTPClientConfig,
 	httpClient *http.Client,
 ) *HTTPClient {
 	if httpClient == nil {
-		httpClient = http.DefaultClient
+		httpClient = newHTTPClient(requestTimeout(cfg.Timeout))
 	}
 
 	return &HTTPClient{
 		httpClient: httpClient,
+		group:      new(singleflight.Group),
+		cache:      newValidationCache(time.Duration(cfg.CacheTTL)*time.Second, cfg.CacheSize),
 		log:        logging.GetLogger("svc.authsvc.http_client"),
 		cfg:        cfg,
 	}
 }
 
 // Validate implements AuthClient.Validate by making an HTTP request to the configured
-// auth service endpoint. The token is sent in the Authorization header.
+// auth service endpoint. The token is sent in the Authorization header using the Bearer scheme.
+// Tokens with or without a "Bearer" prefix are accepted.
+// If Coalesce is enabled, concurrent validations of the same token share one upstream request.
+// If CacheTTL is set, successful validations are answered from the cache without a request.
+// Requests failing with a network error or server error response are retried up to Retries times,
+// and validations time out after Timeout.
 func (ht *HTTPClient) Validate(ctx context.Context, token string) (string, bool, error) {
+	username, _, ok, err := ht.ValidateRoles(ctx, token)
+
+	return username, ok, err
+}
+
+// ValidateRoles implements RoleValidator.ValidateRoles like Validate, reading the roles
+// from the RolesHeader of the auth service response.
+func (ht *HTTPClient) ValidateRoles(ctx context.Context, token string) (string, []string, bool, error) {
+	claims, ok, err := ht.ValidateClaims(ctx, token)
+
+	return claims.Username, claims.Roles, ok, err
+}
+
+// ValidateClaims implements ClaimsValidator.ValidateClaims like Validate, reading the roles,
+// audience and scopes from the RolesHeader, AudienceHeader and ScopesHeader of the auth
+// service response.
+func (ht *HTTPClient) ValidateClaims(ctx context.Context, token string) (domain.AuthToken, bool, error) {
+	token, ok := ParseAuthorization(token)
+	if !ok {
+		return domain.AuthToken{}, false, nil
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	if result, ok := ht.cache.get(string(key[:]), time.Now()); ok {
+		ht.log.DebugContext(ctx, "token validation cached")
+
+		// Cached results must not share the claim slices
+		return cloneClaims(result.token), result.ok, nil
+	}
+
+	if !ht.cfg.Coalesce {
+		validateCtx, cancel := context.WithTimeout(ctx, requestTimeout(ht.cfg.Timeout))
+		defer cancel()
+
+		result, err := ht.validateWithRetry(validateCtx, token)
+		if err == nil {
+			ht.cache.put(string(key[:]), result, time.Now())
+		}
+
+		return result.token, result.ok, err
+	}
+
+	// The shared request must not be cancelled when the caller that started it goes away,
+	// as other callers may still be waiting for its result. It times out on its own instead,
+	// so a hanging auth service does not block the callers of the token indefinitely.
+	resultCh := ht.group.DoChan(string(key[:]), func() (any, error) {
+		validateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout(ht.cfg.Timeout))
+		defer cancel()
+
+		result, err := ht.validateWithRetry(validateCtx, token)
+		if err == nil {
+			ht.cache.put(string(key[:]), result, time.Now())
+		}
+
+		return result, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return domain.AuthToken{}, false, fmt.Errorf("validate: %w", ctx.Err())
+	case res := <-resultCh:
+		if res.Shared {
+			ht.log.DebugContext(ctx, "token validation coalesced")
+		}
+
+		if res.Err != nil {
+			return domain.AuthToken{}, false, res.Err
+		}
+
+		result, _ := res.Val.(validateResult)
+
+		// Shared results must not share the claim slices
+		return cloneClaims(result.token), result.ok, nil
+	}
+}
+
+// Probe checks whether the auth service is reachable by sending a validation request
+// without credentials. Any response other than a server error counts as reachable.
+func (ht *HTTPClient) Probe(ctx context.Context) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ht.cfg.AuthURL, nil)
 	if err != nil {
-		return "", false, fmt.Errorf("new request: %w", err)
+		return fmt.Errorf("new request: %w", err)
+	}
+
+	resp, err := ht.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s", ErrAuthUnavailable, resp.Status)
+	}
+
+	return nil
+}
+
+// validateWithRetry validates the token, retrying after transient errors with exponential
+// backoff and jitter up to the configured number of retries.
+func (ht *HTTPClient) validateWithRetry(ctx context.Context, token string) (validateResult, error) {
+	backoff := max(time.Duration(ht.cfg.RetryBackoff)*time.Millisecond, time.Millisecond)
+	maxBackoff := max(time.Duration(ht.cfg.RetryMaxBackoff)*time.Millisecond, backoff)
 
-	req.Header.Set(AuthorizationHeader, token)
+	for attempt := 1; ; attempt++ {
+		result, err := ht.validate(ctx, token)
+		if err == nil || attempt > ht.cfg.Retries || !isTransient(ctx, err) {
+			return result, err
+		}
+
+		delay := jitter(backoff, ht.cfg.RetryJitter)
+		ht.log.WarnContext(ctx, "token validation failed, retrying", "attempt", attempt, "backoff", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return validateResult{}, fmt.Errorf("validate: %w", errors.Join(ctx.Err(), err))
+		case <-timer.C:
+		}
+
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// isTransient reports whether a validation failed due to a network error or server error
+// response, rather than the cancellation of the context.
+func isTransient(ctx context.Context, err error) bool {
+	var netErr net.Error
+
+	return ctx.Err() == nil && (errors.Is(err, ErrAuthUnavailable) || errors.As(err, &netErr))
+}
+
+// jitter randomizes percent of the delay, returning a delay in [delay*(1-percent/100), delay].
+func jitter(delay time.Duration, percent int) time.Duration {
+	spread := int64(delay) * int64(min(max(percent, 0), 100)) / 100
+	if spread <= 0 {
+		return delay
+	}
+
+	return delay - time.Duration(rand.Int64N(spread+1)) //nolint:gosec
+}
+
+func (ht *HTTPClient) validate(ctx context.Context, token string) (validateResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ht.cfg.AuthURL, nil)
+	if err != nil {
+		return validateResult{}, fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set(AuthorizationHeader, AuthorizationValue(token))
 
 	if traceID, ok := context_.TraceIDFromContext(ctx); ok {
 		req.Header.Set(TraceIDHeader, traceID)
 	}
 
+	if spanCtx, ok := context_.SpanContextFromContext(ctx); ok {
+		req.Header.Set(TraceparentHeader, spanCtx.Traceparent())
+
+		if spanCtx.TraceState != "" {
+			req.Header.Set(TracestateHeader, spanCtx.TraceState)
+		}
+	}
+
 	resp, err := ht.httpClient.Do(req)
 	if err != nil {
-		return "", false, fmt.Errorf("post: %w", err)
+		return validateResult{}, fmt.Errorf("post: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", false, nil
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return validateResult{}, fmt.Errorf("%w: %s", ErrAuthUnavailable, resp.Status)
+	} else if resp.StatusCode != http.StatusOK {
+		return validateResult{}, nil
 	}
 
 	username, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", false, fmt.Errorf("read string: %w", err)
+		return validateResult{}, fmt.Errorf("read string: %w", err)
+	}
+
+	claims := domain.AuthToken{
+		Username:  string(username),
+		Issuer:    "",
+		IssuedAt:  0,
+		ExpiresAt: 0,
+		Roles:     headerList(resp.Header, RolesHeader),
+		Audience:  headerList(resp.Header, AudienceHeader),
+		Scopes:    headerList(resp.Header, ScopesHeader),
+	}
+
+	var expires time.Time
+	if header := resp.Header.Get(ExpiresHeader); header != "" {
+		if unix, err := strconv.ParseInt(header, 10, 64); err == nil {
+			claims.ExpiresAt = unix
+			expires = time.Unix(unix, 0)
+		}
+	}
+
+	return validateResult{token: claims, ok: true, expires: expires}, nil
+}
+
+// headerList returns the elements of a comma-separated header, nil if it is not set.
+func headerList(header http.Header, key string) []string {
+	if value := header.Get(key); value != "" {
+		return strings.Split(value, ",")
 	}
 
-	return string(username), true, nil
+	return nil
 }
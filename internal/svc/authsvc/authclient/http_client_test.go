@@ -0,0 +1,239 @@
+package authclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+func TestHTTPClient_ValidateCoalescing(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls   atomic.Int32
+		release = make(chan struct{})
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.Header().Set(authclient.RolesHeader, "admin,editor")
+		_, _ = w.Write([]byte("testuser"))
+	}))
+	t.Cleanup(server.Close)
+
+	client := authclient.NewHTTPClient(authclient.HTTPClientConfig{
+		AuthURL:  server.URL,
+		Coalesce: true,
+	}, server.Client())
+
+	const concurrency = 50
+
+	var wg sync.WaitGroup
+
+	for i := range concurrency {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if i%2 == 0 {
+				username, ok, err := client.Validate(context.Background(), "Bearer valid")
+				if err != nil || !ok || username != "testuser" {
+					t.Errorf("Validate() = (%q, %v, %v), want (%q, true, nil)", username, ok, err, "testuser")
+				}
+
+				return
+			}
+
+			username, roles, ok, err := client.ValidateRoles(context.Background(), "Bearer valid")
+			if err != nil || !ok || username != "testuser" || !slices.Equal(roles, []string{"admin", "editor"}) {
+				t.Errorf("ValidateRoles() = (%q, %v, %v, %v), want (%q, [admin editor], true, nil)",
+					username, roles, ok, err, "testuser")
+			}
+		}()
+	}
+
+	// Give all goroutines a chance to join the in-flight request
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
+
+func TestHTTPClient_ValidateTimeout(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	for _, coalesce := range []bool{false, true} {
+		t.Run("coalesce="+strconv.FormatBool(coalesce), func(t *testing.T) {
+			t.Parallel()
+
+			client := authclient.NewHTTPClient(authclient.HTTPClientConfig{
+				AuthURL:  server.URL,
+				Coalesce: coalesce,
+				Timeout:  1,
+			}, nil)
+
+			// The caller does not time out, so only the validation itself can
+			started := time.Now()
+
+			if _, ok, err := client.Validate(context.Background(), "Bearer valid"); err == nil || ok {
+				t.Errorf("Validate() = (%v, %v), want an error", ok, err)
+			}
+
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("Validate() took %v, want at most the timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_ValidateCache(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		token     string
+		expires   time.Duration // Expiry of the token relative to now, no header if 0
+		cacheTTL  int64
+		wantCalls int32
+	}{
+		{name: "cached", token: "valid", expires: time.Hour, cacheTTL: 60, wantCalls: 1},
+		{name: "caching disabled", token: "valid", expires: time.Hour, wantCalls: 3},
+		{name: "unknown expiry", token: "valid", cacheTTL: 60, wantCalls: 3},
+		{name: "expired", token: "valid", expires: -time.Minute, cacheTTL: 60, wantCalls: 3},
+		{name: "invalid token", token: "invalid", expires: time.Hour, cacheTTL: 60, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+
+				if r.Header.Get("Authorization") != "Bearer valid" {
+					w.WriteHeader(http.StatusUnauthorized)
+
+					return
+				}
+
+				if tt.expires != 0 {
+					w.Header().Set(authclient.ExpiresHeader, strconv.FormatInt(time.Now().Add(tt.expires).Unix(), 10))
+				}
+
+				w.Header().Set(authclient.RolesHeader, "admin")
+				_, _ = w.Write([]byte("testuser"))
+			}))
+			t.Cleanup(server.Close)
+
+			client := authclient.NewHTTPClient(authclient.HTTPClientConfig{
+				AuthURL:   server.URL,
+				Coalesce:  true,
+				CacheTTL:  tt.cacheTTL,
+				CacheSize: 10,
+			}, server.Client())
+
+			for range 3 {
+				username, roles, ok, err := client.ValidateRoles(context.Background(), "Bearer "+tt.token)
+				if err != nil {
+					t.Fatalf("ValidateRoles() error = %v", err)
+				}
+
+				if valid := tt.token == "valid"; ok != valid ||
+					valid && (username != "testuser" || !slices.Equal(roles, []string{"admin"})) {
+					t.Errorf("ValidateRoles() = (%q, %v, %v), want valid %v", username, roles, ok, valid)
+				}
+			}
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_ValidateRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		failures  int32 // Number of requests failing before the auth service recovers
+		status    int   // Status of the failing requests
+		retries   int
+		wantOK    bool
+		wantErr   error
+		wantCalls int32
+	}{
+		{name: "no failures", retries: 2, wantOK: true, wantCalls: 1},
+		{name: "recovered", failures: 2, status: http.StatusServiceUnavailable, retries: 2, wantOK: true, wantCalls: 3},
+		{name: "exhausted", failures: 3, status: http.StatusBadGateway, retries: 2, wantErr: authclient.ErrAuthUnavailable, wantCalls: 3},
+		{name: "retries disabled", failures: 1, status: http.StatusInternalServerError, wantErr: authclient.ErrAuthUnavailable, wantCalls: 1},
+		{name: "client error not retried", failures: 1, status: http.StatusUnauthorized, retries: 2, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					w.WriteHeader(tt.status)
+
+					return
+				}
+
+				_, _ = w.Write([]byte("testuser"))
+			}))
+			t.Cleanup(server.Close)
+
+			client := authclient.NewHTTPClient(authclient.HTTPClientConfig{
+				AuthURL:         server.URL,
+				Retries:         tt.retries,
+				RetryBackoff:    1,
+				RetryMaxBackoff: 5,
+				RetryJitter:     50,
+			}, server.Client())
+
+			_, ok, err := client.Validate(context.Background(), "Bearer valid")
+			if !errors.Is(err, tt.wantErr) || ok != tt.wantOK {
+				t.Errorf("Validate() = (%v, %v), want (%v, %v)", ok, err, tt.wantOK, tt.wantErr)
+			}
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package authclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// JWTAlgorithm is the JWS algorithm of auth tokens (RFC 7518, RSASSA-PKCS1-v1_5 using SHA-256).
+const JWTAlgorithm = "RS256"
+
+// JWTHeader is the JOSE header of a JWT.
+type JWTHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWTClaims are the registered JWT claims (RFC 7519) carried by auth tokens.
+type JWTClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+
+	// AuthTime is the time of the login the token descends from by renewals (OIDC Core 1.0)
+	AuthTime int64 `json:"auth_time,omitempty"`
+
+	// Audience lists the services the token is intended for
+	Audience JWTAudience `json:"aud,omitempty"`
+
+	// Scope is the space-separated list of scopes granted to the token (RFC 9068)
+	Scope string `json:"scope,omitempty"`
+
+	// Roles is a private claim carrying the roles of the user
+	Roles []string `json:"roles,omitempty"`
+
+	// Remember is a private claim marking tokens of persistent "remember me" sessions
+	Remember bool `json:"remember,omitempty"`
+}
+
+// JWTAudience is the "aud" claim, which is either a single string or an array of strings (RFC 7519).
+type JWTAudience []string
+
+// UnmarshalJSON implements json.Unmarshaler, accepting a single audience as string.
+func (a *JWTAudience) UnmarshalJSON(data []byte) error {
+	var audience string
+	if err := json.Unmarshal(data, &audience); err == nil {
+		*a = JWTAudience{audience}
+
+		return nil
+	}
+
+	var audiences []string
+	if err := json.Unmarshal(data, &audiences); err != nil {
+		return fmt.Errorf("unmarshal audience: %w", err)
+	}
+
+	*a = audiences
+
+	return nil
+}
+
+// KeyFunc returns the public key with the given ID verifying a token.
+type KeyFunc func(ctx context.Context, kid string) (*rsa.PublicKey, error)
+
+// VerifyToken verifies a compact JWT by:
+// - Splitting it into header, claims and signature
+// - Rejecting any algorithm but RS256
+// - Verifying the RSASSA-PKCS1-v1_5 signature using SHA256 with the key returned by keyFunc
+// for the "kid" header
+// - Parsing the claims into an AuthToken
+// - Checking the token was issued before now and has not expired, allowing for leeway clock skew
+// Returns domain.ErrInvalidAuthToken for any validation failure, joined with domain.ErrBadSignature,
+// domain.ErrTokenNotYetValid or domain.ErrTokenExpired if the token failed for that reason.
+// Errors of keyFunc are returned as is.
+func VerifyToken(
+	ctx context.Context,
+	tokenString string,
+	keyFunc KeyFunc,
+	now time.Time,
+	leeway time.Duration,
+) (domain.AuthToken, error) {
+	segments := strings.Split(tokenString, ".")
+	if len(segments) != 3 { //nolint:mnd // header, claims, signature
+		return domain.AuthToken{}, domain.ErrInvalidAuthToken
+	}
+
+	// Check header
+	var header JWTHeader
+	if err := decodeJWTSegment(segments[0], &header); err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, fmt.Errorf("decode header: %w", err))
+	} else if header.Alg != JWTAlgorithm {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, fmt.Errorf("unsupported algorithm %q", header.Alg))
+	}
+
+	// Verify signature
+	signature, err := keyEncoding.DecodeString(segments[2])
+	if err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, fmt.Errorf("decode signature: %w", err))
+	}
+
+	publicKey, err := keyFunc(ctx, header.Kid)
+	if err != nil {
+		return domain.AuthToken{}, fmt.Errorf("public key: %w", err)
+	}
+
+	hashed := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, domain.ErrBadSignature)
+	}
+
+	// Parse claims
+	var claims JWTClaims
+	if err := decodeJWTSegment(segments[1], &claims); err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, fmt.Errorf("decode claims: %w", err))
+	}
+
+	if err := CheckTokenTimes(claims.IssuedAt, claims.ExpiresAt, now, leeway); err != nil {
+		return domain.AuthToken{}, err
+	}
+
+	var scopes []string
+	if claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+
+	return domain.AuthToken{
+		Username:  claims.Subject,
+		Issuer:    claims.Issuer,
+		IssuedAt:  claims.IssuedAt,
+		ExpiresAt: claims.ExpiresAt,
+		AuthTime:  claims.AuthTime,
+		Roles:     claims.Roles,
+		Audience:  claims.Audience,
+		Scopes:    scopes,
+		Remember:  claims.Remember,
+	}, nil
+}
+
+// CheckTokenTimes checks a token issued at issuedAt and expiring at expiresAt (Unix times) is
+// valid at now. Clocks of issuer and validator may drift apart, so the validity is extended
+// by leeway in both directions.
+func CheckTokenTimes(issuedAt, expiresAt int64, now time.Time, leeway time.Duration) error {
+	if time.Unix(issuedAt, 0).After(now.Add(leeway)) {
+		return errors.Join(domain.ErrInvalidAuthToken, domain.ErrTokenNotYetValid)
+	}
+
+	if time.Unix(expiresAt, 0).Before(now.Add(-leeway)) {
+		return errors.Join(domain.ErrInvalidAuthToken, domain.ErrTokenExpired)
+	}
+
+	return nil
+}
+
+// decodeJWTSegment decodes a base64url-encoded JSON segment of a JWT into v.
+func decodeJWTSegment(segment string, v any) error {
+	data, err := keyEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("decode base64: %w", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshal json: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package authclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// Auth client modes, selecting how tokens are validated.
+const (
+	// ModeHTTP validates tokens by requests to the auth service
+	ModeHTTP = "http"
+	// ModeLocal validates tokens locally using the public key of the auth service
+	ModeLocal = "local"
+)
+
+var (
+	// ErrUnknownMode is returned when the configured auth client mode does not exist.
+	ErrUnknownMode = errors.New("unknown auth client mode")
+	// ErrInvalidPublicKey is returned when the configured public key file holds no RSA public key.
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// PublicKeyClientConfig holds configuration for validating tokens locally.
+type PublicKeyClientConfig struct {
+	// PublicKeyFile is a PEM file holding the public key of the auth service,
+	// empty to fetch the keys from the JWKS endpoint of the auth service
+	PublicKeyFile string `env:"PUBLIC_KEY_FILE" default:""`
+
+	// Leeway is the clock skew in seconds tolerated between the auth service and this client
+	Leeway int64 `env:"LEEWAY" default:"30"`
+
+	// Keys configures fetching the keys from the JWKS endpoint, used without PublicKeyFile
+	Keys PublicKeyConfig `envPrefix:"KEYS_"`
+}
+
+// PublicKeyAuthClient implements AuthClient by verifying the signature and validity of tokens
+// locally, without a request to the auth service per token. Revoked tokens are accepted
+// until they expire, as the auth service is not asked.
+type PublicKeyAuthClient struct {
+	keys   KeyFunc
+	source *PublicKeySource // Source of the keys, nil if read from a file
+	leeway time.Duration
+	log    logging.Logger
+}
+
+var (
+	_ AuthClient      = (*PublicKeyAuthClient)(nil)
+	_ RoleValidator   = (*PublicKeyAuthClient)(nil)
+	_ ClaimsValidator = (*PublicKeyAuthClient)(nil)
+)
+
+// NewPublicKeyAuthClient creates a PublicKeyAuthClient verifying tokens with the key of the
+// configured public key file, or with the keys of the JWKS endpoint.
+// If httpClient is nil, a client timing out after the configured Keys.Timeout will be used to fetch keys.
+// Returns ErrInvalidPublicKey if the public key file holds no RSA public key.
+func NewPublicKeyAuthClient(cfg PublicKeyClientConfig, httpClient *http.Client) (*PublicKeyAuthClient, error) {
+	client := &PublicKeyAuthClient{
+		keys:   nil,
+		source: nil,
+		leeway: time.Duration(cfg.Leeway) * time.Second,
+		log:    logging.GetLogger("svc.authsvc.public_key_client"),
+	}
+
+	if cfg.PublicKeyFile == "" {
+		client.source = NewPublicKeySource(cfg.Keys, httpClient)
+		client.keys = client.source.PublicKey
+
+		return client, nil
+	}
+
+	key, err := readPublicKeyFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read public key %s: %w", cfg.PublicKeyFile, err)
+	}
+
+	// The file holds the only trusted key, so the "kid" header is not needed to select it
+	client.keys = func(context.Context, string) (*rsa.PublicKey, error) { return key, nil }
+
+	return client, nil
+}
+
+// Validate implements AuthClient.Validate by verifying the token locally.
+// Tokens with or without a "Bearer" prefix are accepted.
+func (pc *PublicKeyAuthClient) Validate(ctx context.Context, token string) (string, bool, error) {
+	username, _, ok, err := pc.ValidateRoles(ctx, token)
+
+	return username, ok, err
+}
+
+// ValidateRoles implements RoleValidator.ValidateRoles like Validate, reading the roles
+// from the claims of the token.
+func (pc *PublicKeyAuthClient) ValidateRoles(ctx context.Context, token string) (string, []string, bool, error) {
+	claims, ok, err := pc.ValidateClaims(ctx, token)
+
+	return claims.Username, claims.Roles, ok, err
+}
+
+// ValidateClaims implements ClaimsValidator.ValidateClaims like Validate, returning the claims
+// of the token. Tokens signed by an unknown key are invalid.
+// Returns an error if the keys cannot be fetched from the auth service.
+func (pc *PublicKeyAuthClient) ValidateClaims(ctx context.Context, token string) (domain.AuthToken, bool, error) {
+	token, ok := ParseAuthorization(token)
+	if !ok {
+		return domain.AuthToken{}, false, nil
+	}
+
+	claims, err := VerifyToken(ctx, token, pc.keys, time.Now(), pc.leeway)
+	if errors.Is(err, domain.ErrInvalidAuthToken) || errors.Is(err, ErrUnknownKey) {
+		pc.log.DebugContext(ctx, "token invalid", "error", err)
+
+		return domain.AuthToken{}, false, nil
+	} else if err != nil {
+		return domain.AuthToken{}, false, err
+	}
+
+	return claims, true, nil
+}
+
+// Probe checks that the keys verifying tokens are available, fetching them from the
+// auth service unless they are read from a file.
+func (pc *PublicKeyAuthClient) Probe(ctx context.Context) error {
+	if pc.source == nil {
+		return nil
+	}
+
+	return pc.source.Probe(ctx)
+}
+
+// readPublicKeyFile reads an RSA public key from a PEM file, encoded either as
+// SubjectPublicKeyInfo ("PUBLIC KEY") or PKCS #1 ("RSA PUBLIC KEY").
+func readPublicKeyFile(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block", ErrInvalidPublicKey)
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+		}
+
+		return key, nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+		}
+
+		key, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T is no RSA key", ErrInvalidPublicKey, parsed)
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: PEM block type %q", ErrInvalidPublicKey, block.Type)
+	}
+}
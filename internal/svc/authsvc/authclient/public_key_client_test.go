@@ -0,0 +1,133 @@
+package authclient_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+func TestPublicKeyAuthClient(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(domain.JWKSet{Keys: []domain.JWK{authsvc.PublicJWK(&key.PublicKey)}})
+	}))
+	t.Cleanup(server.Close)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	now := time.Now().Unix()
+	sign := func(t *testing.T, privateKey *rsa.PrivateKey, issuedAt, expiresAt int64) string {
+		t.Helper()
+
+		token, err := authsvc.SignToken(domain.AuthToken{
+			Username:  "testuser",
+			Issuer:    "authsvc",
+			IssuedAt:  issuedAt,
+			ExpiresAt: expiresAt,
+			Roles:     []string{"admin"},
+		}, privateKey)
+		if err != nil {
+			t.Fatalf("SignToken() error = %v", err)
+		}
+
+		return token
+	}
+
+	configs := map[string]authclient.PublicKeyClientConfig{
+		"file": {PublicKeyFile: keyFile, Leeway: 30, Keys: authclient.PublicKeyConfig{}},
+		"jwks": {PublicKeyFile: "", Leeway: 30, Keys: authclient.PublicKeyConfig{JWKSURL: server.URL, CacheTTL: 3600}},
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		wantOK bool
+	}{
+		{name: "valid", token: "Bearer " + sign(t, key, now, now+3600), wantOK: true},
+		{name: "valid without prefix", token: sign(t, key, now, now+3600), wantOK: true},
+		{name: "expired within leeway", token: sign(t, key, now-3600, now-10), wantOK: true},
+		{name: "expired", token: sign(t, key, now-3600, now-60), wantOK: false},
+		{name: "not yet valid", token: sign(t, key, now+60, now+3600), wantOK: false},
+		{name: "other key", token: sign(t, other, now, now+3600), wantOK: false},
+		{name: "malformed", token: "Bearer not.a.token", wantOK: false},
+		{name: "empty", token: "", wantOK: false},
+	}
+
+	for mode, cfg := range configs {
+		client, err := authclient.NewPublicKeyAuthClient(cfg, server.Client())
+		if err != nil {
+			t.Fatalf("NewPublicKeyAuthClient(%s) error = %v", mode, err)
+		}
+
+		if err := client.Probe(context.Background()); err != nil {
+			t.Errorf("Probe(%s) error = %v", mode, err)
+		}
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				username, roles, ok, err := client.ValidateRoles(context.Background(), tt.token)
+				if err != nil {
+					t.Fatalf("ValidateRoles() error = %v", err)
+				}
+
+				if ok != tt.wantOK {
+					t.Fatalf("ValidateRoles() ok = %v, want %v", ok, tt.wantOK)
+				}
+
+				if ok && (username != "testuser" || !slices.Equal(roles, []string{"admin"})) {
+					t.Errorf("ValidateRoles() = %q, %v, want %q, [admin]", username, roles, "testuser")
+				}
+			})
+		}
+	}
+
+	t.Run("invalid key file", func(t *testing.T) {
+		t.Parallel()
+
+		invalidFile := filepath.Join(t.TempDir(), "invalid.pem")
+		if err := os.WriteFile(invalidFile, []byte("no key"), 0o600); err != nil {
+			t.Fatalf("write key: %v", err)
+		}
+
+		_, err := authclient.NewPublicKeyAuthClient(authclient.PublicKeyClientConfig{PublicKeyFile: invalidFile}, nil)
+		if !errors.Is(err, authclient.ErrInvalidPublicKey) {
+			t.Errorf("NewPublicKeyAuthClient() error = %v, want %v", err, authclient.ErrInvalidPublicKey)
+		}
+	})
+}
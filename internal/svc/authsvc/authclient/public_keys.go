@@ -0,0 +1,468 @@
+package authclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+var (
+	// ErrUnknownKey is returned when the auth service does not serve a key with the requested ID.
+	ErrUnknownKey = errors.New("unknown public key")
+	// ErrUntrustedKey is returned when no served key matches its ID and the configured fingerprints.
+	ErrUntrustedKey = errors.New("untrusted public key")
+)
+
+const (
+	// maxJWKSSize is the maximum size of JWKS responses in bytes.
+	maxJWKSSize = 1 << 20
+
+	// maxUnknownKeys is the maximum number of remembered unknown key IDs.
+	maxUnknownKeys = 1024
+)
+
+// keyEncoding encodes the members of JWKs and thumbprints.
+//
+//nolint:gochecknoglobals
+var keyEncoding = base64.RawURLEncoding
+
+// PublicKeyConfig holds configuration for fetching the public keys verifying tokens.
+type PublicKeyConfig struct {
+	// JWKSURL is the JSON Web Key Set endpoint of the auth service
+	JWKSURL string `env:"JWKS_URL" default:"http://localhost:8080/.well-known/jwks.json"`
+
+	// CacheFile is the file keeping fetched keys across restarts, empty to keep them in memory only
+	CacheFile string `env:"CACHE_FILE" default:""`
+
+	// CacheTTL is the duration in seconds fetched keys are used before they are fetched again.
+	// Expired keys are still used while the auth service is unavailable.
+	CacheTTL int64 `env:"CACHE_TTL" default:"3600"`
+
+	// Fingerprints is the comma-separated list of trusted key thumbprints (RFC 7638), as found in
+	// the "kid" header of tokens. Keys not listed are rejected, which prevents substituted keys
+	// from being trusted. Empty trusts any key served by the auth service.
+	Fingerprints string `env:"FINGERPRINTS" default:""`
+
+	// RefreshInterval is the minimum duration in seconds between two fetches of the keys, so
+	// tokens with unknown key IDs cannot make the auth service fetch them for every request
+	RefreshInterval int64 `env:"REFRESH_INTERVAL" default:"30"`
+
+	// UnknownKeyTTL is the duration in seconds key IDs not served by the auth service are
+	// rejected without fetching the keys again
+	UnknownKeyTTL int64 `env:"UNKNOWN_KEY_TTL" default:"300"`
+
+	// Timeout is the maximum duration in seconds of fetching the keys, 10 if not positive
+	Timeout int64 `env:"TIMEOUT" default:"10"`
+}
+
+// PublicKeySource provides the public keys verifying tokens, as served by the JWKS endpoint of
+// the auth service. Keys are cached in memory and, if configured, on disk, so they are available
+// while the auth service restarts. Every key must match its thumbprint and, if configured, one
+// of the trusted fingerprints, both when fetched and when loaded from disk.
+// Concurrent fetches are coalesced, and fetches are at least RefreshInterval apart.
+// PublicKeySource is safe for concurrent use.
+type PublicKeySource struct {
+	httpClient   *http.Client
+	fingerprints []string
+	group        *singleflight.Group
+	mu           sync.Mutex
+	cached       publicKeyCache
+	keys         map[string]*rsa.PublicKey
+	unknown      map[string]time.Time // Expiry of the rejection of unknown key IDs
+	refreshedAt  time.Time            // Time of the last fetch, successful or not
+	refreshErr   error                // Error of the last fetch
+	log          logging.Logger
+	cfg          PublicKeyConfig
+}
+
+// publicKeyCache is the cached key set along with its expiry, as stored in the cache file.
+type publicKeyCache struct {
+	FetchedAt time.Time     `json:"fetched_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	Keys      domain.JWKSet `json:"keys"`
+}
+
+// NewPublicKeySource creates a PublicKeySource with the given configuration.
+// If httpClient is nil, a client timing out after the configured Timeout will be used.
+func NewPublicKeySource(cfg PublicKeyConfig, httpClient *http.Client) *PublicKeySource {
+	if httpClient == nil {
+		httpClient = newHTTPClient(requestTimeout(cfg.Timeout))
+	}
+
+	var fingerprints []string
+
+	for _, fingerprint := range strings.Split(cfg.Fingerprints, ",") {
+		if fingerprint = strings.TrimSpace(fingerprint); fingerprint != "" {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+
+	return &PublicKeySource{
+		httpClient:   httpClient,
+		fingerprints: fingerprints,
+		group:        new(singleflight.Group),
+		mu:           sync.Mutex{},
+		cached:       publicKeyCache{FetchedAt: time.Time{}, ExpiresAt: time.Time{}, Keys: domain.JWKSet{Keys: nil}},
+		keys:         nil,
+		unknown:      make(map[string]time.Time),
+		refreshedAt:  time.Time{},
+		refreshErr:   nil,
+		log:          logging.GetLogger("svc.authsvc.public_keys"),
+		cfg:          cfg,
+	}
+}
+
+// PublicKey returns the trusted public key with the given ID. Keys are fetched again once the
+// cached keys expire, or if the ID is unknown, e.g. after the auth service rotated its key.
+// Fetches are at least RefreshInterval apart, and IDs still unknown after a fetch are rejected
+// without fetching again for UnknownKeyTTL.
+// Returns ErrUnknownKey if no trusted key has the ID.
+func (s *PublicKeySource) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+
+	if s.keys == nil {
+		s.loadCacheFile(ctx)
+	}
+
+	key, ok := s.keys[kid]
+	expired := !now.Before(s.cached.ExpiresAt)
+	throttled := !s.refreshedAt.IsZero() && now.Before(s.refreshedAt.Add(time.Duration(s.cfg.RefreshInterval)*time.Second))
+	rejectedUntil, rejected := s.unknown[kid]
+	lastErr := s.refreshErr
+
+	s.mu.Unlock()
+
+	switch {
+	case ok && (!expired || throttled):
+		return key, nil
+	case !ok && rejected && now.Before(rejectedUntil):
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	case !ok && throttled:
+		// Keys that could not be fetched at all are unavailable rather than unknown
+		if lastErr != nil && s.keysEmpty() {
+			return nil, lastErr
+		}
+
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if err := s.refreshShared(ctx); err != nil {
+		// Expired keys keep tokens verifiable while the auth service is unavailable
+		if ok {
+			s.log.WarnContext(ctx, "using expired public key", "kid", kid, "error", err)
+
+			return key, nil
+		}
+
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok = s.keys[kid]
+	if !ok {
+		s.rejectUnknown(kid, now)
+
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	return key, nil
+}
+
+// Probe fetches the keys from the auth service unless cached keys are unexpired, so the
+// keys are available before the first token is verified.
+func (s *PublicKeySource) Probe(ctx context.Context) error {
+	s.mu.Lock()
+
+	if s.keys == nil {
+		s.loadCacheFile(ctx)
+	}
+
+	fresh := s.keys != nil && time.Now().Before(s.cached.ExpiresAt)
+
+	s.mu.Unlock()
+
+	if fresh {
+		return nil
+	}
+
+	return s.refreshShared(ctx)
+}
+
+// keysEmpty reports whether no keys are cached.
+func (s *PublicKeySource) keysEmpty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keys) == 0
+}
+
+// rejectUnknown remembers that the auth service does not serve a key with the given ID.
+// The remembered IDs are forgotten once there are too many, so random IDs cannot exhaust memory.
+// Must be called with s.mu held.
+func (s *PublicKeySource) rejectUnknown(kid string, now time.Time) {
+	if len(s.unknown) >= maxUnknownKeys {
+		clear(s.unknown)
+	}
+
+	s.unknown[kid] = now.Add(time.Duration(s.cfg.UnknownKeyTTL) * time.Second)
+}
+
+// refreshShared fetches the keys like refresh, sharing one fetch between concurrent callers.
+// The shared fetch is not cancelled when the caller that started it goes away, as other
+// callers may still be waiting for its result, but times out after the configured Timeout.
+func (s *PublicKeySource) refreshShared(ctx context.Context) error {
+	resultCh := s.group.DoChan("refresh", func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout(s.cfg.Timeout))
+		defer cancel()
+
+		return nil, s.refresh(fetchCtx, time.Now())
+	})
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("fetch keys: %w", ctx.Err())
+	case res := <-resultCh:
+		return res.Err
+	}
+}
+
+// refresh fetches the key set from the auth service, replacing the cached keys and the cache file.
+// The keys are fetched without holding s.mu, so cached keys stay available meanwhile.
+func (s *PublicKeySource) refresh(ctx context.Context, now time.Time) error {
+	keys, set, err := s.fetchTrusted(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshedAt = now
+	s.refreshErr = err
+
+	if err != nil {
+		return err
+	}
+
+	s.cached = publicKeyCache{
+		FetchedAt: now,
+		ExpiresAt: now.Add(time.Duration(s.cfg.CacheTTL) * time.Second),
+		Keys:      set,
+	}
+	s.keys = keys
+
+	// Rotated keys may have been rejected as unknown before
+	for kid := range keys {
+		delete(s.unknown, kid)
+	}
+
+	s.log.DebugContext(ctx, "public keys fetched", "count", len(keys))
+
+	if err := s.storeCacheFile(); err != nil {
+		s.log.WarnContext(ctx, "public key cache not stored", "file", s.cfg.CacheFile, "error", err)
+	}
+
+	return nil
+}
+
+// fetchTrusted fetches the key set from the auth service and returns its trusted keys.
+func (s *PublicKeySource) fetchTrusted(ctx context.Context) (map[string]*rsa.PublicKey, domain.JWKSet, error) {
+	set, err := s.fetch(ctx)
+	if err != nil {
+		return nil, domain.JWKSet{}, fmt.Errorf("fetch keys: %w", err)
+	}
+
+	keys, err := s.trustedKeys(set)
+	if err != nil {
+		return nil, domain.JWKSet{}, err
+	}
+
+	return keys, set, nil
+}
+
+// fetch requests the key set from the JWKS endpoint.
+func (s *PublicKeySource) fetch(ctx context.Context) (domain.JWKSet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.JWKSURL, nil)
+	if err != nil {
+		return domain.JWKSet{}, fmt.Errorf("new request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return domain.JWKSet{}, fmt.Errorf("%w: %w", ErrAuthUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return domain.JWKSet{}, fmt.Errorf("%w: status %d", ErrAuthUnavailable, resp.StatusCode)
+	}
+
+	var set domain.JWKSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return domain.JWKSet{}, fmt.Errorf("decode: %w", err)
+	}
+
+	return set, nil
+}
+
+// loadCacheFile restores the keys of the cache file, if any. Keys that are no longer trusted,
+// e.g. because the file was tampered with or the fingerprints changed, are discarded.
+func (s *PublicKeySource) loadCacheFile(ctx context.Context) {
+	if s.cfg.CacheFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(s.cfg.CacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		s.log.WarnContext(ctx, "public key cache not loaded", "file", s.cfg.CacheFile, "error", err)
+
+		return
+	}
+
+	var cached publicKeyCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		s.log.WarnContext(ctx, "public key cache not loaded", "file", s.cfg.CacheFile, "error", err)
+
+		return
+	}
+
+	keys, err := s.trustedKeys(cached.Keys)
+	if err != nil {
+		s.log.WarnContext(ctx, "public key cache not loaded", "file", s.cfg.CacheFile, "error", err)
+
+		return
+	}
+
+	s.cached = cached
+	s.keys = keys
+
+	s.log.DebugContext(ctx, "public key cache loaded", "count", len(keys), "expires", cached.ExpiresAt)
+}
+
+// storeCacheFile replaces the cache file by the cached keys. The file is written to a
+// temporary file first, so readers never see a partially written file.
+func (s *PublicKeySource) storeCacheFile() error {
+	if s.cfg.CacheFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.cached)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.cfg.CacheFile), 0o755); err != nil {
+		return fmt.Errorf("mkdir all: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.cfg.CacheFile), filepath.Base(s.cfg.CacheFile)+".*")
+	if err != nil {
+		return fmt.Errorf("create temp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.cfg.CacheFile); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	return nil
+}
+
+// trustedKeys returns the RSA keys of set by ID. Keys whose ID is not their thumbprint, or whose
+// thumbprint is not one of the configured fingerprints, are skipped. Returns ErrUntrustedKey if
+// no key is trusted.
+func (s *PublicKeySource) trustedKeys(set domain.JWKSet) (map[string]*rsa.PublicKey, error) {
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		key, err := parseRSAJWK(jwk)
+		if err != nil {
+			continue
+		}
+
+		thumbprint := KeyThumbprint(key)
+		if thumbprint != jwk.Kid {
+			continue
+		}
+
+		if len(s.fingerprints) > 0 && !slices.Contains(s.fingerprints, thumbprint) {
+			continue
+		}
+
+		keys[thumbprint] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: none of %d keys is trusted", ErrUntrustedKey, len(set.Keys))
+	}
+
+	return keys, nil
+}
+
+// KeyThumbprint returns the JWK thumbprint (RFC 7638) of an RSA public key, which the auth
+// service uses as key ID.
+func KeyThumbprint(key *rsa.PublicKey) string {
+	// The thumbprint hashes the required members in lexicographic order without whitespace
+	thumbprint := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+		keyEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		keyEncoding.EncodeToString(key.N.Bytes()),
+	)
+	hashed := sha256.Sum256([]byte(thumbprint))
+
+	return keyEncoding.EncodeToString(hashed[:])
+}
+
+// parseRSAJWK decodes the RSA public key of a JWK.
+func parseRSAJWK(jwk domain.JWK) (*rsa.PublicKey, error) {
+	if jwk.Kty != "RSA" {
+		return nil, fmt.Errorf("%w: key type %q", ErrUntrustedKey, jwk.Kty)
+	}
+
+	n, err := keyEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("decode modulus: %w", err)
+	}
+
+	e, err := keyEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("decode exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("%w: exponent out of range", ErrUntrustedKey)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
@@ -0,0 +1,217 @@
+package authclient_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+func TestPublicKeySource(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	kid := authsvc.KeyID(&key.PublicKey)
+	if got := authclient.KeyThumbprint(&key.PublicKey); got != kid {
+		t.Fatalf("KeyThumbprint() = %q, want %q", got, kid)
+	}
+
+	var fetches atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(domain.JWKSet{Keys: []domain.JWK{authsvc.PublicJWK(&key.PublicKey)}})
+	}))
+	t.Cleanup(server.Close)
+
+	cacheFile := filepath.Join(t.TempDir(), "jwks.json")
+	cfg := authclient.PublicKeyConfig{JWKSURL: server.URL, CacheFile: cacheFile, CacheTTL: 3600, Fingerprints: ""}
+	ctx := context.Background()
+
+	source := authclient.NewPublicKeySource(cfg, server.Client())
+
+	for range 2 {
+		if got, err := source.PublicKey(ctx, kid); err != nil || !got.Equal(&key.PublicKey) {
+			t.Fatalf("PublicKey() = %v, %v, want the served key", got, err)
+		}
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("keys fetched %d times, want once", n)
+	}
+
+	if _, err := source.PublicKey(ctx, "unknown"); !errors.Is(err, authclient.ErrUnknownKey) {
+		t.Errorf("PublicKey() of unknown key error = %v, want %v", err, authclient.ErrUnknownKey)
+	}
+
+	// Keys survive restarts while the auth service is unavailable
+	unavailable := cfg
+	unavailable.JWKSURL = "http://127.0.0.1:1/.well-known/jwks.json"
+
+	restarted := authclient.NewPublicKeySource(unavailable, nil)
+	if got, err := restarted.PublicKey(ctx, kid); err != nil || !got.Equal(&key.PublicKey) {
+		t.Errorf("PublicKey() after restart = %v, %v, want the cached key", got, err)
+	}
+
+	// Keys not matching the fingerprints are rejected, whether fetched or cached
+	pinned := cfg
+	pinned.Fingerprints = authclient.KeyThumbprint(&other.PublicKey)
+
+	if _, err := authclient.NewPublicKeySource(pinned, server.Client()).PublicKey(ctx, kid); !errors.Is(err, authclient.ErrUntrustedKey) {
+		t.Errorf("PublicKey() of unpinned key error = %v, want %v", err, authclient.ErrUntrustedKey)
+	}
+
+	pinned.JWKSURL = unavailable.JWKSURL
+
+	if _, err := authclient.NewPublicKeySource(pinned, nil).PublicKey(ctx, kid); err == nil {
+		t.Error("PublicKey() of unpinned cached key: expected error")
+	}
+
+	// A substituted key in the cache file does not match its ID
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		t.Fatalf("read cache file: %v", err)
+	}
+
+	data = []byte(strings.Replace(string(data), authsvc.PublicJWK(&key.PublicKey).N, authsvc.PublicJWK(&other.PublicKey).N, 1))
+	if err := os.WriteFile(cacheFile, data, 0o600); err != nil {
+		t.Fatalf("write cache file: %v", err)
+	}
+
+	if _, err := authclient.NewPublicKeySource(unavailable, nil).PublicKey(ctx, kid); err == nil {
+		t.Error("PublicKey() of substituted cached key: expected error")
+	}
+}
+
+func TestPublicKeySource_UnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		refreshInterval int64
+		unknownKeyTTL   int64
+		kids            []string
+		wantFetches     int32
+	}{
+		{name: "unlimited", kids: []string{"a", "b", "a"}, wantFetches: 4},
+		{name: "rate limited", refreshInterval: 3600, kids: []string{"a", "b", "c"}, wantFetches: 1},
+		{name: "rejected", unknownKeyTTL: 3600, kids: []string{"a", "a", "a"}, wantFetches: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var fetches atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				fetches.Add(1)
+				_ = json.NewEncoder(w).Encode(domain.JWKSet{Keys: []domain.JWK{authsvc.PublicJWK(&key.PublicKey)}})
+			}))
+			t.Cleanup(server.Close)
+
+			source := authclient.NewPublicKeySource(authclient.PublicKeyConfig{
+				JWKSURL:         server.URL,
+				CacheTTL:        3600,
+				RefreshInterval: tt.refreshInterval,
+				UnknownKeyTTL:   tt.unknownKeyTTL,
+			}, nil)
+
+			ctx := context.Background()
+
+			// The first lookup fetches the keys
+			if _, err := source.PublicKey(ctx, authsvc.KeyID(&key.PublicKey)); err != nil {
+				t.Fatalf("PublicKey() error = %v", err)
+			}
+
+			for _, kid := range tt.kids {
+				if _, err := source.PublicKey(ctx, kid); !errors.Is(err, authclient.ErrUnknownKey) {
+					t.Errorf("PublicKey(%q) error = %v, want %v", kid, err, authclient.ErrUnknownKey)
+				}
+			}
+
+			if got := fetches.Load(); got != tt.wantFetches {
+				t.Errorf("keys fetched %d times, want %d", got, tt.wantFetches)
+			}
+
+			// Known keys are served without fetching
+			if _, err := source.PublicKey(ctx, authsvc.KeyID(&key.PublicKey)); err != nil {
+				t.Errorf("PublicKey() error = %v", err)
+			}
+
+			if got := fetches.Load(); got != tt.wantFetches {
+				t.Errorf("keys fetched %d times, want %d", got, tt.wantFetches)
+			}
+		})
+	}
+
+	t.Run("coalesced", func(t *testing.T) {
+		t.Parallel()
+
+		var fetches atomic.Int32
+
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fetches.Add(1)
+			<-release
+			_ = json.NewEncoder(w).Encode(domain.JWKSet{Keys: []domain.JWK{authsvc.PublicJWK(&key.PublicKey)}})
+		}))
+		t.Cleanup(server.Close)
+
+		source := authclient.NewPublicKeySource(authclient.PublicKeyConfig{JWKSURL: server.URL, CacheTTL: 3600}, nil)
+
+		const callers = 8
+
+		errs := make(chan error, callers)
+
+		for range callers {
+			go func() {
+				_, err := source.PublicKey(context.Background(), authsvc.KeyID(&key.PublicKey))
+				errs <- err
+			}()
+		}
+
+		for fetches.Load() == 0 {
+			runtime.Gosched()
+		}
+
+		close(release)
+
+		for range callers {
+			if err := <-errs; err != nil {
+				t.Errorf("PublicKey() error = %v", err)
+			}
+		}
+
+		if got := fetches.Load(); got != 1 {
+			t.Errorf("keys fetched %d times, want once", got)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package authclient
+
+import (
+	"sync"
+	"time"
+)
+
+// validationCache caches successful token validations, keyed by the hash of the token,
+// until the earlier of the configured TTL and the expiry of the token.
+type validationCache struct {
+	m       sync.Mutex
+	entries map[string]validationCacheEntry
+	ttl     time.Duration
+	size    int
+}
+
+// validationCacheEntry is a cached validation result.
+type validationCacheEntry struct {
+	result  validateResult
+	expires time.Time
+}
+
+// newValidationCache creates a cache holding up to size results for at most ttl,
+// or returns nil if ttl or size is not positive, which disables caching.
+func newValidationCache(ttl time.Duration, size int) *validationCache {
+	if ttl <= 0 || size <= 0 {
+		return nil
+	}
+
+	return &validationCache{
+		m:       sync.Mutex{},
+		entries: make(map[string]validationCacheEntry),
+		ttl:     ttl,
+		size:    size,
+	}
+}
+
+// get returns the cached result of the token with the given hash, if it has not expired.
+func (c *validationCache) get(key string, now time.Time) (validateResult, bool) {
+	if c == nil {
+		return validateResult{}, false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return validateResult{}, false
+	}
+
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+
+		return validateResult{}, false
+	}
+
+	return entry.result, true
+}
+
+// put caches the successful result of the token with the given hash. Results of tokens
+// without a known expiry are not cached, as they might be cached beyond their validity.
+func (c *validationCache) put(key string, result validateResult, now time.Time) {
+	if c == nil || !result.ok || result.expires.IsZero() {
+		return
+	}
+
+	expires := now.Add(c.ttl)
+	if result.expires.Before(expires) {
+		expires = result.expires
+	}
+
+	if !now.Before(expires) {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if len(c.entries) >= c.size {
+		c.evict(now)
+	}
+
+	c.entries[key] = validationCacheEntry{result: result, expires: expires}
+}
+
+// evict removes the expired results, or an arbitrary one if none has expired.
+// Must be called with the lock held.
+func (c *validationCache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	for key := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,158 @@
+package authsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+const (
+	// ChallengeProviderHCaptcha selects the hCaptcha challenge verifier.
+	ChallengeProviderHCaptcha = "hcaptcha"
+	// ChallengeProviderTurnstile selects the Cloudflare Turnstile challenge verifier.
+	ChallengeProviderTurnstile = "turnstile"
+
+	// ChallengeHeader names the challenge provider in responses rejecting a request
+	// for a missing or failed challenge, so clients know to show the challenge widget.
+	ChallengeHeader = "X-Auth-Challenge"
+
+	hcaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+	turnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+var (
+	// ErrUnknownChallengeProvider is returned when the configured challenge provider does not exist.
+	ErrUnknownChallengeProvider = errors.New("unknown challenge provider")
+	// ErrChallengeUnavailable is returned when the challenge provider cannot verify responses.
+	ErrChallengeUnavailable = domain.NewError(
+		"auth.challenge_unavailable", "challenge provider unavailable", http.StatusServiceUnavailable, true)
+	// ErrChallengeRequired is returned when a request requiring a challenge has no challenge response.
+	ErrChallengeRequired = domain.NewError(
+		"auth.challenge_required", "challenge required", http.StatusForbidden, false)
+	// ErrChallengeFailed is returned when the challenge response of a request is rejected by the provider.
+	ErrChallengeFailed = domain.NewError(
+		"auth.challenge_failed", "challenge failed", http.StatusForbidden, false)
+)
+
+// ChallengeConfig configures the CAPTCHA challenge protecting registration and,
+// after repeated failures, login.
+type ChallengeConfig struct {
+	// Provider is the challenge provider ("hcaptcha" or "turnstile"), empty to disable challenges
+	Provider string `env:"PROVIDER" default:""`
+
+	// Secret is the secret key of the site registered with the provider
+	Secret string `env:"SECRET" default:""`
+
+	// VerifyURL overrides the verification endpoint of the provider
+	VerifyURL string `env:"VERIFY_URL" default:""`
+
+	// ResponseParam is the form parameter carrying the challenge response,
+	// empty for the parameter set by the widget of the provider
+	ResponseParam string `env:"RESPONSE_PARAM" default:""`
+
+	// Timeout is the timeout in seconds of verification requests
+	Timeout int64 `env:"TIMEOUT" default:"5"`
+
+	// LoginFailures is the number of failed logins of a user after which logins
+	// require a challenge, 0 to never require a challenge for logins
+	LoginFailures int `env:"LOGIN_FAILURES" default:"3"`
+}
+
+// ChallengeVerifier verifies the responses of clients to a CAPTCHA challenge.
+type ChallengeVerifier interface {
+	// Verify reports whether the challenge response of the client with the given IP address
+	// is valid. Returns an error if the response cannot be verified.
+	Verify(ctx context.Context, response, remoteIP string) (bool, error)
+}
+
+// SiteVerifier is a ChallengeVerifier for providers implementing the siteverify API
+// shared by hCaptcha and Turnstile.
+type SiteVerifier struct {
+	URL        string
+	Secret     string
+	HTTPClient *http.Client
+}
+
+// siteVerifyResponse is the response of the siteverify API.
+type siteVerifyResponse struct {
+	Success bool `json:"success"`
+}
+
+// NewChallengeVerifier creates the challenge verifier selected by the configuration.
+// Returns nil if no provider is configured, or ErrUnknownChallengeProvider if the
+// configured provider does not exist.
+func NewChallengeVerifier(cfg ChallengeConfig) (ChallengeVerifier, error) {
+	var verifyURL string
+
+	switch cfg.Provider {
+	case "":
+		return nil, nil //nolint:nilnil
+	case ChallengeProviderHCaptcha:
+		verifyURL = hcaptchaVerifyURL
+	case ChallengeProviderTurnstile:
+		verifyURL = turnstileVerifyURL
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownChallengeProvider, cfg.Provider)
+	}
+
+	if cfg.VerifyURL != "" {
+		verifyURL = cfg.VerifyURL
+	}
+
+	return &SiteVerifier{
+		URL:        verifyURL,
+		Secret:     cfg.Secret,
+		HTTPClient: &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second}, //nolint:exhaustruct
+	}, nil
+}
+
+// Verify implements ChallengeVerifier by posting the response to the siteverify endpoint.
+func (v *SiteVerifier) Verify(ctx context.Context, response, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.Secret}, "response": {response}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%w: %s", ErrChallengeUnavailable, resp.Status)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("decode response: %w", err)
+	}
+
+	return result.Success, nil
+}
+
+// challengeResponseParam returns the form parameter carrying the challenge response.
+func challengeResponseParam(cfg ChallengeConfig) string {
+	switch {
+	case cfg.ResponseParam != "":
+		return cfg.ResponseParam
+	case cfg.Provider == ChallengeProviderHCaptcha:
+		return "h-captcha-response"
+	default:
+		return "cf-turnstile-response"
+	}
+}
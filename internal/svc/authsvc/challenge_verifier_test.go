@@ -0,0 +1,232 @@
+package authsvc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+)
+
+// newSiteVerifyServer starts a siteverify endpoint accepting the response "pass" for the
+// secret "secret", and failing for the response "down".
+func newSiteVerifyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.PostFormValue("response") == "down":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.PostFormValue("response") == "pass" && r.PostFormValue("secret") == "secret":
+			_, _ = w.Write([]byte(`{"success": true}`))
+		default:
+			_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestNewChallengeVerifier(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		provider string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "disabled", provider: "", wantNil: true},
+		{name: "hcaptcha", provider: authsvc.ChallengeProviderHCaptcha},
+		{name: "turnstile", provider: authsvc.ChallengeProviderTurnstile},
+		{name: "unknown", provider: "recaptcha", wantNil: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			verifier, err := authsvc.NewChallengeVerifier(authsvc.ChallengeConfig{Provider: tt.provider})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewChallengeVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (verifier == nil) != tt.wantNil {
+				t.Errorf("NewChallengeVerifier() = %v, want nil %v", verifier, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestHTTPTransport_Challenge(t *testing.T) {
+	t.Parallel()
+
+	server := newSiteVerifyServer(t)
+
+	newTransport := func(t *testing.T) *authsvc.HTTPTransport {
+		t.Helper()
+
+		svc, _ := setupTestService(t)
+		svc.Config.LoginMaxFailures = 5
+		svc.Config.LoginLockoutDuration = 60
+		svc.Throttle = throttle.NewMemoryStore("")
+
+		if err := svc.RegisterUser(context.Background(), "testuser", "testpass"); err != nil {
+			t.Fatalf("failed to register user: %v", err)
+		}
+
+		cfg := authsvc.ChallengeConfig{
+			Provider:      authsvc.ChallengeProviderHCaptcha,
+			Secret:        "secret",
+			VerifyURL:     server.URL,
+			Timeout:       5,
+			LoginFailures: 2,
+		}
+
+		verifier, err := authsvc.NewChallengeVerifier(cfg)
+		if err != nil {
+			t.Fatalf("NewChallengeVerifier() error = %v", err)
+		}
+
+		oauth, err := authsvc.NewOAuthServer(svc, authsvc.OAuthConfig{
+			Clients: testClientID + "=" + testRedirectURI,
+			CodeTTL: 60,
+		})
+		if err != nil {
+			t.Fatalf("NewOAuthServer() error = %v", err)
+		}
+
+		transport := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+		transport.SetChallengeVerifier(verifier, cfg)
+		transport.SetOAuthServer(oauth)
+
+		return transport
+	}
+
+	t.Run("register", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name       string
+			response   string
+			wantStatus int
+		}{
+			{name: "missing", response: "", wantStatus: http.StatusForbidden},
+			{name: "rejected", response: "fail", wantStatus: http.StatusForbidden},
+			{name: "unavailable", response: "down", wantStatus: http.StatusServiceUnavailable},
+			{name: "passed", response: "pass", wantStatus: http.StatusOK},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				transport := newTransport(t)
+
+				form := url.Values{"username": {"newuser"}, "password": {"newpass"}}
+				if tt.response != "" {
+					form.Set("h-captcha-response", tt.response)
+				}
+
+				rec := serveForm(transport, http.MethodPost, "/auth/register", form)
+				if rec.Code != tt.wantStatus {
+					t.Errorf("register status = %d, want %d", rec.Code, tt.wantStatus)
+				}
+
+				if got := rec.Header().Get(authsvc.ChallengeHeader); (got != "") != (tt.wantStatus == http.StatusForbidden) {
+					t.Errorf("register %s = %q", authsvc.ChallengeHeader, got)
+				}
+			})
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		t.Parallel()
+
+		transport := newTransport(t)
+		login := func(password, response string) int {
+			form := url.Values{"username": {"testuser"}, "password": {password}}
+			if response != "" {
+				form.Set("h-captcha-response", response)
+			}
+
+			return serveForm(transport, http.MethodPost, "/auth/login", form).Code
+		}
+
+		// Logins are challenged after repeated failures only
+		for range 2 {
+			if status := login("wrongpass", ""); status != http.StatusUnauthorized {
+				t.Fatalf("login with wrong password status = %d, want %d", status, http.StatusUnauthorized)
+			}
+		}
+
+		if status := login("testpass", ""); status != http.StatusForbidden {
+			t.Errorf("login without challenge status = %d, want %d", status, http.StatusForbidden)
+		}
+
+		if status := login("testpass", "pass"); status != http.StatusOK {
+			t.Errorf("login with challenge status = %d, want %d", status, http.StatusOK)
+		}
+
+		// The successful login resets the failures
+		if status := login("testpass", ""); status != http.StatusOK {
+			t.Errorf("login after success status = %d, want %d", status, http.StatusOK)
+		}
+	})
+
+	t.Run("oauth authorize", func(t *testing.T) {
+		t.Parallel()
+
+		transport := newTransport(t)
+		authorize := func(password, response string) *httptest.ResponseRecorder {
+			form := authorizeParams("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+			form.Set("username", "testuser")
+			form.Set("password", password)
+
+			if response != "" {
+				form.Set("h-captcha-response", response)
+			}
+
+			return serveForm(transport, http.MethodPost, "/auth/authorize", form)
+		}
+
+		// Failed logins by the login form count towards the challenge
+		for range 2 {
+			if rec := authorize("wrongpass", ""); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("authorize with wrong password status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		}
+
+		tests := []struct {
+			name       string
+			response   string
+			wantStatus int
+		}{
+			{name: "missing", response: "", wantStatus: http.StatusForbidden},
+			{name: "rejected", response: "fail", wantStatus: http.StatusForbidden},
+			{name: "unavailable", response: "down", wantStatus: http.StatusServiceUnavailable},
+		}
+
+		for _, tt := range tests {
+			rec := authorize("testpass", tt.response)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s: authorize status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+			}
+
+			if got := rec.Header().Get(authsvc.ChallengeHeader); (got != "") != (tt.wantStatus == http.StatusForbidden) {
+				t.Errorf("%s: authorize %s = %q", tt.name, authsvc.ChallengeHeader, got)
+			}
+		}
+
+		if rec := authorize("testpass", "pass"); rec.Code != http.StatusFound {
+			t.Errorf("authorize with challenge status = %d, want %d", rec.Code, http.StatusFound)
+		} else if location := rec.Header().Get("Location"); !strings.Contains(location, "code=") {
+			t.Errorf("authorize with challenge redirects to %q, want a code", location)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package authsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// ErrUnknownAuthBackend is returned when the configured auth backend is not registered
+// or its configuration is incomplete.
+var ErrUnknownAuthBackend = errors.New("unknown auth backend")
+
+// CredentialVerifier checks the credentials of logins, e.g. against the stored password hashes
+// or an external identity provider.
+type CredentialVerifier interface {
+	// Verify checks the password of the user. user is the stored account of the user, or nil if
+	// there is none; verifiers of external backends may accept users without account, who are
+	// provisioned one without password. Returns an error if the credentials cannot be checked.
+	Verify(ctx context.Context, username, password string, user *domain.User) (CredentialResult, error)
+}
+
+// CredentialResult is the outcome of checking the credentials of a login.
+type CredentialResult struct {
+	Valid  bool // Whether the credentials are valid
+	Rehash bool // Whether the stored password hash should be replaced by a hash of the configured hasher
+}
+
+// CredentialVerifierFactory creates a CredentialVerifier from the auth service configuration.
+type CredentialVerifierFactory func(cfg AuthConfig) (CredentialVerifier, error)
+
+//nolint:gochecknoglobals
+var (
+	credentialVerifiersMu sync.RWMutex
+
+	// credentialVerifiers maps auth backend names to the factories of their verifiers.
+	credentialVerifiers = map[string]CredentialVerifierFactory{
+		AuthBackendLocal: func(cfg AuthConfig) (CredentialVerifier, error) {
+			hasher, err := NewPasswordHasher(cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			return PasswordVerifier{Hasher: hasher}, nil
+		},
+		AuthBackendLDAP: func(cfg AuthConfig) (CredentialVerifier, error) {
+			return NewLDAPAuthenticator(cfg.LDAP)
+		},
+	}
+)
+
+// RegisterCredentialVerifier makes an auth backend available under the given name, so it can be
+// selected in AuthConfig.Backend. A backend registered under an existing name replaces it.
+func RegisterCredentialVerifier(name string, factory CredentialVerifierFactory) {
+	credentialVerifiersMu.Lock()
+	defer credentialVerifiersMu.Unlock()
+
+	credentialVerifiers[strings.ToLower(name)] = factory
+}
+
+// CredentialVerifierNames returns the sorted names of all registered auth backends.
+func CredentialVerifierNames() []string {
+	credentialVerifiersMu.RLock()
+	defer credentialVerifiersMu.RUnlock()
+
+	names := make([]string, 0, len(credentialVerifiers))
+	for name := range credentialVerifiers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// NewCredentialVerifier creates the CredentialVerifier of the auth backend selected by
+// cfg.Backend, AuthBackendLocal if empty.
+// Returns ErrUnknownAuthBackend if the backend is not registered, or the error of its factory.
+func NewCredentialVerifier(cfg AuthConfig) (CredentialVerifier, error) {
+	name := strings.ToLower(strings.TrimSpace(cfg.Backend))
+	if name == "" {
+		name = AuthBackendLocal
+	}
+
+	credentialVerifiersMu.RLock()
+	factory, ok := credentialVerifiers[name]
+	credentialVerifiersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAuthBackend, cfg.Backend)
+	}
+
+	verifier, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new %s verifier: %w", name, err)
+	}
+
+	return verifier, nil
+}
+
+// PasswordVerifier checks passwords against the hashes stored with the accounts of users.
+type PasswordVerifier struct {
+	Hasher PasswordHasher // Configured hasher, tried first; hashes of other algorithms or parameters are rehashed
+}
+
+var _ CredentialVerifier = PasswordVerifier{}
+
+// Verify implements CredentialVerifier. Users without account are rejected.
+func (v PasswordVerifier) Verify(_ context.Context, _, password string, user *domain.User) (CredentialResult, error) {
+	if user == nil {
+		return CredentialResult{Valid: false, Rehash: false}, nil
+	}
+
+	ok, rehash, err := verifyPassword(v.Hasher, password, user.PasswordHash)
+	if err != nil {
+		return CredentialResult{Valid: false, Rehash: false}, fmt.Errorf("verify password: %w", err)
+	}
+
+	return CredentialResult{Valid: ok, Rehash: rehash}, nil
+}
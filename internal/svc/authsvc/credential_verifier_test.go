@@ -0,0 +1,84 @@
+package authsvc_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+)
+
+// staticVerifier accepts the password "static" of any user, with or without account.
+type staticVerifier struct{}
+
+func (staticVerifier) Verify(_ context.Context, _, password string, _ *domain.User) (authsvc.CredentialResult, error) {
+	return authsvc.CredentialResult{Valid: password == "static"}, nil
+}
+
+func TestNewCredentialVerifier(t *testing.T) {
+	t.Parallel()
+
+	authsvc.RegisterCredentialVerifier("Static", func(authsvc.AuthConfig) (authsvc.CredentialVerifier, error) {
+		return staticVerifier{}, nil
+	})
+
+	if names := authsvc.CredentialVerifierNames(); !slices.Contains(names, "static") || !slices.Contains(names, authsvc.AuthBackendLDAP) {
+		t.Errorf("CredentialVerifierNames() = %v, want static and ldap", names)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     authsvc.AuthConfig
+		want    any
+		wantErr error
+	}{
+		{name: "default", cfg: authsvc.AuthConfig{PasswordHasher: authsvc.PasswordHasherBcrypt}, want: authsvc.PasswordVerifier{}},
+		{name: "local", cfg: authsvc.AuthConfig{Backend: "local", PasswordHasher: authsvc.PasswordHasherBcrypt}, want: authsvc.PasswordVerifier{}},
+		{name: "registered", cfg: authsvc.AuthConfig{Backend: "static"}, want: staticVerifier{}},
+		{name: "unknown", cfg: authsvc.AuthConfig{Backend: "kerberos"}, wantErr: authsvc.ErrUnknownAuthBackend},
+		{name: "incomplete ldap", cfg: authsvc.AuthConfig{Backend: "ldap"}, wantErr: authsvc.ErrUnknownAuthBackend},
+		{name: "unknown hasher", cfg: authsvc.AuthConfig{Backend: "local", PasswordHasher: "md5"}, wantErr: authsvc.ErrUnknownPasswordHasher},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			verifier, err := authsvc.NewCredentialVerifier(tt.cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewCredentialVerifier() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if reflect.TypeOf(verifier) != reflect.TypeOf(tt.want) {
+				t.Errorf("NewCredentialVerifier() = %T, want %T", verifier, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthService_LoginCredentialVerifier(t *testing.T) {
+	t.Parallel()
+
+	svc, mockRepo := setupTestService(t)
+	svc.Credentials = staticVerifier{}
+	ctx := context.Background()
+
+	if _, err := svc.Login(ctx, "carol", "wrong", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("Login(wrong) error = %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+
+	if _, err := svc.Login(ctx, "carol", "static", nil); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if _, ok := mockRepo.users["carol"]; !ok {
+		t.Error("user accepted without account not provisioned")
+	}
+}
@@ -2,23 +2,30 @@ package authsvc
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
 	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
 )
 
+// WWWAuthenticateHeader carries the challenge of responses rejecting a token (RFC 6750).
+const WWWAuthenticateHeader = "WWW-Authenticate"
+
 var (
 	// ErrNoUsername is returned when the username is missing from the request.
-	ErrNoUsername = errors.New("no username")
+	ErrNoUsername = domain.NewError("user.no_username", "no username", http.StatusBadRequest, false)
 	// ErrNoPassword is returned when the password is missing from the request.
-	ErrNoPassword = errors.New("no password")
+	ErrNoPassword = domain.NewError("user.no_password", "no password", http.StatusBadRequest, false)
 )
 
 // HTTPTransportConfig contains configuration parameters for the HTTP transport layer.
@@ -29,46 +36,99 @@ type HTTPTransportConfig struct {
 // HTTPTransport handles HTTP requests for the authentication service.
 // It provides endpoints for user registration, login, and token validation.
 type HTTPTransport struct {
-	authSvc *AuthService
-	log     logging.Logger
-	cfg     HTTPTransportConfig
+	authSvc      *AuthService
+	oauth        *OAuthServer
+	challenge    ChallengeVerifier
+	challengeCfg ChallengeConfig
+	rateLimiter  credentialRateLimiter
+	cache        *http_.ResponseCache
+	log          logging.Logger
+	cfg          HTTPTransportConfig
 }
 
 // NewHTTPTransport creates a new HTTPTransport instance with the given configuration.
-// It requires an AuthService for handling authentication operations.
+// It requires an AuthService for handling authentication operations, whose configuration
+// and throttle store also set the rate limit of login and register requests.
 func NewHTTPTransport(
 	authSvc *AuthService,
 	cfg HTTPTransportConfig,
 ) *HTTPTransport {
 	return &HTTPTransport{
-		authSvc: authSvc,
-		log:     logging.GetLogger("svc.imagesvc.http_transport"),
-		cfg:     cfg,
+		authSvc:      authSvc,
+		oauth:        nil,
+		challenge:    nil,
+		challengeCfg: ChallengeConfig{}, //nolint:exhaustruct
+		rateLimiter:  newCredentialRateLimiter(authSvc),
+		cache:        nil,
+		log:          logging.GetLogger("svc.imagesvc.http_transport"),
+		cfg:          cfg,
 	}
 }
 
 // ServeHTTP implements http.Handler and sets up routes for the auth service endpoints:
 // - POST /auth/register: Register a new user
 // - POST /auth/login: Login and get an auth token
-// - POST /auth/validate: Validate an auth token.
+// - POST /auth/validate: Validate an auth token
+// - POST /auth/renew: Renew a valid auth token, if AuthConfig.TokenMaxLifetime is set
+// - GET /.well-known/openid-configuration: OIDC discovery document
+// - GET /.well-known/jwks.json: Public key verifying tokens
+// - GET/POST /auth/authorize: OAuth2 authorization endpoint, if an OAuthServer is set
+// - POST /auth/token: OAuth2 token endpoint, if an OAuthServer is set
+// - GET /metrics: Prometheus metrics.
+// The client IP is added to the request context, attributing failed logins to clients.
+// The routes listed by CacheableRoutes are cached if a ResponseCache is set and configures them.
 func (ht *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /auth/register", ht.HandleRegister)
 	mux.HandleFunc("POST /auth/login", ht.HandleLogin)
 	mux.HandleFunc("POST /auth/validate", ht.HandleValidate)
-	mux.ServeHTTP(w, r)
+
+	if ht.authSvc.Config.TokenMaxLifetime > 0 {
+		mux.HandleFunc("POST /auth/renew", ht.HandleRenew)
+	}
+
+	mux.Handle("GET /.well-known/openid-configuration",
+		ht.cache.Handle("GET /.well-known/openid-configuration", http.HandlerFunc(ht.HandleDiscovery)))
+	mux.Handle("GET /.well-known/jwks.json",
+		ht.cache.Handle("GET /.well-known/jwks.json", http.HandlerFunc(ht.HandleJWKS)))
+
+	if ht.oauth != nil {
+		mux.HandleFunc("GET /auth/authorize", ht.HandleAuthorize)
+		mux.HandleFunc("POST /auth/authorize", ht.HandleAuthorize)
+		mux.HandleFunc("POST /auth/token", ht.HandleToken)
+	}
+
+	mux.Handle("GET /metrics", metrics.Handler(metrics.Default()))
+
+	r = r.WithContext(context_.WithClientIP(r.Context(), http_.ClientIP(r)))
+
+	http_.RecordRoute(mux).ServeHTTP(w, r)
 }
 
 var _ http_.HTTPTransport = (*HTTPTransport)(nil)
 
+// CacheableRoutes returns the patterns of the routes a ResponseCache may cache, the well-known documents.
+func (ht *HTTPTransport) CacheableRoutes() []string {
+	return []string{"GET /.well-known/openid-configuration", "GET /.well-known/jwks.json"}
+}
+
+// SetResponseCache sets the cache of the routes listed by CacheableRoutes. Without a cache,
+// the well-known documents are built on every request.
+func (ht *HTTPTransport) SetResponseCache(cache *http_.ResponseCache) {
+	ht.cache = cache
+}
+
 // HandleRegister processes user registration requests.
-// Expects form parameters: username, password.
+// Expects form parameters or a JSON object with the members: username, password.
+// Requests exceeding the rate limit per client or username are rejected with 429 Too Many Requests.
+// If a ChallengeVerifier is set, requests without a valid challenge response are rejected
+// with 403 Forbidden.
 func (ht *HTTPTransport) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	_ = ht.handleRegister(w, r)
 }
 
 func (ht *HTTPTransport) handleRegister(w http.ResponseWriter, r *http.Request) (err error) {
-	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.String()))
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
 
 	defer func(ctx context.Context) {
 		if err != nil {
@@ -78,14 +138,13 @@ func (ht *HTTPTransport) handleRegister(w http.ResponseWriter, r *http.Request)
 		}
 	}(r.Context())
 
-	// Parse form
-	if err := r.ParseForm(); err != nil {
-		return fmt.Errorf("parse form: %w", err)
+	if err := parseCredentials(w, r); err != nil {
+		return err
 	}
 
 	username := r.FormValue("username")
 	if username == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		http_.WriteDomainError(w, r, http.StatusBadRequest, ErrNoUsername)
 
 		return ErrNoUsername
 	}
@@ -94,17 +153,27 @@ func (ht *HTTPTransport) handleRegister(w http.ResponseWriter, r *http.Request)
 
 	password := r.FormValue("password")
 	if password == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		http_.WriteDomainError(w, r, http.StatusBadRequest, ErrNoPassword)
 
 		return ErrNoPassword
 	}
 
+	if err := ht.checkRateLimit(w, r, username); err != nil {
+		return err
+	}
+
+	if ht.challenge != nil {
+		if err := ht.checkChallenge(w, r); err != nil {
+			return err
+		}
+	}
+
 	// Register user
 	if err := ht.authSvc.RegisterUser(r.Context(), username, password); err != nil {
 		if errors.Is(err, domain.ErrUserAlreadyExists) {
-			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			http_.WriteDomainError(w, r, http.StatusConflict, err)
 		} else {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			http_.WriteDomainError(w, r, http.StatusInternalServerError, err)
 		}
 
 		return fmt.Errorf("register user: %w", err)
@@ -114,14 +183,19 @@ func (ht *HTTPTransport) handleRegister(w http.ResponseWriter, r *http.Request)
 }
 
 // HandleLogin processes user login requests.
-// Expects form parameters: username, password
-// Returns an auth token on successful login.
+// Expects form parameters or a JSON object with the members: username, password, and optionally
+// scope, the space-separated scopes requested for the token, and remember=true for a long-lived
+// "remember me" token.
+// Returns an auth token on successful login, or 400 Bad Request if a scope cannot be granted.
+// Requests exceeding the rate limit per client or username are rejected with 429 Too Many Requests.
+// If a ChallengeVerifier is set, requests for users with repeated failed logins without
+// a valid challenge response are rejected with 403 Forbidden.
 func (ht *HTTPTransport) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	_ = ht.handleLogin(w, r)
 }
 
 func (ht *HTTPTransport) handleLogin(w http.ResponseWriter, r *http.Request) (err error) {
-	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.String()))
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
 
 	defer func(ctx context.Context) {
 		if err != nil {
@@ -131,14 +205,13 @@ func (ht *HTTPTransport) handleLogin(w http.ResponseWriter, r *http.Request) (er
 		}
 	}(r.Context())
 
-	// Parse form
-	if err := r.ParseForm(); err != nil {
-		return fmt.Errorf("parse form: %w", err)
+	if err := parseCredentials(w, r); err != nil {
+		return err
 	}
 
 	username := r.FormValue("username")
 	if username == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		http_.WriteDomainError(w, r, http.StatusBadRequest, ErrNoUsername)
 
 		return ErrNoUsername
 	}
@@ -147,25 +220,52 @@ func (ht *HTTPTransport) handleLogin(w http.ResponseWriter, r *http.Request) (er
 
 	password := r.FormValue("password")
 	if password == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		http_.WriteDomainError(w, r, http.StatusBadRequest, ErrNoPassword)
 
 		return ErrNoPassword
 	}
 
-	// Login user
-	token, err := ht.authSvc.Login(r.Context(), username, password)
+	if err := ht.checkRateLimit(w, r, username); err != nil {
+		return err
+	}
+
+	if ht.loginChallengeRequired(r, username) {
+		if err := ht.checkChallenge(w, r); err != nil {
+			return err
+		}
+	}
+
+	// Login user, for a persistent session if requested
+	login := ht.authSvc.Login
+	if remember, _ := strconv.ParseBool(r.FormValue("remember")); remember {
+		login = ht.authSvc.LoginRemember
+	}
+
+	token, err := login(r.Context(), username, password, strings.Fields(r.FormValue("scope")))
 	if err != nil {
-		if errors.Is(err, domain.ErrInvalidCredentials) {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		} else {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		var lockoutErr *LockoutError
+
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			http_.WriteDomainError(w, r, http.StatusUnauthorized, err)
+		case errors.As(err, &lockoutErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockoutErr.RetryAfter.Seconds()))))
+			http_.WriteDomainError(w, r, http.StatusTooManyRequests, err)
+		case errors.Is(err, domain.ErrAccountExpired):
+			http_.WriteDomainError(w, r, http.StatusForbidden, err)
+		case errors.Is(err, domain.ErrInvalidScope):
+			http_.WriteDomainError(w, r, http.StatusBadRequest, err)
+		case errors.Is(err, ErrLDAPUnavailable):
+			http_.WriteDomainError(w, r, http.StatusServiceUnavailable, err)
+		default:
+			http_.WriteDomainError(w, r, http.StatusInternalServerError, err)
 		}
 
 		return fmt.Errorf("login user: %w", err)
 	}
 
 	// Return token
-	if err := json.NewEncoder(w).Encode(domain.AuthTokenResponse{Token: token}); err != nil {
+	if err := http_.WriteJSON(w, r, http.StatusOK, domain.AuthTokenResponse{Token: token}); err != nil {
 		return fmt.Errorf("encode response: %w", err)
 	}
 
@@ -173,14 +273,17 @@ func (ht *HTTPTransport) handleLogin(w http.ResponseWriter, r *http.Request) (er
 }
 
 // HandleValidate processes token validation requests.
-// Expects the token in the Authorization header with Bearer scheme.
-// Returns the username associated with the token if valid.
+// Expects the token in the Authorization header (optionally with Bearer scheme),
+// the X-Api-Key header or the access_token URL parameter.
+// Returns the username associated with the token if valid, and the user's roles, the audience
+// and the scopes of the token as comma-separated lists in the X-Auth-Roles, X-Auth-Audience
+// and X-Auth-Scopes headers.
 func (ht *HTTPTransport) HandleValidate(w http.ResponseWriter, r *http.Request) {
 	_ = ht.handleValidate(w, r)
 }
 
 func (ht *HTTPTransport) handleValidate(w http.ResponseWriter, r *http.Request) (err error) {
-	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.String()))
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
 
 	defer func(ctx context.Context) {
 		if err != nil {
@@ -190,21 +293,19 @@ func (ht *HTTPTransport) handleValidate(w http.ResponseWriter, r *http.Request)
 		}
 	}(r.Context())
 
-	// Parse headers
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// Parse credentials
+	creds, ok := authclient.CredentialsFromRequest(r)
+	if !ok {
+		http_.WriteDomainError(w, r, http.StatusBadRequest, domain.ErrNoAuthToken)
 
 		return domain.ErrNoAuthToken
 	}
 
-	tokenString, _ := strings.CutPrefix(authHeader, "Bearer")
-	tokenString = strings.TrimSpace(tokenString)
-
 	// Validate token
-	token, err := ht.authSvc.ValidateToken(r.Context(), tokenString)
+	token, err := ht.authSvc.ValidateToken(r.Context(), creds.Token)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		setTokenChallenge(w, err)
+		http_.WriteDomainError(w, r, http.StatusUnauthorized, tokenRejectionReason(err))
 
 		return fmt.Errorf("validate token: %w", err)
 	}
@@ -215,10 +316,102 @@ func (ht *HTTPTransport) handleValidate(w http.ResponseWriter, r *http.Request)
 		"iat", time.Unix(token.IssuedAt, 0).UTC().Format(time.RFC3339),
 	))
 
-	// Return username
+	// Return username, roles, audience, scopes and expiry, which bounds how long clients
+	// may cache the validation
+	if len(token.Roles) > 0 {
+		w.Header().Set(authclient.RolesHeader, strings.Join(token.Roles, ","))
+	}
+
+	if len(token.Audience) > 0 {
+		w.Header().Set(authclient.AudienceHeader, strings.Join(token.Audience, ","))
+	}
+
+	if len(token.Scopes) > 0 {
+		w.Header().Set(authclient.ScopesHeader, strings.Join(token.Scopes, ","))
+	}
+
+	w.Header().Set(authclient.ExpiresHeader, strconv.FormatInt(token.ExpiresAt, 10))
+
 	if _, err := w.Write([]byte(token.Username)); err != nil {
 		return fmt.Errorf("write: %w", err)
 	}
 
 	return nil
 }
+
+// HandleRenew processes token renewal requests.
+// Expects the token to renew like HandleValidate. Returns a new auth token with a sliding expiry,
+// 401 Unauthorized with a token challenge if the token is invalid or the session reached its
+// maximum lifetime, or 403 Forbidden if the account expired.
+func (ht *HTTPTransport) HandleRenew(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleRenew(w, r)
+}
+
+func (ht *HTTPTransport) handleRenew(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "token renewal failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "token renewed")
+		}
+	}(r.Context())
+
+	// Parse credentials
+	creds, ok := authclient.CredentialsFromRequest(r)
+	if !ok {
+		http_.WriteDomainError(w, r, http.StatusBadRequest, domain.ErrNoAuthToken)
+
+		return domain.ErrNoAuthToken
+	}
+
+	// Renew token
+	token, err := ht.authSvc.RenewToken(r.Context(), creds.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidAuthToken), errors.Is(err, domain.ErrSessionExpired):
+			setTokenChallenge(w, err)
+			http_.WriteDomainError(w, r, http.StatusUnauthorized, tokenRejectionReason(err))
+		case errors.Is(err, domain.ErrAccountExpired):
+			http_.WriteDomainError(w, r, http.StatusForbidden, err)
+		case errors.Is(err, domain.ErrInvalidScope):
+			http_.WriteDomainError(w, r, http.StatusBadRequest, err)
+		default:
+			http_.WriteDomainError(w, r, http.StatusInternalServerError, err)
+		}
+
+		return fmt.Errorf("renew token: %w", err)
+	}
+
+	// Return token
+	if err := http_.WriteJSON(w, r, http.StatusOK, domain.AuthTokenResponse{Token: token}); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// setTokenChallenge sets the challenge of a response rejecting a token (RFC 6750), telling
+// clients why the token was rejected: the "reason" parameter is the code of the
+// tokenRejectionReason, e.g. "auth.token_expired".
+func setTokenChallenge(w http.ResponseWriter, err error) {
+	reason := tokenRejectionReason(err)
+
+	w.Header().Set(WWWAuthenticateHeader, fmt.Sprintf(`Bearer error="invalid_token", error_description=%q, reason=%q`,
+		reason.Message, reason.Code))
+}
+
+// tokenRejectionReason returns the specific reason a token was rejected with err, e.g.
+// domain.ErrTokenExpired, or domain.ErrInvalidAuthToken if there is none.
+func tokenRejectionReason(err error) *domain.Error {
+	for _, candidate := range []*domain.Error{
+		domain.ErrTokenExpired, domain.ErrTokenNotYetValid, domain.ErrBadSignature, domain.ErrSessionExpired,
+	} {
+		if errors.Is(err, candidate) {
+			return candidate
+		}
+	}
+
+	return domain.ErrInvalidAuthToken
+}
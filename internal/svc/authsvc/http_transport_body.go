@@ -0,0 +1,67 @@
+package authsvc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// credentialsBodyLimit is the maximum size of JSON register and login request bodies.
+const credentialsBodyLimit = 64 << 10 // 64KiB
+
+// ErrInvalidRequestBody is returned when the body of a register or login request cannot be parsed.
+var ErrInvalidRequestBody = domain.NewError("user.invalid_request_body", "invalid request body", http.StatusBadRequest, false)
+
+// parseCredentials parses the parameters of register and login requests into r.Form, from a
+// form-encoded body or, with Content-Type application/json, a JSON object like
+// {"username": "...", "password": "..."}. String and boolean members are taken as the parameters
+// of the same name, so JSON clients can also send the scope, remember or challenge response.
+// Writes a 400 Bad Request response and returns an error if the body cannot be parsed.
+func parseCredentials(w http.ResponseWriter, r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		if err := r.ParseForm(); err != nil {
+			http_.WriteDomainError(w, r, http.StatusBadRequest, ErrInvalidRequestBody)
+
+			return errors.Join(ErrInvalidRequestBody, fmt.Errorf("parse form: %w", err))
+		}
+
+		return nil
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, credentialsBodyLimit)).Decode(&body); err != nil {
+		http_.WriteDomainError(w, r, http.StatusBadRequest, ErrInvalidRequestBody)
+
+		return errors.Join(ErrInvalidRequestBody, fmt.Errorf("decode body: %w", err))
+	}
+
+	// Query parameters are kept like for forms, but the body takes precedence
+	form := r.URL.Query()
+
+	for name, value := range body {
+		switch value := value.(type) {
+		case string:
+			form.Set(name, value)
+		case bool:
+			form.Set(name, strconv.FormatBool(value))
+		case nil:
+		default:
+			http_.WriteDomainError(w, r, http.StatusBadRequest, ErrInvalidRequestBody)
+
+			return fmt.Errorf("%w: %q is not a string or boolean", ErrInvalidRequestBody, name)
+		}
+	}
+
+	r.Form = form
+	r.PostForm = url.Values{}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package authsvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+)
+
+func TestHTTPTransport_JSONCredentials(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+	svc.Config.RememberTokenDuration = 86400
+
+	if err := svc.RegisterUser(context.Background(), "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	transport := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+
+	tests := []struct {
+		name         string
+		path         string
+		contentType  string
+		body         string
+		wantStatus   int
+		wantRemember bool
+	}{
+		{
+			name: "form login", path: "/auth/login", contentType: "application/x-www-form-urlencoded",
+			body: "username=testuser&password=testpass", wantStatus: http.StatusOK,
+		},
+		{
+			name: "json login", path: "/auth/login", contentType: "application/json",
+			body: `{"username": "testuser", "password": "testpass"}`, wantStatus: http.StatusOK,
+		},
+		{
+			name: "json login remember", path: "/auth/login", contentType: "application/json; charset=utf-8",
+			body:       `{"username": "testuser", "password": "testpass", "remember": true, "scope": null}`,
+			wantStatus: http.StatusOK, wantRemember: true,
+		},
+		{
+			name: "json wrong password", path: "/auth/login", contentType: "application/json",
+			body: `{"username": "testuser", "password": "wrong"}`, wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "json register", path: "/auth/register", contentType: "application/json",
+			body: `{"username": "newuser", "password": "newpass"}`, wantStatus: http.StatusOK,
+		},
+		{
+			name: "json missing password", path: "/auth/register", contentType: "application/json",
+			body: `{"username": "otheruser"}`, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "malformed json", path: "/auth/login", contentType: "application/json",
+			body: `{"username": "testuser",`, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "non-string member", path: "/auth/login", contentType: "application/json",
+			body: `{"username": "testuser", "password": 1234}`, wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			rec := httptest.NewRecorder()
+			transport.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s status = %d, want %d: %s", tt.path, rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.path != "/auth/login" || rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp domain.AuthTokenResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			token, err := svc.ValidateToken(context.Background(), resp.Token)
+			if err != nil || token.Remember != tt.wantRemember {
+				t.Errorf("ValidateToken() = %+v, %v, want remember %v", token, err, tt.wantRemember)
+			}
+		})
+	}
+}
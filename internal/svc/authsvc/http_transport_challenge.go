@@ -0,0 +1,63 @@
+package authsvc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// SetChallengeVerifier enables the CAPTCHA challenge of registrations and, after
+// cfg.LoginFailures failed logins of a user, logins.
+func (ht *HTTPTransport) SetChallengeVerifier(verifier ChallengeVerifier, cfg ChallengeConfig) {
+	ht.challenge = verifier
+	ht.challengeCfg = cfg
+}
+
+// loginChallengeRequired reports whether logins of the user require a challenge after repeated failures.
+func (ht *HTTPTransport) loginChallengeRequired(r *http.Request, username string) bool {
+	return ht.challenge != nil && ht.challengeCfg.LoginFailures > 0 &&
+		ht.authSvc.LoginFailures(r.Context(), username) >= int64(ht.challengeCfg.LoginFailures)
+}
+
+// checkChallenge verifies the challenge response of a request, writing a 403 Forbidden response
+// naming the provider in the X-Auth-Challenge header if it is missing or rejected.
+// If the provider is unavailable, the request is rejected with 503 Service Unavailable.
+// Returns an error if the request must not be processed.
+func (ht *HTTPTransport) checkChallenge(w http.ResponseWriter, r *http.Request) error {
+	err := ht.verifyChallenge(r)
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrChallengeUnavailable):
+		http_.WriteDomainError(w, r, http.StatusServiceUnavailable, ErrChallengeUnavailable)
+	case errors.Is(err, ErrChallengeFailed):
+		w.Header().Set(ChallengeHeader, ht.challengeCfg.Provider)
+		http_.WriteDomainError(w, r, http.StatusForbidden, ErrChallengeFailed)
+	default:
+		w.Header().Set(ChallengeHeader, ht.challengeCfg.Provider)
+		http_.WriteDomainError(w, r, http.StatusForbidden, ErrChallengeRequired)
+	}
+
+	return err
+}
+
+// verifyChallenge verifies the challenge response of a request.
+// Returns ErrChallengeRequired if it is missing, ErrChallengeFailed if it is rejected,
+// or ErrChallengeUnavailable if the provider is unavailable.
+func (ht *HTTPTransport) verifyChallenge(r *http.Request) error {
+	response := r.FormValue(challengeResponseParam(ht.challengeCfg))
+	if response == "" {
+		return ErrChallengeRequired
+	}
+
+	ok, err := ht.challenge.Verify(r.Context(), response, http_.ClientIP(r))
+	if err != nil {
+		return errors.Join(ErrChallengeUnavailable, fmt.Errorf("verify challenge: %w", err))
+	} else if !ok {
+		return ErrChallengeFailed
+	}
+
+	return nil
+}
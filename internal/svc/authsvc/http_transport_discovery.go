@@ -0,0 +1,77 @@
+package authsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// wellKnownMaxAge is the duration in seconds clients may cache the discovery document and key set.
+const wellKnownMaxAge = "3600"
+
+// HandleDiscovery serves the OpenID Provider metadata, so OIDC-aware clients and reverse
+// proxies can configure themselves against the service. The OAuth2 endpoints are only listed
+// if an OAuthServer is set.
+func (ht *HTTPTransport) HandleDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := ht.issuer(r)
+
+	doc := domain.OIDCDiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             "",
+		TokenEndpoint:                     "",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               nil,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{JWTAlgorithm},
+		TokenEndpointAuthMethodsSupported: nil,
+		CodeChallengeMethodsSupported:     nil,
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "iat", "exp", "auth_time", "scope"},
+		ScopesSupported:                   splitList(ht.authSvc.Config.Scopes),
+	}
+
+	if ht.oauth != nil {
+		doc.AuthorizationEndpoint = issuer + "/auth/authorize"
+		doc.TokenEndpoint = issuer + "/auth/token"
+		doc.GrantTypesSupported = []string{"authorization_code"}
+		doc.TokenEndpointAuthMethodsSupported = []string{"none"}
+		doc.CodeChallengeMethodsSupported = []string{pkceMethodS256}
+	}
+
+	ht.writeWellKnownJSON(w, r, doc)
+}
+
+// HandleJWKS serves the public key verifying issued tokens as JSON Web Key Set.
+func (ht *HTTPTransport) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	ht.writeWellKnownJSON(w, r, domain.JWKSet{Keys: []domain.JWK{PublicJWK(&ht.authSvc.SigningKey.PublicKey)}})
+}
+
+// issuer returns the configured issuer, or the base URL of the request if none is configured.
+func (ht *HTTPTransport) issuer(r *http.Request) string {
+	if ht.authSvc.Config.Issuer != "" {
+		return strings.TrimSuffix(ht.authSvc.Config.Issuer, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// writeWellKnownJSON writes a cacheable well-known document as plain JSON without the
+// response envelope, as expected by OIDC clients.
+func (ht *HTTPTransport) writeWellKnownJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+wellKnownMaxAge)
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		ht.log.ErrorContext(r.Context(), "encode well-known document failed", "error", err)
+	}
+}
@@ -0,0 +1,259 @@
+package authsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// authorizeTemplate renders the login form of authorization requests. It does not use
+// inline styles or scripts, so it is compatible with the default Content-Security-Policy.
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Sign in</title>
+</head>
+<body>
+<h1>Sign in to {{.Request.ClientID}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/auth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<label>Username <input type="text" name="username" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// authorizePage holds the data of a rendered login form.
+type authorizePage struct {
+	Request AuthorizeRequest
+	Error   string
+}
+
+// SetOAuthServer enables the OAuth2 authorization code grant served by /auth/authorize and /auth/token.
+func (ht *HTTPTransport) SetOAuthServer(oauth *OAuthServer) {
+	ht.oauth = oauth
+}
+
+// parseAuthorizeRequest reads the parameters of an authorization request from the query or form.
+func parseAuthorizeRequest(r *http.Request) AuthorizeRequest {
+	return AuthorizeRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Scope:               r.FormValue("scope"),
+	}
+}
+
+// HandleAuthorize serves authorization requests of the OAuth2 authorization code grant with PKCE.
+// GET renders a login form for the request parameters response_type=code, client_id, redirect_uri,
+// state, code_challenge, code_challenge_method=S256 and the optional scope. POST authenticates the user with the form
+// parameters username and password, and redirects to the redirect URI with the authorization code
+// and state. Invalid requests of registered clients are redirected with an OAuth2 error.
+func (ht *HTTPTransport) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleAuthorize(w, r)
+}
+
+func (ht *HTTPTransport) handleAuthorize(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.Path))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "oauth authorize failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "oauth authorize handled")
+		}
+	}(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("parse form: %w", err)
+	}
+
+	req := parseAuthorizeRequest(r)
+	log = log.With(logging.Group("oauth", "client_id", req.ClientID))
+
+	if err := ht.oauth.ValidateAuthorizeRequest(req); err != nil {
+		return ht.writeAuthorizeError(w, r, req, err)
+	}
+
+	if r.Method == http.MethodGet {
+		return writeAuthorizePage(w, http.StatusOK, authorizePage{Request: req, Error: ""})
+	}
+
+	if wait, ok := ht.rateLimiter.allow(r, r.PostFormValue("username")); !ok {
+		w.Header().Set("Retry-After", retryAfter(wait))
+
+		return ht.writeAuthorizeError(w, r, req, ErrRateLimited)
+	}
+
+	// Logins by the form are challenged like logins by /auth/login, so the challenge cannot be bypassed
+	if ht.loginChallengeRequired(r, r.PostFormValue("username")) {
+		if err := ht.verifyChallenge(r); err != nil {
+			return ht.writeAuthorizeError(w, r, req, err)
+		}
+	}
+
+	redirectURL, err := ht.oauth.Authorize(r.Context(), req, r.PostFormValue("username"), r.PostFormValue("password"))
+	if err != nil {
+		return ht.writeAuthorizeError(w, r, req, err)
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+
+	return nil
+}
+
+// writeAuthorizeError responds to a failed authorization request. Unknown clients get an
+// error response, failed logins and challenges the login form again, and anything else a
+// redirect to the client with the OAuth2 error.
+func (ht *HTTPTransport) writeAuthorizeError(w http.ResponseWriter, r *http.Request, req AuthorizeRequest, err error) error {
+	var (
+		oauthErr   *OAuthError
+		lockoutErr *LockoutError
+	)
+
+	switch {
+	case errors.Is(err, ErrUnknownOAuthClient):
+		http_.WriteError(w, r, http.StatusBadRequest)
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		if writeErr := writeAuthorizePage(w, http.StatusUnauthorized,
+			authorizePage{Request: req, Error: "Invalid username or password."}); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+	case errors.Is(err, ErrChallengeUnavailable):
+		if writeErr := writeAuthorizePage(w, http.StatusServiceUnavailable,
+			authorizePage{Request: req, Error: "Sign in is unavailable, try again later."}); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+	case errors.Is(err, ErrChallengeRequired), errors.Is(err, ErrChallengeFailed):
+		w.Header().Set(ChallengeHeader, ht.challengeCfg.Provider)
+
+		if writeErr := writeAuthorizePage(w, http.StatusForbidden,
+			authorizePage{Request: req, Error: "Too many failed logins, please complete the challenge."}); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+	case errors.As(err, &lockoutErr), errors.Is(err, ErrRateLimited):
+		if writeErr := writeAuthorizePage(w, http.StatusTooManyRequests,
+			authorizePage{Request: req, Error: "Too many login attempts, try again later."}); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+	case errors.As(err, &oauthErr):
+		http.Redirect(w, r, RedirectURL(req.RedirectURI, url.Values{
+			"error": {oauthErr.Code}, "error_description": {oauthErr.Description}, "state": {req.State},
+		}), http.StatusFound)
+	case errors.Is(err, domain.ErrAccountExpired):
+		http.Redirect(w, r, RedirectURL(req.RedirectURI, url.Values{
+			"error": {OAuthAccessDenied}, "error_description": {"account expired"}, "state": {req.State},
+		}), http.StatusFound)
+	default:
+		http.Redirect(w, r, RedirectURL(req.RedirectURI, url.Values{
+			"error": {OAuthServerError}, "state": {req.State},
+		}), http.StatusFound)
+	}
+
+	return err
+}
+
+// writeAuthorizePage renders the login form of an authorization request.
+func writeAuthorizePage(w http.ResponseWriter, status int, page authorizePage) error {
+	var buf bytes.Buffer
+	if err := authorizeTemplate.Execute(&buf, page); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return fmt.Errorf("render authorize page: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write authorize page: %w", err)
+	}
+
+	return nil
+}
+
+// HandleToken serves access token requests of the OAuth2 authorization code grant.
+// Expects form parameters: grant_type=authorization_code, code, redirect_uri, client_id, code_verifier.
+// Responds with the access token, or an OAuth2 error, as plain JSON without the response
+// envelope, as expected by OAuth2 client libraries.
+func (ht *HTTPTransport) HandleToken(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleToken(w, r)
+}
+
+func (ht *HTTPTransport) handleToken(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.Path))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "oauth token failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "oauth token issued")
+		}
+	}(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthJSON(w, http.StatusBadRequest,
+			domain.OAuthErrorResponse{Error: OAuthInvalidRequest, ErrorDescription: "invalid form"})
+
+		return fmt.Errorf("parse form: %w", err)
+	}
+
+	resp, err := ht.oauth.Exchange(r.Context(), TokenRequest{
+		GrantType:    r.PostFormValue("grant_type"),
+		Code:         r.PostFormValue("code"),
+		RedirectURI:  r.PostFormValue("redirect_uri"),
+		ClientID:     r.PostFormValue("client_id"),
+		CodeVerifier: r.PostFormValue("code_verifier"),
+	})
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) {
+			writeOAuthJSON(w, http.StatusBadRequest,
+				domain.OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+		} else {
+			writeOAuthJSON(w, http.StatusInternalServerError,
+				domain.OAuthErrorResponse{Error: OAuthServerError, ErrorDescription: ""})
+		}
+
+		return fmt.Errorf("exchange: %w", err)
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+
+	return nil
+}
+
+// writeOAuthJSON writes a response of the token endpoint, which must not be cached.
+func writeOAuthJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
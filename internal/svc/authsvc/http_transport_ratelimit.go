@@ -0,0 +1,94 @@
+package authsvc
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
+)
+
+// ErrRateLimited is returned when a client or username exceeds the login and register rate limit.
+var ErrRateLimited = domain.NewError("auth.rate_limited", "too many requests", http.StatusTooManyRequests, true)
+
+// credentialRateWindow is the window within which the login and register requests are counted.
+const credentialRateWindow = time.Minute
+
+// credentialRateLimiter limits the login and register requests per client IP address and
+// per username, counting the requests per minute in the throttle store. Like the lockout,
+// it fails open: if the throttle store is unavailable, requests are allowed.
+type credentialRateLimiter struct {
+	store       throttle.Store
+	perIP       int
+	perUsername int
+	log         logging.Logger
+}
+
+// newCredentialRateLimiter creates a credentialRateLimiter for the limits of the configuration of
+// authSvc, counting requests in its throttle store, so they are shared between replicas using Redis.
+// Without a throttle store, requests are counted in memory. Limits of 0 are disabled.
+func newCredentialRateLimiter(authSvc *AuthService) credentialRateLimiter {
+	store := authSvc.Throttle
+	if store == nil {
+		store = throttle.NewMemoryStore("")
+	}
+
+	return credentialRateLimiter{
+		store:       store,
+		perIP:       authSvc.Config.RateLimitPerIP,
+		perUsername: authSvc.Config.RateLimitPerUsername,
+		log:         authSvc.Log,
+	}
+}
+
+// allow counts a request of the client and the username of a request.
+// Returns false and the time until the request would be allowed if either limit is exceeded.
+func (limiter credentialRateLimiter) allow(r *http.Request, username string) (time.Duration, bool) {
+	if wait, ok := limiter.allowKey(r.Context(), "rate_limit_ip:"+http_.ClientIP(r), limiter.perIP); !ok {
+		return wait, false
+	}
+
+	return limiter.allowKey(r.Context(), "rate_limit_username:"+username, limiter.perUsername)
+}
+
+// allowKey counts a request of key within the current window, allowing up to limit requests, 0 for unlimited.
+// Returns false and the remaining time of the window if the limit is exceeded.
+func (limiter credentialRateLimiter) allowKey(ctx context.Context, key string, limit int) (time.Duration, bool) {
+	if limit <= 0 {
+		return 0, true
+	}
+
+	count, ttl, err := limiter.store.Incr(ctx, key, credentialRateWindow)
+	if err != nil {
+		limiter.log.WarnContext(ctx, "rate limit check failed", "error", err)
+
+		return 0, true
+	}
+
+	return ttl, count <= int64(limit)
+}
+
+// checkRateLimit enforces the login and register rate limit for the username of a request,
+// writing a 429 Too Many Requests response with a Retry-After header if it is exceeded.
+// Returns ErrRateLimited if the request must not be processed.
+func (ht *HTTPTransport) checkRateLimit(w http.ResponseWriter, r *http.Request, username string) error {
+	wait, ok := ht.rateLimiter.allow(r, username)
+	if ok {
+		return nil
+	}
+
+	w.Header().Set("Retry-After", retryAfter(wait))
+	http_.WriteDomainError(w, r, http.StatusTooManyRequests, ErrRateLimited)
+
+	return ErrRateLimited
+}
+
+// retryAfter returns the Retry-After header value for the given wait time in whole seconds, at least 1.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1))
+}
@@ -0,0 +1,121 @@
+package authsvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+func TestHTTPTransport_ErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+	svc.Clock = clk
+
+	if err := svc.RegisterUser(context.Background(), "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	expired, err := svc.Login(context.Background(), "testuser", "testpass", nil)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	clk.Advance(2 * time.Hour)
+
+	transport := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+
+	validate := func(token string) func() *httptest.ResponseRecorder {
+		return func() *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodPost, "/auth/validate", nil)
+			if token != "" {
+				r.Header.Set(authclient.AuthorizationHeader, authclient.AuthorizationValue(token))
+			}
+
+			rec := httptest.NewRecorder()
+			transport.ServeHTTP(rec, r)
+
+			return rec
+		}
+	}
+
+	login := func(form url.Values) func() *httptest.ResponseRecorder {
+		return func() *httptest.ResponseRecorder {
+			return serveForm(transport, http.MethodPost, "/auth/login", form)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		serve      func() *httptest.ResponseRecorder
+		wantStatus int
+		wantCode   domain.ErrorCode
+	}{
+		{
+			name: "user exists",
+			serve: func() *httptest.ResponseRecorder {
+				return serveForm(transport, http.MethodPost, "/auth/register",
+					url.Values{"username": {"testuser"}, "password": {"other"}})
+			},
+			wantStatus: http.StatusConflict, wantCode: "user.already_exists",
+		},
+		{
+			name:       "invalid credentials",
+			serve:      login(url.Values{"username": {"testuser"}, "password": {"wrong"}}),
+			wantStatus: http.StatusUnauthorized, wantCode: "user.invalid_credentials",
+		},
+		{
+			name:       "unknown user",
+			serve:      login(url.Values{"username": {"nobody"}, "password": {"wrong"}}),
+			wantStatus: http.StatusUnauthorized, wantCode: "user.invalid_credentials",
+		},
+		{
+			name:       "no password",
+			serve:      login(url.Values{"username": {"testuser"}}),
+			wantStatus: http.StatusBadRequest, wantCode: "user.no_password",
+		},
+		{
+			name:       "no token",
+			serve:      validate(""),
+			wantStatus: http.StatusBadRequest, wantCode: domain.ErrNoAuthToken.Code,
+		},
+		{
+			name:       "expired token",
+			serve:      validate(expired),
+			wantStatus: http.StatusUnauthorized, wantCode: "auth.token_expired",
+		},
+		{
+			name:       "malformed token",
+			serve:      validate("invalid"),
+			wantStatus: http.StatusUnauthorized, wantCode: "auth.invalid_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := tt.serve()
+
+			var resp domain.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode error response %s: %v", rec.Body, err)
+			}
+
+			if rec.Code != tt.wantStatus || resp.Code != tt.wantCode || resp.Error == "" {
+				t.Errorf("response = %d %+v, want %d with code %q", rec.Code, resp, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package authsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+// InProcessClient implements authclient.AuthClient by validating tokens with an AuthService of
+// the same process, so a binary serving the auth service along with its clients validates
+// tokens without loopback HTTP requests. Validation is the same as by the validate endpoint.
+type InProcessClient struct {
+	authSvc *AuthService
+}
+
+var (
+	_ authclient.AuthClient      = (*InProcessClient)(nil)
+	_ authclient.RoleValidator   = (*InProcessClient)(nil)
+	_ authclient.ClaimsValidator = (*InProcessClient)(nil)
+)
+
+// NewInProcessClient creates an InProcessClient validating tokens with the given service.
+func NewInProcessClient(authSvc *AuthService) *InProcessClient {
+	return &InProcessClient{authSvc: authSvc}
+}
+
+// Validate implements authclient.AuthClient.Validate by validating the token with the service.
+// Tokens with or without a "Bearer" prefix are accepted.
+func (c *InProcessClient) Validate(ctx context.Context, token string) (string, bool, error) {
+	username, _, ok, err := c.ValidateRoles(ctx, token)
+
+	return username, ok, err
+}
+
+// ValidateRoles implements authclient.RoleValidator.ValidateRoles like Validate,
+// returning the roles embedded into the token.
+func (c *InProcessClient) ValidateRoles(ctx context.Context, token string) (string, []string, bool, error) {
+	claims, ok, err := c.ValidateClaims(ctx, token)
+
+	return claims.Username, claims.Roles, ok, err
+}
+
+// ValidateClaims implements authclient.ClaimsValidator.ValidateClaims like Validate,
+// returning the claims of the token.
+func (c *InProcessClient) ValidateClaims(ctx context.Context, token string) (domain.AuthToken, bool, error) {
+	token, ok := authclient.ParseAuthorization(token)
+	if !ok {
+		return domain.AuthToken{}, false, nil
+	}
+
+	claims, err := c.authSvc.ValidateToken(ctx, token)
+	if errors.Is(err, domain.ErrInvalidAuthToken) {
+		return domain.AuthToken{}, false, nil
+	} else if err != nil {
+		return domain.AuthToken{}, false, fmt.Errorf("validate token: %w", err)
+	}
+
+	return claims, true, nil
+}
+
+// Probe implements the startup probe of auth clients. The service is always available
+// in process, so Probe only fails if the context is done.
+func (c *InProcessClient) Probe(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package authsvc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+// JWTAlgorithm is the JWS algorithm of issued tokens (RFC 7518, RSASSA-PKCS1-v1_5 using SHA-256).
+const JWTAlgorithm = authclient.JWTAlgorithm
+
+// jwtEncoding is the unpadded base64url encoding of JWT segments.
+var jwtEncoding = base64.RawURLEncoding
+
+// SignToken encodes an auth token as a compact JWT signed with RS256.
+// The header identifies the signing key by its KeyID.
+func SignToken(token domain.AuthToken, privateKey *rsa.PrivateKey) (string, error) {
+	header, err := json.Marshal(authclient.JWTHeader{Alg: JWTAlgorithm, Typ: "JWT", Kid: KeyID(&privateKey.PublicKey)})
+	if err != nil {
+		return "", fmt.Errorf("marshal header: %w", err)
+	}
+
+	claims, err := json.Marshal(authclient.JWTClaims{
+		Issuer:    token.Issuer,
+		Subject:   token.Username,
+		IssuedAt:  token.IssuedAt,
+		ExpiresAt: token.ExpiresAt,
+		AuthTime:  token.AuthTime,
+		Roles:     token.Roles,
+		Audience:  token.Audience,
+		Scope:     strings.Join(token.Scopes, " "),
+		Remember:  token.Remember,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal claims: %w", err)
+	}
+
+	signingInput := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+
+	return signingInput + "." + jwtEncoding.EncodeToString(signature), nil
+}
+
+// ValidateToken validates an authentication token signed by the private key of publicKey
+// at the time now, allowing for leeway clock skew, as described by authclient.VerifyToken.
+// Returns the parsed AuthToken if valid, or an error if validation fails.
+func ValidateToken(
+	ctx context.Context,
+	tokenString string,
+	publicKey *rsa.PublicKey,
+	now time.Time,
+	leeway time.Duration,
+) (domain.AuthToken, error) {
+	token, err := authclient.VerifyToken(ctx, tokenString,
+		func(context.Context, string) (*rsa.PublicKey, error) { return publicKey, nil }, now, leeway)
+	if err != nil {
+		return domain.AuthToken{}, fmt.Errorf("verify token: %w", err)
+	}
+
+	return token, nil
+}
+
+// IsLegacyToken reports whether a token uses the legacy format predating JWTs.
+// Legacy tokens are a single base64url segment, so they never contain a dot.
+func IsLegacyToken(tokenString string) bool {
+	return tokenString != "" && !strings.Contains(tokenString, ".")
+}
+
+// PublicJWK returns the public key as JSON Web Key (RFC 7517) for verifying issued tokens.
+func PublicJWK(publicKey *rsa.PublicKey) domain.JWK {
+	return domain.JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: JWTAlgorithm,
+		Kid: KeyID(publicKey),
+		N:   jwtEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:   jwtEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
+
+// KeyID returns the JWK thumbprint (RFC 7638) of the public key, identifying it in
+// the "kid" header of issued tokens.
+func KeyID(publicKey *rsa.PublicKey) string {
+	return authclient.KeyThumbprint(publicKey)
+}
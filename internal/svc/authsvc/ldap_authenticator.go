@@ -0,0 +1,391 @@
+package authsvc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// Auth backends, selecting how the credentials of logins are checked.
+const (
+	// AuthBackendLocal checks credentials against the password hashes of the user repository
+	AuthBackendLocal = "local"
+	// AuthBackendLDAP checks credentials by binding to an LDAP server as the user
+	AuthBackendLDAP = "ldap"
+)
+
+// LDAP protocol constants (RFC 4511).
+const (
+	ldapResultSuccess                 = 0
+	ldapResultInvalidCredentials      = 49
+	ldapStartTLSOID                   = "1.3.6.1.4.1.1466.20037"
+	ldapProtocolVersion               = 3
+	ldapMaxMessageSize                = 1 << 20
+	ldapTagSequence              byte = 0x30
+	ldapTagInteger               byte = 0x02
+	ldapTagOctetString           byte = 0x04
+	ldapTagEnumerated            byte = 0x0a
+	ldapTagBindRequest           byte = 0x60 // [APPLICATION 0] constructed
+	ldapTagBindResponse          byte = 0x61 // [APPLICATION 1] constructed
+	ldapTagUnbindRequest         byte = 0x42 // [APPLICATION 2] primitive
+	ldapTagExtendedRequest       byte = 0x77 // [APPLICATION 23] constructed
+	ldapTagExtendedResponse      byte = 0x78 // [APPLICATION 24] constructed
+	ldapTagSimpleAuth            byte = 0x80 // [0] primitive
+	ldapTagExtendedName          byte = 0x80 // [0] primitive
+)
+
+var (
+	// ErrLDAPUnavailable is returned when the LDAP server cannot check credentials.
+	ErrLDAPUnavailable = domain.NewError(
+		"auth.ldap_unavailable", "ldap server unavailable", http.StatusServiceUnavailable, true)
+	// ErrInvalidLDAPMessage is returned when the LDAP server responds with a malformed message.
+	ErrInvalidLDAPMessage = errors.New("invalid ldap message")
+)
+
+// LDAPConfig configures checking credentials against an LDAP server, e.g. Active Directory.
+type LDAPConfig struct {
+	// URL is the address of the LDAP server, "ldap://host:389" or "ldaps://host:636"
+	URL string `env:"URL" default:""`
+
+	// UserDN is the template of the distinguished name users bind as, "%s" being replaced by the
+	// escaped username, e.g. "uid=%s,ou=people,dc=example,dc=org", or "%s@example.org" for the
+	// user principal names of Active Directory
+	UserDN string `env:"USER_DN" default:""`
+
+	// StartTLS upgrades "ldap://" connections to TLS before binding; "ldaps://" URLs are rejected
+	StartTLS bool `env:"START_TLS" default:"false"`
+
+	// Timeout is the timeout in seconds of binding, including connecting
+	Timeout int64 `env:"TIMEOUT" default:"5"`
+}
+
+// LDAPAuthenticator checks credentials by a simple bind (RFC 4511) to an LDAP server as the user.
+// Users are not looked up in the directory, so their roles are managed by the auth service.
+type LDAPAuthenticator struct {
+	cfg       LDAPConfig
+	address   string
+	tlsConfig *tls.Config // TLS configuration of ldaps:// and StartTLS, nil for plain connections
+}
+
+// NewLDAPAuthenticator creates an LDAPAuthenticator for the configured server.
+// Returns ErrUnknownAuthBackend wrapping the reason if the configuration is incomplete or
+// combines an ldaps:// URL with StartTLS.
+func NewLDAPAuthenticator(cfg LDAPConfig) (*LDAPAuthenticator, error) {
+	if cfg.URL == "" || !strings.Contains(cfg.UserDN, "%s") {
+		return nil, fmt.Errorf("%w: ldap requires a url and a user dn template with %%s", ErrUnknownAuthBackend)
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse ldap url: %w", ErrUnknownAuthBackend, err)
+	}
+
+	authenticator := &LDAPAuthenticator{cfg: cfg, address: u.Host, tlsConfig: nil}
+
+	switch {
+	case u.Scheme == "ldaps" && cfg.StartTLS:
+		return nil, fmt.Errorf("%w: ldap start tls requires an ldap:// url", ErrUnknownAuthBackend)
+	case u.Scheme == "ldaps":
+		authenticator.address = defaultPort(u, "636")
+		authenticator.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12} //nolint:exhaustruct
+	case u.Scheme == "ldap":
+		authenticator.address = defaultPort(u, "389")
+		if cfg.StartTLS {
+			authenticator.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12} //nolint:exhaustruct
+		}
+	default:
+		return nil, fmt.Errorf("%w: ldap url scheme %q", ErrUnknownAuthBackend, u.Scheme)
+	}
+
+	return authenticator, nil
+}
+
+// defaultPort returns the host and port of u, using port if u has none.
+func defaultPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+var _ CredentialVerifier = (*LDAPAuthenticator)(nil)
+
+// Verify implements CredentialVerifier by Authenticate, accepting users without account.
+func (a *LDAPAuthenticator) Verify(ctx context.Context, username, password string, _ *domain.User) (CredentialResult, error) {
+	ok, err := a.Authenticate(ctx, username, password)
+
+	return CredentialResult{Valid: ok, Rehash: false}, err
+}
+
+// Authenticate reports whether the LDAP server accepts the password of the user.
+// Empty passwords are rejected without asking the server, which would accept them
+// as unauthenticated bind (RFC 4513, section 5.1.2).
+// Returns ErrLDAPUnavailable if the server cannot be reached or fails to check the credentials.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (bool, error) {
+	if username == "" || password == "" {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.cfg.Timeout)*time.Second)
+	defer cancel()
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrLDAPUnavailable, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	dn := fmt.Sprintf(a.cfg.UserDN, escapeDN(username))
+
+	code, err := ldapBind(conn, 1, dn, password)
+	if err != nil {
+		return false, fmt.Errorf("%w: bind: %w", ErrLDAPUnavailable, err)
+	}
+
+	_, _ = conn.Write(ldapMessage(2, ldapTLV(ldapTagUnbindRequest))) //nolint:mnd // message ID
+
+	switch code {
+	case ldapResultSuccess:
+		return true, nil
+	case ldapResultInvalidCredentials:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: bind result code %d", ErrLDAPUnavailable, code)
+	}
+}
+
+// dial connects to the LDAP server, upgrading the connection to TLS for ldaps:// or StartTLS.
+func (a *LDAPAuthenticator) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{} //nolint:exhaustruct
+
+	if a.tlsConfig != nil && !a.cfg.StartTLS {
+		conn, err := (&tls.Dialer{NetDialer: dialer, Config: a.tlsConfig}).DialContext(ctx, "tcp", a.address)
+		if err != nil {
+			return nil, fmt.Errorf("dial tls: %w", err)
+		}
+
+		return conn, nil
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", a.address)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	if a.tlsConfig == nil {
+		return conn, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	request := ldapTLV(ldapTagExtendedRequest, ldapTLV(ldapTagExtendedName, []byte(ldapStartTLSOID)))
+	if code, err := ldapRoundTrip(conn, ldapMessage(0, request), ldapTagExtendedResponse); err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("start tls: %w", err)
+	} else if code != ldapResultSuccess {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("start tls: result code %d", code)
+	}
+
+	tlsConn := tls.Client(conn, a.tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+
+	return tlsConn, nil
+}
+
+// ldapBind sends a simple bind request and returns the result code of the response.
+func ldapBind(conn io.ReadWriter, messageID int, dn, password string) (int, error) {
+	request := ldapTLV(ldapTagBindRequest,
+		ldapInteger(ldapProtocolVersion),
+		ldapTLV(ldapTagOctetString, []byte(dn)),
+		ldapTLV(ldapTagSimpleAuth, []byte(password)),
+	)
+
+	return ldapRoundTrip(conn, ldapMessage(messageID, request), ldapTagBindResponse)
+}
+
+// ldapRoundTrip sends a request and reads the result code of the response with the given tag.
+// Responses of other messages, e.g. notices of disconnection, are errors.
+func ldapRoundTrip(conn io.ReadWriter, request []byte, responseTag byte) (int, error) {
+	if _, err := conn.Write(request); err != nil {
+		return 0, fmt.Errorf("write: %w", err)
+	}
+
+	tag, message, err := readBERElement(bufio.NewReader(conn))
+	if err != nil {
+		return 0, fmt.Errorf("read: %w", err)
+	} else if tag != ldapTagSequence {
+		return 0, fmt.Errorf("%w: message tag %#x", ErrInvalidLDAPMessage, tag)
+	}
+
+	// LDAPMessage ::= SEQUENCE { messageID, protocolOp, ... }
+	elements, err := splitBERElements(message)
+	if err != nil || len(elements) < 2 || elements[1].tag != responseTag {
+		return 0, fmt.Errorf("%w: unexpected response", ErrInvalidLDAPMessage)
+	}
+
+	// LDAPResult ::= SEQUENCE { resultCode ENUMERATED, matchedDN, diagnosticMessage, ... }
+	result, err := splitBERElements(elements[1].content)
+	if err != nil || len(result) == 0 || result[0].tag != ldapTagEnumerated || len(result[0].content) == 0 {
+		return 0, fmt.Errorf("%w: missing result code", ErrInvalidLDAPMessage)
+	}
+
+	code := 0
+	for _, b := range result[0].content {
+		code = code<<8 | int(b)
+	}
+
+	return code, nil
+}
+
+// escapeDN escapes the special characters of an attribute value of a distinguished name (RFC 4514).
+func escapeDN(value string) string {
+	var b strings.Builder
+
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// berElement is a decoded BER element.
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// ldapMessage encodes an LDAPMessage envelope of a protocol operation.
+func ldapMessage(messageID int, op []byte) []byte {
+	return ldapTLV(ldapTagSequence, ldapInteger(messageID), op)
+}
+
+// ldapInteger encodes a small non-negative INTEGER.
+func ldapInteger(value int) []byte {
+	return ldapTLV(ldapTagInteger, []byte{byte(value)}) //nolint:gosec // message IDs and versions are below 128
+}
+
+// ldapTLV encodes a BER element of the given tag holding the concatenated contents,
+// using the definite length form.
+func ldapTLV(tag byte, contents ...[]byte) []byte {
+	var content []byte
+	for _, c := range contents {
+		content = append(content, c...)
+	}
+
+	out := []byte{tag}
+
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	default:
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+
+	return append(out, content...)
+}
+
+// readBERElement reads a BER element with a single byte tag and a definite length of up to
+// ldapMaxMessageSize bytes.
+func readBERElement(r io.ByteReader) (tag byte, content []byte, err error) {
+	if tag, err = r.ReadByte(); err != nil {
+		return 0, nil, err //nolint:wrapcheck
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err //nolint:wrapcheck
+	}
+
+	length := int(first)
+
+	if first&0x80 != 0 {
+		count := int(first &^ 0x80)
+		if count == 0 || count > 4 {
+			return 0, nil, fmt.Errorf("%w: length of %d bytes", ErrInvalidLDAPMessage, count)
+		}
+
+		length = 0
+
+		for range count {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err //nolint:wrapcheck
+			}
+
+			length = length<<8 | int(b)
+		}
+	}
+
+	if length > ldapMaxMessageSize {
+		return 0, nil, fmt.Errorf("%w: length %d", ErrInvalidLDAPMessage, length)
+	}
+
+	content = make([]byte, length)
+	for i := range content {
+		if content[i], err = r.ReadByte(); err != nil {
+			return 0, nil, err //nolint:wrapcheck
+		}
+	}
+
+	return tag, content, nil
+}
+
+// splitBERElements decodes the consecutive BER elements of the content of a constructed element.
+func splitBERElements(content []byte) ([]berElement, error) {
+	var (
+		elements []berElement
+		reader   = bytes.NewReader(content)
+	)
+
+	for {
+		tag, element, err := readBERElement(reader)
+		if errors.Is(err, io.EOF) {
+			return elements, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		elements = append(elements, berElement{tag: tag, content: element})
+	}
+}
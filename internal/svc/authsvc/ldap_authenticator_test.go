@@ -0,0 +1,212 @@
+package authsvc_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+)
+
+// ldapBindRequest is the BindRequest of RFC 4511 with simple authentication.
+type ldapBindRequest struct {
+	Version  int
+	DN       []byte
+	Password []byte `asn1:"tag:0"`
+}
+
+// newLDAPServer starts an LDAP server accepting simple binds with the password "secret" for the DNs
+// "uid=<username>,ou=people,dc=example,dc=org", and failing as unavailable for the user "down".
+// Responses use the long length form of Active Directory.
+func newLDAPServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+
+		for {
+			var message struct {
+				ID int
+				Op asn1.RawValue
+			}
+
+			// Requests are short, so their length is a single byte
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(reader, header); err != nil {
+				return
+			}
+
+			content := make([]byte, header[1])
+			if _, err := io.ReadFull(reader, content); err != nil {
+				return
+			}
+
+			if _, err := asn1.Unmarshal(append(header, content...), &message); err != nil {
+				return
+			}
+
+			var bind ldapBindRequest
+			if _, err := asn1.UnmarshalWithParams(message.Op.FullBytes, &bind, "application,tag:0"); err != nil {
+				return // Unbind
+			}
+
+			code := byte(49) // invalidCredentials
+			switch string(bind.DN) {
+			case "uid=down,ou=people,dc=example,dc=org":
+				code = 52 // unavailable
+			case "uid=alice,ou=people,dc=example,dc=org", `uid=doe\, john,ou=people,dc=example,dc=org`:
+				if bind.Version == 3 && string(bind.Password) == "secret" {
+					code = 0
+				}
+			}
+
+			_, _ = conn.Write([]byte{
+				0x30, 0x84, 0, 0, 0, 0x0c, 0x02, 0x01, byte(message.ID),
+				0x61, 0x07, 0x0a, 0x01, code, 0x04, 0x00, 0x04, 0x00,
+			})
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serve(conn)
+		}
+	}()
+
+	return "ldap://" + listener.Addr().String()
+}
+
+func TestLDAPAuthenticator_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	authenticator, err := authsvc.NewLDAPAuthenticator(authsvc.LDAPConfig{
+		URL:     newLDAPServer(t),
+		UserDN:  "uid=%s,ou=people,dc=example,dc=org",
+		Timeout: 5,
+	})
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     bool
+		wantErr  error
+	}{
+		{name: "valid", username: "alice", password: "secret", want: true},
+		{name: "wrong password", username: "alice", password: "wrong"},
+		{name: "empty password", username: "alice", password: ""},
+		{name: "unknown user", username: "bob", password: "secret"},
+		{name: "escaped dn", username: "doe, john", password: "secret", want: true},
+		{name: "injected dn", username: "alice,ou=people", password: "secret"},
+		{name: "unavailable", username: "down", password: "secret", wantErr: authsvc.ErrLDAPUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := authenticator.Authenticate(context.Background(), tt.username, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Authenticate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLDAPAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []authsvc.LDAPConfig{
+		{URL: "", UserDN: "uid=%s,dc=example,dc=org"},
+		{URL: "ldap://localhost", UserDN: "dc=example,dc=org"},
+		{URL: "http://localhost", UserDN: "uid=%s,dc=example,dc=org"},
+		{URL: "ldaps://localhost", UserDN: "uid=%s,dc=example,dc=org", StartTLS: true},
+	} {
+		if _, err := authsvc.NewLDAPAuthenticator(cfg); !errors.Is(err, authsvc.ErrUnknownAuthBackend) {
+			t.Errorf("NewLDAPAuthenticator(%+v) error = %v, want %v", cfg, err, authsvc.ErrUnknownAuthBackend)
+		}
+	}
+}
+
+func TestAuthService_LoginLDAP(t *testing.T) {
+	t.Parallel()
+
+	svc, mockRepo := setupTestService(t)
+	ctx := context.Background()
+
+	authenticator, err := authsvc.NewLDAPAuthenticator(authsvc.LDAPConfig{
+		URL:     newLDAPServer(t),
+		UserDN:  "uid=%s,ou=people,dc=example,dc=org",
+		Timeout: 5,
+	})
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator() error = %v", err)
+	}
+
+	svc.Credentials = authenticator
+
+	// Local passwords are not accepted
+	if err := svc.RegisterUser(ctx, "bob", "secret"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	if _, err := svc.Login(ctx, "bob", "secret", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("Login(bob) error = %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+
+	if _, err := svc.Login(ctx, "alice", "wrong", nil); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("Login(alice, wrong) error = %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+
+	if _, ok := mockRepo.users["alice"]; ok {
+		t.Error("user provisioned after failed login")
+	}
+
+	// Users are provisioned on their first login, and keep their roles afterwards
+	for range 2 {
+		token, err := svc.Login(ctx, "alice", "secret", nil)
+		if err != nil {
+			t.Fatalf("Login(alice) error = %v", err)
+		}
+
+		got, err := authsvc.ValidateToken(ctx, token, &svc.SigningKey.PublicKey, svc.Clock.Now(), 0)
+		if err != nil || got.Username != "alice" {
+			t.Fatalf("ValidateToken() = %+v, %v, want alice", got, err)
+		}
+
+		mockRepo.users["alice"].Roles = []string{"admin"}
+	}
+
+	if user := mockRepo.users["alice"]; len(user.PasswordHash) != 0 || user.LastLoginAt == 0 {
+		t.Errorf("provisioned user = %+v, want no password and last login", user)
+	}
+
+	if _, err := svc.Login(ctx, "down", "secret", nil); !errors.Is(err, authsvc.ErrLDAPUnavailable) {
+		t.Errorf("Login(down) error = %v, want %v", err, authsvc.ErrLDAPUnavailable)
+	}
+}
@@ -0,0 +1,89 @@
+package authsvc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+)
+
+// SignLegacyToken encodes an auth token in the legacy format predating JWTs:
+// The base64url-encoded JSON token followed by its RSA-PSS signature using SHA256.
+// Legacy tokens are only issued to tenants with the jwt_tokens feature flag disabled.
+func SignLegacyToken(token domain.AuthToken, privateKey *rsa.PrivateKey) (string, error) {
+	tokenBytes, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("marshal token: %w", err)
+	}
+
+	hashed := sha256.Sum256(tokenBytes)
+
+	signature, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, hashed[:], nil)
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+
+	return base64.URLEncoding.EncodeToString(append(tokenBytes, signature...)), nil
+}
+
+// ValidateLegacyToken validates an authentication token of the legacy format predating JWTs by:
+// - Decoding the base64url-encoded token
+// - Verifying the RSA-PSS signature using SHA256
+// - Parsing the JSON payload into an AuthToken
+// - Checking the token was issued before now and has not expired, allowing for leeway clock skew
+// Returns the parsed AuthToken if valid, or an error if validation fails.
+// Returns domain.ErrInvalidAuthToken for any validation failure, joined with the reason like ValidateToken.
+// Tokens are now issued as JWTs; legacy tokens are only accepted during the migration,
+// see AuthConfig.AcceptLegacyTokens and FlagJWTTokens.
+func ValidateLegacyToken(
+	ctx context.Context,
+	tokenString string,
+	publicKey *rsa.PublicKey,
+	now time.Time,
+	leeway time.Duration,
+) (domain.AuthToken, error) {
+	// Decode token
+	tokenData, err := base64.URLEncoding.DecodeString(tokenString)
+	if err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, fmt.Errorf("decode token: %w", err))
+	}
+
+	if len(tokenData) < rsa.PSSSaltLengthAuto { // Minimum signature length
+		return domain.AuthToken{}, domain.ErrInvalidAuthToken
+	}
+
+	signatureStart := len(tokenData) - publicKey.Size()
+	if signatureStart < 0 {
+		return domain.AuthToken{}, domain.ErrInvalidAuthToken
+	}
+
+	payload := tokenData[:signatureStart]
+	signature := tokenData[signatureStart:]
+
+	// Verify signature
+	hashed := sha256.Sum256(payload)
+	if err := rsa.VerifyPSS(publicKey, crypto.SHA256, hashed[:], signature, nil); err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, domain.ErrBadSignature)
+	}
+
+	// Parse token
+	var token domain.AuthToken
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return domain.AuthToken{}, errors.Join(domain.ErrInvalidAuthToken, fmt.Errorf("unmarshal token: %w", err))
+	}
+
+	if err := authclient.CheckTokenTimes(token.IssuedAt, token.ExpiresAt, now, leeway); err != nil {
+		return domain.AuthToken{}, err
+	}
+
+	return token, nil
+}
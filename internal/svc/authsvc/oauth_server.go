@@ -0,0 +1,306 @@
+package authsvc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+var (
+	// ErrInvalidOAuthClients is returned when the registered OAuth2 clients cannot be parsed.
+	ErrInvalidOAuthClients = errors.New("invalid oauth clients")
+	// ErrUnknownOAuthClient is returned when an authorization request names an unregistered client
+	// or redirect URI. Such requests are not redirected back to the client.
+	ErrUnknownOAuthClient = domain.NewError(
+		"oauth.unknown_client", "unknown client or redirect uri", http.StatusBadRequest, false)
+)
+
+// OAuth2 error codes (RFC 6749 sections 4.1.2.1 and 5.2).
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthAccessDenied            = "access_denied"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthServerError             = "server_error"
+)
+
+const (
+	// pkceMethodS256 is the only supported PKCE code challenge method (RFC 7636).
+	pkceMethodS256 = "S256"
+	// pkceVerifierMinLength and pkceVerifierMaxLength bound the length of code verifiers.
+	pkceVerifierMinLength = 43
+	pkceVerifierMaxLength = 128
+	// authorizationCodeBytes is the number of random bytes of an authorization code.
+	authorizationCodeBytes = 32
+)
+
+// OAuthConfig configures the OAuth2 authorization code grant.
+type OAuthConfig struct {
+	// Clients are the comma-separated registered public clients "client_id=redirect_uri".
+	// A client may be listed once per redirect URI.
+	Clients string `env:"CLIENTS" default:""`
+
+	// CodeTTL is the validity duration of authorization codes in seconds
+	CodeTTL int64 `env:"CODE_TTL" default:"60"` // 1m
+}
+
+// OAuthError is an OAuth2 error, reported to clients by its code.
+type OAuthError struct {
+	Code        string // OAuth2 error code, e.g. OAuthInvalidGrant
+	Description string // Human-readable description
+}
+
+// Error implements error.
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("oauth: %s: %s", e.Code, e.Description)
+}
+
+// AuthorizeRequest holds the parameters of an authorization request (RFC 6749 section 4.1.1).
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Scope               string // Space-separated scopes requested for the token
+}
+
+// TokenRequest holds the parameters of an access token request (RFC 6749 section 4.1.3).
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	CodeVerifier string
+}
+
+// authorizationCode is an issued authorization code, redeemable once before it expires.
+type authorizationCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	token         string
+	tokenExpiry   time.Time
+	expiresAt     time.Time
+}
+
+// OAuthServer implements the OAuth2 authorization code grant with PKCE for public clients.
+// Users authenticate with their username and password; the access token is the auth token
+// issued by AuthService.Login. Authorization codes are kept in memory, so the token request
+// must reach the replica that issued the code.
+type OAuthServer struct {
+	authSvc *AuthService
+	clients map[string][]string
+	codeTTL time.Duration
+	mu      sync.Mutex
+	codes   map[string]authorizationCode
+	log     logging.Logger
+}
+
+// NewOAuthServer creates an OAuthServer issuing tokens of the given AuthService.
+// Returns ErrInvalidOAuthClients if the registered clients cannot be parsed.
+func NewOAuthServer(authSvc *AuthService, cfg OAuthConfig) (*OAuthServer, error) {
+	clients := make(map[string][]string)
+
+	for _, client := range strings.Split(cfg.Clients, ",") {
+		if client = strings.TrimSpace(client); client == "" {
+			continue
+		}
+
+		clientID, redirectURI, ok := strings.Cut(client, "=")
+		if !ok || clientID == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidOAuthClients, client)
+		}
+
+		if u, err := url.Parse(redirectURI); err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, fmt.Errorf("%w: %q: invalid redirect uri", ErrInvalidOAuthClients, client)
+		}
+
+		clients[clientID] = append(clients[clientID], redirectURI)
+	}
+
+	return &OAuthServer{
+		authSvc: authSvc,
+		clients: clients,
+		codeTTL: time.Duration(cfg.CodeTTL) * time.Second,
+		mu:      sync.Mutex{},
+		codes:   make(map[string]authorizationCode),
+		log:     logging.GetLogger("svc.authsvc.oauth_server"),
+	}, nil
+}
+
+// ValidateAuthorizeRequest checks the parameters of an authorization request.
+// Returns ErrUnknownOAuthClient if the client or redirect URI is not registered, in which
+// case the error must not be redirected to the client. Returns an *OAuthError for any
+// other invalid parameter.
+func (s *OAuthServer) ValidateAuthorizeRequest(req AuthorizeRequest) error {
+	if !slices.Contains(s.clients[req.ClientID], req.RedirectURI) {
+		return ErrUnknownOAuthClient
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		return &OAuthError{Code: OAuthUnsupportedResponseType, Description: "response_type must be code"}
+	case req.CodeChallenge == "":
+		return &OAuthError{Code: OAuthInvalidRequest, Description: "code_challenge required"}
+	case req.CodeChallengeMethod != pkceMethodS256:
+		return &OAuthError{Code: OAuthInvalidRequest, Description: "code_challenge_method must be S256"}
+	case s.authSvc.checkScopes(strings.Fields(req.Scope)) != nil:
+		return &OAuthError{Code: OAuthInvalidScope, Description: "scope not allowed"}
+	}
+
+	return nil
+}
+
+// Authorize authenticates the user of an authorization request and issues an authorization code.
+// Returns the URL redirecting the user back to the client with the code and state.
+// Returns the errors of ValidateAuthorizeRequest and AuthService.Login.
+func (s *OAuthServer) Authorize(
+	ctx context.Context,
+	req AuthorizeRequest,
+	username string,
+	password string,
+) (redirectURL string, err error) {
+	log := s.log.With(logging.Group("oauth", "client_id", req.ClientID, "username", username))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "authorize failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "authorization code issued")
+		}
+	}()
+
+	if err := s.ValidateAuthorizeRequest(req); err != nil {
+		return "", err
+	}
+
+	token, err := s.authSvc.Login(ctx, username, password, strings.Fields(req.Scope))
+	if err != nil {
+		return "", fmt.Errorf("login: %w", err)
+	}
+
+	code := make([]byte, authorizationCodeBytes)
+	if _, err := rand.Read(code); err != nil {
+		return "", fmt.Errorf("generate code: %w", err)
+	}
+
+	codeStr := base64.RawURLEncoding.EncodeToString(code)
+	now := s.authSvc.Clock.Now()
+
+	s.mu.Lock()
+	s.sweepLocked(now)
+	s.codes[codeStr] = authorizationCode{
+		clientID:      req.ClientID,
+		redirectURI:   req.RedirectURI,
+		codeChallenge: req.CodeChallenge,
+		token:         token,
+		tokenExpiry:   now.Add(time.Duration(s.authSvc.Config.TokenDuration) * time.Second),
+		expiresAt:     now.Add(s.codeTTL),
+	}
+	s.mu.Unlock()
+
+	return RedirectURL(req.RedirectURI, url.Values{"code": {codeStr}, "state": {req.State}}), nil
+}
+
+// Exchange redeems an authorization code for an access token.
+// The code verifier must match the code challenge of the authorization request.
+// Returns an *OAuthError if the request is invalid.
+func (s *OAuthServer) Exchange(ctx context.Context, req TokenRequest) (resp domain.OAuthTokenResponse, err error) {
+	log := s.log.With(logging.Group("oauth", "client_id", req.ClientID))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "token exchange failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "access token issued")
+		}
+	}()
+
+	switch {
+	case req.GrantType != "authorization_code":
+		return resp, &OAuthError{Code: OAuthUnsupportedGrantType, Description: "grant_type must be authorization_code"}
+	case req.Code == "":
+		return resp, &OAuthError{Code: OAuthInvalidRequest, Description: "code required"}
+	case len(req.CodeVerifier) < pkceVerifierMinLength || len(req.CodeVerifier) > pkceVerifierMaxLength:
+		return resp, &OAuthError{Code: OAuthInvalidRequest, Description: "code_verifier must have 43 to 128 characters"}
+	}
+
+	// Codes are redeemable once, even if the exchange fails
+	now := s.authSvc.Clock.Now()
+
+	s.mu.Lock()
+	code, ok := s.codes[req.Code]
+	delete(s.codes, req.Code)
+	s.mu.Unlock()
+
+	switch {
+	case !ok || now.After(code.expiresAt):
+		return resp, &OAuthError{Code: OAuthInvalidGrant, Description: "invalid or expired code"}
+	case code.clientID != req.ClientID || code.redirectURI != req.RedirectURI:
+		return resp, &OAuthError{Code: OAuthInvalidGrant, Description: "client_id or redirect_uri mismatch"}
+	case !verifyCodeChallenge(req.CodeVerifier, code.codeChallenge):
+		return resp, &OAuthError{Code: OAuthInvalidGrant, Description: "code_verifier mismatch"}
+	}
+
+	return domain.OAuthTokenResponse{
+		AccessToken: code.token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(code.tokenExpiry.Sub(now).Seconds()),
+	}, nil
+}
+
+// sweepLocked removes expired authorization codes. The caller must hold s.mu.
+func (s *OAuthServer) sweepLocked(now time.Time) {
+	for code, entry := range s.codes {
+		if now.After(entry.expiresAt) {
+			delete(s.codes, code)
+		}
+	}
+}
+
+// verifyCodeChallenge reports whether the S256 code challenge of verifier matches challenge.
+func verifyCodeChallenge(verifier, challenge string) bool {
+	hashed := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(hashed[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// RedirectURL returns the redirect URI extended by the given non-empty query parameters.
+func RedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
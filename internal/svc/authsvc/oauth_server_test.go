@@ -0,0 +1,366 @@
+package authsvc_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/repo/throttle"
+	"github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+const (
+	testClientID    = "app"
+	testRedirectURI = "https://app.example.com/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func setupTestOAuth(t *testing.T) (http.Handler, *authsvc.AuthService) {
+	t.Helper()
+
+	svc, _ := setupTestService(t)
+	if err := svc.RegisterUser(context.Background(), "testuser", "testpass"); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	oauth, err := authsvc.NewOAuthServer(svc, authsvc.OAuthConfig{
+		Clients: testClientID + "=" + testRedirectURI,
+		CodeTTL: 60,
+	})
+	if err != nil {
+		t.Fatalf("NewOAuthServer() error = %v", err)
+	}
+
+	transport := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+	transport.SetOAuthServer(oauth)
+
+	return transport, svc
+}
+
+func authorizeParams(challenge string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func serveForm(handler http.Handler, method, path string, form url.Values) *httptest.ResponseRecorder {
+	var r *http.Request
+	if method == http.MethodGet {
+		r = httptest.NewRequest(method, path+"?"+form.Encode(), nil)
+	} else {
+		r = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	return rec
+}
+
+func TestOAuthServer_AuthorizationCodeFlow(t *testing.T) {
+	t.Parallel()
+
+	handler, svc := setupTestOAuth(t)
+	clk := clock.NewFake(svc.Clock.Now())
+	svc.Clock = clk
+	hashed := sha256.Sum256([]byte(testVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(hashed[:])
+
+	// Login form
+	if rec := serveForm(handler, http.MethodGet, "/auth/authorize", authorizeParams(challenge)); rec.Code != http.StatusOK ||
+		!strings.Contains(rec.Body.String(), `name="code_challenge" value="`+challenge+`"`) {
+		t.Fatalf("GET /auth/authorize = %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Failed login renders the form again
+	form := authorizeParams(challenge)
+	form.Set("username", "testuser")
+	form.Set("password", "wrongpass")
+
+	if rec := serveForm(handler, http.MethodPost, "/auth/authorize", form); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("POST /auth/authorize with wrong password = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Successful login redirects with code and state
+	code := authorizeCode(t, handler, challenge)
+	tokenForm := func(code, verifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"client_id":     {testClientID},
+			"code_verifier": {verifier},
+		}
+	}
+
+	// Subtests are sequential, codes are redeemable once
+	tests := []struct {
+		name      string
+		form      url.Values
+		wantCode  int
+		wantError string
+	}{
+		{name: "wrong grant type", form: url.Values{"grant_type": {"password"}}, wantCode: http.StatusBadRequest, wantError: authsvc.OAuthUnsupportedGrantType},
+		{name: "short verifier", form: tokenForm(code, "short"), wantCode: http.StatusBadRequest, wantError: authsvc.OAuthInvalidRequest},
+		{name: "valid", form: tokenForm(code, testVerifier), wantCode: http.StatusOK},
+		{name: "reused code", form: tokenForm(code, testVerifier), wantCode: http.StatusBadRequest, wantError: authsvc.OAuthInvalidGrant},
+		{name: "wrong verifier", form: tokenForm(authorizeCode(t, handler, challenge), strings.Repeat("a", 43)), wantCode: http.StatusBadRequest, wantError: authsvc.OAuthInvalidGrant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveForm(handler, http.MethodPost, "/auth/token", tt.form)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("POST /auth/token = %d %s, want %d", rec.Code, rec.Body.String(), tt.wantCode)
+			}
+
+			if tt.wantError != "" {
+				var resp domain.OAuthErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error != tt.wantError {
+					t.Errorf("POST /auth/token error = %q (%v), want %q", resp.Error, err, tt.wantError)
+				}
+
+				return
+			}
+
+			var resp domain.OAuthTokenResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if resp.AccessToken == "" || resp.TokenType != "Bearer" || resp.ExpiresIn != 3600 {
+				t.Errorf("POST /auth/token = %+v", resp)
+			}
+		})
+	}
+
+	// Codes expire after the code TTL
+	code = authorizeCode(t, handler, challenge)
+	clk.Advance(61 * time.Second)
+
+	if rec := serveForm(handler, http.MethodPost, "/auth/token", tokenForm(code, testVerifier)); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /auth/token with expired code = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// authorizeCode logs in through the authorization endpoint and returns the issued code.
+func authorizeCode(t *testing.T, handler http.Handler, challenge string) string {
+	t.Helper()
+
+	form := authorizeParams(challenge)
+	form.Set("username", "testuser")
+	form.Set("password", "testpass")
+
+	rec := serveForm(handler, http.MethodPost, "/auth/authorize", form)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("POST /auth/authorize = %d, want %d", rec.Code, http.StatusFound)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), testRedirectURI+"?") || location.Query().Get("state") != "xyz" {
+		t.Fatalf("POST /auth/authorize redirected to %q", rec.Header().Get("Location"))
+	}
+
+	return location.Query().Get("code")
+}
+
+func TestOAuthServer_ValidateAuthorizeRequest(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := setupTestService(t)
+
+	oauth, err := authsvc.NewOAuthServer(svc, authsvc.OAuthConfig{Clients: testClientID + "=" + testRedirectURI})
+	if err != nil {
+		t.Fatalf("NewOAuthServer() error = %v", err)
+	}
+
+	valid := authsvc.AuthorizeRequest{
+		ResponseType: "code", ClientID: testClientID, RedirectURI: testRedirectURI,
+		CodeChallenge: "challenge", CodeChallengeMethod: "S256",
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(*authsvc.AuthorizeRequest)
+		wantErr   error
+		wantOAuth string
+	}{
+		{name: "valid", modify: func(*authsvc.AuthorizeRequest) {}},
+		{name: "unknown client", modify: func(r *authsvc.AuthorizeRequest) { r.ClientID = "other" }, wantErr: authsvc.ErrUnknownOAuthClient},
+		{name: "unregistered redirect", modify: func(r *authsvc.AuthorizeRequest) { r.RedirectURI = "https://evil.example.com/" }, wantErr: authsvc.ErrUnknownOAuthClient},
+		{name: "token response type", modify: func(r *authsvc.AuthorizeRequest) { r.ResponseType = "token" }, wantOAuth: authsvc.OAuthUnsupportedResponseType},
+		{name: "missing challenge", modify: func(r *authsvc.AuthorizeRequest) { r.CodeChallenge = "" }, wantOAuth: authsvc.OAuthInvalidRequest},
+		{name: "plain challenge", modify: func(r *authsvc.AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, wantOAuth: authsvc.OAuthInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := valid
+			tt.modify(&req)
+
+			err := oauth.ValidateAuthorizeRequest(req)
+
+			var oauthErr *authsvc.OAuthError
+
+			switch {
+			case tt.wantOAuth != "":
+				if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantOAuth {
+					t.Errorf("ValidateAuthorizeRequest() error = %v, want %s", err, tt.wantOAuth)
+				}
+			case !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil):
+				t.Errorf("ValidateAuthorizeRequest() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPTransport_Discovery(t *testing.T) {
+	t.Parallel()
+
+	handler, svc := setupTestOAuth(t)
+
+	rec := serveForm(handler, http.MethodGet, "/.well-known/openid-configuration", url.Values{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /.well-known/openid-configuration = %d", rec.Code)
+	}
+
+	var doc domain.OIDCDiscoveryDocument
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode discovery document: %v", err)
+	}
+
+	if doc.Issuer != "http://example.com" || doc.JWKSURI != doc.Issuer+"/.well-known/jwks.json" ||
+		doc.TokenEndpoint != doc.Issuer+"/auth/token" {
+		t.Errorf("discovery document = %+v", doc)
+	}
+
+	rec = serveForm(handler, http.MethodGet, "/.well-known/jwks.json", url.Values{})
+
+	var jwks domain.JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil || len(jwks.Keys) != 1 {
+		t.Fatalf("GET /.well-known/jwks.json = %s (%v)", rec.Body.String(), err)
+	}
+
+	// Tokens are verifiable by the published key alone
+	n, errN := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	e, errE := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	if errN != nil || errE != nil {
+		t.Fatalf("failed to decode key: %v, %v", errN, errE)
+	}
+
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	now := svc.Clock.Now()
+
+	token, err := authsvc.SignToken(domain.AuthToken{Username: "testuser", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}, svc.SigningKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	if _, err := authsvc.ValidateToken(context.Background(), token, publicKey, now, 0); err != nil {
+		t.Errorf("ValidateToken() with published key error = %v", err)
+	}
+
+	header, _, _ := strings.Cut(token, ".")
+	if headerJSON, err := base64.RawURLEncoding.DecodeString(header); err != nil ||
+		!strings.Contains(string(headerJSON), `"kid":"`+jwks.Keys[0].Kid+`"`) {
+		t.Errorf("token header %s does not reference key %s", headerJSON, jwks.Keys[0].Kid)
+	}
+}
+
+func TestHTTPTransport_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	// Without a throttle store, a transport counts requests in memory. Transports sharing a
+	// throttle store, like replicas using Redis, share the limits.
+	tests := []struct {
+		name   string
+		shared bool
+	}{
+		{name: "memory", shared: false},
+		{name: "shared store", shared: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, _ := setupTestService(t)
+			svc.Config.RateLimitPerIP = 4
+			svc.Config.RateLimitPerUsername = 2
+
+			if err := svc.RegisterUser(context.Background(), "alice", "password"); err != nil {
+				t.Fatalf("failed to register user: %v", err)
+			}
+
+			handler := authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{})
+			handlers := []http.Handler{handler, handler}
+
+			if tt.shared {
+				svc.Throttle = throttle.NewMemoryStore("")
+				handlers = []http.Handler{
+					authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{}),
+					authsvc.NewHTTPTransport(svc, authsvc.HTTPTransportConfig{}),
+				}
+			}
+
+			steps := []struct {
+				path       string
+				username   string
+				remoteAddr string
+				wantStatus int
+			}{
+				{"/auth/login", "alice", "192.0.2.1:1234", http.StatusOK},
+				{"/auth/login", "alice", "192.0.2.1:1234", http.StatusOK},
+				// Username limit exceeded, regardless of the client
+				{"/auth/login", "alice", "192.0.2.2:1234", http.StatusTooManyRequests},
+				{"/auth/register", "bob", "192.0.2.1:1234", http.StatusOK},
+				{"/auth/login", "carol", "192.0.2.1:1234", http.StatusUnauthorized},
+				// Client limit exceeded, regardless of the username
+				{"/auth/login", "dave", "192.0.2.1:1234", http.StatusTooManyRequests},
+				{"/auth/register", "dave", "192.0.2.2:1234", http.StatusOK},
+			}
+
+			// The steps alternate between the handlers
+			for i, step := range steps {
+				r := httptest.NewRequest(http.MethodPost, step.path, strings.NewReader(url.Values{
+					"username": {step.username}, "password": {"password"},
+				}.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				r.RemoteAddr = step.remoteAddr
+
+				rec := httptest.NewRecorder()
+				handlers[i%len(handlers)].ServeHTTP(rec, r)
+
+				if rec.Code != step.wantStatus {
+					t.Fatalf("step %d: POST %s as %s from %s = %d, want %d",
+						i, step.path, step.username, step.remoteAddr, rec.Code, step.wantStatus)
+				}
+
+				if retryAfter := rec.Header().Get("Retry-After"); (rec.Code == http.StatusTooManyRequests) != (retryAfter != "") {
+					t.Errorf("step %d: Retry-After = %q", i, retryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package authsvc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordHasherArgon2id selects the argon2id password hasher.
+	PasswordHasherArgon2id = "argon2id"
+	// PasswordHasherBcrypt selects the bcrypt password hasher.
+	PasswordHasherBcrypt = "bcrypt"
+
+	argon2idPrefix   = "$argon2id$"
+	sha256WrapPrefix = "$sha256$"
+	argon2idSaltLen  = 16
+	argon2idKeyLen   = 32
+)
+
+var (
+	// ErrUnknownPasswordHasher is returned when the configured password hasher does not exist.
+	ErrUnknownPasswordHasher = errors.New("unknown password hasher")
+	// ErrUnsupportedPasswordHash is returned when a stored password hash has an unknown format.
+	ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+)
+
+// PasswordHasher hashes passwords for storage and verifies passwords against stored hashes.
+// Hashes are self-describing, i.e. they encode the algorithm and its parameters.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password, using a random salt.
+	Hash(password string) ([]byte, error)
+
+	// Verify reports whether the password matches the hash.
+	// Returns ErrUnsupportedPasswordHash if the hash was not created by this hasher's algorithm.
+	Verify(password string, hash []byte) (bool, error)
+
+	// Supports reports whether the hash was created by this hasher's algorithm.
+	Supports(hash []byte) bool
+
+	// NeedsRehash reports whether the hash should be replaced by a new hash of this hasher,
+	// because it uses another algorithm or other parameters.
+	NeedsRehash(hash []byte) bool
+}
+
+// NewPasswordHasher creates the password hasher selected by the configuration.
+// Returns ErrUnknownPasswordHasher if the configured hasher does not exist.
+func NewPasswordHasher(cfg AuthConfig) (PasswordHasher, error) {
+	switch cfg.PasswordHasher {
+	case PasswordHasherArgon2id:
+		return Argon2idHasher{
+			Time:    uint32(max(cfg.Argon2Time, 1)),   //nolint:gosec
+			Memory:  uint32(max(cfg.Argon2Memory, 8)), //nolint:gosec
+			Threads: uint8(max(cfg.Argon2Threads, 1)), //nolint:gosec
+		}, nil
+	case PasswordHasherBcrypt:
+		return BcryptHasher{Cost: cfg.BcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPasswordHasher, cfg.PasswordHasher)
+	}
+}
+
+// verifyPassword verifies the password against a hash of any supported algorithm,
+// trying the configured hasher first. Reports whether the password matches and
+// whether the hash should be replaced by a hash of the configured hasher.
+func verifyPassword(hasher PasswordHasher, password string, hash []byte) (ok, rehash bool, err error) {
+	for _, h := range append([]PasswordHasher{hasher}, knownHashers()...) {
+		if !h.Supports(hash) {
+			continue
+		}
+
+		ok, err := h.Verify(password, hash)
+		if err != nil {
+			return false, false, fmt.Errorf("verify: %w", err)
+		}
+
+		return ok, ok && hasher.NeedsRehash(hash), nil
+	}
+
+	return false, false, ErrUnsupportedPasswordHash
+}
+
+// knownHashers returns hashers of all supported hash formats with default parameters.
+func knownHashers() []PasswordHasher {
+	return []PasswordHasher{Argon2idHasher{}, BcryptHasher{}, WrappedSHA256Hasher{}, SHA256Hasher{}}
+}
+
+// PasswordHashAlgorithm returns the name of the algorithm of the hash,
+// or "unknown" if the format is not supported.
+func PasswordHashAlgorithm(hash []byte) string {
+	switch {
+	case WrappedSHA256Hasher{}.Supports(hash):
+		return "sha256+" + PasswordHashAlgorithm(hash[len(sha256WrapPrefix):])
+	case Argon2idHasher{}.Supports(hash):
+		return PasswordHasherArgon2id
+	case BcryptHasher{}.Supports(hash):
+		return PasswordHasherBcrypt
+	case SHA256Hasher{}.Supports(hash):
+		return "sha256"
+	default:
+		return "unknown"
+	}
+}
+
+// Argon2idHasher hashes passwords with argon2id. Hashes are encoded in the PHC string format,
+// e.g. "$argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>".
+type Argon2idHasher struct {
+	Time    uint32 // Number of passes over the memory
+	Memory  uint32 // Memory in KiB
+	Threads uint8  // Degree of parallelism
+}
+
+var _ PasswordHasher = Argon2idHasher{}
+
+// Hash implements PasswordHasher.Hash.
+func (h Argon2idHasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, argon2idKeyLen)
+
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+// Verify implements PasswordHasher.Verify.
+func (h Argon2idHasher) Verify(password string, hash []byte) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	//nolint:gosec
+	otherKey := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+// Supports implements PasswordHasher.Supports.
+func (h Argon2idHasher) Supports(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
+
+// NeedsRehash implements PasswordHasher.NeedsRehash.
+func (h Argon2idHasher) NeedsRehash(hash []byte) bool {
+	params, _, _, err := parseArgon2id(hash)
+
+	return err != nil || params != h
+}
+
+// parseArgon2id decodes an argon2id hash in the PHC string format.
+func parseArgon2id(hash []byte) (params Argon2idHasher, salt, key []byte, err error) {
+	var version int
+
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 || string(parts[1]) != "argon2id" {
+		return Argon2idHasher{}, nil, nil, ErrUnsupportedPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: version %q", ErrUnsupportedPasswordHash, parts[2])
+	}
+
+	if _, err := fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Time, &params.Threads); err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: params: %w", ErrUnsupportedPasswordHash, err)
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(string(parts[4])); err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: salt: %w", ErrUnsupportedPasswordHash, err)
+	}
+
+	if key, err = base64.RawStdEncoding.DecodeString(string(parts[5])); err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: key: %w", ErrUnsupportedPasswordHash, err)
+	} else if len(key) == 0 {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("%w: empty key", ErrUnsupportedPasswordHash)
+	}
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. Passwords longer than 72 bytes are rejected.
+type BcryptHasher struct {
+	Cost int // Cost factor, bcrypt.DefaultCost if below bcrypt.MinCost
+}
+
+var _ PasswordHasher = BcryptHasher{}
+
+// Hash implements PasswordHasher.Hash.
+func (h BcryptHasher) Hash(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	if err != nil {
+		return nil, fmt.Errorf("generate: %w", err)
+	}
+
+	return hash, nil
+}
+
+// Verify implements PasswordHasher.Verify.
+func (h BcryptHasher) Verify(password string, hash []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %w", ErrUnsupportedPasswordHash, err)
+	}
+}
+
+// Supports implements PasswordHasher.Supports.
+func (h BcryptHasher) Supports(hash []byte) bool {
+	_, err := bcrypt.Cost(hash)
+
+	return err == nil
+}
+
+// NeedsRehash implements PasswordHasher.NeedsRehash.
+func (h BcryptHasher) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+
+	return err != nil || cost != h.cost()
+}
+
+func (h BcryptHasher) cost() int {
+	if h.Cost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+
+	return h.Cost
+}
+
+// SHA256Hasher verifies legacy unsalted SHA-256 password hashes. It is only used to
+// verify existing hashes, which are replaced by hashes of the configured hasher on login.
+type SHA256Hasher struct{}
+
+var _ PasswordHasher = SHA256Hasher{}
+
+// Hash implements PasswordHasher.Hash.
+func (SHA256Hasher) Hash(password string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(password))
+
+	return sum[:], nil
+}
+
+// Verify implements PasswordHasher.Verify.
+func (h SHA256Hasher) Verify(password string, hash []byte) (bool, error) {
+	if !h.Supports(hash) {
+		return false, ErrUnsupportedPasswordHash
+	}
+
+	sum := sha256.Sum256([]byte(password))
+
+	return hmac.Equal(sum[:], hash), nil
+}
+
+// Supports implements PasswordHasher.Supports.
+func (SHA256Hasher) Supports(hash []byte) bool {
+	return len(hash) == sha256.Size
+}
+
+// NeedsRehash implements PasswordHasher.NeedsRehash. Legacy hashes always need to be replaced.
+func (SHA256Hasher) NeedsRehash(_ []byte) bool {
+	return true
+}
+
+// WrappedSHA256Hasher hashes the hex-encoded SHA-256 digest of passwords with an inner hasher.
+// It migrates legacy SHA-256 hashes to a strong algorithm without knowing the passwords
+// (see Wrap). Wrapped hashes are prefixed by "$sha256$" and replaced on the next login.
+type WrappedSHA256Hasher struct {
+	Inner PasswordHasher // Hasher of the digests, e.g. Argon2idHasher
+}
+
+var _ PasswordHasher = WrappedSHA256Hasher{}
+
+// Hash implements PasswordHasher.Hash.
+func (h WrappedSHA256Hasher) Hash(password string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(password))
+
+	return h.Wrap(sum[:])
+}
+
+// Wrap hashes a legacy SHA-256 password hash, so it verifies the same passwords.
+func (h WrappedSHA256Hasher) Wrap(legacyHash []byte) ([]byte, error) {
+	hash, err := h.Inner.Hash(hex.EncodeToString(legacyHash))
+	if err != nil {
+		return nil, fmt.Errorf("hash digest: %w", err)
+	}
+
+	return append([]byte(sha256WrapPrefix), hash...), nil
+}
+
+// Verify implements PasswordHasher.Verify. The inner hash may be of any supported algorithm.
+func (h WrappedSHA256Hasher) Verify(password string, hash []byte) (bool, error) {
+	if !h.Supports(hash) {
+		return false, ErrUnsupportedPasswordHash
+	}
+
+	inner := hash[len(sha256WrapPrefix):]
+	sum := sha256.Sum256([]byte(password))
+
+	for _, innerHasher := range []PasswordHasher{Argon2idHasher{}, BcryptHasher{}} {
+		if innerHasher.Supports(inner) {
+			return innerHasher.Verify(hex.EncodeToString(sum[:]), inner) //nolint:wrapcheck
+		}
+	}
+
+	return false, ErrUnsupportedPasswordHash
+}
+
+// Supports implements PasswordHasher.Supports.
+func (WrappedSHA256Hasher) Supports(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(sha256WrapPrefix))
+}
+
+// NeedsRehash implements PasswordHasher.NeedsRehash. Wrapped hashes always need to be replaced.
+func (WrappedSHA256Hasher) NeedsRehash(_ []byte) bool {
+	return true
+}
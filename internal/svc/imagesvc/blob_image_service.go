@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"image"
+	"maps"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
 	"github.com/mkrupp/homecase-michael/internal/repo/blob"
 	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
 	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
 )
 
@@ -19,20 +25,34 @@ import (
 // like resizing and caching of resized images.
 type BlobImageService struct {
 	cacheRepo  blob.Repository
+	exifRepo   blob.Repository
+	uploadRepo blob.Repository
+	chunkRepo  blob.Repository
 	mediaSvc   mediasvc.MediaService
 	authClient authclient.AuthClient
 	cfg        ImageConfig
+	processors *ProcessorChain
+	metrics    *imageMetrics
 	log        logging.Logger
+	cacheIndex *cacheIndex
+
+	thumbnailWidths []int
+	thumbnailQueue  chan thumbnailJob
+	allowedWidths   []int
 }
 
 var _ ImageService = (*BlobImageService)(nil)
 
 // NewBlobImageService creates a new BlobImageService with the given configuration.
-// It initializes a cache repository for storing resized images and requires:
+// It initializes repositories for storing resized images and resumable uploads and requires:
 // - A blob repository factory for creating the cache storage
 // - A MediaService for handling basic media operations
 // - An AuthClient for authentication
-// Returns an error if repository initialization fails.
+// The processors run on ingest are selected by cfg.Processors.
+// Returns an error if repository initialization fails or the processor chain is invalid,
+// ErrInvalidThumbnailWidths if cfg.ThumbnailWidths cannot be parsed or are not allowed,
+// ErrInvalidAllowedWidths if cfg.AllowedWidths cannot be parsed,
+// or ErrInvalidJPEGQuality if the configured JPEG qualities are out of range.
 func NewBlobImageService(
 	ctx context.Context,
 	repoFactory blob.RepositoryFactory,
@@ -40,17 +60,63 @@ func NewBlobImageService(
 	authClient authclient.AuthClient,
 	cfg ImageConfig,
 ) (*BlobImageService, error) {
+	processors, err := NewProcessorChain(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new processor chain: %w", err)
+	}
+
+	if err := checkJPEGQuality(cfg); err != nil {
+		return nil, err
+	}
+
+	thumbnailWidths, err := parseThumbnailWidths(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedWidths, err := parseAllowedWidths(cfg, thumbnailWidths)
+	if err != nil {
+		return nil, err
+	}
+
 	cacheRepo, err := repoFactory(ctx, "cache", "bin")
 	if err != nil {
 		return nil, fmt.Errorf("new data repository: %w", err)
 	}
 
+	exifRepo, err := repoFactory(ctx, "exif", "json")
+	if err != nil {
+		return nil, fmt.Errorf("new exif repository: %w", err)
+	}
+
+	uploadRepo, err := repoFactory(ctx, "uploads", "json")
+	if err != nil {
+		return nil, fmt.Errorf("new upload repository: %w", err)
+	}
+
+	chunkRepo, err := repoFactory(ctx, "upload-chunks", "bin")
+	if err != nil {
+		return nil, fmt.Errorf("new upload chunk repository: %w", err)
+	}
+
+	imageMetrics := newImageMetrics(metrics.Default())
+
 	return &BlobImageService{
 		cacheRepo:  cacheRepo,
+		exifRepo:   exifRepo,
+		uploadRepo: uploadRepo,
+		chunkRepo:  chunkRepo,
 		mediaSvc:   mediaSvc,
 		authClient: authClient,
 		cfg:        cfg,
+		processors: processors,
+		metrics:    imageMetrics,
 		log:        logging.GetLogger("svc.imagesvc.blob_image_service"),
+		cacheIndex: newCacheIndex(cfg.CacheMaxSize, imageMetrics.cacheSize),
+
+		thumbnailWidths: thumbnailWidths,
+		thumbnailQueue:  make(chan thumbnailJob, max(cfg.ThumbnailQueueSize, 0)),
+		allowedWidths:   allowedWidths,
 	}, nil
 }
 
@@ -61,21 +127,53 @@ func (imageSvc BlobImageService) Lock(ctx context.Context, imageID domain.MediaI
 }
 
 // Store implements ImageService.Store by delegating to the underlying MediaService.
-func (imageSvc BlobImageService) Store(ctx context.Context, image domain.Media) error {
+// The image is passed through the configured processor chain before it is stored.
+// If enabled, the EXIF metadata of the uploaded image is extracted and stored alongside it.
+// Thumbnails in the configured widths are generated in the background by RunThumbnailWorkers.
+func (imageSvc BlobImageService) Store(ctx context.Context, image domain.Media) (domain.Media, error) {
 	if _, _, err := imageSvc.CheckUploadConstraints(
 		image.Meta().Filename,
 		int64(len(image.Bytes())),
 		image.Bytes(),
 	); err != nil {
-		return fmt.Errorf("check upload constraints: %w", err)
+		return domain.Media{}, fmt.Errorf("check upload constraints: %w", err)
 	}
 
-	//nolint:wrapcheck
-	return imageSvc.mediaSvc.Store(ctx, image)
+	// Processors may strip the EXIF metadata, so it is extracted first
+	exif := imageSvc.extractExif(ctx, image)
+	if exif.TakenAt != "" || exif.GPS != nil {
+		meta := image.Meta()
+		meta.TakenAt = exif.TakenAt
+
+		if exif.GPS != nil {
+			meta.Location = &domain.MediaLocation{Latitude: exif.GPS.Latitude, Longitude: exif.GPS.Longitude}
+		}
+
+		image = domain.NewMedia(image.Bytes(), meta)
+	}
+
+	image, err := imageSvc.processors.Process(ctx, image)
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("process image: %w", err)
+	}
+
+	if err := imageSvc.mediaSvc.Store(ctx, image); err != nil {
+		return domain.Media{}, fmt.Errorf("store media: %w", err)
+	}
+
+	if !exif.IsEmpty() {
+		if err := imageSvc.storeExif(ctx, image.ID(), exif); err != nil {
+			return domain.Media{}, fmt.Errorf("store exif: %w", err)
+		}
+	}
+
+	imageSvc.enqueueThumbnails(ctx, image.ID())
+
+	return image, nil
 }
 
-// Delete implements ImageService.Delete and additionally handles cleanup of cached resized images
-// when the original image is deleted.
+// Delete implements ImageService.Delete and additionally removes the extracted EXIF metadata,
+// and the cached resized images when the original image is deleted.
 func (imageSvc BlobImageService) Delete(ctx context.Context, imageID domain.MediaID) (err error) {
 	log := imageSvc.log.With(logging.Group("image", "id", imageID))
 
@@ -88,24 +186,30 @@ func (imageSvc BlobImageService) Delete(ctx context.Context, imageID domain.Medi
 	}()
 
 	// Delete image
-	pruned, dataID, err := imageSvc.mediaSvc.Delete(ctx, imageID)
+	result, err := imageSvc.mediaSvc.Delete(ctx, imageID)
 	if err != nil {
 		return fmt.Errorf("delete media: %w", err)
 	}
 
-	log = log.With(logging.Group("image", "pruned", pruned))
+	log = log.With(logging.Group("image", "pruned", result.Pruned))
+
+	if err := imageSvc.deleteExif(ctx, imageID); err != nil {
+		return fmt.Errorf("delete exif: %w", err)
+	}
 
 	// Delete caches if image was pruned
-	if pruned {
-		unlock, err := imageSvc.cacheRepo.Lock(ctx, dataID, true)
+	if result.Pruned {
+		unlock, err := imageSvc.cacheRepo.Lock(ctx, result.DataID, true)
 		if err != nil {
 			return fmt.Errorf("lock cache: %w", err)
 		}
 		defer unlock()
 
-		if err := imageSvc.cacheRepo.DeleteAll(ctx, dataID, "_*"); err != nil {
+		if err := imageSvc.cacheRepo.DeleteAll(ctx, result.DataID, "_*"); err != nil {
 			return fmt.Errorf("delete cache: %w", err)
 		}
+
+		imageSvc.cacheIndex.removePrefix(string(result.DataID) + "_")
 	}
 
 	return nil
@@ -118,8 +222,32 @@ func (imageSvc BlobImageService) Fetch(
 	ctx context.Context,
 	imageID domain.MediaID,
 	width int,
+) (domain.Media, error) {
+	return imageSvc.Transform(ctx, imageID, transform.Spec{Width: width})
+}
+
+// FetchMeta implements ImageService.FetchMeta by delegating to the underlying MediaService.
+func (imageSvc BlobImageService) FetchMeta(ctx context.Context, imageID domain.MediaID) (domain.MediaMeta, error) {
+	//nolint:wrapcheck
+	return imageSvc.mediaSvc.FetchMeta(ctx, imageID)
+}
+
+// Transform implements ImageService.Transform.
+// Transformed images are cached by the content hash of the original, the canonical spec and
+// the progressive or interlaced encoding of the output.
+// A spec converting the image to its own format does not convert it. Requested qualities are
+// limited to the bounds of ImageConfig; JPEG images without one use ImageConfig.JPEGQuality.
+// Widths are restricted to ImageConfig.AllowedWidths, if set.
+// If the spec is the identity transformation, returns the original image, unless it has an
+// EXIF orientation and ImageConfig.AutoOrientOriginals is enabled.
+//
+//nolint:funlen
+func (imageSvc BlobImageService) Transform(
+	ctx context.Context,
+	imageID domain.MediaID,
+	spec transform.Spec,
 ) (image domain.Media, err error) {
-	log := imageSvc.log.With(logging.Group("image", "id", imageID))
+	log := imageSvc.log.With(logging.Group("image", "id", imageID, "transform", spec.String()))
 
 	defer func() {
 		if err != nil {
@@ -135,13 +263,40 @@ func (imageSvc BlobImageService) Fetch(
 		return domain.Media{}, fmt.Errorf("fetch media: %w", err)
 	}
 
-	if width == 0 {
+	if imageFormatTypes[spec.Format] == image.MIMEType() {
+		spec.Format = ""
+	}
+
+	spec.Quality = imageSvc.boundQuality(spec.Quality)
+
+	spec.Width, err = imageSvc.allowedWidth(spec.Width)
+	if err != nil {
+		return domain.Media{}, err
+	}
+
+	spec = spec.Canonical()
+	if spec.IsIdentity() && !imageSvc.orientsOriginal(image) {
 		// Return original image
 		return image, nil
 	}
 
+	if spec.Width != 0 {
+		imageSvc.metrics.requestedWidth.Observe(float64(spec.Width))
+	}
+
+	outType, err := transformOutputType(image.MIMEType(), spec)
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("output type: %w", err)
+	}
+
+	meta := image.Meta()
+	if outType != meta.MIMEType {
+		meta.MIMEType = outType
+		meta.Filename = strings.TrimSuffix(meta.Filename, filepath.Ext(meta.Filename)) + imageTypeExts[outType]
+	}
+
 	// Try serve from cache
-	cacheID := domain.BlobID(fmt.Sprintf("%s_%d", image.Hash(), width))
+	cacheID := imageSvc.transformCacheID(image.Hash(), spec, outType)
 
 	unlock, err := imageSvc.cacheRepo.Lock(ctx, cacheID, false)
 	if err != nil {
@@ -156,32 +311,222 @@ func (imageSvc BlobImageService) Fetch(
 		}
 
 		log = log.With(logging.Group("image", "cached", true))
+		imageSvc.metrics.cacheRequests.With("hit", widthBucket(spec.Width)).Inc()
+		imageSvc.cacheIndex.touch(cacheID, cacheBlob.Size())
 
-		return domain.NewMedia(cacheBlob.Bytes(), image.Meta()), nil
+		return domain.NewMedia(cacheBlob.Bytes(), meta), nil
 	}
 
-	// Resize image
-	resized, err := imageSvc.resizeImage(ctx, image.Bytes(), image.MIMEType(), width)
+	imageSvc.metrics.cacheRequests.With("miss", widthBucket(spec.Width)).Inc()
+
+	// Transform image
+	transformed, err := imageSvc.transformImage(ctx, image.Bytes(), image.MIMEType(), spec)
 	if err != nil {
-		return domain.Media{}, fmt.Errorf("resize image: %w", err)
+		return domain.Media{}, fmt.Errorf("transform image: %w", err)
 	}
 
-	resizedMedia := domain.NewMedia(resized, image.Meta())
+	transformedMedia := domain.NewMedia(transformed, meta)
 
 	// Update cache
-	cacheBlob := domain.NewBlob(cacheID, resizedMedia.Bytes())
+	cacheBlob := domain.NewBlob(cacheID, transformedMedia.Bytes())
 
 	if err := imageSvc.cacheRepo.Store(ctx, cacheBlob); err != nil {
 		return domain.Media{}, fmt.Errorf("store: %w", err)
 	}
 
-	return resizedMedia, nil
+	imageSvc.metrics.cacheStoredBytes.Add(float64(cacheBlob.Size()))
+	imageSvc.cacheIndex.touch(cacheID, cacheBlob.Size())
+
+	return transformedMedia, nil
+}
+
+// transformCacheID returns the ID of the cached transform of an original by spec to outType.
+// Progressive JPEG and interlaced PNG images are cached separately, so changing
+// ImageConfig.ProgressiveJPEG or ImageConfig.InterlacedPNG re-encodes them.
+func (imageSvc BlobImageService) transformCacheID(hash string, spec transform.Spec, outType string) domain.BlobID {
+	key := spec.CacheKey()
+
+	switch {
+	case outType == MIMETypeJPEG && imageSvc.cfg.ProgressiveJPEG:
+		key += "-progressive"
+	case outType == MIMETypePNG && imageSvc.cfg.InterlacedPNG:
+		key += "-interlaced"
+	}
+
+	return domain.BlobID(fmt.Sprintf("%s_%s", hash, key))
+}
+
+// TransformMeta implements ImageService.TransformMeta.
+// Originals are read if ImageConfig.AutoOrientOriginals is enabled, as turning them upright
+// changes their content.
+func (imageSvc BlobImageService) TransformMeta(
+	ctx context.Context,
+	imageID domain.MediaID,
+	spec transform.Spec,
+) (domain.MediaMeta, error) {
+	if spec.IsIdentity() && !imageSvc.cfg.AutoOrientOriginals {
+		return imageSvc.FetchMeta(ctx, imageID)
+	}
+
+	image, err := imageSvc.Transform(ctx, imageID, spec)
+	if err != nil {
+		return domain.MediaMeta{}, err
+	}
+
+	return image.Meta(), nil
+}
+
+// Exists implements ImageService.Exists by delegating to the underlying MediaService.
+func (imageSvc BlobImageService) Exists(ctx context.Context, imageID domain.MediaID) bool {
+	return imageSvc.mediaSvc.Exists(ctx, imageID)
+}
+
+// FindByHash implements ImageService.FindByHash.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) FindByHash(ctx context.Context, hash string) ([]domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.FindByHash(ctx, hash)
+}
+
+// List implements ImageService.List.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) List(ctx context.Context) ([]domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.List(ctx)
+}
+
+// ListChanges implements ImageService.ListChanges.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) ListChanges(ctx context.Context, since int64) (domain.MediaChanges, error) {
+	return imageSvc.mediaSvc.ListChanges(ctx, since)
+}
+
+// ListPage implements ImageService.ListPage.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) ListPage(
+	ctx context.Context,
+	after domain.MediaPosition,
+	limit int,
+) ([]domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.ListPage(ctx, after, limit)
+}
+
+// SetVisibility implements ImageService.SetVisibility by delegating to the underlying MediaService.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) SetVisibility(
+	ctx context.Context,
+	imageID domain.MediaID,
+	visibility domain.MediaVisibility,
+) (domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.SetVisibility(ctx, imageID, visibility)
+}
+
+// Share implements ImageService.Share by delegating to the underlying MediaService.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) Share(ctx context.Context, imageID domain.MediaID, username string) (domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.Share(ctx, imageID, username)
+}
+
+// Unshare implements ImageService.Unshare by delegating to the underlying MediaService.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) Unshare(ctx context.Context, imageID domain.MediaID, username string) (domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.Unshare(ctx, imageID, username)
+}
+
+// ListLocated implements ImageService.ListLocated.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) ListLocated(ctx context.Context) ([]domain.MediaMeta, error) {
+	return imageSvc.mediaSvc.ListLocated(ctx)
+}
+
+// ValidateUpload implements ImageService.ValidateUpload.
+func (imageSvc BlobImageService) ValidateUpload(ctx context.Context, img domain.Media) (image.Config, error) {
+	if _, _, err := imageSvc.CheckUploadConstraints(
+		img.Meta().Filename,
+		img.Size(),
+		img.Bytes(),
+	); err != nil {
+		return image.Config{}, fmt.Errorf("check upload constraints: %w", err)
+	}
+
+	imgConfig, err := decodeImageConfig(bytes.NewReader(img.Bytes()), img.MIMEType())
+	if err != nil {
+		return image.Config{}, fmt.Errorf("decode image config: %w", err)
+	}
+
+	return imgConfig, nil
 }
 
 func (imageSvc BlobImageService) MaxSize() int64 {
 	return imageSvc.mediaSvc.MaxSize()
 }
 
+// UploadConstraints implements ImageService.UploadConstraints.
+func (imageSvc BlobImageService) UploadConstraints() domain.MediaUploadConstraints {
+	extensions := slices.Sorted(maps.Keys(imageExtTypes))
+
+	mimeTypes := make([]string, 0, len(imageExtTypes))
+	for _, mimeType := range imageExtTypes {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+
+	slices.Sort(mimeTypes)
+
+	return domain.MediaUploadConstraints{
+		MaxSize:      imageSvc.MaxSize(),
+		MaxWidth:     imageSvc.cfg.MaxWidth,
+		MaxHeight:    imageSvc.cfg.MaxHeight,
+		MaxPixels:    imageSvc.cfg.MaxPixels,
+		ChunkMaxSize: imageSvc.cfg.UploadChunkMaxSize,
+		MIMETypes:    slices.Compact(mimeTypes),
+		Extensions:   extensions,
+	}
+}
+
+// CacheStats implements ImageService.CacheStats.
+// The number of entries is only known if the cache size is limited by ImageConfig.CacheMaxSize,
+// as it would require listing the cached images otherwise.
+func (imageSvc BlobImageService) CacheStats() domain.CacheStats {
+	return domain.NewCacheStats(imageSvc.cacheIndex.len(), 0,
+		int64(imageSvc.metrics.cacheRequests.Sum("result", "hit")),
+		int64(imageSvc.metrics.cacheRequests.Sum("result", "miss")),
+	)
+}
+
+// RecordDownload implements ImageService.RecordDownload.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) RecordDownload(ctx context.Context, username string, size int64) error {
+	return imageSvc.mediaSvc.RecordDownload(ctx, username, size)
+}
+
+// Usage implements ImageService.Usage.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) Usage(ctx context.Context, username string) (domain.MediaUsage, error) {
+	return imageSvc.mediaSvc.Usage(ctx, username)
+}
+
+// CheckDownloadCap implements ImageService.CheckDownloadCap.
+//
+//nolint:wrapcheck
+func (imageSvc BlobImageService) CheckDownloadCap(ctx context.Context, username string) error {
+	return imageSvc.mediaSvc.CheckDownloadCap(ctx, username)
+}
+
+// DownloadCap implements ImageService.DownloadCap.
+func (imageSvc BlobImageService) DownloadCap() int64 {
+	return imageSvc.mediaSvc.DownloadCap()
+}
+
+// CheckUploadConstraints implements ImageService.CheckUploadConstraints.
+// Returns domain.ErrImageDimensionsTooLarge if the image exceeds the configured dimensions.
 func (imageSvc BlobImageService) CheckUploadConstraints(
 	filename string,
 	size int64,
@@ -202,33 +547,59 @@ func (imageSvc BlobImageService) CheckUploadConstraints(
 		return "", true, nil
 	}
 
+	if !matchesImageType(image, imageType) {
+		return "", false, fmt.Errorf("%w: %q", domain.ErrImageTypeMismatch, filenameExt)
+	}
+
+	if err := imageSvc.checkDimensions(image, imageType); err != nil {
+		return "", false, err
+	}
+
+	return imageType, true, nil
+}
+
+// matchesImageType reports whether the content of an image matches the given image type.
+func matchesImageType(image []byte, imageType string) bool {
 	for _, header := range imageExtHeaders[imageType] {
 		if bytes.HasPrefix(image, []byte(header)) {
-			return imageType, true, nil
+			return true
 		}
 	}
 
-	return "", false, fmt.Errorf("%w: %q", domain.ErrImageTypeMismatch, filenameExt)
+	sniff, ok := imageTypeSniffers[imageType]
+
+	return ok && sniff(image)
 }
 
-func (imageSvc BlobImageService) resizeImage(
+func (imageSvc BlobImageService) transformImage(
 	ctx context.Context,
 	data []byte,
 	ctype string,
-	width int,
-) (resized []byte, err error) {
+	spec transform.Spec,
+) (transformed []byte, err error) {
 	log := imageSvc.log.With(logging.Group("image",
 		"type", ctype,
-		logging.Group("target", "width", width),
+		logging.Group("target", "width", spec.Width, "height", spec.Height, "transform", spec.String()),
 	))
 
 	defer func() {
 		if err != nil {
-			log.ErrorContext(ctx, "image resize failed", "error", err)
+			log.ErrorContext(ctx, "image transform failed", "error", err)
 		} else {
-			log.DebugContext(ctx, "image resized")
+			log.DebugContext(ctx, "image transformed")
 		}
 	}()
 
-	return resizeImage(data, ctype, width, imageSvc.cfg.Interpolator)
+	defer imageSvc.metrics.resizeDuration.With(ctype).ObserveDuration(time.Now())
+
+	if spec.Quality == 0 {
+		spec.Quality = imageSvc.cfg.JPEGQuality
+	}
+
+	transformed, _, err = transformImage(data, ctype, spec, imageSvc.cfg.Interpolator, encodeOptions{
+		progressiveJPEG: imageSvc.cfg.ProgressiveJPEG,
+		interlacedPNG:   imageSvc.cfg.InterlacedPNG,
+	})
+
+	return transformed, err
 }
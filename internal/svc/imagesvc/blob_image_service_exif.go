@@ -0,0 +1,138 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// Exif implements ImageService.Exif.
+func (imageSvc BlobImageService) Exif(ctx context.Context, imageID domain.MediaID) (domain.MediaExif, error) {
+	// Make sure the image exists and the user is allowed to access it
+	meta, err := imageSvc.mediaSvc.FetchMeta(ctx, imageID)
+	if err != nil {
+		return domain.MediaExif{}, fmt.Errorf("fetch meta: %w", err)
+	}
+
+	unlock, err := imageSvc.exifRepo.Lock(ctx, imageID, false)
+	if err != nil {
+		return domain.MediaExif{}, fmt.Errorf("lock exif: %w", err)
+	}
+	defer unlock()
+
+	if !imageSvc.exifRepo.Exists(ctx, imageID) {
+		return domain.MediaExif{}, fmt.Errorf("fetch exif: %w", os.ErrNotExist)
+	}
+
+	exifBlob, err := imageSvc.exifRepo.Fetch(ctx, imageID)
+	if err != nil {
+		return domain.MediaExif{}, fmt.Errorf("fetch exif: %w", err)
+	}
+
+	var exif domain.MediaExif
+	if err := json.Unmarshal(exifBlob.Bytes(), &exif); err != nil {
+		return domain.MediaExif{}, fmt.Errorf("unmarshal exif: %w", err)
+	}
+
+	// Locations are private to the owner, even if others are granted access to the image
+	if username, _ := context_.UsernameFromContext(ctx); username != meta.Owner {
+		exif.GPS = nil
+	}
+
+	return exif, nil
+}
+
+// extractExif returns the EXIF metadata of an uploaded image, or empty metadata if extraction
+// is disabled. Images with malformed metadata are still accepted, so errors are only logged.
+func (imageSvc BlobImageService) extractExif(ctx context.Context, image domain.Media) domain.MediaExif {
+	if !imageSvc.cfg.ExifExtract {
+		return domain.MediaExif{}
+	}
+
+	exif, err := extractExif(image.Bytes(), image.MIMEType(), imageSvc.cfg.ExifGPS)
+	if err != nil {
+		imageSvc.log.WarnContext(ctx, "exif extraction failed",
+			logging.Group("image", "filename", image.Meta().Filename, "type", image.MIMEType()),
+			"error", err,
+		)
+
+		return domain.MediaExif{}
+	}
+
+	return exif
+}
+
+// storeExif stores the EXIF metadata of the image with the given ID.
+func (imageSvc BlobImageService) storeExif(ctx context.Context, imageID domain.MediaID, exif domain.MediaExif) error {
+	data, err := json.Marshal(exif)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	unlock, err := imageSvc.exifRepo.Lock(ctx, imageID, true)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer unlock()
+
+	if err := imageSvc.exifRepo.Store(ctx, domain.NewBlob(imageID, data)); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+
+	return nil
+}
+
+// copyExif copies the EXIF metadata of the image with ID from to the image with ID to, if any.
+func (imageSvc BlobImageService) copyExif(ctx context.Context, from, to domain.MediaID) error {
+	unlock, err := imageSvc.exifRepo.Lock(ctx, from, false)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer unlock()
+
+	if !imageSvc.exifRepo.Exists(ctx, from) {
+		return nil
+	}
+
+	exifBlob, err := imageSvc.exifRepo.Fetch(ctx, from)
+	if err != nil {
+		return fmt.Errorf("fetch: %w", err)
+	}
+
+	unlockTo, err := imageSvc.exifRepo.Lock(ctx, to, true)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer unlockTo()
+
+	if err := imageSvc.exifRepo.Store(ctx, domain.NewBlob(to, exifBlob.Bytes())); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+
+	return nil
+}
+
+// deleteExif removes the EXIF metadata of the image with the given ID, if any.
+func (imageSvc BlobImageService) deleteExif(ctx context.Context, imageID domain.MediaID) error {
+	unlock, err := imageSvc.exifRepo.Lock(ctx, imageID, true)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer unlock()
+
+	if !imageSvc.exifRepo.Exists(ctx, imageID) {
+		return nil
+	}
+
+	if err := imageSvc.exifRepo.Delete(ctx, imageID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// streamHeaderSize is the number of leading bytes of a streamed image its type and dimensions
+// are read from. It covers the metadata segments commonly preceding the dimensions of a JPEG image.
+const streamHeaderSize = 1 << 20
+
+// StoreFrom implements ImageService.StoreFrom. The image is streamed into the MediaService if it
+// is stored as uploaded, which is if it passes through all configured processors, and its EXIF
+// metadata is neither extracted nor transcoded from HEIC/HEIF. Its type and dimensions are checked
+// from its leading bytes. Other images, and images whose dimensions are not found in their
+// leading bytes, are read into memory and stored by Store.
+func (imageSvc BlobImageService) StoreFrom(
+	ctx context.Context,
+	meta domain.MediaMeta,
+	content io.ReadSeeker,
+) (domain.MediaMeta, error) {
+	// The size is checked before anything is read
+	if _, _, err := imageSvc.CheckUploadConstraints(meta.Filename, meta.Size, nil); err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("check upload constraints: %w", err)
+	}
+
+	header, err := io.ReadAll(io.LimitReader(content, streamHeaderSize))
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("read header: %w", err)
+	}
+
+	mimeType, _, err := imageSvc.CheckUploadConstraints(meta.Filename, meta.Size, header)
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("check upload constraints: %w", err)
+	}
+
+	meta.MIMEType = mimeType
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("seek: %w", err)
+	}
+
+	if !imageSvc.streamable(header, mimeType) {
+		return imageSvc.storeBuffered(ctx, meta, content)
+	}
+
+	// The ID depends on the MIME type, which is only known now
+	meta = meta.WithContent(meta.Hash, meta.Size)
+
+	if err := imageSvc.mediaSvc.StoreFrom(ctx, meta, content); err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("store media: %w", err)
+	}
+
+	imageSvc.log.DebugContext(ctx, "image streamed",
+		logging.Group("image", "id", meta.ID, "type", meta.MIMEType, "size", meta.Size))
+
+	imageSvc.enqueueThumbnails(ctx, meta.ID)
+
+	return meta, nil
+}
+
+// streamable reports whether an image of the given type, starting with header, is stored as
+// uploaded and its dimensions are known from header, so it can be streamed into storage.
+func (imageSvc BlobImageService) streamable(header []byte, mimeType string) bool {
+	if imageSvc.cfg.ExifExtract {
+		return false
+	}
+
+	if !imageSvc.processors.PassesThrough(mimeType) {
+		return false
+	}
+
+	// Streamed images are never decoded on upload, so their dimensions must have been checked
+	_, err := decodeImageConfig(bytes.NewReader(header), mimeType)
+
+	return err == nil
+}
+
+// storeBuffered reads the image from content into memory and stores it by Store.
+func (imageSvc BlobImageService) storeBuffered(
+	ctx context.Context,
+	meta domain.MediaMeta,
+	content io.Reader,
+) (domain.MediaMeta, error) {
+	data, err := io.ReadAll(io.LimitReader(content, meta.Size+1))
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("read: %w", err)
+	}
+
+	if int64(len(data)) != meta.Size {
+		return domain.MediaMeta{}, fmt.Errorf("%w: got %d bytes, want %d", domain.ErrContentMismatch, len(data), meta.Size)
+	}
+
+	image, err := imageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{ //nolint:exhaustruct
+		Filename: meta.Filename,
+		Owner:    meta.Owner,
+		MIMEType: meta.MIMEType,
+	}))
+	if err != nil {
+		return domain.MediaMeta{}, err
+	}
+
+	return image.Meta(), nil
+}
@@ -0,0 +1,71 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestBlobImageService_StoreFrom(t *testing.T) {
+	t.Parallel()
+
+	data := encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true)
+
+	hasher := domain.NewContentHasher()
+	_, _ = hasher.Write(data)
+
+	tests := []struct {
+		name       string
+		processors string
+		filename   string
+		hash       string
+		wantErr    error
+	}{
+		{name: "streamed", processors: "", filename: "photo.png", hash: hasher.Hash()},
+		{name: "passed through", processors: "optimize", filename: "photo.png", hash: hasher.Hash()},
+		{name: "buffered", processors: "exif_strip", filename: "photo.png", hash: hasher.Hash()},
+		{name: "hash mismatch", processors: "", filename: "photo.png", hash: "0000", wantErr: domain.ErrContentMismatch},
+		{name: "type mismatch", processors: "", filename: "photo.jpg", hash: hasher.Hash(), wantErr: domain.ErrImageTypeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			imageSvc, err := newTestImageService(t, testConfig(tt.processors))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+			meta := domain.MediaMeta{Filename: tt.filename, Owner: "alice"}.WithContent(tt.hash, int64(len(data)))
+
+			stored, err := imageSvc.StoreFrom(ctx, meta, bytes.NewReader(data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("StoreFrom() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if stored.MIMEType != imagesvc.MIMETypePNG || stored.Owner != "alice" {
+				t.Errorf("StoreFrom() = %+v, want PNG image of alice", stored)
+			}
+
+			fetched, err := imageSvc.Fetch(ctx, stored.ID, 0)
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			if !bytes.Equal(fetched.Bytes(), data) {
+				t.Error("stored image differs from the uploaded image")
+			}
+		})
+	}
+}
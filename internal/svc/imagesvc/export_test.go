@@ -0,0 +1,6 @@
+package imagesvc
+
+// EncodeProgressiveJPEG exposes encodeProgressiveJPEG to the decoder round-trip tests.
+//
+//nolint:gochecknoglobals
+var EncodeProgressiveJPEG = encodeProgressiveJPEG
@@ -2,26 +2,33 @@ package imagesvc
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
 	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+	"github.com/mkrupp/homecase-michael/internal/infra/panics"
 	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
 	"github.com/mkrupp/homecase-michael/internal/svc/authsvc/authclient"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
 	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+	"github.com/mkrupp/homecase-michael/internal/util/semaphore"
+	"github.com/mkrupp/homecase-michael/internal/util/tokenbucket"
 )
 
-var ErrPanic = errors.New("panic")
+// ErrPanic matches the *panics.PanicError of a panic recovered in the upload pipeline.
+var ErrPanic = panics.ErrPanic
 
 // HTTPTransportConfig contains configuration parameters for the HTTP transport layer.
 type HTTPTransportConfig struct {
@@ -43,24 +50,225 @@ type HTTPTransportConfig struct {
 	// Default is "width".
 	URLWidthParam string `env:"URL_WIDTH_PARAM" default:"width"`
 
+	// URLQualityParam is the URL parameter for specifying the encoding quality of JPEG images.
+	// Default is "quality".
+	URLQualityParam string `env:"URL_QUALITY_PARAM" default:"quality"`
+
+	// URLRotateParam is the URL parameter for rotating images clockwise by 90, 180 or 270 degrees.
+	// Default is "rotate".
+	URLRotateParam string `env:"URL_ROTATE_PARAM" default:"rotate"`
+
+	// URLFlipParam is the URL parameter for mirroring images horizontally ("h") or vertically ("v").
+	// Default is "flip".
+	URLFlipParam string `env:"URL_FLIP_PARAM" default:"flip"`
+
+	// URLTransformParam is the URL parameter carrying a transform spec, e.g. "w:640,h:480,fit:cover".
+	// Default is "t".
+	URLTransformParam string `env:"URL_TRANSFORM_PARAM" default:"t"`
+
+	// URLSignatureParam is the URL parameter carrying the signature of a transform spec.
+	// Default is "sig".
+	URLSignatureParam string `env:"URL_SIGNATURE_PARAM" default:"sig"`
+
+	// URLExpiresParam is the URL parameter carrying the expiry of a signed share URL in Unix seconds.
+	// Default is "expires".
+	URLExpiresParam string `env:"URL_EXPIRES_PARAM" default:"expires"`
+
+	// TransformSecret is the HMAC secret used to sign transform specs. If set, downloads
+	// with a valid signature are served without authentication, srcset URLs are signed,
+	// and share URLs can be created at /media/{id}/share.
+	// Default is empty, which disables signed downloads.
+	TransformSecret string `env:"TRANSFORM_SECRET" default:""`
+
+	// ShareDefaultTTL is the validity duration of share URLs in seconds, unless requested otherwise.
+	// Default is 86400 (1 day).
+	ShareDefaultTTL int64 `env:"SHARE_DEFAULT_TTL" default:"86400"`
+
+	// ShareMaxTTL is the maximum validity duration of share URLs in seconds.
+	// Default is 604800 (7 days).
+	ShareMaxTTL int64 `env:"SHARE_MAX_TTL" default:"604800"`
+
+	// SignedURLTTL is the minimum validity duration in seconds of the signed URLs of srcset, variants
+	// and gallery responses. They expire at the end of the period of this length following the current
+	// one, so they stay the same within a period and can be cached.
+	// Default is 3600 (1 hour).
+	SignedURLTTL int64 `env:"SIGNED_URL_TTL" default:"3600"`
+
 	// ContentDispositionDownload controls whether files are served with download headers.
 	// Default is false.
 	ContentDispositionDownload bool `env:"CONTENT_DISPOSITION_DOWNLOAD" default:"false"`
 
+	// DownloadCacheControl is the Cache-Control header of media downloads, letting clients
+	// reuse downloads and revalidate them by their ETag or Last-Modified header.
+	// Default is "private, max-age=86400". Empty sets no header.
+	DownloadCacheControl string `env:"DOWNLOAD_CACHE_CONTROL" default:"private, max-age=86400"`
+
 	// MultipartFormMaxMemory is the maximum allowed memory for multipart form uploads.
 	// Default is 10MB.
 	MultipartFormMaxMemory int64 `env:"MULTIPART_FORM_MAX_SIZE" default:"10485760"`
+
+	// URLWidthsParam is the URL parameter listing the widths of a srcset request.
+	// Default is "widths".
+	URLWidthsParam string `env:"URL_WIDTHS_PARAM" default:"widths"`
+
+	// URLFormatParam is the URL parameter selecting the srcset response format ("json" or "html"),
+	// or the output format of downloads (e.g. "png"). Default is "format".
+	URLFormatParam string `env:"URL_FORMAT_PARAM" default:"format"`
+
+	// SrcsetMaxWidths is the maximum number of widths accepted in a single srcset request.
+	// Default is 10.
+	SrcsetMaxWidths int `env:"SRCSET_MAX_WIDTHS" default:"10"`
+
+	// SrcsetPrewarm controls whether srcset and variants requests queue the generation of their
+	// derivatives along with the thumbnails (see ImageConfig.ThumbnailQueueSize). Default is true.
+	SrcsetPrewarm bool `env:"SRCSET_PREWARM" default:"true"`
+
+	// VariantWidths is the comma-separated list of widths listed by /media/{id}/variants.
+	// Default is "320,640,1024,1920".
+	VariantWidths string `env:"VARIANT_WIDTHS" default:"320,640,1024,1920"`
+
+	// MaxConcurrentUploads is the maximum number of concurrent upload requests per user.
+	// Default is 2, 0 disables the limit.
+	MaxConcurrentUploads int `env:"MAX_CONCURRENT_UPLOADS" default:"2"`
+
+	// MaxConcurrentResizes is the maximum number of concurrent resizing downloads per user,
+	// or per client IP address of anonymous downloads.
+	// Default is 4, 0 disables the limit.
+	MaxConcurrentResizes int `env:"MAX_CONCURRENT_RESIZES" default:"4"`
+
+	// URLValidateParam is the URL parameter enabling validate-only uploads.
+	// Default is "validate".
+	URLValidateParam string `env:"URL_VALIDATE_PARAM" default:"validate"`
+
+	// DownloadRateLimit is the download bandwidth per user in bytes per second.
+	// Default is 0 (unlimited).
+	DownloadRateLimit int64 `env:"DOWNLOAD_RATE_LIMIT" default:"0"`
+
+	// DownloadRateBurst is the number of bytes a user may download at full speed
+	// before being throttled. Default is 1MB.
+	DownloadRateBurst int64 `env:"DOWNLOAD_RATE_BURST" default:"1048576"`
+
+	// URLHashParam is the URL parameter carrying the content hash of existence checks.
+	// Default is "hash".
+	URLHashParam string `env:"URL_HASH_PARAM" default:"hash"`
+
+	// URLSinceParam is the URL parameter carrying the cursor of manifest deltas.
+	// Default is "since".
+	URLSinceParam string `env:"URL_SINCE_PARAM" default:"since"`
+
+	// URLCursorParam is the URL parameter carrying the cursor of the next page of the media listing.
+	// Default is "cursor".
+	URLCursorParam string `env:"URL_CURSOR_PARAM" default:"cursor"`
+
+	// URLLimitParam is the URL parameter carrying the number of media per page of the media listing.
+	// Default is "limit".
+	URLLimitParam string `env:"URL_LIMIT_PARAM" default:"limit"`
+
+	// ListDefaultLimit is the number of media per page of the media listing without a limit.
+	// Default is 100.
+	ListDefaultLimit int `env:"LIST_DEFAULT_LIMIT" default:"100"`
+
+	// ListMaxLimit is the maximum number of media per page of the media listing.
+	// Larger limits are lowered to it. Default is 1000.
+	ListMaxLimit int `env:"LIST_MAX_LIMIT" default:"1000"`
+
+	// URLGroupParam is the URL parameter selecting the grouping of the timeline ("day" or "month").
+	// Default is "group".
+	URLGroupParam string `env:"URL_GROUP_PARAM" default:"group"`
+
+	// TimelineCoverWidth is the width of the cover thumbnails of timeline periods and map clusters.
+	// Default is 320.
+	TimelineCoverWidth int `env:"TIMELINE_COVER_WIDTH" default:"320"`
+
+	// URLZoomParam is the URL parameter selecting the map zoom level media are clustered for.
+	// Default is "zoom".
+	URLZoomParam string `env:"URL_ZOOM_PARAM" default:"zoom"`
+
+	// GalleryEnabled controls whether the HTML gallery is served at /gallery.
+	// Default is false.
+	GalleryEnabled bool `env:"GALLERY_ENABLED" default:"false"`
+
+	// GalleryThumbnailWidth is the width of the thumbnails shown in the gallery.
+	// Default is 320.
+	GalleryThumbnailWidth int `env:"GALLERY_THUMBNAIL_WIDTH" default:"320"`
+
+	// BulkDeleteTokenTTL is the validity duration of bulk deletion confirmation tokens in seconds.
+	// Default is 300 (5 minutes).
+	BulkDeleteTokenTTL int64 `env:"BULK_DELETE_TOKEN_TTL" default:"300"`
+
+	// BulkDeleteSecret is the HMAC secret used to sign bulk deletion confirmation tokens.
+	// If empty, the key is derived from TransformSecret. If both are empty, a random key is
+	// generated, so tokens do not survive a restart and are only accepted by the issuing instance.
+	BulkDeleteSecret string `env:"BULK_DELETE_SECRET" default:""`
+
+	// BulkDeleteMaxIDs is the maximum number of media in a single bulk deletion.
+	// Default is 1000, 0 disables the limit.
+	BulkDeleteMaxIDs int `env:"BULK_DELETE_MAX_IDS" default:"1000"`
+
+	// AdminUsers is the comma-separated list of usernames having the admin role
+	// in addition to the roles of their tokens.
+	AdminUsers string `env:"ADMIN_USERS" default:""`
+
+	// ImpersonationEnabled allows admins to act as another user by sending its username
+	// in the X-Impersonate-User header. Impersonated requests are written to the audit log.
+	ImpersonationEnabled bool `env:"IMPERSONATION_ENABLED" default:"false"`
+
+	// Audience is the name of the service in the audience of tokens. Tokens intended for other
+	// services only are rejected. Default is empty, which accepts tokens of any audience.
+	Audience string `env:"AUDIENCE" default:""`
+
+	// RequiredScopes is the comma-separated list of scopes tokens need for any non-public route.
+	// Default is empty, which requires no scopes.
+	RequiredScopes string `env:"REQUIRED_SCOPES" default:""`
+
+	// UploadStagingDir is the directory uploaded files exceeding MultipartFormMaxMemory are
+	// written to while the upload is processed. Default is empty, which uses the OS temp directory.
+	UploadStagingDir string `env:"UPLOAD_STAGING_DIR" default:""`
+
+	// UploadStagingMaxAge is the age in seconds after which staged files left behind,
+	// e.g. by a crash, are removed. Default is 3600 (1 hour).
+	UploadStagingMaxAge int64 `env:"UPLOAD_STAGING_MAX_AGE" default:"3600"`
+
+	// UploadStagingCleanupInterval is the interval in seconds between removals of stale staged files.
+	// Default is 600 (10 minutes), 0 disables the cleanup.
+	UploadStagingCleanupInterval int64 `env:"UPLOAD_STAGING_CLEANUP_INTERVAL" default:"600"`
+
+	// UploadMinFreeSpace is the free space in bytes the staging directory must keep after
+	// accepting an upload. Default is 104857600 (100MB), 0 disables the check.
+	UploadMinFreeSpace int64 `env:"UPLOAD_MIN_FREE_SPACE" default:"104857600"`
 }
 
-var ErrNoMultipartFiles = errors.New("no multipart files")
+var (
+	ErrNoMultipartFiles = domain.NewError("upload.no_files", "no multipart files", http.StatusBadRequest, false)
+
+	// ErrConcurrencyLimit is returned when a user exceeds the number of concurrent operations.
+	ErrConcurrencyLimit = domain.NewError(
+		"request.concurrency_limit", "concurrency limit exceeded", http.StatusTooManyRequests, true)
+)
+
+// FlagStreamingUploads toggles streaming of uploaded images into storage.
+// Without it, uploads are read into memory before they are stored.
+//
+//nolint:gochecknoglobals
+var FlagStreamingUploads = featureflags.Flag{Name: "streaming_uploads", Default: true}
 
 // HTTPTransport handles HTTP requests for the image service.
 // It provides endpoints for uploading, downloading and deleting images.
 type HTTPTransport struct {
-	imageSvc   ImageService
-	authClient authclient.AuthClient
-	log        logging.Logger
-	cfg        HTTPTransportConfig
+	imageSvc      ImageService
+	authClient    authclient.AuthClient
+	uploadLimiter *semaphore.KeyedSemaphore
+	resizeLimiter *semaphore.KeyedSemaphore
+	downloadRates *tokenbucket.Keyed
+	bulkDeleteKey []byte
+	reprocess     *reprocessJob
+	degraded      func() []string
+	flags         *featureflags.Store
+	cache         *http_.ResponseCache
+	status        StatusSources
+	clock         clock.Clock
+	log           logging.Logger
+	cfg           HTTPTransportConfig
 }
 
 var _ http_.HTTPTransport = (*HTTPTransport)(nil)
@@ -72,40 +280,260 @@ func NewHTTPTransport(
 	authClient authclient.AuthClient,
 	cfg HTTPTransportConfig,
 ) *HTTPTransport {
-	return &HTTPTransport{
-		imageSvc:   imageSvc,
-		authClient: authClient,
-		log:        logging.GetLogger("svc.imagesvc.http_transport"),
-		cfg:        cfg,
+	ht := &HTTPTransport{
+		imageSvc:      imageSvc,
+		authClient:    authClient,
+		uploadLimiter: semaphore.NewKeyedSemaphore(cfg.MaxConcurrentUploads),
+		resizeLimiter: semaphore.NewKeyedSemaphore(cfg.MaxConcurrentResizes),
+		downloadRates: tokenbucket.NewKeyed(
+			float64(cfg.DownloadRateLimit), float64(max(cfg.DownloadRateBurst, 1)), downloadRateIdleTimeout),
+		bulkDeleteKey: nil,
+		reprocess:     &reprocessJob{m: sync.Mutex{}, status: nil, cancel: nil, stopped: nil},
+		degraded:      nil,
+		flags:         nil,
+		cache:         nil,
+		status:        StatusSources{StorageDir: "", Health: nil, Config: nil},
+		clock:         clock.Real{},
+		log:           logging.GetLogger("svc.imagesvc.http_transport"),
+		cfg:           cfg,
+	}
+
+	// Without a key, bulk deletions are rejected rather than failing the service
+	key, err := bulkDeleteKey(cfg)
+	if err != nil {
+		ht.log.ErrorContext(context.Background(), "bulk deletions disabled", "error", err)
 	}
+
+	ht.bulkDeleteKey = key
+
+	return ht
 }
 
 // ServeHTTP implements http.Handler and sets up routes for the image service endpoints:
+// - GET /media: Paginated listing of the user's media
 // - POST /media: Upload image
+// - POST /media/data: Upload image from base64 or data URL JSON body
+// - POST /media/uploads: Create a resumable upload session
+// - HEAD, PATCH, DELETE /media/uploads/{upload-id}: Get the offset of, append a chunk to or cancel an upload session
+// - POST /media/uploads/{upload-id}/complete: Store the image of a complete upload session
 // - DELETE /media/{image-id}: Delete image by ID
+// - DELETE /admin/media/{image-id}: Delete image of any user by ID, restricted to admins
+// - POST, GET, DELETE /admin/reprocess: Start, poll or cancel reprocessing of stored images, restricted to admins
+// - GET /admin/status: Snapshot of the state of the service for dashboards, restricted to admins
 // - GET /media/{image-id}: Download image by ID
-// Routes are protected by authentication middleware.
+// - HEAD /media/{image-id}: Headers of an image download, without reading the original
+// - GET /media/transforms: Describe the transform spec language
+// - GET /media/usage: Download usage of the current period
+// - GET, HEAD /media/exists: Check whether content is already stored for the user
+// - GET /media/manifest: Listing of the user's media for sync clients
+// - GET /media/timeline: The user's media grouped by the day or month they were taken
+// - GET /media/constraints: Limits uploaded images must meet
+// - GET /media/geo: The user's geotagged media clustered by location, as GeoJSON
+// - POST /media/bulk-delete/prepare: Summarize a bulk deletion and issue a confirmation token
+// - POST /media/bulk-delete: Execute a confirmed bulk deletion
+// - GET /media/{image-id}/srcset: List resized derivatives of an image
+// - GET /media/{image-id}/variants: List the dimensions and URLs of the configured derivatives of an image
+// - POST /media/{image-id}/share: Create a time-limited signed download URL, if signing is enabled
+// - GET /media/{image-id}/meta: Metadata of an image, without its content
+// - PUT /media/{image-id}/visibility: Set the visibility of an image (private, unlisted or public)
+// - PUT, DELETE /media/{image-id}/access/{username}: Share an image with a user or revoke the share
+// - GET /media/{image-id}/exif: EXIF metadata extracted from an image on upload
+// - GET /gallery, /gallery/{album}: HTML gallery of the user's images, if enabled
+// - GET /health: Health check
+// - GET /metrics: Prometheus metrics
+// Routes are protected by authentication middleware according to AuthPolicies.
+// The routes listed by CacheableRoutes are cached per user if a ResponseCache is set and
+// configures their routes.
 func (ht *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", ht.HandleHealth)
+	mux.Handle("GET /metrics", metrics.Handler(metrics.Default()))
+	mux.HandleFunc("GET /media", ht.HandleList)
 	mux.HandleFunc("POST /media", ht.HandleUpload)
+	mux.HandleFunc("POST /media/data", ht.HandleDataUpload)
+	mux.HandleFunc("POST /media/uploads", ht.HandleUploadCreate)
+	mux.HandleFunc(fmt.Sprintf("PATCH /media/uploads/{%s}", URLUploadIDParam), ht.HandleUploadAppend)
+	mux.HandleFunc(fmt.Sprintf("DELETE /media/uploads/{%s}", URLUploadIDParam), ht.HandleUploadCancel)
+	mux.HandleFunc(fmt.Sprintf("POST /media/uploads/{%s}/complete", URLUploadIDParam), ht.HandleUploadComplete)
 	mux.HandleFunc(fmt.Sprintf("DELETE /media/{%s}", ht.cfg.URLFileIDParam), ht.HandleDelete)
+	mux.Handle(fmt.Sprintf("DELETE /admin/media/{%s}", ht.cfg.URLFileIDParam),
+		http_.RequireRole(http.HandlerFunc(ht.HandleAdminDelete), ht.log, domain.RoleAdmin))
+	mux.Handle("POST /admin/reprocess",
+		http_.RequireRole(http.HandlerFunc(ht.HandleReprocessStart), ht.log, domain.RoleAdmin))
+	mux.Handle("GET /admin/reprocess",
+		http_.RequireRole(http.HandlerFunc(ht.HandleReprocessStatus), ht.log, domain.RoleAdmin))
+	mux.Handle("DELETE /admin/reprocess",
+		http_.RequireRole(http.HandlerFunc(ht.HandleReprocessCancel), ht.log, domain.RoleAdmin))
+	mux.Handle("GET /admin/status",
+		http_.RequireRole(http.HandlerFunc(ht.HandleAdminStatus), ht.log, domain.RoleAdmin))
 	mux.HandleFunc(fmt.Sprintf("GET /media/{%s}", ht.cfg.URLFileIDParam), ht.HandleDownload)
+	mux.HandleFunc("GET /media/transforms", ht.HandleTransformDocs)
+	mux.HandleFunc("GET /media/usage", ht.HandleUsage)
+	mux.HandleFunc("GET /media/exists", ht.HandleExists)
+	mux.HandleFunc("GET /media/manifest", ht.HandleManifest)
+	mux.Handle("GET /media/timeline", ht.cache.Handle("GET /media/timeline", http.HandlerFunc(ht.HandleTimeline)))
+	mux.Handle("GET /media/constraints",
+		ht.cache.Handle("GET /media/constraints", http.HandlerFunc(ht.HandleConstraints)))
+	mux.HandleFunc("GET /media/geo", ht.HandleGeo)
+	mux.HandleFunc("POST /media/bulk-delete/prepare", ht.HandleBulkDeletePrepare)
+	mux.HandleFunc("POST /media/bulk-delete", ht.HandleBulkDelete)
+	mux.HandleFunc(fmt.Sprintf("GET /media/{%s}/srcset", ht.cfg.URLFileIDParam), ht.HandleSrcset)
+	mux.HandleFunc(fmt.Sprintf("GET /media/{%s}/variants", ht.cfg.URLFileIDParam), ht.HandleVariants)
+	mux.HandleFunc(fmt.Sprintf("GET /media/{%s}/meta", ht.cfg.URLFileIDParam), ht.HandleMeta)
+	mux.HandleFunc(fmt.Sprintf("PUT /media/{%s}/visibility", ht.cfg.URLFileIDParam), ht.HandleVisibility)
+	mux.HandleFunc(fmt.Sprintf("PUT /media/{%s}/access/{%s}", ht.cfg.URLFileIDParam, URLShareUserParam),
+		ht.HandleShareUser)
+	mux.HandleFunc(fmt.Sprintf("DELETE /media/{%s}/access/{%s}", ht.cfg.URLFileIDParam, URLShareUserParam),
+		ht.HandleUnshareUser)
+	mux.HandleFunc(fmt.Sprintf("GET /media/{%s}/exif", ht.cfg.URLFileIDParam), ht.HandleExif)
+
+	if ht.cfg.TransformSecret != "" {
+		mux.HandleFunc(fmt.Sprintf("POST /media/{%s}/share", ht.cfg.URLFileIDParam), ht.HandleShare)
+	}
+
+	if ht.cfg.GalleryEnabled {
+		mux.Handle("GET /gallery", ht.cache.Handle("GET /gallery", http.HandlerFunc(ht.HandleGallery)))
+		mux.Handle("GET /gallery/{album}", ht.cache.Handle("GET /gallery/{album}", http.HandlerFunc(ht.HandleGallery)))
+	}
+
+	// The upload status route is matched first, as its pattern conflicts with the GET routes below
+	// /media/{image-id}, which match HEAD requests too
+	uploadStatus := http.NewServeMux()
+	uploadStatus.HandleFunc(fmt.Sprintf("HEAD /media/uploads/{%s}", URLUploadIDParam), ht.HandleUploadStatus)
+
+	routes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := uploadStatus.Handler(r); pattern != "" {
+			uploadStatus.ServeHTTP(w, r)
+		} else {
+			mux.ServeHTTP(w, r)
+		}
+	})
 
-	handler := http.Handler(mux)
-	handler = http_.AuthorizingMiddleware(handler, ht.authClient, ht.log)
+	handler := http_.RecordRoute(routes)
+	handler = http_.PolicyAuthorizingMiddleware(handler, ht.authClient, ht.authorizationConfig(), ht.log)
+	handler = withShareToken(handler)
 
 	handler.ServeHTTP(w, r)
 }
 
+// AuthPolicies returns the authentication policies of the image service routes.
+// Routes not listed require an authenticated user.
+// Downloads are public and authorized by handleDownload and handleHead instead, as they may
+// be authorized by a signature or be of public images.
+func (ht *HTTPTransport) AuthPolicies() http_.RoutePolicies {
+	return http_.RoutePolicies{
+		http_.PublicRoute("GET /health"),
+		http_.PublicRoute("GET /metrics"),
+		http_.PublicRoute("GET /media/transforms"),
+		http_.PublicRoute(fmt.Sprintf("GET /media/{%s}", ht.cfg.URLFileIDParam)),
+		http_.AuthenticatedRoute("GET /media/usage"),
+		http_.AuthenticatedRoute("GET /media/exists"),
+		http_.AuthenticatedRoute("GET /media/manifest"),
+		http_.AuthenticatedRoute("GET /media/timeline"),
+		http_.AuthenticatedRoute("GET /media/geo"),
+		http_.AuthenticatedRoute("POST /media/bulk-delete/prepare"),
+		http_.AuthenticatedRoute("POST /media/bulk-delete"),
+	}
+}
+
+// CacheableRoutes returns the patterns of the routes a ResponseCache may cache. They are
+// listed per user and invalidated whenever the user's images change.
+func (ht *HTTPTransport) CacheableRoutes() []string {
+	routes := []string{"GET /media/timeline", "GET /media/constraints"}
+
+	if ht.cfg.GalleryEnabled {
+		routes = append(routes, "GET /gallery", "GET /gallery/{album}")
+	}
+
+	return routes
+}
+
+// authorizationConfig returns the configuration of the authorizing middleware.
+func (ht *HTTPTransport) authorizationConfig() http_.AuthorizationConfig {
+	roles := make(map[string][]string)
+
+	for _, username := range strings.Split(ht.cfg.AdminUsers, ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			roles[username] = []string{http_.RoleAdmin}
+		}
+	}
+
+	var scopes []string
+
+	for _, scope := range strings.Split(ht.cfg.RequiredScopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return http_.AuthorizationConfig{
+		Policies:      ht.AuthPolicies(),
+		Roles:         roles,
+		Impersonation: ht.cfg.ImpersonationEnabled,
+		Audit:         nil,
+		Audience:      ht.cfg.Audience,
+		Scopes:        scopes,
+	}
+}
+
+// SetDegradedFunc sets the function reporting the names of unavailable dependencies
+// for the health check.
+func (ht *HTTPTransport) SetDegradedFunc(degraded func() []string) {
+	ht.degraded = degraded
+}
+
+// SetFeatureFlags sets the feature flags toggling behaviors per route and tenant.
+// Without feature flags, all flags evaluate to their default.
+func (ht *HTTPTransport) SetFeatureFlags(flags *featureflags.Store) {
+	ht.flags = flags
+}
+
+// SetClock sets the time source of the expiries of signed URLs and bulk delete tokens.
+// Without a clock, the system time is used.
+func (ht *HTTPTransport) SetClock(c clock.Clock) {
+	ht.clock = c
+}
+
+// SetResponseCache sets the cache of the routes listed by CacheableRoutes. The image service is
+// decorated to invalidate the cached responses of a user whenever their images are stored,
+// deleted, shared or change visibility.
+func (ht *HTTPTransport) SetResponseCache(cache *http_.ResponseCache) {
+	ht.cache = cache
+	ht.imageSvc = newCacheInvalidatingImageService(ht.imageSvc, cache)
+}
+
+// HandleHealth reports that the service is up and able to serve requests.
+// If dependencies are unavailable, it reports them as "degraded: <names>".
+func (ht *HTTPTransport) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if ht.degraded != nil {
+		if names := ht.degraded(); len(names) > 0 {
+			_, _ = w.Write([]byte("degraded: " + strings.Join(names, ",")))
+
+			return
+		}
+	}
+
+	_, _ = w.Write([]byte("ok"))
+}
+
 // HandleUpload processes image upload requests.
 // Expects a multipart form with a file field matching MultipartFileName config.
+// If the URLValidateParam is set, the files are only validated and not stored.
 func (ht *HTTPTransport) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	if ht.isValidateOnly(r) {
+		_ = ht.handleValidateUpload(w, r)
+
+		return
+	}
+
 	_ = ht.handleUpload(w, r)
 }
 
 //nolint:funlen
 func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (err error) {
-	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.String()))
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
 
 	ctx, cancel := context.WithCancel(r.Context()) // Create cancellable context
 	defer cancel()
@@ -118,13 +546,22 @@ func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (e
 		}
 	}()
 
+	release, ok := ht.acquireUserSlot(ctx, r, ht.uploadLimiter)
+	if !ok {
+		w.Header().Set("Retry-After", "1")
+		http_.WriteError(w, r, http.StatusTooManyRequests)
+
+		return fmt.Errorf("upload: %w", ErrConcurrencyLimit)
+	}
+	defer release()
+
 	mediaCh, errCh := ht.processMultipartForm(ctx, r)
 
 	var (
 		mediaResp    []domain.MediaIDResponse
 		errGroup     sync.WaitGroup
 		errMutex     sync.Mutex
-		uploadErrors []error
+		uploadErrors domain.BatchError
 	)
 
 	// Goroutine to listen for errors and cancel on first error
@@ -137,7 +574,10 @@ func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (e
 			log.ErrorContext(ctx, "media upload error", "error", err)
 
 			errMutex.Lock()
-			uploadErrors = append(uploadErrors, err)
+			// Cancellations caused by an earlier error are not failures of their own
+			if !errors.Is(err, context.Canceled) || uploadErrors.Len() == 0 {
+				uploadErrors.Add(uploadErrorKey(err), err)
+			}
 			errMutex.Unlock()
 
 			cancel() // Stop media processing
@@ -150,17 +590,17 @@ func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (e
 	go func() {
 		defer errGroup.Done()
 
-		for media := range mediaCh {
+		for meta := range mediaCh {
 			log.DebugContext(ctx, "media uploaded", logging.Group("media",
-				"id", media.ID().String(),
-				"filename", media.Meta().Filename,
-				"size", media.Size(),
-				"owner", media.Owner(),
+				"id", meta.ID.String(),
+				"filename", meta.Filename,
+				"size", meta.Size,
+				"owner", meta.Owner,
 			))
 
 			mediaResp = append(mediaResp, domain.MediaIDResponse{
-				ID:       media.ID().String(),
-				Filename: media.Meta().Filename,
+				ID:       meta.ID.String(),
+				Filename: meta.Filename,
 			})
 		}
 	}()
@@ -168,11 +608,16 @@ func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (e
 	// Wait for both goroutines to finish
 	errGroup.Wait()
 
-	// If errors occurred, return HTTP 400
-	if len(uploadErrors) > 0 {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// If errors occurred, return HTTP 500 on panics, otherwise the status of the first
+	// client-facing error or HTTP 400, listing the failed files
+	if err := uploadErrors.ErrOrNil(); err != nil {
+		status := domain.ErrorStatus(err, http.StatusBadRequest)
+		if errors.Is(err, ErrPanic) {
+			status = http.StatusInternalServerError
+		}
+		http_.WriteBatchError(w, r, status, &uploadErrors)
 
-		return fmt.Errorf("process multipart form: %w", errors.Join(uploadErrors...))
+		return fmt.Errorf("process multipart form: %w", err)
 	}
 
 	// Send response with media IDs
@@ -180,7 +625,7 @@ func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (e
 		return mediaResp[i].ID < mediaResp[j].ID
 	})
 
-	if err := json.NewEncoder(w).Encode(mediaResp); err != nil {
+	if err := http_.WriteJSON(w, r, http.StatusOK, mediaResp); err != nil {
 		return fmt.Errorf("encode response: %w", err)
 	}
 
@@ -190,8 +635,9 @@ func (ht *HTTPTransport) handleUpload(w http.ResponseWriter, r *http.Request) (e
 func (ht *HTTPTransport) processMultipartForm(
 	ctx context.Context,
 	r *http.Request,
-) (<-chan domain.Media, <-chan error) {
-	if err := r.ParseMultipartForm(ht.cfg.MultipartFormMaxMemory); err != nil {
+) (<-chan domain.MediaMeta, <-chan error) {
+	form, err := ht.stageMultipartForm(r)
+	if err != nil {
 		errCh := make(chan error, 1)
 		errCh <- fmt.Errorf("parse multipart form: %w", err)
 		close(errCh)
@@ -199,7 +645,7 @@ func (ht *HTTPTransport) processMultipartForm(
 		return nil, errCh
 	}
 
-	if r.MultipartForm == nil || r.MultipartForm.File == nil {
+	if len(form.Files) == 0 {
 		errCh := make(chan error, 1)
 		errCh <- ErrNoMultipartFiles
 		close(errCh)
@@ -207,15 +653,18 @@ func (ht *HTTPTransport) processMultipartForm(
 		return nil, errCh
 	}
 
-	return ht.processMultipartFormFiles(ctx, r.MultipartForm.File)
+	return ht.processMultipartFormFiles(ctx, form, ht.flags.EnabledForRequest(r, FlagStreamingUploads))
 }
 
+// processMultipartFormFiles stores the files of form concurrently, removing
+// the staged files once all are processed. Unless stream is set, each file is read into memory.
 func (ht *HTTPTransport) processMultipartFormFiles(
 	ctx context.Context,
-	fileHeaders map[string][]*multipart.FileHeader,
-) (<-chan domain.Media, <-chan error) {
-	mediaCh := make(chan domain.Media)
-	errCh := make(chan error, len(fileHeaders)) // Buffered to avoid blocking
+	form *stagedForm,
+	stream bool,
+) (<-chan domain.MediaMeta, <-chan error) {
+	mediaCh := make(chan domain.MediaMeta)
+	errCh := make(chan error, len(form.Files)+1) // Buffered to avoid blocking
 
 	var (
 		wg   sync.WaitGroup
@@ -228,40 +677,47 @@ func (ht *HTTPTransport) processMultipartFormFiles(
 		defer close(errCh)
 
 		defer func() {
-			if r := recover(); r != nil {
-				errCh <- fmt.Errorf("%w: %v", ErrPanic, r)
+			if err := form.RemoveAll(); err != nil {
+				ht.log.WarnContext(ctx, "staged files not removed", "error", err)
 			}
 		}()
 
-		for _, f := range fileHeaders {
-			for _, fileHeader := range f {
-				// Check if context is already cancelled before processing
-				select {
-				case <-ctx.Done():
-					once.Do(func() { errCh <- ctx.Err() })
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- panics.Recover(ctx, ht.log, "upload", r)
+			}
+		}()
 
-					return // Stop processing immediately
-				default:
-				}
+		defer wg.Wait() // Staged files are removed only once all files are processed
 
-				wg.Add(1)
+		for _, file := range form.Files {
+			// Check if context is already cancelled before processing
+			select {
+			case <-ctx.Done():
+				once.Do(func() { errCh <- ctx.Err() })
 
-				go processFile(ctx, ht.imageSvc, fileHeader, mediaCh, errCh, &wg)
+				return // Stop processing immediately
+			default:
 			}
-		}
 
-		wg.Wait() // Wait for all file processing to complete
+			wg.Add(1)
+
+			go processFile(ctx, ht.imageSvc, ht.log, file, stream, mediaCh, errCh, &wg)
+		}
 	}()
 
 	return mediaCh, errCh
 }
 
-//nolint:funlen
+// processFile stores a staged file, streaming it from the staging directory if stream is set
+// (see storeUploaded).
 func processFile(
 	ctx context.Context,
 	imageSvc ImageService,
-	fileHeader *multipart.FileHeader,
-	mediaCh chan<- domain.Media,
+	log logging.Logger,
+	fileHeader *stagedFile,
+	stream bool,
+	mediaCh chan<- domain.MediaMeta,
 	errCh chan<- error,
 	wg *sync.WaitGroup,
 ) {
@@ -269,7 +725,10 @@ func processFile(
 
 	defer func() {
 		if r := recover(); r != nil {
-			errCh <- fmt.Errorf("%w: %v", ErrPanic, r)
+			errCh <- &uploadFileError{
+				filename: fileHeader.Filename,
+				err:      panics.Recover(ctx, log, "upload", r, "filename", fileHeader.Filename),
+			}
 		}
 	}()
 
@@ -277,60 +736,106 @@ func processFile(
 		return
 	}
 
-	// Check upload constraints before reading the image to buffer
+	// Check upload constraints before opening the file
 	_, _, err := imageSvc.CheckUploadConstraints(
 		fileHeader.Filename,
 		fileHeader.Size,
 		nil,
 	)
 	if err != nil {
-		errCh <- fmt.Errorf("upload not allowed: %s: %w", fileHeader.Filename, err)
+		errCh <- &uploadFileError{fileHeader.Filename, fmt.Errorf("upload not allowed: %w", err)}
+
+		return
 	}
 
-	// Read file content
 	file, err := fileHeader.Open()
 	if err != nil {
-		errCh <- fmt.Errorf("open %s: %w", fileHeader.Filename, err)
+		errCh <- &uploadFileError{fileHeader.Filename, fmt.Errorf("open: %w", err)}
 
 		return
 	}
 	defer file.Close()
 
-	buffer, err := io.ReadAll(file)
+	// Store file via image service, which checks the content against the upload constraints
+	owner, _ := context_.UsernameFromContext(ctx)
+	meta := domain.MediaMeta{ //nolint:exhaustruct
+		Filename: fileHeader.Filename,
+		Owner:    owner,
+	}
+
+	meta, err = storeUploaded(ctx, imageSvc, meta.WithContent(fileHeader.Hash, fileHeader.Size), file, stream)
 	if err != nil {
-		errCh <- fmt.Errorf("read %s: %w", fileHeader.Filename, err)
+		errCh <- &uploadFileError{fileHeader.Filename, fmt.Errorf("store: %w", err)}
 
 		return
 	}
 
-	// Re-Check upload constraints now that the image has been read
-	mimeType, _, err := imageSvc.CheckUploadConstraints(
-		fileHeader.Filename,
-		fileHeader.Size,
-		buffer,
-	)
-	if err != nil {
-		errCh <- fmt.Errorf("upload not allowed: %s: %w", fileHeader.Filename, err)
+	select {
+	case mediaCh <- meta:
+	case <-ctx.Done():
 	}
+}
 
-	// Store file via image service
-	owner, _ := context_.UsernameFromContext(ctx)
-	media := domain.NewMedia(buffer, domain.MediaMeta{ //nolint:exhaustruct
-		Filename: fileHeader.Filename,
-		Owner:    owner,
-		MIMEType: mimeType,
-	})
+// storeUploaded stores the uploaded content described by meta. If stream is set, the content
+// is streamed without reading it into memory where possible (see ImageService.StoreFrom),
+// otherwise it is read into memory and stored by ImageService.Store.
+func storeUploaded(
+	ctx context.Context,
+	imageSvc ImageService,
+	meta domain.MediaMeta,
+	content io.ReadSeeker,
+	stream bool,
+) (domain.MediaMeta, error) {
+	if stream {
+		return imageSvc.StoreFrom(ctx, meta, content) //nolint:wrapcheck
+	}
 
-	if err := imageSvc.Store(ctx, media); err != nil {
-		errCh <- fmt.Errorf("store %s: %w", fileHeader.Filename, err)
+	// One more byte than the size is read to tell whether the content is longer than described
+	data, err := io.ReadAll(io.LimitReader(content, meta.Size+1))
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("read: %w", err)
+	}
 
-		return
+	if int64(len(data)) != meta.Size {
+		return domain.MediaMeta{}, fmt.Errorf("%w: got %d bytes, want %d", domain.ErrContentMismatch, len(data), meta.Size)
 	}
 
-	select {
-	case mediaCh <- media:
-	case <-ctx.Done():
+	image, err := imageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{ //nolint:exhaustruct
+		Filename: meta.Filename,
+		Owner:    meta.Owner,
+	}))
+	if err != nil {
+		return domain.MediaMeta{}, err //nolint:wrapcheck
+	}
+
+	return image.Meta(), nil
+}
+
+// uploadFileError is an error of the upload pipeline concerning a single uploaded file.
+type uploadFileError struct {
+	filename string
+	err      error
+}
+
+// Error implements error.
+func (e *uploadFileError) Error() string {
+	return e.filename + ": " + e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *uploadFileError) Unwrap() error {
+	return e.err
+}
+
+// uploadErrorKey returns the key of an upload pipeline error in the batch error, which is the
+// filename of the concerned file, or empty if the error concerns the whole request.
+func uploadErrorKey(err error) string {
+	var fileErr *uploadFileError
+	if errors.As(err, &fileErr) {
+		return fileErr.filename
 	}
+
+	return ""
 }
 
 // HandleDelete processes image deletion requests.
@@ -340,7 +845,7 @@ func (ht *HTTPTransport) HandleDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ht *HTTPTransport) handleDelete(w http.ResponseWriter, r *http.Request) (err error) {
-	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.String()))
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
 
 	defer func(ctx context.Context) {
 		if err != nil {
@@ -352,7 +857,7 @@ func (ht *HTTPTransport) handleDelete(w http.ResponseWriter, r *http.Request) (e
 
 	mediaID := r.PathValue(ht.cfg.URLFileIDParam)
 	if mediaID == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		http_.WriteError(w, r, http.StatusBadRequest)
 
 		return domain.ErrNoMediaID
 	}
@@ -365,9 +870,9 @@ func (ht *HTTPTransport) handleDelete(w http.ResponseWriter, r *http.Request) (e
 		case errors.Is(err, domain.ErrUnauthorized):
 			fallthrough
 		case errors.Is(err, os.ErrNotExist):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			http_.WriteError(w, r, http.StatusNotFound)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			http_.WriteError(w, r, http.StatusInternalServerError)
 		}
 
 		return fmt.Errorf("delete: %w", err)
@@ -376,15 +881,33 @@ func (ht *HTTPTransport) handleDelete(w http.ResponseWriter, r *http.Request) (e
 	return nil
 }
 
+// HandleAdminDelete processes deletion requests of admins for images of any user.
+// Expects the image ID as a URL parameter matching URLFileIDParam config.
+// Must be served behind http_.RequireRole restricting it to domain.RoleAdmin.
+func (ht *HTTPTransport) HandleAdminDelete(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleDelete(w, r.WithContext(context_.WithAdminAccess(r.Context())))
+}
+
 // HandleDownload processes image download requests.
-// Expects the image ID as a URL parameter and an optional width parameter for resizing.
+// Expects the image ID as a URL parameter and either optional width and format parameters for
+// resizing and converting, or an optional transform spec parameter. Without a format, images are
+// converted to a format accepted by the request's Accept header if their own is not accepted.
+// Responds with 304 Not Modified if the request's If-None-Match header matches the content hash
+// of the image or, without If-None-Match, if the image was not stored after the request's
+// If-Modified-Since time.
+// HEAD requests, which the GET route matches as well, are served by HandleHead.
 func (ht *HTTPTransport) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		_ = ht.handleHead(w, r)
+
+		return
+	}
+
 	_ = ht.handleDownload(w, r)
 }
 
-//nolint:funlen,cyclop
 func (ht *HTTPTransport) handleDownload(w http.ResponseWriter, r *http.Request) (err error) {
-	log := ht.log.With(logging.Group("http", "method", r.Method, "url", r.URL.String()))
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
 
 	defer func(ctx context.Context) {
 		if err != nil {
@@ -394,55 +917,190 @@ func (ht *HTTPTransport) handleDownload(w http.ResponseWriter, r *http.Request)
 		}
 	}(r.Context())
 
-	fileID := r.PathValue(ht.cfg.URLFileIDParam)
-	if fileID == "" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-
-		return domain.ErrNoMediaID
+	ctx, fileID, spec, err := ht.parseDownload(w, r)
+	if err != nil {
+		return err
 	}
 
-	fileID = encoding.NormalizeCrockfordB32LC(fileID)
 	log = log.With(logging.Group("media", "id", fileID))
 
-	var width int
+	// Capped users are rejected before their downloads cost any resizing
+	account, err := ht.downloadAccount(ctx, fileID)
+	if err != nil {
+		http_.WriteError(w, r, downloadErrorStatus(ctx, r, fileID, err))
 
-	if widthStr := r.URL.Query().Get(ht.cfg.URLWidthParam); widthStr != "" {
-		width_, err := strconv.ParseInt(widthStr, 10, 64)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return fmt.Errorf("fetch meta: %w", err)
+	}
 
-			return fmt.Errorf("parse width: %w", err)
-		}
+	if err := ht.imageSvc.CheckDownloadCap(ctx, account); err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
 
-		width = int(width_)
+		return fmt.Errorf("check download cap: %w", err)
 	}
 
-	media, err := ht.imageSvc.Fetch(r.Context(), domain.MediaID(fileID), width)
-	if err != nil {
-		switch {
-		case errors.Is(err, domain.ErrUnauthorized):
-			fallthrough
-		case errors.Is(err, os.ErrNotExist):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if !spec.IsIdentity() {
+		release, ok := ht.acquireUserSlot(ctx, r, ht.resizeLimiter)
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http_.WriteError(w, r, http.StatusTooManyRequests)
+
+			return fmt.Errorf("resize: %w", ErrConcurrencyLimit)
 		}
+		defer release()
+	}
+
+	media, err := ht.imageSvc.Transform(ctx, fileID, spec)
+	if err != nil {
+		http_.WriteError(w, r, downloadErrorStatus(ctx, r, fileID, err))
 
 		return fmt.Errorf("fetch: %w", err)
 	}
 
-	if ht.cfg.ContentDispositionDownload {
-		w.Header().Set("Content-Disposition", "attachment; filename="+media.Meta().Filename)
+	if ht.notModifiedDownload(w, r, media.Meta()) {
+		return nil
 	}
 
 	w.Header().Set("Content-Type", media.MIMEType())
 	w.Header().Set("Content-Length", strconv.FormatInt(media.Size(), 10))
 
-	if _, err := media.WriteTo(w); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	written, err := media.WriteTo(ht.throttle(ctx, w, account))
+
+	if written > 0 {
+		if err := ht.imageSvc.RecordDownload(context.WithoutCancel(ctx), account, written); err != nil {
+			log.WarnContext(ctx, "download accounting failed", "error", err)
+		}
+	}
+
+	if err != nil {
+		http_.WriteError(w, r, http.StatusInternalServerError)
 
 		return fmt.Errorf("write to: %w", err)
 	}
 
 	return nil
 }
+
+// downloadAccount returns the user a download of the image is accounted to: the requesting
+// user, or the owner for anonymous downloads of signed URLs and public images.
+func (ht *HTTPTransport) downloadAccount(ctx context.Context, mediaID domain.MediaID) (string, error) {
+	if username, ok := context_.UsernameFromContext(ctx); ok && username != "" {
+		return username, nil
+	}
+
+	meta, err := ht.imageSvc.FetchMeta(ctx, mediaID)
+	if err != nil {
+		return "", fmt.Errorf("fetch meta: %w", err)
+	}
+
+	return meta.Owner, nil
+}
+
+// parseDownload parses and authorizes a download request of HandleDownload or HandleHead.
+// Returns the request context, extended by the grant of signed requests, the requested image ID
+// and transform spec. Writes an error response if the request is invalid or unauthorized.
+func (ht *HTTPTransport) parseDownload(
+	w http.ResponseWriter,
+	r *http.Request,
+) (context.Context, domain.MediaID, transform.Spec, error) {
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return nil, "", transform.Spec{}, domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+
+	spec, err := ht.parseTransformSpec(r)
+	if err != nil {
+		status := domain.ErrorStatus(err, http.StatusBadRequest)
+		http_.WriteError(w, r, status)
+
+		return nil, "", transform.Spec{}, fmt.Errorf("parse transform: %w", err)
+	}
+
+	ctx, err := ht.authorizeTransform(r, fileID, spec)
+	if err != nil {
+		status := domain.ErrorStatus(err, http.StatusForbidden)
+		http_.WriteError(w, r, status)
+
+		return nil, "", transform.Spec{}, fmt.Errorf("authorize transform: %w", err)
+	}
+
+	if spec.Format == "" {
+		w.Header().Add("Vary", "Accept")
+		spec.Format = ht.negotiateFormat(ctx, r, domain.MediaID(fileID))
+	}
+
+	return ctx, domain.MediaID(fileID), spec, nil
+}
+
+// notModifiedDownload sets the caching headers of a download of the given image and replies with
+// 304 Not Modified if the request's preconditions match, returning true.
+// Otherwise, it sets the Content-Disposition header, if enabled.
+func (ht *HTTPTransport) notModifiedDownload(w http.ResponseWriter, r *http.Request, meta domain.MediaMeta) bool {
+	if ht.cfg.DownloadCacheControl != "" {
+		w.Header().Set("Cache-Control", ht.cfg.DownloadCacheControl)
+	}
+
+	// Media are immutable, so derivatives are unmodified since the original was stored
+	if http_.NotModified(w, r, http_.ContentETag(meta.Hash)) ||
+		http_.NotModifiedSince(w, r, meta.ModifiedTime()) {
+		return true
+	}
+
+	if ht.cfg.ContentDispositionDownload {
+		w.Header().Set("Content-Disposition",
+			http_.ContentDisposition(http_.DispositionAttachment, meta.Filename))
+	}
+
+	return false
+}
+
+// withShareToken wraps a handler, adding the share token of the request's http_.ShareTokenParam
+// URL parameter to the request context, which grants access to unlisted images.
+func withShareToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get(http_.ShareTokenParam); token != "" {
+			r = r.WithContext(context_.WithShareToken(r.Context(), token))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// downloadErrorStatus returns the response status of a failed download.
+// Images the user may not access are reported as not found, so their existence is not disclosed.
+// Anonymous requests not authorized by a signature are asked to authenticate instead, unless
+// they presented credentials that were not accepted, e.g. a token lacking a required scope.
+func downloadErrorStatus(ctx context.Context, r *http.Request, mediaID domain.MediaID, err error) int {
+	if errors.Is(err, domain.ErrUnauthorized) || errors.Is(err, os.ErrNotExist) {
+		if username, _ := context_.UsernameFromContext(ctx); username == "" && !context_.HasGrant(ctx, string(mediaID)) {
+			if _, ok := authclient.CredentialsFromRequest(r); ok {
+				return http.StatusForbidden
+			}
+
+			return http.StatusUnauthorized
+		}
+
+		return http.StatusNotFound
+	}
+
+	return domain.ErrorStatus(err, http.StatusInternalServerError)
+}
+
+// acquireUserSlot acquires a slot of the given limiter for the user of the request context.
+// Anonymous requests acquire the slot of their client IP address, so they do not share one slot.
+// Returns a function to release the slot and whether the slot was acquired.
+func (ht *HTTPTransport) acquireUserSlot(
+	ctx context.Context,
+	r *http.Request,
+	limiter *semaphore.KeyedSemaphore,
+) (func(), bool) {
+	username, _ := context_.UsernameFromContext(ctx)
+	if username == "" {
+		return limiter.TryAcquire("client:" + http_.ClientIP(r))
+	}
+
+	return limiter.TryAcquire(username)
+}
@@ -0,0 +1,119 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// ErrInvalidVisibilityRequest is returned when the body of a visibility request is malformed.
+var ErrInvalidVisibilityRequest = domain.NewError(
+	"media.invalid_visibility_request", "invalid visibility request", http.StatusBadRequest, false)
+
+// accessBodyLimit is the maximum size of a visibility request body.
+const accessBodyLimit = 1 << 10
+
+// URLShareUserParam is the URL parameter of the share routes carrying the username
+// to share media with.
+const URLShareUserParam = "username"
+
+// HandleVisibility sets the visibility of an image of the authenticated user.
+// Expects the image ID as a URL parameter and a JSON body with the visibility ("private",
+// "unlisted" or "public"). Responds with the visibility and share list of the image, and the
+// share token granting access to it while unlisted.
+func (ht *HTTPTransport) HandleVisibility(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleAccess(w, r, "visibility", func(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error) {
+		var req domain.MediaVisibilityRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, accessBodyLimit)).Decode(&req); err != nil {
+			return domain.MediaMeta{}, fmt.Errorf("%w: decode request: %w", ErrInvalidVisibilityRequest, err)
+		}
+
+		return ht.imageSvc.SetVisibility(ctx, mediaID, req.Visibility) //nolint:wrapcheck
+	})
+}
+
+// HandleShareUser shares an image of the authenticated user with another user, granting them
+// access regardless of its visibility. Expects the image ID and the username as URL parameters.
+// Responds with the visibility and share list of the image.
+func (ht *HTTPTransport) HandleShareUser(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleAccess(w, r, "share", func(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error) {
+		return ht.imageSvc.Share(ctx, mediaID, r.PathValue(URLShareUserParam)) //nolint:wrapcheck
+	})
+}
+
+// HandleUnshareUser revokes the access to an image of the authenticated user granted by
+// HandleShareUser. Expects the image ID and the username as URL parameters.
+// Responds with the visibility and share list of the image.
+func (ht *HTTPTransport) HandleUnshareUser(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleAccess(w, r, "unshare", func(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error) {
+		return ht.imageSvc.Unshare(ctx, mediaID, r.PathValue(URLShareUserParam)) //nolint:wrapcheck
+	})
+}
+
+// handleAccess applies an access update to the image given as URL parameter and responds with
+// the resulting visibility and share list.
+func (ht *HTTPTransport) handleAccess(
+	w http.ResponseWriter,
+	r *http.Request,
+	op string,
+	update func(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error),
+) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media access update failed", "op", op, "error", err)
+		} else {
+			log.InfoContext(ctx, "media access updated", "op", op)
+		}
+	}(r.Context())
+
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+	log = log.With(logging.Group("media", "id", fileID))
+
+	meta, err := update(r.Context(), domain.MediaID(fileID))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnauthorized):
+			fallthrough
+		case errors.Is(err, os.ErrNotExist):
+			http_.WriteError(w, r, http.StatusNotFound)
+		default:
+			http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp := domain.MediaAccessResponse{
+		ID:         meta.ID.String(),
+		Visibility: meta.EffectiveVisibility(),
+		SharedWith: meta.SharedWith,
+		ShareToken: meta.ShareToken,
+	}
+
+	if resp.SharedWith == nil {
+		resp.SharedWith = []string{}
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
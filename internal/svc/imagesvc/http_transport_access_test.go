@@ -0,0 +1,246 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleAccess(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	mediaID := stored.ID().String()
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam: "media_id",
+		URLWidthParam:  "width",
+	})
+
+	// update changes the access to the image as alice
+	update := func(method, path, body string, handler http.HandlerFunc) (int, domain.MediaAccessResponse) {
+		req := httptest.NewRequest(method, "/media/"+mediaID+path, bytes.NewBufferString(body)).WithContext(ctx)
+		req.SetPathValue("media_id", mediaID)
+		req.SetPathValue(imagesvc.URLShareUserParam, "bob")
+
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		var resp domain.MediaAccessResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+		}
+
+		return rec.Code, resp
+	}
+
+	// download downloads the image as the given user, anonymously if empty, presenting the share token if any
+	download := func(username, shareToken, query string) int {
+		reqCtx := context.Background()
+		if username != "" {
+			reqCtx = context_.WithUsername(reqCtx, username)
+		}
+
+		if shareToken != "" {
+			reqCtx = context_.WithShareToken(reqCtx, shareToken)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/media/"+mediaID+query, nil).WithContext(reqCtx)
+		req.SetPathValue("media_id", mediaID)
+
+		rec := httptest.NewRecorder()
+		ht.HandleDownload(rec, req)
+
+		return rec.Code
+	}
+
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		handler        http.HandlerFunc
+		wantStatus     int
+		wantVisibility domain.MediaVisibility
+		wantShared     []string
+		downloads      map[string]int // status of downloads by username, "" for anonymous
+		shareDownloads map[string]int // status of downloads presenting the share token by username
+	}{
+		{
+			name: "private", method: http.MethodPut, path: "/visibility", body: `{"visibility": "private"}`,
+			handler: ht.HandleVisibility, wantStatus: http.StatusOK,
+			wantVisibility: domain.VisibilityPrivate, wantShared: []string{},
+			downloads: map[string]int{"alice": http.StatusOK, "bob": http.StatusNotFound, "": http.StatusUnauthorized},
+		},
+		{
+			name: "shared", method: http.MethodPut, path: "/access/bob", handler: ht.HandleShareUser,
+			wantStatus: http.StatusOK, wantVisibility: domain.VisibilityPrivate, wantShared: []string{"bob"},
+			downloads: map[string]int{"bob": http.StatusOK, "carol": http.StatusNotFound},
+		},
+		{
+			name: "unshared", method: http.MethodDelete, path: "/access/bob", handler: ht.HandleUnshareUser,
+			wantStatus: http.StatusOK, wantVisibility: domain.VisibilityPrivate, wantShared: []string{},
+			downloads: map[string]int{"bob": http.StatusNotFound},
+		},
+		{
+			name: "unlisted", method: http.MethodPut, path: "/visibility", body: `{"visibility": "unlisted"}`,
+			handler: ht.HandleVisibility, wantStatus: http.StatusOK,
+			wantVisibility: domain.VisibilityUnlisted, wantShared: []string{},
+			downloads:      map[string]int{"carol": http.StatusNotFound, "": http.StatusUnauthorized},
+			shareDownloads: map[string]int{"carol": http.StatusOK, "": http.StatusUnauthorized},
+		},
+		{
+			name: "public", method: http.MethodPut, path: "/visibility", body: `{"visibility": "public"}`,
+			handler: ht.HandleVisibility, wantStatus: http.StatusOK,
+			wantVisibility: domain.VisibilityPublic, wantShared: []string{},
+			downloads: map[string]int{"carol": http.StatusOK, "": http.StatusOK},
+		},
+		{
+			name: "invalid visibility", method: http.MethodPut, path: "/visibility", body: `{"visibility": "friends"}`,
+			handler: ht.HandleVisibility, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "malformed body", method: http.MethodPut, path: "/visibility", body: `{`,
+			handler: ht.HandleVisibility, wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	var shareToken string
+
+	// The steps change the access to the same image, so they run in order
+	for _, step := range steps {
+		status, resp := update(step.method, step.path, step.body, step.handler)
+		if status != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", step.name, status, step.wantStatus)
+		}
+
+		if status != http.StatusOK {
+			continue
+		}
+
+		if resp.Visibility != step.wantVisibility || !slices.Equal(resp.SharedWith, step.wantShared) {
+			t.Errorf("%s: response = %+v, want visibility %q shared with %v",
+				step.name, resp, step.wantVisibility, step.wantShared)
+		}
+
+		if (resp.ShareToken != "") != (step.wantVisibility == domain.VisibilityUnlisted) {
+			t.Errorf("%s: share token = %q, want one only while unlisted", step.name, resp.ShareToken)
+		}
+
+		if resp.ShareToken != "" {
+			shareToken = resp.ShareToken
+		}
+
+		for username, wantStatus := range step.downloads {
+			if got := download(username, "", ""); got != wantStatus {
+				t.Errorf("%s: download as %q: status = %d, want %d", step.name, username, got, wantStatus)
+			}
+		}
+
+		for username, wantStatus := range step.shareDownloads {
+			if got := download(username, shareToken, ""); got != wantStatus {
+				t.Errorf("%s: download as %q with share token: status = %d, want %d", step.name, username, got, wantStatus)
+			}
+		}
+	}
+
+	// The share token of unlisted images is revoked by other visibilities
+	if got := download("carol", shareToken, ""); got != http.StatusOK {
+		t.Errorf("public download with share token: status = %d, want %d", got, http.StatusOK)
+	}
+
+	if status, _ := update(http.MethodPut, "/visibility", `{"visibility": "private"}`, ht.HandleVisibility); status != http.StatusOK {
+		t.Fatalf("private: status = %d, want %d", status, http.StatusOK)
+	}
+
+	if got := download("carol", shareToken, ""); got != http.StatusNotFound {
+		t.Errorf("download with revoked share token: status = %d, want %d", got, http.StatusNotFound)
+	}
+
+	// Anonymous transforms require a signature, even of public images
+	if got := download("", "", "?width=8"); got != http.StatusUnauthorized {
+		t.Errorf("anonymous resized download: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestHTTPTransport_ShareTokenParam(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	meta, err := imageSvc.SetVisibility(ctx, stored.ID(), domain.VisibilityUnlisted)
+	if err != nil {
+		t.Fatalf("SetVisibility() error = %v", err)
+	}
+
+	authClient := &testAuthClient{claims: map[string]domain.AuthToken{"carol": {Username: "carol"}}}
+	ht := imagesvc.NewHTTPTransport(imageSvc, authClient, imagesvc.HTTPTransportConfig{URLFileIDParam: "media_id"})
+
+	tests := []struct {
+		name       string
+		path       string
+		query      string
+		wantStatus int
+	}{
+		{name: "download with share token", query: "?share_token=" + meta.ShareToken, wantStatus: http.StatusOK},
+		{name: "meta with share token", path: "/meta", query: "?share_token=" + meta.ShareToken, wantStatus: http.StatusOK},
+		{name: "download without share token", wantStatus: http.StatusNotFound},
+		{name: "download with wrong share token", query: "?share_token=" + stored.ID().String(), wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+tt.path+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer carol")
+
+			rec := httptest.NewRecorder()
+			ht.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if strings.Contains(rec.Body.String(), meta.ShareToken) {
+				t.Errorf("response leaks the share token to a non-owner: %s", rec.Body)
+			}
+		})
+	}
+}
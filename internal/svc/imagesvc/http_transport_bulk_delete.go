@@ -0,0 +1,306 @@
+package imagesvc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+var (
+	// ErrNoBulkDeleteIDs is returned when a bulk deletion does not list any media.
+	ErrNoBulkDeleteIDs = domain.NewError("bulk_delete.no_ids", "no media IDs", http.StatusBadRequest, false)
+	// ErrTooManyBulkDeleteIDs is returned when a bulk deletion lists more media than allowed.
+	ErrTooManyBulkDeleteIDs = domain.NewError(
+		"bulk_delete.too_many_ids", "too many media IDs", http.StatusBadRequest, false)
+	// ErrInvalidConfirmationToken is returned when the confirmation token of a bulk deletion is
+	// missing, expired or was issued for another user or other media.
+	ErrInvalidConfirmationToken = domain.NewError(
+		"bulk_delete.invalid_token", "invalid confirmation token", http.StatusForbidden, false)
+)
+
+// errNoBulkDeleteKey is returned when no key for signing confirmation tokens is available.
+var errNoBulkDeleteKey = errors.New("no bulk delete key")
+
+// bulkDeleteKeyPurpose separates the key derived from TransformSecret from the secret itself.
+const bulkDeleteKeyPurpose = "bulk-delete"
+
+// bulkDeleteBodyLimit is the maximum size of a bulk deletion request body.
+const bulkDeleteBodyLimit = 1 << 20
+
+// HandleBulkDeletePrepare prepares the deletion of multiple media of the authenticated user.
+// Expects a JSON body listing the media IDs. Responds with the number and total size of the
+// media, and a short-lived confirmation token that must accompany the execute step.
+// Nothing is deleted.
+func (ht *HTTPTransport) HandleBulkDeletePrepare(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleBulkDeletePrepare(w, r)
+}
+
+func (ht *HTTPTransport) handleBulkDeletePrepare(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media bulk delete prepare failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media bulk delete prepared")
+		}
+	}(r.Context())
+
+	username, ids, err := ht.decodeBulkDeleteRequest(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	metas, err := ht.imageSvc.List(r.Context())
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("list: %w", err)
+	}
+
+	sizes := make(map[string]int64, len(metas))
+	for _, meta := range metas {
+		sizes[meta.ID.String()] = meta.Size
+	}
+
+	resp := domain.MediaBulkDeletePrepareResponse{
+		IDs:        ids,
+		Count:      len(ids),
+		TotalBytes: 0,
+		Token:      "",
+		ExpiresAt:  ht.clock.Now().Add(time.Duration(ht.cfg.BulkDeleteTokenTTL) * time.Second).Unix(),
+	}
+
+	for _, id := range ids {
+		size, ok := sizes[id]
+		if !ok {
+			http_.WriteError(w, r, http.StatusNotFound)
+
+			return fmt.Errorf("media %q: %w", id, domain.ErrUnauthorized)
+		}
+
+		resp.TotalBytes += size
+	}
+
+	resp.Token, err = ht.bulkDeleteToken(username, ids, resp.ExpiresAt)
+	if err != nil {
+		http_.WriteError(w, r, http.StatusInternalServerError)
+
+		return fmt.Errorf("issue token: %w", err)
+	}
+
+	log = log.With(logging.Group("bulk_delete", "count", resp.Count, "bytes", resp.TotalBytes))
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// HandleBulkDelete executes a bulk deletion prepared by HandleBulkDeletePrepare.
+// Expects a JSON body listing the same media IDs as the prepare step along with its
+// confirmation token. Responds with the IDs of the deleted media and the media that
+// could not be deleted.
+func (ht *HTTPTransport) HandleBulkDelete(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleBulkDelete(w, r)
+}
+
+func (ht *HTTPTransport) handleBulkDelete(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media bulk delete failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "media bulk deleted")
+		}
+	}(r.Context())
+
+	var token string
+
+	username, ids, err := ht.decodeBulkDeleteRequest(w, r, &token)
+	if err != nil {
+		return err
+	}
+
+	if err := ht.verifyBulkDeleteToken(username, ids, token); err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("verify token: %w", err)
+	}
+
+	resp := domain.MediaBulkDeleteResponse{
+		Deleted: make([]string, 0, len(ids)),
+		Failed:  domain.BatchError{Items: nil},
+	}
+
+	for _, id := range ids {
+		if err := ht.imageSvc.Delete(r.Context(), domain.MediaID(id)); err != nil {
+			log.WarnContext(r.Context(), "media bulk delete item failed", "id", id, "error", err)
+
+			resp.Failed.Add(id, bulkDeleteError(err))
+
+			continue
+		}
+
+		resp.Deleted = append(resp.Deleted, id)
+	}
+
+	log = log.With(logging.Group("bulk_delete", "deleted", len(resp.Deleted), "failed", resp.Failed.Len()))
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// decodeBulkDeleteRequest reads the user and the normalized, sorted and de-duplicated media IDs
+// of a bulk deletion request. If token is not nil, it receives the confirmation token.
+// Writes the error response on failure.
+func (ht *HTTPTransport) decodeBulkDeleteRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	token *string,
+) (string, []string, error) {
+	username, ok := context_.UsernameFromContext(r.Context())
+	if !ok || username == "" {
+		http_.WriteError(w, r, http.StatusUnauthorized)
+
+		return "", nil, domain.ErrNoAuthToken
+	}
+
+	var req domain.MediaBulkDeleteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, bulkDeleteBodyLimit)).Decode(&req); err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return "", nil, fmt.Errorf("decode request: %w", err)
+	}
+
+	ids := make([]string, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if id = encoding.NormalizeCrockfordB32LC(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	switch {
+	case len(ids) == 0:
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return "", nil, ErrNoBulkDeleteIDs
+	case ht.cfg.BulkDeleteMaxIDs > 0 && len(ids) > ht.cfg.BulkDeleteMaxIDs:
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return "", nil, fmt.Errorf("%w: %d exceeds %d", ErrTooManyBulkDeleteIDs, len(ids), ht.cfg.BulkDeleteMaxIDs)
+	}
+
+	if token != nil {
+		*token = req.Token
+	}
+
+	return username, ids, nil
+}
+
+// bulkDeleteKey returns the key for signing confirmation tokens: BulkDeleteSecret, a key
+// derived from TransformSecret, or a random key if neither is configured.
+func bulkDeleteKey(cfg HTTPTransportConfig) ([]byte, error) {
+	switch {
+	case cfg.BulkDeleteSecret != "":
+		return []byte(cfg.BulkDeleteSecret), nil
+	case cfg.TransformSecret != "":
+		mac := hmac.New(sha256.New, []byte(cfg.TransformSecret))
+		mac.Write([]byte(bulkDeleteKeyPurpose))
+
+		return mac.Sum(nil), nil
+	default:
+		return randomKey()
+	}
+}
+
+// randomKey returns a random key for signing confirmation tokens.
+func randomKey() ([]byte, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("read random key: %w", err)
+	}
+
+	return key, nil
+}
+
+// bulkDeleteToken returns a confirmation token for deleting the given media of the user,
+// valid until expiresAt. The token has the form "<expiresAt>.<signature>".
+func (ht *HTTPTransport) bulkDeleteToken(username string, ids []string, expiresAt int64) (string, error) {
+	if len(ht.bulkDeleteKey) == 0 {
+		return "", errNoBulkDeleteKey
+	}
+
+	mac := hmac.New(sha256.New, ht.bulkDeleteKey)
+	mac.Write([]byte(username))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expiresAt, 10)))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strings.Join(ids, ",")))
+
+	return strconv.FormatInt(expiresAt, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyBulkDeleteToken checks that the token was issued for deleting the given media of the
+// user and has not expired.
+func (ht *HTTPTransport) verifyBulkDeleteToken(username string, ids []string, token string) error {
+	expiresAtStr, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidConfirmationToken
+	}
+
+	expiresAt, err := strconv.ParseInt(expiresAtStr, 10, 64)
+	if err != nil {
+		return ErrInvalidConfirmationToken
+	}
+
+	want, err := ht.bulkDeleteToken(username, ids, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(token), []byte(want)) {
+		return ErrInvalidConfirmationToken
+	}
+
+	if ht.clock.Now().Unix() > expiresAt {
+		return fmt.Errorf("%w: expired", ErrInvalidConfirmationToken)
+	}
+
+	return nil
+}
+
+// bulkDeleteError returns the client-facing error of a failed deletion. Media of other users
+// are reported as not found, so their existence is not disclosed.
+func bulkDeleteError(err error) error {
+	if errors.Is(err, domain.ErrUnauthorized) || errors.Is(err, os.ErrNotExist) {
+		return domain.ErrMediaNotFound
+	}
+
+	return err
+}
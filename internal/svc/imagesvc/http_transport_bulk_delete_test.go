@@ -0,0 +1,188 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleBulkDelete(t *testing.T) {
+	t.Parallel()
+
+	// tamper alters a character of the signature of token
+	tamper := func(token string) string {
+		i, c := len(token)/2+len(token)/4, byte('A')
+		if token[i] == c {
+			c = 'B'
+		}
+
+		return token[:i] + string(c) + token[i+1:]
+	}
+
+	tests := []struct {
+		name       string
+		cfg        imagesvc.HTTPTransportConfig
+		restart    bool // Execute with a new transport of the same configuration
+		username   string
+		alter      func(ids []string, token string) ([]string, string)
+		wantStatus int
+	}{
+		{
+			name: "confirmed", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60},
+			username: "alice", wantStatus: http.StatusOK,
+		},
+		{
+			name: "expired", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: -1},
+			username: "alice", wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "tampered", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60}, username: "alice",
+			alter: func(ids []string, token string) ([]string, string) {
+				return ids, tamper(token)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "other media", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60}, username: "alice",
+			alter: func(ids []string, token string) ([]string, string) {
+				return ids[:1], token
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "other user", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60},
+			username: "bob", wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "missing token", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60}, username: "alice",
+			alter: func(ids []string, _ string) ([]string, string) {
+				return ids, ""
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:    "restart with secret",
+			cfg:     imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60, BulkDeleteSecret: "secret"},
+			restart: true, username: "alice", wantStatus: http.StatusOK,
+		},
+		{
+			name:    "restart with transform secret",
+			cfg:     imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60, TransformSecret: "secret"},
+			restart: true, username: "alice", wantStatus: http.StatusOK,
+		},
+		{
+			name: "restart without secret", cfg: imagesvc.HTTPTransportConfig{BulkDeleteTokenTTL: 60},
+			restart: true, username: "alice", wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			imageSvc, err := newTestImageService(t, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+			ids := make([]string, 0, 2)
+
+			var totalBytes int64
+
+			for _, width := range []int{8, 16} {
+				data := encodeTestImage(t, imagesvc.MIMETypePNG, width, width, true)
+
+				stored, err := imageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{
+					Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+				}))
+				if err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+
+				ids = append(ids, stored.ID().String())
+				totalBytes += stored.Meta().Size
+			}
+
+			slices.Sort(ids)
+
+			post := func(handler http.HandlerFunc, username string, req domain.MediaBulkDeleteRequest,
+			) *httptest.ResponseRecorder {
+				body, err := json.Marshal(req)
+				if err != nil {
+					t.Fatalf("encode request: %v", err)
+				}
+
+				r := httptest.NewRequest(http.MethodPost, "/media/bulk-delete", bytes.NewReader(body)).
+					WithContext(context_.WithUsername(context.Background(), username))
+
+				rec := httptest.NewRecorder()
+				handler(rec, r)
+
+				return rec
+			}
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, tt.cfg)
+
+			rec := post(ht.HandleBulkDeletePrepare, "alice", domain.MediaBulkDeleteRequest{IDs: ids, Token: ""})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("prepare: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			var prepared domain.MediaBulkDeletePrepareResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &prepared); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if prepared.Count != len(ids) || prepared.TotalBytes != totalBytes || prepared.Token == "" {
+				t.Errorf("prepare: response = %+v, want %d media of %d bytes with a token", prepared, len(ids), totalBytes)
+			}
+
+			execIDs, token := ids, prepared.Token
+			if tt.alter != nil {
+				execIDs, token = tt.alter(execIDs, token)
+			}
+
+			if tt.restart {
+				ht = imagesvc.NewHTTPTransport(imageSvc, nil, tt.cfg)
+			}
+
+			rec = post(ht.HandleBulkDelete, tt.username, domain.MediaBulkDeleteRequest{IDs: execIDs, Token: token})
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("execute: status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			// Rejected deletions delete nothing
+			wantDeleted := []string{}
+			if tt.wantStatus == http.StatusOK {
+				wantDeleted = ids
+
+				var resp domain.MediaBulkDeleteResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+
+				if !slices.Equal(resp.Deleted, ids) || resp.Failed.Len() != 0 {
+					t.Errorf("execute: response = %+v, want %v deleted", resp, ids)
+				}
+			}
+
+			metas, err := imageSvc.List(ctx)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			if got, want := len(metas), len(ids)-len(wantDeleted); got != want {
+				t.Errorf("%d media left, want %d", got, want)
+			}
+		})
+	}
+}
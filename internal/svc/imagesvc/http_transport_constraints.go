@@ -0,0 +1,34 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// HandleConstraints reports the limits uploaded images must meet, so clients can reject
+// images before uploading them.
+func (ht *HTTPTransport) HandleConstraints(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleConstraints(w, r)
+}
+
+func (ht *HTTPTransport) handleConstraints(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media constraints failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media constraints served")
+		}
+	}(r.Context())
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, ht.imageSvc.UploadConstraints()); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package imagesvc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleConstraints(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{})
+
+	rec := httptest.NewRecorder()
+	ht.HandleConstraints(rec, httptest.NewRequest(http.MethodGet, "/media/constraints", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp domain.MediaUploadConstraints
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if resp.MaxSize != imageSvc.MaxSize() || !slices.Contains(resp.MIMETypes, imagesvc.MIMETypePNG) ||
+		!slices.Contains(resp.Extensions, ".png") || !slices.IsSorted(resp.MIMETypes) {
+		t.Errorf("response = %+v, want max size %d and PNG images", resp, imageSvc.MaxSize())
+	}
+}
@@ -0,0 +1,163 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+var (
+	// ErrNoFilename is returned when an inline upload does not specify a filename.
+	ErrNoFilename = domain.NewError("upload.no_filename", "no filename", http.StatusBadRequest, false)
+	// ErrNoData is returned when an inline upload does not contain any data.
+	ErrNoData = domain.NewError("upload.no_data", "no data", http.StatusBadRequest, false)
+	// ErrInvalidDataURL is returned when inline data is neither base64 nor a base64 data URL.
+	ErrInvalidDataURL = domain.NewError("upload.invalid_data_url", "invalid data url", http.StatusBadRequest, false)
+)
+
+// dataURLOverhead is the allowance for JSON framing and data URL prefix on top of the encoded media size.
+const dataURLOverhead = 4096
+
+// HandleDataUpload processes inline image upload requests.
+// Expects a JSON body with a filename and base64 or data URL encoded content.
+func (ht *HTTPTransport) HandleDataUpload(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleDataUpload(w, r)
+}
+
+//nolint:funlen
+func (ht *HTTPTransport) handleDataUpload(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+	ctx := r.Context()
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media data upload failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media data uploaded")
+		}
+	}()
+
+	release, ok := ht.acquireUserSlot(ctx, r, ht.uploadLimiter)
+	if !ok {
+		w.Header().Set("Retry-After", "1")
+		http_.WriteError(w, r, http.StatusTooManyRequests)
+
+		return fmt.Errorf("upload: %w", ErrConcurrencyLimit)
+	}
+	defer release()
+
+	// Base64 inflates content by 4/3
+	maxBodySize := ht.imageSvc.MaxSize()/3*4 + dataURLOverhead
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	var req domain.MediaDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http_.WriteError(w, r, http.StatusRequestEntityTooLarge)
+
+			return fmt.Errorf("decode request: %w", errors.Join(domain.ErrImageTooLarge, err))
+		}
+
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("decode request: %w", err)
+	}
+
+	log = log.With(logging.Group("media", "filename", req.Filename))
+
+	media, err := ht.mediaFromDataRequest(ctx, req)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusBadRequest))
+
+		return fmt.Errorf("media from data request: %w", err)
+	}
+
+	media, err = ht.imageSvc.Store(ctx, media)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusBadRequest))
+
+		return fmt.Errorf("store %s: %w", req.Filename, err)
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, domain.MediaIDResponse{
+		ID:       media.ID().String(),
+		Filename: media.Meta().Filename,
+	}); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// mediaFromDataRequest decodes and validates the content of an inline upload request.
+func (ht *HTTPTransport) mediaFromDataRequest(
+	ctx context.Context,
+	req domain.MediaDataRequest,
+) (domain.Media, error) {
+	if req.Filename == "" {
+		return domain.Media{}, ErrNoFilename
+	}
+
+	data, err := decodeDataURL(req.Data)
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("decode data: %w", err)
+	}
+
+	mimeType, _, err := ht.imageSvc.CheckUploadConstraints(req.Filename, int64(len(data)), data)
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("upload not allowed: %s: %w", req.Filename, err)
+	}
+
+	owner, _ := context_.UsernameFromContext(ctx)
+
+	return domain.NewMedia(data, domain.MediaMeta{ //nolint:exhaustruct
+		Filename: req.Filename,
+		Owner:    owner,
+		MIMEType: mimeType,
+	}), nil
+}
+
+// decodeDataURL decodes plain base64 content or a base64 data URL.
+// The media type of a data URL is ignored; the content type is detected from the data itself.
+func decodeDataURL(data string) ([]byte, error) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil, ErrNoData
+	}
+
+	if rest, ok := strings.CutPrefix(data, "data:"); ok {
+		params, payload, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(params, ";base64") {
+			return nil, ErrInvalidDataURL
+		}
+
+		data = payload
+	}
+
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		if decoded, err := encoding.DecodeString(data); err == nil {
+			if len(decoded) == 0 {
+				return nil, ErrNoData
+			}
+
+			return decoded, nil
+		}
+	}
+
+	return nil, ErrInvalidDataURL
+}
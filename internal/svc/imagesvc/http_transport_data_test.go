@@ -0,0 +1,141 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleDataUpload(t *testing.T) {
+	t.Parallel()
+
+	png := encodeTestImage(t, imagesvc.MIMETypePNG, 16, 8, true)
+	jpeg := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 8, true)
+	encoded := base64.StdEncoding.EncodeToString(png)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantType   string // MIME type of the stored image, if any
+	}{
+		{
+			name:       "data url",
+			body:       `{"filename":"pasted.png","data":"data:image/png;base64,` + encoded + `"}`,
+			wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG,
+		},
+		{
+			name:       "plain base64",
+			body:       `{"filename":"pasted.png","data":"` + encoded + `"}`,
+			wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG,
+		},
+		{
+			name:       "unpadded url-safe base64",
+			body:       `{"filename":"pasted.png","data":"` + base64.RawURLEncoding.EncodeToString(png) + `"}`,
+			wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG,
+		},
+		{
+			// The media type of a data URL is ignored, the content type is detected from the data
+			name:       "data url type ignored",
+			body:       `{"filename":"pasted.png","data":"data:image/jpeg;base64,` + encoded + `"}`,
+			wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG,
+		},
+		{
+			name:       "content mismatch",
+			body:       `{"filename":"pasted.png","data":"data:image/png;base64,` + base64.StdEncoding.EncodeToString(jpeg) + `"}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "unsupported type",
+			body:       `{"filename":"pasted.gif","data":"` + encoded + `"}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "not base64",
+			body:       `{"filename":"pasted.png","data":"data:image/png;base64,not base64!"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not base64 data url",
+			body:       `{"filename":"pasted.png","data":"data:image/png,` + encoded + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "data url without payload",
+			body:       `{"filename":"pasted.png","data":"data:image/png;base64"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{name: "no data", body: `{"filename":"pasted.png","data":""}`, wantStatus: http.StatusBadRequest},
+		{name: "no filename", body: `{"data":"` + encoded + `"}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed json", body: `{"filename":`, wantStatus: http.StatusBadRequest},
+		{
+			// Within the body limit, but exceeding the maximum size once decoded
+			name:       "content too large",
+			body:       `{"filename":"pasted.png","data":"` + base64.StdEncoding.EncodeToString(make([]byte, 1<<20+1)) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "body too large",
+			body:       `{"filename":"pasted.png","data":"` + strings.Repeat("A", 2<<20) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			imageSvc, err := newTestImageService(t, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{MaxConcurrentUploads: 2})
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+			req := httptest.NewRequest(http.MethodPost, "/media/data", strings.NewReader(tt.body)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			ht.HandleDataUpload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			metas, err := imageSvc.List(ctx)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				if len(metas) != 0 {
+					t.Errorf("%d media stored, want none", len(metas))
+				}
+
+				return
+			}
+
+			var resp domain.MediaIDResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if len(metas) != 1 || metas[0].ID.String() != resp.ID {
+				t.Fatalf("stored = %+v, want %s", metas, resp.ID)
+			}
+
+			if metas[0].MIMEType != tt.wantType || metas[0].Filename != "pasted.png" || resp.Filename != "pasted.png" {
+				t.Errorf("stored = %+v, response = %+v, want pasted.png of type %s", metas[0], resp, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package imagesvc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestHTTPTransport_HandleDownloadConditional(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:       "media_id",
+		URLWidthParam:        "width",
+		DownloadCacheControl: "private, max-age=60",
+	})
+
+	download := func(query string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+query, nil).WithContext(ctx)
+		req.SetPathValue("media_id", stored.ID().String())
+		req.Header = header
+
+		rec := httptest.NewRecorder()
+		ht.HandleDownload(rec, req)
+
+		return rec
+	}
+
+	original := download("", http.Header{})
+	resized := download("?width=8", http.Header{})
+
+	for _, rec := range []*httptest.ResponseRecorder{original, resized} {
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+
+		if got := rec.Header().Get("Cache-Control"); got != "private, max-age=60" {
+			t.Errorf("Cache-Control = %q, want %q", got, "private, max-age=60")
+		}
+	}
+
+	if got, want := original.Header().Get("ETag"), `"`+stored.Hash()+`"`; got != want {
+		t.Errorf("ETag = %q, want %q", got, want)
+	}
+
+	if original.Header().Get("ETag") == resized.Header().Get("ETag") {
+		t.Error("resized download has the ETag of the original")
+	}
+
+	lastModified := original.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("Last-Modified not set")
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "matching etag", header: http.Header{"If-None-Match": {original.Header().Get("ETag")}}, wantStatus: http.StatusNotModified},
+		{name: "matching resized etag", query: "?width=8", header: http.Header{"If-None-Match": {resized.Header().Get("ETag")}}, wantStatus: http.StatusNotModified},
+		{name: "etag of other version", query: "?width=8", header: http.Header{"If-None-Match": {original.Header().Get("ETag")}}, wantStatus: http.StatusOK},
+		{name: "not modified since", header: http.Header{"If-Modified-Since": {lastModified}}, wantStatus: http.StatusNotModified},
+		{name: "modified since", header: http.Header{"If-Modified-Since": {time.Unix(0, 0).UTC().Format(http.TimeFormat)}}, wantStatus: http.StatusOK},
+		{name: "etag precedes date", header: http.Header{"If-None-Match": {`"stale"`}, "If-Modified-Since": {lastModified}}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := download(tt.query, tt.header)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("body length = %d, want 0", rec.Body.Len())
+			}
+
+			if got := rec.Header().Get("Cache-Control"); got != "private, max-age=60" {
+				t.Errorf("Cache-Control = %q, want %q", got, "private, max-age=60")
+			}
+		})
+	}
+}
+
+// transformCountingImageService counts the transforms of an ImageService.
+type transformCountingImageService struct {
+	imagesvc.ImageService
+
+	transforms atomic.Int64
+}
+
+// Transform implements imagesvc.ImageService.
+//
+//nolint:wrapcheck
+func (svc *transformCountingImageService) Transform(
+	ctx context.Context,
+	imageID domain.MediaID,
+	spec transform.Spec,
+) (domain.Media, error) {
+	svc.transforms.Add(1)
+
+	return svc.ImageService.Transform(ctx, imageID, spec)
+}
+
+func TestHTTPTransport_HandleDownloadCap(t *testing.T) {
+	t.Parallel()
+
+	data := encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true)
+
+	tests := []struct {
+		name       string
+		username   string // Downloading user, anonymous if empty
+		query      string
+		used       int64 // Bytes the owner downloaded before
+		wantStatus int
+	}{
+		{name: "within cap", username: "alice", query: "?width=8", used: 0, wantStatus: http.StatusOK},
+		{name: "capped", username: "alice", query: "?width=8", used: int64(len(data)), wantStatus: http.StatusTooManyRequests},
+		{name: "anonymous within cap", username: "", query: "", used: 0, wantStatus: http.StatusOK},
+		{name: "anonymous capped owner", username: "", query: "", used: int64(len(data)), wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+			mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{
+				MaxSize: 1 << 20, MonthlyDownloadCap: int64(len(data)), ChangeLogDeletions: 100,
+			})
+			if err != nil {
+				t.Fatalf("new media service: %v", err)
+			}
+
+			blobImageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			stored, err := blobImageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{
+				Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+			}))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			// Public images can be downloaded anonymously, on the account of the owner
+			if _, err := blobImageSvc.SetVisibility(ctx, stored.ID(), domain.VisibilityPublic); err != nil {
+				t.Fatalf("SetVisibility() error = %v", err)
+			}
+
+			if err := blobImageSvc.RecordDownload(ctx, "alice", tt.used); err != nil {
+				t.Fatalf("RecordDownload() error = %v", err)
+			}
+
+			imageSvc := &transformCountingImageService{ImageService: blobImageSvc}
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+				URLFileIDParam:       "media_id",
+				URLWidthParam:        "width",
+				MaxConcurrentResizes: 2,
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+tt.query, nil).
+				WithContext(context_.WithUsername(context.Background(), tt.username))
+			req.SetPathValue("media_id", stored.ID().String())
+
+			rec := httptest.NewRecorder()
+			ht.HandleDownload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			// Capped downloads are rejected before the image is fetched or resized
+			wantTransforms := int64(0)
+			if tt.wantStatus == http.StatusOK {
+				wantTransforms = 1
+			}
+
+			if got := imageSvc.transforms.Load(); got != wantTransforms {
+				t.Errorf("%d transforms, want %d", got, wantTransforms)
+			}
+		})
+	}
+}
+
+func TestHTTPTransport_DownloadScopes(t *testing.T) {
+	t.Parallel()
+
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	stored, err := imageSvc.Store(context_.WithUsername(context.Background(), "alice"),
+		domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+			Filename: "private.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+		}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	authClient := &testAuthClient{claims: map[string]domain.AuthToken{
+		"scoped":   {Username: "alice", Scopes: []string{"media"}},
+		"unscoped": {Username: "alice", Scopes: []string{"profile"}},
+	}}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, authClient, imagesvc.HTTPTransportConfig{
+		URLFileIDParam: "media_id",
+		RequiredScopes: "media",
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{name: "scoped token", method: http.MethodGet, token: "scoped", wantStatus: http.StatusOK},
+		{name: "under-scoped token", method: http.MethodGet, token: "unscoped", wantStatus: http.StatusForbidden},
+		{name: "under-scoped token head", method: http.MethodHead, token: "unscoped", wantStatus: http.StatusForbidden},
+		{name: "invalid token", method: http.MethodGet, token: "invalid", wantStatus: http.StatusForbidden},
+		{name: "anonymous", method: http.MethodGet, token: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/media/"+stored.ID().String(), nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			rec := httptest.NewRecorder()
+			ht.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+// blockingImageService blocks the first transform of an ImageService until released.
+type blockingImageService struct {
+	imagesvc.ImageService
+
+	blocked atomic.Bool
+	started chan struct{}
+	release chan struct{}
+}
+
+// Transform implements imagesvc.ImageService.
+//
+//nolint:wrapcheck
+func (svc *blockingImageService) Transform(
+	ctx context.Context,
+	imageID domain.MediaID,
+	spec transform.Spec,
+) (domain.Media, error) {
+	if svc.blocked.CompareAndSwap(false, true) {
+		close(svc.started)
+		<-svc.release
+	}
+
+	return svc.ImageService.Transform(ctx, imageID, spec)
+}
+
+func TestHTTPTransport_HandleDownloadAnonymousResizes(t *testing.T) {
+	t.Parallel()
+
+	blobImageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := blobImageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true),
+		domain.MediaMeta{Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	imageSvc := &blockingImageService{
+		ImageService: blobImageSvc, started: make(chan struct{}), release: make(chan struct{}),
+	}
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:       "media_id",
+		URLWidthParam:        "width",
+		URLSignatureParam:    "sig",
+		URLExpiresParam:      "expires",
+		TransformSecret:      "secret",
+		MaxConcurrentResizes: 1,
+	})
+
+	// download resizes the image anonymously by a signed URL from the given client. Resizes to
+	// other widths do not wait for the blocked resize of the same derivative.
+	download := func(remoteAddr string, width int) *httptest.ResponseRecorder {
+		expiresAt := time.Now().Add(time.Hour).Unix()
+		query := url.Values{
+			"width":   {strconv.Itoa(width)},
+			"expires": {strconv.FormatInt(expiresAt, 10)},
+			"sig": {transform.SignUntil([]byte("secret"), stored.ID().String(),
+				transform.Spec{Width: width}, expiresAt)},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+"?"+query.Encode(), nil)
+		req.SetPathValue("media_id", stored.ID().String())
+		req.RemoteAddr = remoteAddr
+
+		rec := httptest.NewRecorder()
+		ht.HandleDownload(rec, req)
+
+		return rec
+	}
+
+	// The first client holds its only resize slot until released
+	blocked := make(chan *httptest.ResponseRecorder)
+	go func() { blocked <- download("192.0.2.1:1234", 8) }()
+
+	select {
+	case <-imageSvc.started:
+	case rec := <-blocked:
+		t.Fatalf("blocked client: status = %d before resizing: %s", rec.Code, rec.Body)
+	}
+
+	steps := []struct {
+		name       string
+		remoteAddr string
+		width      int
+		wantStatus int
+	}{
+		{name: "other client", remoteAddr: "192.0.2.2:1234", width: 4, wantStatus: http.StatusOK},
+		{name: "same client", remoteAddr: "192.0.2.1:5678", width: 4, wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, step := range steps {
+		if rec := download(step.remoteAddr, step.width); rec.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", step.name, rec.Code, step.wantStatus, rec.Body)
+		}
+	}
+
+	close(imageSvc.release)
+
+	if rec := <-blocked; rec.Code != http.StatusOK {
+		t.Errorf("blocked client: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
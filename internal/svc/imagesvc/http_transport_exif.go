@@ -0,0 +1,63 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// HandleExif processes EXIF metadata requests.
+// Expects the image ID as a URL parameter. Responds with the EXIF metadata extracted on upload,
+// or 404 Not Found if none was extracted, e.g. because extraction was disabled.
+func (ht *HTTPTransport) HandleExif(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleExif(w, r)
+}
+
+func (ht *HTTPTransport) handleExif(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media exif failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media exif served")
+		}
+	}(r.Context())
+
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+	log = log.With(logging.Group("media", "id", fileID))
+
+	exif, err := ht.imageSvc.Exif(r.Context(), domain.MediaID(fileID))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnauthorized):
+			fallthrough
+		case errors.Is(err, os.ErrNotExist):
+			http_.WriteError(w, r, http.StatusNotFound)
+		default:
+			http_.WriteError(w, r, http.StatusInternalServerError)
+		}
+
+		return fmt.Errorf("exif: %w", err)
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, exif); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// contentHashLength is the length of a SHA-256 content hash in Crockford Base32.
+const contentHashLength = 52
+
+// ErrInvalidHash is returned when a content hash is missing or malformed.
+var ErrInvalidHash = domain.NewError("media.invalid_hash", "invalid content hash", http.StatusBadRequest, false)
+
+// HandleExists checks whether content is already stored for the authenticated user, so clients
+// can skip uploading it. Expects the SHA-256 of the content as hash parameter, either in
+// Crockford Base32 or in hex. Responds with 200 OK and the matching media if the content exists,
+// or with 404 Not Found otherwise. HEAD requests receive the status code only.
+func (ht *HTTPTransport) HandleExists(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleExists(w, r)
+}
+
+func (ht *HTTPTransport) handleExists(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media exists failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media exists served")
+		}
+	}(r.Context())
+
+	hash, err := parseContentHash(r.URL.Query().Get(ht.cfg.URLHashParam))
+	if err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("parse hash: %w", err)
+	}
+
+	log = log.With(logging.Group("media", "hash", hash))
+
+	metas, err := ht.imageSvc.FindByHash(r.Context(), hash)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("find by hash: %w", err)
+	}
+
+	resp := domain.MediaExistsResponse{
+		Hash:   hash,
+		Exists: len(metas) > 0,
+		Media:  make([]domain.MediaIDResponse, 0, len(metas)),
+	}
+
+	for _, meta := range metas {
+		resp.Media = append(resp.Media, domain.MediaIDResponse{ID: meta.ID.String(), Filename: meta.Filename})
+	}
+
+	sort.Slice(resp.Media, func(i, j int) bool {
+		return resp.Media[i].ID < resp.Media[j].ID
+	})
+
+	status := http.StatusOK
+	if !resp.Exists {
+		status = http.StatusNotFound
+	}
+
+	if err := http_.WriteJSON(w, r, status, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// parseContentHash parses a SHA-256 content hash given in Crockford Base32 or hex,
+// and returns it in the Crockford Base32 form used as content ID.
+func parseContentHash(hash string) (string, error) {
+	hash = strings.TrimSpace(hash)
+
+	if sum, err := hex.DecodeString(hash); err == nil && len(sum) == 32 {
+		return encoding.EncodeCrockfordB32LC(sum), nil
+	}
+
+	hash = encoding.NormalizeCrockfordB32LC(hash)
+	if len(hash) != contentHashLength {
+		return "", fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+
+	for _, c := range hash {
+		if !strings.ContainsRune("0123456789abcdefghjkmnpqrstvwxyz", c) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+		}
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,201 @@
+package imagesvc
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// ErrAlbumNotFound is returned when a gallery album does not exist.
+var ErrAlbumNotFound = domain.NewError("gallery.album_not_found", "album not found", http.StatusNotFound, false)
+
+// galleryAlbumLayout is the time layout of album names, which group media by storage month.
+const galleryAlbumLayout = "2006-01"
+
+// galleryTemplate renders a gallery page. It does not use inline styles or scripts,
+// so it is compatible with the default Content-Security-Policy.
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<nav>
+<a href="{{.Root}}">All</a>{{range .Albums}} | <a href="{{.URL}}">{{.Name}}</a>{{end}}
+</nav>
+{{if .Images}}<ul>
+{{range .Images}}<li><a href="{{.URL}}"><img src="{{.ThumbnailURL}}" alt="{{.Filename}}" width="{{$.Width}}" loading="lazy"></a></li>
+{{end}}</ul>{{else}}<p>No images.</p>{{end}}
+</body>
+</html>
+`))
+
+// galleryPage holds the data of a rendered gallery page.
+type galleryPage struct {
+	Title  string
+	Root   string
+	Width  int
+	Albums []galleryLink
+	Images []galleryImage
+}
+
+// galleryLink links an album of a gallery page.
+type galleryLink struct {
+	Name string
+	URL  string
+}
+
+// galleryImage is an image of a gallery page, shown as thumbnail linking the original.
+type galleryImage struct {
+	Filename     string
+	URL          string
+	ThumbnailURL string
+}
+
+// HandleGallery renders an HTML gallery of the authenticated user's images, newest first.
+// Expects an optional album name as URL parameter, the storage month of the images in
+// YYYY-MM format. Thumbnails and originals are linked by expiring share URLs if a transform
+// secret is configured, otherwise by their plain download URLs. Links never carry the
+// credentials of the request. The thumbnails of the shown images are queued for generation.
+func (ht *HTTPTransport) HandleGallery(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleGallery(w, r)
+}
+
+func (ht *HTTPTransport) handleGallery(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "gallery failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "gallery served")
+		}
+	}(r.Context())
+
+	album := r.PathValue("album")
+	if album != "" {
+		if _, err := time.Parse(galleryAlbumLayout, album); err != nil {
+			http_.WriteError(w, r, http.StatusNotFound)
+
+			return fmt.Errorf("%w: %q", ErrAlbumNotFound, album)
+		}
+	}
+
+	metas, err := ht.imageSvc.List(r.Context())
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("list: %w", err)
+	}
+
+	// Newest first
+	slices.SortFunc(metas, func(a, b domain.MediaMeta) int {
+		return cmp.Or(cmp.Compare(b.Modified, a.Modified), cmp.Compare(a.ID, b.ID))
+	})
+
+	page := galleryPage{
+		Title:  "Gallery",
+		Root:   galleryURL(""),
+		Width:  ht.cfg.GalleryThumbnailWidth,
+		Albums: nil,
+		Images: nil,
+	}
+
+	if album != "" {
+		page.Title = "Gallery " + album
+	}
+
+	expiresAt := ht.signedURLExpiry(ht.clock.Now())
+
+	for _, meta := range metas {
+		if !strings.HasPrefix(meta.MIMEType, "image/") {
+			continue
+		}
+
+		metaAlbum := galleryAlbum(meta)
+		if metaAlbum != "" && !slices.ContainsFunc(page.Albums, func(l galleryLink) bool { return l.Name == metaAlbum }) {
+			page.Albums = append(page.Albums, galleryLink{Name: metaAlbum, URL: galleryURL(metaAlbum)})
+		}
+
+		if album != "" && metaAlbum != album {
+			continue
+		}
+
+		page.Images = append(page.Images, galleryImage{
+			Filename:     meta.Filename,
+			URL:          ht.galleryMediaURL(meta.ID.String(), 0, expiresAt),
+			ThumbnailURL: ht.galleryMediaURL(meta.ID.String(), ht.cfg.GalleryThumbnailWidth, expiresAt),
+		})
+
+		if ht.cfg.GalleryThumbnailWidth > 0 {
+			ht.imageSvc.Prewarm(r.Context(), meta.ID, []int{ht.cfg.GalleryThumbnailWidth})
+		}
+	}
+
+	if album != "" && len(page.Images) == 0 {
+		http_.WriteError(w, r, http.StatusNotFound)
+
+		return fmt.Errorf("%w: %q", ErrAlbumNotFound, album)
+	}
+
+	var buf bytes.Buffer
+	if err := galleryTemplate.Execute(&buf, page); err != nil {
+		http_.WriteError(w, r, http.StatusInternalServerError)
+
+		return fmt.Errorf("render: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// galleryAlbum returns the album of the given media, or an empty string if its storage time is unknown.
+func galleryAlbum(meta domain.MediaMeta) string {
+	if meta.Modified == 0 {
+		return ""
+	}
+
+	return time.UnixMilli(meta.Modified).UTC().Format(galleryAlbumLayout)
+}
+
+// galleryURL returns the URL of a gallery page, or of the gallery root if album is empty.
+func galleryURL(album string) string {
+	if album == "" {
+		return "/gallery"
+	}
+
+	return "/gallery/" + url.PathEscape(album)
+}
+
+// galleryMediaURL returns the download URL of the given media, resized to width unless 0.
+// If a transform secret is configured, it is a share URL expiring at expiresAt.
+func (ht *HTTPTransport) galleryMediaURL(mediaID string, width int, expiresAt int64) string {
+	if ht.cfg.TransformSecret != "" {
+		return ht.shareURL(mediaID, width, expiresAt)
+	}
+
+	if width == 0 {
+		return "/media/" + url.PathEscape(mediaID)
+	}
+
+	return "/media/" + url.PathEscape(mediaID) + "?" + url.Values{ht.cfg.URLWidthParam: {strconv.Itoa(width)}}.Encode()
+}
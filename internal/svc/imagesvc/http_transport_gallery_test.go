@@ -0,0 +1,140 @@
+package imagesvc_test
+
+import (
+	"context"
+	"html"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+// galleryThumbnailPattern matches the thumbnail URLs of a rendered gallery page.
+var galleryThumbnailPattern = regexp.MustCompile(`<img src="([^"]+)"`)
+
+func TestHTTPTransport_HandleGallery(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	for _, width := range []int{8, 16} {
+		if _, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, width, width, true),
+			domain.MediaMeta{Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG},
+		)); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	album := time.Now().UTC().Format("2006-01")
+
+	tests := []struct {
+		name       string
+		secret     string
+		album      string
+		wantStatus int
+		wantImages int
+		wantSigned bool
+	}{
+		{name: "all", secret: "secret", album: "", wantStatus: http.StatusOK, wantImages: 2, wantSigned: true},
+		{name: "album", secret: "secret", album: album, wantStatus: http.StatusOK, wantImages: 2, wantSigned: true},
+		{name: "unsigned", secret: "", album: "", wantStatus: http.StatusOK, wantImages: 2, wantSigned: false},
+		{name: "empty album", secret: "secret", album: "1999-01", wantStatus: http.StatusNotFound},
+		{name: "invalid album", secret: "secret", album: "photos", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+				URLFileIDParam:        "media_id",
+				URLWidthParam:         "width",
+				URLSignatureParam:     "sig",
+				URLExpiresParam:       "expires",
+				TransformSecret:       tt.secret,
+				SignedURLTTL:          3600,
+				GalleryEnabled:        true,
+				GalleryThumbnailWidth: 4,
+			})
+
+			// The access token of the request must not leak into the rendered links
+			req := httptest.NewRequest(http.MethodGet, "/gallery?access_token=token-of-alice", nil).
+				WithContext(context_.WithUsername(context.Background(), "alice"))
+			req.SetPathValue("album", tt.album)
+
+			rec := httptest.NewRecorder()
+			ht.HandleGallery(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			body := rec.Body.String()
+			if strings.Contains(body, "token-of-alice") {
+				t.Errorf("page contains the access token: %s", body)
+			}
+
+			matches := galleryThumbnailPattern.FindAllStringSubmatch(body, -1)
+			if len(matches) != tt.wantImages {
+				t.Fatalf("%d images, want %d: %s", len(matches), tt.wantImages, body)
+			}
+
+			for _, match := range matches {
+				thumbnail, err := url.Parse(html.UnescapeString(match[1]))
+				if err != nil {
+					t.Fatalf("parse thumbnail URL: %v", err)
+				}
+
+				query := thumbnail.Query()
+				if query.Get("width") != "4" {
+					t.Errorf("thumbnail URL %s, want width 4", thumbnail)
+				}
+
+				if got := query.Get("sig") != "" && query.Get("expires") != ""; got != tt.wantSigned {
+					t.Errorf("thumbnail URL %s signed = %t, want %t", thumbnail, got, tt.wantSigned)
+				}
+
+				if !tt.wantSigned {
+					continue
+				}
+
+				// Signed thumbnails are downloaded without authentication
+				download := httptest.NewRequest(http.MethodGet, thumbnail.String(), nil)
+				download.SetPathValue("media_id", strings.TrimPrefix(thumbnail.Path, "/media/"))
+
+				downloaded := httptest.NewRecorder()
+				ht.HandleDownload(downloaded, download)
+
+				if downloaded.Code != http.StatusOK {
+					t.Fatalf("download status = %d, want %d", downloaded.Code, http.StatusOK)
+				}
+
+				config, _, err := image.DecodeConfig(downloaded.Body)
+				if err != nil {
+					t.Fatalf("decode download: %v", err)
+				}
+
+				if config.Width != 4 {
+					t.Errorf("thumbnail width = %d, want 4", config.Width)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package imagesvc
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+const (
+	// GeoMaxZoom is the highest zoom level media can be clustered for.
+	GeoMaxZoom = 22
+
+	// geoCellsPerTile is the number of clustering cells along each side of a map tile,
+	// i.e. a tile at any zoom level is divided into geoCellsPerTile² cells.
+	geoCellsPerTile = 4
+)
+
+// ErrInvalidGeoZoom is returned when the zoom level of a geo request is not between 0 and GeoMaxZoom.
+var ErrInvalidGeoZoom = domain.NewError(
+	"media.invalid_geo_zoom", "invalid geo zoom level", http.StatusBadRequest, false)
+
+// geoCell identifies a clustering cell of the grid of a zoom level.
+type geoCell struct {
+	x, y int
+}
+
+// HandleGeo lists the authenticated user's geotagged media as a GeoJSON FeatureCollection of
+// points, clustering media taken close to each other at the requested zoom level. The location
+// is read from the EXIF metadata extracted on upload, if GPS positions are kept.
+func (ht *HTTPTransport) HandleGeo(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleGeo(w, r)
+}
+
+func (ht *HTTPTransport) handleGeo(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media geo failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media geo served")
+		}
+	}(r.Context())
+
+	zoom := 0
+
+	if zoomStr := r.URL.Query().Get(ht.cfg.URLZoomParam); zoomStr != "" {
+		zoom, err = strconv.Atoi(zoomStr)
+		if err != nil || zoom < 0 || zoom > GeoMaxZoom {
+			http_.WriteError(w, r, http.StatusBadRequest)
+
+			return fmt.Errorf("%w: %q", ErrInvalidGeoZoom, zoomStr)
+		}
+	}
+
+	metas, err := ht.imageSvc.ListLocated(r.Context())
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("list located: %w", err)
+	}
+
+	resp := domain.MediaGeoResponse{
+		Type:     domain.GeoJSONFeatureCollection,
+		Zoom:     zoom,
+		Features: ht.geoFeatures(metas, zoom),
+	}
+
+	log.DebugContext(r.Context(), "media geo clustered", "zoom", zoom, "clusters", len(resp.Features))
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// geoFeatures clusters the media by the grid cell of their location at the zoom level.
+// Each cluster is placed at the mean location of its media. Largest clusters come first.
+func (ht *HTTPTransport) geoFeatures(metas []domain.MediaMeta, zoom int) []domain.MediaGeoFeature {
+	slices.SortFunc(metas, func(a, b domain.MediaMeta) int {
+		return cmp.Or(cmp.Compare(b.Modified, a.Modified), cmp.Compare(a.ID, b.ID))
+	})
+
+	features := make([]domain.MediaGeoFeature, 0)
+	clusters := make(map[geoCell]int)
+
+	for _, meta := range metas {
+		if meta.Location == nil {
+			continue
+		}
+
+		cell := geoCellOf(*meta.Location, zoom)
+
+		i, ok := clusters[cell]
+		if !ok {
+			i = len(features)
+			clusters[cell] = i
+			features = append(features, domain.MediaGeoFeature{
+				Type: domain.GeoJSONFeature,
+				Geometry: domain.MediaGeoPoint{
+					Type:        domain.GeoJSONPoint,
+					Coordinates: [2]float64{0, 0},
+				},
+				Properties: domain.MediaGeoProperties{
+					Count:    0,
+					CoverID:  meta.ID.String(),
+					CoverURL: ht.variantURL(meta.ID.String(), ht.cfg.TimelineCoverWidth),
+					IDs:      nil,
+				},
+			})
+		}
+
+		// Accumulate the sums of the coordinates, which are divided once all media are assigned
+		feature := &features[i]
+		feature.Geometry.Coordinates[0] += meta.Location.Longitude
+		feature.Geometry.Coordinates[1] += meta.Location.Latitude
+		feature.Properties.Count++
+		feature.Properties.IDs = append(feature.Properties.IDs, meta.ID.String())
+	}
+
+	for i := range features {
+		count := float64(features[i].Properties.Count)
+		features[i].Geometry.Coordinates[0] /= count
+		features[i].Geometry.Coordinates[1] /= count
+	}
+
+	slices.SortStableFunc(features, func(a, b domain.MediaGeoFeature) int {
+		return cmp.Compare(b.Properties.Count, a.Properties.Count)
+	})
+
+	return features
+}
+
+// geoCellOf returns the clustering cell containing the location at the zoom level.
+// Cells span equal angles of latitude and longitude, which are halved with each zoom level.
+func geoCellOf(location domain.MediaLocation, zoom int) geoCell {
+	size := 360 / math.Exp2(float64(zoom)) / geoCellsPerTile
+
+	return geoCell{
+		x: int(math.Floor((location.Longitude + 180) / size)),
+		y: int(math.Floor((location.Latitude + 90) / size)),
+	}
+}
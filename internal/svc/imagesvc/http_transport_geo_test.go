@@ -0,0 +1,129 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/repo/metaindex"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestHTTPTransport_HandleGeo(t *testing.T) {
+	t.Parallel()
+
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	index, err := metaindex.NewSQLiteIndex(metaindex.SQLiteIndexConfig{
+		DatabasePath: filepath.Join(t.TempDir(), "index.db"),
+	})
+	if err != nil {
+		t.Fatalf("new index: %v", err)
+	}
+
+	t.Cleanup(func() { _ = index.Close() })
+	mediaSvc.SetIndex(index)
+
+	cfg := testConfig("")
+	cfg.ExifExtract = true
+	cfg.ExifGPS = true
+
+	imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+	data := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 16, true)
+	withExif := slices.Concat(data[:2], buildTestExif(), data[2:])
+
+	uploads := map[string][]byte{
+		"first.jpg":  withExif,
+		"second.jpg": withExif,
+		"plain.jpg":  data,
+	}
+
+	var located []string
+
+	for filename, upload := range uploads {
+		stored, err := imageSvc.Store(ctx, domain.NewMedia(upload, domain.MediaMeta{
+			Filename: filename,
+			Owner:    "alice",
+			MIMEType: imagesvc.MIMETypeJPEG,
+		}))
+		if err != nil {
+			t.Fatalf("Store(%q) error = %v", filename, err)
+		}
+
+		if filename != "plain.jpg" {
+			located = append(located, stored.ID().String())
+		}
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:     "media_id",
+		URLWidthParam:      "width",
+		URLZoomParam:       "zoom",
+		TimelineCoverWidth: 320,
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantZoom   int
+	}{
+		{name: "world by default", wantStatus: http.StatusOK},
+		{name: "max zoom", query: "?zoom=22", wantStatus: http.StatusOK, wantZoom: 22},
+		{name: "zoom too high", query: "?zoom=23", wantStatus: http.StatusBadRequest},
+		{name: "invalid zoom", query: "?zoom=far", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			ht.HandleGeo(rec, httptest.NewRequest(http.MethodGet, "/media/geo"+tt.query, nil).WithContext(ctx))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp domain.MediaGeoResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			if resp.Type != domain.GeoJSONFeatureCollection || resp.Zoom != tt.wantZoom || len(resp.Features) != 1 {
+				t.Fatalf("response = %+v, want one cluster at zoom %d", resp, tt.wantZoom)
+			}
+
+			feature := resp.Features[0]
+			if want := [2]float64{-13.25, 52.5}; feature.Geometry.Coordinates != want {
+				t.Errorf("coordinates = %v, want %v", feature.Geometry.Coordinates, want)
+			}
+
+			if feature.Properties.Count != 2 || !sameElements(feature.Properties.IDs, located) {
+				t.Errorf("cluster = %d %v, want %v", feature.Properties.Count, feature.Properties.IDs, located)
+			}
+		})
+	}
+}
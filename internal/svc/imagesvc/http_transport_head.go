@@ -0,0 +1,67 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// HandleHead processes HEAD requests of image downloads, accepting the parameters of HandleDownload.
+// Responds with the Content-Type, Content-Length, ETag and caching headers of the download, without
+// its body. Original images are described by their metadata, so their content is not read; transformed
+// images are transformed, unless cached, as their size is not known otherwise.
+// Downloads described by HEAD requests do not count towards the download cap.
+func (ht *HTTPTransport) HandleHead(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleHead(w, r)
+}
+
+func (ht *HTTPTransport) handleHead(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media head failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media head served")
+		}
+	}(r.Context())
+
+	ctx, fileID, spec, err := ht.parseDownload(w, r)
+	if err != nil {
+		return err
+	}
+
+	log = log.With(logging.Group("media", "id", fileID))
+
+	if !spec.IsIdentity() {
+		release, ok := ht.acquireUserSlot(ctx, r, ht.resizeLimiter)
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http_.WriteError(w, r, http.StatusTooManyRequests)
+
+			return fmt.Errorf("resize: %w", ErrConcurrencyLimit)
+		}
+		defer release()
+	}
+
+	meta, err := ht.imageSvc.TransformMeta(ctx, fileID, spec)
+	if err != nil {
+		http_.WriteError(w, r, downloadErrorStatus(ctx, r, fileID, err))
+
+		return fmt.Errorf("fetch meta: %w", err)
+	}
+
+	if ht.notModifiedDownload(w, r, meta) {
+		return nil
+	}
+
+	w.Header().Set("Content-Type", meta.MIMEType)
+	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
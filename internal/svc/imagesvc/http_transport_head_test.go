@@ -0,0 +1,192 @@
+package imagesvc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleHead(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:       "media_id",
+		URLWidthParam:        "width",
+		URLFormatParam:       "format",
+		DownloadCacheControl: "private, max-age=60",
+	})
+
+	tests := []struct {
+		name        string
+		mediaID     string
+		query       string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "original", mediaID: stored.ID().String(), wantStatus: http.StatusOK},
+		{name: "resized", mediaID: stored.ID().String(), query: "?width=8", wantStatus: http.StatusOK},
+		{name: "converted", mediaID: stored.ID().String(), query: "?format=jpeg", wantStatus: http.StatusOK},
+		{name: "not modified", mediaID: stored.ID().String(), ifNoneMatch: `"` + stored.Hash() + `"`, wantStatus: http.StatusNotModified},
+		{name: "not found", mediaID: "unknown", wantStatus: http.StatusNotFound},
+		{name: "invalid width", mediaID: stored.ID().String(), query: "?width=x", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := func(method string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, "/media/"+tt.mediaID+tt.query, nil).WithContext(ctx)
+				req.SetPathValue("media_id", tt.mediaID)
+
+				if tt.ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", tt.ifNoneMatch)
+				}
+
+				rec := httptest.NewRecorder()
+
+				if method == http.MethodHead {
+					ht.HandleHead(rec, req)
+				} else {
+					ht.HandleDownload(rec, req)
+				}
+
+				return rec
+			}
+
+			head := request(http.MethodHead)
+
+			if head.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", head.Code, tt.wantStatus)
+			}
+
+			if head.Code != http.StatusOK {
+				return
+			}
+
+			if head.Body.Len() != 0 {
+				t.Errorf("body length = %d, want 0", head.Body.Len())
+			}
+
+			get := request(http.MethodGet)
+
+			for _, header := range []string{"Content-Type", "Content-Length", "ETag", "Last-Modified", "Cache-Control"} {
+				if got, want := head.Header().Get(header), get.Header().Get(header); got != want || got == "" {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPTransport_HandleHeadUsage(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{URLFileIDParam: "media_id"})
+
+	req := httptest.NewRequest(http.MethodHead, "/media/"+stored.ID().String(), nil).WithContext(ctx)
+	req.SetPathValue("media_id", stored.ID().String())
+	ht.HandleHead(httptest.NewRecorder(), req)
+
+	usage, err := imageSvc.Usage(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+
+	if usage.Downloads != 0 || usage.DownloadBytes != 0 {
+		t.Errorf("usage = %+v, want no downloads", usage)
+	}
+}
+
+func TestHTTPTransport_HandleDownloadHead(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{URLFileIDParam: "media_id"})
+
+	// The route policies must not conflict, as the download route matches HEAD requests too
+	_ = http_.PolicyAuthorizingMiddleware(http.NotFoundHandler(), nil, http_.AuthorizationConfig{
+		Policies: ht.AuthPolicies(),
+	}, logging.NewNopLogger())
+
+	tests := []struct {
+		name     string
+		method   string
+		wantBody bool
+	}{
+		{name: "download", method: http.MethodGet, wantBody: true},
+		{name: "head", method: http.MethodHead, wantBody: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/media/"+stored.ID().String(), nil).WithContext(ctx)
+			req.SetPathValue("media_id", stored.ID().String())
+
+			rec := httptest.NewRecorder()
+			ht.HandleDownload(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			if got := rec.Body.Len() > 0; got != tt.wantBody {
+				t.Errorf("body = %d bytes, want body %t", rec.Body.Len(), tt.wantBody)
+			}
+
+			if rec.Header().Get("Content-Length") == "" && !tt.wantBody {
+				t.Error("HEAD response without Content-Length")
+			}
+		})
+	}
+}
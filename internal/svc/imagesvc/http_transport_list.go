@@ -0,0 +1,136 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// ErrInvalidLimit is returned when the limit of a media listing is not a positive integer.
+var ErrInvalidLimit = domain.NewError("media.invalid_limit", "invalid limit", http.StatusBadRequest, false)
+
+// HandleList lists the id, filename, size, MIME type and storage time of the authenticated user's
+// media, ordered by storage time, in pages of the requested limit. With the cursor of a previous
+// response as cursor parameter, the page following it is listed.
+func (ht *HTTPTransport) HandleList(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleList(w, r)
+}
+
+func (ht *HTTPTransport) handleList(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media list failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media list served")
+		}
+	}(r.Context())
+
+	query := r.URL.Query()
+
+	after, err := parseListCursor(query.Get(ht.cfg.URLCursorParam))
+	if err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("parse cursor: %w", err)
+	}
+
+	limit, err := ht.parseListLimit(query.Get(ht.cfg.URLLimitParam))
+	if err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("parse limit: %w", err)
+	}
+
+	// One more than the limit is listed to tell whether another page follows
+	metas, err := ht.imageSvc.ListPage(r.Context(), after, limit+1)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("list page: %w", err)
+	}
+
+	resp := domain.MediaListResponse{
+		Entries: make([]domain.MediaListEntry, 0, min(len(metas), limit)),
+		Cursor:  "",
+	}
+
+	if len(metas) > limit {
+		metas = metas[:limit]
+		resp.Cursor = formatListCursor(metas[len(metas)-1])
+	}
+
+	for _, meta := range metas {
+		resp.Entries = append(resp.Entries, domain.MediaListEntry{
+			ID:       meta.ID.String(),
+			Filename: meta.Filename,
+			Size:     meta.Size,
+			MIMEType: meta.MIMEType,
+			Modified: meta.Modified,
+		})
+	}
+
+	log.DebugContext(r.Context(), "media list built", "entries", len(resp.Entries), "cursor", resp.Cursor)
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// parseListLimit parses the limit of a media listing, defaulting to HTTPTransportConfig.ListDefaultLimit.
+// Limits above HTTPTransportConfig.ListMaxLimit are lowered to it.
+func (ht *HTTPTransport) parseListLimit(limitStr string) (int, error) {
+	limit := ht.cfg.ListDefaultLimit
+
+	if limitStr != "" {
+		var err error
+
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidLimit, limitStr)
+		}
+	}
+
+	if ht.cfg.ListMaxLimit > 0 {
+		limit = min(limit, ht.cfg.ListMaxLimit)
+	}
+
+	return max(limit, 1), nil
+}
+
+// formatListCursor returns the opaque cursor of the page of a media listing following the given media.
+func formatListCursor(meta domain.MediaMeta) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(meta.Modified, 10) + ":" + meta.ID.String()))
+}
+
+// parseListCursor parses the cursor of a media listing into the position the page starts after.
+// An empty cursor is the start of the listing.
+func parseListCursor(cursor string) (domain.MediaPosition, error) {
+	if cursor == "" {
+		return domain.MediaPosition{}, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return domain.MediaPosition{}, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+
+	modifiedStr, id, _ := strings.Cut(string(decoded), ":")
+
+	modified, err := strconv.ParseInt(modifiedStr, 10, 64)
+	if err != nil || modified < 0 || id == "" {
+		return domain.MediaPosition{}, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+
+	return domain.MediaPosition{Modified: modified, ID: domain.MediaID(id)}, nil
+}
@@ -0,0 +1,141 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/repo/metaindex"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestHTTPTransport_HandleList(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		index bool
+	}{
+		{name: "index", index: true},
+		{name: "scan", index: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+			mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+			if err != nil {
+				t.Fatalf("new media service: %v", err)
+			}
+
+			if tt.index {
+				index, err := metaindex.NewSQLiteIndex(metaindex.SQLiteIndexConfig{
+					DatabasePath: filepath.Join(t.TempDir(), "index.db"),
+				})
+				if err != nil {
+					t.Fatalf("new index: %v", err)
+				}
+
+				t.Cleanup(func() { _ = index.Close() })
+				mediaSvc.SetIndex(index)
+			}
+
+			imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			var stored []string
+
+			for _, filename := range []string{"first.png", "second.png", "third.png"} {
+				media, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+					Filename: filename, Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+				}))
+				if err != nil {
+					t.Fatalf("Store(%q) error = %v", filename, err)
+				}
+
+				stored = append(stored, media.ID().String())
+			}
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+				URLCursorParam:   "cursor",
+				URLLimitParam:    "limit",
+				ListDefaultLimit: 100,
+				ListMaxLimit:     2,
+			})
+
+			list := func(query string) (int, domain.MediaListResponse) {
+				req := httptest.NewRequest(http.MethodGet, "/media"+query, nil).WithContext(ctx)
+				rec := httptest.NewRecorder()
+				ht.HandleList(rec, req)
+
+				var resp domain.MediaListResponse
+				if rec.Code == http.StatusOK {
+					if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+						t.Fatalf("decode response: %v", err)
+					}
+				}
+
+				return rec.Code, resp
+			}
+
+			var listed []string
+
+			for query, pages := "", 0; ; pages++ {
+				status, resp := list(query)
+				if status != http.StatusOK {
+					t.Fatalf("list %q: status = %d, want %d", query, status, http.StatusOK)
+				}
+
+				if len(resp.Entries) > 2 {
+					t.Errorf("list %q: entries = %d, want at most 2", query, len(resp.Entries))
+				}
+
+				for _, entry := range resp.Entries {
+					if entry.Size == 0 || entry.MIMEType != imagesvc.MIMETypePNG || entry.Modified == 0 {
+						t.Errorf("entry = %+v, want size, MIME type and time", entry)
+					}
+
+					listed = append(listed, entry.ID)
+				}
+
+				if resp.Cursor == "" {
+					break
+				}
+
+				if pages > len(stored) {
+					t.Fatalf("listing does not end")
+				}
+
+				query = "?cursor=" + resp.Cursor
+			}
+
+			slices.Sort(stored)
+			slices.Sort(listed)
+
+			if !slices.Equal(listed, stored) {
+				t.Errorf("listed = %v, want %v", listed, stored)
+			}
+
+			for _, query := range []string{"?cursor=!", "?cursor=Zm9v", "?limit=0", "?limit=x"} {
+				if status, _ := list(query); status != http.StatusBadRequest {
+					t.Errorf("list %q: status = %d, want %d", query, status, http.StatusBadRequest)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package imagesvc
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// ErrInvalidCursor is returned when the cursor of a manifest delta is malformed.
+var ErrInvalidCursor = domain.NewError("media.invalid_cursor", "invalid cursor", http.StatusBadRequest, false)
+
+// HandleManifest lists the id, hash, size and storage time of the authenticated user's media,
+// in the order they were changed. With a cursor from a previous response as since parameter,
+// only the media stored or updated after it are listed, along with the IDs of the media deleted
+// after it. If the cursor expired, all media are listed and the response is marked as reset.
+func (ht *HTTPTransport) HandleManifest(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleManifest(w, r)
+}
+
+func (ht *HTTPTransport) handleManifest(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media manifest failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media manifest served")
+		}
+	}(r.Context())
+
+	since, err := parseCursor(r.URL.Query().Get(ht.cfg.URLSinceParam))
+	if err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("parse cursor: %w", err)
+	}
+
+	changes, err := ht.imageSvc.ListChanges(r.Context(), since)
+
+	reset := errors.Is(err, domain.ErrChangesExpired)
+	if reset {
+		log.DebugContext(r.Context(), "media manifest cursor expired", "error", err)
+
+		changes, err = ht.imageSvc.ListChanges(r.Context(), 0)
+	}
+
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("list changes: %w", err)
+	}
+
+	slices.SortFunc(changes.Changed, func(a, b domain.MediaMeta) int {
+		return cmp.Or(cmp.Compare(a.Seq, b.Seq), cmp.Compare(a.Modified, b.Modified), cmp.Compare(a.ID, b.ID))
+	})
+
+	resp := domain.MediaManifestResponse{
+		Cursor:  strconv.FormatInt(changes.Seq, 10),
+		Entries: make([]domain.MediaManifestEntry, 0, len(changes.Changed)),
+		Deleted: nil,
+		Reset:   reset,
+	}
+
+	for _, meta := range changes.Changed {
+		resp.Entries = append(resp.Entries, domain.MediaManifestEntry{
+			ID:           meta.ID.String(),
+			Hash:         meta.Hash,
+			OriginalHash: meta.OriginalHash,
+			Size:         meta.Size,
+			Modified:     meta.Modified,
+		})
+	}
+
+	for _, id := range changes.Deleted {
+		resp.Deleted = append(resp.Deleted, id.String())
+	}
+
+	log.DebugContext(r.Context(), "media manifest built",
+		"entries", len(resp.Entries), "deleted", len(resp.Deleted), "cursor", resp.Cursor)
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// parseCursor parses the cursor of a manifest delta, the number of the latest change already
+// known to the client, or 0 without a cursor.
+func parseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	since, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || since < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+
+	return since, nil
+}
@@ -0,0 +1,123 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleManifest(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{URLSinceParam: "since"})
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	ids := make([]string, 0, 3)
+
+	store := func(width int) {
+		stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, width, width, true),
+			domain.MediaMeta{Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG},
+		))
+		if err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+
+		ids = append(ids, stored.ID().String())
+	}
+
+	manifest := func(since string) (int, domain.MediaManifestResponse) {
+		target := "/media/manifest"
+		if since != "" {
+			target += "?" + url.Values{"since": {since}}.Encode()
+		}
+
+		rec := httptest.NewRecorder()
+		ht.HandleManifest(rec, httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx))
+
+		var resp domain.MediaManifestResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+		}
+
+		return rec.Code, resp
+	}
+
+	entryIDs := func(resp domain.MediaManifestResponse) []string {
+		entries := make([]string, 0, len(resp.Entries))
+		for _, entry := range resp.Entries {
+			entries = append(entries, entry.ID)
+		}
+
+		return entries
+	}
+
+	store(8)
+	store(16)
+
+	_, full := manifest("")
+	if got := entryIDs(full); !slices.Equal(got, ids) || full.Reset || len(full.Deleted) != 0 {
+		t.Fatalf("full manifest = %+v, want %v", full, ids)
+	}
+
+	store(24)
+
+	if err := imageSvc.Delete(ctx, domain.MediaID(ids[0])); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		since       string
+		wantStatus  int
+		wantEntries []string
+		wantDeleted []string
+		wantReset   bool
+	}{
+		{name: "unchanged", since: "4", wantStatus: http.StatusOK},
+		{name: "delta", since: full.Cursor, wantStatus: http.StatusOK, wantEntries: ids[2:], wantDeleted: ids[:1]},
+		{name: "expired", since: "99", wantStatus: http.StatusOK, wantEntries: ids[1:], wantReset: true},
+		{name: "invalid", since: "yesterday", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			status, resp := manifest(tt.since)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+
+			if status != http.StatusOK {
+				return
+			}
+
+			if resp.Cursor != "4" || resp.Reset != tt.wantReset {
+				t.Errorf("cursor %q, reset %t, want 4, %t", resp.Cursor, resp.Reset, tt.wantReset)
+			}
+
+			if got := entryIDs(resp); !slices.Equal(got, tt.wantEntries) {
+				t.Errorf("entries = %v, want %v", got, tt.wantEntries)
+			}
+
+			if !slices.Equal(resp.Deleted, tt.wantDeleted) {
+				t.Errorf("deleted = %v, want %v", resp.Deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
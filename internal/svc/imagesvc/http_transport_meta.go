@@ -0,0 +1,89 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// HandleMeta processes media metadata requests.
+// Expects the image ID as a URL parameter. Responds with the filename, size, MIME type, content hash,
+// storage time and visibility of the image, without reading its content. The users the image is
+// shared with are only listed to the owner. Responds with 304 Not Modified if the
+// request's If-None-Match header matches the ETag of the metadata.
+func (ht *HTTPTransport) HandleMeta(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleMeta(w, r)
+}
+
+func (ht *HTTPTransport) handleMeta(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media meta failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media meta served")
+		}
+	}(r.Context())
+
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+	log = log.With(logging.Group("media", "id", fileID))
+
+	meta, err := ht.imageSvc.FetchMeta(r.Context(), domain.MediaID(fileID))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnauthorized):
+			fallthrough
+		case errors.Is(err, os.ErrNotExist):
+			http_.WriteError(w, r, http.StatusNotFound)
+		default:
+			http_.WriteError(w, r, http.StatusInternalServerError)
+		}
+
+		return fmt.Errorf("fetch meta: %w", err)
+	}
+
+	if http_.NotModified(w, r, http_.RevisionETag(meta.Revision())) {
+		return nil
+	}
+
+	resp := domain.MediaMetaResponse{
+		ID:           meta.ID.String(),
+		Filename:     meta.Filename,
+		Size:         meta.Size,
+		MIMEType:     meta.MIMEType,
+		Hash:         meta.Hash,
+		OriginalHash: meta.OriginalHash,
+		Modified:     meta.Modified,
+		TakenAt:      meta.TakenAt,
+
+		Visibility: meta.EffectiveVisibility(),
+		SharedWith: nil,
+	}
+
+	if username, _ := context_.UsernameFromContext(r.Context()); username == meta.Owner {
+		resp.SharedWith = meta.SharedWith
+		resp.ShareToken = meta.ShareToken
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleMeta(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{URLFileIDParam: "media_id"})
+
+	meta := func(username, mediaID, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/media/"+mediaID+"/meta", nil).
+			WithContext(context_.WithUsername(context.Background(), username))
+		req.SetPathValue("media_id", mediaID)
+
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		rec := httptest.NewRecorder()
+		ht.HandleMeta(rec, req)
+
+		return rec
+	}
+
+	rec := meta("alice", stored.ID().String(), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp domain.MediaMetaResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	storedMeta, err := imageSvc.FetchMeta(ctx, stored.ID())
+	if err != nil {
+		t.Fatalf("FetchMeta() error = %v", err)
+	}
+
+	want := domain.MediaMetaResponse{
+		ID:       stored.ID().String(),
+		Filename: "photo.png",
+		Size:     stored.Size(),
+		MIMEType: imagesvc.MIMETypePNG,
+		Hash:     stored.Hash(),
+		Modified: storedMeta.Modified,
+
+		Visibility: domain.VisibilityPrivate,
+	}
+	if !reflect.DeepEqual(resp, want) || resp.Modified == 0 {
+		t.Errorf("response = %+v, want %+v", resp, want)
+	}
+
+	tests := []struct {
+		name        string
+		username    string
+		mediaID     string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "not modified", username: "alice", mediaID: stored.ID().String(), ifNoneMatch: rec.Header().Get("ETag"), wantStatus: http.StatusNotModified},
+		{name: "stale etag", username: "alice", mediaID: stored.ID().String(), ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+		{name: "other user", username: "bob", mediaID: stored.ID().String(), wantStatus: http.StatusNotFound},
+		{name: "not found", username: "alice", mediaID: "unknown", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := meta(tt.username, tt.mediaID, tt.ifNoneMatch).Code; got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+var (
+	// ErrInvalidReprocessProcessors is returned when a reprocessing job names no or unknown processors.
+	ErrInvalidReprocessProcessors = domain.NewError(
+		"reprocess.invalid_processors", "invalid reprocess processors", http.StatusBadRequest, false)
+	// ErrReprocessRunning is returned when a reprocessing job is started while another one is running.
+	ErrReprocessRunning = domain.NewError(
+		"reprocess.running", "reprocessing already running", http.StatusConflict, true)
+	// ErrReprocessNotRunning is returned when no reprocessing job is running or has run.
+	ErrReprocessNotRunning = domain.NewError(
+		"reprocess.not_running", "no reprocessing job", http.StatusNotFound, false)
+)
+
+// reprocessBodyLimit is the maximum size of a reprocessing request body.
+const reprocessBodyLimit = 1 << 16
+
+// reprocessJob tracks the reprocessing job run in the background. Only one job runs at a time.
+type reprocessJob struct {
+	m       sync.Mutex
+	status  *domain.MediaReprocessStatus // Status of the running or last job, nil if none has run
+	cancel  context.CancelFunc           // Cancels the running job, nil if none is running
+	stopped chan struct{}                // Closed when the running job stops
+}
+
+// update records the progress of the running job.
+func (job *reprocessJob) update(status domain.MediaReprocessStatus) {
+	status = cloneReprocessStatus(status)
+
+	job.m.Lock()
+	defer job.m.Unlock()
+
+	job.status = &status
+}
+
+// snapshot returns a copy of the status of the running or last job.
+func (job *reprocessJob) snapshot() (domain.MediaReprocessStatus, bool) {
+	job.m.Lock()
+	defer job.m.Unlock()
+
+	if job.status == nil {
+		return domain.MediaReprocessStatus{}, false
+	}
+
+	return cloneReprocessStatus(*job.status), true
+}
+
+// HandleReprocessStart starts a reprocessing job in the background, running processors on the
+// already stored images, e.g. to backfill a processor added to the ingest pipeline.
+// Expects a JSON body naming the processors, and optionally the owner of the images to reprocess
+// and a rate limit. Responds with 202 Accepted and the initial status of the job.
+// Must be served behind http_.RequireRole restricting it to domain.RoleAdmin.
+func (ht *HTTPTransport) HandleReprocessStart(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleReprocessStart(w, r)
+}
+
+func (ht *HTTPTransport) handleReprocessStart(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "reprocess start failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "reprocess started")
+		}
+	}(r.Context())
+
+	var req domain.MediaReprocessRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, reprocessBodyLimit)).Decode(&req); err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("decode request: %w", err)
+	}
+
+	names := ProcessorNames()
+	if len(req.Processors) == 0 || slices.ContainsFunc(req.Processors, func(name string) bool {
+		return !slices.Contains(names, name)
+	}) {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("%w: %q", ErrInvalidReprocessProcessors, req.Processors)
+	}
+
+	log = log.With(logging.Group("reprocess", "processors", req.Processors, "owner", req.Owner))
+
+	ht.reprocess.m.Lock()
+	defer ht.reprocess.m.Unlock()
+
+	if ht.reprocess.cancel != nil {
+		http_.WriteError(w, r, http.StatusConflict)
+
+		return ErrReprocessRunning
+	}
+
+	// The job outlives the request, acting with admin access on the images of all users
+	ctx, cancel := context.WithCancel(context_.WithAdminAccess(context.WithoutCancel(r.Context())))
+	stopped := make(chan struct{})
+
+	status := domain.MediaReprocessStatus{
+		Running:    true,
+		Processors: req.Processors,
+		Owner:      req.Owner,
+		Total:      0,
+		Processed:  0,
+		Changed:    0,
+		Failed:     0,
+		Replaced:   nil,
+		Started:    time.Now().UnixMilli(),
+		Finished:   0,
+		Error:      "",
+	}
+
+	ht.reprocess.status = &status
+	ht.reprocess.cancel = cancel
+	ht.reprocess.stopped = stopped
+
+	go ht.runReprocess(ctx, req, stopped)
+
+	if err := http_.WriteJSON(w, r, http.StatusAccepted, status); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// runReprocess runs the reprocessing job and records its final status.
+func (ht *HTTPTransport) runReprocess(ctx context.Context, req domain.MediaReprocessRequest, stopped chan struct{}) {
+	defer close(stopped)
+
+	status, err := ht.imageSvc.Reprocess(ctx, req, ht.reprocess.update)
+	if err != nil {
+		ht.log.WarnContext(ctx, "reprocess stopped", "error", err)
+	}
+
+	ht.reprocess.update(status)
+
+	ht.reprocess.m.Lock()
+	defer ht.reprocess.m.Unlock()
+
+	ht.reprocess.cancel()
+	ht.reprocess.cancel = nil
+}
+
+// HandleReprocessStatus responds with the progress of the running or last reprocessing job,
+// or 404 Not Found if none has run.
+// Must be served behind http_.RequireRole restricting it to domain.RoleAdmin.
+func (ht *HTTPTransport) HandleReprocessStatus(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleReprocessStatus(w, r)
+}
+
+func (ht *HTTPTransport) handleReprocessStatus(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "reprocess status failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "reprocess status served")
+		}
+	}(r.Context())
+
+	status, ok := ht.reprocess.snapshot()
+	if !ok {
+		http_.WriteError(w, r, http.StatusNotFound)
+
+		return ErrReprocessNotRunning
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, status); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// HandleReprocessCancel cancels the running reprocessing job and responds with its final status,
+// or 404 Not Found if no job is running. Images reprocessed before the cancellation stay changed.
+// Must be served behind http_.RequireRole restricting it to domain.RoleAdmin.
+func (ht *HTTPTransport) HandleReprocessCancel(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleReprocessCancel(w, r)
+}
+
+func (ht *HTTPTransport) handleReprocessCancel(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "reprocess cancel failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "reprocess canceled")
+		}
+	}(r.Context())
+
+	ht.reprocess.m.Lock()
+	cancel, stopped := ht.reprocess.cancel, ht.reprocess.stopped
+	ht.reprocess.m.Unlock()
+
+	if cancel == nil {
+		http_.WriteError(w, r, http.StatusNotFound)
+
+		return ErrReprocessNotRunning
+	}
+
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-r.Context().Done():
+		return fmt.Errorf("wait for reprocess: %w", r.Context().Err())
+	}
+
+	status, _ := ht.reprocess.snapshot()
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, status); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// ErrInvalidShareExpiry is returned when a share URL is requested with a negative validity
+// duration or one exceeding HTTPTransportConfig.ShareMaxTTL.
+var ErrInvalidShareExpiry = domain.NewError("share.invalid_expiry", "invalid share expiry", http.StatusBadRequest, false)
+
+// shareBodyLimit is the maximum size of a share request body.
+const shareBodyLimit = 1 << 10
+
+// HandleShare creates a time-limited download URL of an image of the authenticated user, which
+// is served without authentication until it expires. Expects the image ID as a URL parameter and
+// an optional JSON body with the width to resize the image to and the validity duration.
+// The URL is signed, so neither can be altered. Requires a transform secret.
+func (ht *HTTPTransport) HandleShare(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleShare(w, r)
+}
+
+func (ht *HTTPTransport) handleShare(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media share failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "media shared")
+		}
+	}(r.Context())
+
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+	log = log.With(logging.Group("media", "id", fileID))
+
+	// The body is optional, sharing the original with the default validity
+	var req domain.MediaShareRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, shareBodyLimit)).Decode(&req); err != nil &&
+		!errors.Is(err, io.EOF) {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("decode request: %w", err)
+	}
+
+	if req.Width < 0 {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("%w: %d", ErrInvalidWidth, req.Width)
+	}
+
+	ttl := req.ExpiresIn
+	if ttl == 0 {
+		ttl = ht.cfg.ShareDefaultTTL
+	}
+
+	if ttl < 0 || (ht.cfg.ShareMaxTTL > 0 && ttl > ht.cfg.ShareMaxTTL) {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("%w: %d", ErrInvalidShareExpiry, req.ExpiresIn)
+	}
+
+	// Make sure the media exists and the user is allowed to access it
+	if _, err := ht.imageSvc.FetchMeta(r.Context(), domain.MediaID(fileID)); err != nil {
+		http_.WriteError(w, r, downloadErrorStatus(r.Context(), r, domain.MediaID(fileID), err))
+
+		return fmt.Errorf("fetch meta: %w", err)
+	}
+
+	resp := domain.MediaShareResponse{
+		URL:       "",
+		ExpiresAt: ht.clock.Now().Add(time.Duration(ttl) * time.Second).Unix(),
+	}
+	resp.URL = ht.shareURL(fileID, req.Width, resp.ExpiresAt)
+
+	log = log.With(logging.Group("share", "width", req.Width, "expires_at", resp.ExpiresAt))
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// shareURL returns the download URL of the given media, resized to width unless 0,
+// signed until expiresAt.
+func (ht *HTTPTransport) shareURL(mediaID string, width int, expiresAt int64) string {
+	query := url.Values{}
+
+	if width > 0 {
+		query.Set(ht.cfg.URLWidthParam, strconv.Itoa(width))
+	}
+
+	query.Set(ht.cfg.URLExpiresParam, strconv.FormatInt(expiresAt, 10))
+	query.Set(ht.cfg.URLSignatureParam,
+		transform.SignUntil([]byte(ht.cfg.TransformSecret), mediaID, transform.Spec{Width: width}, expiresAt))
+
+	return "/media/" + url.PathEscape(mediaID) + "?" + query.Encode()
+}
@@ -0,0 +1,266 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+func TestHTTPTransport_HandleShare(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	mediaID := stored.ID().String()
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:    "media_id",
+		URLWidthParam:     "width",
+		URLSignatureParam: "sig",
+		URLExpiresParam:   "expires",
+		TransformSecret:   "secret",
+		ShareDefaultTTL:   60,
+		ShareMaxTTL:       3600,
+	})
+
+	share := func(username, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/media/"+mediaID+"/share", bytes.NewBufferString(body)).
+			WithContext(context_.WithUsername(context.Background(), username))
+		req.SetPathValue("media_id", mediaID)
+
+		rec := httptest.NewRecorder()
+		ht.HandleShare(rec, req)
+
+		return rec
+	}
+
+	// Shared URLs are downloaded without authentication
+	download := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.SetPathValue("media_id", mediaID)
+
+		rec := httptest.NewRecorder()
+		ht.HandleDownload(rec, req)
+
+		return rec
+	}
+
+	t.Run("share", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name      string
+			body      string
+			wantWidth int
+			wantTTL   int64
+		}{
+			{name: "original", body: "", wantWidth: 16, wantTTL: 60},
+			{name: "resized", body: `{"width": 8, "expiresIn": 600}`, wantWidth: 8, wantTTL: 600},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				rec := share("alice", tt.body)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+				}
+
+				var resp domain.MediaShareResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+
+				if ttl := resp.ExpiresAt - time.Now().Unix(); ttl < tt.wantTTL-5 || ttl > tt.wantTTL {
+					t.Errorf("expires in %d s, want %d s", ttl, tt.wantTTL)
+				}
+
+				downloaded := download(resp.URL)
+				if downloaded.Code != http.StatusOK {
+					t.Fatalf("download status = %d, want %d", downloaded.Code, http.StatusOK)
+				}
+
+				config, _, err := image.DecodeConfig(downloaded.Body)
+				if err != nil {
+					t.Fatalf("decode download: %v", err)
+				}
+
+				if config.Width != tt.wantWidth {
+					t.Errorf("width = %d, want %d", config.Width, tt.wantWidth)
+				}
+
+				shared, err := url.Parse(resp.URL)
+				if err != nil {
+					t.Fatalf("parse URL: %v", err)
+				}
+
+				// The width and expiry are covered by the signature
+				query := shared.Query()
+				query.Set("width", "4")
+
+				if got := download(shared.Path + "?" + query.Encode()).Code; got != http.StatusForbidden {
+					t.Errorf("altered width: status = %d, want %d", got, http.StatusForbidden)
+				}
+
+				query = shared.Query()
+				query.Set("expires", strconv.FormatInt(resp.ExpiresAt+3600, 10))
+
+				if got := download(shared.Path + "?" + query.Encode()).Code; got != http.StatusForbidden {
+					t.Errorf("altered expiry: status = %d, want %d", got, http.StatusForbidden)
+				}
+			})
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		expiresAt := time.Now().Add(-time.Minute).Unix()
+		query := url.Values{
+			"expires": {strconv.FormatInt(expiresAt, 10)},
+			"sig":     {transform.SignUntil([]byte("secret"), mediaID, transform.Spec{}, expiresAt)},
+		}
+
+		if got := download("/media/" + mediaID + "?" + query.Encode()).Code; got != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", got, http.StatusForbidden)
+		}
+	})
+
+	t.Run("without expiry", func(t *testing.T) {
+		t.Parallel()
+
+		// The signature is only valid along with the expiry it covers
+		expiresAt := time.Now().Add(time.Hour).Unix()
+		query := url.Values{"sig": {transform.SignUntil([]byte("secret"), mediaID, transform.Spec{}, expiresAt)}}
+
+		if got := download("/media/" + mediaID + "?" + query.Encode()).Code; got != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", got, http.StatusForbidden)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name       string
+			username   string
+			body       string
+			wantStatus int
+		}{
+			{name: "expiry too long", username: "alice", body: `{"expiresIn": 7200}`, wantStatus: http.StatusBadRequest},
+			{name: "negative expiry", username: "alice", body: `{"expiresIn": -1}`, wantStatus: http.StatusBadRequest},
+			{name: "negative width", username: "alice", body: `{"width": -1}`, wantStatus: http.StatusBadRequest},
+			{name: "invalid body", username: "alice", body: `{`, wantStatus: http.StatusBadRequest},
+			{name: "other user", username: "bob", wantStatus: http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				if got := share(tt.username, tt.body).Code; got != tt.wantStatus {
+					t.Errorf("status = %d, want %d", got, tt.wantStatus)
+				}
+			})
+		}
+	})
+}
+
+func TestHTTPTransport_ShareExpiry(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	stored, err := imageSvc.Store(context_.WithUsername(context.Background(), "alice"),
+		domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+			Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+		}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	mediaID := stored.ID().String()
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:    "media_id",
+		URLSignatureParam: "sig",
+		URLExpiresParam:   "expires",
+		TransformSecret:   "secret",
+		ShareDefaultTTL:   60,
+		ShareMaxTTL:       3600,
+	})
+
+	clk := clock.NewFake(now)
+	ht.SetClock(clk)
+
+	req := httptest.NewRequest(http.MethodPost, "/media/"+mediaID+"/share", nil).
+		WithContext(context_.WithUsername(context.Background(), "alice"))
+	req.SetPathValue("media_id", mediaID)
+
+	rec := httptest.NewRecorder()
+	ht.HandleShare(rec, req)
+
+	var resp domain.MediaShareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if want := now.Unix() + 60; resp.ExpiresAt != want {
+		t.Fatalf("ExpiresAt = %d, want %d", resp.ExpiresAt, want)
+	}
+
+	// The expiry is checked against the clock of the transport, so the steps run in order
+	steps := []struct {
+		name       string
+		advance    time.Duration
+		wantStatus int
+	}{
+		{name: "before expiry", advance: 59 * time.Second, wantStatus: http.StatusOK},
+		{name: "at expiry", advance: time.Second, wantStatus: http.StatusOK},
+		{name: "after expiry", advance: time.Second, wantStatus: http.StatusForbidden},
+	}
+
+	for _, step := range steps {
+		clk.Advance(step.advance)
+
+		req := httptest.NewRequest(http.MethodGet, resp.URL, nil)
+		req.SetPathValue("media_id", mediaID)
+
+		rec := httptest.NewRecorder()
+		ht.HandleDownload(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", step.name, rec.Code, step.wantStatus, rec.Body)
+		}
+	}
+}
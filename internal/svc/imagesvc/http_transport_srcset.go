@@ -0,0 +1,179 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+var (
+	// ErrNoWidths is returned when a srcset request does not list any widths.
+	ErrNoWidths = domain.NewError("srcset.no_widths", "no widths", http.StatusBadRequest, false)
+	// ErrInvalidWidth is returned when a requested width is not a positive integer.
+	ErrInvalidWidth = domain.NewError("image.invalid_width", "invalid width", http.StatusBadRequest, false)
+	// ErrTooManyWidths is returned when a srcset request lists more widths than allowed.
+	ErrTooManyWidths = domain.NewError("srcset.too_many_widths", "too many widths", http.StatusBadRequest, false)
+)
+
+const srcsetFormatHTML = "html"
+
+// HandleSrcset processes srcset requests.
+// Expects the image ID as a URL parameter and a comma-separated list of widths.
+// Responds with the URLs of the resized derivatives, either as JSON or as a
+// plain HTML srcset attribute value, or with 304 Not Modified if the request's
+// If-None-Match header matches the ETag of the response, or, without If-None-Match,
+// if the image was not stored after the request's If-Modified-Since time.
+func (ht *HTTPTransport) HandleSrcset(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleSrcset(w, r)
+}
+
+//nolint:funlen
+func (ht *HTTPTransport) handleSrcset(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media srcset failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media srcset served")
+		}
+	}(r.Context())
+
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+	log = log.With(logging.Group("media", "id", fileID))
+
+	widths, err := parseWidths(r.URL.Query().Get(ht.cfg.URLWidthsParam), ht.cfg.SrcsetMaxWidths)
+	if err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("parse widths: %w", err)
+	}
+
+	// Make sure the media exists and the user is allowed to access it
+	meta, err := ht.imageSvc.FetchMeta(r.Context(), domain.MediaID(fileID))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnauthorized):
+			fallthrough
+		case errors.Is(err, os.ErrNotExist):
+			http_.WriteError(w, r, http.StatusNotFound)
+		default:
+			http_.WriteError(w, r, http.StatusInternalServerError)
+		}
+
+		return fmt.Errorf("fetch meta: %w", err)
+	}
+
+	if ht.cfg.SrcsetPrewarm {
+		ht.imageSvc.Prewarm(r.Context(), domain.MediaID(fileID), widths)
+	}
+
+	resp := domain.MediaSrcsetResponse{
+		ID:       fileID,
+		Srcset:   "",
+		Variants: make([]domain.MediaVariantResponse, 0, len(widths)),
+	}
+
+	candidates := make([]string, 0, len(widths))
+
+	for _, width := range widths {
+		variantURL := ht.variantURL(fileID, width)
+
+		resp.Variants = append(resp.Variants, domain.MediaVariantResponse{
+			Width:  width,
+			Height: 0,
+			URL:    variantURL,
+		})
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variantURL, width))
+	}
+
+	resp.Srcset = strings.Join(candidates, ", ")
+
+	// The srcset covers the requested widths and signatures, the query the response format
+	if http_.NotModified(w, r, http_.RevisionETag(meta.Revision(), r.URL.RawQuery, resp.Srcset)) ||
+		http_.NotModifiedSince(w, r, meta.ModifiedTime()) {
+		return nil
+	}
+
+	if r.URL.Query().Get(ht.cfg.URLFormatParam) == srcsetFormatHTML {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if _, err := w.Write([]byte(resp.Srcset)); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// variantURL returns the download URL of the given media resized to width.
+// If a transform secret is configured, the URL is signed until signedURLExpiry.
+func (ht *HTTPTransport) variantURL(mediaID string, width int) string {
+	if ht.cfg.TransformSecret != "" {
+		return ht.shareURL(mediaID, width, ht.signedURLExpiry(ht.clock.Now()))
+	}
+
+	return "/media/" + url.PathEscape(mediaID) + "?" + url.Values{ht.cfg.URLWidthParam: {strconv.Itoa(width)}}.Encode()
+}
+
+// signedURLExpiry returns the expiry of URLs signed at now, in Unix seconds: the end of the
+// SignedURLTTL period following the current one.
+func (ht *HTTPTransport) signedURLExpiry(now time.Time) int64 {
+	period := max(ht.cfg.SignedURLTTL, 1)
+
+	return (now.Unix()/period + 2) * period //nolint:mnd // end of the following period
+}
+
+// parseWidths parses a comma-separated list of positive widths.
+// Duplicates are removed and the result is sorted in ascending order.
+func parseWidths(widthsStr string, maxWidths int) ([]int, error) {
+	if strings.TrimSpace(widthsStr) == "" {
+		return nil, ErrNoWidths
+	}
+
+	parts := strings.Split(widthsStr, ",")
+	widths := make([]int, 0, len(parts))
+
+	for _, part := range parts {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidWidth, part)
+		}
+
+		widths = append(widths, width)
+	}
+
+	slices.Sort(widths)
+	widths = slices.Compact(widths)
+
+	if maxWidths > 0 && len(widths) > maxWidths {
+		return nil, fmt.Errorf("%w: %d exceeds %d", ErrTooManyWidths, len(widths), maxWidths)
+	}
+
+	return widths, nil
+}
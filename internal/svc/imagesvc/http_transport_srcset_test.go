@@ -0,0 +1,170 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleSrcset(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	stored, err := imageSvc.Store(context_.WithUsername(context.Background(), "alice"),
+		domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 40, 20, true), domain.MediaMeta{
+			Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+		}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	mediaID := stored.ID().String()
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:    "media_id",
+		URLWidthParam:     "width",
+		URLWidthsParam:    "widths",
+		URLFormatParam:    "format",
+		URLSignatureParam: "sig",
+		URLExpiresParam:   "expires",
+		TransformSecret:   "secret",
+		SignedURLTTL:      600,
+		SrcsetMaxWidths:   3,
+		SrcsetPrewarm:     true,
+	})
+
+	srcset := func(username, query string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/media/"+mediaID+"/srcset?"+query, nil).
+			WithContext(context_.WithUsername(context.Background(), username))
+		req.SetPathValue("media_id", mediaID)
+
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		rec := httptest.NewRecorder()
+		ht.HandleSrcset(rec, req)
+
+		return rec
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		rec := srcset("alice", "widths=20,10,20", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+
+		var resp domain.MediaSrcsetResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+
+		if len(resp.Variants) != 2 || resp.Variants[0].Width != 10 || resp.Variants[1].Width != 20 {
+			t.Fatalf("variants = %+v, want widths 10 and 20", resp.Variants)
+		}
+
+		for _, variant := range resp.Variants {
+			if !strings.Contains(resp.Srcset, variant.URL+" "+strconv.Itoa(variant.Width)+"w") {
+				t.Errorf("srcset %q does not list %q", resp.Srcset, variant.URL)
+			}
+
+			parsed, err := url.Parse(variant.URL)
+			if err != nil {
+				t.Fatalf("parse URL: %v", err)
+			}
+
+			// Signed URLs expire after one to two periods
+			expiresAt, err := strconv.ParseInt(parsed.Query().Get("expires"), 10, 64)
+			if ttl := expiresAt - time.Now().Unix(); err != nil || ttl < 600-5 || ttl > 1200 {
+				t.Errorf("URL %q expires in %d s, want 600 to 1200 s", variant.URL, ttl)
+			}
+
+			// Signed URLs are downloaded without authentication
+			req := httptest.NewRequest(http.MethodGet, variant.URL, nil)
+			req.SetPathValue("media_id", mediaID)
+
+			downloaded := httptest.NewRecorder()
+			ht.HandleDownload(downloaded, req)
+
+			if downloaded.Code != http.StatusOK {
+				t.Fatalf("download status = %d, want %d", downloaded.Code, http.StatusOK)
+			}
+
+			config, _, err := image.DecodeConfig(downloaded.Body)
+			if err != nil {
+				t.Fatalf("decode download: %v", err)
+			}
+
+			if config.Width != variant.Width {
+				t.Errorf("width = %d, want %d", config.Width, variant.Width)
+			}
+		}
+
+		// Responses are revalidated by their ETag
+		notModified := srcset("alice", "widths=20,10,20", http.Header{"If-None-Match": {rec.Header().Get("ETag")}})
+		if notModified.Code != http.StatusNotModified {
+			t.Errorf("revalidation status = %d, want %d", notModified.Code, http.StatusNotModified)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		t.Parallel()
+
+		rec := srcset("alice", "widths=10&format=html", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+
+		if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+			t.Errorf("Content-Type = %q, want text/plain", got)
+		}
+
+		if got := rec.Body.String(); !strings.HasPrefix(got, "/media/"+mediaID+"?") || !strings.HasSuffix(got, " 10w") {
+			t.Errorf("srcset = %q, want a single candidate of width 10", got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name       string
+			username   string
+			query      string
+			wantStatus int
+		}{
+			{name: "no widths", username: "alice", query: "", wantStatus: http.StatusBadRequest},
+			{name: "invalid width", username: "alice", query: "widths=10,abc", wantStatus: http.StatusBadRequest},
+			{name: "negative width", username: "alice", query: "widths=-10", wantStatus: http.StatusBadRequest},
+			{name: "too many widths", username: "alice", query: "widths=1,2,3,4", wantStatus: http.StatusBadRequest},
+			{name: "other user", username: "bob", query: "widths=10", wantStatus: http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				if got := srcset(tt.username, tt.query, nil).Code; got != tt.wantStatus {
+					t.Errorf("status = %d, want %d", got, tt.wantStatus)
+				}
+			})
+		}
+	})
+}
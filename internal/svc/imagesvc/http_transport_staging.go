@@ -0,0 +1,272 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// ErrInsufficientStorage is returned when the staging directory lacks the free space to accept an upload.
+var ErrInsufficientStorage = domain.NewError(
+	"upload.insufficient_storage", "insufficient storage", http.StatusInsufficientStorage, true)
+
+// errFreeSpaceUnsupported is returned by freeSpace on platforms that cannot tell the free space.
+var errFreeSpaceUnsupported = errors.New("free space not supported")
+
+// stagedFilePrefix precedes the names of staged files, so the cleanup never removes other files
+// of a shared staging directory like the OS temp directory.
+const stagedFilePrefix = "imagesvc-upload-"
+
+// stagedFile is a file of a multipart upload, held in memory or written to the staging
+// directory if it exceeds the memory budget of the upload. It mirrors multipart.FileHeader,
+// and additionally carries the content hash computed while the file was staged.
+type stagedFile struct {
+	Filename string
+	Size     int64
+	Hash     string
+
+	content []byte
+	path    string
+}
+
+// Open returns a reader of the file content.
+func (f *stagedFile) Open() (io.ReadSeekCloser, error) {
+	if f.path == "" {
+		return nopSeekCloser{bytes.NewReader(f.content)}, nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("open staged file: %w", err)
+	}
+
+	return file, nil
+}
+
+// nopSeekCloser adds a no-op Close method to an io.ReadSeeker.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+// Close implements io.Closer.
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// stagedForm holds the files of a multipart upload.
+type stagedForm struct {
+	Files []*stagedFile
+}
+
+// RemoveAll removes the staged files written to the staging directory.
+func (form *stagedForm) RemoveAll() error {
+	var errs []error
+
+	for _, file := range form.Files {
+		if file.path == "" {
+			continue
+		}
+
+		if err := os.Remove(file.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("remove staged file: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// stageMultipartForm reads the files of a multipart upload. Files are kept in memory until
+// MultipartFormMaxMemory bytes are used, later files are written to the staging directory.
+// Other form fields are ignored. Returns ErrInsufficientStorage if the staging directory would
+// be left with less than UploadMinFreeSpace bytes. Staged files must be removed by RemoveAll.
+func (ht *HTTPTransport) stageMultipartForm(r *http.Request) (*stagedForm, error) {
+	if err := ht.checkStagingSpace(r.ContentLength); err != nil {
+		return nil, err
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("multipart reader: %w", err)
+	}
+
+	form := &stagedForm{Files: nil}
+	budget := ht.cfg.MultipartFormMaxMemory
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		} else if err != nil {
+			_ = form.RemoveAll()
+
+			return nil, fmt.Errorf("next part: %w", err)
+		}
+
+		if part.FileName() == "" {
+			_, _ = io.Copy(io.Discard, part)
+
+			continue
+		}
+
+		file, err := ht.stageFile(part.FileName(), part, budget)
+		if err != nil {
+			_ = form.RemoveAll()
+
+			return nil, fmt.Errorf("stage %q: %w", part.FileName(), err)
+		}
+
+		form.Files = append(form.Files, file)
+
+		if file.path == "" {
+			budget -= file.Size
+		}
+	}
+}
+
+// stageFile reads a file into memory if it fits the remaining memory budget,
+// or writes it to the staging directory otherwise. The file is hashed while it is read.
+func (ht *HTTPTransport) stageFile(filename string, content io.Reader, budget int64) (*stagedFile, error) {
+	var buf bytes.Buffer
+
+	hasher := domain.NewContentHasher()
+	content = io.TeeReader(content, hasher)
+
+	n, err := io.CopyN(&buf, content, max(budget, 0)+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	if n <= budget {
+		return &stagedFile{Filename: filename, Size: n, Hash: hasher.Hash(), content: buf.Bytes(), path: ""}, nil
+	}
+
+	dir := ht.stagingDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("mkdir all: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, stagedFilePrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("create staged file: %w", err)
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, io.MultiReader(&buf, content))
+	if err != nil {
+		_ = os.Remove(file.Name())
+
+		return nil, fmt.Errorf("write staged file: %w", err)
+	}
+
+	return &stagedFile{Filename: filename, Size: size, Hash: hasher.Hash(), content: nil, path: file.Name()}, nil
+}
+
+// checkStagingSpace returns ErrInsufficientStorage if staging an upload of the given size would
+// leave less than UploadMinFreeSpace bytes in the staging directory. Uploads of unknown size are
+// checked against the free space alone. Uploads are not checked on platforms that cannot tell
+// the free space.
+func (ht *HTTPTransport) checkStagingSpace(size int64) error {
+	if ht.cfg.UploadMinFreeSpace <= 0 {
+		return nil
+	}
+
+	free, err := freeSpace(ht.stagingDir())
+	if errors.Is(err, errFreeSpaceUnsupported) {
+		return nil
+	} else if err != nil {
+		// The directory is created on demand, so its absence is not a lack of space
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("free space: %w", err)
+	}
+
+	if free-max(size, 0) < ht.cfg.UploadMinFreeSpace {
+		return fmt.Errorf("%w: %d bytes free, %d requested", ErrInsufficientStorage, free, max(size, 0))
+	}
+
+	return nil
+}
+
+// stagingDir returns the configured staging directory, or the OS temp directory.
+func (ht *HTTPTransport) stagingDir() string {
+	if ht.cfg.UploadStagingDir != "" {
+		return ht.cfg.UploadStagingDir
+	}
+
+	return os.TempDir()
+}
+
+// RunStagingCleanup periodically removes stale staged files until the context is cancelled.
+// The interval is configured by UploadStagingCleanupInterval; returns immediately if it is 0.
+func (ht *HTTPTransport) RunStagingCleanup(ctx context.Context) {
+	if ht.cfg.UploadStagingCleanupInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(ht.cfg.UploadStagingCleanupInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = ht.CleanupStaging(ctx)
+		}
+	}
+}
+
+// CleanupStaging removes staged files older than UploadStagingMaxAge, which were left behind,
+// e.g. by a crash while an upload was processed. Returns the number of removed files.
+func (ht *HTTPTransport) CleanupStaging(ctx context.Context) (removed int, err error) {
+	dir := ht.stagingDir()
+	log := ht.log.With(logging.Group("staging", "dir", dir))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "staging cleanup failed", "error", err, "removed", removed)
+		} else {
+			log.DebugContext(ctx, "staging cleanup finished", "removed", removed)
+		}
+	}()
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("read dir: %w", err)
+	}
+
+	cutoff := time.Now().Add(-time.Duration(ht.cfg.UploadStagingMaxAge) * time.Second)
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), stagedFilePrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("remove %q: %w", entry.Name(), err)
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
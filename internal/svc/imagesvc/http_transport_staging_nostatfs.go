@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || dragonfly)
+
+package imagesvc
+
+// freeSpace is not supported by the platform.
+func freeSpace(string) (int64, error) {
+	return 0, errFreeSpaceUnsupported
+}
+
+// diskSpace is not supported by the platform.
+func diskSpace(string) (int64, int64, error) {
+	return 0, 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package imagesvc
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace returns the number of bytes available to unprivileged users on the filesystem of dir.
+func freeSpace(dir string) (int64, error) {
+	_, free, err := diskSpace(dir)
+
+	return free, err
+}
+
+// diskSpace returns the size of the filesystem of dir and the number of bytes available to
+// unprivileged users on it.
+func diskSpace(dir string) (total, free int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, fmt.Errorf("statfs: %w", err)
+	}
+
+	//nolint:gosec,unconvert // Block counts and sizes are far below the limits of int64, their types vary by platform
+	return int64(stat.Blocks) * int64(stat.Bsize), int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,67 @@
+package imagesvc_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_CleanupStaging(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stale := time.Now().Add(-2 * time.Hour)
+
+	files := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"imagesvc-upload-stale", stale},
+		{"imagesvc-upload-fresh", time.Now()},
+		{"other-stale", stale},
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, file.modTime, file.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ht := imagesvc.NewHTTPTransport(nil, nil, imagesvc.HTTPTransportConfig{
+		UploadStagingDir:    dir,
+		UploadStagingMaxAge: 3600,
+	})
+
+	removed, err := ht.CleanupStaging(context.Background())
+	if err != nil {
+		t.Fatalf("CleanupStaging() error = %v", err)
+	}
+
+	if removed != 1 {
+		t.Errorf("CleanupStaging() removed = %d, want 1", removed)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	if want := []string{"imagesvc-upload-fresh", "other-stale"}; !slices.Equal(names, want) {
+		t.Errorf("remaining files = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,145 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// StatusSources holds the state reported by GET /admin/status that the transport does not own.
+type StatusSources struct {
+	StorageDir string                   // Directory of the blob storage, not reported if empty
+	Health     func() map[string]string // Status of the dependencies by name, e.g. startup.Orchestrator.Health
+	Config     map[string]any           // Configuration highlights of other components, never secrets
+}
+
+// SetStatusSources sets the state reported by GET /admin/status besides that of the transport.
+func (ht *HTTPTransport) SetStatusSources(sources StatusSources) {
+	ht.status = sources
+}
+
+// HandleAdminStatus responds with a snapshot of the state of the service: the usage of the
+// storage and staging filesystems, the cache statistics, the number of active uploads, resizes
+// and pending reprocessing, the health of the dependencies, the build and the configuration highlights.
+// Must be served behind http_.RequireRole restricting it to domain.RoleAdmin.
+func (ht *HTTPTransport) HandleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleAdminStatus(w, r)
+}
+
+func (ht *HTTPTransport) handleAdminStatus(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "admin status failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "admin status served")
+		}
+	}(r.Context())
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, ht.adminStatus()); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// adminStatus assembles the snapshot served by GET /admin/status.
+func (ht *HTTPTransport) adminStatus() domain.AdminStatusResponse {
+	status := domain.AdminStatusResponse{
+		Build:   buildStatus(),
+		Storage: make([]domain.AdminStatusVolume, 0, 2), //nolint:mnd // storage and staging
+		Caches: map[string]domain.CacheStats{
+			"images":    ht.imageSvc.CacheStats(),
+			"responses": ht.cache.Stats(),
+		},
+		Queues: map[string]int{
+			"uploads":   ht.uploadLimiter.Total(),
+			"resizes":   ht.resizeLimiter.Total(),
+			"reprocess": 0,
+		},
+		Health: map[string]string{},
+		Config: map[string]any{
+			"maxUploadSize":        ht.imageSvc.MaxSize(),
+			"maxConcurrentUploads": ht.cfg.MaxConcurrentUploads,
+			"maxConcurrentResizes": ht.cfg.MaxConcurrentResizes,
+			"downloadRateLimit":    ht.cfg.DownloadRateLimit,
+			"downloadCap":          ht.imageSvc.DownloadCap(),
+			"uploadMinFreeSpace":   ht.cfg.UploadMinFreeSpace,
+			"galleryEnabled":       ht.cfg.GalleryEnabled,
+			"signedDownloads":      ht.cfg.TransformSecret != "",
+			"audience":             ht.cfg.Audience,
+			"requiredScopes":       ht.cfg.RequiredScopes,
+		},
+	}
+
+	if ht.status.StorageDir != "" {
+		status.Storage = append(status.Storage, volumeStatus("storage", ht.status.StorageDir))
+	}
+
+	status.Storage = append(status.Storage, volumeStatus("staging", ht.stagingDir()))
+
+	if reprocess, ok := ht.reprocess.snapshot(); ok && reprocess.Running {
+		status.Queues["reprocess"] = max(reprocess.Total-reprocess.Processed, 0)
+	}
+
+	if ht.status.Health != nil {
+		status.Health = ht.status.Health()
+	}
+
+	maps.Copy(status.Config, ht.status.Config)
+
+	return status
+}
+
+// volumeStatus returns the usage of the filesystem holding dir.
+func volumeStatus(name, dir string) domain.AdminStatusVolume {
+	volume := domain.AdminStatusVolume{Name: name, Dir: dir, TotalBytes: 0, FreeBytes: 0, UsedBytes: 0, Error: ""}
+
+	total, free, err := diskSpace(dir)
+	if err != nil {
+		if errors.Is(err, errFreeSpaceUnsupported) {
+			volume.Error = "unsupported"
+		} else {
+			volume.Error = err.Error()
+		}
+
+		return volume
+	}
+
+	volume.TotalBytes, volume.FreeBytes, volume.UsedBytes = total, free, max(total-free, 0)
+
+	return volume
+}
+
+// buildStatus returns the build information embedded in the binary.
+func buildStatus() domain.AdminStatusBuild {
+	build := domain.AdminStatusBuild{GoVersion: "", Version: "", Revision: "", Time: "", Modified: false}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+
+	build.GoVersion, build.Version = info.GoVersion, info.Main.Version
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+
+	return build
+}
@@ -0,0 +1,110 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestHTTPTransport_HandleAdminStatus(t *testing.T) {
+	t.Parallel()
+
+	storageDir := t.TempDir()
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: storageDir})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	responseCache, err := http_.NewResponseCache(http_.ResponseCacheConfig{TTLs: "GET /media/timeline=30", MaxEntries: 10},
+		[]string{"GET /media/timeline"})
+	if err != nil {
+		t.Fatalf("new response cache: %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:       "media_id",
+		MaxConcurrentUploads: 2,
+		UploadStagingDir:     t.TempDir(),
+		TransformSecret:      "secret",
+	})
+	ht.SetResponseCache(responseCache)
+	ht.SetStatusSources(imagesvc.StatusSources{
+		StorageDir: storageDir,
+		Health:     func() map[string]string { return map[string]string{"auth": "ok", "storage": "ok"} },
+		Config:     map[string]any{"authMode": "local"},
+	})
+
+	// Two lookups of the timeline, the second served from the cache
+	timeline := responseCache.Handle("GET /media/timeline", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("timeline"))
+	}))
+	for range 2 {
+		timeline.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/media/timeline", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	ht.HandleAdminStatus(rec, httptest.NewRequest(http.MethodGet, "/admin/status", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp domain.AdminStatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if resp.Build.GoVersion == "" {
+		t.Errorf("build = %+v, want go version", resp.Build)
+	}
+
+	if len(resp.Storage) != 2 || resp.Storage[0].Name != "storage" || resp.Storage[0].Dir != storageDir {
+		t.Fatalf("storage = %+v, want storage and staging volumes", resp.Storage)
+	}
+
+	for _, volume := range resp.Storage {
+		if volume.Error == "" && (volume.TotalBytes <= 0 || volume.UsedBytes != volume.TotalBytes-volume.FreeBytes) {
+			t.Errorf("volume = %+v, want consistent usage", volume)
+		}
+	}
+
+	if want := domain.NewCacheStats(1, 10, 1, 1); resp.Caches["responses"] != want {
+		t.Errorf("response cache = %+v, want %+v", resp.Caches["responses"], want)
+	}
+
+	if _, ok := resp.Caches["images"]; !ok {
+		t.Errorf("caches = %+v, want images", resp.Caches)
+	}
+
+	if resp.Queues["uploads"] != 0 || resp.Queues["reprocess"] != 0 {
+		t.Errorf("queues = %+v, want idle", resp.Queues)
+	}
+
+	if resp.Health["auth"] != "ok" {
+		t.Errorf("health = %+v, want auth ok", resp.Health)
+	}
+
+	if resp.Config["authMode"] != "local" || resp.Config["signedDownloads"] != true {
+		t.Errorf("config = %+v, want auth mode and signed downloads", resp.Config)
+	}
+
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("response leaks the transform secret: %s", rec.Body)
+	}
+}
@@ -0,0 +1,133 @@
+package imagesvc
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// Groupings of the timeline.
+const (
+	TimelineGroupDay   = "day"
+	TimelineGroupMonth = "month"
+)
+
+const (
+	// timelineMonthLayout is the layout of the months grouping the timeline.
+	timelineMonthLayout = "2006-01"
+	// timelineTimeLayout is the layout of times ordering the timeline, without offset.
+	timelineTimeLayout = "2006-01-02T15:04:05"
+)
+
+// ErrInvalidTimelineGroup is returned when the grouping of a timeline request is neither "day" nor "month".
+var ErrInvalidTimelineGroup = domain.NewError(
+	"media.invalid_timeline_group", "invalid timeline group", http.StatusBadRequest, false)
+
+// HandleTimeline lists the authenticated user's media grouped by the day or month they were
+// taken, most recent first, with the count and a cover thumbnail of each period. The time taken
+// is read from the EXIF metadata extracted on upload, falling back to the time the media was stored.
+func (ht *HTTPTransport) HandleTimeline(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleTimeline(w, r)
+}
+
+func (ht *HTTPTransport) handleTimeline(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media timeline failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media timeline served")
+		}
+	}(r.Context())
+
+	group := cmp.Or(r.URL.Query().Get(ht.cfg.URLGroupParam), TimelineGroupDay)
+	if group != TimelineGroupDay && group != TimelineGroupMonth {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("%w: %q", ErrInvalidTimelineGroup, group)
+	}
+
+	metas, err := ht.imageSvc.List(r.Context())
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("list: %w", err)
+	}
+
+	resp := domain.MediaTimelineResponse{
+		Group:  group,
+		Groups: ht.timelineGroups(metas, group),
+	}
+
+	log.DebugContext(r.Context(), "media timeline built", "group", group, "periods", len(resp.Groups))
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// timelineGroups groups media by the period they were taken in, most recent first.
+// Media taken at an unknown time are grouped last.
+func (ht *HTTPTransport) timelineGroups(metas []domain.MediaMeta, group string) []domain.MediaTimelineGroup {
+	slices.SortFunc(metas, func(a, b domain.MediaMeta) int {
+		return cmp.Or(cmp.Compare(timelineTime(b), timelineTime(a)), cmp.Compare(a.ID, b.ID))
+	})
+
+	groups := make([]domain.MediaTimelineGroup, 0)
+
+	for _, meta := range metas {
+		period := timelinePeriod(meta, group)
+
+		if len(groups) == 0 || groups[len(groups)-1].Period != period {
+			groups = append(groups, domain.MediaTimelineGroup{
+				Period:   period,
+				Count:    0,
+				CoverID:  meta.ID.String(),
+				CoverURL: ht.variantURL(meta.ID.String(), ht.cfg.TimelineCoverWidth),
+				IDs:      nil,
+			})
+		}
+
+		current := &groups[len(groups)-1]
+		current.Count++
+		current.IDs = append(current.IDs, meta.ID.String())
+	}
+
+	return groups
+}
+
+// timelinePeriod returns the day or month the media was taken, or an empty string if unknown.
+func timelinePeriod(meta domain.MediaMeta, group string) string {
+	date := meta.TakenDate()
+	if group == TimelineGroupMonth && date != "" {
+		return date[:len(timelineMonthLayout)]
+	}
+
+	return date
+}
+
+// timelineTime returns a sortable representation of the time the media was taken, in the
+// local time of the camera if known, or the time it was stored in UTC.
+func timelineTime(meta domain.MediaMeta) string {
+	date := meta.TakenDate()
+	if date == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(meta.TakenAt, date) {
+		return meta.TakenAt[:min(len(meta.TakenAt), len(timelineTimeLayout))]
+	}
+
+	return time.UnixMilli(meta.Modified).UTC().Format(timelineTimeLayout)
+}
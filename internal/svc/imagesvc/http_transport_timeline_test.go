@@ -0,0 +1,147 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestHTTPTransport_HandleTimeline(t *testing.T) {
+	t.Parallel()
+
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	cfg := testConfig("")
+	cfg.ExifExtract = true
+
+	imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+	data := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 16, true)
+
+	uploads := map[string][]byte{
+		"taken.jpg":  slices.Concat(data[:2], buildTestExif(), data[2:]),
+		"first.jpg":  data,
+		"second.jpg": data,
+	}
+
+	ids := make(map[string]string, len(uploads))
+
+	for filename, upload := range uploads {
+		stored, err := imageSvc.Store(ctx, domain.NewMedia(upload, domain.MediaMeta{
+			Filename: filename,
+			Owner:    "alice",
+			MIMEType: imagesvc.MIMETypeJPEG,
+		}))
+		if err != nil {
+			t.Fatalf("Store(%q) error = %v", filename, err)
+		}
+
+		ids[filename] = stored.ID().String()
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:     "media_id",
+		URLWidthParam:      "width",
+		URLGroupParam:      "group",
+		TimelineCoverWidth: 320,
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantGroups [][]string // Filenames per period
+		wantPeriod string     // Period of the last group
+	}{
+		{
+			name:       "month",
+			query:      "?group=month",
+			wantStatus: http.StatusOK,
+			wantGroups: [][]string{{"first.jpg", "second.jpg"}, {"taken.jpg"}},
+			wantPeriod: "2024-05",
+		},
+		{
+			name:       "day by default",
+			wantStatus: http.StatusOK,
+			wantGroups: [][]string{{"first.jpg", "second.jpg"}, {"taken.jpg"}},
+			wantPeriod: "2024-05-01",
+		},
+		{name: "invalid group", query: "?group=year", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			ht.HandleTimeline(rec, httptest.NewRequest(http.MethodGet, "/media/timeline"+tt.query, nil).WithContext(ctx))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp domain.MediaTimelineResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			if len(resp.Groups) != len(tt.wantGroups) {
+				t.Fatalf("groups = %+v, want %d groups", resp.Groups, len(tt.wantGroups))
+			}
+
+			if now := time.Now().UTC().Format(time.DateOnly); resp.Groups[0].Period[:7] != now[:7] {
+				t.Errorf("period of uploads = %q, want %q", resp.Groups[0].Period, now)
+			}
+
+			if last := resp.Groups[len(resp.Groups)-1]; last.Period != tt.wantPeriod {
+				t.Errorf("period of taken = %q, want %q", last.Period, tt.wantPeriod)
+			}
+
+			for i, group := range resp.Groups {
+				want := make([]string, 0, len(tt.wantGroups[i]))
+				for _, filename := range tt.wantGroups[i] {
+					want = append(want, ids[filename])
+				}
+
+				if group.Count != len(want) || !sameElements(group.IDs, want) {
+					t.Errorf("group %q = %d %v, want %v", group.Period, group.Count, group.IDs, want)
+				}
+
+				if group.CoverID != group.IDs[0] || group.CoverURL == "" {
+					t.Errorf("group %q cover = %q %q, want first media", group.Period, group.CoverID, group.CoverURL)
+				}
+			}
+		})
+	}
+}
+
+func sameElements(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,206 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+var (
+	// ErrAmbiguousTransform is returned when a request specifies a transform spec along with a
+	// width, format, quality, rotation or flip.
+	ErrAmbiguousTransform = domain.NewError(
+		"transform.ambiguous", "transform spec cannot be combined with transform parameters", http.StatusBadRequest, false)
+	// ErrSignatureRequired is returned when an unauthenticated request is not signed.
+	ErrSignatureRequired = domain.NewError(
+		"transform.signature_required", "signature required", http.StatusUnauthorized, false)
+	// ErrInvalidSignature is returned when the signature of a request does not match its transform spec.
+	ErrInvalidSignature = domain.NewError(
+		"transform.invalid_signature", "invalid signature", http.StatusForbidden, false)
+	// ErrSignatureExpired is returned when a signed share URL is used after its expiry.
+	ErrSignatureExpired = domain.NewError(
+		"transform.signature_expired", "signature expired", http.StatusForbidden, false)
+	// ErrTransformDisabled is returned when a request specifies a transform spec while the
+	// transform_dsl feature flag is disabled.
+	ErrTransformDisabled = domain.NewError(
+		"transform.disabled", "transform specs are disabled", http.StatusForbidden, false)
+)
+
+// FlagTransformDSL toggles transform specs in download requests.
+// Without it, downloads only accept the width parameter.
+//
+//nolint:gochecknoglobals
+var FlagTransformDSL = featureflags.Flag{Name: "transform_dsl", Default: true}
+
+// HandleTransformDocs describes the transform spec language accepted by download requests.
+// Responds with 304 Not Modified if the request's If-None-Match header matches the ETag of the docs.
+func (ht *HTTPTransport) HandleTransformDocs(w http.ResponseWriter, r *http.Request) {
+	docs := transform.Documentation(TransformFormats())
+
+	if http_.NotModified(w, r, http_.RevisionETag(fmt.Sprint(docs), r.URL.RawQuery)) {
+		return
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, docs); err != nil {
+		ht.log.ErrorContext(r.Context(), "encode transform docs failed", "error", err)
+	}
+}
+
+// parseTransformSpec reads the transform spec of a download request, either from the transform
+// spec parameter or from the width, format, quality, rotate and flip parameters.
+func (ht *HTTPTransport) parseTransformSpec(r *http.Request) (transform.Spec, error) {
+	query := r.URL.Query()
+
+	specStr := query.Get(ht.cfg.URLTransformParam)
+	if specStr == "" {
+		return ht.parseTransformParams(query)
+	}
+
+	for _, param := range ht.transformParams() {
+		if query.Get(param) != "" {
+			return transform.Spec{}, ErrAmbiguousTransform
+		}
+	}
+
+	if !ht.flags.EnabledForRequest(r, FlagTransformDSL) {
+		return transform.Spec{}, ErrTransformDisabled
+	}
+
+	spec, err := transform.Parse(specStr, TransformFormats())
+	if err != nil {
+		return transform.Spec{}, fmt.Errorf("parse spec: %w", err)
+	}
+
+	return spec, nil
+}
+
+// transformParams returns the names of the URL parameters describing a transform
+// as an alternative to a transform spec.
+func (ht *HTTPTransport) transformParams() []string {
+	return []string{
+		ht.cfg.URLWidthParam, ht.cfg.URLFormatParam, ht.cfg.URLQualityParam, ht.cfg.URLRotateParam, ht.cfg.URLFlipParam,
+	}
+}
+
+// parseTransformParams reads the transform of a download request without a transform spec
+// from its width, format, quality, rotate and flip parameters.
+func (ht *HTTPTransport) parseTransformParams(query url.Values) (spec transform.Spec, err error) {
+	if widthStr := query.Get(ht.cfg.URLWidthParam); widthStr != "" {
+		var width int64
+
+		if width, err = strconv.ParseInt(widthStr, 10, 64); err != nil {
+			return transform.Spec{}, fmt.Errorf("parse width: %w", err)
+		} else if width < 0 || width > transform.MaxDimension {
+			return transform.Spec{}, fmt.Errorf("%w: %d", ErrInvalidWidth, width)
+		}
+
+		spec.Width = int(width)
+	}
+
+	if formatStr := query.Get(ht.cfg.URLFormatParam); formatStr != "" {
+		if spec.Format, err = transform.ParseFormat(formatStr, TransformFormats()); err != nil {
+			return transform.Spec{}, fmt.Errorf("parse format: %w", err)
+		}
+	}
+
+	if qualityStr := query.Get(ht.cfg.URLQualityParam); qualityStr != "" {
+		if spec.Quality, err = transform.ParseQuality(qualityStr); err != nil {
+			return transform.Spec{}, fmt.Errorf("parse quality: %w", err)
+		}
+	}
+
+	if rotateStr := query.Get(ht.cfg.URLRotateParam); rotateStr != "" {
+		if spec.Rotate, err = transform.ParseRotation(rotateStr); err != nil {
+			return transform.Spec{}, fmt.Errorf("parse rotation: %w", err)
+		}
+	}
+
+	if flipStr := query.Get(ht.cfg.URLFlipParam); flipStr != "" {
+		if spec.Flip, err = transform.ParseFlip(flipStr); err != nil {
+			return transform.Spec{}, fmt.Errorf("parse flip: %w", err)
+		}
+	}
+
+	return spec, nil
+}
+
+// negotiateFormat returns the output format of a download without an explicit format, if the
+// request's Accept header does not accept the format the image is stored in, but one it can be
+// converted to. Returns "" to keep the stored format, including if the image cannot be found,
+// which is left to the download to report.
+func (ht *HTTPTransport) negotiateFormat(ctx context.Context, r *http.Request, mediaID domain.MediaID) string {
+	if r.Header.Get("Accept") == "" {
+		return ""
+	}
+
+	meta, err := ht.imageSvc.FetchMeta(ctx, mediaID)
+	if err != nil {
+		return ""
+	}
+
+	// The stored format is preferred, so images are only converted if necessary
+	offers := []string{meta.MIMEType}
+	formats := map[string]string{}
+
+	for _, format := range imageNegotiableFormats {
+		offers = append(offers, imageFormatTypes[format])
+		formats[imageFormatTypes[format]] = format
+	}
+
+	negotiated := http_.NegotiateContentType(r, offers...)
+	if negotiated == meta.MIMEType {
+		return ""
+	}
+
+	return formats[negotiated]
+}
+
+// authorizeTransform checks the signature of a download request.
+// Signatures must cover an expiry and are only valid until then.
+// Signed requests are granted access to the media, regardless of the authenticated user.
+// Unsigned requests must be authenticated, unless they download the original image, which is
+// only served if it is public.
+// Returns the request context, extended by the grant if the request is signed.
+func (ht *HTTPTransport) authorizeTransform(
+	r *http.Request,
+	mediaID string,
+	spec transform.Spec,
+) (context.Context, error) {
+	ctx := r.Context()
+
+	signature := r.URL.Query().Get(ht.cfg.URLSignatureParam)
+	if signature == "" {
+		// Anonymous requests of originals are left to the media service, which serves public images
+		if username, _ := context_.UsernameFromContext(ctx); username == "" && !spec.IsIdentity() {
+			return ctx, ErrSignatureRequired
+		}
+
+		return ctx, nil
+	}
+
+	// Signatures grant access regardless of later visibility changes, so only signatures
+	// covering an expiry are accepted
+	expiresStr := r.URL.Query().Get(ht.cfg.URLExpiresParam)
+	if expiresStr == "" {
+		return ctx, fmt.Errorf("%w: no expiry", ErrInvalidSignature)
+	}
+
+	expiresAt, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || !transform.VerifyUntil([]byte(ht.cfg.TransformSecret), mediaID, spec, expiresAt, signature) {
+		return ctx, ErrInvalidSignature
+	}
+
+	if ht.clock.Now().Unix() > expiresAt {
+		return ctx, ErrSignatureExpired
+	}
+
+	return context_.WithGrant(ctx, mediaID), nil
+}
@@ -0,0 +1,96 @@
+package imagesvc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleDownloadFormat(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam:    "media_id",
+		URLWidthParam:     "width",
+		URLFormatParam:    "format",
+		URLQualityParam:   "quality",
+		URLRotateParam:    "rotate",
+		URLFlipParam:      "flip",
+		URLTransformParam: "t",
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		wantStatus int
+		wantType   string
+	}{
+		{name: "original", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG},
+		{name: "format", query: "?width=8&format=jpg", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypeJPEG},
+		{name: "own format", query: "?format=png", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG},
+		{name: "accepted", accept: "image/*", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG},
+		{name: "negotiated", accept: "image/webp, image/tiff;q=0.5, image/jpeg", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypeJPEG},
+		{name: "format overrides accept", query: "?format=bmp", accept: "image/jpeg", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypeBMP},
+		{name: "unsupported format", query: "?format=webp", wantStatus: http.StatusBadRequest},
+		{name: "format and spec", query: "?format=png&t=w:8", wantStatus: http.StatusBadRequest},
+		{name: "quality", query: "?format=jpeg&quality=40", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypeJPEG},
+		{name: "invalid quality", query: "?format=jpeg&quality=0", wantStatus: http.StatusBadRequest},
+		{name: "quality and spec", query: "?quality=40&t=w:8", wantStatus: http.StatusBadRequest},
+		{name: "rotate and flip", query: "?width=8&rotate=90&flip=h", wantStatus: http.StatusOK, wantType: imagesvc.MIMETypePNG},
+		{name: "invalid rotation", query: "?rotate=45", wantStatus: http.StatusBadRequest},
+		{name: "invalid flip", query: "?flip=x", wantStatus: http.StatusBadRequest},
+		{name: "flip and spec", query: "?flip=v&t=w:8", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+tt.query, nil).WithContext(ctx)
+			req.SetPathValue("media_id", stored.ID().String())
+
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			ht.HandleDownload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+
+			if got := http.DetectContentType(rec.Body.Bytes()); tt.wantType != imagesvc.MIMETypeTIFF && got != tt.wantType {
+				t.Errorf("detected content type = %q, want %q", got, tt.wantType)
+			}
+		})
+	}
+}
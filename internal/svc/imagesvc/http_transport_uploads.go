@@ -0,0 +1,287 @@
+package imagesvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// ErrInvalidUploadOffset is returned when a chunk is sent without a valid Upload-Offset header.
+var ErrInvalidUploadOffset = domain.NewError(
+	"upload.invalid_offset", "invalid upload offset", http.StatusBadRequest, false)
+
+// URLUploadIDParam is the URL parameter of the resumable upload routes carrying the upload session ID.
+const URLUploadIDParam = "upload_id"
+
+// uploadBodyLimit is the maximum size of a request body creating an upload session.
+const uploadBodyLimit = 1 << 10
+
+// Headers of resumable uploads.
+const (
+	headerUploadOffset  = "Upload-Offset"
+	headerUploadLength  = "Upload-Length"
+	headerUploadExpires = "Upload-Expires"
+)
+
+// HandleUploadCreate creates a resumable upload session of the authenticated user.
+// Expects a JSON body with the filename and total size of the image. Responds with the
+// session, whose URL is set as Location header.
+func (ht *HTTPTransport) HandleUploadCreate(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleUploadCreate(w, r)
+}
+
+func (ht *HTTPTransport) handleUploadCreate(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "upload create failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "upload created")
+		}
+	}(r.Context())
+
+	var req domain.MediaUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, uploadBodyLimit)).Decode(&req); err != nil {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("decode request: %w", err)
+	}
+
+	log = log.With(logging.Group("upload", "filename", req.Filename, "size", req.Size))
+
+	upload, err := ht.imageSvc.CreateUpload(r.Context(), req.Filename, req.Size)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusBadRequest))
+
+		return fmt.Errorf("create upload: %w", err)
+	}
+
+	log = log.With(logging.Group("upload", "id", upload.ID))
+
+	setUploadHeaders(w, upload)
+	w.Header().Set("Location", "/media/uploads/"+upload.ID)
+
+	if err := http_.WriteJSON(w, r, http.StatusCreated, uploadResponse(upload)); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// HandleUploadStatus reports the offset of a resumable upload session of the authenticated user
+// in the Upload-Offset header, so an interrupted upload can be resumed there.
+// Expects the upload session ID as a URL parameter.
+func (ht *HTTPTransport) HandleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleUploadStatus(w, r)
+}
+
+func (ht *HTTPTransport) handleUploadStatus(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "upload status failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "upload status served")
+		}
+	}(r.Context())
+
+	uploadID := encoding.NormalizeCrockfordB32LC(r.PathValue(URLUploadIDParam))
+	log = log.With(logging.Group("upload", "id", uploadID))
+
+	upload, err := ht.imageSvc.FetchUpload(r.Context(), uploadID)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("fetch upload: %w", err)
+	}
+
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+// HandleUploadAppend appends a chunk to a resumable upload session of the authenticated user.
+// Expects the upload session ID as a URL parameter, the offset the chunk starts at in the
+// Upload-Offset header, and the chunk as body. Responds with the new offset in the Upload-Offset
+// header, or with 409 Conflict and the current offset if the offset does not match.
+func (ht *HTTPTransport) HandleUploadAppend(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleUploadAppend(w, r)
+}
+
+func (ht *HTTPTransport) handleUploadAppend(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+	ctx := r.Context()
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "upload append failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "upload appended")
+		}
+	}()
+
+	uploadID := encoding.NormalizeCrockfordB32LC(r.PathValue(URLUploadIDParam))
+	log = log.With(logging.Group("upload", "id", uploadID))
+
+	offset, err := strconv.ParseInt(r.Header.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return fmt.Errorf("%w: %q", ErrInvalidUploadOffset, r.Header.Get(headerUploadOffset))
+	}
+
+	release, ok := ht.acquireUserSlot(ctx, r, ht.uploadLimiter)
+	if !ok {
+		w.Header().Set("Retry-After", "1")
+		http_.WriteError(w, r, http.StatusTooManyRequests)
+
+		return fmt.Errorf("upload: %w", ErrConcurrencyLimit)
+	}
+	defer release()
+
+	upload, err := ht.imageSvc.AppendUpload(ctx, uploadID, offset, r.Body)
+	if err != nil {
+		// The current offset lets the client resume after a lost chunk
+		if errors.Is(err, ErrUploadOffsetMismatch) {
+			setUploadHeaders(w, upload)
+		}
+
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("append upload: %w", err)
+	}
+
+	log = log.With(logging.Group("upload", "offset", upload.Offset, "size", upload.Size))
+
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// HandleUploadComplete stores the image received by a complete resumable upload session of the
+// authenticated user and removes the session. Expects the upload session ID as a URL parameter.
+// Responds like HandleDataUpload.
+func (ht *HTTPTransport) HandleUploadComplete(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleUploadComplete(w, r)
+}
+
+func (ht *HTTPTransport) handleUploadComplete(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+	ctx := r.Context()
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "upload complete failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "upload completed")
+		}
+	}()
+
+	uploadID := encoding.NormalizeCrockfordB32LC(r.PathValue(URLUploadIDParam))
+	log = log.With(logging.Group("upload", "id", uploadID))
+
+	release, ok := ht.acquireUserSlot(ctx, r, ht.uploadLimiter)
+	if !ok {
+		w.Header().Set("Retry-After", "1")
+		http_.WriteError(w, r, http.StatusTooManyRequests)
+
+		return fmt.Errorf("upload: %w", ErrConcurrencyLimit)
+	}
+	defer release()
+
+	meta, content, err := ht.imageSvc.AssembleUpload(ctx, uploadID)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("assemble upload: %w", err)
+	}
+
+	// The content holds the session lock, so it is closed before the session is removed
+	meta, err = storeUploaded(ctx, ht.imageSvc, meta, content, ht.flags.EnabledForRequest(r, FlagStreamingUploads))
+	_ = content.Close()
+
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusBadRequest))
+
+		return fmt.Errorf("store: %w", err)
+	}
+
+	log = log.With(logging.Group("media", "id", meta.ID.String()))
+
+	// The image is stored, a session left behind is removed once it expires
+	if err := ht.imageSvc.DeleteUpload(ctx, uploadID); err != nil {
+		log.WarnContext(ctx, "completed upload not removed", "error", err)
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, domain.MediaIDResponse{
+		ID:       meta.ID.String(),
+		Filename: meta.Filename,
+	}); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// HandleUploadCancel removes a resumable upload session of the authenticated user and its
+// received chunks. Expects the upload session ID as a URL parameter.
+func (ht *HTTPTransport) HandleUploadCancel(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleUploadCancel(w, r)
+}
+
+func (ht *HTTPTransport) handleUploadCancel(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "upload cancel failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "upload cancelled")
+		}
+	}(r.Context())
+
+	uploadID := encoding.NormalizeCrockfordB32LC(r.PathValue(URLUploadIDParam))
+	log = log.With(logging.Group("upload", "id", uploadID))
+
+	if err := ht.imageSvc.DeleteUpload(r.Context(), uploadID); err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+
+		return fmt.Errorf("delete upload: %w", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// setUploadHeaders sets the headers describing the state of an upload session.
+func setUploadHeaders(w http.ResponseWriter, upload domain.MediaUpload) {
+	w.Header().Set(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set(headerUploadLength, strconv.FormatInt(upload.Size, 10))
+	w.Header().Set(headerUploadExpires, time.Unix(upload.Expires, 0).UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// uploadResponse returns the response describing an upload session.
+func uploadResponse(upload domain.MediaUpload) domain.MediaUploadResponse {
+	return domain.MediaUploadResponse{
+		ID:        upload.ID,
+		Filename:  upload.Filename,
+		Size:      upload.Size,
+		Offset:    upload.Offset,
+		ExpiresAt: upload.Expires,
+	}
+}
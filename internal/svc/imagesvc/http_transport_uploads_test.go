@@ -0,0 +1,331 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/featureflags"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleUploads(t *testing.T) {
+	t.Parallel()
+
+	// Uploads are stored the same with and without streaming
+	tests := []struct {
+		name      string
+		overrides string
+	}{
+		{name: "streaming", overrides: ""},
+		{name: "buffered", overrides: "streaming_uploads=false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true)
+
+			cfg := testConfig("")
+			cfg.UploadSessionTTL = 3600
+			cfg.UploadChunkMaxSize = int64(len(data) - len(data)/2)
+
+			imageSvc, err := newTestImageService(t, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			flags, err := featureflags.NewStore(featureflags.Config{Overrides: tt.overrides}) //nolint:exhaustruct
+			if err != nil {
+				t.Fatalf("new feature flags: %v", err)
+			}
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{URLFileIDParam: "media_id"})
+			ht.SetFeatureFlags(flags)
+
+			var uploadID string
+
+			// request sends a request to the upload session as the given user
+			request := func(username, method, path string, body []byte, offset int64, handler http.HandlerFunc,
+			) *httptest.ResponseRecorder {
+				ctx := context_.WithUsername(context.Background(), username)
+
+				req := httptest.NewRequest(method, "/media/uploads"+path, bytes.NewReader(body)).WithContext(ctx)
+				if offset >= 0 {
+					req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+				}
+
+				req.SetPathValue(imagesvc.URLUploadIDParam, uploadID)
+
+				rec := httptest.NewRecorder()
+				handler(rec, req)
+
+				return rec
+			}
+
+			createBody := fmt.Sprintf(`{"filename": "photo.png", "size": %d}`, len(data))
+
+			rec := request("alice", http.MethodPost, "", []byte(createBody), -1, ht.HandleUploadCreate)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("create: status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+
+			var upload domain.MediaUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &upload); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if upload.Size != int64(len(data)) || upload.Offset != 0 || upload.ExpiresAt == 0 {
+				t.Errorf("create: response = %+v, want size %d at offset 0", upload, len(data))
+			}
+
+			if got, want := rec.Header().Get("Location"), "/media/uploads/"+upload.ID; got != want {
+				t.Errorf("create: Location = %q, want %q", got, want)
+			}
+
+			uploadID = upload.ID
+			half := int64(len(data) / 2)
+			path := "/" + upload.ID
+
+			steps := []struct {
+				name       string
+				username   string
+				method     string
+				path       string
+				body       []byte
+				offset     int64
+				handler    http.HandlerFunc
+				wantStatus int
+				wantOffset string
+			}{
+				{
+					name: "chunk too large", username: "alice", method: http.MethodPatch, path: path, body: data,
+					offset: 0, handler: ht.HandleUploadAppend, wantStatus: http.StatusRequestEntityTooLarge,
+				},
+				{
+					name: "first chunk", username: "alice", method: http.MethodPatch, path: path, body: data[:half],
+					offset: 0, handler: ht.HandleUploadAppend, wantStatus: http.StatusNoContent,
+					wantOffset: strconv.FormatInt(half, 10),
+				},
+				{
+					name: "status", username: "alice", method: http.MethodHead, path: path, offset: -1,
+					handler: ht.HandleUploadStatus, wantStatus: http.StatusOK, wantOffset: strconv.FormatInt(half, 10),
+				},
+				{
+					name: "other user", username: "bob", method: http.MethodHead, path: path, offset: -1,
+					handler: ht.HandleUploadStatus, wantStatus: http.StatusNotFound,
+				},
+				{
+					name: "incomplete", username: "alice", method: http.MethodPost, path: path + "/complete", offset: -1,
+					handler: ht.HandleUploadComplete, wantStatus: http.StatusConflict,
+				},
+				{
+					name: "missing offset", username: "alice", method: http.MethodPatch, path: path, body: data[half:],
+					offset: -1, handler: ht.HandleUploadAppend, wantStatus: http.StatusBadRequest,
+				},
+				{
+					name: "repeated chunk", username: "alice", method: http.MethodPatch, path: path, body: data[:half],
+					offset: 0, handler: ht.HandleUploadAppend, wantStatus: http.StatusConflict,
+					wantOffset: strconv.FormatInt(half, 10),
+				},
+				{
+					name: "oversized chunk", username: "alice", method: http.MethodPatch, path: path, body: data,
+					offset: half, handler: ht.HandleUploadAppend, wantStatus: http.StatusRequestEntityTooLarge,
+				},
+				{
+					name: "last chunk", username: "alice", method: http.MethodPatch, path: path, body: data[half:],
+					offset: half, handler: ht.HandleUploadAppend, wantStatus: http.StatusNoContent,
+					wantOffset: strconv.Itoa(len(data)),
+				},
+				{
+					name: "complete", username: "alice", method: http.MethodPost, path: path + "/complete", offset: -1,
+					handler: ht.HandleUploadComplete, wantStatus: http.StatusOK,
+				},
+				{
+					name: "completed", username: "alice", method: http.MethodHead, path: path, offset: -1,
+					handler: ht.HandleUploadStatus, wantStatus: http.StatusNotFound,
+				},
+			}
+
+			// The steps append to the same upload session, so they run in order
+			for _, step := range steps {
+				rec := request(step.username, step.method, step.path, step.body, step.offset, step.handler)
+				if rec.Code != step.wantStatus {
+					t.Fatalf("%s: status = %d, want %d: %s", step.name, rec.Code, step.wantStatus, rec.Body)
+				}
+
+				if got := rec.Header().Get("Upload-Offset"); step.wantOffset != "" && got != step.wantOffset {
+					t.Errorf("%s: Upload-Offset = %q, want %q", step.name, got, step.wantOffset)
+				}
+
+				if step.name != "complete" {
+					continue
+				}
+
+				var resp domain.MediaIDResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+
+				ctx := context_.WithUsername(context.Background(), "alice")
+
+				stored, err := imageSvc.Fetch(ctx, domain.MediaID(resp.ID), 0)
+				if err != nil {
+					t.Fatalf("Fetch() error = %v", err)
+				}
+
+				if !bytes.Equal(stored.Bytes(), data) || stored.Meta().Filename != "photo.png" {
+					t.Errorf("stored image %q differs from the uploaded image", stored.Meta().Filename)
+				}
+			}
+		})
+	}
+}
+
+func TestBlobImageService_ExpireUploads(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		ttl         int64
+		wantExpired int
+		wantErr     error
+	}{
+		{name: "active", ttl: 3600, wantExpired: 0, wantErr: nil},
+		{name: "stale", ttl: -1, wantExpired: 1, wantErr: imagesvc.ErrUploadNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig("")
+			cfg.UploadSessionTTL = tt.ttl
+
+			imageSvc, err := newTestImageService(t, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			upload, err := imageSvc.CreateUpload(ctx, "photo.png", 1024)
+			if err != nil {
+				t.Fatalf("CreateUpload() error = %v", err)
+			}
+
+			result, err := imageSvc.ExpireUploads(ctx)
+			if err != nil {
+				t.Fatalf("ExpireUploads() error = %v", err)
+			}
+
+			if result.Expired != tt.wantExpired {
+				t.Errorf("ExpireUploads() expired = %d, want %d", result.Expired, tt.wantExpired)
+			}
+
+			if _, err := imageSvc.FetchUpload(ctx, upload.ID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("FetchUpload() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testAuthClient validates the tokens it has claims of.
+type testAuthClient struct {
+	claims map[string]domain.AuthToken
+}
+
+func (c *testAuthClient) Validate(ctx context.Context, token string) (string, bool, error) {
+	claims, ok, err := c.ValidateClaims(ctx, token)
+
+	return claims.Username, ok, err
+}
+
+func (c *testAuthClient) ValidateClaims(_ context.Context, token string) (domain.AuthToken, bool, error) {
+	claims, ok := c.claims[token]
+
+	return claims, ok, nil
+}
+
+func TestHTTPTransport_ServeHTTPUploadStatus(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig("")
+	cfg.UploadSessionTTL = 3600
+
+	imageSvc, err := newTestImageService(t, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	stored, err := imageSvc.Store(context_.WithUsername(context.Background(), "alice"),
+		domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 16, 16, true), domain.MediaMeta{
+			Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+		}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	authClient := &testAuthClient{claims: map[string]domain.AuthToken{"alice": {Username: "alice"}}}
+	ht := imagesvc.NewHTTPTransport(imageSvc, authClient, imagesvc.HTTPTransportConfig{URLFileIDParam: "media_id"})
+
+	// request sends a request through all routes of the transport as alice
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer alice")
+
+		rec := httptest.NewRecorder()
+		ht.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/media/uploads", `{"filename": "upload.png", "size": 10}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	var upload domain.MediaUploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &upload); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantOffset string
+	}{
+		{name: "upload status", method: http.MethodHead, path: "/media/uploads/" + upload.ID,
+			wantStatus: http.StatusOK, wantOffset: "0"},
+		{name: "unknown upload", method: http.MethodHead, path: "/media/uploads/unknown", wantStatus: http.StatusNotFound},
+		{name: "download head", method: http.MethodHead, path: "/media/" + stored.ID().String(), wantStatus: http.StatusOK},
+		{name: "meta", method: http.MethodGet, path: "/media/" + stored.ID().String() + "/meta", wantStatus: http.StatusOK},
+		{name: "meta head", method: http.MethodHead, path: "/media/" + stored.ID().String() + "/meta", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := request(tt.method, tt.path, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if got := rec.Header().Get("Upload-Offset"); got != tt.wantOffset {
+				t.Errorf("Upload-Offset = %q, want %q", got, tt.wantOffset)
+			}
+		})
+	}
+}
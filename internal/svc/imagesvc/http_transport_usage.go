@@ -0,0 +1,119 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/tokenbucket"
+)
+
+// downloadRateIdleTimeout is the duration after which the bandwidth bucket of an idle user is dropped.
+const downloadRateIdleTimeout = 10 * time.Minute
+
+// HandleUsage reports the download usage of the authenticated user in the current period.
+func (ht *HTTPTransport) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleUsage(w, r)
+}
+
+func (ht *HTTPTransport) handleUsage(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media usage failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media usage served")
+		}
+	}(r.Context())
+
+	username, ok := context_.UsernameFromContext(r.Context())
+	if !ok || username == "" {
+		http_.WriteError(w, r, http.StatusUnauthorized)
+
+		return domain.ErrNoAuthToken
+	}
+
+	usage, err := ht.imageSvc.Usage(r.Context(), username)
+	if err != nil {
+		http_.WriteError(w, r, http.StatusInternalServerError)
+
+		return fmt.Errorf("usage: %w", err)
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, domain.MediaUsageResponse{
+		Period:        usage.Period,
+		Downloads:     usage.Downloads,
+		DownloadBytes: usage.DownloadBytes,
+		DownloadCap:   ht.imageSvc.DownloadCap(),
+	}); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// throttle returns a writer limiting writes to w to the download bandwidth of the user.
+// Returns w if the bandwidth is unlimited.
+func (ht *HTTPTransport) throttle(ctx context.Context, w http.ResponseWriter, username string) io.Writer {
+	if ht.cfg.DownloadRateLimit <= 0 {
+		return w
+	}
+
+	return &throttledWriter{
+		ctx:          ctx,
+		w:            w,
+		rc:           http.NewResponseController(w),
+		writeTimeout: time.Duration(ht.cfg.WriteTimeout) * time.Second,
+		bucket:       ht.downloadRates.Get(username, time.Now()),
+		chunk:        int(max(ht.cfg.DownloadRateBurst, 1)),
+	}
+}
+
+// throttledWriter writes in chunks of at most the bucket's burst size,
+// waiting for the bucket to hold enough tokens before each chunk.
+// The bucket is shared by all concurrent downloads of a user.
+// The write deadline is extended for every chunk, so throttled downloads
+// are not cut off by the server's write timeout.
+type throttledWriter struct {
+	ctx          context.Context //nolint:containedctx
+	w            io.Writer
+	rc           *http.ResponseController
+	writeTimeout time.Duration
+	bucket       *tokenbucket.Bucket
+	chunk        int
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	var written int
+
+	for len(p) > 0 {
+		n := min(len(p), tw.chunk)
+
+		if err := tw.bucket.Wait(tw.ctx, float64(n)); err != nil {
+			return written, fmt.Errorf("throttle: %w", err)
+		}
+
+		if tw.writeTimeout > 0 {
+			// Not all response writers support deadlines, in which case the server's timeout applies
+			_ = tw.rc.SetWriteDeadline(time.Now().Add(tw.writeTimeout))
+		}
+
+		n, err := tw.w.Write(p[:n])
+		written += n
+
+		if err != nil {
+			return written, fmt.Errorf("write: %w", err)
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,135 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// isValidateOnly reports whether the request asks for a validate-only (dry-run) upload.
+func (ht *HTTPTransport) isValidateOnly(r *http.Request) bool {
+	validate, err := strconv.ParseBool(r.URL.Query().Get(ht.cfg.URLValidateParam))
+
+	return err == nil && validate
+}
+
+// handleValidateUpload runs all upload checks on the files of a multipart form
+// and reports the outcome per file without persisting anything.
+func (ht *HTTPTransport) handleValidateUpload(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media upload validation failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media upload validated")
+		}
+	}(r.Context())
+
+	form, err := ht.stageMultipartForm(r)
+	if err != nil {
+		http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusBadRequest))
+
+		return fmt.Errorf("parse multipart form: %w", err)
+	}
+
+	defer func() {
+		if err := form.RemoveAll(); err != nil {
+			log.WarnContext(r.Context(), "staged files not removed", "error", err)
+		}
+	}()
+
+	if len(form.Files) == 0 {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return ErrNoMultipartFiles
+	}
+
+	var results []domain.UploadValidationResponse
+
+	for _, file := range form.Files {
+		results = append(results, ht.validateFile(r.Context(), file))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Filename < results[j].Filename
+	})
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, results); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
+
+// validateFile validates a single uploaded file.
+func (ht *HTTPTransport) validateFile(
+	ctx context.Context,
+	fileHeader *stagedFile,
+) domain.UploadValidationResponse {
+	result := domain.UploadValidationResponse{ //nolint:exhaustruct
+		Filename: fileHeader.Filename,
+		Size:     fileHeader.Size,
+	}
+
+	// Check upload constraints before reading the image to buffer
+	if _, _, err := ht.imageSvc.CheckUploadConstraints(fileHeader.Filename, fileHeader.Size, nil); err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		result.Error = fmt.Sprintf("open: %v", err)
+
+		return result
+	}
+	defer file.Close()
+
+	buffer, err := io.ReadAll(file)
+	if err != nil {
+		result.Error = fmt.Sprintf("read: %v", err)
+
+		return result
+	}
+
+	mimeType, _, err := ht.imageSvc.CheckUploadConstraints(fileHeader.Filename, fileHeader.Size, buffer)
+	if err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	owner, _ := context_.UsernameFromContext(ctx)
+	media := domain.NewMedia(buffer, domain.MediaMeta{ //nolint:exhaustruct
+		Filename: fileHeader.Filename,
+		Owner:    owner,
+		MIMEType: mimeType,
+	})
+
+	result.ID = media.ID().String()
+	result.MIMEType = mimeType
+	result.Exists = ht.imageSvc.Exists(ctx, media.ID())
+
+	imgConfig, err := ht.imageSvc.ValidateUpload(ctx, media)
+	if err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	result.Width = imgConfig.Width
+	result.Height = imgConfig.Height
+	result.Valid = true
+
+	return result
+}
@@ -0,0 +1,180 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleUploadValidate(t *testing.T) {
+	t.Parallel()
+
+	png := encodeTestImage(t, imagesvc.MIMETypePNG, 16, 8, true)
+	jpeg := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 8, true)
+
+	type file struct {
+		name string
+		data []byte
+	}
+
+	tests := []struct {
+		name        string
+		files       []file
+		stored      bool // The files are stored before validating them
+		wantStatus  int
+		wantResults []domain.UploadValidationResponse
+	}{
+		{
+			name: "valid", files: []file{{"photo.png", png}}, wantStatus: http.StatusOK,
+			wantResults: []domain.UploadValidationResponse{{
+				Filename: "photo.png", MIMEType: imagesvc.MIMETypePNG, Size: int64(len(png)),
+				Width: 16, Height: 8, Exists: false, Valid: true,
+			}},
+		},
+		{
+			name: "stored", files: []file{{"photo.png", png}}, stored: true, wantStatus: http.StatusOK,
+			wantResults: []domain.UploadValidationResponse{{
+				Filename: "photo.png", MIMEType: imagesvc.MIMETypePNG, Size: int64(len(png)),
+				Width: 16, Height: 8, Exists: true, Valid: true,
+			}},
+		},
+		{
+			name: "sorted by filename", files: []file{{"b.png", png}, {"a.jpg", jpeg}}, wantStatus: http.StatusOK,
+			wantResults: []domain.UploadValidationResponse{
+				{Filename: "a.jpg", MIMEType: imagesvc.MIMETypeJPEG, Size: int64(len(jpeg)), Width: 16, Height: 8, Valid: true},
+				{Filename: "b.png", MIMEType: imagesvc.MIMETypePNG, Size: int64(len(png)), Width: 16, Height: 8, Valid: true},
+			},
+		},
+		{
+			name: "type mismatch", files: []file{{"photo.png", jpeg}}, wantStatus: http.StatusOK,
+			wantResults: []domain.UploadValidationResponse{{Filename: "photo.png", Size: int64(len(jpeg)), Valid: false}},
+		},
+		{
+			name: "unsupported type", files: []file{{"photo.gif", png}}, wantStatus: http.StatusOK,
+			wantResults: []domain.UploadValidationResponse{{Filename: "photo.gif", Size: int64(len(png)), Valid: false}},
+		},
+		{
+			name: "too large", files: []file{{"photo.png", make([]byte, 1<<20+1)}}, wantStatus: http.StatusOK,
+			wantResults: []domain.UploadValidationResponse{{Filename: "photo.png", Size: 1<<20 + 1, Valid: false}},
+		},
+		{name: "no files", files: nil, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			imageSvc, err := newTestImageService(t, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			if tt.stored {
+				for _, f := range tt.files {
+					if _, err := imageSvc.Store(ctx, domain.NewMedia(f.data, domain.MediaMeta{
+						Filename: f.name, Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+					})); err != nil {
+						t.Fatalf("Store() error = %v", err)
+					}
+				}
+			}
+
+			before, err := imageSvc.List(ctx)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			var body bytes.Buffer
+
+			form := multipart.NewWriter(&body)
+			for _, f := range tt.files {
+				part, err := form.CreateFormFile("file", f.name)
+				if err != nil {
+					t.Fatalf("create form file: %v", err)
+				}
+
+				_, _ = part.Write(f.data)
+			}
+
+			_ = form.Close()
+
+			stagingDir := t.TempDir()
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+				URLValidateParam:     "validate",
+				MaxConcurrentUploads: 2,
+				UploadStagingDir:     stagingDir,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/media?validate=true", &body).WithContext(ctx)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+
+			rec := httptest.NewRecorder()
+			ht.HandleUpload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				var results []domain.UploadValidationResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+
+				if len(results) != len(tt.wantResults) {
+					t.Fatalf("results = %+v, want %+v", results, tt.wantResults)
+				}
+
+				files := make(map[string][]byte, len(tt.files))
+				for _, f := range tt.files {
+					files[f.name] = f.data
+				}
+
+				for i, got := range results {
+					want := tt.wantResults[i]
+
+					// IDs are those the files would be stored as, errors are only checked for presence
+					if want.Valid {
+						want.ID = domain.NewMedia(files[got.Filename], domain.MediaMeta{
+							Filename: got.Filename, Owner: "alice", MIMEType: got.MIMEType,
+						}).ID().String()
+					}
+
+					if got.Valid == (got.Error != "") {
+						t.Errorf("result %d = %+v, want an error if and only if invalid", i, got)
+					}
+
+					got.Error = ""
+					if got != want {
+						t.Errorf("result %d = %+v, want %+v", i, got, want)
+					}
+				}
+			}
+
+			// Validating stores nothing and leaves no staged files behind
+			after, err := imageSvc.List(ctx)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			if len(after) != len(before) {
+				t.Errorf("%d media stored, want %d", len(after), len(before))
+			}
+
+			if entries, err := os.ReadDir(stagingDir); err != nil || len(entries) != 0 {
+				t.Errorf("staging dir = %v, %v, want empty", entries, err)
+			}
+		})
+	}
+}
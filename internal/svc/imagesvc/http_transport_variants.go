@@ -0,0 +1,108 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// HandleVariants processes variants requests.
+// Expects the image ID as a URL parameter. Responds with the dimensions of the image and the
+// dimensions and URLs of its derivatives resized to the configured VariantWidths, along with
+// a ready-to-use HTML srcset attribute value. Missing derivatives are generated on download,
+// or in the background if SrcsetPrewarm is enabled. Responds with 304 Not Modified like HandleSrcset.
+func (ht *HTTPTransport) HandleVariants(w http.ResponseWriter, r *http.Request) {
+	_ = ht.handleVariants(w, r)
+}
+
+func (ht *HTTPTransport) handleVariants(w http.ResponseWriter, r *http.Request) (err error) {
+	log := ht.log.With(logging.Group("http", "method", r.Method, "url", http_.RedactedURL(r.URL)))
+
+	defer func(ctx context.Context) {
+		if err != nil {
+			log.ErrorContext(ctx, "media variants failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media variants served")
+		}
+	}(r.Context())
+
+	fileID := r.PathValue(ht.cfg.URLFileIDParam)
+	if fileID == "" {
+		http_.WriteError(w, r, http.StatusBadRequest)
+
+		return domain.ErrNoMediaID
+	}
+
+	fileID = encoding.NormalizeCrockfordB32LC(fileID)
+	log = log.With(logging.Group("media", "id", fileID))
+
+	widths, err := parseWidths(ht.cfg.VariantWidths, 0)
+	if err != nil {
+		http_.WriteError(w, r, http.StatusInternalServerError)
+
+		return fmt.Errorf("parse variant widths: %w", err)
+	}
+
+	set, err := ht.imageSvc.Variants(r.Context(), domain.MediaID(fileID), widths)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnauthorized):
+			fallthrough
+		case errors.Is(err, os.ErrNotExist):
+			http_.WriteError(w, r, http.StatusNotFound)
+		default:
+			http_.WriteError(w, r, domain.ErrorStatus(err, http.StatusInternalServerError))
+		}
+
+		return fmt.Errorf("variants: %w", err)
+	}
+
+	resp := domain.MediaVariantsResponse{
+		ID:       fileID,
+		Width:    set.Original.Width,
+		Height:   set.Original.Height,
+		Srcset:   "",
+		Variants: make([]domain.MediaVariantResponse, 0, len(set.Variants)),
+	}
+
+	candidates := make([]string, 0, len(set.Variants))
+	widths = widths[:0]
+
+	for _, variant := range set.Variants {
+		variantURL := ht.variantURL(fileID, variant.Width)
+
+		resp.Variants = append(resp.Variants, domain.MediaVariantResponse{
+			Width:  variant.Width,
+			Height: variant.Height,
+			URL:    variantURL,
+		})
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variantURL, variant.Width))
+		widths = append(widths, variant.Width)
+	}
+
+	resp.Srcset = strings.Join(candidates, ", ")
+
+	// The srcset covers the widths and signatures of the variants
+	if http_.NotModified(w, r, http_.RevisionETag(set.Meta.Revision(), resp.Srcset)) ||
+		http_.NotModifiedSince(w, r, set.Meta.ModifiedTime()) {
+		return nil
+	}
+
+	if ht.cfg.SrcsetPrewarm {
+		ht.imageSvc.Prewarm(r.Context(), domain.MediaID(fileID), widths)
+	}
+
+	if err := http_.WriteJSON(w, r, http.StatusOK, resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+
+	return nil
+}
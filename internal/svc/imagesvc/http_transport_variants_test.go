@@ -0,0 +1,127 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	_ "image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_HandleVariants(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		allowedWidths string
+		variantWidths string
+		username      string
+		wantStatus    int
+		wantSizes     [][2]int
+	}{
+		{
+			name: "resized", variantWidths: "20,10", username: "alice",
+			wantStatus: http.StatusOK, wantSizes: [][2]int{{10, 5}, {20, 10}},
+		},
+		{
+			name: "capped at original", variantWidths: "20,80,160", username: "alice",
+			wantStatus: http.StatusOK, wantSizes: [][2]int{{20, 10}, {40, 20}},
+		},
+		{
+			name: "not allowed", allowedWidths: "10,40", variantWidths: "10,20", username: "alice",
+			wantStatus: http.StatusOK, wantSizes: [][2]int{{10, 5}},
+		},
+		{name: "other user", variantWidths: "10", username: "bob", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig("")
+			cfg.AllowedWidths = tt.allowedWidths
+
+			imageSvc, err := newTestImageService(t, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			stored, err := imageSvc.Store(context_.WithUsername(context.Background(), "alice"),
+				domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 40, 20, true), domain.MediaMeta{
+					Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+				}))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+				URLFileIDParam: "media_id",
+				URLWidthParam:  "width",
+				VariantWidths:  tt.variantWidths,
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+"/variants", nil).
+				WithContext(context_.WithUsername(context.Background(), tt.username))
+			req.SetPathValue("media_id", stored.ID().String())
+
+			rec := httptest.NewRecorder()
+			ht.HandleVariants(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp domain.MediaVariantsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if resp.Width != 40 || resp.Height != 20 {
+				t.Errorf("original = %dx%d, want 40x20", resp.Width, resp.Height)
+			}
+
+			sizes := make([][2]int, 0, len(resp.Variants))
+			for _, variant := range resp.Variants {
+				sizes = append(sizes, [2]int{variant.Width, variant.Height})
+			}
+
+			if !reflect.DeepEqual(sizes, tt.wantSizes) {
+				t.Errorf("variants = %v, want %v", sizes, tt.wantSizes)
+			}
+
+			// The listed URLs must be servable at the listed dimensions
+			variant := resp.Variants[len(resp.Variants)-1]
+
+			req = httptest.NewRequest(http.MethodGet, variant.URL, nil).
+				WithContext(context_.WithUsername(context.Background(), tt.username))
+			req.SetPathValue("media_id", stored.ID().String())
+
+			rec = httptest.NewRecorder()
+			ht.HandleDownload(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("download %s: status = %d, want %d", variant.URL, rec.Code, http.StatusOK)
+			}
+
+			imgConfig, _, err := image.DecodeConfig(rec.Body)
+			if err != nil {
+				t.Fatalf("decode download: %v", err)
+			}
+
+			if imgConfig.Width != variant.Width || imgConfig.Height != variant.Height {
+				t.Errorf("download = %dx%d, want %dx%d", imgConfig.Width, imgConfig.Height, variant.Width, variant.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// CacheGCResult summarizes a cache garbage collection run.
+type CacheGCResult struct {
+	Scanned int // Number of cache entries inspected
+	Removed int // Number of orphaned cache entries removed
+}
+
+// RunCacheGC periodically removes orphaned cache entries until the context is cancelled.
+// The interval is configured by ImageConfig.CacheGCInterval; returns immediately if it is 0.
+func (imageSvc BlobImageService) RunCacheGC(ctx context.Context) {
+	if imageSvc.cfg.CacheGCInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(imageSvc.cfg.CacheGCInterval * int64(time.Second)))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = imageSvc.CollectCacheGarbage(ctx)
+		}
+	}
+}
+
+// CollectCacheGarbage removes cache entries whose original data no longer exists.
+// Such entries remain if a deletion raced with a resize, or if the cache cleanup failed.
+// Entries are identified by the data hash preceding the first underscore of their ID.
+func (imageSvc BlobImageService) CollectCacheGarbage(ctx context.Context) (result CacheGCResult, err error) {
+	log := imageSvc.log.With(logging.Group("cache", "job", "gc"))
+
+	defer func(start time.Time) {
+		imageSvc.metrics.cacheGCDuration.ObserveDuration(start)
+
+		if err != nil {
+			imageSvc.metrics.cacheGCRuns.With("error").Inc()
+			log.ErrorContext(ctx, "cache gc failed", "error", err, "scanned", result.Scanned, "removed", result.Removed)
+		} else {
+			imageSvc.metrics.cacheGCRuns.With("success").Inc()
+			log.InfoContext(ctx, "cache gc finished", "scanned", result.Scanned, "removed", result.Removed)
+		}
+	}(time.Now())
+
+	cacheIDs, err := imageSvc.cacheRepo.List(ctx)
+	if err != nil {
+		return result, fmt.Errorf("list cache: %w", err)
+	}
+
+	for _, cacheID := range cacheIDs {
+		if err := ctx.Err(); err != nil {
+			return result, fmt.Errorf("collect: %w", err)
+		}
+
+		result.Scanned++
+		imageSvc.metrics.cacheGCScanned.Inc()
+
+		removed, err := imageSvc.collectCacheEntry(ctx, cacheID)
+		if err != nil {
+			return result, fmt.Errorf("collect %q: %w", cacheID, err)
+		}
+
+		if removed {
+			result.Removed++
+			imageSvc.metrics.cacheGCRemoved.Inc()
+		}
+	}
+
+	return result, nil
+}
+
+// collectCacheEntry removes the given cache entry if its original data no longer exists.
+// Returns whether the entry was removed.
+func (imageSvc BlobImageService) collectCacheEntry(ctx context.Context, cacheID domain.BlobID) (bool, error) {
+	hash, _, found := strings.Cut(string(cacheID), "_")
+	if !found || imageSvc.mediaSvc.DataExists(ctx, hash) {
+		return false, nil
+	}
+
+	unlock, err := imageSvc.cacheRepo.Lock(ctx, cacheID, true)
+	if err != nil {
+		return false, fmt.Errorf("lock cache: %w", err)
+	}
+	defer unlock()
+
+	// Re-check under lock, the original may have been uploaded again meanwhile
+	if imageSvc.mediaSvc.DataExists(ctx, hash) || !imageSvc.cacheRepo.Exists(ctx, cacheID) {
+		return false, nil
+	}
+
+	if err := imageSvc.cacheRepo.Delete(ctx, cacheID); err != nil {
+		return false, fmt.Errorf("delete cache: %w", err)
+	}
+
+	imageSvc.cacheIndex.remove(cacheID)
+
+	imageSvc.log.DebugContext(ctx, "orphaned cache entry removed", logging.Group("cache", "id", cacheID))
+
+	return true, nil
+}
@@ -0,0 +1,149 @@
+package imagesvc
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+)
+
+// cacheInvalidatingImageService decorates an ImageService, invalidating the cached responses
+// of the user in the context whenever one of their images is stored, deleted, shared or changes
+// visibility. Sharing also invalidates the responses of the user the image is shared with.
+type cacheInvalidatingImageService struct {
+	ImageService
+
+	cache *http_.ResponseCache
+}
+
+// newCacheInvalidatingImageService returns imageSvc decorated to invalidate the responses in
+// cache, or imageSvc unchanged if cache is nil.
+func newCacheInvalidatingImageService(imageSvc ImageService, cache *http_.ResponseCache) ImageService {
+	if cache == nil {
+		return imageSvc
+	}
+
+	return &cacheInvalidatingImageService{ImageService: imageSvc, cache: cache}
+}
+
+// Store implements ImageService.
+func (svc *cacheInvalidatingImageService) Store(ctx context.Context, image domain.Media) (domain.Media, error) {
+	stored, err := svc.ImageService.Store(ctx, image)
+	if err != nil {
+		return stored, fmt.Errorf("store: %w", err)
+	}
+
+	svc.invalidate(ctx)
+
+	return stored, nil
+}
+
+// StoreFrom implements ImageService.
+func (svc *cacheInvalidatingImageService) StoreFrom(
+	ctx context.Context,
+	meta domain.MediaMeta,
+	content io.ReadSeeker,
+) (domain.MediaMeta, error) {
+	stored, err := svc.ImageService.StoreFrom(ctx, meta, content)
+	if err != nil {
+		return stored, fmt.Errorf("store from: %w", err)
+	}
+
+	svc.invalidate(ctx)
+
+	return stored, nil
+}
+
+// Delete implements ImageService.
+func (svc *cacheInvalidatingImageService) Delete(ctx context.Context, imageID domain.MediaID) error {
+	if err := svc.ImageService.Delete(ctx, imageID); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	svc.invalidate(ctx)
+
+	return nil
+}
+
+// SetVisibility implements ImageService.
+func (svc *cacheInvalidatingImageService) SetVisibility(
+	ctx context.Context,
+	imageID domain.MediaID,
+	visibility domain.MediaVisibility,
+) (domain.MediaMeta, error) {
+	meta, err := svc.ImageService.SetVisibility(ctx, imageID, visibility)
+	if err != nil {
+		return meta, fmt.Errorf("set visibility: %w", err)
+	}
+
+	svc.invalidate(ctx)
+
+	return meta, nil
+}
+
+// Share implements ImageService.
+func (svc *cacheInvalidatingImageService) Share(
+	ctx context.Context,
+	imageID domain.MediaID,
+	username string,
+) (domain.MediaMeta, error) {
+	meta, err := svc.ImageService.Share(ctx, imageID, username)
+	if err != nil {
+		return meta, fmt.Errorf("share: %w", err)
+	}
+
+	svc.invalidate(ctx)
+	svc.cache.Invalidate(username)
+
+	return meta, nil
+}
+
+// Unshare implements ImageService.
+func (svc *cacheInvalidatingImageService) Unshare(
+	ctx context.Context,
+	imageID domain.MediaID,
+	username string,
+) (domain.MediaMeta, error) {
+	meta, err := svc.ImageService.Unshare(ctx, imageID, username)
+	if err != nil {
+		return meta, fmt.Errorf("unshare: %w", err)
+	}
+
+	svc.invalidate(ctx)
+	svc.cache.Invalidate(username)
+
+	return meta, nil
+}
+
+// Reprocess implements ImageService. Reprocessing affects the images of any user, so all
+// responses are removed, even if reprocessing failed part way.
+func (svc *cacheInvalidatingImageService) Reprocess(
+	ctx context.Context,
+	req domain.MediaReprocessRequest,
+	progress ReprocessProgressFunc,
+) (domain.MediaReprocessStatus, error) {
+	defer svc.cache.Purge()
+
+	status, err := svc.ImageService.Reprocess(ctx, req, progress)
+	if err != nil {
+		return status, fmt.Errorf("reprocess: %w", err)
+	}
+
+	return status, nil
+}
+
+// invalidate removes the cached responses of the user in the context. Admins may delete the
+// images of other users, whose responses are not known, so all responses are removed then.
+func (svc *cacheInvalidatingImageService) invalidate(ctx context.Context) {
+	username, ok := context_.UsernameFromContext(ctx)
+	if !ok || context_.HasAdminAccess(ctx) {
+		svc.cache.Purge()
+
+		return
+	}
+
+	svc.cache.Invalidate(username)
+}
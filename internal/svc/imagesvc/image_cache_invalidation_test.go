@@ -0,0 +1,123 @@
+package imagesvc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	http_ "github.com/mkrupp/homecase-michael/internal/infra/transport/http"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestHTTPTransport_ResponseCacheInvalidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		handler func(ht *imagesvc.HTTPTransport) http.HandlerFunc
+		wantHit bool // The timeline of alice is still cached afterwards
+	}{
+		{
+			name: "visibility", method: http.MethodPut, path: "/visibility", body: `{"visibility":"public"}`,
+			handler: func(ht *imagesvc.HTTPTransport) http.HandlerFunc { return ht.HandleVisibility },
+		},
+		{
+			name: "share", method: http.MethodPut, path: "/access/bob",
+			handler: func(ht *imagesvc.HTTPTransport) http.HandlerFunc { return ht.HandleShareUser },
+		},
+		{
+			name: "unshare", method: http.MethodDelete, path: "/access/bob",
+			handler: func(ht *imagesvc.HTTPTransport) http.HandlerFunc { return ht.HandleUnshareUser },
+		},
+		{
+			name: "read", method: http.MethodGet, path: "/meta", wantHit: true,
+			handler: func(ht *imagesvc.HTTPTransport) http.HandlerFunc { return ht.HandleMeta },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			imageSvc, err := newTestImageService(t, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			stored, err := imageSvc.Store(context_.WithUsername(context.Background(), "alice"), domain.NewMedia(
+				encodeTestImage(t, imagesvc.MIMETypePNG, 8, 8, true),
+				domain.MediaMeta{Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG},
+			))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			cacheable := []string{"GET /media/timeline"}
+
+			cache, err := http_.NewResponseCache(http_.ResponseCacheConfig{TTLs: "GET /media/timeline=60", MaxEntries: 10},
+				cacheable)
+			if err != nil {
+				t.Fatalf("new response cache: %v", err)
+			}
+
+			ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+				URLFileIDParam: "media_id",
+				URLGroupParam:  "group",
+			})
+			ht.SetResponseCache(cache)
+
+			// The timeline of each user is cached by the first request
+			timeline := cache.Handle("GET /media/timeline", http.HandlerFunc(ht.HandleTimeline))
+			get := func(username string) string {
+				req := httptest.NewRequest(http.MethodGet, "/media/timeline", nil).
+					WithContext(context_.WithUsername(context.Background(), username))
+				rec := httptest.NewRecorder()
+				timeline.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusOK {
+					t.Fatalf("timeline: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+				}
+
+				return rec.Header().Get(http_.CacheStatusHeader)
+			}
+
+			for _, username := range []string{"alice", "bob"} {
+				get(username)
+
+				if got := get(username); got != "HIT" {
+					t.Fatalf("timeline of %s: %s = %q, want HIT", username, http_.CacheStatusHeader, got)
+				}
+			}
+
+			req := httptest.NewRequest(tt.method, "/media/"+stored.ID().String()+tt.path, strings.NewReader(tt.body)).
+				WithContext(context_.WithUsername(context.Background(), "alice"))
+			req.SetPathValue("media_id", stored.ID().String())
+			req.SetPathValue(imagesvc.URLShareUserParam, "bob")
+
+			rec := httptest.NewRecorder()
+			tt.handler(ht)(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			want := map[bool]string{true: "HIT", false: "MISS"}[tt.wantHit]
+			if got := get("alice"); got != want {
+				t.Errorf("timeline of alice: %s = %q, want %q", http_.CacheStatusHeader, got, want)
+			}
+
+			// Sharing changes what the user the image is shared with may access
+			wantBob := map[bool]string{true: "MISS", false: "HIT"}[tt.path == "/access/bob"]
+			if got := get("bob"); got != wantBob {
+				t.Errorf("timeline of bob: %s = %q, want %q", http_.CacheStatusHeader, got, wantBob)
+			}
+		})
+	}
+}
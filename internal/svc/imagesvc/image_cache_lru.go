@@ -0,0 +1,272 @@
+package imagesvc
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// cacheIndex tracks the size and recency of the entries of the resize cache, so the least
+// recently used entries can be evicted once the cache exceeds its size budget.
+// The index is kept in memory; entries cached before a restart are added by RunCacheEviction.
+// All methods are no-ops on a nil index, which is used if the cache size is unlimited.
+type cacheIndex struct {
+	mu      sync.Mutex
+	entries map[domain.BlobID]*list.Element
+	lru     *list.List // of cacheIndexEntry, most recently used first
+	size    int64
+	maxSize int64
+
+	evict     chan struct{} // signals the eviction worker that the budget is exceeded
+	sizeGauge *metrics.Gauge
+}
+
+// cacheIndexEntry is an entry of the cacheIndex.
+type cacheIndexEntry struct {
+	id   domain.BlobID
+	size int64
+}
+
+// newCacheIndex returns an index of a cache of at most maxSize bytes,
+// or nil if maxSize is 0 or less, which leaves the cache unlimited.
+func newCacheIndex(maxSize int64, sizeGauge *metrics.Gauge) *cacheIndex {
+	if maxSize <= 0 {
+		return nil
+	}
+
+	return &cacheIndex{
+		entries:   map[domain.BlobID]*list.Element{},
+		lru:       list.New(),
+		size:      0,
+		maxSize:   maxSize,
+		evict:     make(chan struct{}, 1),
+		sizeGauge: sizeGauge,
+	}
+}
+
+// touch marks the entry as most recently used, adding it if it is not indexed yet.
+func (idx *cacheIndex) touch(id domain.BlobID, size int64) {
+	if idx == nil {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if elem, ok := idx.entries[id]; ok {
+		idx.lru.MoveToFront(elem)
+
+		return
+	}
+
+	idx.entries[id] = idx.lru.PushFront(cacheIndexEntry{id: id, size: size})
+	idx.resize(size)
+}
+
+// addOldest adds the entry as least recently used, unless it is indexed already.
+func (idx *cacheIndex) addOldest(id domain.BlobID, size int64) {
+	if idx == nil {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, ok := idx.entries[id]; ok {
+		return
+	}
+
+	idx.entries[id] = idx.lru.PushBack(cacheIndexEntry{id: id, size: size})
+	idx.resize(size)
+}
+
+// remove removes the entry from the index.
+func (idx *cacheIndex) remove(id domain.BlobID) {
+	if idx == nil {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(id)
+}
+
+// removePrefix removes the entries whose IDs start with prefix from the index.
+func (idx *cacheIndex) removePrefix(prefix string) {
+	if idx == nil {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for id := range idx.entries {
+		if strings.HasPrefix(string(id), prefix) {
+			idx.removeLocked(id)
+		}
+	}
+}
+
+// oldest returns the least recently used entry if the cache exceeds its budget.
+func (idx *cacheIndex) oldest() (domain.BlobID, bool) {
+	if idx == nil {
+		return "", false
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.size <= idx.maxSize || idx.lru.Len() == 0 {
+		return "", false
+	}
+
+	entry, _ := idx.lru.Back().Value.(cacheIndexEntry)
+
+	return entry.id, true
+}
+
+// len returns the number of indexed entries.
+func (idx *cacheIndex) len() int {
+	if idx == nil {
+		return 0
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.lru.Len()
+}
+
+func (idx *cacheIndex) removeLocked(id domain.BlobID) {
+	elem, ok := idx.entries[id]
+	if !ok {
+		return
+	}
+
+	entry, _ := idx.lru.Remove(elem).(cacheIndexEntry)
+	delete(idx.entries, id)
+	idx.resize(-entry.size)
+}
+
+// resize adds delta to the size of the cache, signalling the eviction worker if it exceeds the budget.
+func (idx *cacheIndex) resize(delta int64) {
+	idx.size += delta
+	idx.sizeGauge.Set(float64(idx.size))
+
+	if idx.size > idx.maxSize {
+		select {
+		case idx.evict <- struct{}{}:
+		default: // eviction already pending
+		}
+	}
+}
+
+// RunCacheEviction evicts the least recently used entries of the resize cache whenever it exceeds
+// ImageConfig.CacheMaxSize, until the context is cancelled. Entries cached before the service was
+// started are indexed first, as least recently used. Returns immediately if the size is unlimited.
+func (imageSvc BlobImageService) RunCacheEviction(ctx context.Context) {
+	if imageSvc.cacheIndex == nil {
+		return
+	}
+
+	if err := imageSvc.loadCacheIndex(ctx); err != nil {
+		imageSvc.log.WarnContext(ctx, "cache index incomplete", "error", err)
+	}
+
+	for {
+		imageSvc.evictCache(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-imageSvc.cacheIndex.evict:
+		}
+	}
+}
+
+// loadCacheIndex adds the entries of the cache repository to the cache index.
+func (imageSvc BlobImageService) loadCacheIndex(ctx context.Context) error {
+	cacheIDs, err := imageSvc.cacheRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list cache: %w", err)
+	}
+
+	for _, cacheID := range cacheIDs {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("load: %w", err)
+		}
+
+		size, err := imageSvc.cacheEntrySize(ctx, cacheID)
+		if err != nil {
+			return fmt.Errorf("load %q: %w", cacheID, err)
+		}
+
+		imageSvc.cacheIndex.addOldest(cacheID, size)
+	}
+
+	imageSvc.log.InfoContext(ctx, "cache index loaded", "entries", imageSvc.cacheIndex.len())
+
+	return nil
+}
+
+// cacheEntrySize returns the size in bytes of the given cache entry.
+func (imageSvc BlobImageService) cacheEntrySize(ctx context.Context, cacheID domain.BlobID) (int64, error) {
+	unlock, err := imageSvc.cacheRepo.Lock(ctx, cacheID, false)
+	if err != nil {
+		return 0, fmt.Errorf("lock cache: %w", err)
+	}
+	defer unlock()
+
+	cacheBlob, err := imageSvc.cacheRepo.Fetch(ctx, cacheID)
+	if err != nil {
+		return 0, fmt.Errorf("fetch cache: %w", err)
+	}
+
+	return cacheBlob.Size(), nil
+}
+
+// evictCache removes the least recently used cache entries until the cache fits its budget.
+func (imageSvc BlobImageService) evictCache(ctx context.Context) {
+	for ctx.Err() == nil {
+		cacheID, ok := imageSvc.cacheIndex.oldest()
+		if !ok {
+			return
+		}
+
+		if err := imageSvc.evictCacheEntry(ctx, cacheID); err != nil {
+			imageSvc.log.WarnContext(ctx, "cache eviction failed", logging.Group("cache", "id", cacheID), "error", err)
+		}
+	}
+}
+
+// evictCacheEntry removes the given entry from the cache and the cache index.
+// The entry is removed from the index even if it cannot be deleted, so eviction progresses.
+func (imageSvc BlobImageService) evictCacheEntry(ctx context.Context, cacheID domain.BlobID) error {
+	defer imageSvc.cacheIndex.remove(cacheID)
+
+	unlock, err := imageSvc.cacheRepo.Lock(ctx, cacheID, true)
+	if err != nil {
+		return fmt.Errorf("lock cache: %w", err)
+	}
+	defer unlock()
+
+	if !imageSvc.cacheRepo.Exists(ctx, cacheID) {
+		return nil
+	}
+
+	if err := imageSvc.cacheRepo.Delete(ctx, cacheID); err != nil {
+		return fmt.Errorf("delete cache: %w", err)
+	}
+
+	imageSvc.metrics.cacheEvicted.Inc()
+	imageSvc.log.DebugContext(ctx, "cache entry evicted", logging.Group("cache", "id", cacheID))
+
+	return nil
+}
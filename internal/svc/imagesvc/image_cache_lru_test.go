@@ -0,0 +1,126 @@
+package imagesvc_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestBlobImageService_CacheEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+	data := encodeTestImage(t, imagesvc.MIMETypePNG, 32, 24, true)
+	meta := domain.MediaMeta{Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG}
+
+	// Resized images are deterministic, so their sizes are taken from an unlimited cache
+	sizes := map[int]int64{}
+
+	unlimitedSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	stored, err := unlimitedSvc.Store(ctx, domain.NewMedia(data, meta))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	for _, width := range []int{8, 16, 24} {
+		resized, err := unlimitedSvc.Fetch(ctx, stored.ID(), width)
+		if err != nil {
+			t.Fatalf("Fetch(%d) error = %v", width, err)
+		}
+
+		sizes[width] = resized.Size()
+	}
+
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	cacheRepo, err := factory(context.Background(), "cache", "bin")
+	if err != nil {
+		t.Fatalf("new cache repository: %v", err)
+	}
+
+	// Entries cached before the service started are evicted first
+	if err := cacheRepo.Store(ctx, domain.NewBlob("stale_8", make([]byte, 100))); err != nil {
+		t.Fatalf("store stale cache entry: %v", err)
+	}
+
+	cfg := testConfig("")
+	cfg.CacheMaxSize = sizes[8] + sizes[24]
+
+	imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	stored, err = imageSvc.Store(ctx, domain.NewMedia(data, meta))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Width 8 is used most recently, width 16 least recently
+	for _, width := range []int{8, 16, 24, 8} {
+		if _, err := imageSvc.Fetch(ctx, stored.ID(), width); err != nil {
+			t.Fatalf("Fetch(%d) error = %v", width, err)
+		}
+	}
+
+	evictCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		imageSvc.RunCacheEviction(evictCtx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	cacheID := func(width int) domain.BlobID {
+		return domain.BlobID(stored.Hash() + "_" + strconv.Itoa(width))
+	}
+
+	for _, evicted := range []domain.BlobID{"stale_8", cacheID(16)} {
+		deadline := time.Now().Add(5 * time.Second)
+		for cacheRepo.Exists(ctx, evicted) {
+			if time.Now().After(deadline) {
+				t.Fatalf("cache entry %q not evicted", evicted)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for _, width := range []int{8, 24} {
+		if !cacheRepo.Exists(ctx, cacheID(width)) {
+			t.Errorf("cache entry %q evicted, want it kept", cacheID(width))
+		}
+	}
+
+	// Entries are removed from the index after they are deleted
+	deadline := time.Now().Add(5 * time.Second)
+	for imageSvc.CacheStats().Entries != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("CacheStats().Entries = %d, want 2", imageSvc.CacheStats().Entries)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
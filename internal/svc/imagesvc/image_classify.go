@@ -0,0 +1,70 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// Image categories assigned by the "classify" processor.
+const (
+	CategoryPhoto   = "photo"
+	CategoryGraphic = "graphic"
+	CategoryIcon    = "icon"
+)
+
+// maxIconSize is the maximum width and height of images classified as icons.
+const maxIconSize = 128
+
+// classifyProcessor is the "classify" processor, setting the category of an image
+// in its metadata: small images are icons, images with at most 256 distinct colors
+// are graphics such as diagrams or screenshots, and all other images are photos.
+type classifyProcessor struct{}
+
+func newClassifyProcessor(ImageConfig) (Processor, error) {
+	return classifyProcessor{}, nil
+}
+
+// Process implements Processor by classifying the image.
+func (classifyProcessor) Process(_ context.Context, img domain.Media) (domain.Media, error) {
+	bitmap, err := decodeImage(bytes.NewReader(img.Bytes()), img.MIMEType())
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("decode image: %w", err)
+	}
+
+	meta := img.Meta()
+	meta.Category = classifyImage(bitmap)
+
+	return domain.NewMedia(img.Bytes(), meta), nil
+}
+
+// classifyImage returns the category of an image.
+func classifyImage(bitmap image.Image) string {
+	bounds := bitmap.Bounds()
+	if bounds.Dx() <= maxIconSize && bounds.Dy() <= maxIconSize {
+		return CategoryIcon
+	}
+
+	if _, ok := bitmap.(*image.Paletted); ok {
+		return CategoryGraphic
+	}
+
+	seen := make(map[color.RGBA64]struct{}, maxPaletteColors+1)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c, _ := color.RGBA64Model.Convert(bitmap.At(x, y)).(color.RGBA64)
+
+			seen[c] = struct{}{}
+			if len(seen) > maxPaletteColors {
+				return CategoryPhoto
+			}
+		}
+	}
+
+	return CategoryGraphic
+}
@@ -5,4 +5,120 @@ type ImageConfig struct {
 	// Interpolator specifies the image scaling algorithm to use.
 	// Valid values are: "nearestneighbor", "catmullrom", "bilinear", "approxbilinear"
 	Interpolator string `env:"INTERPOLATOR" default:"catmullrom"`
+
+	// Processors is the comma-separated, ordered list of processors run on uploaded images
+	// before they are stored. Built-in processors are "exif_strip", "optimize", "classify"
+	// and "watermark"; further processors can be added with RegisterProcessor.
+	Processors string `env:"PROCESSORS" default:"optimize"`
+
+	// MaxWidth is the maximum width in pixels of uploaded images. 0 disables the limit.
+	MaxWidth int `env:"MAX_WIDTH" default:"16384"`
+
+	// MaxHeight is the maximum height in pixels of uploaded images. 0 disables the limit.
+	MaxHeight int `env:"MAX_HEIGHT" default:"16384"`
+
+	// MaxPixels is the maximum number of pixels (width times height) of uploaded images, which
+	// bounds the memory needed to decode them. 0 disables the limit.
+	MaxPixels int64 `env:"MAX_PIXELS" default:"100000000"`
+
+	// OptimizePNG enables lossless recompression of uploaded PNG images,
+	// converting them to palette images where possible.
+	OptimizePNG bool `env:"OPTIMIZE_PNG" default:"false"`
+
+	// OptimizeJPEG enables lossless recompression of uploaded sequential JPEG images, rewriting
+	// them as progressive JPEG with optimized Huffman tables without changing their pixels.
+	OptimizeJPEG bool `env:"OPTIMIZE_JPEG" default:"false"`
+
+	// OptimizeJPEGQuality is the quality (1-100) used when processors re-encode JPEG images,
+	// such as the watermark processor.
+	OptimizeJPEGQuality int `env:"OPTIMIZE_JPEG_QUALITY" default:"85"`
+
+	// JPEGQuality is the quality (1-100) of JPEG images output by transforms and resizes
+	// that do not request a quality themselves.
+	JPEGQuality int `env:"JPEG_QUALITY" default:"75"`
+
+	// JPEGMinQuality is the lowest quality (1-100) requests may ask for. Lower qualities are raised to it.
+	JPEGMinQuality int `env:"JPEG_MIN_QUALITY" default:"1"`
+
+	// JPEGMaxQuality is the highest quality (1-100) requests may ask for. Higher qualities are lowered to it.
+	JPEGMaxQuality int `env:"JPEG_MAX_QUALITY" default:"100"`
+
+	// ProgressiveJPEG enables progressive encoding of JPEG images output by transforms and resizes,
+	// which browsers render coarsely first and refine while they load.
+	ProgressiveJPEG bool `env:"PROGRESSIVE_JPEG" default:"false"`
+
+	// InterlacedPNG enables Adam7 interlacing of PNG images output by transforms and resizes,
+	// which browsers render coarsely first and refine while they load, at the cost of larger files.
+	InterlacedPNG bool `env:"INTERLACED_PNG" default:"false"`
+
+	// WatermarkFile is the path of a PNG image drawn onto uploaded images by the
+	// "watermark" processor.
+	WatermarkFile string `env:"WATERMARK_FILE" default:""`
+
+	// WatermarkOpacity is the opacity in percent (1-100) of the watermark.
+	WatermarkOpacity int `env:"WATERMARK_OPACITY" default:"50"`
+
+	// WatermarkScale is the maximum width of the watermark in percent of the image width.
+	WatermarkScale int `env:"WATERMARK_SCALE" default:"25"`
+
+	// ExifExtract enables extracting the EXIF metadata of uploaded images, such as camera,
+	// exposure and the time taken, before processors like "exif_strip" run. The metadata is
+	// stored alongside the image and served by GET /media/{id}/exif.
+	ExifExtract bool `env:"EXIF_EXTRACT" default:"false"`
+
+	// ExifGPS enables keeping the GPS position of extracted EXIF metadata.
+	// Positions are only ever served to the owner of an image.
+	ExifGPS bool `env:"EXIF_GPS" default:"false"`
+
+	// AutoOrientOriginals enables serving original downloads of images with an EXIF orientation
+	// upright, re-encoded and cached like resized images. Resized images are always upright.
+	AutoOrientOriginals bool `env:"AUTO_ORIENT_ORIGINALS" default:"false"`
+
+	// CacheGCInterval is the interval in seconds between garbage collection runs removing
+	// cached images whose original data no longer exists. 0 disables garbage collection.
+	CacheGCInterval int64 `env:"CACHE_GC_INTERVAL" default:"3600"`
+
+	// AllowedWidths is the comma-separated list of widths images may be resized to, e.g.
+	// "320,640,1280", which bounds the number of cached versions of an image. Other widths are
+	// rejected, or snapped to the nearest allowed width if SnapWidths is enabled.
+	// Empty allows any width.
+	AllowedWidths string `env:"ALLOWED_WIDTHS" default:""`
+
+	// SnapWidths enables resizing images to the allowed width nearest to the requested width
+	// instead of rejecting widths not listed in AllowedWidths.
+	SnapWidths bool `env:"SNAP_WIDTHS" default:"false"`
+
+	// CacheMaxSize is the maximum total size in bytes of the cached resized images. The least
+	// recently used images are evicted once it is exceeded. 0 leaves the cache size unlimited.
+	CacheMaxSize int64 `env:"CACHE_MAX_SIZE" default:"0"`
+
+	// ThumbnailWidths is the comma-separated list of widths to which uploaded images are resized
+	// in the background right after they are stored, e.g. "200,800,1600", so their first
+	// downloads in these widths are served from the cache. Empty disables eager thumbnails.
+	ThumbnailWidths string `env:"THUMBNAIL_WIDTHS" default:""`
+
+	// ThumbnailWorkers is the number of background workers generating thumbnails and the
+	// derivatives prewarmed by srcset and variants requests.
+	ThumbnailWorkers int `env:"THUMBNAIL_WORKERS" default:"2"`
+
+	// ThumbnailQueueSize is the number of images waiting for their thumbnails or prewarmed
+	// derivatives. Derivatives queued while the queue is full are generated on their first
+	// download instead.
+	ThumbnailQueueSize int `env:"THUMBNAIL_QUEUE_SIZE" default:"1000"`
+
+	// ReprocessRate is the default maximum number of images reprocessed per second by
+	// reprocessing jobs, which share the storage with uploads and downloads. 0 is unlimited.
+	ReprocessRate int `env:"REPROCESS_RATE" default:"10"`
+
+	// UploadSessionTTL is the time in seconds a resumable upload session is kept after its last
+	// chunk was received. Stale sessions are removed with their chunks.
+	UploadSessionTTL int64 `env:"UPLOAD_SESSION_TTL" default:"86400"`
+
+	// UploadExpiryInterval is the interval in seconds between removals of stale resumable upload
+	// sessions. 0 disables the removal.
+	UploadExpiryInterval int64 `env:"UPLOAD_EXPIRY_INTERVAL" default:"600"`
+
+	// UploadChunkMaxSize is the maximum size in bytes of a chunk appended to a resumable upload
+	// session, which is read into memory. 0 disables the limit.
+	UploadChunkMaxSize int64 `env:"UPLOAD_CHUNK_MAX_SIZE" default:"16777216"`
 }
@@ -0,0 +1,36 @@
+package imagesvc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// checkDimensions returns domain.ErrImageDimensionsTooLarge if the dimensions of an image exceed
+// ImageConfig.MaxWidth, MaxHeight or MaxPixels. Only the image header is decoded, so images
+// that would exhaust memory when decoded are rejected before they are. Images whose dimensions
+// cannot be decoded are accepted, as decoding them fails without allocating their pixels.
+func (imageSvc BlobImageService) checkDimensions(data []byte, mimeType string) error {
+	cfg := imageSvc.cfg
+	if cfg.MaxWidth <= 0 && cfg.MaxHeight <= 0 && cfg.MaxPixels <= 0 {
+		return nil
+	}
+
+	imgConfig, err := decodeImageConfig(bytes.NewReader(data), mimeType)
+	if err != nil {
+		return nil //nolint:nilerr // undecodable images cannot exhaust memory
+	}
+
+	switch {
+	case cfg.MaxWidth > 0 && imgConfig.Width > cfg.MaxWidth:
+		return fmt.Errorf("%w: width %d exceeds %d", domain.ErrImageDimensionsTooLarge, imgConfig.Width, cfg.MaxWidth)
+	case cfg.MaxHeight > 0 && imgConfig.Height > cfg.MaxHeight:
+		return fmt.Errorf("%w: height %d exceeds %d", domain.ErrImageDimensionsTooLarge, imgConfig.Height, cfg.MaxHeight)
+	case cfg.MaxPixels > 0 && int64(imgConfig.Width)*int64(imgConfig.Height) > cfg.MaxPixels:
+		return fmt.Errorf("%w: %dx%d pixels exceed %d",
+			domain.ErrImageDimensionsTooLarge, imgConfig.Width, imgConfig.Height, cfg.MaxPixels)
+	default:
+		return nil
+	}
+}
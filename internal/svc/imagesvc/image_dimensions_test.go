@@ -0,0 +1,66 @@
+package imagesvc_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+// buildPNGBomb returns a small PNG image whose header claims the given dimensions.
+func buildPNGBomb(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+
+	data := slices.Clone(encodeTestImage(t, imagesvc.MIMETypePNG, 1, 1, false))
+
+	// The IHDR chunk follows the 8 byte signature: length, type, width, height, ..., CRC
+	binary.BigEndian.PutUint32(data[16:20], width)
+	binary.BigEndian.PutUint32(data[20:24], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+func TestBlobImageService_CheckUploadConstraintsDimensions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		maxWidth  int
+		maxHeight int
+		maxPixels int64
+		data      []byte
+		wantErr   error
+	}{
+		{name: "unlimited", data: encodeTestImage(t, imagesvc.MIMETypePNG, 64, 32, false)},
+		{name: "within limits", maxWidth: 64, maxHeight: 32, maxPixels: 2048, data: encodeTestImage(t, imagesvc.MIMETypePNG, 64, 32, false)},
+		{name: "too wide", maxWidth: 63, data: encodeTestImage(t, imagesvc.MIMETypePNG, 64, 32, false), wantErr: domain.ErrImageDimensionsTooLarge},
+		{name: "too high", maxHeight: 31, data: encodeTestImage(t, imagesvc.MIMETypePNG, 64, 32, false), wantErr: domain.ErrImageDimensionsTooLarge},
+		{name: "too many pixels", maxPixels: 2047, data: encodeTestImage(t, imagesvc.MIMETypePNG, 64, 32, false), wantErr: domain.ErrImageDimensionsTooLarge},
+		{name: "bomb", maxPixels: 100_000_000, data: buildPNGBomb(t, 100_000, 100_000), wantErr: domain.ErrImageDimensionsTooLarge},
+		{name: "undecodable header", maxPixels: 1, data: []byte("\x89PNG\r\n\x1a\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig("")
+			cfg.MaxWidth, cfg.MaxHeight, cfg.MaxPixels = tt.maxWidth, tt.maxHeight, tt.maxPixels
+
+			imageSvc, err := newTestImageService(t, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			_, _, err = imageSvc.CheckUploadConstraints("photo.png", int64(len(tt.data)), tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckUploadConstraints() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
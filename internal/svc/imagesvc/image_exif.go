@@ -0,0 +1,409 @@
+package imagesvc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// EXIF tags read by extractExif.
+const (
+	exifTagMake               = 0x010F
+	exifTagModel              = 0x0110
+	exifTagOrientation        = 0x0112
+	exifTagSoftware           = 0x0131
+	exifTagDateTime           = 0x0132
+	exifTagExifIFD            = 0x8769
+	exifTagGPSIFD             = 0x8825
+	exifTagExposureTime       = 0x829A
+	exifTagFNumber            = 0x829D
+	exifTagISO                = 0x8827
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagFocalLength        = 0x920A
+	exifTagLensModel          = 0xA434
+
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	gpsTagAltitudeRef  = 0x0005
+	gpsTagAltitude     = 0x0006
+)
+
+// TIFF field types of EXIF values.
+const (
+	tiffTypeByte      = 1
+	tiffTypeASCII     = 2
+	tiffTypeShort     = 3
+	tiffTypeLong      = 4
+	tiffTypeRational  = 5
+	tiffTypeUndefined = 7
+	tiffTypeSLong     = 9
+	tiffTypeSRational = 10
+)
+
+// tiffMagic identifies TIFF structures following the byte order mark.
+const tiffMagic = 42
+
+// exifMaxIFDEntries is the maximum number of entries read from an IFD, limiting the work spent on corrupt files.
+const exifMaxIFDEntries = 512
+
+// exifDateTimeLayout is the layout of EXIF date and time values.
+const exifDateTimeLayout = "2006:01:02 15:04:05"
+
+// tiffTypeSizes maps the TIFF field types to the size of their values in bytes.
+//
+//nolint:gochecknoglobals
+var tiffTypeSizes = map[uint16]int{
+	tiffTypeByte:      1,
+	tiffTypeASCII:     1,
+	tiffTypeShort:     2,
+	tiffTypeLong:      4,
+	tiffTypeRational:  8,
+	tiffTypeUndefined: 1,
+	tiffTypeSLong:     4,
+	tiffTypeSRational: 8,
+}
+
+// extractExif returns the EXIF metadata of a JPEG or PNG image. GPS positions are only
+// included if keepGPS is true. Returns empty metadata for images without EXIF metadata
+// or of other formats, or ErrMalformedImage if the metadata cannot be parsed.
+func extractExif(data []byte, mimeType string, keepGPS bool) (domain.MediaExif, error) {
+	payload, err := exifPayload(data, mimeType)
+	if err != nil || payload == nil {
+		return domain.MediaExif{}, err
+	}
+
+	tiff, err := newTIFFReader(payload)
+	if err != nil {
+		return domain.MediaExif{}, err
+	}
+
+	return tiff.exif(keepGPS)
+}
+
+// exifPayload returns the TIFF structure holding the EXIF metadata of a JPEG or PNG image,
+// or nil if there is none or the image is of another format.
+func exifPayload(data []byte, mimeType string) ([]byte, error) {
+	switch mimeType {
+	case MIMETypeJPEG:
+		return jpegExifPayload(data)
+	case MIMETypePNG:
+		return pngExifPayload(data)
+	default:
+		return nil, nil
+	}
+}
+
+// jpegExifPayload returns the TIFF structure of the first EXIF APP1 segment of a JPEG file,
+// or nil if there is none.
+func jpegExifPayload(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != jpegMarkerPrefix || data[1] != jpegMarkerSOI {
+		return nil, fmt.Errorf("%w: missing JPEG start of image", ErrMalformedImage)
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != jpegMarkerPrefix {
+			return nil, fmt.Errorf("%w: expected JPEG marker at offset %d", ErrMalformedImage, pos)
+		}
+
+		marker := data[pos+1]
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			break
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			return nil, fmt.Errorf("%w: truncated JPEG segment at offset %d", ErrMalformedImage, pos)
+		}
+
+		if marker == jpegMarkerAPP1 && bytes.HasPrefix(data[pos+4:end], jpegExifHeader) {
+			return data[pos+4+len(jpegExifHeader) : end], nil
+		}
+
+		pos = end
+	}
+
+	return nil, nil
+}
+
+// pngExifPayload returns the TIFF structure of the eXIf chunk of a PNG file, or nil if there is none.
+func pngExifPayload(data []byte) ([]byte, error) {
+	if len(data) < pngSignatureLength {
+		return nil, fmt.Errorf("%w: missing PNG signature", ErrMalformedImage)
+	}
+
+	for pos := pngSignatureLength; pos+8 <= len(data); {
+		end := pos + pngChunkOverhead + int(binary.BigEndian.Uint32(data[pos:pos+4]))
+		if end > len(data) || end < pos {
+			return nil, fmt.Errorf("%w: truncated PNG chunk at offset %d", ErrMalformedImage, pos)
+		}
+
+		if bytes.Equal(data[pos+4:pos+8], pngExifChunk) {
+			return data[pos+8 : end-4], nil
+		}
+
+		pos = end
+	}
+
+	return nil, nil
+}
+
+// tiffReader reads the IFDs of the TIFF structure holding EXIF metadata.
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// tiffField is a field of an IFD with its raw value.
+type tiffField struct {
+	typ   uint16
+	count int
+	value []byte
+	order binary.ByteOrder
+}
+
+// newTIFFReader validates the TIFF header of data.
+func newTIFFReader(data []byte) (*tiffReader, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%w: truncated TIFF header", ErrMalformedImage)
+	}
+
+	var order binary.ByteOrder
+
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: invalid TIFF byte order", ErrMalformedImage)
+	}
+
+	if order.Uint16(data[2:4]) != tiffMagic {
+		return nil, fmt.Errorf("%w: invalid TIFF magic number", ErrMalformedImage)
+	}
+
+	return &tiffReader{data: data, order: order}, nil
+}
+
+// exif reads the metadata of IFD0 and the EXIF and GPS IFDs it links to.
+func (tiff *tiffReader) exif(keepGPS bool) (domain.MediaExif, error) {
+	ifd0, err := tiff.ifd(tiff.order.Uint32(tiff.data[4:8]))
+	if err != nil {
+		return domain.MediaExif{}, err
+	}
+
+	exifIFD := map[uint16]tiffField{}
+	if field, ok := ifd0[exifTagExifIFD]; ok {
+		if exifIFD, err = tiff.ifd(field.uint(0)); err != nil {
+			return domain.MediaExif{}, err
+		}
+	}
+
+	exif := domain.MediaExif{
+		Make:         ifd0[exifTagMake].string(),
+		Model:        ifd0[exifTagModel].string(),
+		LensModel:    exifIFD[exifTagLensModel].string(),
+		Software:     ifd0[exifTagSoftware].string(),
+		TakenAt:      exifTakenAt(exifIFD, ifd0),
+		Orientation:  int(ifd0[exifTagOrientation].uint(0)),
+		ExposureTime: exifIFD[exifTagExposureTime].exposureTime(),
+		FNumber:      exifIFD[exifTagFNumber].rational(0),
+		ISO:          int(exifIFD[exifTagISO].uint(0)),
+		FocalLength:  exifIFD[exifTagFocalLength].rational(0),
+		GPS:          nil,
+	}
+
+	if field, ok := ifd0[exifTagGPSIFD]; ok && keepGPS {
+		gpsIFD, err := tiff.ifd(field.uint(0))
+		if err != nil {
+			return domain.MediaExif{}, err
+		}
+
+		exif.GPS = exifGPS(gpsIFD)
+	}
+
+	return exif, nil
+}
+
+// ifd reads the fields of the IFD at the given offset.
+func (tiff *tiffReader) ifd(offset uint32) (map[uint16]tiffField, error) {
+	if uint64(offset)+2 > uint64(len(tiff.data)) {
+		return nil, fmt.Errorf("%w: IFD offset %d out of range", ErrMalformedImage, offset)
+	}
+
+	pos := int(offset)
+	count := min(int(tiff.order.Uint16(tiff.data[pos:pos+2])), exifMaxIFDEntries)
+	fields := make(map[uint16]tiffField, count)
+
+	for i := range count {
+		entry := pos + 2 + i*12 // IFD entries are 12 bytes long
+		if entry+12 > len(tiff.data) {
+			return nil, fmt.Errorf("%w: truncated IFD at offset %d", ErrMalformedImage, offset)
+		}
+
+		tag := tiff.order.Uint16(tiff.data[entry : entry+2])
+		typ := tiff.order.Uint16(tiff.data[entry+2 : entry+4])
+		valueCount := tiff.order.Uint32(tiff.data[entry+4 : entry+8])
+
+		size, ok := tiffTypeSizes[typ]
+		if !ok || uint64(valueCount)*uint64(size) > uint64(len(tiff.data)) {
+			continue // Unknown types and implausible counts are skipped
+		}
+
+		length := int(valueCount) * size
+		valuePos := entry + 8
+
+		if length > 4 { // Values of up to 4 bytes are stored inline
+			valuePos = int(tiff.order.Uint32(tiff.data[entry+8 : entry+12]))
+			if valuePos < 0 || valuePos+length > len(tiff.data) {
+				continue
+			}
+		}
+
+		fields[tag] = tiffField{
+			typ:   typ,
+			count: int(valueCount),
+			value: tiff.data[valuePos : valuePos+length],
+			order: tiff.order,
+		}
+	}
+
+	return fields, nil
+}
+
+// string returns the value of an ASCII field without trailing NULs and spaces.
+func (field tiffField) string() string {
+	if field.typ != tiffTypeASCII {
+		return ""
+	}
+
+	return strings.TrimRight(string(field.value), "\x00 ")
+}
+
+// uint returns the i-th value of a BYTE, SHORT or LONG field, or 0 if there is none.
+func (field tiffField) uint(i int) uint32 {
+	if i >= field.count {
+		return 0
+	}
+
+	switch field.typ {
+	case tiffTypeByte:
+		return uint32(field.value[i])
+	case tiffTypeShort:
+		return uint32(field.order.Uint16(field.value[i*2:]))
+	case tiffTypeLong:
+		return field.order.Uint32(field.value[i*4:])
+	default:
+		return 0
+	}
+}
+
+// fraction returns the numerator and denominator of the i-th value of a RATIONAL or
+// SRATIONAL field, or 0/0 if there is none.
+func (field tiffField) fraction(i int) (float64, float64) {
+	if i >= field.count {
+		return 0, 0
+	}
+
+	num := field.order.Uint32(field.value[i*8:])
+	den := field.order.Uint32(field.value[i*8+4:])
+
+	switch field.typ {
+	case tiffTypeRational:
+		return float64(num), float64(den)
+	case tiffTypeSRational:
+		return float64(int32(num)), float64(int32(den)) //nolint:gosec // Reinterpreted as signed
+	default:
+		return 0, 0
+	}
+}
+
+// rational returns the i-th value of a RATIONAL or SRATIONAL field, or 0 if there is none.
+func (field tiffField) rational(i int) float64 {
+	num, den := field.fraction(i)
+	if den == 0 {
+		return 0
+	}
+
+	return num / den
+}
+
+// exposureTime formats an exposure time as a fraction of a second like cameras display it,
+// e.g. "1/250", or in seconds for exposures of a second or longer.
+func (field tiffField) exposureTime() string {
+	num, den := field.fraction(0)
+	if num <= 0 || den <= 0 {
+		return ""
+	}
+
+	if num >= den {
+		return strconv.FormatFloat(num/den, 'f', -1, 64)
+	}
+
+	return "1/" + strconv.FormatFloat(math.Round(den/num), 'f', -1, 64)
+}
+
+// exifTakenAt returns the time the photo was taken, falling back to the modification time
+// of the file. The time is formatted as RFC 3339 if its offset is known, or without offset otherwise.
+func exifTakenAt(exifIFD, ifd0 map[uint16]tiffField) string {
+	value := exifIFD[exifTagDateTimeOriginal].string()
+	offset := exifIFD[exifTagOffsetTimeOriginal].string()
+
+	if value == "" {
+		value, offset = ifd0[exifTagDateTime].string(), ""
+	}
+
+	if offset != "" {
+		if takenAt, err := time.Parse(exifDateTimeLayout+"-07:00", value+offset); err == nil {
+			return takenAt.Format(time.RFC3339)
+		}
+	}
+
+	takenAt, err := time.Parse(exifDateTimeLayout, value)
+	if err != nil {
+		return ""
+	}
+
+	return takenAt.Format("2006-01-02T15:04:05")
+}
+
+// exifGPS returns the position recorded in a GPS IFD, or nil if there is none.
+func exifGPS(gpsIFD map[uint16]tiffField) *domain.MediaExifGPS {
+	latitude, latOK := gpsCoordinate(gpsIFD[gpsTagLatitude], gpsIFD[gpsTagLatitudeRef].string(), "S")
+	longitude, lonOK := gpsCoordinate(gpsIFD[gpsTagLongitude], gpsIFD[gpsTagLongitudeRef].string(), "W")
+
+	if !latOK || !lonOK {
+		return nil
+	}
+
+	altitude := gpsIFD[gpsTagAltitude].rational(0)
+	if gpsIFD[gpsTagAltitudeRef].uint(0) == 1 {
+		altitude = -altitude
+	}
+
+	return &domain.MediaExifGPS{Latitude: latitude, Longitude: longitude, Altitude: altitude}
+}
+
+// gpsCoordinate converts a coordinate given as degrees, minutes and seconds to decimal degrees,
+// negated if ref is the negative reference direction.
+func gpsCoordinate(field tiffField, ref, negativeRef string) (float64, bool) {
+	if field.count < 3 { // Degrees, minutes and seconds
+		return 0, false
+	}
+
+	degrees := field.rational(0) + field.rational(1)/60 + field.rational(2)/3600
+	if strings.EqualFold(ref, negativeRef) {
+		degrees = -degrees
+	}
+
+	return degrees, true
+}
@@ -0,0 +1,139 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// ErrMalformedImage is returned when the structure of an image file cannot be parsed.
+var ErrMalformedImage = errors.New("malformed image")
+
+const (
+	jpegMarkerPrefix = 0xFF
+	jpegMarkerSOI    = 0xD8 // Start of image
+	jpegMarkerAPP1   = 0xE1 // Application segment 1, holding EXIF and XMP data
+	jpegMarkerSOS    = 0xDA // Start of scan, followed by the entropy-coded image data
+	jpegMarkerEOI    = 0xD9 // End of image
+
+	pngSignatureLength = 8
+	pngChunkOverhead   = 12 // Length, type and CRC
+)
+
+//nolint:gochecknoglobals
+var (
+	jpegExifHeader = []byte("Exif\x00\x00")
+	pngExifChunk   = []byte("eXIf")
+)
+
+// exifStripProcessor is the "exif_strip" processor, removing EXIF metadata such as
+// camera details, timestamps and GPS positions from JPEG and PNG images.
+// The image data is copied as is, so stripping is lossless.
+type exifStripProcessor struct{}
+
+func newExifStripProcessor(ImageConfig) (Processor, error) {
+	return exifStripProcessor{}, nil
+}
+
+// Process implements Processor by removing the EXIF metadata of the image.
+func (exifStripProcessor) Process(_ context.Context, image domain.Media) (domain.Media, error) {
+	var (
+		stripped []byte
+		err      error
+	)
+
+	switch image.MIMEType() {
+	case MIMETypeJPEG:
+		stripped, err = stripJPEGExif(image.Bytes())
+	case MIMETypePNG:
+		stripped, err = stripPNGExif(image.Bytes())
+	default:
+		return image, nil
+	}
+
+	if err != nil {
+		return domain.Media{}, err
+	}
+
+	if len(stripped) == len(image.Bytes()) {
+		return image, nil
+	}
+
+	return withProcessedData(image, stripped), nil
+}
+
+// stripJPEGExif removes all APP1 segments holding EXIF data from a JPEG file.
+func stripJPEGExif(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != jpegMarkerPrefix || data[1] != jpegMarkerSOI {
+		return nil, fmt.Errorf("%w: missing JPEG start of image", ErrMalformedImage)
+	}
+
+	var (
+		stripped = bytes.NewBuffer(make([]byte, 0, len(data)))
+		pos      = 2
+	)
+
+	stripped.Write(data[:pos])
+
+	for pos+4 <= len(data) {
+		if data[pos] != jpegMarkerPrefix {
+			return nil, fmt.Errorf("%w: expected JPEG marker at offset %d", ErrMalformedImage, pos)
+		}
+
+		marker := data[pos+1]
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			break
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			return nil, fmt.Errorf("%w: truncated JPEG segment at offset %d", ErrMalformedImage, pos)
+		}
+
+		if marker != jpegMarkerAPP1 || !bytes.HasPrefix(data[pos+4:end], jpegExifHeader) {
+			stripped.Write(data[pos:end])
+		}
+
+		pos = end
+	}
+
+	// Copy the image data unchanged
+	stripped.Write(data[pos:])
+
+	return stripped.Bytes(), nil
+}
+
+// stripPNGExif removes all eXIf chunks from a PNG file.
+func stripPNGExif(data []byte) ([]byte, error) {
+	if len(data) < pngSignatureLength {
+		return nil, fmt.Errorf("%w: missing PNG signature", ErrMalformedImage)
+	}
+
+	var (
+		stripped = bytes.NewBuffer(make([]byte, 0, len(data)))
+		pos      = pngSignatureLength
+	)
+
+	stripped.Write(data[:pos])
+
+	for pos+8 <= len(data) {
+		end := pos + pngChunkOverhead + int(binary.BigEndian.Uint32(data[pos:pos+4]))
+		if end > len(data) || end < pos {
+			return nil, fmt.Errorf("%w: truncated PNG chunk at offset %d", ErrMalformedImage, pos)
+		}
+
+		if !bytes.Equal(data[pos+4:pos+8], pngExifChunk) {
+			stripped.Write(data[pos:end])
+		}
+
+		pos = end
+	}
+
+	stripped.Write(data[pos:])
+
+	return stripped.Bytes(), nil
+}
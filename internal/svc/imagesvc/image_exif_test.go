@@ -0,0 +1,211 @@
+package imagesvc_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+// testTIFFEntry is a field of an IFD built by buildTestIFD.
+type testTIFFEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// buildTestIFD encodes a big-endian IFD starting at offset start, followed by the values
+// not fitting into their entries.
+func buildTestIFD(start int, entries []testTIFFEntry) []byte {
+	ifd := binary.BigEndian.AppendUint16(nil, uint16(len(entries))) //nolint:gosec
+	external := start + 2 + 12*len(entries) + 4
+
+	var values []byte
+
+	for _, entry := range entries {
+		ifd = binary.BigEndian.AppendUint16(ifd, entry.tag)
+		ifd = binary.BigEndian.AppendUint16(ifd, entry.typ)
+		ifd = binary.BigEndian.AppendUint32(ifd, entry.count)
+
+		if len(entry.value) <= 4 {
+			ifd = append(ifd, entry.value...)
+			ifd = append(ifd, make([]byte, 4-len(entry.value))...)
+
+			continue
+		}
+
+		ifd = binary.BigEndian.AppendUint32(ifd, uint32(external+len(values))) //nolint:gosec
+		values = append(values, entry.value...)
+	}
+
+	ifd = binary.BigEndian.AppendUint32(ifd, 0) // No next IFD
+
+	return append(ifd, values...)
+}
+
+func testASCII(s string) testTIFFEntry {
+	return testTIFFEntry{typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)} //nolint:gosec
+}
+
+func testLong(v uint32) testTIFFEntry {
+	return testTIFFEntry{typ: 4, count: 1, value: binary.BigEndian.AppendUint32(nil, v)}
+}
+
+// buildTestExif returns an EXIF APP1 segment with camera, exposure and GPS metadata.
+func buildTestExif() []byte {
+	rationals := func(values ...uint32) testTIFFEntry {
+		entry := testTIFFEntry{typ: 5, count: uint32(len(values) / 2), value: nil} //nolint:gosec
+		for _, v := range values {
+			entry.value = binary.BigEndian.AppendUint32(entry.value, v)
+		}
+
+		return entry
+	}
+
+	withTag := func(tag uint16, entry testTIFFEntry) testTIFFEntry {
+		entry.tag = tag
+
+		return entry
+	}
+
+	exifIFD := []testTIFFEntry{
+		withTag(0x829A, rationals(1, 250)),
+		withTag(0x829D, rationals(28, 10)),
+		withTag(0x9003, testASCII("2024:05:01 12:30:00")),
+		withTag(0x9011, testASCII("+02:00")),
+	}
+	gpsIFD := []testTIFFEntry{
+		withTag(0x0001, testASCII("N")),
+		withTag(0x0002, rationals(52, 1, 30, 1, 0, 1)),
+		withTag(0x0003, testASCII("W")),
+		withTag(0x0004, rationals(13, 1, 15, 1, 0, 1)),
+	}
+
+	// The sizes of the IFDs do not depend on the offsets, so they are built twice
+	ifd0 := func(exifOffset, gpsOffset uint32) []byte {
+		return buildTestIFD(8, []testTIFFEntry{
+			withTag(0x010F, testASCII("Canon")),
+			withTag(0x0110, testASCII("EOS R5")),
+			withTag(0x8769, testLong(exifOffset)),
+			withTag(0x8825, testLong(gpsOffset)),
+		})
+	}
+
+	exifOffset := 8 + len(ifd0(0, 0))
+	exifData := buildTestIFD(exifOffset, exifIFD)
+	gpsOffset := exifOffset + len(exifData)
+
+	tiff := slices.Concat([]byte("MM\x00\x2A\x00\x00\x00\x08"),
+		ifd0(uint32(exifOffset), uint32(gpsOffset)), exifData, buildTestIFD(gpsOffset, gpsIFD)) //nolint:gosec
+
+	payload := slices.Concat([]byte("Exif\x00\x00"), tiff)
+
+	return slices.Concat([]byte{0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(payload)+2)), payload) //nolint:gosec
+}
+
+func TestBlobImageService_Exif(t *testing.T) {
+	t.Parallel()
+
+	data := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 16, true)
+	withExif := slices.Concat(data[:2], buildTestExif(), data[2:])
+
+	wantExif := domain.MediaExif{
+		Make:         "Canon",
+		Model:        "EOS R5",
+		TakenAt:      "2024-05-01T12:30:00+02:00",
+		ExposureTime: "1/250",
+		FNumber:      2.8,
+		GPS:          &domain.MediaExifGPS{Latitude: 52.5, Longitude: -13.25},
+	}
+
+	tests := []struct {
+		name     string
+		keepGPS  bool
+		grant    bool
+		wantGPS  bool
+		stripped bool
+	}{
+		{name: "owner", keepGPS: true, wantGPS: true},
+		{name: "owner without gps", keepGPS: false},
+		{name: "granted user", keepGPS: true, grant: true},
+		{name: "stripped on ingest", keepGPS: true, wantGPS: true, stripped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+			mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+			if err != nil {
+				t.Fatalf("new media service: %v", err)
+			}
+
+			cfg := testConfig("")
+			if tt.stripped {
+				cfg = testConfig("exif_strip")
+			}
+
+			cfg.ExifExtract = true
+			cfg.ExifGPS = tt.keepGPS
+
+			imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			stored, err := imageSvc.Store(ctx, domain.NewMedia(withExif, domain.MediaMeta{
+				Filename: "photo.jpg",
+				Owner:    "alice",
+				MIMEType: imagesvc.MIMETypeJPEG,
+			}))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			readCtx := ctx
+			if tt.grant {
+				readCtx = context_.WithGrant(context_.WithUsername(context.Background(), "bob"), string(stored.ID()))
+			}
+
+			exif, err := imageSvc.Exif(readCtx, stored.ID())
+			if err != nil {
+				t.Fatalf("Exif() error = %v", err)
+			}
+
+			want := wantExif
+			if !tt.wantGPS {
+				want.GPS = nil
+			}
+
+			if (exif.GPS == nil) != (want.GPS == nil) || exif.GPS != nil && *exif.GPS != *want.GPS {
+				t.Errorf("Exif().GPS = %+v, want %+v", exif.GPS, want.GPS)
+			}
+
+			exif.GPS, want.GPS = nil, nil
+			if exif != want {
+				t.Errorf("Exif() = %+v, want %+v", exif, want)
+			}
+
+			if err := imageSvc.Delete(ctx, stored.ID()); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			if _, err := imageSvc.Exif(ctx, stored.ID()); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Exif() after Delete() error = %v, want %v", err, os.ErrNotExist)
+			}
+		})
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
+	"maps"
+	"slices"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
 )
 
@@ -15,6 +19,9 @@ const (
 	MIMETypeJPEG = "image/jpeg"
 	MIMETypePNG  = "image/png"
 	MIMETypeTIFF = "image/tiff"
+	MIMETypeHEIC = "image/heic"
+	MIMETypeHEIF = "image/heif"
+	MIMETypeBMP  = "image/bmp"
 )
 
 //nolint:gochecknoglobals
@@ -25,27 +32,80 @@ var (
 		".png":  MIMETypePNG,
 		".tiff": MIMETypeTIFF,
 		".tif":  MIMETypeTIFF,
+		".heic": MIMETypeHEIC,
+		".heif": MIMETypeHEIF,
+		".bmp":  MIMETypeBMP,
+	}
+
+	// imageFormatTypes maps the output format names of transform specs to MIME types.
+	imageFormatTypes = map[string]string{
+		"jpeg": MIMETypeJPEG,
+		"png":  MIMETypePNG,
+		"tiff": MIMETypeTIFF,
+		"bmp":  MIMETypeBMP,
+	}
+
+	// imageNegotiableFormats lists the output formats offered to the Accept header of downloads,
+	// in order of preference.
+	imageNegotiableFormats = []string{"jpeg", "png", "tiff", "bmp"}
+
+	// imageTypeExts maps MIME types to their preferred filename extension.
+	imageTypeExts = map[string]string{
+		MIMETypeJPEG: ".jpg",
+		MIMETypePNG:  ".png",
+		MIMETypeTIFF: ".tiff",
+		MIMETypeHEIC: ".heic",
+		MIMETypeHEIF: ".heif",
+		MIMETypeBMP:  ".bmp",
 	}
 
 	imageExtHeaders = map[string][]string{
 		MIMETypeJPEG: {"\xFF\xD8"},
 		MIMETypePNG:  {"\x89\x50\x4E\x47\x0D\x0A\x1A\x0A"},
 		MIMETypeTIFF: {"\x49\x49\x2A\x00", "\x4D\x4D\x00\x2A"},
+		MIMETypeBMP:  {"BM"},
 	}
 
+	// imageTypeSniffers detect the types whose files cannot be told apart by a fixed header.
+	imageTypeSniffers = map[string]func([]byte) bool{
+		MIMETypeHEIC: isHEIF,
+		MIMETypeHEIF: isHEIF,
+	}
+
+	// imageDecoders maps MIME types to their decoders. HEIC/HEIF images have none built in,
+	// as decoding HEVC is beyond the standard library.
 	imageDecoders = map[string]func(io.Reader) (image.Image, error){
 		MIMETypeJPEG: jpeg.Decode,
 		MIMETypeTIFF: tiff.Decode,
 		MIMETypePNG:  png.Decode,
+		MIMETypeBMP:  bmp.Decode,
+	}
+
+	imageConfigDecoders = map[string]func(io.Reader) (image.Config, error){
+		MIMETypeJPEG: jpeg.DecodeConfig,
+		MIMETypeTIFF: tiff.DecodeConfig,
+		MIMETypePNG:  png.DecodeConfig,
+		MIMETypeBMP:  bmp.DecodeConfig,
+		MIMETypeHEIC: decodeHEIFConfig,
+		MIMETypeHEIF: decodeHEIFConfig,
 	}
 
 	imageEncoders = map[string]func(io.Writer, image.Image) error{
 		MIMETypeJPEG: func(w io.Writer, i image.Image) error { return jpeg.Encode(w, i, nil) },
 		MIMETypeTIFF: func(w io.Writer, i image.Image) error { return tiff.Encode(w, i, nil) },
 		MIMETypePNG:  png.Encode,
+		MIMETypeBMP:  bmp.Encode,
 	}
 )
 
+// TransformFormats returns the output format names supported in transform specs.
+func TransformFormats() transform.Formats {
+	formats := slices.Collect(maps.Keys(imageFormatTypes))
+	slices.Sort(formats)
+
+	return formats
+}
+
 func getDecoderByType(mimeType string) (func(io.Reader) (image.Image, error), error) {
 	decoder, ok := imageDecoders[mimeType]
 	if !ok {
@@ -55,6 +115,15 @@ func getDecoderByType(mimeType string) (func(io.Reader) (image.Image, error), er
 	return decoder, nil
 }
 
+func getConfigDecoderByType(mimeType string) (func(io.Reader) (image.Config, error), error) {
+	decoder, ok := imageConfigDecoders[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", domain.ErrImageTypeNotSupported, mimeType)
+	}
+
+	return decoder, nil
+}
+
 func getEncoderByType(mimeType string) (func(io.Writer, image.Image) error, error) {
 	encoder, ok := imageEncoders[mimeType]
 	if !ok {
@@ -0,0 +1,78 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"golang.org/x/image/bmp"
+)
+
+func TestBlobImageService_BMP(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := bmp.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 8, 6))); err != nil {
+		t.Fatalf("encode bmp: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		wantType string
+		wantErr  error
+	}{
+		{name: "bmp", filename: "scan.BMP", data: buffer.Bytes(), wantType: imagesvc.MIMETypeBMP},
+		{
+			name: "png named bmp", filename: "scan.bmp", data: encodeTestImage(t, imagesvc.MIMETypePNG, 8, 6, false),
+			wantErr: domain.ErrImageTypeMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			mimeType, _, err := imageSvc.CheckUploadConstraints(tt.filename, int64(len(tt.data)), tt.data)
+			if mimeType != tt.wantType || !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckUploadConstraints() = %q, %v, want %q, %v", mimeType, err, tt.wantType, tt.wantErr)
+			}
+		})
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(buffer.Bytes(), domain.MediaMeta{
+		Filename: "scan.bmp", Owner: "alice", MIMEType: imagesvc.MIMETypeBMP,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Resized BMP images stay BMP images unless converted to another format
+	resized, err := imageSvc.Transform(ctx, stored.ID(), transform.Spec{Width: 4})
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	if got, format, err := image.DecodeConfig(bytes.NewReader(resized.Bytes())); err != nil || format != "bmp" || got.Width != 4 {
+		t.Errorf("resized image = %+v %q, %v, want 4 pixels wide BMP", got, format, err)
+	}
+
+	converted, err := imageSvc.Transform(ctx, stored.ID(), transform.Spec{Format: "png"})
+	if err != nil || converted.MIMEType() != imagesvc.MIMETypePNG || converted.Meta().Filename != "scan.png" {
+		t.Errorf("Transform(png) = %s %q, %v, want PNG", converted.MIMEType(), converted.Meta().Filename, err)
+	}
+}
@@ -0,0 +1,259 @@
+package imagesvc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+)
+
+// ErrInvalidHEIF is returned when a HEIC/HEIF image is malformed or lacks the dimensions
+// of its primary image.
+var ErrInvalidHEIF = errors.New("invalid heif image")
+
+// heifMaxHeaderSize is the maximum size of the boxes read to find the dimensions of a HEIF image.
+const heifMaxHeaderSize = 1 << 20 // 1MiB
+
+// heifBrands are the ftyp brands of HEIC/HEIF images (ISO/IEC 23008-12).
+//
+//nolint:gochecknoglobals
+var heifBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx"}
+
+// isHEIF reports whether data starts with the ftyp box of a HEIC/HEIF image. Images of the
+// generic image brands "mif1" and "msf1" are accepted unless they are AVIF images.
+func isHEIF(data []byte) bool {
+	//nolint:mnd // box size and type, major brand, minor version
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+
+	size := min(int(binary.BigEndian.Uint32(data)), len(data))
+	major := string(data[8:12])
+
+	var compatible []string
+	for offset := 16; offset+4 <= size; offset += 4 {
+		compatible = append(compatible, string(data[offset:offset+4]))
+	}
+
+	if slices.Contains(heifBrands, major) ||
+		slices.ContainsFunc(compatible, func(brand string) bool { return slices.Contains(heifBrands, brand) }) {
+		return true
+	}
+
+	return (major == "mif1" || major == "msf1") &&
+		!slices.Contains(compatible, "avif") && !slices.Contains(compatible, "avis")
+}
+
+// heifBox is a box of the ISO base media file format.
+type heifBox struct {
+	typ  string
+	data []byte // Content of the box, without its header
+}
+
+// readHEIFBoxes splits data into its boxes. If a box is malformed, the boxes preceding it
+// are returned along with the error.
+func readHEIFBoxes(data []byte) ([]heifBox, error) {
+	var boxes []heifBox
+
+	for len(data) > 0 {
+		//nolint:mnd // 32 bit size and type
+		if len(data) < 8 {
+			return boxes, fmt.Errorf("%w: truncated box header", ErrInvalidHEIF)
+		}
+
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8) //nolint:mnd
+		typ := string(data[4:8])
+
+		switch size {
+		case 0: // Box extends to the end
+			size = uint64(len(data))
+		case 1: // 64 bit size follows the type
+			//nolint:mnd
+			if len(data) < 16 {
+				return boxes, fmt.Errorf("%w: truncated box header", ErrInvalidHEIF)
+			}
+
+			size, header = binary.BigEndian.Uint64(data[8:]), 16 //nolint:mnd
+		}
+
+		if size < header || size > uint64(len(data)) {
+			return boxes, fmt.Errorf("%w: box %q exceeds its parent", ErrInvalidHEIF, typ)
+		}
+
+		boxes = append(boxes, heifBox{typ: typ, data: data[header:size]})
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+// findHEIFBox returns the first box of the given type.
+func findHEIFBox(boxes []heifBox, typ string) (heifBox, bool) {
+	for _, box := range boxes {
+		if box.typ == typ {
+			return box, true
+		}
+	}
+
+	return heifBox{}, false
+}
+
+// decodeHEIFConfig decodes the dimensions of the primary image of a HEIC/HEIF image from the
+// "ispe" property of its "meta" box, swapped if rotated by 90 or 270 degrees by an "irot" property.
+// The color model is always YCbCr, as HEVC coded images are decoded to YCbCr.
+func decodeHEIFConfig(reader io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, heifMaxHeaderSize))
+	if err != nil {
+		return image.Config{}, fmt.Errorf("read: %w", err)
+	}
+
+	// The meta box precedes the mdat box, which may be truncated by the limit
+	boxes, _ := readHEIFBoxes(data)
+
+	if !isHEIF(data) {
+		return image.Config{}, fmt.Errorf("%w: no heif ftyp box", ErrInvalidHEIF)
+	}
+
+	meta, ok := findHEIFBox(boxes, "meta")
+	if !ok || len(meta.data) < 4 { //nolint:mnd // full box header
+		return image.Config{}, fmt.Errorf("%w: no meta box", ErrInvalidHEIF)
+	}
+
+	width, height, err := heifPrimaryDimensions(meta.data[4:])
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{ColorModel: color.YCbCrModel, Width: width, Height: height}, nil
+}
+
+// heifPrimaryDimensions returns the dimensions of the primary item of the content of a meta box.
+func heifPrimaryDimensions(meta []byte) (int, int, error) {
+	boxes, err := readHEIFBoxes(meta)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pitm, ok := findHEIFBox(boxes, "pitm")
+	if !ok || len(pitm.data) < 6 { //nolint:mnd // full box header and 16 bit item ID
+		return 0, 0, fmt.Errorf("%w: no primary item", ErrInvalidHEIF)
+	}
+
+	primary := uint32(binary.BigEndian.Uint16(pitm.data[4:]))
+	if pitm.data[0] != 0 && len(pitm.data) >= 8 { //nolint:mnd // 32 bit item ID
+		primary = binary.BigEndian.Uint32(pitm.data[4:])
+	}
+
+	iprp, ok := findHEIFBox(boxes, "iprp")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: no item properties", ErrInvalidHEIF)
+	}
+
+	iprpBoxes, err := readHEIFBoxes(iprp.data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ipco, ok := findHEIFBox(iprpBoxes, "ipco")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: no item properties", ErrInvalidHEIF)
+	}
+
+	properties, err := readHEIFBoxes(ipco.data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var width, height int
+
+	rotated := false
+
+	for _, index := range heifItemProperties(iprpBoxes, primary) {
+		if index < 1 || index > len(properties) {
+			continue
+		}
+
+		switch property := properties[index-1]; property.typ {
+		case "ispe":
+			if len(property.data) >= 12 { //nolint:mnd // full box header, 32 bit width and height
+				width = int(binary.BigEndian.Uint32(property.data[4:]))
+				height = int(binary.BigEndian.Uint32(property.data[8:]))
+			}
+		case "irot":
+			rotated = len(property.data) >= 1 && property.data[0]&1 == 1
+		}
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("%w: no dimensions of the primary item", ErrInvalidHEIF)
+	}
+
+	if rotated {
+		width, height = height, width
+	}
+
+	return width, height, nil
+}
+
+// heifItemProperties returns the 1-based indexes of the properties associated with the item
+// by the "ipma" boxes of the item properties.
+func heifItemProperties(iprp []heifBox, item uint32) []int {
+	var indexes []int
+
+	for _, ipma := range iprp {
+		if ipma.typ != "ipma" || len(ipma.data) < 8 { //nolint:mnd // full box header and entry count
+			continue
+		}
+
+		version, wideIndex := ipma.data[0], ipma.data[3]&1 == 1
+		entries, data := binary.BigEndian.Uint32(ipma.data[4:]), ipma.data[8:]
+
+		for range entries {
+			var id uint32
+
+			if version < 1 {
+				if len(data) < 3 { //nolint:mnd // 16 bit item ID and association count
+					return indexes
+				}
+
+				id, data = uint32(binary.BigEndian.Uint16(data)), data[2:]
+			} else {
+				if len(data) < 5 { //nolint:mnd // 32 bit item ID and association count
+					return indexes
+				}
+
+				id, data = binary.BigEndian.Uint32(data), data[4:]
+			}
+
+			count := int(data[0])
+			data = data[1:]
+
+			for range count {
+				var index int
+
+				if wideIndex {
+					if len(data) < 2 { //nolint:mnd
+						return indexes
+					}
+
+					index, data = int(binary.BigEndian.Uint16(data)&0x7fff), data[2:] //nolint:mnd
+				} else {
+					if len(data) < 1 {
+						return indexes
+					}
+
+					index, data = int(data[0]&0x7f), data[1:] //nolint:mnd
+				}
+
+				if id == item {
+					indexes = append(indexes, index)
+				}
+			}
+		}
+	}
+
+	return indexes
+}
@@ -0,0 +1,195 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+// testBox encodes an ISO base media file format box.
+func testBox(typ string, content ...[]byte) []byte {
+	data := slices.Concat(content...)
+
+	return slices.Concat(binary.BigEndian.AppendUint32(nil, uint32(8+len(data))), []byte(typ), data)
+}
+
+// buildTestHEIF builds a HEIF file whose primary item 2 has the given dimensions, rotated by
+// 90 degrees if rotated, with an unrelated thumbnail item 1 of 32x32 pixels.
+func buildTestHEIF(brand string, width, height int, rotated bool) []byte {
+	fullBox := []byte{0, 0, 0, 0}
+	ispe := func(width, height int) []byte {
+		return testBox("ispe", fullBox,
+			binary.BigEndian.AppendUint32(nil, uint32(width)), binary.BigEndian.AppendUint32(nil, uint32(height)))
+	}
+
+	irotAngle := byte(0)
+	if rotated {
+		irotAngle = 1
+	}
+
+	// Properties 1 and 2 are the dimensions of the thumbnail and primary item, 3 the rotation
+	ipco := testBox("ipco", ispe(32, 32), ispe(width, height), testBox("irot", []byte{irotAngle}))
+	ipma := testBox("ipma", fullBox, []byte{0, 0, 0, 2, 0, 1, 1, 0x81, 0, 2, 2, 0x82, 3})
+
+	return slices.Concat(
+		testBox("ftyp", []byte(brand), []byte{0, 0, 0, 0}, []byte("mif1")),
+		testBox("meta", fullBox,
+			testBox("hdlr", fullBox, []byte{0, 0, 0, 0}, []byte("pict"), make([]byte, 13)),
+			testBox("pitm", fullBox, []byte{0, 2}),
+			testBox("iprp", ipco, ipma),
+		),
+		testBox("mdat", make([]byte, 64)),
+	)
+}
+
+func TestBlobImageService_HEIC(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		filename   string
+		data       []byte
+		wantType   string
+		wantWidth  int
+		wantHeight int
+		wantErr    error
+	}{
+		{
+			name: "heic", filename: "IMG_0001.HEIC", data: buildTestHEIF("heic", 4032, 3024, false),
+			wantType: imagesvc.MIMETypeHEIC, wantWidth: 4032, wantHeight: 3024,
+		},
+		{
+			name: "rotated heic", filename: "IMG_0002.heic", data: buildTestHEIF("heic", 4032, 3024, true),
+			wantType: imagesvc.MIMETypeHEIC, wantWidth: 3024, wantHeight: 4032,
+		},
+		{
+			name: "generic heif", filename: "image.heif", data: buildTestHEIF("mif1", 640, 480, false),
+			wantType: imagesvc.MIMETypeHEIF, wantWidth: 640, wantHeight: 480,
+		},
+		{
+			name: "avif", filename: "image.heif", data: testBox("ftyp", []byte("avif"), make([]byte, 4), []byte("avif")),
+			wantErr: domain.ErrImageTypeMismatch,
+		},
+		{
+			name: "jpeg named heic", filename: "photo.heic", data: encodeTestImage(t, imagesvc.MIMETypeJPEG, 8, 8, true),
+			wantErr: domain.ErrImageTypeMismatch,
+		},
+		{
+			name: "no dimensions", filename: "photo.heic", data: testBox("ftyp", []byte("heic"), make([]byte, 4)),
+			wantType: imagesvc.MIMETypeHEIC, wantErr: imagesvc.ErrInvalidHEIF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			mimeType, _, err := imageSvc.CheckUploadConstraints(tt.filename, int64(len(tt.data)), tt.data)
+			if mimeType != tt.wantType || (tt.wantType == "" && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("CheckUploadConstraints() = %q, %v, want %q", mimeType, err, tt.wantType)
+			}
+
+			if tt.wantType == "" {
+				return
+			}
+
+			cfg, err := imageSvc.ValidateUpload(context.Background(), domain.NewMedia(tt.data, domain.MediaMeta{
+				Filename: tt.filename, MIMEType: mimeType,
+			}))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateUpload() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if cfg.Width != tt.wantWidth || cfg.Height != tt.wantHeight {
+				t.Errorf("ValidateUpload() = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestBlobImageService_HEICTransform(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig("")
+	cfg.ThumbnailWidths = "8"
+
+	imageSvc, err := newTestImageService(t, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	data := buildTestHEIF("heic", 16, 12, false)
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{
+		Filename: "IMG_0001.HEIC", Owner: "alice", MIMEType: imagesvc.MIMETypeHEIC,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	ht := imagesvc.NewHTTPTransport(imageSvc, nil, imagesvc.HTTPTransportConfig{
+		URLFileIDParam: "media_id",
+		URLWidthParam:  "width",
+		URLFormatParam: "format",
+	})
+
+	// HEIC images are stored and served as uploaded, but cannot be decoded to be transformed
+	tests := []struct {
+		name       string
+		spec       transform.Spec
+		query      string
+		wantStatus int
+		wantErr    error
+	}{
+		{name: "original", spec: transform.Spec{}, query: "", wantStatus: http.StatusOK},
+		{name: "resized", spec: transform.Spec{Width: 8}, query: "?width=8",
+			wantStatus: http.StatusUnsupportedMediaType, wantErr: domain.ErrImageTypeNotSupported},
+		{name: "converted", spec: transform.Spec{Format: "jpeg"}, query: "?format=jpeg",
+			wantStatus: http.StatusUnsupportedMediaType, wantErr: domain.ErrImageTypeNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transformed, err := imageSvc.Transform(ctx, stored.ID(), tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transform() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && (transformed.MIMEType() != imagesvc.MIMETypeHEIC || !bytes.Equal(transformed.Bytes(), data)) {
+				t.Errorf("Transform() = %s of %d bytes, want the original", transformed.MIMEType(), transformed.Size())
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/media/"+stored.ID().String()+tt.query, nil).WithContext(ctx)
+			req.SetPathValue("media_id", stored.ID().String())
+
+			rec := httptest.NewRecorder()
+			ht.HandleDownload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("download status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus == http.StatusOK && rec.Header().Get("Content-Type") != imagesvc.MIMETypeHEIC {
+				t.Errorf("Content-Type = %q, want %q", rec.Header().Get("Content-Type"), imagesvc.MIMETypeHEIC)
+			}
+		})
+	}
+}
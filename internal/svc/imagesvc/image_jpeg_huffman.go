@@ -0,0 +1,347 @@
+package imagesvc
+
+import (
+	"bytes"
+	"math"
+	"math/bits"
+)
+
+const (
+	jpegSymbolZRL   = 0xF0   // Run of 16 zero coefficients
+	jpegMaxZeroRun  = 15     // Longest run of zero coefficients preceding a coefficient
+	jpegMaxEOBRun   = 0x7FFF // Longest run of blocks ending with zero coefficients
+	jpegMaxCodeSize = 16
+)
+
+// jpegToken is a Huffman-coded symbol of a scan followed by size extra bits.
+type jpegToken struct {
+	table  uint8 // Index of the Huffman table in the scan
+	symbol uint8
+	size   uint8
+	bits   uint16
+}
+
+// jpegHuffmanSpec is the specification of a Huffman table as count of codes per length and
+// the values in order of their codes.
+type jpegHuffmanSpec struct {
+	counts [jpegMaxCodeSize]byte
+	values []byte
+}
+
+// jpegHuffmanCode is the code of a value in a Huffman table.
+type jpegHuffmanCode struct {
+	code uint32
+	size uint
+}
+
+// writeJPEGScan writes a scan preceded by its Huffman tables, which are optimized for the scan.
+func writeJPEGScan(buf *bytes.Buffer, components []jpegComponent, scan jpegScan) {
+	var tokens []jpegToken
+	if scan.ss == 0 {
+		tokens = jpegDCTokens(components, scan)
+	} else {
+		tokens = jpegACTokens(components[scan.components[0]], scan)
+	}
+
+	freqs := make([][256]int, scan.tables())
+	for _, token := range tokens {
+		freqs[token.table][token.symbol]++
+	}
+
+	class := byte(0)
+	if scan.ss > 0 {
+		class = 1
+	}
+
+	var dht []byte
+
+	codes := make([][256]jpegHuffmanCode, scan.tables())
+
+	for i := range freqs {
+		spec := jpegOptimalHuffmanSpec(&freqs[i])
+		codes[i] = jpegHuffmanCodes(spec)
+
+		dht = append(dht, class<<4|byte(i))
+		dht = append(dht, spec.counts[:]...)
+		dht = append(dht, spec.values...)
+	}
+
+	writeJPEGSegment(buf, jpegMarkerDHT, dht)
+	writeJPEGScanHeader(buf, components, scan)
+
+	bw := jpegBitWriter{buf: buf, acc: 0, n: 0}
+
+	for _, token := range tokens {
+		code := codes[token.table][token.symbol]
+		bw.writeBits(code.code, code.size)
+		bw.writeBits(uint32(token.bits), uint(token.size))
+	}
+
+	bw.flush()
+}
+
+// jpegDCTokens returns the tokens of the first scan of the DC coefficients of the given
+// components. The blocks of multiple components are interleaved by MCU.
+func jpegDCTokens(components []jpegComponent, scan jpegScan) []jpegToken {
+	predictions := make([]int32, len(scan.components))
+
+	if len(scan.components) == 1 {
+		component := components[scan.components[0]]
+		tokens := make([]jpegToken, 0, component.width*component.height)
+
+		for block := range component.scanBlocks() {
+			tokens = append(tokens, jpegValueToken(0, 0, block[0]-predictions[0]))
+			predictions[0] = block[0]
+		}
+
+		return tokens
+	}
+
+	mcusX := components[0].stride / components[0].h
+	mcus := len(components[0].blocks) / (components[0].h * components[0].v)
+	tokens := make([]jpegToken, 0, mcus*len(scan.components))
+
+	for mcu := range mcus {
+		mx, my := mcu%mcusX, mcu/mcusX
+
+		for i, c := range scan.components {
+			component := components[c]
+
+			for k := range component.h * component.v {
+				x, y := mx*component.h+k%component.h, my*component.v+k/component.h
+				dc := component.blocks[y*component.stride+x][0]
+
+				tokens = append(tokens, jpegValueToken(scan.table(i), 0, dc-predictions[i]))
+				predictions[i] = dc
+			}
+		}
+	}
+
+	return tokens
+}
+
+// jpegACTokens returns the tokens of the first scan of the AC coefficients ss to se of the
+// blocks of a component. Consecutive blocks ending with zero coefficients share an EOB run.
+func jpegACTokens(component jpegComponent, scan jpegScan) []jpegToken {
+	var (
+		tokens []jpegToken
+		eobRun int
+	)
+
+	flushEOBRun := func() {
+		if eobRun > 0 {
+			size := bits.Len(uint(eobRun)) - 1
+			tokens = append(tokens, jpegToken{
+				table:  0,
+				symbol: uint8(size << 4),             //nolint:gosec,mnd // size is at most 14
+				size:   uint8(size),                  //nolint:gosec
+				bits:   uint16(eobRun - (1 << size)), //nolint:gosec // eobRun is at most jpegMaxEOBRun
+			})
+			eobRun = 0
+		}
+	}
+
+	for block := range component.scanBlocks() {
+		run := 0
+
+		for k := scan.ss; k <= scan.se; k++ {
+			if block[k] == 0 {
+				run++
+
+				continue
+			}
+
+			flushEOBRun()
+
+			for ; run > jpegMaxZeroRun; run -= jpegMaxZeroRun + 1 {
+				tokens = append(tokens, jpegToken{table: 0, symbol: jpegSymbolZRL, size: 0, bits: 0})
+			}
+
+			tokens = append(tokens, jpegValueToken(0, uint8(run<<4), block[k])) //nolint:gosec,mnd
+			run = 0
+		}
+
+		if run > 0 {
+			if eobRun++; eobRun == jpegMaxEOBRun {
+				flushEOBRun()
+			}
+		}
+	}
+
+	flushEOBRun()
+
+	return tokens
+}
+
+// jpegValueToken returns the token of a coefficient value. The size of the value is added
+// to the low bits of symbol, the value is encoded in the extra bits.
+func jpegValueToken(table int, symbol uint8, value int32) jpegToken {
+	magnitude := value
+	if value < 0 {
+		magnitude = -value
+		value--
+	}
+
+	size := bits.Len32(uint32(magnitude)) //nolint:gosec // magnitude is not negative
+
+	return jpegToken{
+		table:  uint8(table),                        //nolint:gosec
+		symbol: symbol | uint8(size),                //nolint:gosec // size is at most 11
+		size:   uint8(size),                         //nolint:gosec
+		bits:   uint16(value) & (1<<uint(size) - 1), //nolint:gosec // the low bits of negative values are their encoding
+	}
+}
+
+// jpegOptimalHuffmanSpec returns the Huffman table minimizing the size of symbols of the given
+// frequencies, with codes of at most 16 bits, none of which consists of one bits only, as
+// described in Annex K.2 of the JPEG specification.
+func jpegOptimalHuffmanSpec(freqs *[256]int) jpegHuffmanSpec {
+	var (
+		freq     [257]int
+		codeSize [257]int
+		others   [257]int
+	)
+
+	copy(freq[:], freqs[:])
+	freq[256] = 1 // Reserves the code of one bits only
+
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		// Merge the two least frequent trees, preferring larger values on ties
+		c1, c2 := -1, -1
+		v1, v2 := math.MaxInt, math.MaxInt
+
+		for i, f := range freq {
+			switch {
+			case f == 0:
+			case f <= v1:
+				c2, v2 = c1, v1
+				c1, v1 = i, f
+			case f <= v2:
+				c2, v2 = i, f
+			}
+		}
+
+		if c2 < 0 {
+			break
+		}
+
+		freq[c1] += freq[c2]
+		freq[c2] = 0
+
+		for codeSize[c1]++; others[c1] >= 0; codeSize[c1]++ {
+			c1 = others[c1]
+		}
+
+		others[c1] = c2
+
+		for codeSize[c2]++; others[c2] >= 0; codeSize[c2]++ {
+			c2 = others[c2]
+		}
+	}
+
+	var counts [len(codeSize)]int
+
+	for _, size := range codeSize {
+		if size > 0 {
+			counts[size]++
+		}
+	}
+
+	// Shorten codes exceeding the maximum size by moving pairs of them up the tree
+	for i := len(counts) - 1; i > jpegMaxCodeSize; i-- {
+		for counts[i] > 0 {
+			j := i - 2
+			for counts[j] == 0 {
+				j--
+			}
+
+			counts[i] -= 2
+			counts[i-1]++
+			counts[j+1] += 2
+			counts[j]--
+		}
+	}
+
+	// Drop the reserved code, which is one of the longest
+	for i := jpegMaxCodeSize; i > 0; i-- {
+		if counts[i] > 0 {
+			counts[i]--
+
+			break
+		}
+	}
+
+	var spec jpegHuffmanSpec
+
+	for i := range spec.counts {
+		spec.counts[i] = byte(counts[i+1])
+	}
+
+	for size := 1; size < len(codeSize); size++ {
+		for value := range 256 {
+			if codeSize[value] == size {
+				spec.values = append(spec.values, byte(value))
+			}
+		}
+	}
+
+	return spec
+}
+
+// jpegHuffmanCodes returns the codes of the values of a Huffman table, indexed by value.
+func jpegHuffmanCodes(spec jpegHuffmanSpec) [256]jpegHuffmanCode {
+	var (
+		codes  [256]jpegHuffmanCode
+		code   uint32
+		values = spec.values
+	)
+
+	for i, count := range spec.counts {
+		for _, value := range values[:count] {
+			codes[value] = jpegHuffmanCode{code: code, size: uint(i + 1)}
+			code++
+		}
+
+		values = values[count:]
+		code <<= 1
+	}
+
+	return codes
+}
+
+// jpegBitWriter writes the entropy-coded data of a scan, stuffing a zero byte after each 0xFF.
+type jpegBitWriter struct {
+	buf *bytes.Buffer
+	acc uint32
+	n   uint
+}
+
+// writeBits writes the size low bits of code.
+func (bw *jpegBitWriter) writeBits(code uint32, size uint) {
+	bw.acc = bw.acc<<size | code&(1<<size-1)
+	bw.n += size
+
+	for bw.n >= 8 {
+		b := byte(bw.acc >> (bw.n - 8))
+		bw.buf.WriteByte(b)
+
+		if b == jpegMarkerPrefix {
+			bw.buf.WriteByte(0)
+		}
+
+		bw.n -= 8
+	}
+
+	bw.acc &= 1<<bw.n - 1
+}
+
+// flush pads the last byte of a scan with one bits.
+func (bw *jpegBitWriter) flush() {
+	if bw.n > 0 {
+		bw.writeBits(1<<(8-bw.n)-1, 8-bw.n)
+	}
+}
@@ -0,0 +1,409 @@
+package imagesvc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"iter"
+	"math"
+)
+
+// ErrImageTooLargeForJPEG is returned when an image exceeds the dimensions a JPEG image can have.
+var ErrImageTooLargeForJPEG = errors.New("image too large for JPEG")
+
+const (
+	jpegMarkerAPP0 = 0xE0 // Application segment 0, holding the JFIF header
+	jpegMarkerDQT  = 0xDB // Quantization tables
+	jpegMarkerSOF2 = 0xC2 // Start of a progressive image
+	jpegMarkerDHT  = 0xC4 // Huffman tables
+)
+
+const (
+	jpegBlockSize    = 8
+	jpegMaxDim       = 0xFFFF
+	jpegMaxDC        = 2047
+	jpegMaxAC        = 1023
+	jpegCoefficients = 64
+)
+
+// jpegScan is a scan of a progressive JPEG image, carrying the coefficients ss to se of the
+// blocks of its components. Scans of the DC coefficient carry all components, scans of AC
+// coefficients a single one.
+type jpegScan struct {
+	components []int
+	ss, se     int
+}
+
+// table returns the index of the Huffman table of the i-th component of the scan. Tables are
+// defined for each scan, the luminance and chrominance have separate tables in DC scans.
+func (scan jpegScan) table(i int) int {
+	return min(i, 1)
+}
+
+// tables returns the number of Huffman tables of the scan.
+func (scan jpegScan) tables() int {
+	return scan.table(len(scan.components)-1) + 1
+}
+
+//nolint:gochecknoglobals,mnd
+var (
+	// jpegUnzig maps the zig-zag order of the coefficients of a block to their natural order.
+	jpegUnzig = [jpegCoefficients]int{
+		0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+		12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+		35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+		58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+	}
+
+	// jpegQuantTables are the luminance and chrominance quantization tables of the JPEG
+	// specification (Annex K.1), in natural order, for quality 50.
+	jpegQuantTables = [2][jpegCoefficients]int{
+		{
+			16, 11, 10, 16, 24, 40, 51, 61,
+			12, 12, 14, 19, 26, 58, 60, 55,
+			14, 13, 16, 24, 40, 57, 69, 56,
+			14, 17, 22, 29, 51, 87, 80, 62,
+			18, 22, 37, 56, 68, 109, 103, 77,
+			24, 35, 55, 64, 81, 104, 113, 92,
+			49, 64, 78, 87, 103, 121, 120, 101,
+			72, 92, 95, 98, 112, 100, 103, 99,
+		},
+		{
+			17, 18, 24, 47, 99, 99, 99, 99,
+			18, 21, 26, 66, 99, 99, 99, 99,
+			24, 26, 56, 99, 99, 99, 99, 99,
+			47, 66, 99, 99, 99, 99, 99, 99,
+			99, 99, 99, 99, 99, 99, 99, 99,
+			99, 99, 99, 99, 99, 99, 99, 99,
+			99, 99, 99, 99, 99, 99, 99, 99,
+			99, 99, 99, 99, 99, 99, 99, 99,
+		},
+	}
+
+	// jpegDCTBasis holds the basis functions of the 8-point DCT, scaled so that applying them
+	// along rows and columns yields the DCT of the JPEG specification.
+	jpegDCTBasis = func() (basis [jpegBlockSize][jpegBlockSize]float64) {
+		for u := range jpegBlockSize {
+			scale := 0.5
+			if u == 0 {
+				scale = 0.5 / math.Sqrt2
+			}
+
+			for x := range jpegBlockSize {
+				basis[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+			}
+		}
+
+		return basis
+	}()
+
+	// jpegColorScans and jpegGrayScans are the scans of progressive color and grayscale images:
+	// the DC coefficients first, then the low frequencies of the luminance, which outline the
+	// image, then the chrominance, and finally the high frequencies of the luminance.
+	jpegColorScans = []jpegScan{
+		{components: []int{0, 1, 2}, ss: 0, se: 0},
+		{components: []int{0}, ss: 1, se: 5},
+		{components: []int{1}, ss: 1, se: 63},
+		{components: []int{2}, ss: 1, se: 63},
+		{components: []int{0}, ss: 6, se: 63},
+	}
+	jpegGrayScans = []jpegScan{
+		{components: []int{0}, ss: 0, se: 0},
+		{components: []int{0}, ss: 1, se: 5},
+		{components: []int{0}, ss: 6, se: 63},
+	}
+)
+
+// jpegComponent holds the quantized DCT coefficients of the 8x8 blocks of a component of an
+// image in zig-zag order. The blocks fill whole MCUs of h x v blocks, of which the blocks of
+// width x height cover the component and are the blocks of its non-interleaved scans.
+type jpegComponent struct {
+	id            byte // Component ID referenced by the scans
+	blocks        [][jpegCoefficients]int32
+	h, v          int // Blocks per MCU horizontally and vertically
+	stride        int // Blocks per row
+	width, height int // Blocks covering the component
+}
+
+// scanBlocks yields the blocks covering the component in the order of its non-interleaved scans.
+func (component jpegComponent) scanBlocks() iter.Seq[*[jpegCoefficients]int32] {
+	return func(yield func(*[jpegCoefficients]int32) bool) {
+		for by := range component.height {
+			for bx := range component.width {
+				if !yield(&component.blocks[by*component.stride+bx]) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// encodeProgressiveJPEG writes an image as progressive JPEG with the given quality (1-100),
+// or jpeg.DefaultQuality if 0. Grayscale images are written with a single component, other
+// images as YCbCr with 4:2:0 chroma subsampling. Like jpeg.Encode, alpha is ignored.
+// Returns ErrImageTooLargeForJPEG if a dimension exceeds 65535 pixels.
+func encodeProgressiveJPEG(w io.Writer, img image.Image, quality int) error {
+	bounds := img.Bounds()
+	if bounds.Dx() > jpegMaxDim || bounds.Dy() > jpegMaxDim {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLargeForJPEG, bounds.Dx(), bounds.Dy())
+	}
+
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+
+	quant := jpegScaledQuantTables(min(max(quality, 1), 100)) //nolint:mnd
+
+	scans := jpegColorScans
+	if _, gray := img.(*image.Gray); gray {
+		scans = jpegGrayScans
+	}
+
+	components := jpegComponents(img, quant)
+
+	var buf bytes.Buffer
+
+	writeJPEGHeaders(&buf, bounds, components, quant)
+
+	for _, scan := range scans {
+		writeJPEGScan(&buf, components, scan)
+	}
+
+	buf.Write([]byte{jpegMarkerPrefix, jpegMarkerEOI})
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// jpegScaledQuantTables returns the quantization tables for the given quality (1-100),
+// scaled like those of jpeg.Encode.
+func jpegScaledQuantTables(quality int) [2][jpegCoefficients]int {
+	scale := 200 - quality*2 //nolint:mnd
+	if quality < 50 {        //nolint:mnd
+		scale = 5000 / quality //nolint:mnd
+	}
+
+	var tables [2][jpegCoefficients]int
+
+	for i, base := range jpegQuantTables {
+		for k, q := range base {
+			tables[i][k] = min(max((q*scale+50)/100, 1), 255) //nolint:mnd
+		}
+	}
+
+	return tables
+}
+
+// jpegComponents returns the quantized components of an image: the luminance of grayscale
+// images, or the luminance and the chrominance subsampled by averaging 2x2 pixels of other
+// images. Blocks beyond the right or bottom edge are padded by repeating the edge pixels.
+func jpegComponents(img image.Image, quant [2][jpegCoefficients]int) []jpegComponent {
+	planes := jpegPlanes(img)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// The luminance of color images is sampled 2x2 per MCU
+	scale := 1
+	if len(planes) > 1 {
+		scale = 2
+	}
+
+	mcuSize := jpegBlockSize * scale
+	mcusX, mcusY := (width+mcuSize-1)/mcuSize, (height+mcuSize-1)/mcuSize
+	components := make([]jpegComponent, len(planes))
+
+	var samples [jpegCoefficients]float64
+
+	for c, plane := range planes {
+		// Blocks per MCU, and pixels per sample
+		blocks, subsample := scale, 1
+		if c > 0 {
+			blocks, subsample = 1, scale
+		}
+
+		component := jpegComponent{
+			id:     byte(c + 1),
+			blocks: make([][jpegCoefficients]int32, mcusX*blocks*mcusY*blocks),
+			h:      blocks,
+			v:      blocks,
+			stride: mcusX * blocks,
+			width:  (width + jpegBlockSize*subsample - 1) / (jpegBlockSize * subsample),
+			height: (height + jpegBlockSize*subsample - 1) / (jpegBlockSize * subsample),
+		}
+
+		for i := range component.blocks {
+			bx, by := i%component.stride, i/component.stride
+
+			for k := range jpegCoefficients {
+				x := (bx*jpegBlockSize + k%jpegBlockSize) * subsample
+				y := (by*jpegBlockSize + k/jpegBlockSize) * subsample
+				samples[k] = jpegSubsample(plane, width, height, x, y, subsample) - 128 //nolint:mnd
+			}
+
+			component.blocks[i] = jpegQuantizeBlock(&samples, &quant[min(c, 1)])
+		}
+
+		components[c] = component
+	}
+
+	return components
+}
+
+// jpegPlanes returns the luminance of grayscale images, or the luminance and chrominance
+// of other images, as planes of one sample per pixel.
+func jpegPlanes(img image.Image) [][]uint8 {
+	bounds := img.Bounds()
+
+	if gray, ok := img.(*image.Gray); ok {
+		plane := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			plane = append(plane, gray.Pix[gray.PixOffset(bounds.Min.X, y):gray.PixOffset(bounds.Max.X, y)]...)
+		}
+
+		return [][]uint8{plane}
+	}
+
+	planes := [][]uint8{
+		make([]uint8, 0, bounds.Dx()*bounds.Dy()),
+		make([]uint8, 0, bounds.Dx()*bounds.Dy()),
+		make([]uint8, 0, bounds.Dx()*bounds.Dy()),
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			yy, cb, cr := color.RGBToYCbCr(jpegPixelRGB(img, x, y))
+			planes[0] = append(planes[0], yy)
+			planes[1] = append(planes[1], cb)
+			planes[2] = append(planes[2], cr)
+		}
+	}
+
+	return planes
+}
+
+// jpegSubsample returns the mean of the size x size samples of a plane starting at x, y.
+// Samples beyond the right or bottom edge repeat the edge samples.
+func jpegSubsample(plane []uint8, width, height, x, y, size int) float64 {
+	sum := 0
+
+	for dy := range size {
+		row := min(y+dy, height-1) * width
+		for dx := range size {
+			sum += int(plane[row+min(x+dx, width-1)])
+		}
+	}
+
+	return float64(sum) / float64(size*size)
+}
+
+// jpegPixelRGB returns the red, green and blue samples of a pixel. Images resized by
+// transformImage are read directly, as reading them through their color model is slow.
+func jpegPixelRGB(img image.Image, x, y int) (uint8, uint8, uint8) {
+	if rgba, ok := img.(*image.RGBA); ok {
+		c := rgba.RGBAAt(x, y)
+
+		return c.R, c.G, c.B
+	}
+
+	r, g, b, _ := img.At(x, y).RGBA()
+
+	return uint8(r >> 8), uint8(g >> 8), uint8(b >> 8) //nolint:gosec,mnd
+}
+
+// jpegQuantizeBlock returns the quantized DCT coefficients of a block of level-shifted
+// samples in zig-zag order.
+func jpegQuantizeBlock(samples *[jpegCoefficients]float64, quant *[jpegCoefficients]int) [jpegCoefficients]int32 {
+	var rows, dct [jpegCoefficients]float64
+
+	for y := range jpegBlockSize {
+		for u := range jpegBlockSize {
+			var sum float64
+			for x := range jpegBlockSize {
+				sum += jpegDCTBasis[u][x] * samples[y*jpegBlockSize+x]
+			}
+
+			rows[y*jpegBlockSize+u] = sum
+		}
+	}
+
+	for v := range jpegBlockSize {
+		for u := range jpegBlockSize {
+			var sum float64
+			for y := range jpegBlockSize {
+				sum += jpegDCTBasis[v][y] * rows[y*jpegBlockSize+u]
+			}
+
+			dct[v*jpegBlockSize+u] = sum
+		}
+	}
+
+	var block [jpegCoefficients]int32
+
+	for k, natural := range jpegUnzig {
+		limit := float64(jpegMaxAC)
+		if k == 0 {
+			limit = jpegMaxDC
+		}
+
+		block[k] = int32(math.Max(-limit, math.Min(limit, math.Round(dct[natural]/float64(quant[natural])))))
+	}
+
+	return block
+}
+
+// writeJPEGHeaders writes the markers preceding the scans of a progressive JPEG image.
+func writeJPEGHeaders(buf *bytes.Buffer, bounds image.Rectangle, components []jpegComponent, quant [2][jpegCoefficients]int) {
+	buf.Write([]byte{jpegMarkerPrefix, jpegMarkerSOI})
+
+	// JFIF 1.01 without thumbnail and pixel density
+	writeJPEGSegment(buf, jpegMarkerAPP0, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+
+	dqt := make([]byte, 0, min(len(components), 2)*(1+jpegCoefficients))
+	for i := range min(len(components), 2) {
+		dqt = append(dqt, byte(i))
+		for _, natural := range jpegUnzig {
+			dqt = append(dqt, byte(quant[i][natural]))
+		}
+	}
+
+	writeJPEGSegment(buf, jpegMarkerDQT, dqt)
+
+	sof := []byte{
+		8, //nolint:mnd // bits per sample
+		byte(bounds.Dy() >> 8), byte(bounds.Dy()), byte(bounds.Dx() >> 8), byte(bounds.Dx()),
+		byte(len(components)),
+	}
+	for c, component := range components {
+		// Component ID, sampling factors, quantization table
+		sof = append(sof, component.id, byte(component.h<<4|component.v), byte(min(c, 1)))
+	}
+
+	writeJPEGSegment(buf, jpegMarkerSOF2, sof)
+}
+
+// writeJPEGScanHeader writes the SOS marker of a scan.
+func writeJPEGScanHeader(buf *bytes.Buffer, components []jpegComponent, scan jpegScan) {
+	sos := []byte{byte(len(scan.components))}
+	for i, c := range scan.components {
+		// Component ID, DC and AC Huffman tables
+		sos = append(sos, components[c].id, byte(scan.table(i)<<4|scan.table(i)))
+	}
+
+	// No successive approximation
+	sos = append(sos, byte(scan.ss), byte(scan.se), 0)
+
+	writeJPEGSegment(buf, jpegMarkerSOS, sos)
+}
+
+// writeJPEGSegment writes a marker segment with the given payload.
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, payload []byte) {
+	length := len(payload) + 2 //nolint:mnd // the length includes itself
+	buf.Write([]byte{jpegMarkerPrefix, marker, byte(length >> 8), byte(length)})
+	buf.Write(payload)
+}
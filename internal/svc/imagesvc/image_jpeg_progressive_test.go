@@ -0,0 +1,154 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestEncodeProgressiveJPEG_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	// Sizes below, at and above the 8x8 block and 16x16 MCU boundaries
+	sizes := []image.Point{{1, 1}, {7, 3}, {8, 8}, {9, 17}, {16, 16}, {17, 9}, {33, 65}, {100, 2}, {2, 100}, {127, 129}}
+
+	// Source images of each chroma subsampling the standard decoder produces, grayscale and RGB,
+	// all encoded as 4:2:0 YCbCr or single component grayscale.
+	sources := []struct {
+		name   string
+		new    func(r image.Rectangle) image.Image
+		wantYC bool // Decoded as YCbCr rather than grayscale
+	}{
+		{name: "ycbcr 4:4:4", new: newTestYCbCr(image.YCbCrSubsampleRatio444), wantYC: true},
+		{name: "ycbcr 4:2:2", new: newTestYCbCr(image.YCbCrSubsampleRatio422), wantYC: true},
+		{name: "ycbcr 4:2:0", new: newTestYCbCr(image.YCbCrSubsampleRatio420), wantYC: true},
+		{name: "ycbcr 4:4:0", new: newTestYCbCr(image.YCbCrSubsampleRatio440), wantYC: true},
+		{name: "ycbcr 4:1:1", new: newTestYCbCr(image.YCbCrSubsampleRatio411), wantYC: true},
+		{name: "ycbcr 4:1:0", new: newTestYCbCr(image.YCbCrSubsampleRatio410), wantYC: true},
+		{name: "rgba", new: newTestRGBA, wantYC: true},
+		{name: "gray", new: newTestGray, wantYC: false},
+	}
+
+	for _, source := range sources {
+		for _, size := range sizes {
+			for _, quality := range []int{1, 50, 75, 100} {
+				t.Run(fmt.Sprintf("%s %dx%d q%d", source.name, size.X, size.Y, quality), func(t *testing.T) {
+					t.Parallel()
+
+					// Offset bounds check that the origin of the image is not assumed
+					img := source.new(image.Rect(3, 5, 3+size.X, 5+size.Y))
+
+					var progressive, baseline bytes.Buffer
+					if err := imagesvc.EncodeProgressiveJPEG(&progressive, img, quality); err != nil {
+						t.Fatalf("EncodeProgressiveJPEG() error = %v", err)
+					}
+
+					if err := jpeg.Encode(&baseline, img, &jpeg.Options{Quality: quality}); err != nil {
+						t.Fatalf("encode baseline: %v", err)
+					}
+
+					if !bytes.Contains(progressive.Bytes(), []byte{0xFF, 0xC2}) {
+						t.Fatal("image is not progressive")
+					}
+
+					decoded, err := jpeg.Decode(bytes.NewReader(progressive.Bytes()))
+					if err != nil {
+						t.Fatalf("decode: %v", err)
+					}
+
+					if got, want := decoded.Bounds().Size(), size; got != want {
+						t.Fatalf("decoded size = %v, want %v", got, want)
+					}
+
+					if _, gotYC := decoded.(*image.YCbCr); gotYC != source.wantYC {
+						t.Errorf("decoded %T, want YCbCr %t", decoded, source.wantYC)
+					}
+
+					// The standard encoder quantizes with the same tables and subsampling, so both
+					// images deviate from the source alike
+					diff := meanSampleDiff(t, progressive.Bytes(), baseline.Bytes())
+					if tolerance := 2 + float64(100-quality)/25; diff > tolerance {
+						t.Errorf("mean sample difference to baseline = %.2f, want at most %.2f", diff, tolerance)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestEncodeProgressiveJPEG_TooLarge(t *testing.T) {
+	t.Parallel()
+
+	// Only the bounds are checked, so the pixels need not be allocated
+	img := &image.Gray{Pix: nil, Stride: 0, Rect: image.Rect(0, 0, 65536, 1)}
+
+	var buf bytes.Buffer
+	if err := imagesvc.EncodeProgressiveJPEG(&buf, img, 75); err == nil {
+		t.Error("EncodeProgressiveJPEG() error = nil, want ErrImageTooLargeForJPEG")
+	}
+}
+
+// testGradient returns the color of a smooth gradient over r at x, y, as found in photos.
+func testGradient(r image.Rectangle, x, y int) color.RGBA {
+	fx := float64(x-r.Min.X) / float64(max(r.Dx()-1, 1))
+	fy := float64(y-r.Min.Y) / float64(max(r.Dy()-1, 1))
+
+	return color.RGBA{
+		R: uint8(32 + 192*fx),      //nolint:gosec
+		G: uint8(32 + 192*fy),      //nolint:gosec
+		B: uint8(224 - 96*(fx+fy)), //nolint:gosec
+		A: 0xFF,
+	}
+}
+
+// newTestYCbCr returns a constructor of YCbCr images with the given subsampling showing a gradient.
+func newTestYCbCr(ratio image.YCbCrSubsampleRatio) func(r image.Rectangle) image.Image {
+	return func(r image.Rectangle) image.Image {
+		img := image.NewYCbCr(r, ratio)
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := testGradient(r, x, y)
+				yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+
+				// Subsampled chroma samples are set by each of their pixels, the last one wins
+				img.Y[img.YOffset(x, y)] = yy
+				img.Cb[img.COffset(x, y)] = cb
+				img.Cr[img.COffset(x, y)] = cr
+			}
+		}
+
+		return img
+	}
+}
+
+// newTestRGBA returns an RGBA image showing a gradient.
+func newTestRGBA(r image.Rectangle) image.Image {
+	img := image.NewRGBA(r)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, testGradient(r, x, y))
+		}
+	}
+
+	return img
+}
+
+// newTestGray returns a grayscale image showing a gradient.
+func newTestGray(r image.Rectangle) image.Image {
+	img := image.NewGray(r)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, testGradient(r, x, y))
+		}
+	}
+
+	return img
+}
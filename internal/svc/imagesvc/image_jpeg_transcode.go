@@ -0,0 +1,600 @@
+package imagesvc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+// ErrUnsupportedJPEG is returned when a JPEG image cannot be transcoded losslessly, as it is
+// not a sequential Huffman-coded image with 8 bits per sample and one or three components.
+var ErrUnsupportedJPEG = errors.New("unsupported JPEG")
+
+const (
+	jpegMarkerSOF0 = 0xC0 // Start of a baseline image
+	jpegMarkerSOF1 = 0xC1 // Start of an extended sequential image
+	jpegMarkerSOFF = 0xCF // Start of a differential lossless arithmetic-coded image, the last frame type
+	jpegMarkerRST0 = 0xD0 // First restart marker
+	jpegMarkerRST7 = 0xD7 // Last restart marker
+	jpegMarkerDRI  = 0xDD // Restart interval
+
+	jpegMaxTables     = 4  // Huffman tables per class
+	jpegMaxMCUBlocks  = 10 // Blocks per MCU of an interleaved scan
+	jpegMaxSampling   = 4  // Largest sampling factor of a component
+	jpegMaxDCCategory = 11 // Size of the largest DC difference of 8-bit images
+	jpegMaxACCategory = 10 // Size of the largest AC coefficient of 8-bit images
+)
+
+// jpegFrame holds the components of a sequential JPEG image while it is transcoded.
+type jpegFrame struct {
+	components   []jpegComponent
+	mcusX, mcusY int
+}
+
+// jpegHuffmanDecoder decodes the values of a Huffman table by the canonical codes of its
+// specification, as described in Annex F.2.2.3 of the JPEG specification.
+type jpegHuffmanDecoder struct {
+	maxCode [jpegMaxCodeSize + 1]int32 // Largest code of each size, -1 if there is none
+	minCode [jpegMaxCodeSize + 1]int32 // Smallest code of each size
+	valPtr  [jpegMaxCodeSize + 1]int32 // Index of the value of the smallest code of each size
+	values  []byte
+}
+
+// transcodeJPEG losslessly rewrites a sequential JPEG image as a progressive JPEG image with
+// Huffman tables optimized for its scans, which is usually smaller. The quantized DCT
+// coefficients are copied as they are, so the decoded pixels do not change. Other segments,
+// such as EXIF data and color profiles, are kept; restart markers are dropped.
+// Returns ErrUnsupportedJPEG for images it cannot transcode and ErrMalformedImage for images
+// it cannot parse.
+//
+//nolint:cyclop,funlen
+func transcodeJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != jpegMarkerPrefix || data[1] != jpegMarkerSOI {
+		return nil, fmt.Errorf("%w: missing JPEG start of image", ErrMalformedImage)
+	}
+
+	var (
+		out             = bytes.NewBuffer(make([]byte, 0, len(data)))
+		frame           *jpegFrame
+		tables          [2][jpegMaxTables]*jpegHuffmanDecoder
+		restartInterval int
+		scanned         bool
+		pos             = 2
+	)
+
+	out.Write(data[:pos])
+
+	for {
+		// Markers may be preceded by fill bytes
+		for pos+1 < len(data) && data[pos] == jpegMarkerPrefix && data[pos+1] == jpegMarkerPrefix {
+			pos++
+		}
+
+		if pos+2 > len(data) || data[pos] != jpegMarkerPrefix {
+			return nil, fmt.Errorf("%w: expected JPEG marker at offset %d", ErrMalformedImage, pos)
+		}
+
+		marker := data[pos+1]
+		if marker == jpegMarkerEOI {
+			break
+		}
+
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("%w: truncated JPEG segment at offset %d", ErrMalformedImage, pos)
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) || end < pos+4 {
+			return nil, fmt.Errorf("%w: truncated JPEG segment at offset %d", ErrMalformedImage, pos)
+		}
+
+		payload := data[pos+4 : end]
+
+		var err error
+
+		switch {
+		case marker == jpegMarkerSOF0 || marker == jpegMarkerSOF1:
+			if frame != nil {
+				return nil, fmt.Errorf("%w: multiple frames", ErrMalformedImage)
+			}
+
+			if frame, err = parseJPEGFrame(payload); err != nil {
+				return nil, err
+			}
+
+			// The frame header of progressive images has the same layout
+			writeJPEGSegment(out, jpegMarkerSOF2, payload)
+		case marker >= jpegMarkerSOF2 && marker <= jpegMarkerSOFF && marker != jpegMarkerDHT:
+			// Progressive, lossless and arithmetic-coded images
+			return nil, fmt.Errorf("%w: frame type %#x", ErrUnsupportedJPEG, marker)
+		case marker == jpegMarkerDHT:
+			err = parseJPEGHuffmanTables(payload, &tables)
+		case marker == jpegMarkerDRI:
+			if len(payload) != 2 { //nolint:mnd
+				return nil, fmt.Errorf("%w: invalid restart interval", ErrMalformedImage)
+			}
+
+			restartInterval = int(binary.BigEndian.Uint16(payload))
+		case marker == jpegMarkerSOS:
+			if frame == nil {
+				return nil, fmt.Errorf("%w: scan before frame", ErrMalformedImage)
+			}
+
+			var n int
+			if n, err = frame.decodeScan(payload, data[end:], &tables, restartInterval); err == nil {
+				scanned = true
+				end += n
+			}
+		case marker == jpegMarkerDQT && scanned:
+			// Quantization tables redefined between scans would apply to all scans
+			return nil, fmt.Errorf("%w: quantization tables between scans", ErrUnsupportedJPEG)
+		default:
+			out.Write(data[pos:end])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		pos = end
+	}
+
+	if !scanned {
+		return nil, fmt.Errorf("%w: no scan", ErrMalformedImage)
+	}
+
+	scans := jpegColorScans
+	if len(frame.components) == 1 {
+		scans = jpegGrayScans
+	}
+
+	for _, scan := range scans {
+		writeJPEGScan(out, frame.components, scan)
+	}
+
+	out.Write([]byte{jpegMarkerPrefix, jpegMarkerEOI})
+
+	return out.Bytes(), nil
+}
+
+// parseJPEGFrame parses the frame header of a sequential JPEG image and allocates the blocks
+// of its components.
+func parseJPEGFrame(sof []byte) (*jpegFrame, error) {
+	const headerSize, componentSize = 6, 3
+
+	if len(sof) < headerSize {
+		return nil, fmt.Errorf("%w: truncated frame header", ErrMalformedImage)
+	}
+
+	if sof[0] != 8 { //nolint:mnd
+		return nil, fmt.Errorf("%w: %d bits per sample", ErrUnsupportedJPEG, sof[0])
+	}
+
+	height, width := int(binary.BigEndian.Uint16(sof[1:3])), int(binary.BigEndian.Uint16(sof[3:5]))
+	if height == 0 || width == 0 {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrUnsupportedJPEG, width, height)
+	}
+
+	count := int(sof[5])
+	if count != 1 && count != 3 {
+		return nil, fmt.Errorf("%w: %d components", ErrUnsupportedJPEG, count)
+	}
+
+	if len(sof) != headerSize+count*componentSize {
+		return nil, fmt.Errorf("%w: invalid frame header length", ErrMalformedImage)
+	}
+
+	frame := &jpegFrame{components: make([]jpegComponent, count), mcusX: 0, mcusY: 0}
+	hMax, vMax := 1, 1
+
+	for c := range frame.components {
+		spec := sof[headerSize+c*componentSize:]
+		h, v := int(spec[1]>>4), int(spec[1]&0x0F) //nolint:mnd
+
+		if h < 1 || h > jpegMaxSampling || v < 1 || v > jpegMaxSampling {
+			return nil, fmt.Errorf("%w: invalid sampling factors", ErrMalformedImage)
+		}
+
+		// Single components are not interleaved, so their MCUs are single blocks
+		if count == 1 {
+			h, v = 1, 1
+		}
+
+		frame.components[c] = jpegComponent{id: spec[0], blocks: nil, h: h, v: v, stride: 0, width: 0, height: 0}
+		hMax, vMax = max(hMax, h), max(vMax, v)
+	}
+
+	frame.mcusX = (width + jpegBlockSize*hMax - 1) / (jpegBlockSize * hMax)
+	frame.mcusY = (height + jpegBlockSize*vMax - 1) / (jpegBlockSize * vMax)
+
+	for c := range frame.components {
+		component := &frame.components[c]
+		component.stride = frame.mcusX * component.h
+		component.blocks = make([][jpegCoefficients]int32, component.stride*frame.mcusY*component.v)
+		component.width = ((width*component.h+hMax-1)/hMax + jpegBlockSize - 1) / jpegBlockSize
+		component.height = ((height*component.v+vMax-1)/vMax + jpegBlockSize - 1) / jpegBlockSize
+	}
+
+	return frame, nil
+}
+
+// parseJPEGHuffmanTables parses the Huffman tables of a DHT segment into tables,
+// indexed by class (DC or AC) and destination.
+func parseJPEGHuffmanTables(dht []byte, tables *[2][jpegMaxTables]*jpegHuffmanDecoder) error {
+	for len(dht) > 0 {
+		if len(dht) < 1+jpegMaxCodeSize {
+			return fmt.Errorf("%w: truncated Huffman table", ErrMalformedImage)
+		}
+
+		class, dest := int(dht[0]>>4), int(dht[0]&0x0F) //nolint:mnd
+		if class > 1 || dest >= jpegMaxTables {
+			return fmt.Errorf("%w: invalid Huffman table %#x", ErrMalformedImage, dht[0])
+		}
+
+		var spec jpegHuffmanSpec
+
+		copy(spec.counts[:], dht[1:1+jpegMaxCodeSize])
+
+		total := 0
+		for _, count := range spec.counts {
+			total += int(count)
+		}
+
+		dht = dht[1+jpegMaxCodeSize:]
+		if total > len(dht) || total > 256 { //nolint:mnd
+			return fmt.Errorf("%w: truncated Huffman table", ErrMalformedImage)
+		}
+
+		spec.values = dht[:total]
+		dht = dht[total:]
+		tables[class][dest] = newJPEGHuffmanDecoder(spec)
+	}
+
+	return nil
+}
+
+func newJPEGHuffmanDecoder(spec jpegHuffmanSpec) *jpegHuffmanDecoder {
+	//nolint:exhaustruct
+	decoder := &jpegHuffmanDecoder{values: spec.values}
+
+	var code, index int32
+
+	for i, count := range spec.counts {
+		size := i + 1
+		decoder.maxCode[size] = -1
+
+		if count > 0 {
+			decoder.valPtr[size] = index
+			decoder.minCode[size] = code
+			code += int32(count)
+			index += int32(count)
+			decoder.maxCode[size] = code - 1
+		}
+
+		code <<= 1
+	}
+
+	return decoder
+}
+
+// decode reads the next value coded by the table.
+func (decoder *jpegHuffmanDecoder) decode(br *jpegBitReader) (byte, error) {
+	var code int32
+
+	for size := 1; size <= jpegMaxCodeSize; size++ {
+		bit, err := br.readBit()
+		if err != nil {
+			return 0, err
+		}
+
+		code = code<<1 | int32(bit) //nolint:gosec // bit is 0 or 1
+		if code <= decoder.maxCode[size] {
+			return decoder.values[decoder.valPtr[size]+code-decoder.minCode[size]], nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: invalid Huffman code", ErrMalformedImage)
+}
+
+// decodeScan decodes the coefficients of the blocks of a sequential scan, given its header
+// and the data following it. Returns the length of its entropy-coded data.
+//
+//nolint:cyclop,funlen
+func (frame *jpegFrame) decodeScan(
+	sos, data []byte,
+	tables *[2][jpegMaxTables]*jpegHuffmanDecoder,
+	restartInterval int,
+) (int, error) {
+	const componentSize, trailerSize = 2, 3
+
+	if len(sos) < 1 || len(sos) != 1+int(sos[0])*componentSize+trailerSize || sos[0] == 0 {
+		return 0, fmt.Errorf("%w: invalid scan header", ErrMalformedImage)
+	}
+
+	type scanComponent struct {
+		component *jpegComponent
+		dc, ac    *jpegHuffmanDecoder
+		pred      int32
+	}
+
+	components := make([]scanComponent, sos[0])
+	mcuBlocks := 0
+
+	for i := range components {
+		id, selectors := sos[1+i*componentSize], sos[2+i*componentSize]
+
+		c := -1
+		for j := range frame.components {
+			if frame.components[j].id == id {
+				c = j
+			}
+		}
+
+		dc, ac := int(selectors>>4), int(selectors&0x0F) //nolint:mnd
+		if c < 0 || dc >= jpegMaxTables || ac >= jpegMaxTables || tables[0][dc] == nil || tables[1][ac] == nil {
+			return 0, fmt.Errorf("%w: invalid scan component %d", ErrMalformedImage, id)
+		}
+
+		components[i] = scanComponent{component: &frame.components[c], dc: tables[0][dc], ac: tables[1][ac], pred: 0}
+		mcuBlocks += frame.components[c].h * frame.components[c].v
+	}
+
+	if trailer := sos[len(sos)-trailerSize:]; trailer[0] != 0 || trailer[1] != jpegCoefficients-1 || trailer[2] != 0 {
+		return 0, fmt.Errorf("%w: invalid spectral selection", ErrMalformedImage)
+	}
+
+	if len(components) > 1 && mcuBlocks > jpegMaxMCUBlocks {
+		return 0, fmt.Errorf("%w: %d blocks per MCU", ErrMalformedImage, mcuBlocks)
+	}
+
+	// The blocks of a single component are scanned in rows covering the component,
+	// the blocks of multiple components are interleaved by MCU
+	units := frame.mcusX * frame.mcusY
+	if len(components) == 1 {
+		units = components[0].component.width * components[0].component.height
+	}
+
+	br := &jpegBitReader{data: data, pos: 0, bits: 0, n: 0}
+
+	for unit := range units {
+		if restartInterval > 0 && unit > 0 && unit%restartInterval == 0 {
+			if err := br.restart(); err != nil {
+				return 0, err
+			}
+
+			for i := range components {
+				components[i].pred = 0
+			}
+		}
+
+		for i := range components {
+			sc := &components[i]
+			component := sc.component
+
+			if len(components) == 1 {
+				x, y := unit%component.width, unit/component.width
+				if err := decodeJPEGBlock(br, &component.blocks[y*component.stride+x], sc.dc, sc.ac, &sc.pred); err != nil {
+					return 0, err
+				}
+
+				continue
+			}
+
+			mx, my := unit%frame.mcusX, unit/frame.mcusX
+
+			for k := range component.h * component.v {
+				x, y := mx*component.h+k%component.h, my*component.v+k/component.h
+				if err := decodeJPEGBlock(br, &component.blocks[y*component.stride+x], sc.dc, sc.ac, &sc.pred); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	return br.end(), nil
+}
+
+// decodeJPEGBlock decodes the coefficients of a block in zig-zag order, given the prediction
+// of its DC coefficient, which is updated.
+func decodeJPEGBlock(
+	br *jpegBitReader,
+	block *[jpegCoefficients]int32,
+	dc, ac *jpegHuffmanDecoder,
+	pred *int32,
+) error {
+	size, err := dc.decode(br)
+	if err != nil {
+		return err
+	}
+
+	if size > jpegMaxDCCategory {
+		return fmt.Errorf("%w: DC difference of size %d", ErrMalformedImage, size)
+	}
+
+	diff, err := br.readValue(size)
+	if err != nil {
+		return err
+	}
+
+	*pred += diff
+	if *pred < -jpegMaxDC || *pred > jpegMaxDC {
+		return fmt.Errorf("%w: DC coefficient %d out of range", ErrUnsupportedJPEG, *pred)
+	}
+
+	block[0] = *pred
+
+	for k := 1; k < jpegCoefficients; k++ {
+		symbol, err := ac.decode(br)
+		if err != nil {
+			return err
+		}
+
+		run, size := int(symbol>>4), symbol&0x0F //nolint:mnd
+		if size == 0 {
+			if symbol != jpegSymbolZRL {
+				break // End of block
+			}
+
+			k += jpegMaxZeroRun
+
+			continue
+		}
+
+		if k += run; k >= jpegCoefficients || size > jpegMaxACCategory {
+			return fmt.Errorf("%w: invalid AC coefficient", ErrMalformedImage)
+		}
+
+		if block[k], err = br.readValue(size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jpegBitReader reads the entropy-coded data of a scan, skipping the zero bytes stuffed
+// after each 0xFF.
+type jpegBitReader struct {
+	data []byte
+	pos  int
+	bits byte // Unread bits of the current byte, in the high bits
+	n    uint // Number of unread bits
+}
+
+// readBit reads the next bit of the data.
+func (br *jpegBitReader) readBit() (byte, error) {
+	if br.n == 0 {
+		if br.pos >= len(br.data) {
+			return 0, fmt.Errorf("%w: truncated scan", ErrMalformedImage)
+		}
+
+		b := br.data[br.pos]
+		if b == jpegMarkerPrefix {
+			if br.pos+1 >= len(br.data) || br.data[br.pos+1] != 0 {
+				return 0, fmt.Errorf("%w: unexpected marker in scan", ErrMalformedImage)
+			}
+
+			br.pos++
+		}
+
+		br.pos++
+		br.bits, br.n = b, 8
+	}
+
+	bit := br.bits >> 7 //nolint:mnd
+	br.bits <<= 1
+	br.n--
+
+	return bit, nil
+}
+
+// readValue reads a coefficient value of the given size, encoded as described in
+// Annex F.2.2.1 of the JPEG specification.
+func (br *jpegBitReader) readValue(size byte) (int32, error) {
+	var value int32
+
+	for range size {
+		bit, err := br.readBit()
+		if err != nil {
+			return 0, err
+		}
+
+		value = value<<1 | int32(bit)
+	}
+
+	// Values with a leading zero bit are negative
+	if size > 0 && value < 1<<(size-1) {
+		value -= 1<<size - 1
+	}
+
+	return value, nil
+}
+
+// restart skips the restart marker following the current interval.
+func (br *jpegBitReader) restart() error {
+	br.n = 0
+
+	if br.pos+1 >= len(br.data) || br.data[br.pos] != jpegMarkerPrefix ||
+		br.data[br.pos+1] < jpegMarkerRST0 || br.data[br.pos+1] > jpegMarkerRST7 {
+		return fmt.Errorf("%w: missing restart marker", ErrMalformedImage)
+	}
+
+	br.pos += 2
+
+	return nil
+}
+
+// end returns the length of the entropy-coded data, which ends at the first marker
+// other than a restart marker.
+func (br *jpegBitReader) end() int {
+	pos := br.pos
+	for ; pos+1 < len(br.data); pos++ {
+		if br.data[pos] != jpegMarkerPrefix {
+			continue
+		}
+
+		if marker := br.data[pos+1]; marker != 0 && (marker < jpegMarkerRST0 || marker > jpegMarkerRST7) {
+			return pos
+		}
+	}
+
+	return len(br.data)
+}
+
+// sameJPEGPixels reports whether two JPEG images decode to the same pixels.
+// Returns an error if the first image cannot be decoded.
+func sameJPEGPixels(data, other []byte) (bool, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("decode jpeg: %w", err)
+	}
+
+	otherImg, err := jpeg.Decode(bytes.NewReader(other))
+	if err != nil || img.Bounds() != otherImg.Bounds() {
+		return false, nil //nolint:nilerr // images that cannot be decoded differ
+	}
+
+	// The planes of decoded images cover whole MCUs, so only the samples within the bounds are compared
+	bounds := img.Bounds()
+
+	switch img := img.(type) {
+	case *image.Gray:
+		otherGray, ok := otherImg.(*image.Gray)
+		if !ok {
+			return false, nil
+		}
+
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			if !bytes.Equal(img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)],
+				otherGray.Pix[otherGray.PixOffset(bounds.Min.X, y):otherGray.PixOffset(bounds.Max.X, y)]) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	case *image.YCbCr:
+		otherYCbCr, ok := otherImg.(*image.YCbCr)
+		if !ok || img.SubsampleRatio != otherYCbCr.SubsampleRatio {
+			return false, nil
+		}
+
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				yi, ci := img.YOffset(x, y), img.COffset(x, y)
+				otherYi, otherCi := otherYCbCr.YOffset(x, y), otherYCbCr.COffset(x, y)
+
+				if img.Y[yi] != otherYCbCr.Y[otherYi] || img.Cb[ci] != otherYCbCr.Cb[otherCi] ||
+					img.Cr[ci] != otherYCbCr.Cr[otherCi] {
+					return false, nil
+				}
+			}
+		}
+
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,106 @@
+package imagesvc
+
+import (
+	"strconv"
+
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// widthBuckets are the upper bounds used to group requested resize widths.
+//
+//nolint:gochecknoglobals
+var widthBuckets = []float64{64, 128, 256, 320, 480, 640, 800, 1024, 1280, 1600, 1920, 2560, 3840}
+
+// imageMetrics holds the metrics recorded by the BlobImageService.
+type imageMetrics struct {
+	requestedWidth   *metrics.Histogram
+	resizeDuration   *metrics.HistogramVec
+	cacheRequests    *metrics.CounterVec
+	cacheStoredBytes *metrics.Counter
+	optimizeResults  *metrics.CounterVec
+	optimizeSaved    *metrics.CounterVec
+	cacheGCRuns      *metrics.CounterVec
+	cacheGCScanned   *metrics.Counter
+	cacheGCRemoved   *metrics.Counter
+	cacheGCDuration  *metrics.Histogram
+	cacheEvicted     *metrics.Counter
+	cacheSize        *metrics.Gauge
+	thumbnails       *metrics.CounterVec
+}
+
+func newImageMetrics(reg *metrics.Registry) *imageMetrics {
+	return &imageMetrics{
+		requestedWidth: reg.NewHistogram(
+			"imagesvc_requested_width_pixels",
+			"Distribution of requested resize widths.",
+			widthBuckets,
+		),
+		resizeDuration: reg.NewHistogramVec(
+			"imagesvc_resize_duration_seconds",
+			"Duration of image resize operations by image format.",
+			metrics.DefaultDurationBuckets,
+			"format",
+		),
+		cacheRequests: reg.NewCounterVec(
+			"imagesvc_cache_requests_total",
+			"Resize cache lookups by result and width bucket.",
+			"result", "width_bucket",
+		),
+		cacheStoredBytes: reg.NewCounter(
+			"imagesvc_cache_stored_bytes_total",
+			"Total bytes of resized images written to the cache.",
+		),
+		optimizeResults: reg.NewCounterVec(
+			"imagesvc_optimize_total",
+			"Image optimization attempts on ingest by image format and result.",
+			"format", "result",
+		),
+		optimizeSaved: reg.NewCounterVec(
+			"imagesvc_optimize_saved_bytes_total",
+			"Total bytes saved by image optimization on ingest by image format.",
+			"format",
+		),
+		cacheGCRuns: reg.NewCounterVec(
+			"imagesvc_cache_gc_runs_total",
+			"Cache garbage collection runs by result.",
+			"result",
+		),
+		cacheGCScanned: reg.NewCounter(
+			"imagesvc_cache_gc_scanned_total",
+			"Total cache entries inspected by cache garbage collection.",
+		),
+		cacheGCRemoved: reg.NewCounter(
+			"imagesvc_cache_gc_removed_total",
+			"Total orphaned cache entries removed by cache garbage collection.",
+		),
+		cacheGCDuration: reg.NewHistogram(
+			"imagesvc_cache_gc_duration_seconds",
+			"Duration of cache garbage collection runs.",
+			metrics.DefaultDurationBuckets,
+		),
+		cacheEvicted: reg.NewCounter(
+			"imagesvc_cache_evicted_total",
+			"Total least recently used cache entries evicted to keep the cache within its size budget.",
+		),
+		cacheSize: reg.NewGauge(
+			"imagesvc_cache_size_bytes",
+			"Total bytes of cached resized images, if the cache size is limited.",
+		),
+		thumbnails: reg.NewCounterVec(
+			"imagesvc_thumbnails_total",
+			"Eagerly generated thumbnails by result.",
+			"result",
+		),
+	}
+}
+
+// widthBucket returns the label of the width bucket containing the given width.
+func widthBucket(width int) string {
+	for _, upper := range widthBuckets {
+		if float64(width) <= upper {
+			return "le_" + strconv.Itoa(int(upper))
+		}
+	}
+
+	return "gt_" + strconv.Itoa(int(widthBuckets[len(widthBuckets)-1]))
+}
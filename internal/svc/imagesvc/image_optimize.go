@@ -0,0 +1,215 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+// maxPaletteColors is the maximum number of colors of a palette image.
+const maxPaletteColors = 256
+
+// optimizeProcessor is the "optimize" processor, losslessly recompressing images
+// if optimization is enabled for their type.
+type optimizeProcessor struct {
+	cfg     ImageConfig
+	metrics *imageMetrics
+	log     logging.Logger
+}
+
+func newOptimizeProcessor(cfg ImageConfig) (Processor, error) {
+	return optimizeProcessor{
+		cfg:     cfg,
+		metrics: newImageMetrics(metrics.Default()),
+		log:     logging.GetLogger("svc.imagesvc.optimize_processor"),
+	}, nil
+}
+
+// Process implements Processor by optimizing the image.
+func (processor optimizeProcessor) Process(ctx context.Context, image domain.Media) (domain.Media, error) {
+	log := processor.log.With(logging.Group("image",
+		"id", image.ID(),
+		"type", image.MIMEType(),
+		"size", image.Size(),
+	))
+
+	optimized, err := optimizeImage(image.Bytes(), image.MIMEType(), processor.cfg)
+	if err != nil {
+		processor.metrics.optimizeResults.With(image.MIMEType(), "error").Inc()
+		log.ErrorContext(ctx, "image optimize failed", "error", err)
+
+		return domain.Media{}, fmt.Errorf("optimize image: %w", err)
+	}
+
+	if len(optimized) == len(image.Bytes()) {
+		processor.metrics.optimizeResults.With(image.MIMEType(), "skipped").Inc()
+
+		return image, nil
+	}
+
+	saved := image.Size() - int64(len(optimized))
+	processor.metrics.optimizeResults.With(image.MIMEType(), "optimized").Inc()
+	processor.metrics.optimizeSaved.With(image.MIMEType()).Add(float64(saved))
+
+	log.DebugContext(ctx, "image optimized", "optimizedSize", len(optimized), "savedBytes", saved)
+
+	return withProcessedData(image, optimized), nil
+}
+
+// PassesThrough implements PassthroughProcessor. Images are passed through unless
+// optimization is enabled for their type.
+func (processor optimizeProcessor) PassesThrough(mimeType string) bool {
+	return !(mimeType == MIMETypePNG && processor.cfg.OptimizePNG) &&
+		!(mimeType == MIMETypeJPEG && processor.cfg.OptimizeJPEG)
+}
+
+// optimizeImage losslessly recompresses an image to reduce its size:
+// - PNG images are re-encoded with best compression, using a palette if they have at most 256 colors,
+// and oriented upright according to their EXIF orientation, which is not re-encoded
+// - Sequential JPEG images are transcoded to progressive JPEG with optimized Huffman tables,
+// keeping their quantized coefficients and metadata, if this does not change their pixels
+// Returns the original data if the recompressed image is not smaller
+// or if optimization is not enabled for the given type.
+func optimizeImage(data []byte, ctype string, cfg ImageConfig) ([]byte, error) {
+	var (
+		optimized []byte
+		err       error
+	)
+
+	switch {
+	case ctype == MIMETypePNG && cfg.OptimizePNG:
+		optimized, err = optimizePNG(data)
+	case ctype == MIMETypeJPEG && cfg.OptimizeJPEG:
+		optimized, err = optimizeJPEG(data)
+	default:
+		return data, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(optimized) >= len(data) {
+		return data, nil
+	}
+
+	return optimized, nil
+}
+
+func optimizePNG(data []byte) ([]byte, error) {
+	img, err := decodeImage(bytes.NewReader(data), MIMETypePNG)
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	// The EXIF orientation is not re-encoded, so the image is stored upright
+	img = orientImage(img, imageOrientation(data, MIMETypePNG))
+
+	optimized, err := encodeOptimizedPNG(img)
+	if err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+
+	return optimized, nil
+}
+
+// optimizeJPEG transcodes a JPEG image losslessly. Images that cannot be transcoded, or whose
+// pixels would change, are returned unchanged.
+func optimizeJPEG(data []byte) ([]byte, error) {
+	transcoded, err := transcodeJPEG(data)
+	if errors.Is(err, ErrUnsupportedJPEG) {
+		return data, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("transcode image: %w", err)
+	}
+
+	if len(transcoded) >= len(data) {
+		return data, nil
+	}
+
+	same, err := sameJPEGPixels(data, transcoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if !same {
+		return data, nil
+	}
+
+	return transcoded, nil
+}
+
+func encodeOptimizedPNG(img image.Image) ([]byte, error) {
+	if paletted, ok := toPaletted(img); ok {
+		img = paletted
+	}
+
+	var buffer bytes.Buffer
+
+	//nolint:exhaustruct
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buffer, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// toPaletted converts an image to a palette image if it uses at most 256 distinct colors.
+// Returns false if the image uses more colors or already is a palette image.
+func toPaletted(img image.Image) (*image.Paletted, bool) {
+	if _, ok := img.(*image.Paletted); ok {
+		return nil, false
+	}
+
+	bounds := img.Bounds()
+	seen := make(map[color.NRGBA64]struct{}, maxPaletteColors)
+	palette := make(color.Palette, 0, maxPaletteColors)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c, _ := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			if _, ok := seen[c]; ok {
+				continue
+			}
+
+			// Palette entries are stored with 8 bits per channel, so only
+			// convert images that don't lose precision
+			if !is8Bit(c) {
+				return nil, false
+			}
+
+			if len(palette) == maxPaletteColors {
+				return nil, false
+			}
+
+			seen[c] = struct{}{}
+			palette = append(palette, c)
+		}
+	}
+
+	paletted := image.NewPaletted(bounds, palette)
+	draw.Draw(paletted, bounds, img, bounds.Min, draw.Src)
+
+	return paletted, true
+}
+
+// is8Bit reports whether all channels of the color can be represented with 8 bits.
+func is8Bit(c color.NRGBA64) bool {
+	for _, v := range []uint16{c.R, c.G, c.B, c.A} {
+		if v != (v>>8)*0x101 {
+			return false
+		}
+	}
+
+	return true
+}
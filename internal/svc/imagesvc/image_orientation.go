@@ -0,0 +1,101 @@
+package imagesvc
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// EXIF orientations, describing how the stored pixels must be transformed for display.
+const (
+	orientationNormal     = 1
+	orientationFlipH      = 2
+	orientationRotate180  = 3
+	orientationFlipV      = 4
+	orientationTranspose  = 5
+	orientationRotate90   = 6
+	orientationTransverse = 7
+	orientationRotate270  = 8
+)
+
+// imageOrientation returns the EXIF orientation of a JPEG or PNG image, or orientationNormal
+// if the image has no valid orientation.
+func imageOrientation(data []byte, mimeType string) int {
+	payload, err := exifPayload(data, mimeType)
+	if err != nil || payload == nil {
+		return orientationNormal
+	}
+
+	tiff, err := newTIFFReader(payload)
+	if err != nil {
+		return orientationNormal
+	}
+
+	ifd0, err := tiff.ifd(tiff.order.Uint32(tiff.data[4:8]))
+	if err != nil {
+		return orientationNormal
+	}
+
+	orientation := int(ifd0[exifTagOrientation].uint(0))
+	if orientation < orientationNormal || orientation > orientationRotate270 {
+		return orientationNormal
+	}
+
+	return orientation
+}
+
+// orientImage transforms an image with the given EXIF orientation into its upright form.
+// Images of the normal orientation are returned as is.
+func orientImage(src image.Image, orientation int) image.Image {
+	if orientation <= orientationNormal || orientation > orientationRotate270 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	var dst *image.RGBA
+
+	if orientation < orientationTranspose {
+		dst = image.NewRGBA(image.Rect(0, 0, width, height))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+
+	for y := range height {
+		for x := range width {
+			var dx, dy int
+
+			switch orientation {
+			case orientationFlipH:
+				dx, dy = width-1-x, y
+			case orientationRotate180:
+				dx, dy = width-1-x, height-1-y
+			case orientationFlipV:
+				dx, dy = x, height-1-y
+			case orientationTranspose:
+				dx, dy = y, x
+			case orientationRotate90:
+				dx, dy = height-1-y, x
+			case orientationTransverse:
+				dx, dy = height-1-y, width-1-x
+			default:
+				dx, dy = y, width-1-x
+			}
+
+			dst.SetRGBA(dx, dy, rgba.RGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
+
+// orientsOriginal reports whether original downloads of the image are served upright instead
+// of as stored, as configured by ImageConfig.AutoOrientOriginals.
+func (imageSvc BlobImageService) orientsOriginal(img domain.Media) bool {
+	return imageSvc.cfg.AutoOrientOriginals && imageOrientation(img.Bytes(), img.MIMEType()) != orientationNormal
+}
@@ -0,0 +1,124 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+// buildOrientedJPEG returns a JPEG image of 32x16 pixels, red on the left and blue on the
+// right half, with an EXIF orientation.
+func buildOrientedJPEG(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+
+	bitmap := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	draw.Draw(bitmap, image.Rect(0, 0, 16, 16), image.NewUniform(color.RGBA{R: 0xFF, A: 0xFF}), image.Point{}, draw.Src)
+	draw.Draw(bitmap, image.Rect(16, 0, 32, 16), image.NewUniform(color.RGBA{B: 0xFF, A: 0xFF}), image.Point{}, draw.Src)
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, bitmap, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+
+	entry := testTIFFEntry{tag: 0x0112, typ: 3, count: 1, value: binary.BigEndian.AppendUint16(nil, orientation)}
+	payload := slices.Concat([]byte("Exif\x00\x00"), []byte("MM\x00\x2A\x00\x00\x00\x08"), buildTestIFD(8, []testTIFFEntry{entry}))
+	app1 := slices.Concat([]byte{0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(payload)+2)), payload) //nolint:gosec
+
+	return slices.Concat(buffer.Bytes()[:2], app1, buffer.Bytes()[2:])
+}
+
+// colorAt returns "red" or "blue", whichever dominates the pixel.
+func colorAt(bitmap image.Image, x, y int) string {
+	if r, _, b, _ := bitmap.At(x, y).RGBA(); r > b {
+		return "red"
+	}
+
+	return "blue"
+}
+
+func TestBlobImageService_TransformOrientation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		orientation uint16
+		spec        transform.Spec
+		orientOrig  bool
+		processors  string
+		wantBounds  image.Rectangle
+		wantColors  [2]string // Colors at the top left and bottom right
+	}{
+		{orientation: 1, spec: transform.Spec{Width: 16}, wantBounds: image.Rect(0, 0, 16, 8), wantColors: [2]string{"red", "blue"}},
+		{orientation: 3, spec: transform.Spec{Width: 16}, wantBounds: image.Rect(0, 0, 16, 8), wantColors: [2]string{"blue", "red"}},
+		{orientation: 6, spec: transform.Spec{Width: 8}, wantBounds: image.Rect(0, 0, 8, 16), wantColors: [2]string{"red", "blue"}},
+		{orientation: 8, spec: transform.Spec{Width: 8}, wantBounds: image.Rect(0, 0, 8, 16), wantColors: [2]string{"blue", "red"}},
+		{
+			orientation: 6, spec: transform.Spec{Width: 8, Rotate: 90},
+			wantBounds: image.Rect(0, 0, 8, 4), wantColors: [2]string{"blue", "red"},
+		},
+		{orientation: 6, spec: transform.Spec{}, wantBounds: image.Rect(0, 0, 32, 16), wantColors: [2]string{"red", "blue"}},
+		{
+			orientation: 6, spec: transform.Spec{}, orientOrig: true,
+			wantBounds: image.Rect(0, 0, 16, 32), wantColors: [2]string{"red", "blue"},
+		},
+		{
+			orientation: 6, spec: transform.Spec{}, orientOrig: true, processors: "optimize",
+			wantBounds: image.Rect(0, 0, 16, 32), wantColors: [2]string{"red", "blue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d %v %v %s", tt.orientation, tt.spec, tt.orientOrig, tt.processors), func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig(tt.processors)
+			cfg.AutoOrientOriginals = tt.orientOrig
+			cfg.OptimizeJPEG = true
+
+			imageSvc, err := newTestImageService(t, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			stored, err := imageSvc.Store(ctx, domain.NewMedia(buildOrientedJPEG(t, tt.orientation), domain.MediaMeta{
+				Filename: "photo.jpg", Owner: "alice", MIMEType: imagesvc.MIMETypeJPEG,
+			}))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			transformed, err := imageSvc.Transform(ctx, stored.ID(), tt.spec)
+			if err != nil {
+				t.Fatalf("Transform() error = %v", err)
+			}
+
+			bitmap, err := jpeg.Decode(bytes.NewReader(transformed.Bytes()))
+			if err != nil {
+				t.Fatalf("decode transformed image: %v", err)
+			}
+
+			bounds := bitmap.Bounds()
+			if bounds != tt.wantBounds {
+				t.Fatalf("transformed bounds = %v, want %v", bounds, tt.wantBounds)
+			}
+
+			colors := [2]string{colorAt(bitmap, 1, 1), colorAt(bitmap, bounds.Dx()-2, bounds.Dy()-2)}
+			if colors != tt.wantColors {
+				t.Errorf("transformed colors = %v, want %v", colors, tt.wantColors)
+			}
+		})
+	}
+}
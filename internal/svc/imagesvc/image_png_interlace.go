@@ -0,0 +1,234 @@
+package imagesvc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+)
+
+// ErrImageTooLargeForPNG is returned when an image exceeds the dimensions a PNG image can have.
+var ErrImageTooLargeForPNG = errors.New("image too large for PNG")
+
+// PNG color types written by encodeInterlacedPNG.
+const (
+	pngColorGray = 0
+	pngColorRGB  = 2
+	pngColorRGBA = 6
+)
+
+// PNG row filter types.
+const (
+	pngFilterNone = iota
+	pngFilterSub
+	pngFilterUp
+	pngFilterAverage
+	pngFilterPaeth
+	pngFilters
+)
+
+const pngMaxDim = 1<<31 - 1
+
+// adam7Passes are the offsets and strides of the pixels of the seven passes of Adam7 interlacing.
+//
+//nolint:gochecknoglobals
+var adam7Passes = [7]struct{ x, y, dx, dy int }{
+	{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4}, {0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2},
+}
+
+// encodeInterlacedPNG writes an image as Adam7 interlaced PNG with 8 bits per sample.
+// Grayscale images are written as grayscale, opaque images as RGB and other images as RGBA.
+// Each row is filtered with the filter minimizing the sum of its absolute differences, like png.Encode.
+// Returns ErrImageTooLargeForPNG if a dimension exceeds 2^31-1 pixels.
+func encodeInterlacedPNG(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	if bounds.Dx() > pngMaxDim || bounds.Dy() > pngMaxDim {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLargeForPNG, bounds.Dx(), bounds.Dy())
+	}
+
+	colorType, bpp := byte(pngColorRGBA), 4
+	if _, ok := img.(*image.Gray); ok {
+		colorType, bpp = pngColorGray, 1
+	} else if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		colorType, bpp = pngColorRGB, 3
+	}
+
+	var idat bytes.Buffer
+
+	zw := zlib.NewWriter(&idat)
+
+	for _, pass := range adam7Passes {
+		if err := writeAdam7Pass(zw, img, pass, bpp); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+
+	ihdr := make([]byte, 13)                                   //nolint:mnd // size of the IHDR chunk
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(bounds.Dx())) //nolint:gosec // checked above
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(bounds.Dy())) //nolint:gosec // checked above
+	ihdr[8] = 8                                                // bits per sample
+	ihdr[9] = colorType
+	ihdr[12] = 1 // Adam7 interlacing
+
+	var buf bytes.Buffer
+
+	buf.WriteString(imageExtHeaders[MIMETypePNG][0])
+	writePNGChunk(&buf, "IHDR", ihdr)
+	writePNGChunk(&buf, "IDAT", idat.Bytes())
+	writePNGChunk(&buf, "IEND", nil)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// writeAdam7Pass writes the filtered rows of an Adam7 pass. Passes without pixels have no rows.
+func writeAdam7Pass(w io.Writer, img image.Image, pass struct{ x, y, dx, dy int }, bpp int) error {
+	bounds := img.Bounds()
+
+	width := (bounds.Dx() - pass.x + pass.dx - 1) / pass.dx
+	if width <= 0 || pass.y >= bounds.Dy() {
+		return nil
+	}
+
+	prev := make([]byte, width*bpp)
+	cur := make([]byte, width*bpp)
+	filtered := make([][]byte, pngFilters)
+
+	for i := range filtered {
+		filtered[i] = make([]byte, 1+width*bpp)
+		filtered[i][0] = byte(i)
+	}
+
+	for y := pass.y; y < bounds.Dy(); y += pass.dy {
+		for i := range width {
+			readPNGPixel(cur[i*bpp:(i+1)*bpp], img, bounds.Min.X+pass.x+i*pass.dx, bounds.Min.Y+y)
+		}
+
+		if _, err := w.Write(filterPNGRow(filtered, cur, prev, bpp)); err != nil {
+			return fmt.Errorf("compress: %w", err)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return nil
+}
+
+// readPNGPixel reads the samples of a pixel into dst, which holds one sample for
+// grayscale images, three for RGB and four for RGBA.
+func readPNGPixel(dst []byte, img image.Image, x, y int) {
+	if gray, ok := img.(*image.Gray); ok {
+		dst[0] = gray.GrayAt(x, y).Y
+
+		return
+	}
+
+	// Opaque pixels of images resized by transformImage are read directly, as reading them
+	// through their color model is slow
+	if rgba, ok := img.(*image.RGBA); ok {
+		if c := rgba.RGBAAt(x, y); c.A == 0xFF {
+			copy(dst, []byte{c.R, c.G, c.B, c.A})
+
+			return
+		}
+	}
+
+	c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA) //nolint:forcetypeassert
+	copy(dst, []byte{c.R, c.G, c.B, c.A})
+}
+
+// filterPNGRow filters a row with each filter into filtered and returns the result of the filter
+// minimizing the sum of the absolute values of the filtered samples, taken as signed bytes.
+func filterPNGRow(filtered [][]byte, cur, prev []byte, bpp int) []byte {
+	best, bestSum := filtered[pngFilterNone], -1
+
+	for filter, row := range filtered {
+		sum := 0
+
+		for i, sample := range cur {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+
+			up = prev[i]
+
+			switch filter {
+			case pngFilterSub:
+				sample -= left
+			case pngFilterUp:
+				sample -= up
+			case pngFilterAverage:
+				sample -= byte((int(left) + int(up)) / 2) //nolint:mnd
+			case pngFilterPaeth:
+				sample -= paeth(left, up, upLeft)
+			}
+
+			row[1+i] = sample
+			sum += absSigned(sample)
+		}
+
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = row, sum
+		}
+	}
+
+	return best
+}
+
+// paeth returns the Paeth predictor of a sample from its left, upper and upper left neighbors.
+func paeth(left, up, upLeft byte) byte {
+	p := int(left) + int(up) - int(upLeft)
+	pa, pb, pc := abs(p-int(left)), abs(p-int(up)), abs(p-int(upLeft))
+
+	switch {
+	case pa <= pb && pa <= pc:
+		return left
+	case pb <= pc:
+		return up
+	default:
+		return upLeft
+	}
+}
+
+// absSigned returns the absolute value of a byte taken as signed byte.
+func absSigned(b byte) int {
+	return abs(int(int8(b))) //nolint:gosec // reinterpreting the byte is intended
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// writePNGChunk writes a PNG chunk with the given type and data.
+func writePNGChunk(buf *bytes.Buffer, chunkType string, data []byte) {
+	var header [8]byte
+
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data))) //nolint:gosec // chunks are smaller than 2^31
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header[4:])
+	_, _ = crc.Write(data)
+
+	buf.Write(header[:])
+	buf.Write(data)
+	_ = binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,197 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/infra/metrics"
+)
+
+var (
+	// ErrInvalidProcessorChain is returned when the configured processor chain cannot be created.
+	ErrInvalidProcessorChain = errors.New("invalid processor chain")
+
+	// ErrUnknownProcessor is returned when the configured processor chain names an unregistered processor.
+	ErrUnknownProcessor = errors.New("unknown image processor")
+)
+
+// Processor is a step of the ingest pipeline, processing an image before it is stored.
+// Processors return the image unchanged if they do not apply to it.
+type Processor interface {
+	Process(ctx context.Context, image domain.Media) (domain.Media, error)
+}
+
+// PassthroughProcessor is implemented by processors that know in advance which images they
+// leave unchanged, so these images can be stored without being read into memory.
+type PassthroughProcessor interface {
+	Processor
+
+	// PassesThrough reports whether the processor returns images of the given MIME type unchanged.
+	PassesThrough(mimeType string) bool
+}
+
+// ProcessorFunc adapts an ordinary function to the Processor interface.
+type ProcessorFunc func(ctx context.Context, image domain.Media) (domain.Media, error)
+
+// Process implements Processor by calling fn.
+func (fn ProcessorFunc) Process(ctx context.Context, image domain.Media) (domain.Media, error) {
+	return fn(ctx, image)
+}
+
+// ProcessorFactory creates a Processor from the image service configuration.
+type ProcessorFactory func(cfg ImageConfig) (Processor, error)
+
+//nolint:gochecknoglobals
+var (
+	processorsMu sync.RWMutex
+
+	// processorFactories maps processor names to their factories.
+	processorFactories = map[string]ProcessorFactory{
+		"exif_strip": newExifStripProcessor,
+		"optimize":   newOptimizeProcessor,
+		"classify":   newClassifyProcessor,
+		"watermark":  newWatermarkProcessor,
+	}
+)
+
+// RegisterProcessor makes a processor available under the given name, so it can be
+// selected in ImageConfig.Processors. A processor registered under an existing name replaces it.
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+
+	processorFactories[strings.ToLower(name)] = factory
+}
+
+// ProcessorNames returns the sorted names of all registered processors.
+func ProcessorNames() []string {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+
+	names := make([]string, 0, len(processorFactories))
+	for name := range processorFactories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ProcessorChain runs an ordered list of processors, passing the result of each
+// processor to the next one.
+type ProcessorChain struct {
+	names      []string
+	processors []Processor
+	duration   *metrics.HistogramVec
+	log        logging.Logger
+}
+
+var _ PassthroughProcessor = (*ProcessorChain)(nil)
+
+// NewProcessorChain creates the processor chain selected by the comma-separated
+// processor names of cfg.Processors.
+// Returns ErrInvalidProcessorChain if a name is not registered (ErrUnknownProcessor)
+// or a processor cannot be created.
+func NewProcessorChain(cfg ImageConfig) (*ProcessorChain, error) {
+	chain := &ProcessorChain{
+		names:      nil,
+		processors: nil,
+		duration: metrics.Default().NewHistogramVec(
+			"imagesvc_processor_duration_seconds",
+			"Duration of image processors on ingest by processor.",
+			metrics.DefaultDurationBuckets,
+			"processor",
+		),
+		log: logging.GetLogger("svc.imagesvc.processor_chain"),
+	}
+
+	for _, name := range strings.Split(cfg.Processors, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		processorsMu.RLock()
+		factory, ok := processorFactories[name]
+		processorsMu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("%w: %w: %q", ErrInvalidProcessorChain, ErrUnknownProcessor, name)
+		}
+
+		processor, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: new processor %q: %w", ErrInvalidProcessorChain, name, err)
+		}
+
+		chain.names = append(chain.names, name)
+		chain.processors = append(chain.processors, processor)
+	}
+
+	return chain, nil
+}
+
+// Names returns the names of the processors in the order they are run.
+func (chain *ProcessorChain) Names() []string {
+	return append([]string(nil), chain.names...)
+}
+
+// PassesThrough implements PassthroughProcessor. Images pass through the chain if they pass
+// through all of its processors, which is never the case for processors not implementing
+// PassthroughProcessor.
+func (chain *ProcessorChain) PassesThrough(mimeType string) bool {
+	for _, processor := range chain.processors {
+		passthrough, ok := processor.(PassthroughProcessor)
+		if !ok || !passthrough.PassesThrough(mimeType) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Process implements Processor by running all processors of the chain in order.
+// Processing stops at the first processor returning an error.
+func (chain *ProcessorChain) Process(ctx context.Context, image domain.Media) (domain.Media, error) {
+	for i, processor := range chain.processors {
+		start := time.Now()
+
+		processed, err := processor.Process(ctx, image)
+		if err != nil {
+			return domain.Media{}, fmt.Errorf("processor %q: %w", chain.names[i], err)
+		}
+
+		chain.duration.With(chain.names[i]).ObserveDuration(start)
+
+		if processed.Size() != image.Size() || processed.Hash() != image.Hash() {
+			chain.log.DebugContext(ctx, "image processed",
+				logging.Group("image", "id", image.ID(), "size", image.Size(), "processedSize", processed.Size()),
+				"processor", chain.names[i],
+			)
+		}
+
+		image = processed
+	}
+
+	return image, nil
+}
+
+// withProcessedData returns a copy of image with the given data, keeping the metadata
+// and recording the size and hash of the image before its first modification.
+func withProcessedData(image domain.Media, data []byte) domain.Media {
+	meta := image.Meta()
+	if meta.OriginalSize == 0 {
+		meta.OriginalSize = image.Size()
+		meta.OriginalHash = image.Hash()
+	}
+
+	return domain.NewMedia(data, meta)
+}
@@ -0,0 +1,404 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func testConfig(processors string) imagesvc.ImageConfig {
+	return imagesvc.ImageConfig{
+		Interpolator:        "catmullrom",
+		Processors:          processors,
+		OptimizePNG:         false,
+		OptimizeJPEG:        false,
+		OptimizeJPEGQuality: 85,
+		JPEGQuality:         75,
+		JPEGMinQuality:      1,
+		JPEGMaxQuality:      100,
+		WatermarkFile:       "",
+		WatermarkOpacity:    50,
+		WatermarkScale:      25,
+		CacheGCInterval:     0,
+	}
+}
+
+func encodeTestImage(t *testing.T, ctype string, width, height int, photo bool) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			c := color.RGBA{R: 0xFF, A: 0xFF}
+			if photo {
+				c = color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 0xFF} //nolint:gosec
+			}
+
+			img.Set(x, y, c)
+		}
+	}
+
+	var buffer bytes.Buffer
+
+	var err error
+	if ctype == imagesvc.MIMETypeJPEG {
+		err = jpeg.Encode(&buffer, img, nil)
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+
+	if err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func newTestMedia(data []byte, ctype string) domain.Media {
+	return domain.NewMedia(data, domain.MediaMeta{
+		Filename:     "test",
+		ID:           "",
+		Hash:         "",
+		Size:         0,
+		Owner:        "alice",
+		MIMEType:     ctype,
+		OriginalSize: 0,
+		Modified:     0,
+		Category:     "",
+	})
+}
+
+func newTestImageService(t *testing.T, cfg imagesvc.ImageConfig) (*imagesvc.BlobImageService, error) {
+	t.Helper()
+
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory,
+		mediasvc.MediaConfig{MaxSize: 1 << 20, ChangeLogDeletions: 100})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	return imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+}
+
+func TestProcessorChain_Order(t *testing.T) {
+	t.Parallel()
+
+	appender := func(suffix string) imagesvc.ProcessorFactory {
+		return func(imagesvc.ImageConfig) (imagesvc.Processor, error) {
+			return imagesvc.ProcessorFunc(func(_ context.Context, image domain.Media) (domain.Media, error) {
+				return domain.NewMedia(append(slices.Clone(image.Bytes()), suffix...), image.Meta()), nil
+			}), nil
+		}
+	}
+
+	imagesvc.RegisterProcessor("test_append_a", appender("a"))
+	imagesvc.RegisterProcessor("test_append_b", appender("b"))
+
+	chain, err := imagesvc.NewProcessorChain(testConfig(" test_append_b, test_append_a,,TEST_APPEND_B "))
+	if err != nil {
+		t.Fatalf("new processor chain: %v", err)
+	}
+
+	if names := chain.Names(); !slices.Equal(names, []string{"test_append_b", "test_append_a", "test_append_b"}) {
+		t.Errorf("names = %v", names)
+	}
+
+	processed, err := chain.Process(context.Background(), newTestMedia([]byte("x"), "text/plain"))
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	if got := string(processed.Bytes()); got != "xbab" {
+		t.Errorf("processed = %q, want %q", got, "xbab")
+	}
+
+	if !slices.Contains(imagesvc.ProcessorNames(), "test_append_a") {
+		t.Errorf("registered processor missing from %v", imagesvc.ProcessorNames())
+	}
+}
+
+func TestNewProcessorChain_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		processors string
+		wantErr    error
+	}{
+		{"unknown processor", "optimize,bogus", imagesvc.ErrUnknownProcessor},
+		{"watermark without file", "watermark", imagesvc.ErrWatermarkNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := imagesvc.NewProcessorChain(testConfig(tt.processors))
+			if !errors.Is(err, imagesvc.ErrInvalidProcessorChain) || !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessorChain_ExifStrip(t *testing.T) {
+	t.Parallel()
+
+	data := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 16, true)
+	exif := append([]byte{0xFF, 0xE1, 0x00, 0x0C}, "Exif\x00\x00MM\x00*"...)
+	withExif := slices.Concat(data[:2], exif, data[2:])
+
+	tests := []struct {
+		name     string
+		data     []byte
+		ctype    string
+		wantSize int
+		wantErr  error
+	}{
+		{"jpeg with exif", withExif, imagesvc.MIMETypeJPEG, len(data), nil},
+		{"jpeg without exif", data, imagesvc.MIMETypeJPEG, len(data), nil},
+		{"other type", []byte("Exif\x00\x00"), "image/gif", 6, nil},
+		{"malformed jpeg", []byte("not a jpeg"), imagesvc.MIMETypeJPEG, 0, imagesvc.ErrMalformedImage},
+	}
+
+	chain, err := imagesvc.NewProcessorChain(testConfig("exif_strip"))
+	if err != nil {
+		t.Fatalf("new processor chain: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			processed, err := chain.Process(context.Background(), newTestMedia(tt.data, tt.ctype))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if processed.Size() != int64(tt.wantSize) {
+				t.Errorf("size = %d, want %d", processed.Size(), tt.wantSize)
+			}
+
+			if stripped := len(tt.data) != tt.wantSize; stripped != (processed.Meta().OriginalSize != 0) {
+				t.Errorf("original size = %d", processed.Meta().OriginalSize)
+			}
+		})
+	}
+}
+
+func TestProcessorChain_Classify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		photo  bool
+		want   string
+	}{
+		{"icon", 64, 64, true, imagesvc.CategoryIcon},
+		{"graphic", 256, 200, false, imagesvc.CategoryGraphic},
+		{"photo", 256, 200, true, imagesvc.CategoryPhoto},
+	}
+
+	chain, err := imagesvc.NewProcessorChain(testConfig("classify"))
+	if err != nil {
+		t.Fatalf("new processor chain: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := encodeTestImage(t, imagesvc.MIMETypePNG, tt.width, tt.height, tt.photo)
+
+			processed, err := chain.Process(context.Background(), newTestMedia(data, imagesvc.MIMETypePNG))
+			if err != nil {
+				t.Fatalf("process: %v", err)
+			}
+
+			if got := processed.Meta().Category; got != tt.want {
+				t.Errorf("category = %q, want %q", got, tt.want)
+			}
+
+			if !bytes.Equal(processed.Bytes(), data) {
+				t.Error("classify modified image data")
+			}
+		})
+	}
+}
+
+func TestProcessorChain_Watermark(t *testing.T) {
+	t.Parallel()
+
+	watermarkFile := filepath.Join(t.TempDir(), "watermark.png")
+	if err := os.WriteFile(watermarkFile, encodeTestImage(t, imagesvc.MIMETypePNG, 400, 100, true), 0o600); err != nil {
+		t.Fatalf("write watermark: %v", err)
+	}
+
+	cfg := testConfig("watermark")
+	cfg.WatermarkFile = watermarkFile
+
+	chain, err := imagesvc.NewProcessorChain(cfg)
+	if err != nil {
+		t.Fatalf("new processor chain: %v", err)
+	}
+
+	data := encodeTestImage(t, imagesvc.MIMETypePNG, 200, 100, false)
+
+	processed, err := chain.Process(context.Background(), newTestMedia(data, imagesvc.MIMETypePNG))
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(processed.Bytes()))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if bounds := img.Bounds(); bounds.Dx() != 200 || bounds.Dy() != 100 {
+		t.Errorf("bounds = %v", bounds)
+	}
+
+	// The watermark is scaled to 25% of the image width in the bottom right corner
+	red := color.RGBAModel.Convert(color.RGBA{R: 0xFF, A: 0xFF})
+	if c := color.RGBAModel.Convert(img.At(10, 10)); c != red {
+		t.Errorf("pixel outside watermark = %v, want %v", c, red)
+	}
+
+	if c := color.RGBAModel.Convert(img.At(175, 90)); c == red {
+		t.Errorf("pixel inside watermark = %v, want blended", c)
+	}
+
+	if processed.Meta().OriginalSize != int64(len(data)) {
+		t.Errorf("original size = %d, want %d", processed.Meta().OriginalSize, len(data))
+	}
+}
+
+func TestProcessorChain_Optimize(t *testing.T) {
+	t.Parallel()
+
+	encodeGray := func(width, height int) []byte {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for i := range img.Pix {
+			img.Pix[i] = uint8(i * 7) //nolint:gosec
+		}
+
+		var buffer bytes.Buffer
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 90}); err != nil {
+			t.Fatalf("encode jpeg: %v", err)
+		}
+
+		return buffer.Bytes()
+	}
+
+	photo := encodeTestImage(t, imagesvc.MIMETypeJPEG, 64, 48, true)
+	exif := append([]byte{0xFF, 0xE1, 0x00, 0x0C}, "Exif\x00\x00MM\x00*"...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"jpeg 1x1", encodeTestImage(t, imagesvc.MIMETypeJPEG, 1, 1, true)},
+		{"jpeg 17x9", encodeTestImage(t, imagesvc.MIMETypeJPEG, 17, 9, true)},
+		{"jpeg 33x65", encodeTestImage(t, imagesvc.MIMETypeJPEG, 33, 65, true)},
+		{"jpeg 64x48", photo},
+		{"jpeg with exif", slices.Concat(photo[:2], exif, photo[2:])},
+		{"gray jpeg 17x9", encodeGray(17, 9)},
+		{"gray jpeg 64x48", encodeGray(64, 48)},
+	}
+
+	cfg := testConfig("optimize")
+	cfg.OptimizeJPEG = true
+
+	chain, err := imagesvc.NewProcessorChain(cfg)
+	if err != nil {
+		t.Fatalf("new processor chain: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			original := newTestMedia(tt.data, imagesvc.MIMETypeJPEG)
+
+			processed, err := chain.Process(context.Background(), original)
+			if err != nil {
+				t.Fatalf("process: %v", err)
+			}
+
+			if processed.Size() >= original.Size() {
+				t.Fatalf("size = %d, want less than %d", processed.Size(), original.Size())
+			}
+
+			meta := processed.Meta()
+			if meta.OriginalSize != original.Size() || meta.OriginalHash != original.Hash() {
+				t.Errorf("original size, hash = %d, %q, want %d, %q",
+					meta.OriginalSize, meta.OriginalHash, original.Size(), original.Hash())
+			}
+
+			// Progressive images start with a SOF2 marker, other segments are kept
+			if !bytes.Contains(processed.Bytes(), []byte{0xFF, 0xC2}) {
+				t.Error("optimized image is not progressive")
+			}
+
+			if bytes.Contains(tt.data, exif) && !bytes.Contains(processed.Bytes(), exif) {
+				t.Error("optimized image lost its EXIF segment")
+			}
+
+			assertSamePixels(t, tt.data, processed.Bytes())
+
+			// Progressive images are not transcoded again
+			again, err := chain.Process(context.Background(), processed)
+			if err != nil || !bytes.Equal(again.Bytes(), processed.Bytes()) || again.Meta().OriginalHash != original.Hash() {
+				t.Errorf("process optimized image = %d bytes, %v, want unchanged", again.Size(), err)
+			}
+		})
+	}
+}
+
+// assertSamePixels fails the test unless both JPEG images decode to the same pixels.
+func assertSamePixels(t *testing.T, data, other []byte) {
+	t.Helper()
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode image: %v", err)
+	}
+
+	otherImg, err := jpeg.Decode(bytes.NewReader(other))
+	if err != nil {
+		t.Fatalf("decode other image: %v", err)
+	}
+
+	if img.Bounds() != otherImg.Bounds() {
+		t.Fatalf("bounds = %v, want %v", otherImg.Bounds(), img.Bounds())
+	}
+
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if c, otherC := img.At(x, y), otherImg.At(x, y); c != otherC {
+				t.Fatalf("pixel at %d,%d = %v, want %v", x, y, otherC, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestBlobImageService_TransformProgressive(t *testing.T) {
+	t.Parallel()
+
+	var gray bytes.Buffer
+
+	grayImg := image.NewGray(image.Rect(0, 0, 37, 29))
+	for i := range grayImg.Pix {
+		grayImg.Pix[i] = uint8(i * 7) //nolint:gosec
+	}
+
+	if err := png.Encode(&gray, grayImg); err != nil {
+		t.Fatalf("encode gray image: %v", err)
+	}
+
+	photo := encodeTestImage(t, imagesvc.MIMETypePNG, 75, 50, true)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		spec      transform.Spec
+		wantType  string
+		tolerance float64 // Maximum mean difference of the samples to those of the standard encoders
+	}{
+		{name: "progressive jpeg", data: photo, spec: transform.Spec{Width: 37, Format: "jpeg"}, wantType: imagesvc.MIMETypeJPEG, tolerance: 4},
+		{name: "progressive grayscale jpeg", data: gray.Bytes(), spec: transform.Spec{Format: "jpeg"}, wantType: imagesvc.MIMETypeJPEG, tolerance: 4},
+		{name: "progressive tiny jpeg", data: photo, spec: transform.Spec{Width: 5, Format: "jpeg"}, wantType: imagesvc.MIMETypeJPEG, tolerance: 4},
+		{name: "progressive best quality jpeg", data: photo, spec: transform.Spec{Width: 64, Format: "jpeg", Quality: 100}, wantType: imagesvc.MIMETypeJPEG, tolerance: 2},
+		{name: "interlaced png", data: photo, spec: transform.Spec{Width: 37}, wantType: imagesvc.MIMETypePNG, tolerance: 0},
+		{name: "interlaced tiny png", data: photo, spec: transform.Spec{Width: 3}, wantType: imagesvc.MIMETypePNG, tolerance: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transformed := make(map[bool][]byte, 2)
+
+			for _, enabled := range []bool{false, true} {
+				cfg := testConfig("")
+				cfg.ProgressiveJPEG = enabled
+				cfg.InterlacedPNG = enabled
+
+				imageSvc, err := newTestImageService(t, cfg)
+				if err != nil {
+					t.Fatalf("new image service: %v", err)
+				}
+
+				ctx := context_.WithUsername(context.Background(), "alice")
+
+				stored, err := imageSvc.Store(ctx, domain.NewMedia(tt.data, domain.MediaMeta{
+					Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+				}))
+				if err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+
+				media, err := imageSvc.Transform(ctx, stored.ID(), tt.spec)
+				if err != nil {
+					t.Fatalf("Transform() error = %v", err)
+				}
+
+				if media.MIMEType() != tt.wantType {
+					t.Fatalf("Transform() type = %s, want %s", media.MIMEType(), tt.wantType)
+				}
+
+				transformed[enabled] = media.Bytes()
+			}
+
+			if got := isProgressive(transformed[true], tt.wantType); !got {
+				t.Error("image is not progressive or interlaced")
+			}
+
+			if got := isProgressive(transformed[false], tt.wantType); got {
+				t.Error("image is progressive or interlaced while disabled")
+			}
+
+			if diff := meanSampleDiff(t, transformed[true], transformed[false]); diff > tt.tolerance {
+				t.Errorf("mean sample difference = %.2f, want at most %.2f", diff, tt.tolerance)
+			}
+		})
+	}
+}
+
+// isProgressive reports whether a JPEG image is progressive or a PNG image is interlaced.
+func isProgressive(data []byte, mimeType string) bool {
+	if mimeType == imagesvc.MIMETypePNG {
+		// Interlace method of the IHDR chunk following the signature
+		return len(data) > 28 && data[28] == 1
+	}
+
+	return bytes.Contains(data, []byte{0xFF, 0xC2})
+}
+
+// meanSampleDiff decodes two images of the same size and returns the mean absolute difference
+// of their red, green and blue samples.
+func meanSampleDiff(t *testing.T, a, b []byte) float64 {
+	t.Helper()
+
+	imgA, _, err := image.Decode(bytes.NewReader(a))
+	if err != nil {
+		t.Fatalf("decode image: %v", err)
+	}
+
+	imgB, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode image: %v", err)
+	}
+
+	if imgA.Bounds() != imgB.Bounds() {
+		t.Fatalf("bounds = %v, want %v", imgA.Bounds(), imgB.Bounds())
+	}
+
+	var sum, count float64
+
+	for y := imgA.Bounds().Min.Y; y < imgA.Bounds().Max.Y; y++ {
+		for x := imgA.Bounds().Min.X; x < imgA.Bounds().Max.X; x++ {
+			ra, ga, ba, _ := imgA.At(x, y).RGBA()
+			rb, gb, bb, _ := imgB.At(x, y).RGBA()
+
+			for _, d := range []int{int(ra>>8) - int(rb>>8), int(ga>>8) - int(gb>>8), int(ba>>8) - int(bb>>8)} {
+				sum += float64(max(d, -d))
+				count++
+			}
+		}
+	}
+
+	return sum / count
+}
+
+func TestBlobImageService_TransformProgressiveCache(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		spec transform.Spec
+		set  func(cfg *imagesvc.ImageConfig, enabled bool)
+	}{
+		{name: "jpeg", spec: transform.Spec{Width: 37, Format: "jpeg"},
+			set: func(cfg *imagesvc.ImageConfig, enabled bool) { cfg.ProgressiveJPEG = enabled }},
+		{name: "png", spec: transform.Spec{Width: 37},
+			set: func(cfg *imagesvc.ImageConfig, enabled bool) { cfg.InterlacedPNG = enabled }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Services of each setting share the storage, and so the cached images
+			factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+			mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory,
+				mediasvc.MediaConfig{MaxSize: 1 << 20, ChangeLogDeletions: 100})
+			if err != nil {
+				t.Fatalf("new media service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, testConfig(""))
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 75, 50, true),
+				domain.MediaMeta{Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG},
+			))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			// Each change of the setting is served with the new encoding, not the cached one
+			for _, enabled := range []bool{false, true, false, true} {
+				cfg := testConfig("")
+				tt.set(&cfg, enabled)
+
+				imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+				if err != nil {
+					t.Fatalf("new image service: %v", err)
+				}
+
+				media, err := imageSvc.Transform(ctx, stored.ID(), tt.spec)
+				if err != nil {
+					t.Fatalf("Transform() error = %v", err)
+				}
+
+				if got := isProgressive(media.Bytes(), media.MIMEType()); got != enabled {
+					t.Errorf("progressive or interlaced = %t, want %t", got, enabled)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package imagesvc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+// ErrInvalidJPEGQuality is returned when the configured JPEG qualities are out of range.
+var ErrInvalidJPEGQuality = errors.New("invalid JPEG quality")
+
+// checkJPEGQuality returns ErrInvalidJPEGQuality unless the configured JPEG qualities are
+// between transform.MinQuality and transform.MaxQuality, and the default quality lies within
+// the bounds of requested qualities.
+func checkJPEGQuality(cfg ImageConfig) error {
+	if cfg.JPEGMinQuality < transform.MinQuality || cfg.JPEGMaxQuality > transform.MaxQuality ||
+		cfg.JPEGMinQuality > cfg.JPEGMaxQuality {
+		return fmt.Errorf("%w: bounds must be within %d-%d, got %d-%d", ErrInvalidJPEGQuality,
+			transform.MinQuality, transform.MaxQuality, cfg.JPEGMinQuality, cfg.JPEGMaxQuality)
+	}
+
+	if cfg.JPEGQuality < cfg.JPEGMinQuality || cfg.JPEGQuality > cfg.JPEGMaxQuality {
+		return fmt.Errorf("%w: default must be within %d-%d, got %d", ErrInvalidJPEGQuality,
+			cfg.JPEGMinQuality, cfg.JPEGMaxQuality, cfg.JPEGQuality)
+	}
+
+	return nil
+}
+
+// boundQuality limits a requested quality to the configured bounds.
+// A quality of 0 requests the default quality and is returned as is.
+func (imageSvc BlobImageService) boundQuality(quality int) int {
+	if quality == 0 {
+		return 0
+	}
+
+	return min(max(quality, imageSvc.cfg.JPEGMinQuality), imageSvc.cfg.JPEGMaxQuality)
+}
@@ -0,0 +1,100 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+func TestNewBlobImageService_JPEGQuality(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                string
+		quality, minQ, maxQ int
+		wantErr             bool
+	}{
+		{name: "valid", quality: 75, minQ: 1, maxQ: 100},
+		{name: "default at bounds", quality: 40, minQ: 40, maxQ: 40},
+		{name: "min out of range", quality: 75, minQ: 0, maxQ: 100, wantErr: true},
+		{name: "max out of range", quality: 75, minQ: 1, maxQ: 101, wantErr: true},
+		{name: "bounds inverted", quality: 75, minQ: 80, maxQ: 70, wantErr: true},
+		{name: "default out of bounds", quality: 90, minQ: 1, maxQ: 80, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig("")
+			cfg.JPEGQuality, cfg.JPEGMinQuality, cfg.JPEGMaxQuality = tt.quality, tt.minQ, tt.maxQ
+
+			_, err := newTestImageService(t, cfg)
+			if got := errors.Is(err, imagesvc.ErrInvalidJPEGQuality); got != tt.wantErr {
+				t.Errorf("NewBlobImageService() error = %v, want ErrInvalidJPEGQuality: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlobImageService_TransformQuality(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig("")
+	cfg.JPEGQuality, cfg.JPEGMinQuality, cfg.JPEGMaxQuality = 60, 30, 90
+
+	imageSvc, err := newTestImageService(t, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypeJPEG, 64, 64, true), domain.MediaMeta{
+		Filename: "photo.jpg", Owner: "alice", MIMEType: imagesvc.MIMETypeJPEG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	transformed := func(t *testing.T, quality int) []byte {
+		t.Helper()
+
+		image, err := imageSvc.Transform(ctx, stored.ID(), transform.Spec{Width: 32, Quality: quality})
+		if err != nil {
+			t.Fatalf("Transform(q:%d) error = %v", quality, err)
+		}
+
+		return image.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		quality  int
+		wantLike int
+	}{
+		{name: "default", quality: 0, wantLike: 60},
+		{name: "raised to minimum", quality: 1, wantLike: 30},
+		{name: "lowered to maximum", quality: 100, wantLike: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if !bytes.Equal(transformed(t, tt.quality), transformed(t, tt.wantLike)) {
+				t.Errorf("quality %d not encoded like quality %d", tt.quality, tt.wantLike)
+			}
+		})
+	}
+
+	if bytes.Equal(transformed(t, 30), transformed(t, 90)) {
+		t.Error("qualities 30 and 90 encoded alike")
+	}
+}
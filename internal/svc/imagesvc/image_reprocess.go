@@ -0,0 +1,182 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/tokenbucket"
+)
+
+// ErrNoReprocessProcessors is returned when a reprocessing job does not name any processor.
+var ErrNoReprocessProcessors = errors.New("no processors to reprocess with")
+
+// ReprocessProgressFunc receives the progress of a reprocessing job after each media.
+// The status must not be modified or retained, clone it to keep it.
+type ReprocessProgressFunc func(status domain.MediaReprocessStatus)
+
+// Reprocess implements ImageService.Reprocess.
+func (imageSvc BlobImageService) Reprocess(
+	ctx context.Context,
+	req domain.MediaReprocessRequest,
+	progress ReprocessProgressFunc,
+) (status domain.MediaReprocessStatus, err error) {
+	log := imageSvc.log.With(logging.Group("reprocess", "processors", req.Processors, "owner", req.Owner))
+
+	status = domain.MediaReprocessStatus{
+		Running:    true,
+		Processors: req.Processors,
+		Owner:      req.Owner,
+		Total:      0,
+		Processed:  0,
+		Changed:    0,
+		Failed:     0,
+		Replaced:   make(map[string]string),
+		Started:    time.Now().UnixMilli(),
+		Finished:   0,
+		Error:      "",
+	}
+
+	defer func() {
+		status.Running = false
+		status.Finished = time.Now().UnixMilli()
+
+		if err != nil {
+			status.Error = err.Error()
+			log.ErrorContext(ctx, "reprocess failed", "processed", status.Processed, "error", err)
+		} else {
+			log.InfoContext(ctx, "reprocess finished",
+				"processed", status.Processed, "changed", status.Changed, "failed", status.Failed)
+		}
+	}()
+
+	if len(req.Processors) == 0 {
+		return status, fmt.Errorf("%w: %w", ErrInvalidProcessorChain, ErrNoReprocessProcessors)
+	}
+
+	cfg := imageSvc.cfg
+	cfg.Processors = strings.Join(req.Processors, ",")
+
+	chain, err := NewProcessorChain(cfg)
+	if err != nil {
+		return status, fmt.Errorf("new processor chain: %w", err)
+	}
+
+	metas, err := imageSvc.mediaSvc.ListAll(ctx)
+	if err != nil {
+		return status, fmt.Errorf("list all: %w", err)
+	}
+
+	metas = slices.DeleteFunc(metas, func(meta domain.MediaMeta) bool {
+		return req.Owner != "" && meta.Owner != req.Owner
+	})
+	status.Total = len(metas)
+
+	rate := req.Rate
+	if rate <= 0 {
+		rate = imageSvc.cfg.ReprocessRate
+	}
+
+	var bucket *tokenbucket.Bucket
+	if rate > 0 {
+		bucket = tokenbucket.New(float64(rate), 1)
+	}
+
+	log.InfoContext(ctx, "reprocess started", "total", status.Total, "rate", rate)
+
+	for _, meta := range metas {
+		if bucket != nil {
+			if err := bucket.Wait(ctx, 1); err != nil {
+				return status, fmt.Errorf("rate limit: %w", err)
+			}
+		}
+
+		newID, changed, err := imageSvc.reprocessImage(ctx, chain, meta)
+
+		switch {
+		case ctx.Err() != nil:
+			return status, fmt.Errorf("reprocess: %w", ctx.Err())
+		case err != nil:
+			// A single broken image must not stop the backfill of all others
+			log.WarnContext(ctx, "reprocess image failed", "id", meta.ID, "error", err)
+
+			status.Failed++
+		case changed:
+			status.Changed++
+
+			if newID != meta.ID {
+				status.Replaced[meta.ID.String()] = newID.String()
+			}
+		}
+
+		status.Processed++
+
+		if progress != nil {
+			progress(status)
+		}
+	}
+
+	return status, nil
+}
+
+// reprocessImage runs the processor chain on the image as its owner. Images whose content
+// changes are stored under a new ID, moving their EXIF metadata, and the original is deleted.
+// Returns the ID of the reprocessed image and whether it changed.
+func (imageSvc BlobImageService) reprocessImage(
+	ctx context.Context,
+	chain *ProcessorChain,
+	meta domain.MediaMeta,
+) (domain.MediaID, bool, error) {
+	ctx = context_.WithUsername(ctx, meta.Owner)
+
+	image, err := imageSvc.mediaSvc.Fetch(ctx, meta.ID)
+	if err != nil {
+		return meta.ID, false, fmt.Errorf("fetch: %w", err)
+	}
+
+	processed, err := chain.Process(ctx, image)
+	if err != nil {
+		return meta.ID, false, fmt.Errorf("process: %w", err)
+	}
+
+	if processed.ID() == meta.ID {
+		if processed.Meta().Revision() == image.Meta().Revision() {
+			return meta.ID, false, nil
+		}
+
+		if err := imageSvc.mediaSvc.UpdateMeta(ctx, processed.Meta()); err != nil {
+			return meta.ID, false, fmt.Errorf("update meta: %w", err)
+		}
+
+		return meta.ID, true, nil
+	}
+
+	// The ID is derived from the content, so changed content is stored as new media
+	if err := imageSvc.mediaSvc.Store(ctx, processed); err != nil {
+		return meta.ID, false, fmt.Errorf("store: %w", err)
+	}
+
+	if err := imageSvc.copyExif(ctx, meta.ID, processed.ID()); err != nil {
+		return meta.ID, false, fmt.Errorf("copy exif: %w", err)
+	}
+
+	if err := imageSvc.Delete(ctx, meta.ID); err != nil {
+		return meta.ID, false, fmt.Errorf("delete original: %w", err)
+	}
+
+	return processed.ID(), true, nil
+}
+
+// cloneReprocessStatus returns a copy of the status that does not share its replaced IDs.
+func cloneReprocessStatus(status domain.MediaReprocessStatus) domain.MediaReprocessStatus {
+	status.Replaced = maps.Clone(status.Replaced)
+
+	return status
+}
@@ -0,0 +1,157 @@
+package imagesvc_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestBlobImageService_Reprocess(t *testing.T) {
+	t.Parallel()
+
+	data := encodeTestImage(t, imagesvc.MIMETypeJPEG, 16, 16, true)
+	withExif := slices.Concat(data[:2], buildTestExif(), data[2:])
+
+	tests := []struct {
+		name         string
+		processors   []string
+		owner        string
+		noAdmin      bool
+		wantErr      error
+		wantTotal    int
+		wantChanged  int
+		wantReplaced bool
+		wantCategory string
+	}{
+		{
+			name:         "content changed",
+			processors:   []string{"exif_strip"},
+			wantTotal:    2,
+			wantChanged:  1,
+			wantReplaced: true,
+		},
+		{
+			name:         "metadata changed",
+			processors:   []string{"classify"},
+			owner:        "alice",
+			wantTotal:    1,
+			wantChanged:  1,
+			wantCategory: imagesvc.CategoryIcon,
+		},
+		{name: "unknown processor", processors: []string{"sharpen"}, wantErr: imagesvc.ErrInvalidProcessorChain},
+		{name: "no processors", wantErr: imagesvc.ErrInvalidProcessorChain},
+		{name: "no admin access", processors: []string{"classify"}, noAdmin: true, wantErr: domain.ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+			mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+			if err != nil {
+				t.Fatalf("new media service: %v", err)
+			}
+
+			cfg := testConfig("")
+			cfg.ExifExtract = true
+
+			imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			aliceCtx := context_.WithUsername(context.Background(), "alice")
+
+			// Only alice's image carries EXIF metadata, which exif_strip removes
+			stored, err := imageSvc.Store(aliceCtx, domain.NewMedia(withExif, domain.MediaMeta{
+				Filename: "photo.jpg", Owner: "alice", MIMEType: imagesvc.MIMETypeJPEG,
+			}))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			bobCtx := context_.WithUsername(context.Background(), "bob")
+			if _, err := imageSvc.Store(bobCtx, domain.NewMedia(data, domain.MediaMeta{
+				Filename: "photo.jpg", Owner: "bob", MIMEType: imagesvc.MIMETypeJPEG,
+			})); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			ctx := context_.WithAdminAccess(context.Background())
+			if tt.noAdmin {
+				ctx = aliceCtx
+			}
+
+			var progress []int
+
+			status, err := imageSvc.Reprocess(ctx, domain.MediaReprocessRequest{
+				Processors: tt.processors,
+				Owner:      tt.owner,
+				Rate:       0,
+			}, func(status domain.MediaReprocessStatus) {
+				progress = append(progress, status.Processed)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reprocess() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if status.Running || status.Finished == 0 || (err != nil) != (status.Error != "") {
+				t.Errorf("Reprocess() status = %+v, want finished", status)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if status.Total != tt.wantTotal || status.Processed != tt.wantTotal ||
+				status.Changed != tt.wantChanged || status.Failed != 0 {
+				t.Errorf("Reprocess() status = %+v, want %d processed, %d changed", status, tt.wantTotal, tt.wantChanged)
+			}
+
+			if len(progress) != tt.wantTotal || progress[len(progress)-1] != tt.wantTotal {
+				t.Errorf("progress = %v, want %d reports", progress, tt.wantTotal)
+			}
+
+			newID, replaced := status.Replaced[stored.ID().String()]
+			if replaced != tt.wantReplaced {
+				t.Fatalf("Reprocess() replaced = %v, want replacement %v", status.Replaced, tt.wantReplaced)
+			}
+
+			id := stored.ID()
+			if replaced {
+				id = domain.MediaID(newID)
+
+				if imageSvc.Exists(ctx, stored.ID()) {
+					t.Errorf("original %q still exists", stored.ID())
+				}
+
+				// The EXIF metadata extracted on upload is kept
+				if exif, err := imageSvc.Exif(aliceCtx, id); err != nil || exif.Make != "Canon" {
+					t.Errorf("Exif() of replacement = %+v, %v, want extracted metadata", exif, err)
+				}
+			}
+
+			image, err := imageSvc.Fetch(aliceCtx, id, 0)
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			if image.Meta().Category != tt.wantCategory {
+				t.Errorf("Category = %q, want %q", image.Meta().Category, tt.wantCategory)
+			}
+
+			if replaced && slices.Equal(image.Bytes(), withExif) {
+				t.Error("replacement still carries EXIF metadata")
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/jpeg"
 	"io"
 	"strings"
 
@@ -40,46 +41,26 @@ func getInterpolatorByName(name string) (draw.Interpolator, error) {
 	return interpol, nil
 }
 
-// resizeImage resizes an image to the specified width while maintaining aspect ratio.
-// It supports JPEG, PNG and TIFF formats.
-// The interpolator parameter specifies the scaling algorithm to use.
-// Returns ErrUnknownInterpolator if the interpolator is not supported.
-// Returns ErrUnsupportedContentType if the image format is not supported.
-func resizeImage(data []byte, ctype string, width int, interpolator string) (resized []byte, err error) {
-	// Decode image
-	original, err := decodeImage(bytes.NewReader(data), ctype)
-	if err != nil {
-		return []byte{}, fmt.Errorf("decode image: %w", err)
-	}
-
-	// Resize image
-	ratio := float64(width) / float64(original.Bounds().Dx())
-	height := int(float64(original.Bounds().Dy()) * ratio)
-
-	bitmap := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	interpol, err := getInterpolatorByName(interpolator)
-	if err != nil {
-		return []byte{}, fmt.Errorf("get interpolator: %w", err)
-	}
-
-	interpol.Scale(bitmap, bitmap.Bounds(), original, original.Bounds(), draw.Over, nil)
-
-	// Encode image
-	resized, err = encodeImage(bitmap, ctype)
+// decodeImage decodes a binary image into a Go image.Image object.
+// Returns ErrUnsupportedMIMEType wrapping domain.ErrImageTypeNotSupported if the content type
+// cannot be decoded.
+func decodeImage(reader io.Reader, ctype string) (image image.Image, err error) {
+	decoder, err := getDecoderByType(ctype)
 	if err != nil {
-		return []byte{}, fmt.Errorf("encode image: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedMIMEType, err)
 	}
 
-	return resized, nil
+	return decoder(reader)
 }
 
-// decodeImage decodes a binary image into a Go image.Image object.
-// Returns ErrUnsupportedContentType if the content type is not supported.
-func decodeImage(reader io.Reader, ctype string) (image image.Image, err error) {
-	decoder, err := getDecoderByType(ctype)
+// decodeImageConfig decodes the color model and dimensions of a binary image
+// without decoding the entire image.
+// Returns ErrUnsupportedMIMEType wrapping domain.ErrImageTypeNotSupported if the content type
+// cannot be decoded.
+func decodeImageConfig(reader io.Reader, ctype string) (image.Config, error) {
+	decoder, err := getConfigDecoderByType(ctype)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMIMEType, ctype)
+		return image.Config{}, fmt.Errorf("%w: %w", ErrUnsupportedMIMEType, err)
 	}
 
 	return decoder(reader)
@@ -88,11 +69,45 @@ func decodeImage(reader io.Reader, ctype string) (image image.Image, err error)
 // encodeImage encodes a Go image.Image object into binary format.
 // Returns ErrUnsupportedContentType if the content type is not supported.
 func encodeImage(bitmap image.Image, ctype string) ([]byte, error) {
+	return encodeImageQuality(bitmap, ctype, 0)
+}
+
+// encodeOptions selects optional encodings of transformed images.
+type encodeOptions struct {
+	progressiveJPEG bool // Encode JPEG images progressively
+	interlacedPNG   bool // Encode PNG images with Adam7 interlacing
+}
+
+// encodeImageQuality encodes a Go image.Image object into binary format using the
+// given quality for lossy formats. A quality of 0 uses the encoder default.
+// Returns ErrUnsupportedContentType if the content type is not supported.
+func encodeImageQuality(bitmap image.Image, ctype string, quality int) ([]byte, error) {
+	return encodeImageOptions(bitmap, ctype, quality, encodeOptions{progressiveJPEG: false, interlacedPNG: false})
+}
+
+// encodeImageOptions encodes a Go image.Image object like encodeImageQuality, using the
+// optional encodings selected by opts.
+func encodeImageOptions(bitmap image.Image, ctype string, quality int, opts encodeOptions) ([]byte, error) {
 	var (
 		buffer []byte
 		writer = bytes.NewBuffer(buffer)
 	)
 
+	switch {
+	case ctype == MIMETypeJPEG && opts.progressiveJPEG:
+		err := encodeProgressiveJPEG(writer, bitmap, quality)
+
+		return writer.Bytes(), err
+	case ctype == MIMETypePNG && opts.interlacedPNG:
+		err := encodeInterlacedPNG(writer, bitmap)
+
+		return writer.Bytes(), err
+	case ctype == MIMETypeJPEG && quality != 0:
+		err := jpeg.Encode(writer, bitmap, &jpeg.Options{Quality: quality})
+
+		return writer.Bytes(), err
+	}
+
 	encoder, err := getEncoderByType(ctype)
 	if err != nil {
 		return nil, fmt.Errorf("get encoder: %w", err)
@@ -2,8 +2,11 @@ package imagesvc
 
 import (
 	"context"
+	"image"
+	"io"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
 )
 
 // ImageService defines the interface for managing image objects.
@@ -13,8 +16,15 @@ type ImageService interface {
 	Lock(ctx context.Context, imageID domain.MediaID) (func(), error)
 
 	// Store persists the given image.
-	// Returns an error if the operation fails or if the image format is not supported.
-	Store(ctx context.Context, image domain.Media) error
+	// Returns the stored image, which may differ from the given image if it was optimized,
+	// or an error if the operation fails or if the image format is not supported.
+	Store(ctx context.Context, image domain.Media) (domain.Media, error)
+
+	// StoreFrom persists the image read from content, like Store, without holding it in memory
+	// where possible. The metadata carries the filename and owner of the image, and the content
+	// hash and size computed by a domain.ContentHasher while the image was staged.
+	// Returns the metadata of the stored image.
+	StoreFrom(ctx context.Context, meta domain.MediaMeta, content io.ReadSeeker) (domain.MediaMeta, error)
 
 	// Delete removes the image with the specified ID.
 	// Returns an error if the image was not found or if the operation fails.
@@ -25,10 +35,128 @@ type ImageService interface {
 	// Returns the image object if found, or an error if not found or if the operation fails.
 	Fetch(ctx context.Context, imageID domain.MediaID, width int) (domain.Media, error)
 
+	// FetchMeta retrieves the metadata of the image with the specified ID, with the same access
+	// checks as Fetch, without reading the image itself.
+	FetchMeta(ctx context.Context, imageID domain.MediaID) (domain.MediaMeta, error)
+
+	// SetVisibility sets the visibility of the image with the specified ID (see MediaService.SetVisibility).
+	SetVisibility(ctx context.Context, imageID domain.MediaID, visibility domain.MediaVisibility) (domain.MediaMeta, error)
+
+	// Share grants the user access to the image with the specified ID (see MediaService.Share).
+	Share(ctx context.Context, imageID domain.MediaID, username string) (domain.MediaMeta, error)
+
+	// Unshare revokes the access granted to the user by Share (see MediaService.Unshare).
+	Unshare(ctx context.Context, imageID domain.MediaID, username string) (domain.MediaMeta, error)
+
+	// Transform retrieves the image with the specified ID and applies the given transform spec.
+	// Returns the transformed image, or an error if not found or if the operation fails.
+	Transform(ctx context.Context, imageID domain.MediaID, spec transform.Spec) (domain.Media, error)
+
+	// TransformMeta returns the metadata of the image Transform returns for the given spec, including
+	// its MIME type, size and content hash. Unlike Transform, it does not read the stored image if
+	// the spec is the identity transformation and the original is served as stored.
+	TransformMeta(ctx context.Context, imageID domain.MediaID, spec transform.Spec) (domain.MediaMeta, error)
+
+	// Variants returns the dimensions of the image with the specified ID, oriented upright, and of
+	// its derivatives resized to the given widths, without generating them. Widths exceeding the
+	// image are lowered to its width, widths that are not allowed are left out.
+	Variants(ctx context.Context, imageID domain.MediaID, widths []int) (domain.MediaVariantSet, error)
+
+	// Prewarm queues the generation of the derivatives of the image with the specified ID resized
+	// to the given widths, so their first downloads are served from the cache. The derivatives are
+	// generated in the background like thumbnails, on behalf of the owner, and dropped if the queue
+	// is full. Callers must make sure the user of the context may access the image.
+	Prewarm(ctx context.Context, imageID domain.MediaID, widths []int)
+
+	// Exif returns the EXIF metadata extracted from the image with the specified ID on upload.
+	// GPS positions are only included for the owner. Returns an error wrapping os.ErrNotExist
+	// if no metadata was extracted, or the error of fetching the image otherwise.
+	Exif(ctx context.Context, imageID domain.MediaID) (domain.MediaExif, error)
+
+	// Exists reports whether an image with the specified ID is stored.
+	Exists(ctx context.Context, imageID domain.MediaID) bool
+
+	// FindByHash returns the metadata of the images of the user in the context with the
+	// specified content hash, or whose content had that hash before it was processed on ingest.
+	FindByHash(ctx context.Context, hash string) ([]domain.MediaMeta, error)
+
+	// List returns the metadata of all images of the user in the context.
+	List(ctx context.Context) ([]domain.MediaMeta, error)
+
+	// ListChanges returns the images of the user in the context stored or updated after the change
+	// numbered since, and the images deleted after it (see mediasvc.MediaService.ListChanges).
+	ListChanges(ctx context.Context, since int64) (domain.MediaChanges, error)
+
+	// ListPage returns the metadata of at most limit images of the user in the context after the
+	// given position, ordered by storage time and ID.
+	ListPage(ctx context.Context, after domain.MediaPosition, limit int) ([]domain.MediaMeta, error)
+
+	// ListLocated returns the metadata of all images of the user in the context with a known location.
+	ListLocated(ctx context.Context) ([]domain.MediaMeta, error)
+
+	// Reprocess runs the requested processors on the stored images of all users, or of the
+	// requested owner, e.g. to backfill processors added after the images were uploaded.
+	// Images whose content changes get a new ID. Failures of single images are counted, not returned.
+	// Requires admin access (see context.WithAdminAccess). Returns ErrInvalidProcessorChain if
+	// the processors are invalid. The progress is reported after each image, if progress is not nil.
+	Reprocess(
+		ctx context.Context,
+		req domain.MediaReprocessRequest,
+		progress ReprocessProgressFunc,
+	) (domain.MediaReprocessStatus, error)
+
+	// CreateUpload creates a resumable upload session of the user in the context for a file of
+	// the given name and total size in bytes. Returns ErrInvalidUploadSize if the size is not
+	// positive, or the error of CheckUploadConstraints if the file is not allowed.
+	CreateUpload(ctx context.Context, filename string, size int64) (domain.MediaUpload, error)
+
+	// FetchUpload returns the upload session with the specified ID. Returns ErrUploadNotFound if
+	// it does not exist, has expired or belongs to another user.
+	FetchUpload(ctx context.Context, uploadID string) (domain.MediaUpload, error)
+
+	// AppendUpload appends the chunk to the upload session with the specified ID at the given
+	// offset and extends the expiry of the session. Returns ErrUploadOffsetMismatch if the offset
+	// is not the offset of the session, or domain.ErrMediaTooLarge if the chunk exceeds the size.
+	AppendUpload(ctx context.Context, uploadID string, offset int64, chunk io.Reader) (domain.MediaUpload, error)
+
+	// AssembleUpload returns the metadata and the content of the image received by the upload
+	// session with the specified ID, to be stored by StoreFrom. The content is read from the
+	// received chunks while the session is locked, until the caller closes it. Returns
+	// ErrUploadIncomplete if bytes are missing. The session is kept until it is removed by DeleteUpload.
+	AssembleUpload(ctx context.Context, uploadID string) (domain.MediaMeta, io.ReadSeekCloser, error)
+
+	// DeleteUpload removes the upload session with the specified ID and its received chunks.
+	DeleteUpload(ctx context.Context, uploadID string) error
+
 	// MaxSize returns the maximum allowed file size in bytes.
 	MaxSize() int64
 
+	// UploadConstraints returns the limits checked by CheckUploadConstraints and AppendUpload.
+	UploadConstraints() domain.MediaUploadConstraints
+
+	// CacheStats returns the hits and misses of the cache of resized images since the process started.
+	CacheStats() domain.CacheStats
+
+	// RecordDownload adds a download of size bytes to the usage of the user in the current period.
+	RecordDownload(ctx context.Context, username string, size int64) error
+
+	// Usage returns the download usage of the user in the current period.
+	Usage(ctx context.Context, username string) (domain.MediaUsage, error)
+
+	// CheckDownloadCap returns domain.ErrDownloadCapExceeded if the user has exhausted
+	// the download cap of the current period.
+	CheckDownloadCap(ctx context.Context, username string) error
+
+	// DownloadCap returns the maximum number of bytes a user may download per period, or 0 if unlimited.
+	DownloadCap() int64
+
 	// CheckUploadConstraints checks if the given file meets the upload constraints.
+	// If the image content is given, its type is checked against the filename, and its dimensions
+	// against the configured limits.
 	// Returns true if the file is allowed to be uploaded, or an error if the constraints are not met.
 	CheckUploadConstraints(filename string, size int64, image []byte) (string, bool, error)
+
+	// ValidateUpload runs all upload checks on the given image without storing it.
+	// Returns the image dimensions, or an error if the image would be rejected.
+	ValidateUpload(ctx context.Context, image domain.Media) (image.Config, error)
 }
@@ -0,0 +1,106 @@
+package imagesvc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+)
+
+// ErrInvalidThumbnailWidths is returned when the configured thumbnail widths cannot be parsed.
+var ErrInvalidThumbnailWidths = errors.New("invalid thumbnail widths")
+
+// parseThumbnailWidths parses ImageConfig.ThumbnailWidths. No widths disable eager thumbnails.
+func parseThumbnailWidths(cfg ImageConfig) ([]int, error) {
+	return parseConfigWidths(cfg.ThumbnailWidths, ErrInvalidThumbnailWidths)
+}
+
+// thumbnailJob is a queued generation of the derivatives of an image resized to the given widths.
+type thumbnailJob struct {
+	imageID domain.MediaID
+	widths  []int
+}
+
+// enqueueThumbnails queues the generation of the thumbnails of a stored image.
+// If the queue is full, the thumbnails are generated on their first download instead.
+func (imageSvc BlobImageService) enqueueThumbnails(ctx context.Context, imageID domain.MediaID) {
+	if len(imageSvc.thumbnailWidths) == 0 {
+		return
+	}
+
+	imageSvc.enqueueThumbnailJob(ctx, thumbnailJob{imageID: imageID, widths: imageSvc.thumbnailWidths})
+}
+
+// Prewarm implements ImageService.Prewarm by queueing the derivatives like thumbnails.
+func (imageSvc BlobImageService) Prewarm(ctx context.Context, imageID domain.MediaID, widths []int) {
+	if len(widths) == 0 {
+		return
+	}
+
+	imageSvc.enqueueThumbnailJob(ctx, thumbnailJob{imageID: imageID, widths: widths})
+}
+
+// enqueueThumbnailJob queues a thumbnail job, dropping it if the queue is full.
+func (imageSvc BlobImageService) enqueueThumbnailJob(ctx context.Context, job thumbnailJob) {
+	select {
+	case imageSvc.thumbnailQueue <- job:
+	default:
+		imageSvc.metrics.thumbnails.With("dropped").Add(float64(len(job.widths)))
+		imageSvc.log.WarnContext(ctx, "thumbnail queue full", logging.Group("image", "id", job.imageID))
+	}
+}
+
+// RunThumbnailWorkers generates the queued thumbnails and prewarmed derivatives of images until
+// the context is cancelled, so their first downloads are served from the cache.
+// The number of workers is configured by ImageConfig.ThumbnailWorkers.
+func (imageSvc BlobImageService) RunThumbnailWorkers(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range max(imageSvc.cfg.ThumbnailWorkers, 1) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-imageSvc.thumbnailQueue:
+					imageSvc.generateThumbnails(ctx, job)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// generateThumbnails resizes the image of a job to its widths. Images of types that cannot be
+// decoded, like HEIC, have no thumbnails.
+func (imageSvc BlobImageService) generateThumbnails(ctx context.Context, job thumbnailJob) {
+	log := imageSvc.log.With(logging.Group("image", "id", job.imageID, "widths", job.widths))
+
+	// Thumbnails are generated on behalf of the owner, who is not part of the context
+	ctx = context_.WithGrant(ctx, string(job.imageID))
+
+	for _, width := range job.widths {
+		if _, err := imageSvc.Fetch(ctx, job.imageID, width); errors.Is(err, domain.ErrImageTypeNotSupported) {
+			log.DebugContext(ctx, "thumbnails not supported", "error", err)
+
+			return
+		} else if err != nil {
+			imageSvc.metrics.thumbnails.With("failed").Inc()
+			log.WarnContext(ctx, "thumbnail generation failed", "width", width, "error", err)
+
+			continue
+		}
+
+		imageSvc.metrics.thumbnails.With("generated").Inc()
+	}
+
+	log.DebugContext(ctx, "thumbnails generated")
+}
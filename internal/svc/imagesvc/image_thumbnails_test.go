@@ -0,0 +1,91 @@
+package imagesvc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+func TestBlobImageService_Thumbnails(t *testing.T) {
+	t.Parallel()
+
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()})
+
+	mediaSvc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("new media service: %v", err)
+	}
+
+	cacheRepo, err := factory(context.Background(), "cache", "bin")
+	if err != nil {
+		t.Fatalf("new cache repository: %v", err)
+	}
+
+	cfg := testConfig("")
+	cfg.ThumbnailWidths = "16, 8,16"
+	cfg.ThumbnailWorkers = 2
+	cfg.ThumbnailQueueSize = 10
+
+	imageSvc, err := imagesvc.NewBlobImageService(context.Background(), factory, mediaSvc, nil, cfg)
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		imageSvc.RunThumbnailWorkers(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	data := encodeTestImage(t, imagesvc.MIMETypePNG, 32, 24, true)
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Prewarmed derivatives are generated by the same workers
+	imageSvc.Prewarm(ctx, stored.ID(), []int{4})
+
+	for _, width := range []string{"8", "16", "4"} {
+		cacheID := domain.BlobID(stored.Hash() + "_" + width)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !cacheRepo.Exists(ctx, cacheID) {
+			if time.Now().After(deadline) {
+				t.Fatalf("thumbnail %q not generated", cacheID)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestNewBlobImageService_InvalidThumbnailWidths(t *testing.T) {
+	t.Parallel()
+
+	for _, widths := range []string{"200,abc", "0", "100000"} {
+		cfg := testConfig("")
+		cfg.ThumbnailWidths = widths
+
+		if _, err := newTestImageService(t, cfg); !errors.Is(err, imagesvc.ErrInvalidThumbnailWidths) {
+			t.Errorf("NewBlobImageService(%q) error = %v, want %v", widths, err, imagesvc.ErrInvalidThumbnailWidths)
+		}
+	}
+}
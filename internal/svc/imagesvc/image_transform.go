@@ -0,0 +1,209 @@
+package imagesvc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+	xdraw "golang.org/x/image/draw"
+)
+
+// transformImage applies the given transform spec to an image.
+// The image is oriented upright according to its EXIF orientation, rotated, mirrored and then
+// cropped, so the crop region refers to the upright, rotated and mirrored image, and the width
+// and height to the cropped image.
+// It supports JPEG, PNG and TIFF formats.
+// The interpolator parameter specifies the scaling algorithm to use, opts the optional encodings.
+// Returns the transformed image and its MIME type.
+// Returns ErrUnknownInterpolator if the interpolator is not supported.
+// Returns ErrUnsupportedContentType if the image format is not supported.
+// Returns domain.ErrCropOutOfBounds if the crop region lies outside of the image.
+func transformImage(
+	data []byte,
+	ctype string,
+	spec transform.Spec,
+	interpolator string,
+	opts encodeOptions,
+) (transformed []byte, outType string, err error) {
+	interpol, err := getInterpolatorByName(interpolator)
+	if err != nil {
+		return nil, "", fmt.Errorf("get interpolator: %w", err)
+	}
+
+	outType, err = transformOutputType(ctype, spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Decode image
+	bitmap, err := decodeImage(bytes.NewReader(data), ctype)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+
+	// Orient image upright as recorded by the camera, before rotating it as requested
+	bitmap = orientImage(bitmap, imageOrientation(data, ctype))
+
+	// Rotate image
+	if spec.Rotate != 0 {
+		bitmap = rotateImage(bitmap, spec.Rotate)
+	}
+
+	// Flip image
+	if spec.Flip != "" {
+		bitmap = flipImage(bitmap, spec.Flip)
+	}
+
+	// Crop image
+	if spec.CropWidth != 0 && spec.CropHeight != 0 {
+		bitmap, err = cropImage(bitmap, spec)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Resize image
+	if spec.Width != 0 || spec.Height != 0 {
+		srcRect, dstWidth, dstHeight := transformGeometry(bitmap.Bounds(), spec)
+
+		scaled := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+		interpol.Scale(scaled, scaled.Bounds(), bitmap, srcRect, xdraw.Over, nil)
+
+		bitmap = scaled
+	}
+
+	// Encode image
+	transformed, err = encodeImageOptions(bitmap, outType, spec.Quality, opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("encode image: %w", err)
+	}
+
+	return transformed, outType, nil
+}
+
+// transformOutputType returns the MIME type of an image of type ctype transformed by spec.
+func transformOutputType(ctype string, spec transform.Spec) (string, error) {
+	if spec.Format == "" {
+		return ctype, nil
+	}
+
+	outType, ok := imageFormatTypes[spec.Format]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedMIMEType, spec.Format)
+	}
+
+	return outType, nil
+}
+
+// transformGeometry computes the source rectangle and the target dimensions
+// of scaling an image with the given bounds according to spec.
+func transformGeometry(bounds image.Rectangle, spec transform.Spec) (image.Rectangle, int, int) {
+	srcWidth, srcHeight := float64(bounds.Dx()), float64(bounds.Dy())
+	width, height := spec.Width, spec.Height
+
+	switch {
+	case height == 0:
+		height = int(srcHeight * float64(width) / srcWidth)
+	case width == 0:
+		width = int(srcWidth * float64(height) / srcHeight)
+	case spec.Fit == transform.FitFill:
+		// stretch to the target dimensions
+	case spec.Fit == transform.FitCover:
+		// crop the source to the target aspect ratio, centered
+		ratio := float64(width) / float64(height)
+		cropWidth, cropHeight := srcWidth, srcHeight
+
+		if srcWidth/srcHeight > ratio {
+			cropWidth = math.Round(srcHeight * ratio)
+		} else {
+			cropHeight = math.Round(srcWidth / ratio)
+		}
+
+		x0 := bounds.Min.X + int(srcWidth-cropWidth)/2
+		y0 := bounds.Min.Y + int(srcHeight-cropHeight)/2
+		bounds = image.Rect(x0, y0, x0+int(cropWidth), y0+int(cropHeight))
+	default:
+		// contain within the target dimensions
+		scale := math.Min(float64(width)/srcWidth, float64(height)/srcHeight)
+		width = int(math.Round(srcWidth * scale))
+		height = int(math.Round(srcHeight * scale))
+	}
+
+	return bounds, max(width, 1), max(height, 1)
+}
+
+// cropRect computes the crop region of spec within the given bounds. A region placed by
+// gravity is shrunk to fit the image, a region at an offset is clipped to the image.
+// Returns domain.ErrCropOutOfBounds if the region does not overlap the image.
+func cropRect(bounds image.Rectangle, spec transform.Spec) (image.Rectangle, error) {
+	width, height := spec.CropWidth, spec.CropHeight
+	x, y := spec.CropX, spec.CropY
+
+	if spec.Gravity != "" {
+		width, height = min(width, bounds.Dx()), min(height, bounds.Dy())
+		spareX, spareY := bounds.Dx()-width, bounds.Dy()-height
+
+		switch spec.Gravity {
+		case transform.GravityNorth, transform.GravitySouth, transform.GravityCenter:
+			x = spareX / 2 //nolint:mnd // centered
+		case transform.GravityNorthEast, transform.GravityEast, transform.GravitySouthEast:
+			x = spareX
+		default:
+			x = 0
+		}
+
+		switch spec.Gravity {
+		case transform.GravityWest, transform.GravityEast, transform.GravityCenter:
+			y = spareY / 2 //nolint:mnd // centered
+		case transform.GravitySouthWest, transform.GravitySouth, transform.GravitySouthEast:
+			y = spareY
+		default:
+			y = 0
+		}
+	}
+
+	region := image.Rect(x, y, x+width, y+height).Add(bounds.Min)
+	if !region.Overlaps(bounds) {
+		return image.Rectangle{}, fmt.Errorf("%w: %v not within %v", domain.ErrCropOutOfBounds, region, bounds)
+	}
+
+	return region.Intersect(bounds), nil
+}
+
+// cropImage copies the crop region of spec out of an image.
+func cropImage(src image.Image, spec transform.Spec) (image.Image, error) {
+	rect, err := cropRect(src.Bounds(), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, rect.Min, draw.Src)
+
+	return dst, nil
+}
+
+// rotateImage rotates an image clockwise by the given degrees (90, 180 or 270).
+func rotateImage(src image.Image, degrees int) image.Image {
+	switch degrees {
+	case 90:
+		return orientImage(src, orientationRotate90)
+	case 180:
+		return orientImage(src, orientationRotate180)
+	default:
+		return orientImage(src, orientationRotate270)
+	}
+}
+
+// flipImage mirrors an image horizontally or vertically.
+func flipImage(src image.Image, flip transform.Flip) image.Image {
+	if flip == transform.FlipVertical {
+		return orientImage(src, orientationFlipV)
+	}
+
+	return orientImage(src, orientationFlipH)
+}
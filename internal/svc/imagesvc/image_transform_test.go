@@ -0,0 +1,91 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+func TestBlobImageService_TransformCrop(t *testing.T) {
+	t.Parallel()
+
+	imageSvc, err := newTestImageService(t, testConfig(""))
+	if err != nil {
+		t.Fatalf("new image service: %v", err)
+	}
+
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	// Pixels of the photo encode their position as red and green values
+	data := encodeTestImage(t, imagesvc.MIMETypePNG, 64, 48, true)
+
+	stored, err := imageSvc.Store(ctx, domain.NewMedia(data, domain.MediaMeta{
+		Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+	}))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		spec       string
+		wantBounds image.Rectangle
+		wantOrigin [2]uint32 // Red and green value of the top left pixel
+		wantErr    error
+	}{
+		{name: "offset", spec: "cx:10,cy:5,cw:20,ch:10", wantBounds: image.Rect(0, 0, 20, 10), wantOrigin: [2]uint32{10, 5}},
+		{name: "clipped", spec: "cx:50,cy:40,cw:20,ch:20", wantBounds: image.Rect(0, 0, 14, 8), wantOrigin: [2]uint32{50, 40}},
+		{name: "gravity", spec: "cw:100,ch:10,g:southeast", wantBounds: image.Rect(0, 0, 64, 10), wantOrigin: [2]uint32{0, 38}},
+		{name: "centered", spec: "cw:20,ch:20,g:center", wantBounds: image.Rect(0, 0, 20, 20), wantOrigin: [2]uint32{22, 14}},
+		{name: "resized", spec: "cw:20,ch:10,w:10", wantBounds: image.Rect(0, 0, 10, 5)},
+		{name: "flipped", spec: "flip:h,cw:10,ch:10", wantBounds: image.Rect(0, 0, 10, 10), wantOrigin: [2]uint32{63, 0}},
+		{name: "flipped vertically", spec: "flip:v,cw:10,ch:10", wantBounds: image.Rect(0, 0, 10, 10), wantOrigin: [2]uint32{0, 47}},
+		{name: "rotated and flipped", spec: "rot:90,flip:v,cw:10,ch:60", wantBounds: image.Rect(0, 0, 10, 60), wantOrigin: [2]uint32{63, 47}},
+		{name: "out of bounds", spec: "cx:64,cw:20,ch:10", wantErr: domain.ErrCropOutOfBounds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec, err := transform.Parse(tt.spec, imagesvc.TransformFormats())
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			cropped, err := imageSvc.Transform(ctx, stored.ID(), spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transform() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			bitmap, err := png.Decode(bytes.NewReader(cropped.Bytes()))
+			if err != nil {
+				t.Fatalf("decode transformed image: %v", err)
+			}
+
+			if bitmap.Bounds() != tt.wantBounds {
+				t.Errorf("transformed bounds = %v, want %v", bitmap.Bounds(), tt.wantBounds)
+			}
+
+			if tt.wantOrigin == [2]uint32{} {
+				return // Resized pixels are interpolated
+			}
+
+			if red, green, _, _ := bitmap.At(0, 0).RGBA(); [2]uint32{red >> 8, green >> 8} != tt.wantOrigin {
+				t.Errorf("top left pixel = %d, %d, want %v", red>>8, green>>8, tt.wantOrigin)
+			}
+		})
+	}
+}
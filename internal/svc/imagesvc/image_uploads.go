@@ -0,0 +1,523 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+var (
+	// ErrUploadNotFound is returned when an upload session does not exist, has expired,
+	// or belongs to another user.
+	ErrUploadNotFound = domain.NewError("upload.not_found", "upload not found", http.StatusNotFound, false)
+	// ErrInvalidUploadSize is returned when an upload session is created without a positive size.
+	ErrInvalidUploadSize = domain.NewError("upload.invalid_size", "invalid upload size", http.StatusBadRequest, false)
+	// ErrUploadOffsetMismatch is returned when a chunk is not appended at the offset of the upload
+	// session, e.g. because a previous chunk was lost. The client resumes at the current offset.
+	ErrUploadOffsetMismatch = domain.NewError(
+		"upload.offset_mismatch", "upload offset mismatch", http.StatusConflict, false)
+	// ErrUploadIncomplete is returned when an upload session is completed before all bytes were received.
+	ErrUploadIncomplete = domain.NewError("upload.incomplete", "upload incomplete", http.StatusConflict, false)
+	// ErrUploadChunkTooLarge is returned when a chunk exceeds ImageConfig.UploadChunkMaxSize.
+	ErrUploadChunkTooLarge = domain.NewError(
+		"upload.chunk_too_large", "upload chunk too large", http.StatusRequestEntityTooLarge, false)
+)
+
+// errUploadSeek is returned when an assembled upload is seeked elsewhere than to its start.
+var errUploadSeek = errors.New("upload can only be seeked to its start")
+
+// uploadIDSize is the number of random bytes of upload session IDs.
+const uploadIDSize = 16
+
+// UploadExpiryResult summarizes a removal of stale upload sessions.
+type UploadExpiryResult struct {
+	Expired  int // Number of expired upload sessions removed
+	Orphaned int // Number of chunks without upload session removed
+}
+
+// CreateUpload implements ImageService.CreateUpload.
+func (imageSvc BlobImageService) CreateUpload(
+	ctx context.Context,
+	filename string,
+	size int64,
+) (domain.MediaUpload, error) {
+	if filename == "" {
+		return domain.MediaUpload{}, ErrNoFilename
+	}
+
+	if size <= 0 {
+		return domain.MediaUpload{}, fmt.Errorf("%w: %d", ErrInvalidUploadSize, size)
+	}
+
+	if _, _, err := imageSvc.CheckUploadConstraints(filename, size, nil); err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("check upload constraints: %w", err)
+	}
+
+	id := make([]byte, uploadIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("read random id: %w", err)
+	}
+
+	owner, _ := context_.UsernameFromContext(ctx)
+	upload := domain.MediaUpload{
+		ID:       encoding.EncodeCrockfordB32LC(id),
+		Owner:    owner,
+		Filename: filename,
+		Size:     size,
+		Offset:   0,
+		Chunks:   0,
+		Expires:  imageSvc.uploadExpiry(),
+	}
+
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(upload.ID), true)
+	if err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("lock upload: %w", err)
+	}
+	defer unlock()
+
+	if err := imageSvc.storeUpload(ctx, upload); err != nil {
+		return domain.MediaUpload{}, err
+	}
+
+	imageSvc.log.DebugContext(ctx, "upload created",
+		logging.Group("upload", "id", upload.ID, "filename", filename, "size", size, "owner", owner))
+
+	return upload, nil
+}
+
+// FetchUpload implements ImageService.FetchUpload.
+func (imageSvc BlobImageService) FetchUpload(ctx context.Context, uploadID string) (domain.MediaUpload, error) {
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(uploadID), false)
+	if err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("lock upload: %w", err)
+	}
+	defer unlock()
+
+	return imageSvc.fetchUpload(ctx, uploadID)
+}
+
+// AppendUpload implements ImageService.AppendUpload.
+// Each chunk is stored as a blob of its own, so appending does not rewrite the received content.
+func (imageSvc BlobImageService) AppendUpload(
+	ctx context.Context,
+	uploadID string,
+	offset int64,
+	chunk io.Reader,
+) (domain.MediaUpload, error) {
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(uploadID), true)
+	if err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("lock upload: %w", err)
+	}
+	defer unlock()
+
+	upload, err := imageSvc.fetchUpload(ctx, uploadID)
+	if err != nil {
+		return domain.MediaUpload{}, err
+	}
+
+	if offset != upload.Offset {
+		return upload, fmt.Errorf("%w: got %d, want %d", ErrUploadOffsetMismatch, offset, upload.Offset)
+	}
+
+	// One more byte than allowed is read to tell whether the chunk exceeds the upload or chunk size
+	remaining, limit := upload.Size-upload.Offset, imageSvc.cfg.UploadChunkMaxSize
+	if limit <= 0 || limit > remaining {
+		limit = remaining
+	}
+
+	data, err := io.ReadAll(io.LimitReader(chunk, limit+1))
+	if err != nil {
+		return upload, fmt.Errorf("read chunk: %w", err)
+	}
+
+	switch {
+	case int64(len(data)) <= limit:
+	case limit == remaining:
+		return upload, fmt.Errorf("%w: chunk exceeds upload size of %d bytes", domain.ErrMediaTooLarge, upload.Size)
+	default:
+		return upload, fmt.Errorf("%w: chunk exceeds %d bytes", ErrUploadChunkTooLarge, limit)
+	}
+
+	if len(data) > 0 {
+		chunkID := uploadChunkID(uploadID, upload.Chunks)
+		if err := imageSvc.chunkRepo.Store(ctx, domain.NewBlob(chunkID, data)); err != nil {
+			return upload, fmt.Errorf("store chunk: %w", err)
+		}
+
+		upload.Offset += int64(len(data))
+		upload.Chunks++
+	}
+
+	upload.Expires = imageSvc.uploadExpiry()
+
+	if err := imageSvc.storeUpload(ctx, upload); err != nil {
+		return upload, err
+	}
+
+	return upload, nil
+}
+
+// AssembleUpload implements ImageService.AssembleUpload. The chunks are read twice, to hash
+// them and to store them, one chunk at a time, so memory usage is bounded by the chunk size.
+func (imageSvc BlobImageService) AssembleUpload(
+	ctx context.Context,
+	uploadID string,
+) (domain.MediaMeta, io.ReadSeekCloser, error) {
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(uploadID), false)
+	if err != nil {
+		return domain.MediaMeta{}, nil, fmt.Errorf("lock upload: %w", err)
+	}
+
+	content := &uploadReader{
+		fetch: func(i int) ([]byte, error) {
+			chunk, err := imageSvc.chunkRepo.Fetch(ctx, uploadChunkID(uploadID, i))
+			if err != nil {
+				return nil, fmt.Errorf("fetch chunk %d: %w", i, err)
+			}
+
+			return chunk.Bytes(), nil
+		},
+		chunks:  0,
+		next:    0,
+		current: nil,
+		unlock:  sync.OnceFunc(unlock),
+	}
+
+	meta, err := imageSvc.assembleUpload(ctx, uploadID, content)
+	if err != nil {
+		_ = content.Close()
+
+		return domain.MediaMeta{}, nil, err
+	}
+
+	return meta, content, nil
+}
+
+// assembleUpload returns the metadata of the content of a complete upload session, which is
+// hashed by reading it from content. The caller must hold a lock of the session.
+func (imageSvc BlobImageService) assembleUpload(
+	ctx context.Context,
+	uploadID string,
+	content *uploadReader,
+) (domain.MediaMeta, error) {
+	upload, err := imageSvc.fetchUpload(ctx, uploadID)
+	if err != nil {
+		return domain.MediaMeta{}, err
+	}
+
+	if !upload.Complete() {
+		return domain.MediaMeta{}, fmt.Errorf("%w: %d of %d bytes received", ErrUploadIncomplete, upload.Offset, upload.Size)
+	}
+
+	content.chunks = upload.Chunks
+	hasher := domain.NewContentHasher()
+
+	if _, err := io.Copy(hasher, content); err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("hash: %w", err)
+	}
+
+	if hasher.Size() != upload.Size {
+		return domain.MediaMeta{}, fmt.Errorf("%w: got %d bytes, want %d", domain.ErrContentMismatch, hasher.Size(), upload.Size)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("seek: %w", err)
+	}
+
+	meta := domain.MediaMeta{ //nolint:exhaustruct
+		Filename: upload.Filename,
+		Owner:    upload.Owner,
+	}
+
+	return meta.WithContent(hasher.Hash(), hasher.Size()), nil
+}
+
+// uploadReader reads the chunks of an upload session in order, fetching one chunk at a time.
+// Closing it releases the lock of the session.
+type uploadReader struct {
+	fetch   func(i int) ([]byte, error)
+	chunks  int // Number of chunks of the session
+	next    int // Index of the chunk read after current
+	current *bytes.Reader
+	unlock  func()
+}
+
+// Read implements io.Reader.
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for r.current == nil || r.current.Len() == 0 {
+		if r.next >= r.chunks {
+			return 0, io.EOF
+		}
+
+		data, err := r.fetch(r.next)
+		if err != nil {
+			return 0, err
+		}
+
+		r.current = bytes.NewReader(data)
+		r.next++
+	}
+
+	return r.current.Read(p)
+}
+
+// Seek implements io.Seeker. Only seeking to the start is supported.
+func (r *uploadReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errUploadSeek
+	}
+
+	r.current, r.next = nil, 0
+
+	return 0, nil
+}
+
+// Close implements io.Closer by releasing the lock of the upload session.
+func (r *uploadReader) Close() error {
+	r.unlock()
+
+	return nil
+}
+
+// DeleteUpload implements ImageService.DeleteUpload.
+func (imageSvc BlobImageService) DeleteUpload(ctx context.Context, uploadID string) error {
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(uploadID), true)
+	if err != nil {
+		return fmt.Errorf("lock upload: %w", err)
+	}
+	defer unlock()
+
+	if _, err := imageSvc.fetchUpload(ctx, uploadID); err != nil {
+		return err
+	}
+
+	return imageSvc.removeUpload(ctx, uploadID)
+}
+
+// RunUploadExpiry periodically removes stale upload sessions until the context is cancelled.
+// The interval is configured by ImageConfig.UploadExpiryInterval; returns immediately if it is 0.
+func (imageSvc BlobImageService) RunUploadExpiry(ctx context.Context) {
+	if imageSvc.cfg.UploadExpiryInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(imageSvc.cfg.UploadExpiryInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = imageSvc.ExpireUploads(ctx)
+		}
+	}
+}
+
+// ExpireUploads removes the upload sessions not resumed within ImageConfig.UploadSessionTTL,
+// and the chunks left without a session, e.g. by a crash while a chunk was appended.
+func (imageSvc BlobImageService) ExpireUploads(ctx context.Context) (result UploadExpiryResult, err error) {
+	log := imageSvc.log.With(logging.Group("upload", "job", "expiry"))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "upload expiry failed", "error", err,
+				"expired", result.Expired, "orphaned", result.Orphaned)
+		} else {
+			log.DebugContext(ctx, "upload expiry finished", "expired", result.Expired, "orphaned", result.Orphaned)
+		}
+	}()
+
+	uploadIDs, err := imageSvc.uploadRepo.List(ctx)
+	if err != nil {
+		return result, fmt.Errorf("list uploads: %w", err)
+	}
+
+	for _, uploadID := range uploadIDs {
+		if err := ctx.Err(); err != nil {
+			return result, fmt.Errorf("expire: %w", err)
+		}
+
+		expired, err := imageSvc.expireUpload(ctx, uploadID.String())
+		if err != nil {
+			return result, fmt.Errorf("expire %q: %w", uploadID, err)
+		}
+
+		if expired {
+			result.Expired++
+		}
+	}
+
+	chunkIDs, err := imageSvc.chunkRepo.List(ctx)
+	if err != nil {
+		return result, fmt.Errorf("list chunks: %w", err)
+	}
+
+	for _, chunkID := range chunkIDs {
+		uploadID, _, _ := strings.Cut(chunkID.String(), "_")
+		if imageSvc.uploadRepo.Exists(ctx, domain.BlobID(uploadID)) {
+			continue
+		}
+
+		removed, err := imageSvc.removeOrphanedChunk(ctx, uploadID, chunkID)
+		if err != nil {
+			return result, fmt.Errorf("remove chunk %q: %w", chunkID, err)
+		}
+
+		if removed {
+			result.Orphaned++
+		}
+	}
+
+	return result, nil
+}
+
+// expireUpload removes the given upload session with its chunks if it has expired.
+// Returns whether the session was removed.
+func (imageSvc BlobImageService) expireUpload(ctx context.Context, uploadID string) (bool, error) {
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(uploadID), true)
+	if err != nil {
+		return false, fmt.Errorf("lock upload: %w", err)
+	}
+	defer unlock()
+
+	// The session may have been completed or removed meanwhile
+	if !imageSvc.uploadRepo.Exists(ctx, domain.BlobID(uploadID)) {
+		return false, nil
+	}
+
+	upload, err := imageSvc.readUpload(ctx, uploadID)
+	if err != nil {
+		return false, err
+	}
+
+	if !uploadExpired(upload) {
+		return false, nil
+	}
+
+	if err := imageSvc.removeUpload(ctx, uploadID); err != nil {
+		return false, err
+	}
+
+	imageSvc.log.DebugContext(ctx, "expired upload removed",
+		logging.Group("upload", "id", uploadID, "offset", upload.Offset, "size", upload.Size))
+
+	return true, nil
+}
+
+// removeOrphanedChunk removes the given chunk of an upload session that does not exist.
+// Returns whether the chunk was removed.
+func (imageSvc BlobImageService) removeOrphanedChunk(
+	ctx context.Context,
+	uploadID string,
+	chunkID domain.BlobID,
+) (bool, error) {
+	unlock, err := imageSvc.uploadRepo.Lock(ctx, domain.BlobID(uploadID), true)
+	if err != nil {
+		return false, fmt.Errorf("lock upload: %w", err)
+	}
+	defer unlock()
+
+	// Re-check under lock, the chunk may be the first of a session being created
+	if imageSvc.uploadRepo.Exists(ctx, domain.BlobID(uploadID)) || !imageSvc.chunkRepo.Exists(ctx, chunkID) {
+		return false, nil
+	}
+
+	if err := imageSvc.chunkRepo.Delete(ctx, chunkID); err != nil {
+		return false, fmt.Errorf("delete chunk: %w", err)
+	}
+
+	return true, nil
+}
+
+// fetchUpload returns the upload session with the given ID, or ErrUploadNotFound if it does not
+// exist, has expired or belongs to another user. The caller must hold a lock of the session.
+func (imageSvc BlobImageService) fetchUpload(ctx context.Context, uploadID string) (domain.MediaUpload, error) {
+	if !imageSvc.uploadRepo.Exists(ctx, domain.BlobID(uploadID)) {
+		return domain.MediaUpload{}, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+	}
+
+	upload, err := imageSvc.readUpload(ctx, uploadID)
+	if err != nil {
+		return domain.MediaUpload{}, err
+	}
+
+	// Sessions of other users are not revealed
+	if username, _ := context_.UsernameFromContext(ctx); username != upload.Owner || uploadExpired(upload) {
+		return domain.MediaUpload{}, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+	}
+
+	return upload, nil
+}
+
+// readUpload reads the stored state of the upload session with the given ID.
+func (imageSvc BlobImageService) readUpload(ctx context.Context, uploadID string) (domain.MediaUpload, error) {
+	uploadBlob, err := imageSvc.uploadRepo.Fetch(ctx, domain.BlobID(uploadID))
+	if err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("fetch upload: %w", err)
+	}
+
+	var upload domain.MediaUpload
+	if err := json.Unmarshal(uploadBlob.Bytes(), &upload); err != nil {
+		return domain.MediaUpload{}, fmt.Errorf("unmarshal upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// storeUpload stores the state of the given upload session. The caller must hold a write lock of the session.
+func (imageSvc BlobImageService) storeUpload(ctx context.Context, upload domain.MediaUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("marshal upload: %w", err)
+	}
+
+	if err := imageSvc.uploadRepo.Store(ctx, domain.NewBlob(domain.BlobID(upload.ID), data)); err != nil {
+		return fmt.Errorf("store upload: %w", err)
+	}
+
+	return nil
+}
+
+// removeUpload removes the upload session with the given ID and its chunks.
+// The caller must hold a write lock of the session.
+func (imageSvc BlobImageService) removeUpload(ctx context.Context, uploadID string) error {
+	if err := imageSvc.chunkRepo.DeleteAll(ctx, domain.BlobID(uploadID), "_*"); err != nil {
+		return fmt.Errorf("delete chunks: %w", err)
+	}
+
+	if err := imageSvc.uploadRepo.Delete(ctx, domain.BlobID(uploadID)); err != nil {
+		return fmt.Errorf("delete upload: %w", err)
+	}
+
+	return nil
+}
+
+// uploadExpiry returns the expiry of an upload session resumed now.
+func (imageSvc BlobImageService) uploadExpiry() int64 {
+	return time.Now().Unix() + imageSvc.cfg.UploadSessionTTL
+}
+
+// uploadExpired reports whether the given upload session has expired.
+func uploadExpired(upload domain.MediaUpload) bool {
+	return time.Now().Unix() > upload.Expires
+}
+
+// uploadChunkID returns the blob ID of the chunk of an upload session with the given index.
+// Indexes are zero-padded so the chunks of a session are listed in order.
+func uploadChunkID(uploadID string, index int) domain.BlobID {
+	return domain.BlobID(fmt.Sprintf("%s_%06d", uploadID, index))
+}
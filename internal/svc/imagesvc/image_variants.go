@@ -0,0 +1,68 @@
+package imagesvc
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+// Variants implements ImageService.Variants. Only the header of the original is decoded.
+// Widths are snapped to ImageConfig.AllowedWidths like those of Fetch.
+func (imageSvc BlobImageService) Variants(
+	ctx context.Context,
+	imageID domain.MediaID,
+	widths []int,
+) (domain.MediaVariantSet, error) {
+	img, err := imageSvc.mediaSvc.Fetch(ctx, imageID)
+	if err != nil {
+		return domain.MediaVariantSet{}, fmt.Errorf("fetch media: %w", err)
+	}
+
+	imgConfig, err := decodeImageConfig(bytes.NewReader(img.Bytes()), img.MIMEType())
+	if err != nil {
+		return domain.MediaVariantSet{}, fmt.Errorf("decode image config: %w", err)
+	}
+
+	// Derivatives are always oriented upright
+	original := orientedBounds(imgConfig, imageOrientation(img.Bytes(), img.MIMEType()))
+
+	set := domain.MediaVariantSet{
+		Meta:     img.Meta(),
+		Original: domain.MediaVariant{Width: original.Dx(), Height: original.Dy()},
+		Variants: make([]domain.MediaVariant, 0, len(widths)),
+	}
+
+	for _, width := range widths {
+		width, err := imageSvc.allowedWidth(min(width, original.Dx()))
+		if errors.Is(err, domain.ErrWidthNotAllowed) {
+			continue
+		} else if err != nil {
+			return domain.MediaVariantSet{}, err
+		}
+
+		_, width, height := transformGeometry(original, transform.Spec{Width: width})
+		set.Variants = append(set.Variants, domain.MediaVariant{Width: width, Height: height})
+	}
+
+	slices.SortFunc(set.Variants, func(a, b domain.MediaVariant) int { return cmp.Compare(a.Width, b.Width) })
+	set.Variants = slices.Compact(set.Variants)
+
+	return set, nil
+}
+
+// orientedBounds returns the bounds of an image with the given config once oriented upright
+// according to its EXIF orientation.
+func orientedBounds(imgConfig image.Config, orientation int) image.Rectangle {
+	if orientation >= orientationTranspose && orientation <= orientationRotate270 {
+		return image.Rect(0, 0, imgConfig.Height, imgConfig.Width)
+	}
+
+	return image.Rect(0, 0, imgConfig.Width, imgConfig.Height)
+}
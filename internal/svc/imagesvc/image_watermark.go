@@ -0,0 +1,114 @@
+package imagesvc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+
+	"golang.org/x/image/draw"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+)
+
+// ErrWatermarkNotConfigured is returned when the "watermark" processor is selected without a watermark file.
+var ErrWatermarkNotConfigured = errors.New("watermark file not configured")
+
+// watermarkMarginDivisor determines the margin between the watermark and the image border
+// as a fraction of the image width.
+const watermarkMarginDivisor = 50
+
+// watermarkProcessor is the "watermark" processor, drawing a semi-transparent watermark
+// onto the bottom right corner of images. Watermarked images are re-encoded.
+type watermarkProcessor struct {
+	watermark image.Image
+	opacity   uint8
+	scale     int
+	quality   int
+	interpol  draw.Interpolator
+}
+
+func newWatermarkProcessor(cfg ImageConfig) (Processor, error) {
+	if cfg.WatermarkFile == "" {
+		return nil, ErrWatermarkNotConfigured
+	}
+
+	file, err := os.Open(cfg.WatermarkFile)
+	if err != nil {
+		return nil, fmt.Errorf("open watermark: %w", err)
+	}
+	defer file.Close()
+
+	watermark, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode watermark: %w", err)
+	}
+
+	interpol, err := getInterpolatorByName(cfg.Interpolator)
+	if err != nil {
+		return nil, err
+	}
+
+	return watermarkProcessor{
+		watermark: watermark,
+		opacity:   uint8(min(max(cfg.WatermarkOpacity, 0), 100) * 0xFF / 100), //nolint:gosec
+		scale:     min(max(cfg.WatermarkScale, 1), 100),
+		quality:   cfg.OptimizeJPEGQuality,
+		interpol:  interpol,
+	}, nil
+}
+
+// Process implements Processor by drawing the watermark onto the image.
+// Images of types that cannot be encoded are returned unchanged.
+func (processor watermarkProcessor) Process(_ context.Context, img domain.Media) (domain.Media, error) {
+	if _, err := getEncoderByType(img.MIMEType()); err != nil {
+		return img, nil //nolint:nilerr
+	}
+
+	bitmap, err := decodeImage(bytes.NewReader(img.Bytes()), img.MIMEType())
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("decode image: %w", err)
+	}
+
+	// The EXIF orientation is not re-encoded, so the watermark is drawn onto the upright image
+	bitmap = orientImage(bitmap, imageOrientation(img.Bytes(), img.MIMEType()))
+
+	bounds := bitmap.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), bitmap, bounds.Min, draw.Src)
+
+	// Scale down the watermark to the maximum width, keeping its aspect ratio
+	mark := processor.watermark.Bounds()
+	width, height := mark.Dx(), mark.Dy()
+
+	if maxWidth := bounds.Dx() * processor.scale / 100; width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+
+	if width == 0 || height == 0 {
+		return img, nil
+	}
+
+	margin := bounds.Dx() / watermarkMarginDivisor
+	target := image.Rect(
+		bounds.Dx()-width-margin, bounds.Dy()-height-margin,
+		bounds.Dx()-margin, bounds.Dy()-margin,
+	)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	processor.interpol.Scale(scaled, scaled.Bounds(), processor.watermark, mark, draw.Src, nil)
+
+	draw.DrawMask(canvas, target, scaled, image.Point{}, image.NewUniform(color.Alpha{A: processor.opacity}),
+		image.Point{}, draw.Over)
+
+	watermarked, err := encodeImageQuality(canvas, img.MIMEType(), processor.quality)
+	if err != nil {
+		return domain.Media{}, fmt.Errorf("encode image: %w", err)
+	}
+
+	return withProcessedData(img, watermarked), nil
+}
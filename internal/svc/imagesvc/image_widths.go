@@ -0,0 +1,75 @@
+package imagesvc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+// ErrInvalidAllowedWidths is returned when the configured allowed widths cannot be parsed.
+var ErrInvalidAllowedWidths = errors.New("invalid allowed widths")
+
+// parseConfigWidths parses a configured comma-separated list of widths, wrapping errors in errInvalid.
+// Returns the widths in ascending order, or no widths if the list is empty.
+func parseConfigWidths(widthsStr string, errInvalid error) ([]int, error) {
+	if widthsStr == "" {
+		return nil, nil
+	}
+
+	widths, err := parseWidths(widthsStr, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalid, err)
+	}
+
+	if widths[len(widths)-1] > transform.MaxDimension {
+		return nil, fmt.Errorf("%w: %d exceeds %d", errInvalid, widths[len(widths)-1], transform.MaxDimension)
+	}
+
+	return widths, nil
+}
+
+// parseAllowedWidths parses ImageConfig.AllowedWidths. No widths allow any width.
+// Returns ErrInvalidThumbnailWidths if thumbnail widths are not allowed and cannot be snapped.
+func parseAllowedWidths(cfg ImageConfig, thumbnailWidths []int) ([]int, error) {
+	allowedWidths, err := parseConfigWidths(cfg.AllowedWidths, ErrInvalidAllowedWidths)
+	if err != nil || allowedWidths == nil || cfg.SnapWidths {
+		return allowedWidths, err
+	}
+
+	for _, width := range thumbnailWidths {
+		if _, found := slices.BinarySearch(allowedWidths, width); !found {
+			return nil, fmt.Errorf("%w: %d is not allowed", ErrInvalidThumbnailWidths, width)
+		}
+	}
+
+	return allowedWidths, nil
+}
+
+// allowedWidth returns the width an image is resized to for a requested width.
+// If ImageConfig.AllowedWidths is set, widths not listed are snapped to the nearest allowed width
+// if ImageConfig.SnapWidths is enabled, and rejected with domain.ErrWidthNotAllowed otherwise.
+// Ties are snapped to the larger width.
+func (imageSvc BlobImageService) allowedWidth(width int) (int, error) {
+	allowed := imageSvc.allowedWidths
+	if width == 0 || len(allowed) == 0 {
+		return width, nil
+	}
+
+	i, found := slices.BinarySearch(allowed, width)
+
+	switch {
+	case found:
+		return width, nil
+	case !imageSvc.cfg.SnapWidths:
+		return 0, fmt.Errorf("%w: %d", domain.ErrWidthNotAllowed, width)
+	case i == 0:
+		return allowed[0], nil
+	case i == len(allowed) || width-allowed[i-1] < allowed[i]-width:
+		return allowed[i-1], nil
+	default:
+		return allowed[i], nil
+	}
+}
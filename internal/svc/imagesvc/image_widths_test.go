@@ -0,0 +1,102 @@
+package imagesvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+func TestBlobImageService_AllowedWidths(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		snap      bool
+		width     int
+		wantWidth int
+		wantErr   error
+	}{
+		{width: 8, wantWidth: 8},
+		{width: 16, wantWidth: 16},
+		{width: 12, wantErr: domain.ErrWidthNotAllowed},
+		{snap: true, width: 1, wantWidth: 8},
+		{snap: true, width: 11, wantWidth: 8},
+		{snap: true, width: 12, wantWidth: 16},
+		{snap: true, width: 13, wantWidth: 16},
+		{snap: true, width: 100, wantWidth: 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d snap %v", tt.width, tt.snap), func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig("")
+			cfg.AllowedWidths = "16, 8"
+			cfg.SnapWidths = tt.snap
+
+			imageSvc, err := newTestImageService(t, cfg)
+			if err != nil {
+				t.Fatalf("new image service: %v", err)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			stored, err := imageSvc.Store(ctx, domain.NewMedia(encodeTestImage(t, imagesvc.MIMETypePNG, 32, 32, true), domain.MediaMeta{
+				Filename: "photo.png", Owner: "alice", MIMEType: imagesvc.MIMETypePNG,
+			}))
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			resized, err := imageSvc.Fetch(ctx, stored.ID(), tt.width)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fetch() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			bitmap, err := png.Decode(bytes.NewReader(resized.Bytes()))
+			if err != nil {
+				t.Fatalf("decode resized image: %v", err)
+			}
+
+			if got := bitmap.Bounds().Dx(); got != tt.wantWidth {
+				t.Errorf("resized width = %d, want %d", got, tt.wantWidth)
+			}
+		})
+	}
+}
+
+func TestNewBlobImageService_InvalidAllowedWidths(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		allowed    string
+		thumbnails string
+		snap       bool
+		wantErr    error
+	}{
+		{allowed: "320,abc", wantErr: imagesvc.ErrInvalidAllowedWidths},
+		{allowed: "100000", wantErr: imagesvc.ErrInvalidAllowedWidths},
+		{allowed: "320,640", thumbnails: "200", wantErr: imagesvc.ErrInvalidThumbnailWidths},
+		{allowed: "320,640", thumbnails: "200", snap: true},
+		{allowed: "320,640", thumbnails: "640"},
+	}
+
+	for _, tt := range tests {
+		cfg := testConfig("")
+		cfg.AllowedWidths, cfg.ThumbnailWidths, cfg.SnapWidths = tt.allowed, tt.thumbnails, tt.snap
+
+		if _, err := newTestImageService(t, cfg); !errors.Is(err, tt.wantErr) {
+			t.Errorf("NewBlobImageService(%q, %q) error = %v, want %v", tt.allowed, tt.thumbnails, err, tt.wantErr)
+		}
+	}
+}
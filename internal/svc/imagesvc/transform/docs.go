@@ -0,0 +1,55 @@
+package transform
+
+// ParamDoc documents a single key of the transform spec.
+type ParamDoc struct {
+	Key         string   `json:"key"`
+	Description string   `json:"description"`
+	Values      []string `json:"values,omitempty"`
+	Min         int      `json:"min,omitempty"`
+	Max         int      `json:"max,omitempty"`
+}
+
+// Doc documents the transform spec language.
+type Doc struct {
+	Syntax  string     `json:"syntax"`
+	Example string     `json:"example"`
+	Params  []ParamDoc `json:"params"`
+}
+
+// Documentation returns a description of the transform spec language
+// for the given accepted output formats.
+func Documentation(formats Formats) Doc {
+	fits := make([]string, len(validFits))
+	for i, fit := range validFits {
+		fits[i] = string(fit)
+	}
+
+	flips := make([]string, len(validFlips))
+	for i, flip := range validFlips {
+		flips[i] = string(flip)
+	}
+
+	gravities := make([]string, len(validGravities))
+	for i, gravity := range validGravities {
+		gravities[i] = string(gravity)
+	}
+
+	return Doc{
+		Syntax:  "key:value[,key:value...]",
+		Example: "w:640,h:480,fit:cover,q:80,rot:90",
+		Params: []ParamDoc{
+			{Key: KeyWidth, Description: "Target width in pixels", Min: 1, Max: MaxDimension},
+			{Key: KeyHeight, Description: "Target height in pixels", Min: 1, Max: MaxDimension},
+			{Key: KeyFit, Description: "How to fit the image if both width and height are set", Values: fits},
+			{Key: KeyFormat, Description: "Output format", Values: formats},
+			{Key: KeyQuality, Description: "Encoding quality for lossy formats", Min: MinQuality, Max: MaxQuality},
+			{Key: KeyRotate, Description: "Clockwise rotation in degrees", Values: []string{"0", "90", "180", "270"}},
+			{Key: KeyFlip, Description: "Mirroring after rotation, horizontal or vertical", Values: flips},
+			{Key: KeyCropX, Description: "Left edge of the crop region in pixels", Min: 0, Max: MaxDimension},
+			{Key: KeyCropY, Description: "Top edge of the crop region in pixels", Min: 0, Max: MaxDimension},
+			{Key: KeyCropWidth, Description: "Width of the crop region in pixels", Min: 1, Max: MaxDimension},
+			{Key: KeyCropHeight, Description: "Height of the crop region in pixels", Min: 1, Max: MaxDimension},
+			{Key: KeyGravity, Description: "Placement of the crop region instead of its edges", Values: gravities},
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+)
+
+// SignUntil returns the URL-safe HMAC-SHA256 signature of applying the canonical spec to the
+// resource with the given ID until expiresAt, in Unix seconds, so neither the spec nor the
+// expiry can be altered without invalidating the signature.
+func SignUntil(secret []byte, resourceID string, spec Spec, expiresAt int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(resourceID))
+	mac.Write([]byte{'/'})
+	mac.Write([]byte(spec.String()))
+	mac.Write([]byte{'/'})
+	mac.Write([]byte(strconv.FormatInt(expiresAt, 10)))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyUntil reports whether signature is a valid signature of applying spec to the resource
+// with the given ID until expiresAt. It does not check whether expiresAt has passed.
+// Always returns false if the secret is empty.
+func VerifyUntil(secret []byte, resourceID string, spec Spec, expiresAt int64, signature string) bool {
+	if len(secret) == 0 || signature == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(SignUntil(secret, resourceID, spec, expiresAt)), []byte(signature))
+}
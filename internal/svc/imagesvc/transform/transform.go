@@ -0,0 +1,407 @@
+// Package transform implements a compact specification language for image transformations.
+//
+// A transform spec is a comma-separated list of key:value pairs, e.g.
+//
+//	w:640,h:480,fit:cover,fmt:png,q:80,rot:90,flip:h
+//
+// A region of the image may be cropped before it is resized, either at an offset
+// (cx:10,cy:20,cw:320,ch:240) or placed by gravity (cw:320,ch:240,g:center).
+//
+// Specs are strictly validated and can be canonicalized, so that equivalent specs
+// map to the same cache key.
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidSpec is returned when a transform spec cannot be parsed.
+	ErrInvalidSpec = errors.New("invalid transform spec")
+	// ErrUnknownKey is returned when a transform spec contains an unknown key.
+	ErrUnknownKey = errors.New("unknown transform key")
+	// ErrDuplicateKey is returned when a transform spec contains a key more than once.
+	ErrDuplicateKey = errors.New("duplicate transform key")
+	// ErrInvalidValue is returned when a transform spec contains an invalid value.
+	ErrInvalidValue = errors.New("invalid transform value")
+)
+
+const (
+	// MaxDimension is the maximum width or height of a transformed image in pixels.
+	MaxDimension = 8192
+	// MinQuality is the minimum encoding quality.
+	MinQuality = 1
+	// MaxQuality is the maximum encoding quality.
+	MaxQuality = 100
+)
+
+// Fit defines how an image is fitted into the target dimensions if both width and height are given.
+type Fit string
+
+const (
+	// FitContain scales the image to fit within the target dimensions, preserving its aspect ratio.
+	FitContain Fit = "contain"
+	// FitCover scales the image to cover the target dimensions, preserving its aspect ratio,
+	// and crops the overflowing parts.
+	FitCover Fit = "cover"
+	// FitFill stretches the image to the target dimensions.
+	FitFill Fit = "fill"
+)
+
+// Flip defines how an image is mirrored after it is rotated.
+type Flip string
+
+const (
+	// FlipHorizontal mirrors the image left to right.
+	FlipHorizontal Flip = "h"
+	// FlipVertical mirrors the image top to bottom.
+	FlipVertical Flip = "v"
+)
+
+// Gravity defines where a crop region of the given dimensions is placed within the image.
+type Gravity string
+
+// Gravities place the crop region at the center, an edge or a corner of the image.
+const (
+	GravityCenter    Gravity = "center"
+	GravityNorth     Gravity = "north"
+	GravitySouth     Gravity = "south"
+	GravityEast      Gravity = "east"
+	GravityWest      Gravity = "west"
+	GravityNorthEast Gravity = "northeast"
+	GravityNorthWest Gravity = "northwest"
+	GravitySouthEast Gravity = "southeast"
+	GravitySouthWest Gravity = "southwest"
+)
+
+// Keys of the transform spec.
+const (
+	KeyWidth      = "w"
+	KeyHeight     = "h"
+	KeyFit        = "fit"
+	KeyFormat     = "fmt"
+	KeyQuality    = "q"
+	KeyRotate     = "rot"
+	KeyFlip       = "flip"
+	KeyCropX      = "cx"
+	KeyCropY      = "cy"
+	KeyCropWidth  = "cw"
+	KeyCropHeight = "ch"
+	KeyGravity    = "g"
+)
+
+// keyOrder is the order of keys in canonical specs.
+//
+//nolint:gochecknoglobals
+var keyOrder = []string{
+	KeyWidth, KeyHeight, KeyFit, KeyFormat, KeyQuality, KeyRotate, KeyFlip,
+	KeyCropX, KeyCropY, KeyCropWidth, KeyCropHeight, KeyGravity,
+}
+
+//nolint:gochecknoglobals
+var (
+	validFits      = []Fit{FitContain, FitCover, FitFill}
+	validRotations = []int{0, 90, 180, 270}
+	validFlips     = []Flip{FlipHorizontal, FlipVertical}
+	validGravities = []Gravity{
+		GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest,
+		GravityNorthEast, GravityNorthWest, GravitySouthEast, GravitySouthWest,
+	}
+)
+
+// Spec describes a set of image transformations.
+// The zero value describes the identity transformation.
+type Spec struct {
+	Width   int    // Target width in pixels, 0 to derive from height or keep original
+	Height  int    // Target height in pixels, 0 to derive from width or keep original
+	Fit     Fit    // How to fit the image if both width and height are set, defaults to FitContain
+	Format  string // Output format name (e.g. "jpeg", "png"), empty to keep the original format
+	Quality int    // Encoding quality (1-100), 0 for the encoder default
+	Rotate  int    // Clockwise rotation in degrees (0, 90, 180, 270)
+	Flip    Flip   // Mirroring of the rotated image, empty to not mirror it
+
+	// The crop region is applied to the rotated and mirrored image, before it is resized.
+	// It is placed by Gravity if set, or at the offset CropX, CropY otherwise.
+	CropX      int     // Left edge of the crop region in pixels
+	CropY      int     // Top edge of the crop region in pixels
+	CropWidth  int     // Width of the crop region in pixels, 0 to not crop
+	CropHeight int     // Height of the crop region in pixels, 0 to not crop
+	Gravity    Gravity // Placement of the crop region, empty to place it at its offset
+}
+
+// Formats lists the output format names accepted by Parse.
+// It is set by the image service to the formats it is able to encode.
+type Formats []string
+
+// Parse parses and validates a transform spec.
+// The formats parameter lists the accepted output format names.
+// An empty spec string yields the identity transformation.
+//
+//nolint:cyclop,funlen
+func Parse(specStr string, formats Formats) (Spec, error) {
+	var (
+		spec Spec
+		seen = make(map[string]bool)
+	)
+
+	specStr = strings.TrimSpace(specStr)
+	if specStr == "" {
+		return spec, nil
+	}
+
+	for _, part := range strings.Split(specStr, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), ":")
+		if !found || key == "" || value == "" {
+			return Spec{}, fmt.Errorf("%w: %q", ErrInvalidSpec, part)
+		}
+
+		key = strings.ToLower(key)
+
+		if seen[key] {
+			return Spec{}, fmt.Errorf("%w: %q", ErrDuplicateKey, key)
+		}
+
+		seen[key] = true
+
+		var err error
+
+		switch key {
+		case KeyWidth:
+			spec.Width, err = parseInt(key, value, 1, MaxDimension)
+		case KeyHeight:
+			spec.Height, err = parseInt(key, value, 1, MaxDimension)
+		case KeyQuality:
+			spec.Quality, err = ParseQuality(value)
+		case KeyRotate:
+			spec.Rotate, err = ParseRotation(value)
+		case KeyFlip:
+			spec.Flip, err = ParseFlip(value)
+		case KeyFit:
+			spec.Fit = Fit(strings.ToLower(value))
+			if !slices.Contains(validFits, spec.Fit) {
+				err = fmt.Errorf("%w: %s must be one of %v", ErrInvalidValue, key, validFits)
+			}
+		case KeyFormat:
+			spec.Format, err = ParseFormat(value, formats)
+		case KeyCropX:
+			spec.CropX, err = parseInt(key, value, 0, MaxDimension)
+		case KeyCropY:
+			spec.CropY, err = parseInt(key, value, 0, MaxDimension)
+		case KeyCropWidth:
+			spec.CropWidth, err = parseInt(key, value, 1, MaxDimension)
+		case KeyCropHeight:
+			spec.CropHeight, err = parseInt(key, value, 1, MaxDimension)
+		case KeyGravity:
+			spec.Gravity = Gravity(strings.ToLower(value))
+			if !slices.Contains(validGravities, spec.Gravity) {
+				err = fmt.Errorf("%w: %s must be one of %v", ErrInvalidValue, key, validGravities)
+			}
+		default:
+			err = fmt.Errorf("%w: %q", ErrUnknownKey, key)
+		}
+
+		if err != nil {
+			return Spec{}, err
+		}
+	}
+
+	if err := checkCrop(seen); err != nil {
+		return Spec{}, err
+	}
+
+	return spec, nil
+}
+
+// checkCrop checks that the crop keys of a spec describe a single crop region.
+func checkCrop(seen map[string]bool) error {
+	switch {
+	case seen[KeyCropWidth] != seen[KeyCropHeight]:
+		return fmt.Errorf("%w: %s and %s must be given together", ErrInvalidSpec, KeyCropWidth, KeyCropHeight)
+	case (seen[KeyCropX] || seen[KeyCropY] || seen[KeyGravity]) && !seen[KeyCropWidth]:
+		return fmt.Errorf("%w: %s and %s are required to crop", ErrInvalidSpec, KeyCropWidth, KeyCropHeight)
+	case (seen[KeyCropX] || seen[KeyCropY]) && seen[KeyGravity]:
+		return fmt.Errorf("%w: crop offset and %s are mutually exclusive", ErrInvalidSpec, KeyGravity)
+	default:
+		return nil
+	}
+}
+
+func parseInt(key, value string, minValue, maxValue int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be an integer", ErrInvalidValue, key)
+	}
+
+	if n < minValue || n > maxValue {
+		return 0, fmt.Errorf("%w: %s must be between %d and %d", ErrInvalidValue, key, minValue, maxValue)
+	}
+
+	return n, nil
+}
+
+// ParseQuality parses and validates an encoding quality.
+func ParseQuality(quality string) (int, error) {
+	return parseInt(KeyQuality, quality, MinQuality, MaxQuality)
+}
+
+// ParseRotation parses and validates a clockwise rotation in degrees.
+func ParseRotation(rotation string) (int, error) {
+	degrees, err := parseInt(KeyRotate, rotation, 0, 359)
+	if err == nil && !slices.Contains(validRotations, degrees) {
+		return 0, fmt.Errorf("%w: %s must be one of %v", ErrInvalidValue, KeyRotate, validRotations)
+	}
+
+	return degrees, err
+}
+
+// ParseFlip parses and validates a flip direction.
+func ParseFlip(flip string) (Flip, error) {
+	direction := Flip(strings.ToLower(flip))
+	if !slices.Contains(validFlips, direction) {
+		return "", fmt.Errorf("%w: %s must be one of %v", ErrInvalidValue, KeyFlip, validFlips)
+	}
+
+	return direction, nil
+}
+
+// ParseFormat parses and validates an output format name, e.g. "jpg" as "jpeg".
+// The formats parameter lists the accepted output format names.
+func ParseFormat(format string, formats Formats) (string, error) {
+	format = normalizeFormat(format)
+	if !slices.Contains(formats, format) {
+		return "", fmt.Errorf("%w: %s must be one of %v", ErrInvalidValue, KeyFormat, []string(formats))
+	}
+
+	return format, nil
+}
+
+func normalizeFormat(format string) string {
+	format = strings.ToLower(format)
+
+	switch format {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
+	default:
+		return format
+	}
+}
+
+// IsIdentity reports whether the spec does not change the image.
+func (s Spec) IsIdentity() bool {
+	return s.Canonical() == Spec{}
+}
+
+// Canonical returns the spec with redundant values removed, so that
+// equivalent specs compare equal.
+func (s Spec) Canonical() Spec {
+	if s.Width == 0 || s.Height == 0 || s.Fit == FitContain {
+		s.Fit = "" // fit only applies if both dimensions are given
+	}
+
+	if s.Rotate%360 == 0 {
+		s.Rotate = 0
+	}
+
+	if s.Flip != "" && s.Rotate >= 180 {
+		// rotating by 180 degrees mirrors the image in both directions
+		s.Rotate -= 180
+
+		if s.Flip == FlipHorizontal {
+			s.Flip = FlipVertical
+		} else {
+			s.Flip = FlipHorizontal
+		}
+	}
+
+	switch {
+	case s.CropWidth == 0 || s.CropHeight == 0:
+		s.CropX, s.CropY, s.CropWidth, s.CropHeight, s.Gravity = 0, 0, 0, 0, ""
+	case s.Gravity == GravityNorthWest:
+		s.CropX, s.CropY, s.Gravity = 0, 0, "" // same as cropping at offset 0,0
+	case s.Gravity != "":
+		s.CropX, s.CropY = 0, 0 // the offset is ignored if placed by gravity
+	}
+
+	return s
+}
+
+// String returns the canonical string representation of the spec.
+func (s Spec) String() string {
+	s = s.Canonical()
+
+	values := map[string]string{}
+
+	if s.Width != 0 {
+		values[KeyWidth] = strconv.Itoa(s.Width)
+	}
+
+	if s.Height != 0 {
+		values[KeyHeight] = strconv.Itoa(s.Height)
+	}
+
+	if s.Fit != "" {
+		values[KeyFit] = string(s.Fit)
+	}
+
+	if s.Format != "" {
+		values[KeyFormat] = s.Format
+	}
+
+	if s.Quality != 0 {
+		values[KeyQuality] = strconv.Itoa(s.Quality)
+	}
+
+	if s.Rotate != 0 {
+		values[KeyRotate] = strconv.Itoa(s.Rotate)
+	}
+
+	if s.Flip != "" {
+		values[KeyFlip] = string(s.Flip)
+	}
+
+	if s.CropX != 0 {
+		values[KeyCropX] = strconv.Itoa(s.CropX)
+	}
+
+	if s.CropY != 0 {
+		values[KeyCropY] = strconv.Itoa(s.CropY)
+	}
+
+	if s.CropWidth != 0 {
+		values[KeyCropWidth] = strconv.Itoa(s.CropWidth)
+		values[KeyCropHeight] = strconv.Itoa(s.CropHeight)
+	}
+
+	if s.Gravity != "" {
+		values[KeyGravity] = string(s.Gravity)
+	}
+
+	parts := make([]string, 0, len(values))
+
+	for _, key := range keyOrder {
+		if value, ok := values[key]; ok {
+			parts = append(parts, key+":"+value)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// CacheKey returns a filesystem-safe key identifying the canonical spec.
+// A spec only setting the width yields just the width, which keeps the
+// cache keys of plain resize requests stable.
+func (s Spec) CacheKey() string {
+	s = s.Canonical()
+
+	if (s == Spec{Width: s.Width}) {
+		return strconv.Itoa(s.Width)
+	}
+
+	return strings.NewReplacer(":", "", ",", "-").Replace(s.String())
+}
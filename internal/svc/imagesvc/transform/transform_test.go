@@ -0,0 +1,196 @@
+package transform_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/svc/imagesvc/transform"
+)
+
+//nolint:gochecknoglobals
+var formats = transform.Formats{"jpeg", "png", "tiff"}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		spec      string
+		want      transform.Spec
+		canonical string
+		cacheKey  string
+		wantErr   error
+	}{
+		{name: "empty", spec: "", want: transform.Spec{}, canonical: "", cacheKey: "0"},
+		{
+			name:      "full",
+			spec:      "w:640,h:480,fit:cover,fmt:png,q:80,rot:90",
+			want:      transform.Spec{Width: 640, Height: 480, Fit: transform.FitCover, Format: "png", Quality: 80, Rotate: 90},
+			canonical: "w:640,h:480,fit:cover,fmt:png,q:80,rot:90",
+			cacheKey:  "w640-h480-fitcover-fmtpng-q80-rot90",
+		},
+		{
+			name:      "reordered and redundant",
+			spec:      "rot:0, FIT:contain,h:480,w:640,fmt:JPG",
+			want:      transform.Spec{Width: 640, Height: 480, Fit: transform.FitContain, Format: "jpeg"},
+			canonical: "w:640,h:480,fmt:jpeg",
+			cacheKey:  "w640-h480-fmtjpeg",
+		},
+		{name: "width only", spec: "w:320", want: transform.Spec{Width: 320}, canonical: "w:320", cacheKey: "320"},
+		{
+			name:      "fit without both dimensions",
+			spec:      "h:200,fit:fill",
+			want:      transform.Spec{Height: 200, Fit: transform.FitFill},
+			canonical: "h:200",
+			cacheKey:  "h200",
+		},
+		{
+			name:      "crop at offset",
+			spec:      "cw:320,ch:240,cx:10,cy:0,w:160",
+			want:      transform.Spec{Width: 160, CropX: 10, CropWidth: 320, CropHeight: 240},
+			canonical: "w:160,cx:10,cw:320,ch:240",
+			cacheKey:  "w160-cx10-cw320-ch240",
+		},
+		{
+			name:      "crop by gravity",
+			spec:      "cw:320,ch:240,g:SouthEast",
+			want:      transform.Spec{CropWidth: 320, CropHeight: 240, Gravity: transform.GravitySouthEast},
+			canonical: "cw:320,ch:240,g:southeast",
+			cacheKey:  "cw320-ch240-gsoutheast",
+		},
+		{
+			name:      "crop by northwest gravity",
+			spec:      "cw:320,ch:240,g:northwest",
+			want:      transform.Spec{CropWidth: 320, CropHeight: 240, Gravity: transform.GravityNorthWest},
+			canonical: "cw:320,ch:240",
+			cacheKey:  "cw320-ch240",
+		},
+		{
+			name:      "flip",
+			spec:      "rot:90,flip:H",
+			want:      transform.Spec{Rotate: 90, Flip: transform.FlipHorizontal},
+			canonical: "rot:90,flip:h",
+			cacheKey:  "rot90-fliph",
+		},
+		{
+			name:      "flip of half turn",
+			spec:      "rot:270,flip:v",
+			want:      transform.Spec{Rotate: 270, Flip: transform.FlipVertical},
+			canonical: "rot:90,flip:h",
+			cacheKey:  "rot90-fliph",
+		},
+		{name: "missing value", spec: "w:", wantErr: transform.ErrInvalidSpec},
+		{name: "missing separator", spec: "w640", wantErr: transform.ErrInvalidSpec},
+		{name: "unknown key", spec: "w:640,blur:3", wantErr: transform.ErrUnknownKey},
+		{name: "duplicate key", spec: "w:640,W:320", wantErr: transform.ErrDuplicateKey},
+		{name: "non-integer width", spec: "w:abc", wantErr: transform.ErrInvalidValue},
+		{name: "zero width", spec: "w:0", wantErr: transform.ErrInvalidValue},
+		{name: "width too large", spec: "w:100000", wantErr: transform.ErrInvalidValue},
+		{name: "quality too high", spec: "q:101", wantErr: transform.ErrInvalidValue},
+		{name: "invalid rotation", spec: "rot:45", wantErr: transform.ErrInvalidValue},
+		{name: "invalid flip", spec: "flip:x", wantErr: transform.ErrInvalidValue},
+		{name: "invalid fit", spec: "fit:stretch", wantErr: transform.ErrInvalidValue},
+		{name: "unsupported format", spec: "fmt:webp", wantErr: transform.ErrInvalidValue},
+		{name: "crop without height", spec: "cw:320", wantErr: transform.ErrInvalidSpec},
+		{name: "crop offset without size", spec: "cx:10,cy:10", wantErr: transform.ErrInvalidSpec},
+		{name: "crop offset and gravity", spec: "cw:320,ch:240,cx:10,g:center", wantErr: transform.ErrInvalidSpec},
+		{name: "negative crop offset", spec: "cw:320,ch:240,cx:-1", wantErr: transform.ErrInvalidValue},
+		{name: "invalid gravity", spec: "cw:320,ch:240,g:middle", wantErr: transform.ErrInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := transform.Parse(tt.spec, formats)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.spec, err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+
+			if s := got.String(); s != tt.canonical {
+				t.Errorf("String() = %q, want %q", s, tt.canonical)
+			}
+
+			if key := got.CacheKey(); key != tt.cacheKey {
+				t.Errorf("CacheKey() = %q, want %q", key, tt.cacheKey)
+			}
+
+			// The canonical form must parse to an equivalent spec
+			reparsed, err := transform.Parse(got.String(), formats)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", got.String(), err)
+			}
+
+			if reparsed.Canonical() != got.Canonical() {
+				t.Errorf("reparsed = %+v, want %+v", reparsed.Canonical(), got.Canonical())
+			}
+		})
+	}
+}
+
+func TestVerifyUntil(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	spec := transform.Spec{Width: 640, Height: 480, Fit: transform.FitContain}
+	signature := transform.SignUntil(secret, "media", spec, 1000)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		mediaID   string
+		spec      transform.Spec
+		expiresAt int64
+		signature string
+		want      bool
+	}{
+		{name: "valid", secret: secret, mediaID: "media", spec: spec, expiresAt: 1000, signature: signature, want: true},
+		{
+			name:      "equivalent spec",
+			secret:    secret,
+			mediaID:   "media",
+			spec:      transform.Spec{Width: 640, Height: 480},
+			expiresAt: 1000,
+			signature: signature,
+			want:      true,
+		},
+		{name: "other expiry", secret: secret, mediaID: "media", spec: spec, expiresAt: 1001, signature: signature},
+		{
+			name:      "other spec",
+			secret:    secret,
+			mediaID:   "media",
+			spec:      transform.Spec{Width: 641},
+			expiresAt: 1000,
+			signature: signature,
+		},
+		{name: "other media", secret: secret, mediaID: "other", spec: spec, expiresAt: 1000, signature: signature},
+		{name: "other secret", secret: []byte("other"), mediaID: "media", spec: spec, expiresAt: 1000, signature: signature},
+		{
+			name:      "empty secret",
+			secret:    nil,
+			mediaID:   "media",
+			spec:      spec,
+			expiresAt: 1000,
+			signature: transform.SignUntil(nil, "media", spec, 1000),
+		},
+		{name: "empty signature", secret: secret, mediaID: "media", spec: spec, expiresAt: 1000, signature: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := transform.VerifyUntil(tt.secret, tt.mediaID, tt.spec, tt.expiresAt, tt.signature); got != tt.want {
+				t.Errorf("VerifyUntil() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
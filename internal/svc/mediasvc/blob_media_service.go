@@ -2,8 +2,12 @@ package mediasvc
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"slices"
 	"strings"
 
@@ -11,15 +15,24 @@ import (
 	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
 	"github.com/mkrupp/homecase-michael/internal/infra/logging"
 	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/repo/metaindex"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
 )
 
 // BlobMediaService implements MediaService interface using blob storage.
 // It manages media data and metadata in separate blob repositories and maintains
 // backreferences to efficiently de-duplicate shared content.
+// An optional metadata index (see SetIndex) answers listings without scanning the metadata blobs.
+//
+//nolint:recvcheck
 type BlobMediaService struct {
 	dataRepo    blob.Repository
 	metaRepo    blob.Repository
 	backrefRepo blob.Repository
+	usageRepo   blob.Repository
+	changesRepo blob.Repository
+	index       metaindex.Index
+	clock       clock.Clock
 	cfg         MediaConfig
 	log         logging.Logger
 }
@@ -27,10 +40,12 @@ type BlobMediaService struct {
 var _ MediaService = (*BlobMediaService)(nil)
 
 // NewBlobMediaService creates a new BlobMediaService with the given configuration.
-// It initializes three blob repositories:
+// It initializes five blob repositories:
 // - data: for storing actual media content
 // - meta: for storing media metadata
 // - backref: for managing references to shared content
+// - usage: for accounting downloads per user and period
+// - changes: for numbering the changes of the media of each user
 // Returns an error if any repository initialization fails.
 func NewBlobMediaService(
 	ctx context.Context,
@@ -54,20 +69,342 @@ func NewBlobMediaService(
 		return nil, fmt.Errorf("new meta repository: %w", err)
 	}
 
+	usageRepo, err := repoFactory(ctx, "usage", "json")
+	if err != nil {
+		return nil, fmt.Errorf("new usage repository: %w", err)
+	}
+
+	changesRepo, err := repoFactory(ctx, "changes", "json")
+	if err != nil {
+		return nil, fmt.Errorf("new changes repository: %w", err)
+	}
+
 	return &BlobMediaService{
 		dataRepo:    dataRepo,
 		metaRepo:    metaRepo,
 		backrefRepo: backrefRepo,
+		usageRepo:   usageRepo,
+		changesRepo: changesRepo,
+		index:       nil,
+		clock:       clock.Real{},
 		cfg:         cfg,
 		log:         log,
 	}, nil
 }
 
+// SetClock sets the clock timestamping stored media and selecting the accounting period of
+// downloads, e.g. a fake clock in tests. Defaults to the system clock.
+func (mediaSvc *BlobMediaService) SetClock(clk clock.Clock) {
+	mediaSvc.clock = clk
+}
+
 // MaxSize implements MediaService.MaxSize.
 func (mediaSvc BlobMediaService) MaxSize() int64 {
 	return mediaSvc.cfg.MaxSize
 }
 
+// Exists implements MediaService.Exists.
+func (mediaSvc BlobMediaService) Exists(ctx context.Context, mediaID domain.MediaID) bool {
+	return mediaSvc.metaRepo.Exists(ctx, mediaID)
+}
+
+// DataExists implements MediaService.DataExists.
+func (mediaSvc BlobMediaService) DataExists(ctx context.Context, hash string) bool {
+	return mediaSvc.dataRepo.Exists(ctx, domain.BlobID(hash))
+}
+
+// FindByHash implements MediaService.FindByHash.
+func (mediaSvc BlobMediaService) FindByHash(ctx context.Context, hash string) (metas []domain.MediaMeta, err error) {
+	log := mediaSvc.log.With(logging.Group("media", "hash", hash))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media find-by-hash failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media found by hash", "count", len(metas))
+		}
+	}()
+
+	username, ok := context_.UsernameFromContext(ctx)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("%w: no user", domain.ErrUnauthorized)
+	}
+
+	if mediaSvc.index != nil {
+		metas, err := mediaSvc.index.FindByHash(ctx, username, hash)
+		if err != nil {
+			return nil, fmt.Errorf("index find by hash: %w", err)
+		}
+
+		return metas, nil
+	}
+
+	// Media processed on ingest is stored under the hash of its processed content,
+	// so it is found by its original hash among all media of the user
+	listed, err := mediaSvc.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list: %w", err)
+	}
+
+	for _, mediaMeta := range listed {
+		if mediaMeta.OriginalHash == hash {
+			metas = append(metas, mediaMeta)
+		}
+	}
+
+	// Lock data blob, so its backrefs are consistent
+	unlockData, err := mediaSvc.dataRepo.Lock(ctx, domain.BlobID(hash), false)
+	if err != nil {
+		return nil, fmt.Errorf("lock data: %w", err)
+	}
+	defer unlockData()
+
+	backrefs, err := mediaSvc.fetchBackrefs(ctx, domain.BlobID(hash))
+	if err != nil {
+		return nil, fmt.Errorf("fetch backrefs: %w", err)
+	}
+
+	for _, metaID := range backrefs {
+		if metaID == "" || !mediaSvc.metaRepo.Exists(ctx, metaID) {
+			continue
+		}
+
+		mediaMeta, err := mediaSvc.fetchMeta(ctx, metaID)
+		if err != nil {
+			return nil, fmt.Errorf("fetch meta: %w", err)
+		}
+
+		if mediaMeta.Owner == username {
+			metas = append(metas, mediaMeta)
+		}
+	}
+
+	return metas, nil
+}
+
+// List implements MediaService.List.
+func (mediaSvc BlobMediaService) List(ctx context.Context) (metas []domain.MediaMeta, err error) {
+	log := mediaSvc.log
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media list failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media listed", "count", len(metas))
+		}
+	}()
+
+	username, ok := context_.UsernameFromContext(ctx)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("%w: no user", domain.ErrUnauthorized)
+	}
+
+	log = log.With(logging.Group("user", "name", username))
+
+	if mediaSvc.index != nil {
+		metas, err := mediaSvc.index.ListByOwner(ctx, username)
+		if err != nil {
+			return nil, fmt.Errorf("index list: %w", err)
+		}
+
+		return metas, nil
+	}
+
+	metaIDs, err := mediaSvc.metaRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list meta: %w", err)
+	}
+
+	for _, metaID := range metaIDs {
+		mediaMeta, err := mediaSvc.fetchMetaLocked(ctx, metaID)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted while listing
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("fetch meta: %w", err)
+		}
+
+		if mediaMeta.Owner == username {
+			metas = append(metas, mediaMeta)
+		}
+	}
+
+	return metas, nil
+}
+
+// ListPage implements MediaService.ListPage.
+// Without an index, all metadata blobs are scanned for every page.
+func (mediaSvc BlobMediaService) ListPage(
+	ctx context.Context,
+	after domain.MediaPosition,
+	limit int,
+) ([]domain.MediaMeta, error) {
+	if mediaSvc.index == nil {
+		metas, err := mediaSvc.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		slices.SortFunc(metas, func(a, b domain.MediaMeta) int {
+			return compareMediaPosition(mediaPosition(a), mediaPosition(b))
+		})
+		metas = slices.DeleteFunc(metas, func(meta domain.MediaMeta) bool {
+			return compareMediaPosition(mediaPosition(meta), after) <= 0
+		})
+
+		return metas[:min(limit, len(metas))], nil
+	}
+
+	username, ok := context_.UsernameFromContext(ctx)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("%w: no user", domain.ErrUnauthorized)
+	}
+
+	metas, err := mediaSvc.index.ListPageByOwner(ctx, username, after, limit)
+	if err != nil {
+		mediaSvc.log.ErrorContext(ctx, "media list page failed", logging.Group("user", "name", username), "error", err)
+
+		return nil, fmt.Errorf("index list page: %w", err)
+	}
+
+	return metas, nil
+}
+
+// mediaPosition returns the position of the media in the listing of ListPage.
+func mediaPosition(meta domain.MediaMeta) domain.MediaPosition {
+	return domain.MediaPosition{Modified: meta.Modified, ID: meta.ID}
+}
+
+// compareMediaPosition orders positions by storage time and ID, as listed by ListPage.
+func compareMediaPosition(a, b domain.MediaPosition) int {
+	return cmp.Or(cmp.Compare(a.Modified, b.Modified), cmp.Compare(a.ID, b.ID))
+}
+
+// ListLocated implements MediaService.ListLocated.
+func (mediaSvc BlobMediaService) ListLocated(ctx context.Context) ([]domain.MediaMeta, error) {
+	if mediaSvc.index == nil {
+		metas, err := mediaSvc.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return slices.DeleteFunc(metas, func(meta domain.MediaMeta) bool { return meta.Location == nil }), nil
+	}
+
+	username, ok := context_.UsernameFromContext(ctx)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("%w: no user", domain.ErrUnauthorized)
+	}
+
+	metas, err := mediaSvc.index.ListLocated(ctx, username)
+	if err != nil {
+		mediaSvc.log.ErrorContext(ctx, "media list located failed", logging.Group("user", "name", username), "error", err)
+
+		return nil, fmt.Errorf("index list located: %w", err)
+	}
+
+	return metas, nil
+}
+
+// ListAll implements MediaService.ListAll.
+func (mediaSvc BlobMediaService) ListAll(ctx context.Context) (metas []domain.MediaMeta, err error) {
+	defer func() {
+		if err != nil {
+			mediaSvc.log.ErrorContext(ctx, "media list all failed", "error", err)
+		} else {
+			mediaSvc.log.DebugContext(ctx, "all media listed", "count", len(metas))
+		}
+	}()
+
+	if !context_.HasAdminAccess(ctx) {
+		return nil, fmt.Errorf("%w: no admin access", domain.ErrUnauthorized)
+	}
+
+	metaIDs, err := mediaSvc.metaRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list meta: %w", err)
+	}
+
+	for _, metaID := range metaIDs {
+		mediaMeta, err := mediaSvc.fetchMetaLocked(ctx, metaID)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted while listing
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("fetch meta: %w", err)
+		}
+
+		metas = append(metas, mediaMeta)
+	}
+
+	return metas, nil
+}
+
+// UpdateMeta implements MediaService.UpdateMeta.
+func (mediaSvc BlobMediaService) UpdateMeta(ctx context.Context, mediaMeta domain.MediaMeta) (err error) {
+	log := mediaSvc.log.With(logging.Group("media", "id", mediaMeta.ID))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media meta update failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media meta updated")
+		}
+	}()
+
+	unlockMeta, err := mediaSvc.metaRepo.Lock(ctx, mediaMeta.ID, true)
+	if err != nil {
+		return fmt.Errorf("lock meta: %w", err)
+	}
+	defer unlockMeta()
+
+	existing, err := mediaSvc.fetchMeta(ctx, mediaMeta.ID)
+	if err != nil {
+		return fmt.Errorf("fetch meta: %w", err)
+	}
+
+	if username, _ := context_.UsernameFromContext(ctx); username != existing.Owner {
+		return fmt.Errorf("%w: user %q is not owner %q", domain.ErrUnauthorized, username, existing.Owner)
+	}
+
+	// The ID is derived from these fields, so they cannot change without storing new media
+	if mediaMeta.Hash != existing.Hash || mediaMeta.Filename != existing.Filename ||
+		mediaMeta.MIMEType != existing.MIMEType || mediaMeta.Owner != existing.Owner {
+		return fmt.Errorf("%w: content, name, type or owner changed", ErrMetaIdentityChanged)
+	}
+
+	mediaMeta.Size = existing.Size
+	mediaMeta.Modified = mediaSvc.clock.Now().UnixMilli()
+
+	return mediaSvc.commitChange(ctx, existing.Owner, "", func(seq int64) error {
+		mediaMeta.Seq = seq
+
+		metaBlob, err := mediaMeta.AsBlob()
+		if err != nil {
+			return fmt.Errorf("convert meta to blob: %w", err)
+		}
+
+		if err := mediaSvc.metaRepo.Store(ctx, metaBlob); err != nil {
+			return fmt.Errorf("store meta: %w", err)
+		}
+
+		mediaSvc.indexPut(ctx, mediaMeta)
+
+		return nil
+	})
+}
+
+// fetchMetaLocked fetches the metadata of the specified media under a shared lock.
+func (mediaSvc BlobMediaService) fetchMetaLocked(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error) {
+	unlockMeta, err := mediaSvc.metaRepo.Lock(ctx, mediaID, false)
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("lock meta: %w", err)
+	}
+	defer unlockMeta()
+
+	return mediaSvc.fetchMeta(ctx, mediaID)
+}
+
 // Lock implements MediaService.Lock.
 func (mediaSvc BlobMediaService) Lock(ctx context.Context, mediaID domain.MediaID) (unlock func(), err error) {
 	log := mediaSvc.log.With(logging.Group("media", "id", mediaID))
@@ -91,17 +428,58 @@ func (mediaSvc BlobMediaService) Lock(ctx context.Context, mediaID domain.MediaI
 	}, nil
 }
 
-// Store implements MediaService.Store.
-//
-//nolint:cyclop
+// Store implements MediaService.Store. The meta and data blobs are locked exclusively, so
+// concurrent uploads of the same media are serialized and all but the first find it stored.
 func (mediaSvc BlobMediaService) Store(
 	ctx context.Context,
 	media domain.Media,
+) error {
+	return mediaSvc.store(ctx, media.Meta(), func(domain.BlobID) error {
+		return mediaSvc.dataRepo.Store(ctx, media.AsBlob()) //nolint:wrapcheck
+	})
+}
+
+// StoreFrom implements MediaService.StoreFrom. The content is hashed while it is streamed to
+// the data repository, and removed again if it does not match the content hash of meta.
+func (mediaSvc BlobMediaService) StoreFrom(
+	ctx context.Context,
+	meta domain.MediaMeta,
+	content io.Reader,
+) error {
+	return mediaSvc.store(ctx, meta, func(dataID domain.BlobID) error {
+		// One more byte than expected is read to tell whether the content is larger
+		hasher := domain.NewContentHasher()
+
+		n, err := mediaSvc.dataRepo.StoreFrom(ctx, dataID, io.TeeReader(io.LimitReader(content, meta.Size+1), hasher))
+		if err != nil {
+			return fmt.Errorf("stream: %w", err)
+		}
+
+		if n != meta.Size || hasher.Hash() != meta.Hash {
+			if err := mediaSvc.dataRepo.Delete(ctx, dataID); err != nil {
+				return fmt.Errorf("delete mismatched data: %w", err)
+			}
+
+			return fmt.Errorf("%w: got %d bytes hashed %s, want %d bytes hashed %s",
+				domain.ErrContentMismatch, n, hasher.Hash(), meta.Size, meta.Hash)
+		}
+
+		return nil
+	})
+}
+
+// store stores the given media metadata, storing its content by storeData unless it is stored already.
+//
+//nolint:cyclop
+func (mediaSvc BlobMediaService) store(
+	ctx context.Context,
+	mediaMeta domain.MediaMeta,
+	storeData func(dataID domain.BlobID) error,
 ) (err error) {
 	log := mediaSvc.log.With(logging.Group("media",
-		"id", media.ID(),
-		"size", media.Size(),
-		"type", media.MIMEType(),
+		"id", mediaMeta.ID,
+		"size", mediaMeta.Size,
+		"type", mediaMeta.MIMEType,
 	))
 
 	defer func() {
@@ -112,12 +490,14 @@ func (mediaSvc BlobMediaService) Store(
 		}
 	}()
 
-	if media.Size() > mediaSvc.cfg.MaxSize {
-		return fmt.Errorf("%w: %d exceeds %d", domain.ErrMediaTooLarge, media.Size(), mediaSvc.cfg.MaxSize)
+	if mediaMeta.Size > mediaSvc.cfg.MaxSize {
+		return fmt.Errorf("%w: %d exceeds %d", domain.ErrMediaTooLarge, mediaMeta.Size, mediaSvc.cfg.MaxSize)
 	}
 
 	// Lock meta blob
-	metaBlob, err := media.Meta().AsBlob()
+	mediaMeta.Modified = mediaSvc.clock.Now().UnixMilli()
+
+	metaBlob, err := mediaMeta.AsBlob()
 	if err != nil {
 		return fmt.Errorf("convert meta to blob: %w", err)
 	}
@@ -129,40 +509,67 @@ func (mediaSvc BlobMediaService) Store(
 	defer unlockMeta()
 
 	// Lock data blob
-	dataBlob := media.AsBlob()
+	dataID := domain.BlobID(mediaMeta.Hash)
 
-	unlockData, err := mediaSvc.dataRepo.Lock(ctx, dataBlob.ID, true)
+	unlockData, err := mediaSvc.dataRepo.Lock(ctx, dataID, true)
 	if err != nil {
 		return fmt.Errorf("lock data: %w", err)
 	}
 	defer unlockData()
 
 	// Store data
-	if !mediaSvc.dataRepo.Exists(ctx, dataBlob.ID) {
-		if err := mediaSvc.dataRepo.Store(ctx, dataBlob); err != nil {
+	if !mediaSvc.dataRepo.Exists(ctx, dataID) {
+		if err := storeData(dataID); err != nil {
 			return fmt.Errorf("store data: %w", err)
 		}
 	}
 
-	// Store meta and add backrefs
-	if !mediaSvc.metaRepo.Exists(ctx, metaBlob.ID) {
+	// Media with the same ID has the same content, name, type and owner, e.g. if it was
+	// uploaded twice concurrently, so the existing meta is kept and merely repaired.
+	if mediaSvc.metaRepo.Exists(ctx, metaBlob.ID) {
+		existing, err := mediaSvc.fetchMeta(ctx, mediaMeta.ID)
+		if err != nil {
+			return fmt.Errorf("fetch existing meta: %w", err)
+		}
+
+		if err := mediaSvc.addBackrefs(ctx, dataID, metaBlob.ID); err != nil {
+			return fmt.Errorf("add backrefs: %w", err)
+		}
+
+		mediaSvc.indexPut(ctx, existing)
+		log.DebugContext(ctx, "media already stored", "modified", existing.Modified)
+
+		return nil
+	}
+
+	// Store meta and add backrefs as a numbered change
+	return mediaSvc.commitChange(ctx, mediaMeta.Owner, "", func(seq int64) error {
+		mediaMeta.Seq = seq
+
+		metaBlob, err := mediaMeta.AsBlob()
+		if err != nil {
+			return fmt.Errorf("convert meta to blob: %w", err)
+		}
+
 		if err := mediaSvc.metaRepo.Store(ctx, metaBlob); err != nil {
 			return fmt.Errorf("store meta: %w", err)
 		}
 
-		if err := mediaSvc.addBackrefs(ctx, dataBlob.ID, metaBlob.ID); err != nil {
+		if err := mediaSvc.addBackrefs(ctx, dataID, metaBlob.ID); err != nil {
 			return fmt.Errorf("add backrefs: %w", err)
 		}
-	}
 
-	return nil
+		mediaSvc.indexPut(ctx, mediaMeta)
+
+		return nil
+	})
 }
 
 // Delete implements MediaService.Delete.
 func (mediaSvc BlobMediaService) Delete(
 	ctx context.Context,
 	mediaID domain.MediaID,
-) (prune bool, dataID domain.BlobID, err error) {
+) (result DeleteResult, err error) {
 	log := mediaSvc.log.With(logging.Group("media", "id", mediaID))
 
 	defer func() {
@@ -176,20 +583,20 @@ func (mediaSvc BlobMediaService) Delete(
 	// Lock meta blob
 	unlockMeta, err := mediaSvc.metaRepo.Lock(ctx, mediaID, false)
 	if err != nil {
-		return false, domain.BlobID(""), fmt.Errorf("lock meta: %w", err)
+		return DeleteResult{}, fmt.Errorf("lock meta: %w", err)
 	}
 	defer unlockMeta()
 
 	// Fetch meta
 	mediaMeta, err := mediaSvc.fetchMeta(ctx, mediaID)
 	if err != nil {
-		return false, domain.BlobID(""), fmt.Errorf("fetch meta: %w", err)
+		return DeleteResult{}, fmt.Errorf("fetch meta: %w", err)
 	}
 
-	dataID = domain.BlobID(mediaMeta.Hash)
+	result = DeleteResult{Pruned: false, DataID: domain.BlobID(mediaMeta.Hash), MetaID: mediaID}
 
 	log = log.With(logging.Group("media",
-		"dataID", dataID,
+		"dataID", result.DataID,
 		"size", mediaMeta.Size,
 		"type", mediaMeta.MIMEType,
 		"filename", mediaMeta.Filename,
@@ -197,32 +604,47 @@ func (mediaSvc BlobMediaService) Delete(
 		"owner", mediaMeta.Owner,
 	))
 
-	// Authorize access
+	// Authorize access, either as owner or as administrator
 	username, ok := context_.UsernameFromContext(ctx)
 	if !ok || strings.Compare(username, mediaMeta.Owner) != 0 {
-		return false, domain.BlobID(""), fmt.Errorf("%w: user %q is not owner %q",
-			domain.ErrUnauthorized, username, mediaMeta.Owner)
+		if !context_.HasAdminAccess(ctx) {
+			return DeleteResult{}, fmt.Errorf("%w: user %q is not owner %q",
+				domain.ErrUnauthorized, username, mediaMeta.Owner)
+		}
+
+		log.InfoContext(ctx, "deleting media of other user as admin", "admin", username)
 	}
 
 	// Lock data blob
 	unlockData, err := mediaSvc.dataRepo.Lock(ctx, domain.BlobID(mediaMeta.Hash), true)
 	if err != nil {
-		return false, dataID, fmt.Errorf("lock data: %w", err)
+		return result, fmt.Errorf("lock data: %w", err)
 	}
 	defer unlockData()
 
 	// Update backrefs or delete blob
 	pruned, err := mediaSvc.pruneMedia(ctx, mediaMeta)
 	if err != nil {
-		return false, dataID, fmt.Errorf("prune media: %w", err)
+		return result, fmt.Errorf("prune media: %w", err)
 	}
 
-	// Delete meta
-	if err := mediaSvc.metaRepo.Delete(ctx, mediaID); err != nil {
-		return pruned, dataID, fmt.Errorf("delete meta: %w", err)
+	result.Pruned = pruned
+	log = log.With(logging.Group("media", "pruned", pruned))
+
+	// Delete meta as a numbered change
+	if err := mediaSvc.commitChange(ctx, mediaMeta.Owner, mediaID, func(int64) error {
+		if err := mediaSvc.metaRepo.Delete(ctx, mediaID); err != nil {
+			return fmt.Errorf("delete meta: %w", err)
+		}
+
+		mediaSvc.indexDelete(ctx, mediaID)
+
+		return nil
+	}); err != nil {
+		return result, err
 	}
 
-	return pruned, dataID, nil
+	return result, nil
 }
 
 // Fetch implements MediaService.Fetch.
@@ -249,15 +671,9 @@ func (mediaSvc BlobMediaService) Fetch(
 	}
 	defer unlockMeta()
 
-	// Fetch meta blob
-	metaBlob, err := mediaSvc.metaRepo.Fetch(ctx, mediaID)
-	if err != nil {
-		return domain.Media{}, fmt.Errorf("fetch meta: %w", err)
-	}
-
-	mediaMeta, err := domain.NewMediaMetaFromBlob(metaBlob)
+	mediaMeta, err := mediaSvc.authorizedMeta(ctx, mediaID)
 	if err != nil {
-		return domain.Media{}, fmt.Errorf("convert meta blob: %w", err)
+		return domain.Media{}, err
 	}
 
 	log = log.With(logging.Group("media",
@@ -268,12 +684,6 @@ func (mediaSvc BlobMediaService) Fetch(
 		"owner", mediaMeta.Owner,
 	))
 
-	// Authorize access
-	username, ok := context_.UsernameFromContext(ctx)
-	if !ok || strings.Compare(username, mediaMeta.Owner) != 0 {
-		return domain.Media{}, fmt.Errorf("%w: user %q is not owner %q", domain.ErrUnauthorized, username, mediaMeta.Owner)
-	}
-
 	// Lock data blob
 	unlockData, err := mediaSvc.dataRepo.Lock(ctx, domain.BlobID(mediaMeta.Hash), false)
 	if err != nil {
@@ -396,7 +806,20 @@ func (mediaSvc BlobMediaService) addBackrefs(
 		return fmt.Errorf("fetch backrefs: %w", err)
 	}
 
-	backrefs = append(backrefs, metaIDs...)
+	// Adding a backref is idempotent, so storing the same media again repairs missing backrefs
+	// without duplicating existing ones
+	added := false
+
+	for _, metaID := range metaIDs {
+		if !slices.Contains(backrefs, metaID) {
+			backrefs = append(backrefs, metaID)
+			added = true
+		}
+	}
+
+	if !added {
+		return nil
+	}
 
 	if err := mediaSvc.storeBackrefs(ctx, dataID, backrefs); err != nil {
 		return fmt.Errorf("store backrefs: %w", err)
@@ -445,3 +868,34 @@ func (mediaSvc BlobMediaService) pruneMedia(ctx context.Context, mediaMeta domai
 
 	return false, nil
 }
+
+// FetchMeta implements MediaService.FetchMeta.
+func (mediaSvc BlobMediaService) FetchMeta(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error) {
+	unlockMeta, err := mediaSvc.metaRepo.Lock(ctx, mediaID, false)
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("lock meta: %w", err)
+	}
+	defer unlockMeta()
+
+	return mediaSvc.authorizedMeta(ctx, mediaID)
+}
+
+// authorizedMeta fetches the metadata of the media, granting access to the owner, to the users
+// the media is shared with or its visibility admits, and to contexts holding a grant for the media.
+// The caller must hold a lock on the meta blob.
+func (mediaSvc BlobMediaService) authorizedMeta(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error) {
+	mediaMeta, err := mediaSvc.fetchMeta(ctx, mediaID)
+	if err != nil {
+		return domain.MediaMeta{}, err
+	}
+
+	// Authorize access, either per the visibility and share list or by a grant for this media
+	username, _ := context_.UsernameFromContext(ctx)
+	shareToken, _ := context_.ShareTokenFromContext(ctx)
+
+	if !mayAccess(mediaMeta, username, shareToken) && !context_.HasGrant(ctx, string(mediaID)) {
+		return domain.MediaMeta{}, fmt.Errorf("%w: user %q is not owner %q", domain.ErrUnauthorized, username, mediaMeta.Owner)
+	}
+
+	return mediaMeta, nil
+}
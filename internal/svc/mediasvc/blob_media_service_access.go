@@ -0,0 +1,155 @@
+package mediasvc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"slices"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// shareTokenSize is the number of random bytes of share tokens.
+const shareTokenSize = 20
+
+// SetVisibility implements MediaService.SetVisibility.
+// Media set to unlisted is issued a random share token, which is kept while it stays unlisted
+// and revoked when it is set to another visibility.
+
+func (mediaSvc BlobMediaService) SetVisibility(
+	ctx context.Context,
+	mediaID domain.MediaID,
+	visibility domain.MediaVisibility,
+) (domain.MediaMeta, error) {
+	if !visibility.Valid() {
+		return domain.MediaMeta{}, fmt.Errorf("%w: %q", domain.ErrInvalidVisibility, visibility)
+	}
+
+	return mediaSvc.updateAccess(ctx, mediaID, func(mediaMeta *domain.MediaMeta) error {
+		mediaMeta.Visibility = visibility
+
+		if visibility != domain.VisibilityUnlisted {
+			mediaMeta.ShareToken = ""
+		} else if mediaMeta.ShareToken == "" {
+			token := make([]byte, shareTokenSize)
+			if _, err := rand.Read(token); err != nil {
+				return fmt.Errorf("read random share token: %w", err)
+			}
+
+			mediaMeta.ShareToken = encoding.EncodeCrockfordB32LC(token)
+		}
+
+		return nil
+	})
+}
+
+// Share implements MediaService.Share.
+func (mediaSvc BlobMediaService) Share(
+	ctx context.Context,
+	mediaID domain.MediaID,
+	username string,
+) (domain.MediaMeta, error) {
+	return mediaSvc.updateAccess(ctx, mediaID, func(mediaMeta *domain.MediaMeta) error {
+		if username == "" || username == mediaMeta.Owner {
+			return fmt.Errorf("%w: %q", domain.ErrInvalidShareUser, username)
+		}
+
+		if !slices.Contains(mediaMeta.SharedWith, username) {
+			mediaMeta.SharedWith = append(mediaMeta.SharedWith, username)
+			slices.Sort(mediaMeta.SharedWith)
+		}
+
+		return nil
+	})
+}
+
+// Unshare implements MediaService.Unshare.
+func (mediaSvc BlobMediaService) Unshare(
+	ctx context.Context,
+	mediaID domain.MediaID,
+	username string,
+) (domain.MediaMeta, error) {
+	return mediaSvc.updateAccess(ctx, mediaID, func(mediaMeta *domain.MediaMeta) error {
+		mediaMeta.SharedWith = slices.DeleteFunc(mediaMeta.SharedWith, func(shared string) bool {
+			return shared == username
+		})
+
+		return nil
+	})
+}
+
+// updateAccess applies update to the metadata of the media, which only its owner may do.
+// Unlike UpdateMeta, the storage time is kept, as the media itself is unchanged.
+// Returns the updated metadata.
+func (mediaSvc BlobMediaService) updateAccess(
+	ctx context.Context,
+	mediaID domain.MediaID,
+	update func(mediaMeta *domain.MediaMeta) error,
+) (mediaMeta domain.MediaMeta, err error) {
+	log := mediaSvc.log.With(logging.Group("media", "id", mediaID))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media access update failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "media access updated",
+				logging.Group("media", "visibility", mediaMeta.Visibility, "shared_with", mediaMeta.SharedWith))
+		}
+	}()
+
+	unlockMeta, err := mediaSvc.metaRepo.Lock(ctx, mediaID, true)
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("lock meta: %w", err)
+	}
+	defer unlockMeta()
+
+	mediaMeta, err = mediaSvc.fetchMeta(ctx, mediaID)
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("fetch meta: %w", err)
+	}
+
+	if username, _ := context_.UsernameFromContext(ctx); username != mediaMeta.Owner {
+		return domain.MediaMeta{}, fmt.Errorf("%w: user %q is not owner %q", domain.ErrUnauthorized, username, mediaMeta.Owner)
+	}
+
+	if err := update(&mediaMeta); err != nil {
+		return domain.MediaMeta{}, err
+	}
+
+	metaBlob, err := mediaMeta.AsBlob()
+	if err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("convert meta to blob: %w", err)
+	}
+
+	if err := mediaSvc.metaRepo.Store(ctx, metaBlob); err != nil {
+		return domain.MediaMeta{}, fmt.Errorf("store meta: %w", err)
+	}
+
+	mediaSvc.indexPut(ctx, mediaMeta)
+
+	return mediaMeta, nil
+}
+
+// mayAccess reports whether the user may access the media per its visibility and share list,
+// presenting the given share token. An empty username denotes an anonymous request.
+func mayAccess(mediaMeta domain.MediaMeta, username, shareToken string) bool {
+	if username != "" && (username == mediaMeta.Owner || slices.Contains(mediaMeta.SharedWith, username)) {
+		return true
+	}
+
+	switch mediaMeta.EffectiveVisibility() {
+	case domain.VisibilityPublic:
+		return true
+	case domain.VisibilityUnlisted:
+		return username != "" && mediaMeta.ShareToken != "" &&
+			subtle.ConstantTimeCompare([]byte(shareToken), []byte(mediaMeta.ShareToken)) == 1
+	case domain.VisibilityPrivate:
+		return false
+	default:
+		return false
+	}
+}
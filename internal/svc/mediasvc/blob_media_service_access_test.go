@@ -0,0 +1,191 @@
+package mediasvc_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+)
+
+func TestBlobMediaService_Access(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		visibility domain.MediaVisibility
+		shareWith  string
+		username   string
+		shareToken string // Share token presented, "issued" for the token issued by SetVisibility
+		want       bool
+	}{
+		{name: "owner", visibility: domain.VisibilityPrivate, username: "alice", want: true},
+		{name: "private", visibility: domain.VisibilityPrivate, username: "bob"},
+		{name: "private anonymous", visibility: domain.VisibilityPrivate},
+		{name: "shared", visibility: domain.VisibilityPrivate, shareWith: "bob", username: "bob", want: true},
+		{name: "shared with other user", visibility: domain.VisibilityPrivate, shareWith: "carol", username: "bob"},
+		{name: "unlisted", visibility: domain.VisibilityUnlisted, username: "bob", shareToken: "issued", want: true},
+		{name: "unlisted without token", visibility: domain.VisibilityUnlisted, username: "bob"},
+		{name: "unlisted with wrong token", visibility: domain.VisibilityUnlisted, username: "bob", shareToken: "guessed"},
+		{name: "unlisted anonymous", visibility: domain.VisibilityUnlisted, shareToken: "issued"},
+		{name: "public", visibility: domain.VisibilityPublic, username: "bob", want: true},
+		{name: "public anonymous", visibility: domain.VisibilityPublic, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, _, _, _ := setupMediaService(t)
+			ctx := context_.WithUsername(context.Background(), "alice")
+
+			media := domain.NewMedia([]byte("test data"), domain.MediaMeta{
+				Filename: "test.txt", MIMEType: "text/plain", Owner: "alice",
+			})
+			if err := svc.Store(ctx, media); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			meta, err := svc.SetVisibility(ctx, media.ID(), tt.visibility)
+			if err != nil {
+				t.Fatalf("SetVisibility() error = %v", err)
+			}
+
+			if tt.shareWith != "" {
+				if _, err := svc.Share(ctx, media.ID(), tt.shareWith); err != nil {
+					t.Fatalf("Share() error = %v", err)
+				}
+			}
+
+			fetchCtx := context.Background()
+			if tt.username != "" {
+				fetchCtx = context_.WithUsername(fetchCtx, tt.username)
+			}
+
+			switch tt.shareToken {
+			case "":
+			case "issued":
+				fetchCtx = context_.WithShareToken(fetchCtx, meta.ShareToken)
+			default:
+				fetchCtx = context_.WithShareToken(fetchCtx, tt.shareToken)
+			}
+
+			_, err = svc.Fetch(fetchCtx, media.ID())
+			if got := err == nil; got != tt.want {
+				t.Fatalf("Fetch() error = %v, want access %t", err, tt.want)
+			}
+
+			if !tt.want && !errors.Is(err, domain.ErrUnauthorized) {
+				t.Errorf("Fetch() error = %v, want %v", err, domain.ErrUnauthorized)
+			}
+		})
+	}
+}
+
+func TestBlobMediaService_UpdateAccess(t *testing.T) {
+	t.Parallel()
+
+	svc, _, _, _ := setupMediaService(t)
+	ctx := context_.WithUsername(context.Background(), "alice")
+
+	media := domain.NewMedia([]byte("test data"), domain.MediaMeta{
+		Filename: "test.txt", MIMEType: "text/plain", Owner: "alice",
+	})
+	if err := svc.Store(ctx, media); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	stored, err := svc.FetchMeta(ctx, media.ID())
+	if err != nil {
+		t.Fatalf("FetchMeta() error = %v", err)
+	}
+
+	for _, username := range []string{"carol", "bob", "carol"} {
+		if _, err := svc.Share(ctx, media.ID(), username); err != nil {
+			t.Fatalf("Share(%q) error = %v", username, err)
+		}
+	}
+
+	meta, err := svc.Unshare(ctx, media.ID(), "carol")
+	if err != nil {
+		t.Fatalf("Unshare() error = %v", err)
+	}
+
+	if want := []string{"bob"}; !slices.Equal(meta.SharedWith, want) {
+		t.Errorf("SharedWith = %v, want %v", meta.SharedWith, want)
+	}
+
+	if meta.Modified != stored.Modified {
+		t.Errorf("Modified = %d, want unchanged %d", meta.Modified, stored.Modified)
+	}
+
+	// Unlisted media is issued a share token, kept while unlisted and revoked otherwise
+	unlisted, err := svc.SetVisibility(ctx, media.ID(), domain.VisibilityUnlisted)
+	if err != nil || len(unlisted.ShareToken) < 32 {
+		t.Fatalf("SetVisibility(unlisted) = %+v, %v, want share token", unlisted, err)
+	}
+
+	if again, err := svc.SetVisibility(ctx, media.ID(), domain.VisibilityUnlisted); err != nil || again.ShareToken != unlisted.ShareToken {
+		t.Errorf("SetVisibility(unlisted) again: share token = %q, %v, want %q", again.ShareToken, err, unlisted.ShareToken)
+	}
+
+	if private, err := svc.SetVisibility(ctx, media.ID(), domain.VisibilityPrivate); err != nil || private.ShareToken != "" {
+		t.Errorf("SetVisibility(private): share token = %q, %v, want revoked", private.ShareToken, err)
+	}
+
+	if reissued, err := svc.SetVisibility(ctx, media.ID(), domain.VisibilityUnlisted); err != nil ||
+		reissued.ShareToken == "" || reissued.ShareToken == unlisted.ShareToken {
+		t.Errorf("SetVisibility(unlisted) after revocation: share token = %q, %v, want new token", reissued.ShareToken, err)
+	}
+
+	tests := []struct {
+		name    string
+		update  func() error
+		wantErr error
+	}{
+		{
+			name: "invalid visibility",
+			update: func() error {
+				_, err := svc.SetVisibility(ctx, media.ID(), "friends")
+				return err
+			},
+			wantErr: domain.ErrInvalidVisibility,
+		},
+		{
+			name: "share with owner",
+			update: func() error {
+				_, err := svc.Share(ctx, media.ID(), "alice")
+				return err
+			},
+			wantErr: domain.ErrInvalidShareUser,
+		},
+		{
+			name: "share with empty username",
+			update: func() error {
+				_, err := svc.Share(ctx, media.ID(), "")
+				return err
+			},
+			wantErr: domain.ErrInvalidShareUser,
+		},
+		{
+			name: "not owner",
+			update: func() error {
+				_, err := svc.SetVisibility(context_.WithUsername(context.Background(), "bob"), media.ID(), domain.VisibilityPublic)
+				return err
+			},
+			wantErr: domain.ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.update(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package mediasvc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// mediaChangeLog numbers the changes of the media of a user. Stored and updated media carry the
+// number of their latest change (see domain.MediaMeta.Seq), deleted media are kept as deletions.
+type mediaChangeLog struct {
+	Seq       int64      `json:"seq"`                 // Number of the latest change
+	Pruned    int64      `json:"pruned,omitempty"`    // Number of the latest deletion no longer kept
+	Deletions []deletion `json:"deletions,omitempty"` // Kept deletions, ordered by number
+}
+
+// deletion is a deletion of media in a change log.
+type deletion struct {
+	Seq int64          `json:"seq"`
+	ID  domain.MediaID `json:"id"`
+}
+
+// ListChanges implements MediaService.ListChanges.
+func (mediaSvc BlobMediaService) ListChanges(ctx context.Context, since int64) (changes domain.MediaChanges, err error) {
+	log := mediaSvc.log.With(logging.Group("changes", "since", since))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media changes list failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "media changes listed",
+				"seq", changes.Seq, "changed", len(changes.Changed), "deleted", len(changes.Deleted))
+		}
+	}()
+
+	username, ok := context_.UsernameFromContext(ctx)
+	if !ok || username == "" {
+		return domain.MediaChanges{}, fmt.Errorf("%w: no user", domain.ErrUnauthorized)
+	}
+
+	// Changes are numbered once committed, so all media changed up to the current number are
+	// listed. Media changed while listing carry later numbers and are left to the next listing.
+	changeLog, err := mediaSvc.fetchChangeLogLocked(ctx, username)
+	if err != nil {
+		return domain.MediaChanges{}, err
+	}
+
+	if since < 0 || since > changeLog.Seq || (since > 0 && since < changeLog.Pruned) {
+		return domain.MediaChanges{}, fmt.Errorf("%w: %d not in %d..%d",
+			domain.ErrChangesExpired, since, changeLog.Pruned, changeLog.Seq)
+	}
+
+	metas, err := mediaSvc.List(ctx)
+	if err != nil {
+		return domain.MediaChanges{}, err
+	}
+
+	changes = domain.MediaChanges{Seq: changeLog.Seq, Changed: nil, Deleted: nil}
+
+	// Without a number, all media are listed, including media stored before changes were numbered
+	for _, meta := range metas {
+		if meta.Seq <= changeLog.Seq && (since == 0 || meta.Seq > since) {
+			changes.Changed = append(changes.Changed, meta)
+		}
+	}
+
+	if since == 0 {
+		return changes, nil
+	}
+
+	for _, deleted := range changeLog.Deletions {
+		if deleted.Seq > since {
+			changes.Deleted = append(changes.Deleted, deleted.ID)
+		}
+	}
+
+	return changes, nil
+}
+
+// commitChange numbers a change of the media of the owner, which apply commits. The change log
+// is locked until the change is committed, so its number is only visible once the change is.
+// If deleted is set, the change deletes the media with that ID.
+func (mediaSvc BlobMediaService) commitChange(
+	ctx context.Context,
+	owner string,
+	deleted domain.MediaID,
+	apply func(seq int64) error,
+) error {
+	id := changeLogBlobID(owner)
+
+	unlock, err := mediaSvc.changesRepo.Lock(ctx, id, true)
+	if err != nil {
+		return fmt.Errorf("lock changes: %w", err)
+	}
+	defer unlock()
+
+	changeLog, err := mediaSvc.fetchChangeLog(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	changeLog.Seq++
+
+	if err := apply(changeLog.Seq); err != nil {
+		return err
+	}
+
+	if deleted != "" {
+		changeLog.Deletions = append(changeLog.Deletions, deletion{Seq: changeLog.Seq, ID: deleted})
+
+		// Clients with a number before the oldest kept deletion list all media again
+		if excess := len(changeLog.Deletions) - mediaSvc.cfg.ChangeLogDeletions; excess > 0 {
+			changeLog.Pruned = changeLog.Deletions[excess-1].Seq
+			changeLog.Deletions = changeLog.Deletions[excess:]
+		}
+	}
+
+	data, err := json.Marshal(changeLog)
+	if err != nil {
+		return fmt.Errorf("marshal changes: %w", err)
+	}
+
+	if err := mediaSvc.changesRepo.Store(ctx, domain.NewBlob(id, data)); err != nil {
+		return fmt.Errorf("store changes: %w", err)
+	}
+
+	return nil
+}
+
+// fetchChangeLogLocked fetches the change log of the owner under a shared lock.
+func (mediaSvc BlobMediaService) fetchChangeLogLocked(ctx context.Context, owner string) (mediaChangeLog, error) {
+	unlock, err := mediaSvc.changesRepo.Lock(ctx, changeLogBlobID(owner), false)
+	if err != nil {
+		return mediaChangeLog{}, fmt.Errorf("lock changes: %w", err)
+	}
+	defer unlock()
+
+	return mediaSvc.fetchChangeLog(ctx, owner)
+}
+
+// fetchChangeLog returns the change log of the owner, or an empty log if none is stored.
+// The caller must hold a lock on the change log blob.
+func (mediaSvc BlobMediaService) fetchChangeLog(ctx context.Context, owner string) (mediaChangeLog, error) {
+	var changes mediaChangeLog
+
+	id := changeLogBlobID(owner)
+	if !mediaSvc.changesRepo.Exists(ctx, id) {
+		return changes, nil
+	}
+
+	changesBlob, err := mediaSvc.changesRepo.Fetch(ctx, id)
+	if err != nil {
+		return mediaChangeLog{}, fmt.Errorf("fetch changes: %w", err)
+	}
+
+	if err := json.Unmarshal(changesBlob.Bytes(), &changes); err != nil {
+		return mediaChangeLog{}, fmt.Errorf("unmarshal changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// changeLogBlobID returns the ID of the blob holding the change log of the owner.
+func changeLogBlobID(owner string) domain.BlobID {
+	sum := sha256.Sum256([]byte("changes/" + owner))
+
+	return domain.BlobID(encoding.EncodeCrockfordB32LC(sum[:]))
+}
@@ -0,0 +1,85 @@
+package mediasvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/repo/metaindex"
+)
+
+// SetIndex sets the metadata index kept in sync with the metadata blobs.
+// Listings and hash lookups are answered by the index if set.
+func (mediaSvc *BlobMediaService) SetIndex(index metaindex.Index) {
+	mediaSvc.index = index
+}
+
+// RebuildIndex replaces the contents of the metadata index by the metadata of all stored media.
+// Returns the number of indexed media.
+func (mediaSvc BlobMediaService) RebuildIndex(ctx context.Context) (count int, err error) {
+	log := mediaSvc.log
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "media index rebuild failed", "error", err)
+		} else {
+			log.InfoContext(ctx, "media index rebuilt", "count", count)
+		}
+	}()
+
+	if mediaSvc.index == nil {
+		return 0, nil
+	}
+
+	metaIDs, err := mediaSvc.metaRepo.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list meta: %w", err)
+	}
+
+	if err := mediaSvc.index.Reset(ctx); err != nil {
+		return 0, fmt.Errorf("reset index: %w", err)
+	}
+
+	for _, metaID := range metaIDs {
+		mediaMeta, err := mediaSvc.fetchMetaLocked(ctx, metaID)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted while rebuilding
+			continue
+		} else if err != nil {
+			return count, fmt.Errorf("fetch meta: %w", err)
+		}
+
+		if err := mediaSvc.index.Put(ctx, mediaMeta); err != nil {
+			return count, fmt.Errorf("index put: %w", err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// indexPut adds the metadata to the index, if any. The metadata blobs are authoritative,
+// so failures are logged only and fixed by rebuilding the index.
+func (mediaSvc BlobMediaService) indexPut(ctx context.Context, mediaMeta domain.MediaMeta) {
+	if mediaSvc.index == nil {
+		return
+	}
+
+	if err := mediaSvc.index.Put(ctx, mediaMeta); err != nil {
+		mediaSvc.log.WarnContext(ctx, "media index put failed", "id", mediaMeta.ID, "error", err)
+	}
+}
+
+// indexDelete removes the media from the index, if any. Failures are logged only.
+func (mediaSvc BlobMediaService) indexDelete(ctx context.Context, mediaID domain.MediaID) {
+	if mediaSvc.index == nil {
+		return
+	}
+
+	if err := mediaSvc.index.Delete(ctx, mediaID); err != nil {
+		mediaSvc.log.WarnContext(ctx, "media index delete failed", "id", mediaID, "error", err)
+	}
+}
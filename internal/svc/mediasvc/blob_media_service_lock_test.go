@@ -0,0 +1,266 @@
+//go:build integration || all
+
+package mediasvc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
+	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+)
+
+// lockHelperEnv names the storage directory of a helper process spawned by
+// TestBlobMediaService_ConcurrentLocking, and lockHelperSeedEnv the seed of its operations.
+const (
+	lockHelperEnv     = "MEDIASVC_LOCK_HELPER_BASEDIR"
+	lockHelperSeedEnv = "MEDIASVC_LOCK_HELPER_SEED"
+)
+
+const (
+	lockWorkers    = 8                 // Goroutines per process
+	lockOperations = 200               // Operations per goroutine
+	lockProcesses  = 2                 // Helper processes besides the test process
+	lockTimeout    = 2 * time.Minute   // Deadline after which the operations count as deadlocked
+	lockOwner      = "testuser"        // Owner of all media
+	lockContents   = 3                 // Distinct contents, each shared by lockFilenames media
+	lockFilenames  = 3                 // Filenames per content
+	lockDataSize   = 64 * 1024         // Size of each content, large enough for torn writes to show
+	lockMaxSize    = 16 * lockDataSize // MaxSize of the media service
+)
+
+// lockTestMedia returns the overlapping media of the lock tests: every content is stored
+// under several filenames, so their media share the data blob and its backrefs.
+func lockTestMedia() []domain.Media {
+	var media []domain.Media
+
+	for c := range lockContents {
+		data := bytes.Repeat([]byte{byte('a' + c)}, lockDataSize)
+
+		for f := range lockFilenames {
+			media = append(media, domain.NewMedia(data, domain.MediaMeta{
+				Filename: fmt.Sprintf("file-%d.bin", f),
+				MIMEType: "application/octet-stream",
+				Owner:    lockOwner,
+			}))
+		}
+	}
+
+	return media
+}
+
+func newFileSystemMediaService(t *testing.T, basedir string) *mediasvc.BlobMediaService {
+	t.Helper()
+
+	svc, err := mediasvc.NewBlobMediaService(context.Background(),
+		blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: basedir}),
+		mediasvc.MediaConfig{MaxSize: lockMaxSize})
+	if err != nil {
+		t.Fatalf("failed to create media service: %v", err)
+	}
+
+	return svc
+}
+
+// hammerMediaService runs random concurrent stores, fetches and deletes of the lock test media.
+// Fetches and deletes of media deleted concurrently fail as not found, any other error or
+// content mismatch is reported.
+func hammerMediaService(t *testing.T, svc *mediasvc.BlobMediaService, seed uint64) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context_.WithUsername(context.Background(), lockOwner), lockTimeout)
+	defer cancel()
+
+	media := lockTestMedia()
+
+	var wg sync.WaitGroup
+
+	for worker := range lockWorkers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewPCG(seed, uint64(worker))) //nolint:gosec
+
+			for range lockOperations {
+				m := media[rng.IntN(len(media))]
+
+				switch op := rng.IntN(3); op {
+				case 0:
+					if err := svc.Store(ctx, m); err != nil {
+						t.Errorf("Store(%s) error = %v", m.ID(), err)
+					}
+				case 1:
+					fetched, err := svc.Fetch(ctx, m.ID())
+					if err != nil && !errors.Is(err, fs.ErrNotExist) {
+						t.Errorf("Fetch(%s) error = %v", m.ID(), err)
+					} else if err == nil && !bytes.Equal(fetched.Bytes(), m.Bytes()) {
+						t.Errorf("Fetch(%s) returned corrupted content", m.ID())
+					}
+				default:
+					if _, err := svc.Delete(ctx, m.ID()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						t.Errorf("Delete(%s) error = %v", m.ID(), err)
+					}
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("operations did not finish within %s, deadlocked", lockTimeout)
+	}
+}
+
+// TestBlobMediaService_LockHelper runs the operations of a helper process spawned by
+// TestBlobMediaService_ConcurrentLocking. It is skipped when run directly.
+func TestBlobMediaService_LockHelper(t *testing.T) {
+	basedir := os.Getenv(lockHelperEnv)
+	if basedir == "" {
+		t.Skip("only run as helper process")
+	}
+
+	seed, err := strconv.ParseUint(os.Getenv(lockHelperSeedEnv), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid seed: %v", err)
+	}
+
+	hammerMediaService(t, newFileSystemMediaService(t, basedir), seed)
+}
+
+func TestBlobMediaService_ConcurrentLocking(t *testing.T) {
+	t.Parallel()
+
+	basedir := t.TempDir()
+	svc := newFileSystemMediaService(t, basedir)
+
+	// Helper processes operate on the same storage, locking it via the file system only
+	helpers := make([]*exec.Cmd, lockProcesses)
+	outputs := make([]bytes.Buffer, lockProcesses)
+
+	for i := range helpers {
+		helpers[i] = exec.Command(os.Args[0], "-test.run=^TestBlobMediaService_LockHelper$", "-test.count=1") //nolint:gosec
+		helpers[i].Env = append(os.Environ(), lockHelperEnv+"="+basedir, lockHelperSeedEnv+"="+strconv.Itoa(i+1))
+		helpers[i].Stdout = &outputs[i]
+		helpers[i].Stderr = &outputs[i]
+
+		if err := helpers[i].Start(); err != nil {
+			t.Fatalf("failed to start helper process: %v", err)
+		}
+	}
+
+	hammerMediaService(t, svc, 0)
+
+	for i, helper := range helpers {
+		if err := helper.Wait(); err != nil {
+			t.Errorf("helper process %d failed: %v\n%s", i, err, outputs[i].String())
+		}
+	}
+
+	verifyMediaStorage(t, svc, basedir)
+}
+
+// verifyMediaStorage checks the consistency of the stored media: every meta references
+// stored data with the original content, every data blob is referenced by exactly the
+// metas of its backrefs, and no data blob is left without backrefs.
+func verifyMediaStorage(t *testing.T, svc *mediasvc.BlobMediaService, basedir string) {
+	t.Helper()
+
+	ctx := context_.WithAdminAccess(context_.WithUsername(context.Background(), lockOwner))
+	factory := blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: basedir})
+
+	dataRepo, err := factory(ctx, "data", "bin")
+	if err != nil {
+		t.Fatalf("failed to open data repository: %v", err)
+	}
+
+	backrefRepo, err := factory(ctx, "data", "txt")
+	if err != nil {
+		t.Fatalf("failed to open backref repository: %v", err)
+	}
+
+	metas, err := svc.ListAll(ctx)
+	if err != nil {
+		t.Fatalf("ListAll() error = %v", err)
+	}
+
+	// The metas referencing each data blob
+	referenced := make(map[domain.BlobID][]domain.BlobID)
+
+	for _, meta := range metas {
+		referenced[domain.BlobID(meta.Hash)] = append(referenced[domain.BlobID(meta.Hash)], meta.ID)
+
+		media, err := svc.Fetch(ctx, meta.ID)
+		if err != nil {
+			t.Errorf("Fetch(%s) of listed media error = %v", meta.ID, err)
+
+			continue
+		}
+
+		if i := slices.IndexFunc(lockTestMedia(), func(m domain.Media) bool { return m.ID() == meta.ID }); i < 0 ||
+			!bytes.Equal(media.Bytes(), lockTestMedia()[i].Bytes()) {
+			t.Errorf("Fetch(%s) returned corrupted content", meta.ID)
+		}
+	}
+
+	dataIDs, err := dataRepo.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list data: %v", err)
+	}
+
+	for _, dataID := range dataIDs {
+		wantRefs := referenced[dataID]
+		if len(wantRefs) == 0 {
+			t.Errorf("data %s is not referenced by any meta", dataID)
+
+			continue
+		}
+
+		backrefBlob, err := backrefRepo.Fetch(ctx, dataID)
+		if err != nil {
+			t.Errorf("backrefs of data %s lost: %v", dataID, err)
+
+			continue
+		}
+
+		var gotRefs []domain.BlobID
+		for _, ref := range bytes.Split(backrefBlob.Bytes(), []byte("\n")) {
+			gotRefs = append(gotRefs, domain.BlobID(ref))
+		}
+
+		slices.Sort(gotRefs)
+		slices.Sort(wantRefs)
+
+		if !slices.Equal(gotRefs, wantRefs) {
+			t.Errorf("backrefs of data %s = %v, want %v", dataID, gotRefs, wantRefs)
+		}
+	}
+
+	for dataID := range referenced {
+		if !slices.Contains(dataIDs, dataID) {
+			t.Errorf("data %s referenced by metas %v is missing", dataID, referenced[dataID])
+		}
+	}
+}
@@ -1,17 +1,31 @@
 package mediasvc_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
 	context_ "github.com/mkrupp/homecase-michael/internal/infra/context"
 	"github.com/mkrupp/homecase-michael/internal/repo/blob"
+	"github.com/mkrupp/homecase-michael/internal/repo/metaindex"
 	"github.com/mkrupp/homecase-michael/internal/svc/mediasvc"
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
 )
 
+// testNow is the time of the fake clock of media services under test.
+//
+//nolint:gochecknoglobals
+var testNow = time.Date(2024, time.June, 30, 23, 0, 0, 0, time.UTC)
+
 type mockRepository struct {
 	blobs     map[domain.BlobID][]byte
 	m         *sync.Mutex
@@ -38,6 +52,20 @@ func (m *mockRepository) Store(_ context.Context, blob *domain.Blob) error {
 	return nil
 }
 
+func (m *mockRepository) StoreFrom(_ context.Context, id domain.BlobID, r io.Reader) (int64, error) {
+	if m.storeErr != nil {
+		return 0, m.storeErr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.blobs[id] = data
+	return int64(len(data)), nil
+}
+
 func (m *mockRepository) Fetch(_ context.Context, id domain.BlobID) (*domain.Blob, error) {
 	if m.fetchErr != nil {
 		return nil, m.fetchErr
@@ -59,6 +87,12 @@ func (m *mockRepository) Delete(_ context.Context, id domain.BlobID) error {
 	return nil
 }
 
+func (m *mockRepository) List(_ context.Context) ([]domain.BlobID, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	return slices.Collect(maps.Keys(m.blobs)), nil
+}
+
 func (m *mockRepository) DeleteAll(_ context.Context, _ domain.BlobID, _ string) error {
 	if m.deleteErr != nil {
 		return m.deleteErr
@@ -105,6 +139,8 @@ func setupMediaService(t *testing.T) (*mediasvc.BlobMediaService, *mockRepositor
 		t.Fatalf("failed to create media service: %v", err)
 	}
 
+	svc.SetClock(clock.NewFake(testNow))
+
 	return svc, dataRepo, metaRepo, backrefRepo
 }
 
@@ -171,6 +207,50 @@ func TestBlobMediaService_Store(t *testing.T) {
 	}
 }
 
+func TestBlobMediaService_StoreFrom(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("streamed data")
+	hasher := domain.NewContentHasher()
+	_, _ = hasher.Write(content)
+
+	meta := domain.MediaMeta{Filename: "test.txt", Owner: "testuser"}.WithContent(hasher.Hash(), hasher.Size())
+
+	tests := []struct {
+		name     string
+		content  []byte
+		wantErr  error
+		wantData bool
+	}{
+		{name: "matching content", content: content, wantErr: nil, wantData: true},
+		{name: "changed content", content: []byte("changed data!"), wantErr: domain.ErrContentMismatch},
+		{name: "truncated content", content: content[:4], wantErr: domain.ErrContentMismatch},
+		{name: "extended content", content: append(slices.Clone(content), '!'), wantErr: domain.ErrContentMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, dataRepo, metaRepo, _ := setupMediaService(t)
+			ctx := context_.WithUsername(context.Background(), "testuser")
+
+			err := svc.StoreFrom(ctx, meta, bytes.NewReader(tt.content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("StoreFrom() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := dataRepo.Exists(ctx, domain.BlobID(meta.Hash)); got != tt.wantData {
+				t.Errorf("data stored = %t, want %t", got, tt.wantData)
+			}
+
+			if got := metaRepo.Exists(ctx, meta.ID); got != tt.wantData {
+				t.Errorf("meta stored = %t, want %t", got, tt.wantData)
+			}
+		})
+	}
+}
+
 func TestBlobMediaService_Fetch(t *testing.T) {
 	t.Parallel()
 
@@ -314,7 +394,7 @@ func TestBlobMediaService_Delete(t *testing.T) {
 			backrefRepo.deleteErr = tt.backrefErr
 
 			ctx := context_.WithUsername(context.Background(), tt.username)
-			pruned, dataID, err := svc.Delete(ctx, tt.mediaID)
+			result, err := svc.Delete(ctx, tt.mediaID)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Delete() error = %v, wantErr %v", err, tt.wantErr)
@@ -322,8 +402,17 @@ func TestBlobMediaService_Delete(t *testing.T) {
 			}
 
 			if err == nil {
-				if pruned {
-					if dataRepo.Exists(ctx, dataID) {
+				if result.MetaID != tt.mediaID {
+					t.Errorf("Delete() MetaID = %q, want %q", result.MetaID, tt.mediaID)
+				}
+				if result.DataID != domain.BlobID(testMedia.Hash()) {
+					t.Errorf("Delete() DataID = %q, want %q", result.DataID, testMedia.Hash())
+				}
+				if !result.Pruned {
+					t.Error("Delete() Pruned = false, want true for unshared content")
+				}
+				if result.Pruned {
+					if dataRepo.Exists(ctx, result.DataID) {
 						t.Error("data blob was not deleted")
 					}
 				}
@@ -334,3 +423,479 @@ func TestBlobMediaService_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestBlobMediaService_Usage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cap       int64
+		downloads []int64
+		wantBytes int64
+		wantErr   error
+	}{
+		{name: "no downloads", cap: 100, wantBytes: 0},
+		{name: "below cap", cap: 100, downloads: []int64{40, 50}, wantBytes: 90},
+		{name: "cap reached", cap: 100, downloads: []int64{60, 40}, wantBytes: 100, wantErr: domain.ErrDownloadCapExceeded},
+		{name: "unlimited", cap: 0, downloads: []int64{1000}, wantBytes: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			factory := func(ctx context.Context, name string, ext string) (blob.Repository, error) {
+				return newMockRepo(), nil
+			}
+
+			svc, err := mediasvc.NewBlobMediaService(context.Background(), factory, mediasvc.MediaConfig{
+				MaxSize:            1024,
+				MonthlyDownloadCap: tt.cap,
+			})
+			if err != nil {
+				t.Fatalf("failed to create media service: %v", err)
+			}
+
+			clk := clock.NewFake(testNow)
+			svc.SetClock(clk)
+
+			ctx := context.Background()
+
+			for _, size := range tt.downloads {
+				if err := svc.RecordDownload(ctx, "testuser", size); err != nil {
+					t.Fatalf("RecordDownload() error = %v", err)
+				}
+			}
+
+			usage, err := svc.Usage(ctx, "testuser")
+			if err != nil {
+				t.Fatalf("Usage() error = %v", err)
+			}
+
+			if usage.DownloadBytes != tt.wantBytes || usage.Downloads != int64(len(tt.downloads)) {
+				t.Errorf("Usage() = %+v, want %d bytes in %d downloads", usage, tt.wantBytes, len(tt.downloads))
+			}
+
+			if err := svc.CheckDownloadCap(ctx, "testuser"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckDownloadCap() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err := svc.CheckDownloadCap(ctx, "otheruser"); err != nil {
+				t.Errorf("CheckDownloadCap() of other user error = %v, want nil", err)
+			}
+
+			// Usage is accounted per month
+			clk.Advance(time.Hour)
+
+			if usage, err := svc.Usage(ctx, "testuser"); err != nil || usage.Downloads != 0 {
+				t.Errorf("Usage() in next month = %+v, %v, want no downloads", usage, err)
+			}
+
+			if err := svc.CheckDownloadCap(ctx, "testuser"); err != nil {
+				t.Errorf("CheckDownloadCap() in next month error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestBlobMediaService_List(t *testing.T) {
+	t.Parallel()
+
+	svc, _, _, _ := setupMediaService(t)
+
+	owned := []domain.Media{
+		domain.NewMedia([]byte("first"), domain.MediaMeta{Filename: "a.txt", Owner: "testuser"}),
+		domain.NewMedia([]byte("second"), domain.MediaMeta{Filename: "b.txt", Owner: "testuser"}),
+	}
+	foreign := domain.NewMedia([]byte("first"), domain.MediaMeta{Filename: "a.txt", Owner: "otheruser"})
+
+	for _, media := range append(owned, foreign) {
+		ctx := context_.WithUsername(context.Background(), media.Owner())
+		if err := svc.Store(ctx, media); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	ctx := context_.WithUsername(context.Background(), "testuser")
+
+	metas, err := svc.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if len(metas) != len(owned) {
+		t.Fatalf("List() returned %d media, want %d", len(metas), len(owned))
+	}
+
+	for _, meta := range metas {
+		if meta.Owner != "testuser" {
+			t.Errorf("List() returned media of %q", meta.Owner)
+		}
+
+		if meta.Modified != testNow.UnixMilli() {
+			t.Errorf("List() returned media %q stored at %d, want %d", meta.ID, meta.Modified, testNow.UnixMilli())
+		}
+	}
+
+	if _, err := svc.List(context.Background()); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Errorf("List() without user error = %v, want %v", err, domain.ErrUnauthorized)
+	}
+}
+
+func TestBlobMediaService_Index(t *testing.T) {
+	t.Parallel()
+
+	svc, _, _, _ := setupMediaService(t)
+
+	index, err := metaindex.NewSQLiteIndex(metaindex.SQLiteIndexConfig{
+		DatabasePath: filepath.Join(t.TempDir(), "index.db"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	t.Cleanup(func() { _ = index.Close() })
+
+	ctx := context_.WithUsername(context.Background(), "testuser")
+	first := domain.NewMedia([]byte("first"), domain.MediaMeta{Filename: "a.txt", Owner: "testuser"})
+	second := domain.NewMedia([]byte("second"), domain.MediaMeta{Filename: "b.txt", Owner: "testuser"})
+
+	// Stored before the index is set, so only known after a rebuild
+	if err := svc.Store(ctx, first); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	svc.SetIndex(index)
+
+	if count, err := svc.RebuildIndex(ctx); err != nil || count != 1 {
+		t.Fatalf("RebuildIndex() = %d, %v, want 1, nil", count, err)
+	}
+
+	if err := svc.Store(ctx, second); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if metas, err := svc.List(ctx); err != nil || len(metas) != 2 {
+		t.Fatalf("List() = %v, %v, want 2 media", metas, err)
+	}
+
+	if _, err := svc.Delete(ctx, first.ID()); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	metas, err := svc.FindByHash(ctx, second.Hash())
+	if err != nil || len(metas) != 1 || metas[0].ID != second.ID() {
+		t.Errorf("FindByHash() = %v, %v, want %q", metas, err, second.ID())
+	}
+
+	if metas, err := svc.FindByHash(ctx, first.Hash()); err != nil || len(metas) != 0 {
+		t.Errorf("FindByHash() of deleted media = %v, %v, want none", metas, err)
+	}
+}
+
+func TestBlobMediaService_FindByOriginalHash(t *testing.T) {
+	t.Parallel()
+
+	hasher := domain.NewContentHasher()
+	_, _ = hasher.Write([]byte("uploaded"))
+	originalHash := hasher.Hash()
+
+	tests := []struct {
+		name    string
+		indexed bool
+	}{
+		{"without index", false},
+		{"with index", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, _, _, _ := setupMediaService(t)
+
+			if tt.indexed {
+				index, err := metaindex.NewSQLiteIndex(metaindex.SQLiteIndexConfig{
+					DatabasePath: filepath.Join(t.TempDir(), "index.db"),
+				})
+				if err != nil {
+					t.Fatalf("failed to create index: %v", err)
+				}
+				t.Cleanup(func() { _ = index.Close() })
+
+				svc.SetIndex(index)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "testuser")
+			processed := domain.NewMedia([]byte("processed"), domain.MediaMeta{
+				Filename: "a.jpg", Owner: "testuser", OriginalSize: 8, OriginalHash: originalHash,
+			})
+
+			if err := svc.Store(ctx, processed); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			for _, hash := range []string{processed.Hash(), originalHash} {
+				metas, err := svc.FindByHash(ctx, hash)
+				if err != nil || len(metas) != 1 || metas[0].ID != processed.ID() || metas[0].OriginalHash != originalHash {
+					t.Errorf("FindByHash(%q) = %v, %v, want %q", hash, metas, err, processed.ID())
+				}
+			}
+
+			otherCtx := context_.WithUsername(context.Background(), "otheruser")
+			if metas, err := svc.FindByHash(otherCtx, originalHash); err != nil || len(metas) != 0 {
+				t.Errorf("FindByHash() of other user = %v, %v, want none", metas, err)
+			}
+		})
+	}
+}
+
+func TestBlobMediaService_StoreConcurrent(t *testing.T) {
+	t.Parallel()
+
+	svc, err := mediasvc.NewBlobMediaService(context.Background(),
+		blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()}),
+		mediasvc.MediaConfig{MaxSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("failed to create media service: %v", err)
+	}
+
+	const uploads = 8
+
+	ctx := context_.WithUsername(context.Background(), "testuser")
+	data := []byte("same content")
+	same := domain.NewMedia(data, domain.MediaMeta{Filename: "same.txt", Owner: "testuser"})
+
+	// Half of the uploads are identical, the other half share the content under other names
+	media := make([]domain.Media, 0, 2*uploads)
+	for i := range uploads {
+		media = append(media, same,
+			domain.NewMedia(data, domain.MediaMeta{Filename: fmt.Sprintf("copy-%d.txt", i), Owner: "testuser"}))
+	}
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(media))
+	for i, m := range media {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			errs[i] = svc.Store(ctx, m)
+		}()
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	metas, err := svc.List(ctx)
+	if err != nil || len(metas) != uploads+1 {
+		t.Fatalf("List() = %d media, %v, want %d", len(metas), err, uploads+1)
+	}
+
+	// Every media holds exactly one backref, so only deleting the last one prunes the content
+	for i, meta := range metas {
+		result, err := svc.Delete(ctx, meta.ID)
+		if err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		if last := i == len(metas)-1; result.Pruned != last {
+			t.Errorf("Delete() of media %d pruned = %v, want %v", i, result.Pruned, last)
+		}
+	}
+}
+
+func TestBlobMediaService_StoreRepairsBackrefs(t *testing.T) {
+	t.Parallel()
+
+	svc, dataRepo, _, backrefRepo := setupMediaService(t)
+
+	ctx := context_.WithUsername(context.Background(), "testuser")
+	first := domain.NewMedia([]byte("shared"), domain.MediaMeta{Filename: "a.txt", Owner: "testuser"})
+	second := domain.NewMedia([]byte("shared"), domain.MediaMeta{Filename: "b.txt", Owner: "testuser"})
+
+	if err := svc.Store(ctx, first); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// An interrupted store leaves the meta without backref, which storing again repairs
+	_ = backrefRepo.Delete(ctx, domain.BlobID(first.Hash()))
+
+	for _, m := range []domain.Media{first, first, second} {
+		if err := svc.Store(ctx, m); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+
+	if result, err := svc.Delete(ctx, second.ID()); err != nil || result.Pruned {
+		t.Fatalf("Delete() = %+v, %v, want content kept for the first media", result, err)
+	}
+
+	if !dataRepo.Exists(ctx, domain.BlobID(first.Hash())) {
+		t.Fatal("data of the first media was deleted")
+	}
+
+	if result, err := svc.Delete(ctx, first.ID()); err != nil || !result.Pruned {
+		t.Errorf("Delete() = %+v, %v, want content pruned", result, err)
+	}
+}
+
+func TestBlobMediaService_ListChanges(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		indexed bool
+	}{
+		{"without index", false},
+		{"with index", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := mediasvc.NewBlobMediaService(context.Background(),
+				blob.FileSystemBlobRepositoryFactory(blob.FileSystemBlobRepositoryConfig{Basedir: t.TempDir()}),
+				mediasvc.MediaConfig{MaxSize: 1024 * 1024, ChangeLogDeletions: 1})
+			if err != nil {
+				t.Fatalf("failed to create media service: %v", err)
+			}
+
+			if tt.indexed {
+				index, err := metaindex.NewSQLiteIndex(metaindex.SQLiteIndexConfig{
+					DatabasePath: filepath.Join(t.TempDir(), "index.db"),
+				})
+				if err != nil {
+					t.Fatalf("failed to create index: %v", err)
+				}
+				t.Cleanup(func() { _ = index.Close() })
+
+				svc.SetIndex(index)
+			}
+
+			ctx := context_.WithUsername(context.Background(), "testuser")
+			media := make(map[string]domain.Media)
+
+			for _, name := range []string{"a", "b", "c"} {
+				media[name] = domain.NewMedia([]byte(name), domain.MediaMeta{Filename: name + ".txt", Owner: "testuser"})
+			}
+
+			// steps change the media in order, listing the changes after since after each step
+			steps := []struct {
+				name        string
+				change      func() error
+				since       int64
+				wantSeq     int64
+				wantChanged []string
+				wantDeleted []string
+				wantErr     error
+			}{
+				{
+					name:   "store a",
+					change: func() error { return svc.Store(ctx, media["a"]) },
+					since:  0, wantSeq: 1, wantChanged: []string{"a"},
+				},
+				{
+					name:   "store b",
+					change: func() error { return svc.Store(ctx, media["b"]) },
+					since:  1, wantSeq: 2, wantChanged: []string{"b"},
+				},
+				{
+					name:   "list all",
+					change: func() error { return nil },
+					since:  0, wantSeq: 2, wantChanged: []string{"a", "b"},
+				},
+				{
+					name:   "store a again",
+					change: func() error { return svc.Store(ctx, media["a"]) },
+					since:  2, wantSeq: 2,
+				},
+				{
+					name: "delete a",
+					change: func() error {
+						_, err := svc.Delete(ctx, media["a"].ID())
+
+						return err
+					},
+					since: 2, wantSeq: 3, wantDeleted: []string{"a"},
+				},
+				{
+					name:   "store c",
+					change: func() error { return svc.Store(ctx, media["c"]) },
+					since:  2, wantSeq: 4, wantChanged: []string{"c"}, wantDeleted: []string{"a"},
+				},
+				{
+					name: "delete b",
+					change: func() error {
+						_, err := svc.Delete(ctx, media["b"].ID())
+
+						return err
+					},
+					since: 4, wantSeq: 5, wantDeleted: []string{"b"},
+				},
+				{
+					name:   "pruned deletion",
+					change: func() error { return nil },
+					since:  2, wantErr: domain.ErrChangesExpired,
+				},
+				{
+					name:   "unknown change",
+					change: func() error { return nil },
+					since:  6, wantErr: domain.ErrChangesExpired,
+				},
+			}
+
+			// The steps change the same media, so they run in order
+			for _, step := range steps {
+				if err := step.change(); err != nil {
+					t.Fatalf("%s: change error = %v", step.name, err)
+				}
+
+				changes, err := svc.ListChanges(ctx, step.since)
+				if !errors.Is(err, step.wantErr) {
+					t.Fatalf("%s: ListChanges(%d) error = %v, want %v", step.name, step.since, err, step.wantErr)
+				}
+
+				if step.wantErr != nil {
+					continue
+				}
+
+				if changes.Seq != step.wantSeq {
+					t.Errorf("%s: Seq = %d, want %d", step.name, changes.Seq, step.wantSeq)
+				}
+
+				var changed, deleted []string
+
+				for _, meta := range changes.Changed {
+					changed = append(changed, meta.Filename[:1])
+				}
+
+				for _, id := range changes.Deleted {
+					for name, m := range media {
+						if m.ID() == id {
+							deleted = append(deleted, name)
+						}
+					}
+				}
+
+				slices.Sort(changed)
+
+				if !slices.Equal(changed, step.wantChanged) || !slices.Equal(deleted, step.wantDeleted) {
+					t.Errorf("%s: changed %v, deleted %v, want %v, %v",
+						step.name, changed, deleted, step.wantChanged, step.wantDeleted)
+				}
+			}
+
+			// Changes of other users are not listed
+			otherCtx := context_.WithUsername(context.Background(), "otheruser")
+			if changes, err := svc.ListChanges(otherCtx, 0); err != nil || changes.Seq != 0 || len(changes.Changed) != 0 {
+				t.Errorf("ListChanges() of other user = %+v, %v, want none", changes, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package mediasvc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+	"github.com/mkrupp/homecase-michael/internal/infra/logging"
+	"github.com/mkrupp/homecase-michael/internal/util/encoding"
+)
+
+// usagePeriodLayout is the time layout of accounting periods.
+const usagePeriodLayout = "2006-01"
+
+// RecordDownload implements MediaService.RecordDownload.
+func (mediaSvc BlobMediaService) RecordDownload(ctx context.Context, username string, size int64) (err error) {
+	period := usagePeriod(mediaSvc.clock.Now())
+	log := mediaSvc.log.With(logging.Group("usage", "username", username, "period", period, "size", size))
+
+	defer func() {
+		if err != nil {
+			log.ErrorContext(ctx, "download record failed", "error", err)
+		} else {
+			log.DebugContext(ctx, "download recorded")
+		}
+	}()
+
+	id := usageBlobID(username, period)
+
+	unlock, err := mediaSvc.usageRepo.Lock(ctx, id, true)
+	if err != nil {
+		return fmt.Errorf("lock usage: %w", err)
+	}
+	defer unlock()
+
+	usage, err := mediaSvc.fetchUsage(ctx, username, period)
+	if err != nil {
+		return fmt.Errorf("fetch usage: %w", err)
+	}
+
+	usage.Downloads++
+	usage.DownloadBytes += size
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("marshal usage: %w", err)
+	}
+
+	if err := mediaSvc.usageRepo.Store(ctx, domain.NewBlob(id, data)); err != nil {
+		return fmt.Errorf("store usage: %w", err)
+	}
+
+	return nil
+}
+
+// Usage implements MediaService.Usage.
+func (mediaSvc BlobMediaService) Usage(ctx context.Context, username string) (domain.MediaUsage, error) {
+	period := usagePeriod(mediaSvc.clock.Now())
+
+	unlock, err := mediaSvc.usageRepo.Lock(ctx, usageBlobID(username, period), false)
+	if err != nil {
+		return domain.MediaUsage{}, fmt.Errorf("lock usage: %w", err)
+	}
+	defer unlock()
+
+	return mediaSvc.fetchUsage(ctx, username, period)
+}
+
+// CheckDownloadCap implements MediaService.CheckDownloadCap.
+func (mediaSvc BlobMediaService) CheckDownloadCap(ctx context.Context, username string) error {
+	if mediaSvc.cfg.MonthlyDownloadCap <= 0 {
+		return nil
+	}
+
+	usage, err := mediaSvc.Usage(ctx, username)
+	if err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+
+	if usage.DownloadBytes >= mediaSvc.cfg.MonthlyDownloadCap {
+		return fmt.Errorf("%w: %d of %d bytes downloaded in %s",
+			domain.ErrDownloadCapExceeded, usage.DownloadBytes, mediaSvc.cfg.MonthlyDownloadCap, usage.Period)
+	}
+
+	return nil
+}
+
+// DownloadCap implements MediaService.DownloadCap.
+func (mediaSvc BlobMediaService) DownloadCap() int64 {
+	return mediaSvc.cfg.MonthlyDownloadCap
+}
+
+// fetchUsage returns the stored usage of the user in the given period, or an empty usage if none is stored.
+// The caller must hold a lock on the usage blob.
+func (mediaSvc BlobMediaService) fetchUsage(
+	ctx context.Context,
+	username, period string,
+) (domain.MediaUsage, error) {
+	usage := domain.MediaUsage{Username: username, Period: period, Downloads: 0, DownloadBytes: 0}
+
+	id := usageBlobID(username, period)
+	if !mediaSvc.usageRepo.Exists(ctx, id) {
+		return usage, nil
+	}
+
+	usageBlob, err := mediaSvc.usageRepo.Fetch(ctx, id)
+	if err != nil {
+		return domain.MediaUsage{}, fmt.Errorf("fetch usage: %w", err)
+	}
+
+	if err := json.Unmarshal(usageBlob.Bytes(), &usage); err != nil {
+		return domain.MediaUsage{}, fmt.Errorf("unmarshal usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// usagePeriod returns the accounting period containing t.
+func usagePeriod(t time.Time) string {
+	return t.UTC().Format(usagePeriodLayout)
+}
+
+// usageBlobID returns the ID of the blob holding the usage of the user in the given period.
+func usageBlobID(username, period string) domain.BlobID {
+	sum := sha256.Sum256([]byte(username + "/" + period))
+
+	return domain.BlobID(encoding.EncodeCrockfordB32LC(sum[:]))
+}
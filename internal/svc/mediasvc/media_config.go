@@ -5,4 +5,12 @@ type MediaConfig struct {
 	// MaxSize is the maximum allowed file size for uploaded images in bytes.
 	// Default is 20MB.
 	MaxSize int64 `env:"MAX_SIZE" default:"20971520"`
+
+	// MonthlyDownloadCap is the maximum number of bytes a user may download per calendar month (UTC).
+	// Default is 0 (unlimited).
+	MonthlyDownloadCap int64 `env:"MONTHLY_DOWNLOAD_CAP" default:"0"`
+
+	// ChangeLogDeletions is the number of deletions kept per user for listing changes. Clients
+	// listing the changes after an older deletion have to list all media again. Default is 10000.
+	ChangeLogDeletions int `env:"CHANGE_LOG_DELETIONS" default:"10000"`
 }
@@ -2,10 +2,25 @@ package mediasvc
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"github.com/mkrupp/homecase-michael/internal/domain"
 )
 
+// ErrMetaIdentityChanged is returned when a metadata update changes a field the media ID is derived from.
+var ErrMetaIdentityChanged = errors.New("media identity changed")
+
+// DeleteResult describes the outcome of deleting media.
+type DeleteResult struct {
+	// Pruned reports whether the media content was deleted because no other media references it.
+	Pruned bool
+	// DataID is the ID of the content blob, which is shared by all media with the same content.
+	DataID domain.BlobID
+	// MetaID is the ID of the deleted metadata blob, i.e. the ID of the media.
+	MetaID domain.MediaID
+}
+
 // MediaService defines the interface for managing media objects.
 type MediaService interface {
 	// Lock acquires an exclusive lock for the specified media.
@@ -13,19 +28,96 @@ type MediaService interface {
 	// The returned function must be called in a deferred statement to ensure the lock is released.
 	Lock(ctx context.Context, mediaID domain.MediaID) (func(), error)
 
-	// Store persists the given media object.
+	// Store persists the given media object. Storing media that is already stored, e.g. by
+	// concurrent uploads of the same content, succeeds and keeps the existing metadata.
 	// Returns an error if the operation fails or if the media exceeds configured size limits.
 	Store(ctx context.Context, media domain.Media) error
 
+	// StoreFrom persists media whose content is read from content instead of being held in memory,
+	// like Store. The metadata must carry the content hash and size, e.g. computed by a
+	// domain.ContentHasher while the content was staged (see domain.MediaMeta.WithContent).
+	// Returns domain.ErrContentMismatch if the content does not match them.
+	StoreFrom(ctx context.Context, meta domain.MediaMeta, content io.Reader) error
+
 	// Delete removes the media with the specified ID.
-	// Returns whether the media was found and deleted, the ID of the deleted media,
-	// and any error encountered during the operation.
-	Delete(ctx context.Context, mediaID domain.MediaID) (bool, domain.MediaID, error)
+	// Returns the IDs of the deleted blobs and whether the media content was pruned,
+	// or an error if the media was not found or if the operation fails.
+	Delete(ctx context.Context, mediaID domain.MediaID) (DeleteResult, error)
 
 	// Fetch retrieves the media with the specified ID.
+	// Access is granted to the owner, to the users the media is shared with, to any authenticated
+	// user presenting the share token of unlisted media (see context.WithShareToken) and to anyone
+	// for public media, and to contexts holding a grant for the media (see context.WithGrant).
 	// Returns the media object if found, or an error if not found or if the operation fails.
 	Fetch(ctx context.Context, mediaID domain.MediaID) (domain.Media, error)
 
+	// FetchMeta retrieves the metadata of the media with the specified ID, with the same access
+	// rules as Fetch, but without reading the media content.
+	FetchMeta(ctx context.Context, mediaID domain.MediaID) (domain.MediaMeta, error)
+
+	// Exists reports whether media with the specified ID is stored.
+	Exists(ctx context.Context, mediaID domain.MediaID) bool
+
+	// DataExists reports whether media content with the specified hash is stored.
+	DataExists(ctx context.Context, hash string) bool
+
+	// FindByHash returns the metadata of the media of the user in the context with the
+	// specified content hash, or whose content had that hash before it was processed on ingest.
+	// Media of other users is not revealed.
+	FindByHash(ctx context.Context, hash string) ([]domain.MediaMeta, error)
+
+	// List returns the metadata of all media of the user in the context.
+	List(ctx context.Context) ([]domain.MediaMeta, error)
+
+	// ListChanges returns the metadata of the media of the user in the context stored or updated
+	// after the change numbered since, and the IDs of the media deleted after it, along with the
+	// number of the latest change listed. Since 0 lists all media. Returns domain.ErrChangesExpired
+	// if the deletions after since are no longer kept or since is unknown.
+	ListChanges(ctx context.Context, since int64) (domain.MediaChanges, error)
+
+	// ListPage returns the metadata of at most limit media of the user in the context after the
+	// given position, ordered by storage time and ID.
+	ListPage(ctx context.Context, after domain.MediaPosition, limit int) ([]domain.MediaMeta, error)
+
+	// ListLocated returns the metadata of all media of the user in the context with a known location.
+	ListLocated(ctx context.Context) ([]domain.MediaMeta, error)
+
+	// ListAll returns the metadata of the media of all users.
+	// Requires admin access (see context.WithAdminAccess).
+	ListAll(ctx context.Context) ([]domain.MediaMeta, error)
+
+	// UpdateMeta replaces the metadata of stored media, e.g. after reprocessing it.
+	// Only the owner may update the metadata, and the fields the ID is derived from, i.e. the
+	// content hash, filename, MIME type and owner, must be unchanged (ErrMetaIdentityChanged).
+	UpdateMeta(ctx context.Context, mediaMeta domain.MediaMeta) error
+
+	// SetVisibility sets the visibility of the media with the specified ID. Only the owner may
+	// change it. Unlisted media is issued a random share token, which is revoked by any other
+	// visibility. Returns the updated metadata, or domain.ErrInvalidVisibility if it is undefined.
+	SetVisibility(ctx context.Context, mediaID domain.MediaID, visibility domain.MediaVisibility) (domain.MediaMeta, error)
+
+	// Share grants the user access to the media with the specified ID, regardless of its visibility.
+	// Only the owner may share media. Returns the updated metadata, or domain.ErrInvalidShareUser
+	// if the username is empty or the owner's.
+	Share(ctx context.Context, mediaID domain.MediaID, username string) (domain.MediaMeta, error)
+
+	// Unshare revokes the access granted to the user by Share. Only the owner may unshare media.
+	// Returns the updated metadata.
+	Unshare(ctx context.Context, mediaID domain.MediaID, username string) (domain.MediaMeta, error)
+
 	// MaxSize returns the maximum allowed file size for uploaded media in bytes.
 	MaxSize() int64
+
+	// RecordDownload adds a download of size bytes to the usage of the user in the current period.
+	RecordDownload(ctx context.Context, username string, size int64) error
+
+	// Usage returns the download usage of the user in the current period.
+	Usage(ctx context.Context, username string) (domain.MediaUsage, error)
+
+	// CheckDownloadCap returns domain.ErrDownloadCapExceeded if the user has exhausted
+	// the download cap of the current period.
+	CheckDownloadCap(ctx context.Context, username string) error
+
+	// DownloadCap returns the maximum number of bytes a user may download per period, or 0 if unlimited.
+	DownloadCap() int64
 }
@@ -0,0 +1,59 @@
+// Command errcatalog writes the catalog of client-facing error codes as Markdown.
+// The catalog covers all errors registered with domain.NewError by the services.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mkrupp/homecase-michael/internal/domain"
+
+	// Register the service errors
+	_ "github.com/mkrupp/homecase-michael/internal/svc/authsvc"
+	_ "github.com/mkrupp/homecase-michael/internal/svc/imagesvc"
+)
+
+const header = `# Error Codes
+
+<!-- This file is automatically generated by "make docs". Do not edit. -->
+
+Client-facing errors are identified by a stable code. The HTTP status is the status
+used by the services when the error is returned to a client. Retryable errors may
+succeed if the same request is sent again later.
+
+`
+
+func main() {
+	output := flag.String("o", "", "output file (default: stdout)")
+	flag.Parse()
+
+	if err := run(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(output string) error {
+	out := os.Stdout
+
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("create output: %w", err)
+		}
+		defer file.Close()
+
+		out = file
+	}
+
+	if _, err := out.WriteString(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	if err := domain.WriteErrorCatalog(out); err != nil {
+		return fmt.Errorf("write catalog: %w", err)
+	}
+
+	return nil
+}
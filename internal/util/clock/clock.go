@@ -0,0 +1,66 @@
+// Package clock provides the time source of services, so tests can control the current time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock returns the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the Clock of the system, returning time.Now.
+type Real struct{}
+
+var _ Clock = Real{}
+
+// Now returns the current system time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a Clock standing still at a set time until it is advanced, for deterministic tests.
+// It is safe for concurrent use.
+type Fake struct {
+	now time.Time
+	m   sync.Mutex
+}
+
+var _ Clock = (*Fake)(nil)
+
+// NewFake creates a Fake clock set to the given time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now: now,
+		m:   sync.Mutex{},
+	}
+}
+
+// Now returns the time the clock is set to.
+func (f *Fake) Now() time.Time {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.now
+}
+
+// Set sets the clock to the given time.
+func (f *Fake) Set(now time.Time) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.now = now
+}
+
+// Advance moves the clock forward by d, or backward if d is negative.
+// Returns the new time of the clock.
+func (f *Fake) Advance(d time.Duration) time.Time {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.now = f.now.Add(d)
+
+	return f.now
+}
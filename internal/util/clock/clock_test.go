@@ -0,0 +1,59 @@
+package clock_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/util/clock"
+)
+
+func TestReal(t *testing.T) {
+	t.Parallel()
+
+	before := time.Now()
+	now := clock.Real{}.Now()
+
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("Now() = %v, want between %v and now", now, before)
+	}
+}
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	if got := clk.Now(); !got.Equal(start) {
+		t.Fatalf("Now() = %v, want %v", got, start)
+	}
+
+	if got, want := clk.Advance(time.Hour), start.Add(time.Hour); !got.Equal(want) || !clk.Now().Equal(want) {
+		t.Errorf("Advance() = %v, Now() = %v, want %v", got, clk.Now(), want)
+	}
+
+	clk.Set(start)
+
+	if got := clk.Now(); !got.Equal(start) {
+		t.Errorf("Now() after Set() = %v, want %v", got, start)
+	}
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			clk.Advance(time.Second)
+		}()
+	}
+
+	wg.Wait()
+
+	if got, want := clk.Now(), start.Add(10*time.Second); !got.Equal(want) {
+		t.Errorf("Now() after concurrent Advance() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package semaphore
+
+import "sync"
+
+// KeyedSemaphore limits the number of concurrent holders per key,
+// e.g. the number of concurrent operations per user.
+// A limit of zero or less disables the limit.
+type KeyedSemaphore struct {
+	limit  int
+	m      sync.Mutex
+	active map[string]int
+}
+
+// NewKeyedSemaphore creates a new KeyedSemaphore allowing up to limit holders per key.
+func NewKeyedSemaphore(limit int) *KeyedSemaphore {
+	return &KeyedSemaphore{
+		limit:  limit,
+		m:      sync.Mutex{},
+		active: make(map[string]int),
+	}
+}
+
+// TryAcquire acquires a slot for the given key without blocking.
+// Returns a function to release the slot and true on success,
+// or a no-op function and false if the key has reached its limit.
+func (s *KeyedSemaphore) TryAcquire(key string) (func(), bool) {
+	if s.limit <= 0 {
+		return func() {}, true
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.active[key] >= s.limit {
+		return func() {}, false
+	}
+
+	s.active[key]++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { s.release(key) })
+	}, true
+}
+
+// Active returns the number of slots currently held for the given key.
+func (s *KeyedSemaphore) Active(key string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.active[key]
+}
+
+// Total returns the number of slots currently held for all keys.
+func (s *KeyedSemaphore) Total() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	total := 0
+	for _, active := range s.active {
+		total += active
+	}
+
+	return total
+}
+
+func (s *KeyedSemaphore) release(key string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.active[key] <= 1 {
+		delete(s.active, key)
+
+		return
+	}
+
+	s.active[key]--
+}
@@ -0,0 +1,60 @@
+package semaphore_test
+
+import (
+	"testing"
+
+	"github.com/mkrupp/homecase-michael/internal/util/semaphore"
+)
+
+func TestKeyedSemaphore_TryAcquire(t *testing.T) {
+	t.Parallel()
+
+	sem := semaphore.NewKeyedSemaphore(2)
+
+	release1, ok := sem.TryAcquire("alice")
+	if !ok {
+		t.Fatal("first acquire failed")
+	}
+
+	release2, ok := sem.TryAcquire("alice")
+	if !ok {
+		t.Fatal("second acquire failed")
+	}
+
+	if _, ok := sem.TryAcquire("alice"); ok {
+		t.Error("third acquire succeeded, want limit exceeded")
+	}
+
+	if _, ok := sem.TryAcquire("bob"); !ok {
+		t.Error("acquire for other key failed")
+	}
+
+	release1()
+	release1() // releasing twice must not free another slot
+
+	if got := sem.Active("alice"); got != 1 {
+		t.Errorf("Active() = %d, want 1", got)
+	}
+
+	if got := sem.Total(); got != 2 {
+		t.Errorf("Total() = %d, want 2", got)
+	}
+
+	if _, ok := sem.TryAcquire("alice"); !ok {
+		t.Error("acquire after release failed")
+	}
+
+	release2()
+}
+
+func TestKeyedSemaphore_Unlimited(t *testing.T) {
+	t.Parallel()
+
+	sem := semaphore.NewKeyedSemaphore(0)
+
+	for range 100 {
+		if _, ok := sem.TryAcquire("alice"); !ok {
+			t.Fatal("acquire failed on unlimited semaphore")
+		}
+	}
+}
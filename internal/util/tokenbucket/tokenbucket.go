@@ -0,0 +1,163 @@
+// Package tokenbucket implements token buckets for rate limiting.
+package tokenbucket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at a constant rate up to its burst size.
+type Bucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	updated time.Time
+	m       sync.Mutex
+}
+
+// New creates a full Bucket refilled with rate tokens per second and holding up to burst tokens.
+func New(rate, burst float64) *Bucket {
+	return &Bucket{
+		rate:    rate,
+		burst:   burst,
+		tokens:  burst,
+		updated: time.Now(),
+		m:       sync.Mutex{},
+	}
+}
+
+// Allow takes a token from the bucket if one is available at the given time.
+// Returns false and the time until the next token is available if the bucket is empty.
+func (b *Bucket) Allow(now time.Time) (time.Duration, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.refill(now)
+
+	if b.tokens < 1 {
+		return b.waitFor(1), false
+	}
+
+	b.tokens--
+
+	return 0, true
+}
+
+// Reserve takes n tokens from the bucket, which may become negative, at the given time.
+// Returns the time the caller must wait until the tokens are available.
+func (b *Bucket) Reserve(n float64, now time.Time) time.Duration {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.refill(now)
+	b.tokens -= n
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return b.waitFor(0)
+}
+
+// Wait takes n tokens from the bucket, blocking until they are available or the context is done.
+func (b *Bucket) Wait(ctx context.Context, n float64) error {
+	wait := b.Reserve(n, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("wait: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Idle returns the time since the bucket was last used.
+func (b *Bucket) Idle(now time.Time) time.Duration {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return now.Sub(b.updated)
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if now.After(b.updated) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+		b.updated = now
+	}
+}
+
+// waitFor returns the time until the bucket holds the given number of tokens.
+func (b *Bucket) waitFor(tokens float64) time.Duration {
+	return time.Duration((tokens - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Keyed is a set of token buckets with the same rate and burst size, e.g. one per user.
+// Buckets idle for longer than the idle timeout are dropped.
+type Keyed struct {
+	rate        float64
+	burst       float64
+	idleTimeout time.Duration
+	buckets     map[string]*Bucket
+	swept       time.Time
+	m           sync.Mutex
+}
+
+// NewKeyed creates a Keyed set of buckets, see New.
+func NewKeyed(rate, burst float64, idleTimeout time.Duration) *Keyed {
+	return &Keyed{
+		rate:        rate,
+		burst:       burst,
+		idleTimeout: idleTimeout,
+		buckets:     make(map[string]*Bucket),
+		swept:       time.Time{},
+		m:           sync.Mutex{},
+	}
+}
+
+// Get returns the bucket of the given key, creating a full bucket if there is none.
+func (k *Keyed) Get(key string, now time.Time) *Bucket {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	k.sweep(now)
+
+	bucket, ok := k.buckets[key]
+	if !ok {
+		bucket = New(k.rate, k.burst)
+		bucket.updated = now
+		k.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// Len returns the number of buckets.
+func (k *Keyed) Len() int {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	return len(k.buckets)
+}
+
+// sweep drops idle buckets, at most once per idle timeout.
+func (k *Keyed) sweep(now time.Time) {
+	if now.Sub(k.swept) < k.idleTimeout {
+		return
+	}
+
+	for key, bucket := range k.buckets {
+		if bucket.Idle(now) >= k.idleTimeout {
+			delete(k.buckets, key)
+		}
+	}
+
+	k.swept = now
+}
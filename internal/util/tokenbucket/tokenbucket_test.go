@@ -0,0 +1,99 @@
+package tokenbucket_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkrupp/homecase-michael/internal/util/tokenbucket"
+)
+
+func TestBucket_Allow(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	bucket := tokenbucket.NewKeyed(2, 2, time.Minute).Get("user", now)
+
+	for i := range 2 {
+		if _, ok := bucket.Allow(now); !ok {
+			t.Fatalf("Allow() #%d = false, want true", i)
+		}
+	}
+
+	wait, ok := bucket.Allow(now)
+	if ok {
+		t.Fatal("Allow() on empty bucket = true, want false")
+	}
+
+	if wait != 500*time.Millisecond {
+		t.Errorf("Allow() wait = %v, want %v", wait, 500*time.Millisecond)
+	}
+
+	if _, ok := bucket.Allow(now.Add(wait)); !ok {
+		t.Error("Allow() after refill = false, want true")
+	}
+}
+
+func TestBucket_Reserve(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	bucket := tokenbucket.NewKeyed(100, 100, time.Minute).Get("user", now)
+
+	tests := []struct {
+		name string
+		n    float64
+		at   time.Duration
+		want time.Duration
+	}{
+		{name: "within burst", n: 100, want: 0},
+		{name: "exceeds tokens", n: 50, want: 500 * time.Millisecond},
+		{name: "waits for debt", n: 50, at: 500 * time.Millisecond, want: 500 * time.Millisecond},
+		{name: "refilled", n: 10, at: 2 * time.Second, want: 0},
+	}
+
+	// The cases depend on each other and must run in order
+	for _, tt := range tests {
+		if got := bucket.Reserve(tt.n, now.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: Reserve(%v) = %v, want %v", tt.name, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBucket_Wait(t *testing.T) {
+	t.Parallel()
+
+	bucket := tokenbucket.New(1, 1)
+
+	if err := bucket.Wait(context.Background(), 1); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := bucket.Wait(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() on cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestKeyed_Sweep(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	keyed := tokenbucket.NewKeyed(1, 1, time.Minute)
+
+	keyed.Get("a", now)
+	keyed.Get("b", now.Add(30*time.Second))
+
+	if keyed.Get("a", now.Add(30*time.Second)); keyed.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", keyed.Len())
+	}
+
+	keyed.Get("c", now.Add(2*time.Minute))
+
+	if keyed.Len() != 1 {
+		t.Errorf("Len() after sweep = %d, want 1", keyed.Len())
+	}
+}